@@ -0,0 +1,261 @@
+package broker
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// An ACLRule grants or denies access to topics that match a filter.
+type ACLRule struct {
+	// The granted access. NoAccess denies all access to matching topics.
+	Access Access
+
+	// The topic filter. Patterns may use "%c" and "%u" as placeholders for
+	// the client id and the username.
+	Topic string
+}
+
+// An ACL is an Authorizer that evaluates topic rules per username as well as
+// patterns that apply to all clients. Topics that are not granted by a rule
+// are denied. Deny rules take precedence over all other rules.
+type ACL struct {
+	anonymous []ACLRule
+	users     map[string][]ACLRule
+	patterns  []ACLRule
+	mutex     sync.RWMutex
+}
+
+// NewACL returns a new and empty ACL.
+func NewACL() *ACL {
+	return &ACL{
+		users: make(map[string][]ACLRule),
+	}
+}
+
+// LoadACL will read the ACL from the specified file. See ParseACL for details.
+func LoadACL(path string) (*ACL, error) {
+	// open file
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// ensure file is closed
+	defer file.Close()
+
+	return ParseACL(file)
+}
+
+// ParseACL will parse an ACL in the mosquitto acl_file format:
+//
+//	# rules before the first user line apply to anonymous clients
+//	topic read public/#
+//
+//	# rules following a user line apply to that user
+//	user alice
+//	topic readwrite alice/#
+//	topic deny alice/secret
+//
+//	# patterns apply to all clients
+//	pattern write devices/%c/status
+//
+// If the access is omitted, readwrite is assumed. Subscriptions with wildcards
+// that cover denied topics are granted, the broker client authorizes every
+// delivered message again and drops messages of denied topics.
+func ParseACL(r io.Reader) (*ACL, error) {
+	// prepare acl
+	acl := NewACL()
+
+	// prepare state
+	var user *string
+	line := 0
+
+	// read lines
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line++
+
+		// trim line
+		text := strings.TrimSpace(scanner.Text())
+
+		// skip empty lines and comments
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		// split keyword
+		keyword, rest := splitACLField(text)
+
+		switch keyword {
+		case "user":
+			// check username
+			if rest == "" {
+				return nil, fmt.Errorf("acl line %d: missing username", line)
+			}
+
+			user = &rest
+		case "topic", "pattern":
+			// parse access
+			access := ReadWriteAccess
+			field, remainder := splitACLField(rest)
+			switch field {
+			case "read":
+				access, rest = ReadAccess, remainder
+			case "write":
+				access, rest = WriteAccess, remainder
+			case "readwrite":
+				access, rest = ReadWriteAccess, remainder
+			case "deny":
+				access, rest = NoAccess, remainder
+			}
+
+			// validate topic
+			_, err := topic.Parse(rest, true)
+			if err != nil {
+				return nil, fmt.Errorf("acl line %d: %s", line, err.Error())
+			}
+
+			// add rule
+			rule := ACLRule{Access: access, Topic: rest}
+			if keyword == "pattern" {
+				acl.AddPattern(rule)
+			} else if user == nil {
+				acl.AddAnonymousRule(rule)
+			} else {
+				acl.AddUserRule(*user, rule)
+			}
+		default:
+			return nil, fmt.Errorf("acl line %d: unknown keyword %q", line, keyword)
+		}
+	}
+
+	// check error
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return acl, nil
+}
+
+// AddAnonymousRule will add a rule that applies to clients without a username.
+func (a *ACL) AddAnonymousRule(rule ACLRule) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.anonymous = append(a.anonymous, rule)
+}
+
+// AddUserRule will add a rule that applies to clients with the specified
+// username.
+func (a *ACL) AddUserRule(user string, rule ACLRule) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.users[user] = append(a.users[user], rule)
+}
+
+// AddPattern will add a rule that applies to all clients after the "%c" and
+// "%u" placeholders have been replaced with the client id and username.
+func (a *ACL) AddPattern(rule ACLRule) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.patterns = append(a.patterns, rule)
+}
+
+// Authorize implements the Authorizer interface.
+func (a *ACL) Authorize(client *Client, topic string, access Access) (bool, error) {
+	ok, _, err := a.AuthorizeRule(client, topic, access)
+	return ok, err
+}
+
+// AuthorizeRule implements the RuleAuthorizer interface. For patterns the
+// rule is returned with the placeholders in place.
+func (a *ACL) AuthorizeRule(client *Client, topic string, access Access) (bool, *ACLRule, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	// get id and username
+	id := client.ID()
+	user := client.Username()
+
+	// collect rules
+	rules := a.anonymous
+	if user != "" {
+		rules = a.users[user]
+	}
+
+	// prepare original rules
+	originals := rules
+
+	// expand patterns
+	if len(a.patterns) > 0 {
+		rules = append([]ACLRule{}, rules...)
+		originals = append([]ACLRule{}, originals...)
+		for _, pattern := range a.patterns {
+			// skip patterns that require unsafe values
+			if (strings.Contains(pattern.Topic, "%c") && !safeACLValue(id)) ||
+				(strings.Contains(pattern.Topic, "%u") && !safeACLValue(user)) {
+				continue
+			}
+
+			// replace placeholders
+			filter := strings.Replace(pattern.Topic, "%c", id, -1)
+			filter = strings.Replace(filter, "%u", user, -1)
+
+			rules = append(rules, ACLRule{Access: pattern.Access, Topic: filter})
+			originals = append(originals, pattern)
+		}
+	}
+
+	// check deny rules
+	for i, rule := range rules {
+		if rule.Access == NoAccess && aclMatch(rule.Topic, topic) {
+			original := originals[i]
+			return false, &original, nil
+		}
+	}
+
+	// check grant rules
+	for i, rule := range rules {
+		if rule.Access&access == access && aclMatch(rule.Topic, topic) {
+			original := originals[i]
+			return true, &original, nil
+		}
+	}
+
+	return false, nil, nil
+}
+
+// splits the first whitespace separated field from the text
+func splitACLField(text string) (string, string) {
+	i := strings.IndexAny(text, " \t")
+	if i < 0 {
+		return text, ""
+	}
+
+	return text[:i], strings.TrimSpace(text[i+1:])
+}
+
+// checks if the value can safely be inserted into a pattern
+func safeACLValue(value string) bool {
+	return value != "" && !strings.ContainsAny(value, "/+#")
+}
+
+// matches a topic or subscription filter against a rule filter
+func aclMatch(filter, t string) bool {
+	// multi level wildcards in subscriptions are only covered by multi level
+	// wildcards in rules
+	if strings.HasSuffix(t, "#") && !strings.HasSuffix(filter, "#") {
+		return false
+	}
+
+	return topic.Match(t, filter)
+}
@@ -0,0 +1,185 @@
+package broker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+	"github.com/256dpi/gomqtt/transport/flow"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testACL = `
+# anonymous
+topic read public/#
+
+user alice
+topic readwrite alice/#
+topic deny alice/secret
+topic write shared/+/in
+
+user bob
+topic bob/#
+
+pattern write devices/%c/status
+pattern read users/%u/#
+`
+
+func TestParseACL(t *testing.T) {
+	acl, err := ParseACL(strings.NewReader(testACL))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []ACLRule{
+		{Access: ReadAccess, Topic: "public/#"},
+	}, acl.anonymous)
+	assert.Equal(t, []ACLRule{
+		{Access: ReadWriteAccess, Topic: "alice/#"},
+		{Access: NoAccess, Topic: "alice/secret"},
+		{Access: WriteAccess, Topic: "shared/+/in"},
+	}, acl.users["alice"])
+	assert.Equal(t, []ACLRule{
+		{Access: ReadWriteAccess, Topic: "bob/#"},
+	}, acl.users["bob"])
+	assert.Equal(t, []ACLRule{
+		{Access: WriteAccess, Topic: "devices/%c/status"},
+		{Access: ReadAccess, Topic: "users/%u/#"},
+	}, acl.patterns)
+}
+
+func TestParseACLErrors(t *testing.T) {
+	_, err := ParseACL(strings.NewReader("foo bar"))
+	assert.Error(t, err)
+
+	_, err = ParseACL(strings.NewReader("user"))
+	assert.Error(t, err)
+
+	_, err = ParseACL(strings.NewReader("topic read foo/#/bar"))
+	assert.Error(t, err)
+
+	_, err = ParseACL(strings.NewReader("topic read"))
+	assert.Error(t, err)
+}
+
+func TestLoadACL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acl")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "acl")
+	err = ioutil.WriteFile(path, []byte(testACL), 0600)
+	assert.NoError(t, err)
+
+	acl, err := LoadACL(path)
+	assert.NoError(t, err)
+	assert.Len(t, acl.patterns, 2)
+
+	_, err = LoadACL(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestACLAuthorize(t *testing.T) {
+	acl, err := ParseACL(strings.NewReader(testACL))
+	assert.NoError(t, err)
+
+	anonymous := &Client{id: "anon"}
+	alice := &Client{id: "dev1", user: "alice"}
+	bob := &Client{id: "dev+", user: "bob"}
+
+	table := []struct {
+		client *Client
+		topic  string
+		access Access
+		result bool
+	}{
+		{anonymous, "public/news", ReadAccess, true},
+		{anonymous, "public/#", ReadAccess, true},
+		{anonymous, "public/news", WriteAccess, false},
+		{anonymous, "#", ReadAccess, false},
+		{anonymous, "alice/foo", ReadAccess, false},
+		{anonymous, "devices/anon/status", WriteAccess, true},
+		{anonymous, "users//foo", ReadAccess, false},
+		{alice, "public/news", ReadAccess, false},
+		{alice, "alice/foo", ReadWriteAccess, true},
+		{alice, "alice/secret", ReadAccess, false},
+		{alice, "alice/#", ReadAccess, true}, // alice/secret is filtered on delivery
+		{alice, "shared/x/in", WriteAccess, true},
+		{alice, "shared/x/in", ReadAccess, false},
+		{alice, "shared/#", WriteAccess, false},
+		{alice, "devices/dev1/status", WriteAccess, true},
+		{alice, "devices/dev2/status", WriteAccess, false},
+		{alice, "users/alice/foo", ReadAccess, true},
+		{alice, "users/bob/foo", ReadAccess, false},
+		{bob, "bob/foo", WriteAccess, true},
+		{bob, "devices/dev+/status", WriteAccess, false},
+		{bob, "users/bob/foo", ReadAccess, true},
+	}
+
+	for _, item := range table {
+		ok, err := acl.Authorize(item.client, item.topic, item.access)
+		assert.NoError(t, err)
+		assert.Equal(t, item.result, ok, item.client.user+" "+item.topic+" "+item.access.String())
+	}
+}
+
+func TestACLWildcardDelivery(t *testing.T) {
+	acl, err := ParseACL(strings.NewReader(testACL))
+	assert.NoError(t, err)
+
+	backend := NewMemoryBackend()
+	backend.ClientAuthorizer = acl
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	connect := packet.NewConnect()
+	connect.Username = "alice"
+
+	subscribed := make(chan struct{})
+
+	f := flow.New().
+		Send(connect).
+		Receive(packet.NewConnack()).
+		Send(&packet.Subscribe{Subscriptions: []packet.Subscription{
+			{Topic: "alice/#", QOS: 0},
+			{Topic: "alice/+", QOS: 0},
+		}, ID: 1}).
+		Receive(&packet.Suback{ID: 1, ReturnCodes: []packet.QOS{0, 0}}).
+		Run(func() {
+			close(subscribed)
+		}).
+		Receive(&packet.Publish{Message: packet.Message{Topic: "alice/foo", Payload: []byte("2")}}).
+		Send(packet.NewDisconnect()).
+		End()
+
+	go func() {
+		safeReceive(subscribed)
+
+		err := backend.Publish(nil, &packet.Message{Topic: "alice/secret", Payload: []byte("1")}, nil)
+		assert.NoError(t, err)
+
+		err = backend.Publish(nil, &packet.Message{Topic: "alice/foo", Payload: []byte("2")}, nil)
+		assert.NoError(t, err)
+	}()
+
+	err = f.Test(conn)
+	assert.NoError(t, err)
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestAccessString(t *testing.T) {
+	assert.Equal(t, "deny", NoAccess.String())
+	assert.Equal(t, "read", ReadAccess.String())
+	assert.Equal(t, "write", WriteAccess.String())
+	assert.Equal(t, "readwrite", ReadWriteAccess.String())
+	assert.Equal(t, "unknown", Access(4).String())
+}
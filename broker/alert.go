@@ -0,0 +1,83 @@
+package broker
+
+import (
+	"strconv"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// An Alert defines a threshold on a broker statistic. The statistics are named
+// like their topics below "$SYS/broker/", e.g. "messages/dropped",
+// "messages/queued", "heap/current" or "load/bytes/received/1min".
+type Alert struct {
+	// The name of the statistic.
+	Metric string
+
+	// The value at which the alert is raised. The alert is cleared once the
+	// value drops below the threshold again.
+	Threshold float64
+}
+
+// An AlertCallback is called when an alert is raised or cleared.
+type AlertCallback func(alert Alert, value float64, active bool)
+
+type alertChange struct {
+	alert  Alert
+	value  float64
+	active bool
+}
+
+// checkAlerts will evaluate the configured alerts and return the alerts that
+// have been raised or cleared since the last check. The global mutex must be
+// held by the caller.
+func (m *MemoryBackend) checkAlerts(values map[string]float64) []alertChange {
+	// check alerts
+	var changes []alertChange
+	for _, alert := range m.Alerts {
+		// get value
+		value, ok := values[alert.Metric]
+		if !ok {
+			continue
+		}
+
+		// check transition
+		active := value >= alert.Threshold
+		if active == m.activeAlerts[alert] {
+			continue
+		}
+
+		// update state
+		if active {
+			m.activeAlerts[alert] = true
+		} else {
+			delete(m.activeAlerts, alert)
+		}
+
+		changes = append(changes, alertChange{
+			alert:  alert,
+			value:  value,
+			active: active,
+		})
+	}
+
+	return changes
+}
+
+// publishAlert will publish a raised alert as a retained message and clear the
+// retained message once the alert has been cleared. The global mutex must be
+// held by the caller.
+func (m *MemoryBackend) publishAlert(change alertChange) {
+	// prepare message
+	msg := &packet.Message{
+		Topic:  "$SYS/alerts/" + change.alert.Metric,
+		Retain: true,
+	}
+
+	// set payload if active
+	if change.active {
+		msg.Payload = []byte(strconv.FormatFloat(change.value, 'f', 2, 64))
+	}
+
+	// errors are only returned for the own queue of a publishing client
+	_ = m.publish(nil, msg)
+}
@@ -0,0 +1,328 @@
+package broker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/256dpi/gomqtt/logging"
+)
+
+// An AuditRecord describes an authorization decision.
+type AuditRecord struct {
+	// The time of the decision.
+	Time time.Time
+
+	// The id, username and remote address of the client.
+	ClientID string
+	Username string
+	Remote   string
+
+	// The requested topic or subscription filter and access.
+	Topic  string
+	Access Access
+
+	// Whether the request has been allowed.
+	Allowed bool
+
+	// The rule that decided the request. It is nil if no rule matched or the
+	// authorizer does not implement RuleAuthorizer.
+	Rule *ACLRule
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (r AuditRecord) MarshalJSON() ([]byte, error) {
+	// prepare rule
+	var rule string
+	if r.Rule != nil {
+		rule = r.Rule.Access.String() + " " + r.Rule.Topic
+	}
+
+	return json.Marshal(struct {
+		Time     time.Time `json:"time"`
+		ClientID string    `json:"client_id"`
+		Username string    `json:"username,omitempty"`
+		Remote   string    `json:"remote,omitempty"`
+		Topic    string    `json:"topic"`
+		Access   string    `json:"access"`
+		Allowed  bool      `json:"allowed"`
+		Rule     string    `json:"rule,omitempty"`
+	}{
+		Time:     r.Time,
+		ClientID: r.ClientID,
+		Username: r.Username,
+		Remote:   r.Remote,
+		Topic:    r.Topic,
+		Access:   r.Access.String(),
+		Allowed:  r.Allowed,
+		Rule:     rule,
+	})
+}
+
+// An Auditor records authorization decisions. Audit is called synchronously
+// from the client goroutines and should therefore not block.
+type Auditor interface {
+	Audit(record AuditRecord)
+}
+
+// The AuditorFunc type is an adapter to allow the use of ordinary functions
+// as auditors.
+type AuditorFunc func(record AuditRecord)
+
+// Audit implements the Auditor interface.
+func (f AuditorFunc) Audit(record AuditRecord) {
+	f(record)
+}
+
+// LogAuditor returns an auditor that emits records as "authorization decision"
+// events to the logger. Denied requests are logged with the info level and
+// allowed requests with the debug level.
+func LogAuditor(logger logging.Logger) Auditor {
+	return AuditorFunc(func(record AuditRecord) {
+		// prepare fields
+		fields := []logging.Field{
+			logging.F("client", record.ClientID),
+			logging.F("topic", record.Topic),
+			logging.F("access", record.Access.String()),
+			logging.F("allowed", record.Allowed),
+		}
+		if record.Username != "" {
+			fields = append(fields, logging.F("username", record.Username))
+		}
+		if record.Remote != "" {
+			fields = append(fields, logging.F("remote", record.Remote))
+		}
+		if record.Rule != nil {
+			fields = append(fields, logging.F("rule", record.Rule.Access.String()+" "+record.Rule.Topic))
+		}
+
+		// get level
+		level := logging.Info
+		if record.Allowed {
+			level = logging.Debug
+		}
+
+		logger.Log(level, "authorization decision", fields...)
+	})
+}
+
+// A WebhookAuditor is an Auditor that posts records in batches as JSON arrays
+// to a URL. Records are queued and dropped if the queue is full to never block
+// clients. The options must be set before the first record is audited.
+type WebhookAuditor struct {
+	// The URL the records are posted to.
+	URL string
+
+	// The HTTP client used to post the records.
+	//
+	// Will default to a client with a 10s timeout.
+	Client *http.Client
+
+	// The maximum number of records per request.
+	//
+	// Will default to 100.
+	BatchSize int
+
+	// The interval in which incomplete batches are posted.
+	//
+	// Will default to 1s.
+	Interval time.Duration
+
+	// The maximum number of queued records.
+	//
+	// Will default to 10000.
+	QueueSize int
+
+	// The ErrorCallback is called with errors that occurred while posting
+	// records. The records of a failed request are dropped.
+	ErrorCallback func(error)
+
+	dropped int64
+	queue   chan AuditRecord
+	closed  bool
+	start   sync.Once
+	done    chan struct{}
+	mutex   sync.RWMutex
+}
+
+// NewWebhookAuditor returns a new WebhookAuditor that posts to the URL.
+func NewWebhookAuditor(url string) *WebhookAuditor {
+	return &WebhookAuditor{
+		URL:       url,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+		BatchSize: 100,
+		Interval:  time.Second,
+		QueueSize: 10000,
+	}
+}
+
+// Audit implements the Auditor interface.
+func (a *WebhookAuditor) Audit(record AuditRecord) {
+	// start sender
+	a.start.Do(a.run)
+
+	// acquire mutex
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	// drop record if closed
+	if a.closed {
+		atomic.AddInt64(&a.dropped, 1)
+		return
+	}
+
+	// queue record
+	select {
+	case a.queue <- record:
+	default:
+		atomic.AddInt64(&a.dropped, 1)
+	}
+}
+
+// Dropped returns the number of records that have been dropped because the
+// queue was full or the auditor has been closed.
+func (a *WebhookAuditor) Dropped() int64 {
+	return atomic.LoadInt64(&a.dropped)
+}
+
+// Close will post the remaining queued records and stop the auditor. Records
+// audited after the auditor has been closed are dropped.
+func (a *WebhookAuditor) Close() {
+	// ensure sender
+	a.start.Do(a.run)
+
+	// stop sender
+	a.mutex.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mutex.Unlock()
+
+	// wait for sender
+	<-a.done
+}
+
+func (a *WebhookAuditor) run() {
+	// get queue size
+	queueSize := a.QueueSize
+	if queueSize <= 0 {
+		queueSize = 10000
+	}
+
+	// prepare channels
+	a.queue = make(chan AuditRecord, queueSize)
+	a.done = make(chan struct{})
+
+	go a.send()
+}
+
+func (a *WebhookAuditor) send() {
+	// close done channel
+	defer close(a.done)
+
+	// get batch size
+	batchSize := a.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	// get interval
+	interval := a.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	// prepare ticker
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// collect and post batches
+	batch := make([]AuditRecord, 0, batchSize)
+	for {
+		select {
+		case record, ok := <-a.queue:
+			// post remaining records if closed
+			if !ok {
+				a.post(batch)
+				return
+			}
+
+			// add record
+			batch = append(batch, record)
+			if len(batch) < batchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+
+		// post batch
+		a.post(batch)
+		batch = batch[:0]
+	}
+}
+
+func (a *WebhookAuditor) post(batch []AuditRecord) {
+	// check batch
+	if len(batch) == 0 {
+		return
+	}
+
+	// encode batch
+	body, err := json.Marshal(batch)
+	if err != nil {
+		a.fail(err)
+		return
+	}
+
+	// get client
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	// post batch
+	res, err := client.Post(a.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		a.fail(err)
+		return
+	}
+
+	// close body
+	_ = res.Body.Close()
+
+	// check status
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		a.fail(fmt.Errorf("unexpected status %d", res.StatusCode))
+	}
+}
+
+func (a *WebhookAuditor) fail(err error) {
+	if a.ErrorCallback != nil {
+		a.ErrorCallback(err)
+	}
+}
+
+// auditRecord returns a record of the specified decision.
+func (c *Client) auditRecord(topic string, access Access, allowed bool, rule *ACLRule) AuditRecord {
+	// get remote address
+	var remote string
+	if addr := c.conn.RemoteAddr(); addr != nil {
+		remote = addr.String()
+	}
+
+	return AuditRecord{
+		Time:     time.Now(),
+		ClientID: c.id,
+		Username: c.user,
+		Remote:   remote,
+		Topic:    topic,
+		Access:   access,
+		Allowed:  allowed,
+		Rule:     rule,
+	}
+}
@@ -0,0 +1,194 @@
+package broker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+	"github.com/256dpi/gomqtt/transport/flow"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACLAuthorizeRule(t *testing.T) {
+	acl, err := ParseACL(strings.NewReader(testACL))
+	assert.NoError(t, err)
+
+	alice := &Client{id: "dev1", user: "alice"}
+
+	ok, rule, err := acl.AuthorizeRule(alice, "alice/secret", ReadAccess)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, &ACLRule{Access: NoAccess, Topic: "alice/secret"}, rule)
+
+	ok, rule, err = acl.AuthorizeRule(alice, "alice/foo", WriteAccess)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, &ACLRule{Access: ReadWriteAccess, Topic: "alice/#"}, rule)
+
+	ok, rule, err = acl.AuthorizeRule(alice, "devices/dev1/status", WriteAccess)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, &ACLRule{Access: WriteAccess, Topic: "devices/%c/status"}, rule)
+
+	ok, rule, err = acl.AuthorizeRule(alice, "other", ReadAccess)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, rule)
+}
+
+func TestAuditRecordJSON(t *testing.T) {
+	record := AuditRecord{
+		Time:     time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		ClientID: "dev1",
+		Username: "alice",
+		Topic:    "alice/secret",
+		Access:   ReadAccess,
+		Rule:     &ACLRule{Access: NoAccess, Topic: "alice/secret"},
+	}
+
+	buf, err := json.Marshal(record)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"time": "2020-01-01T00:00:00Z",
+		"client_id": "dev1",
+		"username": "alice",
+		"topic": "alice/secret",
+		"access": "read",
+		"allowed": false,
+		"rule": "deny alice/secret"
+	}`, string(buf))
+}
+
+func TestWebhookAuditor(t *testing.T) {
+	var mutex sync.Mutex
+	var batches [][]map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var batch []map[string]interface{}
+		assert.NoError(t, json.Unmarshal(body, &batch))
+
+		mutex.Lock()
+		batches = append(batches, batch)
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	auditor := NewWebhookAuditor(server.URL)
+	auditor.BatchSize = 2
+	auditor.Interval = time.Hour
+
+	for _, topic := range []string{"a", "b", "c"} {
+		auditor.Audit(AuditRecord{ClientID: "c1", Topic: topic, Access: WriteAccess})
+	}
+
+	auditor.Close()
+	auditor.Audit(AuditRecord{ClientID: "c1", Topic: "d", Access: WriteAccess})
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	assert.Len(t, batches, 2)
+	assert.Len(t, batches[0], 2)
+	assert.Len(t, batches[1], 1)
+	assert.Equal(t, "a", batches[0][0]["topic"])
+	assert.Equal(t, "c", batches[1][0]["topic"])
+	assert.Equal(t, "write", batches[1][0]["access"])
+	assert.Equal(t, int64(1), auditor.Dropped())
+}
+
+func TestWebhookAuditorError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	var errs []error
+
+	auditor := NewWebhookAuditor(server.URL)
+	auditor.ErrorCallback = func(err error) {
+		errs = append(errs, err)
+	}
+
+	auditor.Audit(AuditRecord{ClientID: "c1", Topic: "a"})
+	auditor.Close()
+
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "500")
+}
+
+func TestClientAuditor(t *testing.T) {
+	acl := NewACL()
+	acl.AddAnonymousRule(ACLRule{Access: ReadWriteAccess, Topic: "allowed/#"})
+	acl.AddAnonymousRule(ACLRule{Access: NoAccess, Topic: "allowed/secret"})
+
+	records := make(chan AuditRecord, 10)
+
+	backend := NewMemoryBackend()
+	backend.ClientAuthorizer = acl
+	backend.ClientAuditAllows = 1
+	backend.ClientAuditor = AuditorFunc(func(record AuditRecord) {
+		records <- record
+	})
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	connect := packet.NewConnect()
+	connect.ClientID = "c1"
+
+	f := flow.New().
+		Send(connect).
+		Receive(packet.NewConnack()).
+		Send(&packet.Subscribe{Subscriptions: []packet.Subscription{
+			{Topic: "allowed/+", QOS: 0},
+			{Topic: "denied/+", QOS: 0},
+		}, ID: 1}).
+		Receive(&packet.Suback{ID: 1, ReturnCodes: []packet.QOS{0, packet.QOSFailure}}).
+		Send(&packet.Publish{Message: packet.Message{Topic: "allowed/secret", QOS: 1}, ID: 2}).
+		Receive(&packet.Puback{ID: 2}).
+		Send(packet.NewDisconnect()).
+		End()
+
+	err = f.Test(conn)
+	assert.NoError(t, err)
+
+	record := <-records
+	assert.Equal(t, "c1", record.ClientID)
+	assert.Equal(t, "allowed/+", record.Topic)
+	assert.Equal(t, ReadAccess, record.Access)
+	assert.True(t, record.Allowed)
+	assert.Equal(t, &ACLRule{Access: ReadWriteAccess, Topic: "allowed/#"}, record.Rule)
+	assert.NotEmpty(t, record.Remote)
+
+	record = <-records
+	assert.Equal(t, "denied/+", record.Topic)
+	assert.False(t, record.Allowed)
+	assert.Nil(t, record.Rule)
+
+	record = <-records
+	assert.Equal(t, "allowed/secret", record.Topic)
+	assert.Equal(t, WriteAccess, record.Access)
+	assert.False(t, record.Allowed)
+	assert.Equal(t, &ACLRule{Access: NoAccess, Topic: "allowed/secret"}, record.Rule)
+
+	ret := backend.Close(5 * time.Second)
+	assert.True(t, ret)
+
+	close(quit)
+
+	safeReceive(done)
+}
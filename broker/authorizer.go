@@ -0,0 +1,54 @@
+package broker
+
+// Access denotes the kind of access a client requests for a topic.
+type Access int
+
+const (
+	// NoAccess denies all access to a topic.
+	NoAccess Access = 0
+
+	// ReadAccess allows a client to subscribe to a topic.
+	ReadAccess Access = 1 << 0
+
+	// WriteAccess allows a client to publish to a topic.
+	WriteAccess Access = 1 << 1
+
+	// ReadWriteAccess allows a client to subscribe and publish to a topic.
+	ReadWriteAccess = ReadAccess | WriteAccess
+)
+
+// String returns the access as a string.
+func (a Access) String() string {
+	switch a {
+	case NoAccess:
+		return "deny"
+	case ReadAccess:
+		return "read"
+	case WriteAccess:
+		return "write"
+	case ReadWriteAccess:
+		return "readwrite"
+	}
+
+	return "unknown"
+}
+
+// An Authorizer is consulted by the Client before subscriptions are passed to
+// Backend.Subscribe and before messages are passed to Backend.Publish.
+type Authorizer interface {
+	// Authorize should return true if the client is allowed to access the
+	// specified topic. For subscriptions the topic is the subscription filter
+	// and may contain wildcards.
+	Authorize(client *Client, topic string, access Access) (bool, error)
+}
+
+// A RuleAuthorizer is an Authorizer that also reports the rule that decided
+// a request. The rule is included in the records passed to the Auditor of a
+// client.
+type RuleAuthorizer interface {
+	Authorizer
+
+	// AuthorizeRule behaves like Authorize but additionally returns the rule
+	// that decided the request. The rule is nil if no rule matched.
+	AuthorizeRule(client *Client, topic string, access Access) (bool, *ACLRule, error)
+}
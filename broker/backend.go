@@ -3,6 +3,7 @@ package broker
 import (
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/256dpi/gomqtt/packet"
@@ -10,23 +11,41 @@ import (
 	"github.com/256dpi/gomqtt/topic"
 )
 
+type memoryMessage struct {
+	*packet.Message
+
+	expires time.Time
+}
+
+func (m memoryMessage) expired(now time.Time) bool {
+	return !m.expires.IsZero() && !now.Before(m.expires)
+}
+
 type memorySession struct {
 	*session.MemorySession
 
 	subscriptions *topic.Tree
-	stored        chan *packet.Message
-	temporary     chan *packet.Message
+	lanes         []*memoryLane
 
-	owner *Client
+	owner    *Client
+	dequeuer *Client
+	offline  time.Time
+	expiry   time.Duration
 }
 
-func newMemorySession(backlog int) *memorySession {
-	return &memorySession{
+func newMemorySession(backlog, lanes int) *memorySession {
+	// create session
+	sess := &memorySession{
 		MemorySession: session.NewMemorySession(),
 		subscriptions: topic.NewTree(),
-		stored:        make(chan *packet.Message, backlog),
-		temporary:     make(chan *packet.Message, backlog),
 	}
+
+	// create lanes
+	for i := 0; i < lanes; i++ {
+		sess.lanes = append(sess.lanes, newMemoryLane(backlog))
+	}
+
+	return sess
 }
 
 func (s *memorySession) lookupSubscription(topic string) *packet.Subscription {
@@ -38,6 +57,14 @@ func (s *memorySession) lookupSubscription(topic string) *packet.Subscription {
 	return nil
 }
 
+func (s *memorySession) CountSubscriptions() int {
+	return s.subscriptions.Count()
+}
+
+func (s *memorySession) HasSubscription(filter string) bool {
+	return len(s.subscriptions.Get(filter)) > 0
+}
+
 func (s *memorySession) applyQOS(msg *packet.Message) *packet.Message {
 	// get subscription
 	sub := s.lookupSubscription(msg.Topic)
@@ -53,7 +80,31 @@ func (s *memorySession) applyQOS(msg *packet.Message) *packet.Message {
 }
 
 func (s *memorySession) reuse() {
-	s.temporary = make(chan *packet.Message, cap(s.temporary))
+	for _, lane := range s.lanes {
+		lane.temporary = make(chan memoryMessage, cap(lane.temporary))
+	}
+}
+
+func (s *memorySession) queued() int {
+	// count messages of all lanes
+	n := 0
+	for _, lane := range s.lanes {
+		n += lane.len()
+	}
+
+	return n
+}
+
+func (s *memorySession) dropExpired(now time.Time) {
+	// keep messages that did not expire
+	for _, lane := range s.lanes {
+		for i := len(lane.stored); i > 0; i-- {
+			msg := <-lane.stored
+			if !msg.expired(now) {
+				lane.stored <- msg
+			}
+		}
+	}
 }
 
 // ErrQueueFull is returned to a client that attempts two write to its own full
@@ -67,6 +118,32 @@ var ErrClosing = errors.New("closing")
 // in time.
 var ErrKillTimeout = errors.New("kill timeout")
 
+// An ExpiredSession is logged as the error of a SessionExpired event to
+// identify the stored session that has been removed due to expiry.
+type ExpiredSession struct {
+	// The client id of the session.
+	ID string
+}
+
+// Error implements the error interface.
+func (e *ExpiredSession) Error() string {
+	return "session expired: " + e.ID
+}
+
+// A TakeoverPolicy defines how a client is handled that connects with the id of
+// an already connected client.
+type TakeoverPolicy int
+
+const (
+	// TakeoverSession closes the existing client and hands over its session
+	// to the connecting client as required by the specification.
+	TakeoverSession TakeoverPolicy = iota
+
+	// RejectClient keeps the existing client and rejects the connecting client
+	// with an IdentifierRejected return code.
+	RejectClient
+)
+
 // A MemoryBackend stores everything in memory.
 type MemoryBackend struct {
 	// The maximal size of the session queue.
@@ -80,12 +157,152 @@ type MemoryBackend struct {
 	// Will default to 5 seconds.
 	KillTimeout time.Duration
 
+	// The duration after which a stored session of an offline client is
+	// removed together with its subscriptions and queued messages. It can be
+	// overridden per client by setting Client.SessionExpiry during Setup.
+	//
+	// Will default to 0 (never expire).
+	SessionExpiry time.Duration
+
+	// The interval in which stored sessions are scanned for expiry.
+	//
+	// Will default to 1 minute.
+	SessionScanInterval time.Duration
+
+	// The SessionExpiryCallback is called with the client id of every stored
+	// session that has been removed due to expiry. A SessionExpired event is
+	// logged for every removed session as well.
+	SessionExpiryCallback func(id string)
+
+	// The expiry intervals of messages per topic filter. Expired messages are
+	// dropped from session queues and the retained store. If multiple filters
+	// match a topic the shortest interval is used. Expired messages in the
+	// queues of offline sessions and the retained store are removed when
+	// stored sessions are scanned.
+	MessageExpiry map[string]time.Duration
+
+	// The duration for which the will message of a client with an id that
+	// lost its connection is held back. The will is dropped if a client with
+	// the same id connects before the delay has elapsed. Pending wills are
+	// discarded when the backend is closed.
+	//
+	// Will default to 0 (no delay).
+	WillDelay time.Duration
+
+	// The policy that is used to ban clients with an id that connect and
+	// disconnect rapidly. Banned clients are rejected with a ServerUnavailable
+	// return code until the ban expires. Flapping detection is disabled if the
+	// threshold is zero.
+	Flapping FlappingPolicy
+
+	// The interval in which broker statistics are published as retained
+	// messages to topics below "$SYS/broker/".
+	//
+	// Will default to 0 (disabled).
+	SysInterval time.Duration
+
+	// The thresholds on broker statistics that are checked whenever the
+	// statistics are published. Alerts are only checked if SysInterval is
+	// set.
+	Alerts []Alert
+
+	// The AlertCallback is called when an alert is raised or cleared.
+	AlertCallback AlertCallback
+
+	// Whether raised alerts are published as retained messages to topics
+	// below "$SYS/alerts/". The retained message is cleared once the alert
+	// has been cleared.
+	PublishAlerts bool
+
+	// The snapshots of retained messages that are periodically published.
+	// See Snapshot for details.
+	Snapshots []Snapshot
+
+	// The policy that is applied if a client connects with the id of an
+	// already connected client.
+	//
+	// Will default to TakeoverSession.
+	SessionTakeover TakeoverPolicy
+
+	// The Tenant callback returns the tenant of a client that is used to
+	// aggregate usage statistics and enforce quotas. Usage statistics are only
+	// collected if Tenant or TenantQuotas is set. The usage of a tenant is
+	// discarded once its last client has disconnected.
+	//
+	// Will default to the username of the client.
+	Tenant func(*Client) string
+
+	// The Sink is called with every message published by a client before it
+	// is routed and acknowledged. The client is closed without acknowledging
+	// the message if the sink returns an error. Since QOS 2 messages are
+	// stored in the session until the Pubcomp has been sent, clients with a
+	// persistent session will retransmit the release after reconnecting.
+	// Together with an idempotent downstream write this allows forwarding
+	// messages to external systems like streaming platforms exactly once.
+	// Delayed will messages are not passed to the sink.
+	Sink func(client *Client, msg *packet.Message) error
+
+	// The number of recently published messages that are kept in a history
+	// to be replayed using Replay. Messages published by the backend itself
+	// are not recorded.
+	//
+	// Will default to 0 (disabled).
+	History int
+
+	// Whether the payload of a published message is copied before it is
+	// queued. Queued and retained messages share the payload of the published
+	// message with all subscribers to avoid a copy per subscriber. Publishers
+	// that reuse or mutate the payload after Publish returned, e.g. when
+	// decoding into pooled buffers, must enable this option.
+	CopyOnWrite bool
+
+	// The number of messages for which the encoded QOS 0 publish packets are
+	// shared between subscribers. See FrameCache for details.
+	//
+	// Will default to 0 (disabled).
+	SharedFrames int
+
+	// The quotas that are enforced per tenant. Messages published by clients
+	// of a tenant that exceeded its quota are acknowledged but dropped.
+	TenantQuotas map[string]TenantQuota
+
+	// The maximum number of sessions a message published by a client may be
+	// queued for. Messages matching more subscribed sessions are acknowledged
+	// but dropped, including their retained flag. Messages published by the
+	// backend itself are not limited.
+	//
+	// Will default to 0 (unlimited).
+	MaxFanOut int
+
+	// The priority lanes that are used to queue messages. Each lane has its
+	// own session queue of SessionQueueSize messages. See PriorityLane for
+	// details. Lanes must not use the name of the DefaultLane.
+	PriorityLanes []PriorityLane
+
+	// The maximum number of messages that are delivered from lanes with a
+	// higher priority while a lane with a lower priority has queued messages.
+	// The starving lane is served once before the higher lanes continue.
+	//
+	// Will default to 10. A value of zero delivers strictly by priority.
+	PriorityStarvationLimit int
+
 	// Client configuration options. See broker.Client for details.
+	//
+	// ClientReservedTopics will default to no reserved topics. Setting a read
+	// only rule for "$SYS/#" is recommended if system topics are enabled
+	// using SysInterval, but note that the rules apply to all clients.
 	ClientMaximumKeepAlive   time.Duration
 	ClientParallelPublishes  int
 	ClientParallelSubscribes int
 	ClientInflightMessages   int
 	ClientTokenTimeout       time.Duration
+	ClientAuthorizer         Authorizer
+	ClientReservedTopics     []ACLRule
+	ClientMaxPacketSize      int64
+	ClientMaxSubscriptions   int
+	ClientAuditor            Auditor
+	ClientAuditAllows        float64
+	ClientSendQueueSize      int
 
 	// A map of username and passwords that grant read and write access.
 	Credentials map[string]string
@@ -97,21 +314,51 @@ type MemoryBackend struct {
 	storedSessions    map[string]*memorySession
 	temporarySessions map[*Client]*memorySession
 	retainedMessages  *topic.Tree
+	subscribers       *topic.Tree
+	pendingWills      map[string]*time.Timer
+	history           []historyMessage
 
 	globalMutex sync.Mutex
 	setupMutex  sync.Mutex
 	closing     bool
+
+	scanner sync.Once
+	quit    chan struct{}
+
+	stats        *sysStats
+	publisher    sync.Once
+	snapshotter  sync.Once
+	activeAlerts map[Alert]bool
+
+	tenants  *tenantStats
+	flapping *flappingDetector
+	frames   *FrameCache
+
+	prioritizer  sync.Once
+	lanes        []PriorityLane
+	laneCounters []*laneCounter
+	defaultLane  int
+	lanesErr     error
 }
 
 // NewMemoryBackend returns a new MemoryBackend.
 func NewMemoryBackend() *MemoryBackend {
 	return &MemoryBackend{
-		SessionQueueSize:  100,
-		KillTimeout:       5 * time.Second,
-		activeClients:     make(map[string]*Client),
-		storedSessions:    make(map[string]*memorySession),
-		temporarySessions: make(map[*Client]*memorySession),
-		retainedMessages:  topic.NewTree(),
+		SessionQueueSize:        100,
+		KillTimeout:             5 * time.Second,
+		SessionScanInterval:     time.Minute,
+		PriorityStarvationLimit: 10,
+		activeClients:           make(map[string]*Client),
+		storedSessions:          make(map[string]*memorySession),
+		temporarySessions:       make(map[*Client]*memorySession),
+		retainedMessages:        topic.NewTree(),
+		subscribers:             topic.NewTree(),
+		pendingWills:            make(map[string]*time.Timer),
+		quit:                    make(chan struct{}),
+		stats:                   newSysStats(),
+		activeAlerts:            make(map[Alert]bool),
+		tenants:                 newTenantStats(),
+		flapping:                newFlappingDetector(),
 	}
 }
 
@@ -154,17 +401,73 @@ func (m *MemoryBackend) Setup(client *Client, id string, clean bool) (Session, b
 		return nil, false, ErrClosing
 	}
 
+	// start session scanner if sessions or messages expire or flapping
+	// records need to be swept
+	if m.SessionExpiry > 0 || len(m.MessageExpiry) > 0 || m.Flapping.Threshold > 0 {
+		m.scanner.Do(func() {
+			go m.scan()
+		})
+	}
+
+	// start sys publisher if enabled
+	if m.SysInterval > 0 {
+		m.publisher.Do(func() {
+			go m.report()
+		})
+	}
+
+	// track tenant if enabled
+	if m.tenantsEnabled() {
+		m.tenants.add(client, m.tenant(client))
+	}
+
+	// start snapshot publishers if configured
+	if len(m.Snapshots) > 0 {
+		m.snapshotter.Do(func() {
+			for _, snapshot := range m.Snapshots {
+				go m.snapshot(snapshot)
+			}
+		})
+	}
+
+	// prepare priority lanes
+	err := m.prepareLanes()
+	if err != nil {
+		return nil, false, err
+	}
+
+	// reject banned clients
+	if len(id) > 0 && m.Flapping.Threshold > 0 && !m.flapping.connect(m.Flapping, id, time.Now()) {
+		return nil, false, ErrClientBanned
+	}
+
 	// apply client settings
 	client.MaximumKeepAlive = m.ClientMaximumKeepAlive
 	client.ParallelPublishes = m.ClientParallelPublishes
 	client.ParallelSubscribes = m.ClientParallelSubscribes
 	client.InflightMessages = m.ClientInflightMessages
 	client.TokenTimeout = m.ClientTokenTimeout
+	client.Authorizer = m.ClientAuthorizer
+	client.ReservedTopics = m.ClientReservedTopics
+	client.MaxPacketSize = m.ClientMaxPacketSize
+	client.MaxSubscriptions = m.ClientMaxSubscriptions
+	client.Auditor = m.ClientAuditor
+	client.AuditAllows = m.ClientAuditAllows
+	client.SendQueueSize = m.ClientSendQueueSize
+	client.SessionExpiry = m.SessionExpiry
+
+	// share frames if enabled
+	if m.SharedFrames > 0 {
+		if m.frames == nil {
+			m.frames = NewFrameCache(m.SharedFrames)
+		}
+		client.FrameCache = m.frames
+	}
 
 	// return a new temporary session if id is zero
 	if len(id) == 0 {
 		// create session
-		sess := newMemorySession(m.SessionQueueSize)
+		sess := newMemorySession(m.SessionQueueSize, len(m.lanes))
 		sess.owner = client
 
 		// save session
@@ -183,19 +486,30 @@ func (m *MemoryBackend) Setup(client *Client, id string, clean bool) (Session, b
 		}
 	}
 
+	// reject client if session is taken and takeovers are disabled
+	if ok && existingSession.owner != nil && m.SessionTakeover == RejectClient {
+		return nil, false, ErrIdentifierRejected
+	}
+
 	// kill existing client if session is taken
 	if ok && existingSession.owner != nil {
+		// get existing client
+		existingClient := existingSession.owner
+
 		// close client
-		existingSession.owner.Close()
+		existingClient.Close()
 
 		// release global mutex to allow publish and termination, but leave the
 		// setup mutex to prevent setups
 		m.globalMutex.Unlock()
 
+		// log takeover
+		m.Log(SessionTakenOver, existingClient, nil, nil, nil)
+
 		// wait for client to close
 		var err error
 		select {
-		case <-existingSession.owner.Closed():
+		case <-existingClient.Closed():
 			// continue
 		case <-time.After(m.KillTimeout):
 			err = ErrKillTimeout
@@ -210,14 +524,23 @@ func (m *MemoryBackend) Setup(client *Client, id string, clean bool) (Session, b
 		}
 	}
 
+	// cancel pending will of a previous connection
+	if timer, ok := m.pendingWills[id]; ok {
+		timer.Stop()
+		delete(m.pendingWills, id)
+	}
+
 	// delete any stored session and return a temporary session if a clean
 	// session is requested
 	if clean {
 		// delete any stored session
-		delete(m.storedSessions, id)
+		if storedSession, ok := m.storedSessions[id]; ok {
+			m.unsubscribeAll(storedSession)
+			delete(m.storedSessions, id)
+		}
 
 		// create new session
-		sess := newMemorySession(m.SessionQueueSize)
+		sess := newMemorySession(m.SessionQueueSize, len(m.lanes))
 		sess.owner = client
 
 		// save session
@@ -243,7 +566,7 @@ func (m *MemoryBackend) Setup(client *Client, id string, clean bool) (Session, b
 	}
 
 	// otherwise create fresh session
-	storedSession = newMemorySession(m.SessionQueueSize)
+	storedSession = newMemorySession(m.SessionQueueSize, len(m.lanes))
 	storedSession.owner = client
 
 	// save session
@@ -266,9 +589,14 @@ func (m *MemoryBackend) Subscribe(client *Client, subs []packet.Subscription, ac
 	m.globalMutex.Lock()
 	defer m.globalMutex.Unlock()
 
+	// get session
+	sess := client.Session().(*memorySession)
+
 	// save subscription
 	for _, sub := range subs {
-		client.Session().(*memorySession).subscriptions.Set(sub.Topic, &sub)
+		sub := sub
+		sess.subscriptions.Set(sub.Topic, &sub)
+		m.subscribers.Add(sub.Topic, sess)
 	}
 
 	// call ack if provided
@@ -276,19 +604,24 @@ func (m *MemoryBackend) Subscribe(client *Client, subs []packet.Subscription, ac
 		ack()
 	}
 
-	// get session
-	sess := client.Session().(*memorySession)
-
 	// handle all subscriptions
+	now := time.Now()
 	for _, sub := range subs {
 		// get retained messages
 		values := m.retainedMessages.Search(sub.Topic)
 
 		// publish messages
 		for _, value := range values {
+			// remove expired message
+			msg := value.(memoryMessage)
+			if msg.expired(now) {
+				m.retainedMessages.Empty(msg.Topic)
+				continue
+			}
+
 			// add to temporary queue or return error if queue is full
 			select {
-			case sess.temporary <- value.(*packet.Message):
+			case sess.lanes[m.laneIndex(msg.Topic)].temporary <- msg:
 			default:
 				return ErrQueueFull
 			}
@@ -300,9 +633,13 @@ func (m *MemoryBackend) Subscribe(client *Client, subs []packet.Subscription, ac
 
 // Unsubscribe will delete the subscription.
 func (m *MemoryBackend) Unsubscribe(client *Client, topics []string, ack Ack) error {
+	// get session
+	sess := client.Session().(*memorySession)
+
 	// delete subscriptions
 	for _, t := range topics {
-		client.Session().(*memorySession).subscriptions.Empty(t)
+		sess.subscriptions.Empty(t)
+		m.subscribers.Remove(t, sess)
 	}
 
 	// call ack if provided
@@ -314,55 +651,170 @@ func (m *MemoryBackend) Unsubscribe(client *Client, topics []string, ack Ack) er
 }
 
 // Publish will handle retained messages and add the message to the session queues.
+// Messages published without a client are dropped for sessions with a full
+// queue instead of waiting for room.
 func (m *MemoryBackend) Publish(client *Client, msg *packet.Message, ack Ack) error {
+	// drop message if tenant exceeded its quota
+	if client != nil && m.quotaExceeded(client) {
+		m.Log(QuotaExceeded, client, nil, msg, nil)
+
+		// call ack if available
+		if ack != nil {
+			ack()
+		}
+
+		return nil
+	}
+
+	// drop message if it would be queued for too many sessions
+	if client != nil && m.MaxFanOut > 0 && m.fanOut(msg.Topic) > m.MaxFanOut {
+		m.Log(LimitExceeded, client, nil, msg, nil)
+
+		// call ack if available
+		if ack != nil {
+			ack()
+		}
+
+		return nil
+	}
+
+	// write message to sink except delayed wills
+	if client != nil && m.Sink != nil && !(m.WillDelay > 0 && msg == client.will) {
+		err := m.Sink(client, msg)
+		if err != nil {
+			return err
+		}
+	}
+
 	// acquire global mutex
 	m.globalMutex.Lock()
 	defer m.globalMutex.Unlock()
 
+	// hold back will message if delayed
+	if m.WillDelay > 0 && !m.closing && client != nil && client.ID() != "" && msg == client.will {
+		m.delayWill(client.ID(), msg)
+		return nil
+	}
+
+	// detach payload from publisher if requested
+	if m.CopyOnWrite {
+		msg = msg.Detach()
+	}
+
+	// publish message
+	err := m.publish(client, msg)
+	if err != nil {
+		return err
+	}
+
+	// record message
+	m.record(msg)
+
+	// call ack if available
+	if ack != nil {
+		ack()
+	}
+
+	return nil
+}
+
+// fanOut returns the number of sessions that have a subscription matching the
+// topic.
+func (m *MemoryBackend) fanOut(topic string) int {
+	return m.subscribers.MatchCount(topic)
+}
+
+// unsubscribeAll removes the subscriptions of a deleted session from the
+// subscribers tree.
+func (m *MemoryBackend) unsubscribeAll(sess *memorySession) {
+	for _, value := range sess.subscriptions.All() {
+		m.subscribers.Remove(value.(*packet.Subscription).Topic, sess)
+	}
+}
+
+// publish will handle retained messages and add the message to the session
+// queues. The client is nil for messages published by the backend itself,
+// which are dropped for sessions with a full queue. The global mutex must be
+// held by the caller.
+func (m *MemoryBackend) publish(client *Client, msg *packet.Message) error {
 	// this implementation is very basic and will block the backend on every
 	// publish. clients that stay connected but won't drain their queue will
 	// eventually deadlock the broker
 
+	// prepare priority lanes
+	err := m.prepareLanes()
+	if err != nil {
+		return err
+	}
+
+	// prepare expiry
+	var expires time.Time
+	if expiry := m.messageExpiry(msg.Topic); expiry > 0 {
+		expires = time.Now().Add(expiry)
+	}
+
 	// check retain flag
 	if msg.Retain {
 		if len(msg.Payload) > 0 {
 			// retain message
-			m.retainedMessages.Set(msg.Topic, msg.Copy())
+			m.retainedMessages.Set(msg.Topic, memoryMessage{Message: msg.Copy(), expires: expires})
 		} else {
 			// clear already retained message
 			m.retainedMessages.Empty(msg.Topic)
 		}
 	}
 
+	// get lane
+	lane := m.laneIndex(msg.Topic)
+
 	// use temporary queue by default
-	queue := func(s *memorySession) chan *packet.Message {
-		return s.temporary
+	queue := func(s *memorySession) chan memoryMessage {
+		return s.lanes[lane].temporary
 	}
 
 	// use stored queue if qos > 0
 	if msg.QOS > 0 {
-		queue = func(s *memorySession) chan *packet.Message {
-			return s.stored
+		queue = func(s *memorySession) chan memoryMessage {
+			return s.lanes[lane].stored
 		}
 	}
 
 	// reset retained flag
 	msg.Retain = false
 
+	// prepare queued message
+	qm := memoryMessage{Message: msg, expires: expires}
+
+	// count dropped messages
+	drop := func() {
+		if m.SysInterval > 0 {
+			m.stats.drop()
+		}
+		atomic.AddInt64(&m.laneCounters[lane].dropped, 1)
+	}
+
 	// add message to temporary sessions
 	for _, sess := range m.temporarySessions {
 		if sub := sess.lookupSubscription(msg.Topic); sub != nil {
-			if sess.owner == client {
+			if client == nil {
+				// drop message if the queue is full as the backend itself
+				// must not block while holding the global mutex
+				select {
+				case queue(sess) <- qm:
+				default:
+					drop()
+				}
+			} else if sess.owner == client {
 				// detect deadlock when adding to own queue
 				select {
-				case queue(sess) <- msg:
+				case queue(sess) <- qm:
 				default:
 					return ErrQueueFull
 				}
 			} else {
 				// wait for room since client is online
 				select {
-				case queue(sess) <- msg:
+				case queue(sess) <- qm:
 				case <-sess.owner.Closed():
 				case <-client.Closed():
 				}
@@ -373,39 +825,37 @@ func (m *MemoryBackend) Publish(client *Client, msg *packet.Message, ack Ack) er
 	// add message to stored sessions
 	for _, sess := range m.storedSessions {
 		if sub := sess.lookupSubscription(msg.Topic); sub != nil {
-			if sess.owner == client {
+			if client != nil && sess.owner == client {
 				// detect deadlock when adding to own queue
 				select {
-				case queue(sess) <- msg:
+				case queue(sess) <- qm:
 				default:
 					return ErrQueueFull
 				}
-			} else if sess.owner != nil {
+			} else if client != nil && sess.owner != nil {
 				// wait for room if client is online
 				select {
-				case queue(sess) <- msg:
+				case queue(sess) <- qm:
 				case <-sess.owner.Closed():
 				case <-client.Closed():
 				}
 			} else {
-				// ignore message if stored queue is full
+				// drop message if stored queue is full or the backend itself
+				// publishes
 				select {
-				case queue(sess) <- msg:
+				case queue(sess) <- qm:
 				default:
+					drop()
 				}
 			}
 		}
 	}
 
-	// call ack if available
-	if ack != nil {
-		ack()
-	}
-
 	return nil
 }
 
-// Dequeue will get the next message from the temporary or stored queue.
+// Dequeue will get the next message from the temporary or stored queue of the
+// lane with the highest priority.
 func (m *MemoryBackend) Dequeue(client *Client) (*packet.Message, Ack, error) {
 	// mutex locking not needed
 
@@ -415,14 +865,32 @@ func (m *MemoryBackend) Dequeue(client *Client) (*packet.Message, Ack, error) {
 	// this implementation is very basic and will dequeue messages immediately
 	// and not return no ack. messages are lost if the client fails to handle them
 
-	// get next message from queue
-	select {
-	case msg := <-sess.temporary:
-		return sess.applyQOS(msg), nil, nil
-	case msg := <-sess.stored:
-		return sess.applyQOS(msg), nil, nil
-	case <-client.Closing():
-		return nil, nil, nil
+	// reset skip counters if the session has been resumed, they are only
+	// accessed by the dequeuer of the current owner
+	if sess.dequeuer != client {
+		sess.dequeuer = client
+		sess.resetSkips()
+	}
+
+	for {
+		// get next queued message or wait for one
+		msg, lane, ok := sess.next(m.PriorityStarvationLimit)
+		if !ok {
+			msg, lane, ok = sess.wait(client.Closing())
+			if !ok {
+				return nil, nil, nil
+			}
+		}
+
+		// skip expired messages
+		if msg.expired(time.Now()) {
+			continue
+		}
+
+		// count delivery
+		atomic.AddInt64(&m.laneCounters[lane].delivered, 1)
+
+		return sess.applyQOS(msg.Message), nil, nil
 	}
 }
 
@@ -436,34 +904,81 @@ func (m *MemoryBackend) Terminate(client *Client) error {
 	sess, ok := client.Session().(*memorySession)
 	if ok && sess != nil {
 		sess.owner = nil
+		sess.offline = time.Now()
+		sess.expiry = client.SessionExpiry
+	}
+
+	// start session scanner if the session expires
+	if client.SessionExpiry > 0 && !m.closing {
+		m.scanner.Do(func() {
+			go m.scan()
+		})
 	}
 
 	// remove any temporary session
-	delete(m.temporarySessions, client)
+	if sess, ok := m.temporarySessions[client]; ok {
+		m.unsubscribeAll(sess)
+		delete(m.temporarySessions, client)
+	}
 
-	// remove any saved client
-	delete(m.activeClients, client.ID())
+	// remove client from tenant
+	m.tenants.remove(client)
+
+	// remove saved client if not taken over
+	if m.activeClients[client.ID()] == client {
+		delete(m.activeClients, client.ID())
+	}
 
 	return nil
 }
 
-// Log will call the associated logger.
+// Log will update the broker statistics and call the associated logger.
 func (m *MemoryBackend) Log(event LogEvent, client *Client, pkt packet.Generic, msg *packet.Message, err error) {
+	// update statistics if enabled
+	if m.SysInterval > 0 {
+		m.stats.count(event, pkt)
+	}
+	if client != nil && pkt != nil && m.tenantsEnabled() {
+		m.tenants.count(m.tenant(client), event, pkt)
+	}
+
 	// call logger if available
 	if m.Logger != nil {
 		m.Logger(event, client, pkt, msg, err)
 	}
 }
 
+// TenantStats returns the usage statistics of all tenants with connected clients.
+func (m *MemoryBackend) TenantStats() map[string]TenantStats {
+	return m.tenants.snapshot(false)
+}
+
+// ResetTenantStats returns the usage statistics of all tenants and resets them
+// afterwards. It can be called at the end of a billing period to start over.
+func (m *MemoryBackend) ResetTenantStats() map[string]TenantStats {
+	return m.tenants.snapshot(true)
+}
+
 // Close will close all active clients and close the backend. The return value
 // denotes if the timeout has been reached.
 func (m *MemoryBackend) Close(timeout time.Duration) bool {
 	// acquire global mutex
 	m.globalMutex.Lock()
 
+	// stop session scanner
+	if !m.closing {
+		close(m.quit)
+	}
+
 	// set closing
 	m.closing = true
 
+	// discard pending wills
+	for id, timer := range m.pendingWills {
+		timer.Stop()
+		delete(m.pendingWills, id)
+	}
+
 	// prepare list
 	var clients []*Client
 
@@ -504,3 +1019,162 @@ func (m *MemoryBackend) Close(timeout time.Duration) bool {
 
 	return true
 }
+
+// scan will periodically remove expired stored sessions and messages until the
+// backend is closed.
+func (m *MemoryBackend) scan() {
+	// get interval
+	interval := m.SessionScanInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	// prepare ticker
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.expire()
+		case <-m.quit:
+			return
+		}
+	}
+}
+
+// expire will remove all stored sessions that have been offline for longer
+// than their session expiry as well as expired messages from offline
+// sessions and the retained store and outdated flapping records.
+func (m *MemoryBackend) expire() {
+	// acquire setup mutex to prevent concurrent session takeovers
+	m.setupMutex.Lock()
+	defer m.setupMutex.Unlock()
+
+	// acquire global mutex
+	m.globalMutex.Lock()
+
+	// collect and remove expired sessions
+	var expired []string
+	for id, sess := range m.storedSessions {
+		if sess.owner == nil && sess.expiry > 0 && time.Since(sess.offline) > sess.expiry {
+			m.unsubscribeAll(sess)
+			delete(m.storedSessions, id)
+			expired = append(expired, id)
+		}
+	}
+
+	// remove expired messages
+	if len(m.MessageExpiry) > 0 {
+		now := time.Now()
+
+		// remove messages from offline sessions
+		for _, sess := range m.storedSessions {
+			if sess.owner == nil {
+				sess.dropExpired(now)
+			}
+		}
+
+		// remove retained messages
+		for _, value := range m.retainedMessages.All() {
+			if msg := value.(memoryMessage); msg.expired(now) {
+				m.retainedMessages.Empty(msg.Topic)
+			}
+		}
+	}
+
+	// release mutex
+	m.globalMutex.Unlock()
+
+	// remove outdated flapping records
+	if m.Flapping.Threshold > 0 {
+		m.flapping.sweep(m.Flapping, time.Now())
+	}
+
+	// log expired sessions and call callback if available
+	for _, id := range expired {
+		m.Log(SessionExpired, nil, nil, nil, &ExpiredSession{ID: id})
+
+		if m.SessionExpiryCallback != nil {
+			m.SessionExpiryCallback(id)
+		}
+	}
+}
+
+// delayWill will publish the will message after the configured will delay
+// unless it is canceled by a new connection. The global mutex must be held by
+// the caller.
+func (m *MemoryBackend) delayWill(id string, msg *packet.Message) {
+	// start timer
+	var timer *time.Timer
+	timer = time.AfterFunc(m.WillDelay, func() {
+		// acquire global mutex
+		m.globalMutex.Lock()
+
+		// check if still pending
+		if m.closing || m.pendingWills[id] != timer {
+			m.globalMutex.Unlock()
+			return
+		}
+
+		// remove will
+		delete(m.pendingWills, id)
+
+		// publish message
+		err := m.publish(nil, msg)
+
+		// release mutex
+		m.globalMutex.Unlock()
+
+		// log error
+		if err != nil {
+			m.Log(BackendError, nil, nil, msg, err)
+		}
+	})
+
+	// replace any pending will
+	if existing, ok := m.pendingWills[id]; ok {
+		existing.Stop()
+	}
+
+	// save timer
+	m.pendingWills[id] = timer
+}
+
+func (m *MemoryBackend) messageExpiry(name string) time.Duration {
+	// find shortest matching expiry
+	var expiry time.Duration
+	for filter, interval := range m.MessageExpiry {
+		if interval > 0 && topic.Match(name, filter) && (expiry == 0 || interval < expiry) {
+			expiry = interval
+		}
+	}
+
+	return expiry
+}
+
+func (m *MemoryBackend) tenantsEnabled() bool {
+	return m.Tenant != nil || len(m.TenantQuotas) > 0
+}
+
+func (m *MemoryBackend) tenant(client *Client) string {
+	// use callback if available
+	if m.Tenant != nil {
+		return m.Tenant(client)
+	}
+
+	return client.Username()
+}
+
+func (m *MemoryBackend) quotaExceeded(client *Client) bool {
+	// get tenant
+	tenant := m.tenant(client)
+
+	// get quota
+	quota, ok := m.TenantQuotas[tenant]
+	if !ok {
+		return false
+	}
+
+	return quota.exceeded(m.tenants.get(tenant))
+}
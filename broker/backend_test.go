@@ -1,12 +1,15 @@
 package broker
 
 import (
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/256dpi/gomqtt/client"
 	"github.com/256dpi/gomqtt/packet"
 	"github.com/256dpi/gomqtt/spec"
+	"github.com/256dpi/gomqtt/transport"
+	"github.com/256dpi/gomqtt/transport/flow"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -17,6 +20,9 @@ func TestBrokerWithMemoryBackend(t *testing.T) {
 		"allow": "allow",
 	}
 
+	// speed up the packet id rollover test
+	backend.ClientInflightMessages = 100
+
 	port, quit, done := Run(NewEngine(backend), "tcp")
 
 	config := spec.AllFeatures()
@@ -26,8 +32,16 @@ func TestBrokerWithMemoryBackend(t *testing.T) {
 	config.NoMessageWait = 50 * time.Millisecond
 	config.MessageRetainWait = 50 * time.Millisecond
 
+	// the memory backend does not support shared subscriptions
+	config.SharedSubscriptions = false
+
+	config.Report = &spec.Report{}
+
 	spec.Run(t, config)
 
+	assert.NotEmpty(t, config.Report.Results())
+	assert.False(t, config.Report.Failed())
+
 	close(quit)
 
 	safeReceive(done)
@@ -86,3 +100,643 @@ func TestMemoryBackendClose(t *testing.T) {
 
 	safeReceive(done)
 }
+
+func TestMemoryBackendSessionExpiry(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.SessionExpiry = 50 * time.Millisecond
+	backend.SessionScanInterval = 10 * time.Millisecond
+	backend.SysInterval = time.Hour
+
+	expired := make(chan string, 1)
+	backend.SessionExpiryCallback = func(id string) {
+		expired <- id
+	}
+
+	logged := make(chan struct{}, 1)
+	backend.Logger = func(event LogEvent, client *Client, _ packet.Generic, _ *packet.Message, err error) {
+		if event == SessionExpired {
+			assert.Nil(t, client)
+			assert.Equal(t, &ExpiredSession{ID: "expiry"}, err)
+			logged <- struct{}{}
+		}
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	options := client.NewConfigWithClientID("tcp://localhost:"+port, "expiry")
+	options.CleanSession = false
+
+	client1 := client.New()
+
+	cf, err := client1.Connect(options)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.False(t, cf.SessionPresent())
+
+	err = client1.Disconnect()
+	assert.NoError(t, err)
+
+	select {
+	case id := <-expired:
+		assert.Equal(t, "expiry", id)
+	case <-time.After(10 * time.Second):
+		assert.Fail(t, "session did not expire")
+	}
+
+	safeReceive(logged)
+	assert.Equal(t, int64(1), backend.stats.counters()["sessions/expired"])
+
+	client2 := client.New()
+
+	cf, err = client2.Connect(options)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.False(t, cf.SessionPresent())
+
+	err = client2.Disconnect()
+	assert.NoError(t, err)
+
+	ret := backend.Close(5 * time.Second)
+	assert.True(t, ret)
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+type expiryMemoryBackend struct {
+	*MemoryBackend
+}
+
+func (b *expiryMemoryBackend) Setup(client *Client, id string, clean bool) (Session, bool, error) {
+	sess, resumed, err := b.MemoryBackend.Setup(client, id, clean)
+	if id == "short" {
+		client.SessionExpiry = 50 * time.Millisecond
+	}
+
+	return sess, resumed, err
+}
+
+func TestMemoryBackendClientSessionExpiry(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.SessionScanInterval = 10 * time.Millisecond
+
+	expired := make(chan string, 2)
+	backend.SessionExpiryCallback = func(id string) {
+		expired <- id
+	}
+
+	port, quit, done := Run(NewEngine(&expiryMemoryBackend{backend}), "tcp")
+
+	for _, id := range []string{"long", "short"} {
+		options := client.NewConfigWithClientID("tcp://localhost:"+port, id)
+		options.CleanSession = false
+
+		client1 := client.New()
+
+		cf, err := client1.Connect(options)
+		assert.NoError(t, err)
+		assert.NoError(t, cf.Wait(10*time.Second))
+
+		err = client1.Disconnect()
+		assert.NoError(t, err)
+	}
+
+	select {
+	case id := <-expired:
+		assert.Equal(t, "short", id)
+	case <-time.After(10 * time.Second):
+		assert.Fail(t, "session did not expire")
+	}
+
+	select {
+	case id := <-expired:
+		assert.Fail(t, "unexpected expiry", id)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	ret := backend.Close(5 * time.Second)
+	assert.True(t, ret)
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestMemoryBackendSessionTakeover(t *testing.T) {
+	events := make(chan *Client, 10)
+
+	backend := NewMemoryBackend()
+	backend.Logger = func(event LogEvent, client *Client, _ packet.Generic, _ *packet.Message, _ error) {
+		if event == SessionTakenOver {
+			events <- client
+		}
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	options := client.NewConfigWithClientID("tcp://localhost:"+port, "takeover")
+	options.CleanSession = false
+
+	wait := make(chan struct{})
+	client1 := client.New()
+	client1.Callback = func(msg *packet.Message, err error) error {
+		assert.Nil(t, msg)
+		assert.Error(t, err)
+		close(wait)
+
+		return nil
+	}
+
+	cf, err := client1.Connect(options)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.False(t, cf.SessionPresent())
+
+	client2 := client.New()
+
+	cf, err = client2.Connect(options)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
+	assert.True(t, cf.SessionPresent())
+
+	safeReceive(wait)
+
+	existing := <-events
+	assert.Equal(t, "takeover", existing.ID())
+
+	assert.NoError(t, client2.Disconnect())
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestMemoryBackendRejectClient(t *testing.T) {
+	disconnected := make(chan struct{}, 10)
+
+	backend := NewMemoryBackend()
+	backend.SessionTakeover = RejectClient
+	backend.Logger = func(event LogEvent, _ *Client, _ packet.Generic, _ *packet.Message, _ error) {
+		if event == ClientDisconnected {
+			disconnected <- struct{}{}
+		}
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	options := client.NewConfigWithClientID("tcp://localhost:"+port, "reject")
+
+	client1 := client.New()
+
+	cf, err := client1.Connect(options)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
+
+	wait := make(chan struct{})
+	client2 := client.New()
+	client2.Callback = func(msg *packet.Message, err error) error {
+		assert.Nil(t, msg)
+		assert.True(t, errors.Is(err, client.ErrClientConnectionDenied))
+		close(wait)
+
+		return nil
+	}
+
+	cf, err = client2.Connect(options)
+	assert.NoError(t, err)
+	assert.Error(t, cf.Wait(10*time.Second))
+	assert.Equal(t, packet.IdentifierRejected, cf.ReturnCode())
+
+	safeReceive(wait)
+
+	// existing client is still connected
+	pf, err := client1.Publish("test", nil, 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(10*time.Second))
+
+	assert.NoError(t, client1.Disconnect())
+	<-disconnected
+
+	// client id is available again
+	client3 := client.New()
+
+	cf, err = client3.Connect(options)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
+
+	assert.NoError(t, client3.Disconnect())
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestMemoryBackendMessageExpiry(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.MessageExpiry = map[string]time.Duration{
+		"expire/#": 50 * time.Millisecond,
+	}
+	backend.SessionScanInterval = 10 * time.Millisecond
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	options := client.NewConfigWithClientID("tcp://localhost:"+port, "expiry")
+	options.CleanSession = false
+
+	subscriber := client.New()
+
+	cf, err := subscriber.Connect(options)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	sf, err := subscriber.SubscribeMultiple([]packet.Subscription{
+		{Topic: "expire/queued", QOS: 1},
+		{Topic: "keep/queued", QOS: 1},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(10*time.Second))
+
+	err = subscriber.Disconnect()
+	assert.NoError(t, err)
+
+	publisher := client.New()
+
+	cf, err = publisher.Connect(client.NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	for _, msg := range []packet.Message{
+		{Topic: "expire/retained", Payload: []byte("1"), Retain: true},
+		{Topic: "keep/retained", Payload: []byte("2"), Retain: true},
+		{Topic: "expire/queued", Payload: []byte("3"), QOS: 1},
+		{Topic: "keep/queued", Payload: []byte("4"), QOS: 1},
+	} {
+		pf, err := publisher.PublishMessage(msg.Copy())
+		assert.NoError(t, err)
+		assert.NoError(t, pf.Wait(10*time.Second))
+	}
+
+	err = publisher.Disconnect()
+	assert.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+
+	received := make(chan string, 10)
+
+	subscriber = client.New()
+	subscriber.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		received <- msg.Topic
+		return nil
+	}
+
+	cf, err = subscriber.Connect(options)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.True(t, cf.SessionPresent())
+
+	sf, err = subscriber.Subscribe("+/retained", 0)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(10*time.Second))
+
+	var topics []string
+	timeout := time.After(100 * time.Millisecond)
+	for waiting := true; waiting; {
+		select {
+		case topic := <-received:
+			topics = append(topics, topic)
+		case <-timeout:
+			waiting = false
+		}
+	}
+	assert.ElementsMatch(t, []string{"keep/queued", "keep/retained"}, topics)
+
+	err = subscriber.Disconnect()
+	assert.NoError(t, err)
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestMemoryBackendWillDelay(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.WillDelay = 100 * time.Millisecond
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	received := make(chan *packet.Message, 10)
+
+	subscriber := client.New()
+	subscriber.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		received <- msg
+		return nil
+	}
+
+	cf, err := subscriber.Connect(client.NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	sf, err := subscriber.Subscribe("will", 0)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(10*time.Second))
+
+	options := client.NewConfigWithClientID("tcp://localhost:"+port, "will")
+	options.WillMessage = &packet.Message{Topic: "will", Payload: []byte("gone")}
+
+	// reconnect in time
+	client1 := client.New()
+
+	cf, err = client1.Connect(options)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	assert.NoError(t, client1.Close())
+
+	time.Sleep(20 * time.Millisecond)
+
+	client2 := client.New()
+
+	cf, err = client2.Connect(options)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	select {
+	case msg := <-received:
+		assert.Fail(t, "unexpected will", msg.String())
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// stay away
+	assert.NoError(t, client2.Close())
+
+	start := time.Now()
+
+	msg := <-received
+	assert.Equal(t, "will", msg.Topic)
+	assert.Equal(t, []byte("gone"), msg.Payload)
+	assert.True(t, time.Since(start) > 50*time.Millisecond)
+
+	assert.NoError(t, subscriber.Disconnect())
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestMemoryBackendSink(t *testing.T) {
+	sunk := make(chan *packet.Message, 1)
+	release := make(chan struct{})
+
+	backend := NewMemoryBackend()
+	backend.Sink = func(client *Client, msg *packet.Message) error {
+		sunk <- msg
+		<-release
+		return nil
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	f := flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(&packet.Publish{Message: packet.Message{Topic: "test", Payload: []byte("test"), QOS: 2}, ID: 1}).
+		Receive(&packet.Pubrec{ID: 1}).
+		Send(&packet.Pubrel{ID: 1}).
+		Run(func() {
+			msg := <-sunk
+			assert.Equal(t, "test", msg.Topic)
+			close(release)
+		}).
+		Receive(&packet.Pubcomp{ID: 1}).
+		Send(packet.NewDisconnect()).
+		End()
+
+	err = f.Test(conn)
+	assert.NoError(t, err)
+
+	ret := backend.Close(5 * time.Second)
+	assert.True(t, ret)
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestMemoryBackendSinkError(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.Sink = func(client *Client, msg *packet.Message) error {
+		return errors.New("failed")
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	f := flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(&packet.Publish{Message: packet.Message{Topic: "test", QOS: 1}, ID: 1}).
+		End()
+
+	err = f.Test(conn)
+	assert.NoError(t, err)
+
+	ret := backend.Close(5 * time.Second)
+	assert.True(t, ret)
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestMemoryBackendCopyOnWrite(t *testing.T) {
+	retained := func(backend *MemoryBackend) []byte {
+		values := backend.retainedMessages.Get("test")
+		assert.Len(t, values, 1)
+		return values[0].(memoryMessage).Payload
+	}
+
+	backend := NewMemoryBackend()
+
+	payload := []byte("foo")
+	err := backend.Publish(nil, &packet.Message{Topic: "test", Payload: payload, Retain: true}, nil)
+	assert.NoError(t, err)
+
+	payload[0] = 'b'
+	assert.Equal(t, []byte("boo"), retained(backend))
+
+	backend = NewMemoryBackend()
+	backend.CopyOnWrite = true
+
+	payload = []byte("foo")
+	err = backend.Publish(nil, &packet.Message{Topic: "test", Payload: payload, Retain: true}, nil)
+	assert.NoError(t, err)
+
+	payload[0] = 'b'
+	assert.Equal(t, []byte("foo"), retained(backend))
+}
+
+func TestMemoryBackendSharedFrames(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.SharedFrames = 10
+
+	engine := NewEngine(backend)
+
+	frames := make(chan *packet.Frame, 2)
+	engine.Interceptors = []transport.Interceptor{{
+		Outgoing: func(pkt packet.Generic) (packet.Generic, error) {
+			if frame, ok := pkt.(*packet.Frame); ok {
+				frames <- frame
+			}
+
+			return pkt, nil
+		},
+	}}
+
+	port, quit, done := Run(engine, "tcp")
+
+	received := make(chan struct{}, 2)
+
+	var clients []*client.Client
+	for i := 0; i < 2; i++ {
+		c := client.New()
+		c.Callback = func(msg *packet.Message, err error) error {
+			assert.NoError(t, err)
+			assert.Equal(t, "test", msg.Topic)
+			assert.Equal(t, []byte("test"), msg.Payload)
+			received <- struct{}{}
+			return nil
+		}
+
+		cf, err := c.Connect(client.NewConfig("tcp://localhost:" + port))
+		assert.NoError(t, err)
+		assert.NoError(t, cf.Wait(10*time.Second))
+
+		sf, err := c.Subscribe("test", 0)
+		assert.NoError(t, err)
+		assert.NoError(t, sf.Wait(10*time.Second))
+
+		clients = append(clients, c)
+	}
+
+	pf, err := clients[0].Publish("test", []byte("test"), 0, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(10*time.Second))
+
+	safeReceive(received)
+	safeReceive(received)
+
+	frame1 := <-frames
+	frame2 := <-frames
+	assert.True(t, frame1 == frame2)
+
+	for _, c := range clients {
+		assert.NoError(t, c.Disconnect())
+	}
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestMemoryBackendMaxFanOut(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.MaxFanOut = 1
+
+	exceeded := make(chan *packet.Message, 1)
+	backend.Logger = func(event LogEvent, _ *Client, _ packet.Generic, msg *packet.Message, _ error) {
+		if event == LimitExceeded {
+			exceeded <- msg
+		}
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	conn1, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	conn2, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	subscribe := func(topic string) *flow.Flow {
+		return flow.New().
+			Send(packet.NewConnect()).
+			Receive(packet.NewConnack()).
+			Send(&packet.Subscribe{Subscriptions: []packet.Subscription{{Topic: topic}}, ID: 1}).
+			Receive(&packet.Suback{ID: 1, ReturnCodes: []packet.QOS{0}})
+	}
+
+	assert.NoError(t, subscribe("cold").Test(conn1))
+	assert.NoError(t, subscribe("+").Test(conn2))
+
+	f := flow.New().
+		Send(&packet.Publish{Message: packet.Message{Topic: "hot", Payload: []byte("1"), QOS: 1}, ID: 2}).
+		Receive(&packet.Puback{ID: 2}, &packet.Publish{Message: packet.Message{Topic: "hot", Payload: []byte("1")}}).
+		Send(&packet.Publish{Message: packet.Message{Topic: "cold", Payload: []byte("2"), QOS: 1}, ID: 3}).
+		Receive(&packet.Puback{ID: 3}).
+		Send(packet.NewDisconnect()).
+		End()
+
+	assert.NoError(t, f.Test(conn2))
+
+	msg := <-exceeded
+	assert.Equal(t, "cold", msg.Topic)
+
+	f = flow.New().
+		Send(packet.NewDisconnect()).
+		End()
+
+	assert.NoError(t, f.Test(conn1))
+
+	ret := backend.Close(5 * time.Second)
+	assert.True(t, ret)
+
+	assert.Equal(t, 0, backend.subscribers.Count())
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestMemoryBackendPublishFullQueue(t *testing.T) {
+	backend := NewMemoryBackend()
+	assert.NoError(t, backend.prepareLanes())
+
+	// online subscribers that do not dequeue
+	for _, stored := range []bool{false, true} {
+		owner := &Client{}
+
+		sess := newMemorySession(1, 1)
+		sess.owner = owner
+		sess.subscriptions.Set("foo", &packet.Subscription{Topic: "foo"})
+
+		if stored {
+			backend.storedSessions["stored"] = sess
+		} else {
+			backend.temporarySessions[owner] = sess
+		}
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		for i := 0; i < 3; i++ {
+			err := backend.Publish(nil, &packet.Message{Topic: "foo"}, nil)
+			assert.NoError(t, err)
+		}
+
+		close(done)
+	}()
+
+	safeReceive(done)
+
+	assert.Equal(t, int64(4), backend.LaneStats()[DefaultLane].Dropped)
+}
@@ -0,0 +1,298 @@
+package broker
+
+import (
+	"hash/fnv"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/topic"
+	"github.com/256dpi/gomqtt/transport"
+)
+
+// BridgeDirection defines in which direction messages are forwarded.
+type BridgeDirection int
+
+// The available bridge directions.
+const (
+	// BridgeOut forwards messages from the local to the remote broker.
+	BridgeOut BridgeDirection = iota + 1
+
+	// BridgeIn forwards messages from the remote to the local broker.
+	BridgeIn
+
+	// BridgeBoth forwards messages in both directions.
+	BridgeBoth
+)
+
+// A BridgeTopic defines a topic mapping between the local and the remote
+// broker. Like in mosquitto, the topic filter is specified relative to the
+// prefixes: A mapping for "sensors/#" with the local prefix "local/" and the
+// remote prefix "site1/" will forward messages published locally on
+// "local/sensors/a" to "site1/sensors/a" on the remote broker and vice versa.
+type BridgeTopic struct {
+	// The topic filter relative to the prefixes.
+	Topic string
+
+	// The direction in which messages are forwarded.
+	Direction BridgeDirection
+
+	// The maximum QOS level of forwarded messages. It is used for the
+	// subscription and messages with a higher QOS level are downgraded.
+	QOS packet.QOS
+
+	// The prefixes prepended to the topic on the local and remote broker.
+	LocalPrefix  string
+	RemotePrefix string
+}
+
+func (t BridgeTopic) forwards(direction BridgeDirection) bool {
+	return t.Direction == direction || t.Direction == BridgeBoth
+}
+
+func (t BridgeTopic) matches(name, prefix string) bool {
+	return strings.HasPrefix(name, prefix) && topic.Match(strings.TrimPrefix(name, prefix), t.Topic)
+}
+
+// A Bridge connects the broker as a client to a remote broker and forwards
+// messages between both brokers according to the configured topic mappings.
+//
+// The bridge connects to the engine using an in-memory connection that is
+// handled like any other client connection, which means that the engine's
+// backend authenticates and authorizes the bridge. Both connections are
+// maintained by a client.Service and are reestablished automatically.
+//
+// Note: Messages that are forwarded in both directions would be echoed back by
+// the brokers. The bridge drops those echoes by tracking the messages it has
+// forwarded.
+type Bridge struct {
+	// The topic mappings.
+	Topics []BridgeTopic
+
+	// The service used for the connection to the engine. The service can be
+	// configured before starting the bridge.
+	Local *client.Service
+
+	// The service used for the connection to the remote broker. The service
+	// can be configured before starting the bridge.
+	Remote *client.Service
+
+	engine *Engine
+
+	inEchoes  *bridgeEchoes
+	outEchoes *bridgeEchoes
+}
+
+// NewBridge returns a new Bridge that forwards messages between the specified
+// engine and a remote broker.
+func NewBridge(engine *Engine, topics ...BridgeTopic) *Bridge {
+	return &Bridge{
+		Topics:    topics,
+		Local:     client.NewService(),
+		Remote:    client.NewService(),
+		engine:    engine,
+		inEchoes:  newBridgeEchoes(),
+		outEchoes: newBridgeEchoes(),
+	}
+}
+
+// Start will connect the bridge to the engine and remote broker using the
+// specified configurations. The local config may be nil to connect without
+// credentials. The broker URL and dialer of the local config are ignored.
+func (b *Bridge) Start(local, remote *client.Config) {
+	// prepare local config
+	if local == nil {
+		local = client.NewConfig("tcp://bridge")
+	} else {
+		copied := *local
+		local = &copied
+	}
+	if local.BrokerURL == "" {
+		local.BrokerURL = "tcp://bridge"
+	}
+	local.Dialer = &bridgeDialer{engine: b.engine}
+
+	// set callbacks
+	b.Local.MessageCallback = b.forwardOut
+	b.Remote.MessageCallback = b.forwardIn
+
+	// start services
+	b.Local.Start(local)
+	b.Remote.Start(remote)
+
+	// collect subscriptions
+	var localSubs, remoteSubs []packet.Subscription
+	for _, t := range b.Topics {
+		if t.forwards(BridgeOut) {
+			localSubs = append(localSubs, packet.Subscription{Topic: t.LocalPrefix + t.Topic, QOS: t.QOS})
+		}
+		if t.forwards(BridgeIn) {
+			remoteSubs = append(remoteSubs, packet.Subscription{Topic: t.RemotePrefix + t.Topic, QOS: t.QOS})
+		}
+	}
+
+	// subscribe topics
+	if len(localSubs) > 0 {
+		b.Local.SubscribeMultiple(localSubs)
+	}
+	if len(remoteSubs) > 0 {
+		b.Remote.SubscribeMultiple(remoteSubs)
+	}
+}
+
+// Stop will disconnect the bridge from both brokers.
+func (b *Bridge) Stop() {
+	b.Local.Stop(true)
+	b.Remote.Stop(true)
+}
+
+func (b *Bridge) forwardIn(msg *packet.Message) error {
+	// drop echoes of forwarded messages
+	if b.outEchoes.take(msg.Topic, msg.Payload) {
+		return nil
+	}
+
+	// find mapping
+	for _, t := range b.Topics {
+		if t.forwards(BridgeIn) && t.matches(msg.Topic, t.RemotePrefix) {
+			// map message
+			fwd := b.mapMessage(msg, t.LocalPrefix+strings.TrimPrefix(msg.Topic, t.RemotePrefix), t.QOS)
+
+			// expect echo if the message is forwarded back
+			if b.forwarded(BridgeOut, fwd.Topic) {
+				b.inEchoes.add(fwd.Topic, fwd.Payload)
+			}
+
+			// publish message
+			b.Local.PublishMessage(fwd)
+
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (b *Bridge) forwardOut(msg *packet.Message) error {
+	// drop echoes of forwarded messages
+	if b.inEchoes.take(msg.Topic, msg.Payload) {
+		return nil
+	}
+
+	// find mapping
+	for _, t := range b.Topics {
+		if t.forwards(BridgeOut) && t.matches(msg.Topic, t.LocalPrefix) {
+			// map message
+			fwd := b.mapMessage(msg, t.RemotePrefix+strings.TrimPrefix(msg.Topic, t.LocalPrefix), t.QOS)
+
+			// expect echo if the message is forwarded back
+			if b.forwarded(BridgeIn, fwd.Topic) {
+				b.outEchoes.add(fwd.Topic, fwd.Payload)
+			}
+
+			// publish message
+			b.Remote.PublishMessage(fwd)
+
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (b *Bridge) forwarded(direction BridgeDirection, name string) bool {
+	for _, t := range b.Topics {
+		prefix := t.LocalPrefix
+		if direction == BridgeIn {
+			prefix = t.RemotePrefix
+		}
+
+		if t.forwards(direction) && t.matches(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b *Bridge) mapMessage(msg *packet.Message, name string, qos packet.QOS) *packet.Message {
+	// copy message
+	fwd := msg.Copy()
+	fwd.Topic = name
+
+	// downgrade qos
+	if fwd.QOS > qos {
+		fwd.QOS = qos
+	}
+
+	return fwd
+}
+
+type bridgeDialer struct {
+	engine *Engine
+}
+
+func (d *bridgeDialer) Dial(string) (transport.Conn, error) {
+	// create in-memory connection
+	local, remote := net.Pipe()
+
+	// handle remote end
+	if !d.engine.Handle(transport.NewNetConn(remote, 0)) {
+		_ = local.Close()
+		return nil, ErrClosing
+	}
+
+	return transport.NewNetConn(local, 0), nil
+}
+
+type bridgeEchoes struct {
+	counts map[uint64]int
+	mutex  sync.Mutex
+}
+
+func newBridgeEchoes() *bridgeEchoes {
+	return &bridgeEchoes{
+		counts: make(map[uint64]int),
+	}
+}
+
+func (e *bridgeEchoes) add(name string, payload []byte) {
+	// acquire mutex
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// increment count
+	e.counts[bridgeEchoKey(name, payload)]++
+}
+
+func (e *bridgeEchoes) take(name string, payload []byte) bool {
+	// acquire mutex
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// check count
+	key := bridgeEchoKey(name, payload)
+	count := e.counts[key]
+	if count == 0 {
+		return false
+	}
+
+	// decrement count
+	if count == 1 {
+		delete(e.counts, key)
+	} else {
+		e.counts[key] = count - 1
+	}
+
+	return true
+}
+
+func bridgeEchoKey(name string, payload []byte) uint64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(name))
+	_, _ = hash.Write([]byte{0})
+	_, _ = hash.Write(payload)
+	return hash.Sum64()
+}
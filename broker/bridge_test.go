@@ -0,0 +1,140 @@
+package broker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func bridgeTestBroker(subscribed chan struct{}) (*Engine, string, chan struct{}, chan struct{}) {
+	backend := NewMemoryBackend()
+	backend.Logger = func(event LogEvent, _ *Client, pkt packet.Generic, _ *packet.Message, _ error) {
+		if _, ok := pkt.(*packet.Suback); ok && event == PacketSent {
+			subscribed <- struct{}{}
+		}
+	}
+
+	engine := NewEngine(backend)
+	port, quit, done := Run(engine, "tcp")
+
+	return engine, port, quit, done
+}
+
+func bridgeTestClient(t *testing.T, port, filter string) (*client.Client, chan *packet.Message) {
+	received := make(chan *packet.Message, 10)
+
+	c := client.New()
+	c.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		received <- msg
+		return nil
+	}
+
+	cf, err := c.Connect(client.NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	sf, err := c.Subscribe(filter, 2)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(10*time.Second))
+
+	return c, received
+}
+
+func TestBridge(t *testing.T) {
+	localSubscribed := make(chan struct{}, 10)
+	remoteSubscribed := make(chan struct{}, 10)
+
+	localEngine, localPort, localQuit, localDone := bridgeTestBroker(localSubscribed)
+	_, remotePort, remoteQuit, remoteDone := bridgeTestBroker(remoteSubscribed)
+
+	localClient, localReceived := bridgeTestClient(t, localPort, "#")
+	<-localSubscribed
+	remoteClient, remoteReceived := bridgeTestClient(t, remotePort, "#")
+	<-remoteSubscribed
+
+	bridge := NewBridge(localEngine, BridgeTopic{
+		Topic:        "sensors/#",
+		Direction:    BridgeBoth,
+		QOS:          1,
+		LocalPrefix:  "local/",
+		RemotePrefix: "site1/",
+	}, BridgeTopic{
+		Topic:     "commands/#",
+		Direction: BridgeIn,
+		QOS:       0,
+	})
+	bridge.Start(nil, client.NewConfig("tcp://localhost:"+remotePort))
+
+	<-localSubscribed
+	<-remoteSubscribed
+
+	// local to remote
+	pf, err := localClient.Publish("local/sensors/a", []byte("1"), 2, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(10*time.Second))
+
+	msg := <-localReceived
+	assert.Equal(t, "local/sensors/a", msg.Topic)
+
+	msg = <-remoteReceived
+	assert.Equal(t, "site1/sensors/a", msg.Topic)
+	assert.Equal(t, []byte("1"), msg.Payload)
+	assert.Equal(t, packet.QOS(1), msg.QOS)
+
+	// remote to local
+	pf, err = remoteClient.Publish("site1/sensors/b", []byte("2"), 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(10*time.Second))
+
+	msg = <-remoteReceived
+	assert.Equal(t, "site1/sensors/b", msg.Topic)
+
+	msg = <-localReceived
+	assert.Equal(t, "local/sensors/b", msg.Topic)
+	assert.Equal(t, []byte("2"), msg.Payload)
+
+	// inbound only
+	pf, err = remoteClient.Publish("commands/c", []byte("3"), 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(10*time.Second))
+
+	msg = <-remoteReceived
+	assert.Equal(t, "commands/c", msg.Topic)
+
+	msg = <-localReceived
+	assert.Equal(t, "commands/c", msg.Topic)
+	assert.Equal(t, packet.QOS(0), msg.QOS)
+
+	// unmapped
+	pf, err = localClient.Publish("commands/d", []byte("4"), 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(10*time.Second))
+
+	msg = <-localReceived
+	assert.Equal(t, "commands/d", msg.Topic)
+
+	// no echoes
+	select {
+	case msg = <-localReceived:
+		assert.Fail(t, "unexpected message", msg.String())
+	case msg = <-remoteReceived:
+		assert.Fail(t, "unexpected message", msg.String())
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	bridge.Stop()
+
+	assert.NoError(t, localClient.Disconnect())
+	assert.NoError(t, remoteClient.Disconnect())
+
+	close(localQuit)
+	close(remoteQuit)
+
+	safeReceive(localDone)
+	safeReceive(remoteDone)
+}
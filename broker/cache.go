@@ -0,0 +1,181 @@
+package broker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/topic"
+)
+
+type authorizerCacheKey struct {
+	client *Client
+	topic  string
+	access Access
+}
+
+type authorizerCacheEntry struct {
+	allowed bool
+	rule    *ACLRule
+	user    string
+	expires time.Time
+}
+
+// A CachedAuthorizer is an Authorizer that caches the decisions of another
+// authorizer per client, topic and access for the configured TTL. It can be
+// used to avoid consulting e.g. a database backed authorizer for every single
+// publish. Errors returned by the authorizer are not cached. If the authorizer
+// implements RuleAuthorizer, the deciding rules are cached and reported along
+// with the decisions.
+//
+// Cached decisions can be invalidated explicitly when the underlying
+// permissions change. Expired decisions are removed periodically.
+type CachedAuthorizer struct {
+	// The authorizer whose decisions are cached.
+	Authorizer Authorizer
+
+	// The duration for which decisions are cached.
+	TTL time.Duration
+
+	entries    map[authorizerCacheKey]authorizerCacheEntry
+	generation uint64
+	swept      time.Time
+	mutex      sync.Mutex
+}
+
+// NewCachedAuthorizer returns a new CachedAuthorizer that caches the decisions
+// of the specified authorizer for the specified duration.
+func NewCachedAuthorizer(authorizer Authorizer, ttl time.Duration) *CachedAuthorizer {
+	return &CachedAuthorizer{
+		Authorizer: authorizer,
+		TTL:        ttl,
+		entries:    make(map[authorizerCacheKey]authorizerCacheEntry),
+		swept:      time.Now(),
+	}
+}
+
+// Authorize implements the Authorizer interface.
+func (a *CachedAuthorizer) Authorize(client *Client, name string, access Access) (bool, error) {
+	allowed, _, err := a.AuthorizeRule(client, name, access)
+	return allowed, err
+}
+
+// AuthorizeRule implements the RuleAuthorizer interface. The returned rule is
+// always nil if the authorizer does not implement RuleAuthorizer.
+func (a *CachedAuthorizer) AuthorizeRule(client *Client, name string, access Access) (bool, *ACLRule, error) {
+	// prepare key
+	key := authorizerCacheKey{client: client, topic: name, access: access}
+
+	// check cache
+	a.mutex.Lock()
+	entry, ok := a.entries[key]
+	generation := a.generation
+	a.mutex.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.allowed, entry.rule, nil
+	}
+
+	// authorize
+	allowed, rule, err := a.authorize(client, name, access)
+	if err != nil {
+		return false, nil, err
+	}
+
+	// acquire mutex
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// do not cache decision if invalidated meanwhile
+	if a.generation != generation {
+		return allowed, rule, nil
+	}
+
+	// remove expired entries
+	now := time.Now()
+	if now.Sub(a.swept) > a.TTL {
+		for key, entry := range a.entries {
+			if !now.Before(entry.expires) {
+				delete(a.entries, key)
+			}
+		}
+
+		a.swept = now
+	}
+
+	// cache decision
+	a.entries[key] = authorizerCacheEntry{
+		allowed: allowed,
+		rule:    rule,
+		user:    client.Username(),
+		expires: now.Add(a.TTL),
+	}
+
+	return allowed, rule, nil
+}
+
+// InvalidateClient will remove all cached decisions of the specified client.
+func (a *CachedAuthorizer) InvalidateClient(client *Client) {
+	a.invalidate(func(key authorizerCacheKey, _ authorizerCacheEntry) bool {
+		return key.client == client
+	})
+}
+
+// InvalidateUser will remove all cached decisions of clients that connected
+// with the specified username.
+func (a *CachedAuthorizer) InvalidateUser(user string) {
+	a.invalidate(func(_ authorizerCacheKey, entry authorizerCacheEntry) bool {
+		return entry.user == user
+	})
+}
+
+// InvalidateTopic will remove all cached decisions for topics and
+// subscriptions that overlap with the specified filter.
+func (a *CachedAuthorizer) InvalidateTopic(filter string) {
+	a.invalidate(func(key authorizerCacheKey, _ authorizerCacheEntry) bool {
+		return topic.Match(key.topic, filter) || topic.Match(filter, key.topic)
+	})
+}
+
+// InvalidateAll will remove all cached decisions.
+func (a *CachedAuthorizer) InvalidateAll() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.entries = make(map[authorizerCacheKey]authorizerCacheEntry)
+	a.generation++
+}
+
+// Len returns the number of cached decisions.
+func (a *CachedAuthorizer) Len() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return len(a.entries)
+}
+
+func (a *CachedAuthorizer) authorize(client *Client, name string, access Access) (bool, *ACLRule, error) {
+	// get rule if supported
+	if ra, ok := a.Authorizer.(RuleAuthorizer); ok {
+		return ra.AuthorizeRule(client, name, access)
+	}
+
+	// otherwise just authorize
+	allowed, err := a.Authorizer.Authorize(client, name, access)
+
+	return allowed, nil, err
+}
+
+func (a *CachedAuthorizer) invalidate(fn func(authorizerCacheKey, authorizerCacheEntry) bool) {
+	// acquire mutex
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// remove matching entries
+	for key, entry := range a.entries {
+		if fn(key, entry) {
+			delete(a.entries, key)
+		}
+	}
+
+	// increment generation
+	a.generation++
+}
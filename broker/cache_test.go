@@ -0,0 +1,130 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingAuthorizer struct {
+	calls   int
+	allowed bool
+	err     error
+}
+
+func (a *countingAuthorizer) Authorize(*Client, string, Access) (bool, error) {
+	a.calls++
+	return a.allowed, a.err
+}
+
+func TestCachedAuthorizer(t *testing.T) {
+	authorizer := &countingAuthorizer{allowed: true}
+	cache := NewCachedAuthorizer(authorizer, time.Minute)
+
+	alice := &Client{id: "dev1", user: "alice"}
+	bob := &Client{id: "dev2", user: "bob"}
+
+	for i := 0; i < 3; i++ {
+		ok, err := cache.Authorize(alice, "foo/bar", WriteAccess)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+	assert.Equal(t, 1, authorizer.calls)
+
+	_, _ = cache.Authorize(alice, "foo/bar", ReadAccess)
+	_, _ = cache.Authorize(alice, "foo/#", ReadAccess)
+	_, _ = cache.Authorize(bob, "foo/bar", WriteAccess)
+	_, _ = cache.Authorize(bob, "baz", WriteAccess)
+	assert.Equal(t, 5, authorizer.calls)
+	assert.Equal(t, 5, cache.Len())
+
+	authorizer.allowed = false
+
+	ok, err := cache.Authorize(alice, "foo/bar", WriteAccess)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	cache.InvalidateClient(alice)
+	assert.Equal(t, 2, cache.Len())
+
+	ok, err = cache.Authorize(alice, "foo/bar", WriteAccess)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 6, authorizer.calls)
+
+	cache.InvalidateUser("bob")
+	assert.Equal(t, 1, cache.Len())
+
+	_, _ = cache.Authorize(alice, "foo/#", ReadAccess)
+	_, _ = cache.Authorize(bob, "baz", WriteAccess)
+	assert.Equal(t, 3, cache.Len())
+
+	cache.InvalidateTopic("foo/bar")
+	assert.Equal(t, 1, cache.Len())
+
+	cache.InvalidateAll()
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestCachedAuthorizerExpiry(t *testing.T) {
+	authorizer := &countingAuthorizer{allowed: true}
+	cache := NewCachedAuthorizer(authorizer, 10*time.Millisecond)
+
+	client := &Client{id: "dev1"}
+
+	_, _ = cache.Authorize(client, "foo", WriteAccess)
+	_, _ = cache.Authorize(client, "foo", WriteAccess)
+	assert.Equal(t, 1, authorizer.calls)
+
+	time.Sleep(20 * time.Millisecond)
+
+	_, _ = cache.Authorize(client, "bar", WriteAccess)
+	assert.Equal(t, 1, cache.Len())
+
+	_, _ = cache.Authorize(client, "foo", WriteAccess)
+	assert.Equal(t, 3, authorizer.calls)
+}
+
+func TestCachedAuthorizerError(t *testing.T) {
+	authorizer := &countingAuthorizer{err: errors.New("failed")}
+	cache := NewCachedAuthorizer(authorizer, time.Minute)
+
+	client := &Client{id: "dev1"}
+
+	ok, err := cache.Authorize(client, "foo", WriteAccess)
+	assert.Error(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestCachedAuthorizerRule(t *testing.T) {
+	acl := NewACL()
+	acl.AddUserRule("alice", ACLRule{Access: ReadWriteAccess, Topic: "foo/#"})
+
+	cache := NewCachedAuthorizer(acl, time.Minute)
+
+	alice := &Client{id: "dev1", user: "alice"}
+
+	for i := 0; i < 2; i++ {
+		ok, rule, err := cache.AuthorizeRule(alice, "foo/bar", WriteAccess)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, &ACLRule{Access: ReadWriteAccess, Topic: "foo/#"}, rule)
+	}
+	assert.Equal(t, 1, cache.Len())
+
+	ok, rule, err := cache.AuthorizeRule(alice, "bar", WriteAccess)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, rule)
+
+	// rules are not available from plain authorizers
+	cache = NewCachedAuthorizer(&countingAuthorizer{allowed: true}, time.Minute)
+
+	ok, rule, err = cache.AuthorizeRule(alice, "foo", WriteAccess)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Nil(t, rule)
+}
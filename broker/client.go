@@ -1,10 +1,13 @@
 package broker
 
 import (
+	"crypto/tls"
 	"errors"
+	"math/rand"
 	"sync/atomic"
 	"time"
 
+	"github.com/256dpi/gomqtt/logging"
 	"github.com/256dpi/gomqtt/packet"
 	"github.com/256dpi/gomqtt/session"
 	"github.com/256dpi/gomqtt/transport"
@@ -52,6 +55,48 @@ const (
 	// ClientError is emitted when the client violates the protocol.
 	ClientError LogEvent = "client error"
 
+	// HandshakeTimeout is emitted when the client fails to send a Connect
+	// packet in time.
+	HandshakeTimeout LogEvent = "handshake timeout"
+
+	// HandshakeViolation is emitted when the client sends another packet
+	// than a Connect packet first.
+	HandshakeViolation LogEvent = "handshake violation"
+
+	// AccessDenied is emitted when the authorizer denies a subscription, a
+	// published message or the delivery of a message.
+	AccessDenied LogEvent = "access denied"
+
+	// QuotaExceeded is emitted when a message is dropped because the tenant of
+	// the client exceeded its quota.
+	QuotaExceeded LogEvent = "quota exceeded"
+
+	// LimitExceeded is emitted when a subscription is denied because the
+	// client reached its subscription limit or when a message is dropped
+	// because it would be queued for too many sessions.
+	LimitExceeded LogEvent = "limit exceeded"
+
+	// SessionTakenOver is emitted when an existing client is closed because
+	// another client connected with the same client id.
+	SessionTakenOver LogEvent = "session taken over"
+
+	// ClientBanned is emitted when a client is rejected because it has been
+	// banned for connecting too often.
+	ClientBanned LogEvent = "client banned"
+
+	// PacketTooLarge is emitted when a message is dropped because the publish
+	// packet would exceed the maximum packet size of the client.
+	PacketTooLarge LogEvent = "packet too large"
+
+	// SendQueueFull is emitted when a QOS 0 message is dropped because the
+	// send queue of the connection is full.
+	SendQueueFull LogEvent = "send queue full"
+
+	// SessionExpired is emitted by the backend when a stored session has been
+	// removed due to expiry. The client is nil as the session is offline,
+	// the error is an *ExpiredSession that carries the client id.
+	SessionExpired LogEvent = "session expired"
+
 	// LostConnection is emitted when the connection has been terminated.
 	LostConnection LogEvent = "lost connection"
 )
@@ -76,6 +121,17 @@ type Session interface {
 	AllPackets(session.Direction) ([]packet.Generic, error)
 }
 
+// A SubscriptionCounter may be implemented by a Session to report its
+// subscriptions. It is required to enforce Client.MaxSubscriptions.
+type SubscriptionCounter interface {
+	// CountSubscriptions should return the number of stored subscriptions.
+	CountSubscriptions() int
+
+	// HasSubscription should return whether a subscription with the specified
+	// filter is stored.
+	HasSubscription(filter string) bool
+}
+
 // Ack is executed by the Backend or Client to signal either that a message will
 // be delivered under the selected qos level and is therefore safe to be deleted
 // from either queue or the successful handling of subscriptions.
@@ -93,7 +149,8 @@ type Backend interface {
 	// supplied id or create and return a new one if it is missing or a clean
 	// session is requested. If the supplied id has a zero length, a new
 	// temporary session should be returned that is not stored further. The
-	// backend should also close any existing clients that use the same id.
+	// backend should also close any existing clients that use the same id or
+	// return ErrIdentifierRejected to reject the client.
 	//
 	// Note: In this call the Backend may also allocate other resources and
 	// setup the client for further usage as the broker will acknowledge the
@@ -170,9 +227,29 @@ type Backend interface {
 // ErrUnexpectedPacket is returned when an unexpected packet is received.
 var ErrUnexpectedPacket = errors.New("unexpected packet")
 
+// ErrExpectedConnect is returned when the first received packet is not a
+// Connect packet.
+var ErrExpectedConnect = errors.New("expected connect")
+
+// ErrHandshakeTimeout is returned if the client does not send a Connect packet
+// in time.
+var ErrHandshakeTimeout = errors.New("handshake timeout")
+
 // ErrNotAuthorized is returned when a client is not authorized.
 var ErrNotAuthorized = errors.New("not authorized")
 
+// ErrIdentifierRejected may be returned by a backend during setup to reject a
+// client with an IdentifierRejected return code.
+var ErrIdentifierRejected = errors.New("identifier rejected")
+
+// ErrClientBanned may be returned by a backend during setup to reject a
+// client with a ServerUnavailable return code because it has been banned.
+var ErrClientBanned = errors.New("client banned")
+
+// ErrUnacceptableVersion is returned when a client connects using a protocol
+// version that is not allowed on the listener.
+var ErrUnacceptableVersion = errors.New("unacceptable version")
+
 // ErrMissingSession is returned if the backend does not return a session.
 var ErrMissingSession = errors.New("missing session")
 
@@ -215,7 +292,8 @@ type Client struct {
 
 	// InflightMessages may be set during Setup to control the number of
 	// inflight messages from the broker to the client. This also defines how
-	// many outgoing packets are stored in the clients session.
+	// many outgoing packets are stored in the clients session. It should be
+	// set to the number of messages the client is willing to receive at once.
 	//
 	// Will default to 10.
 	InflightMessages int
@@ -227,6 +305,74 @@ type Client struct {
 	// Will default to 30 seconds.
 	TokenTimeout time.Duration
 
+	// SessionExpiry may be set during Setup to define how long the stored
+	// session of the client is kept after it disconnected. It corresponds to
+	// the session expiry interval of MQTT 5, which MQTT 3.1.1 clients cannot
+	// request themselves. Zero keeps the session forever.
+	//
+	// Will default to the session expiry of the backend.
+	SessionExpiry time.Duration
+
+	// MaxPacketSize may be set during Setup to limit the size of packets sent
+	// to the client. Messages that would result in larger publish packets are
+	// acknowledged and dropped instead of failing the connection. MQTT 3.1.1
+	// clients cannot announce the limit, so it must be configured out of band.
+	//
+	// Will default to no limit.
+	MaxPacketSize int64
+
+	// MaxSubscriptions may be set during Setup to limit the number of
+	// subscriptions of the client. Subscriptions exceeding the limit are
+	// acknowledged with a failure return code while replacing existing
+	// subscriptions is always allowed. The limit is only enforced if the
+	// session implements SubscriptionCounter.
+	//
+	// Will default to no limit.
+	MaxSubscriptions int
+
+	// Authorizer may be set during Setup to authorize subscriptions and
+	// published messages. Denied subscriptions are acknowledged with a failure
+	// return code and denied messages are acknowledged but dropped.
+	Authorizer Authorizer
+
+	// ReservedTopics may be set during Setup to protect topic namespaces that
+	// are used by the broker itself. Each rule lists the access that is still
+	// granted to clients for topics matching the filter. Requests exceeding
+	// the access are handled like requests denied by the Authorizer.
+	//
+	// Note: The rules apply to all clients regardless of the Authorizer, e.g. a
+	// read only rule for "$SYS/#" also prevents bridges and monitoring agents
+	// from publishing to that namespace.
+	ReservedTopics []ACLRule
+
+	// Auditor may be set during Setup to record authorization decisions. All
+	// denied requests are recorded, allowed requests only as configured by
+	// AuditAllows.
+	Auditor Auditor
+
+	// AuditAllows may be set during Setup to the fraction of allowed requests
+	// that are recorded by the Auditor, e.g. 0.01 to record one percent.
+	//
+	// Will default to 0 (no allowed requests).
+	AuditAllows float64
+
+	// SendQueueSize may be set during Setup to send QOS 0 messages using the
+	// send queue of the connection instead of writing them directly. This
+	// prevents slow clients from blocking the dequeuing of messages and
+	// therefore the publishers of the messages. QOS 0 messages that do not
+	// fit into the queue are dropped and may overtake other packets. The
+	// option is ignored if the connection is not a transport.BufferedConn.
+	//
+	// Will default to 0 (disabled).
+	SendQueueSize int
+
+	// FrameCache may be set during Setup to share the encoded publish packets
+	// of QOS 0 messages with other clients. Shared frames are passed to
+	// interceptors as *packet.Frame.
+	//
+	// Will default to no sharing.
+	FrameCache *FrameCache
+
 	// PacketCallback can be set to inspect packets before processing and
 	// apply rate limits. To guarantee the connection lifecycle, Connect and
 	// Disconnect packets are not provided to the callback.
@@ -235,11 +381,16 @@ type Client struct {
 	// Ref can be used by the backend to attach a custom object to the client.
 	Ref interface{}
 
-	state   uint32
-	backend Backend
-	conn    transport.Conn
+	state    uint32
+	backend  Backend
+	conn     transport.Conn
+	buffered transport.BufferedConn
+	logger   logging.Logger
+	versions []byte
 
 	id      string
+	user    string
+	tls     *tls.ConnectionState
 	will    *packet.Message
 	session Session
 
@@ -247,20 +398,28 @@ type Client struct {
 
 	publishTokens   chan struct{}
 	subscribeTokens chan struct{}
-	dequeueTokens   chan struct{}
+	dequeueQuota    *session.Quota
 
-	tomb tomb.Tomb
-	done chan struct{}
+	tomb      tomb.Tomb
+	handshake chan struct{}
+	done      chan struct{}
 }
 
 // NewClient takes over a connection and returns a Client.
 func NewClient(backend Backend, conn transport.Conn) *Client {
+	return newClient(backend, conn, nil, nil)
+}
+
+func newClient(backend Backend, conn transport.Conn, logger logging.Logger, versions []byte) *Client {
 	// create client
 	c := &Client{
-		state:   clientConnecting,
-		backend: backend,
-		conn:    conn,
-		done:    make(chan struct{}),
+		state:     clientConnecting,
+		backend:   backend,
+		conn:      conn,
+		logger:    logger,
+		versions:  versions,
+		handshake: make(chan struct{}),
+		done:      make(chan struct{}),
 	}
 
 	// start processor
@@ -289,6 +448,20 @@ func (c *Client) ID() string {
 	return c.id
 }
 
+// Username returns the username that has been supplied during connect.
+func (c *Client) Username() string {
+	return c.user
+}
+
+// TLS returns the state of the client's TLS connection. It includes the
+// negotiated version and cipher suite, the requested server name (SNI) and the
+// certificates presented by the client. It will return nil if the connection
+// is not encrypted. The state is available once the client sent its Connect
+// packet and may therefore be used by authenticators and authorizers.
+func (c *Client) TLS() *tls.ConnectionState {
+	return c.tls
+}
+
 // Conn returns the client's underlying connection. Calls to SetReadLimit,
 // LocalAddr and RemoteAddr are safe.
 func (c *Client) Conn() transport.Conn {
@@ -313,9 +486,24 @@ func (c *Client) Closed() <-chan struct{} {
 
 /* goroutines */
 
+// handshake deadline
+func (c *Client) awaitHandshake(timeout time.Duration) {
+	// prepare timer
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	// wait for handshake or deadline
+	select {
+	case <-c.handshake:
+	case <-c.tomb.Dying():
+	case <-timer.C:
+		_ = c.die(HandshakeTimeout, ErrHandshakeTimeout)
+	}
+}
+
 // main processor
 func (c *Client) processor() error {
-	c.backend.Log(NewConnection, c, nil, nil, nil)
+	c.log(NewConnection, nil, nil, nil)
 
 	// get first packet from connection
 	pkt, err := c.conn.Receive()
@@ -323,12 +511,12 @@ func (c *Client) processor() error {
 		return c.die(TransportError, err)
 	}
 
-	c.backend.Log(PacketReceived, c, pkt, nil, nil)
+	c.log(PacketReceived, pkt, nil, nil)
 
 	// get connect
 	connect, ok := pkt.(*packet.Connect)
 	if !ok {
-		return c.die(ClientError, ErrUnexpectedPacket)
+		return c.die(HandshakeViolation, ErrExpectedConnect)
 	}
 
 	// process connect
@@ -337,6 +525,9 @@ func (c *Client) processor() error {
 		return err // error has already been handled
 	}
 
+	// signal completed handshake
+	close(c.handshake)
+
 	// start dequeuer and acker
 	c.tomb.Go(c.dequeuer)
 	c.tomb.Go(c.acker)
@@ -353,7 +544,7 @@ func (c *Client) processor() error {
 			return c.die(TransportError, err)
 		}
 
-		c.backend.Log(PacketReceived, c, pkt, nil, nil)
+		c.log(PacketReceived, pkt, nil, nil)
 
 		// call callback
 		if c.PacketCallback != nil && pkt.Type() != packet.DISCONNECT {
@@ -374,19 +565,12 @@ func (c *Client) processor() error {
 // message dequeuer
 func (c *Client) dequeuer() error {
 	for {
-		// acquire dequeue token, try fast path first
-		select {
-		case <-c.dequeueTokens:
-			// continue
-		default:
-			select {
-			case <-c.dequeueTokens:
-				// continue
-			case <-time.After(c.TokenTimeout):
-				return c.die(ClientError, ErrTokenTimeout)
-			case <-c.tomb.Dying():
-				return tomb.ErrDying
-			}
+		// acquire dequeue token
+		err := c.dequeueQuota.Acquire(c.tomb.Dying(), c.TokenTimeout)
+		if err == session.ErrQuotaTimeout {
+			return c.die(ClientError, ErrTokenTimeout)
+		} else if err != nil {
+			return tomb.ErrDying
 		}
 
 		// request next message
@@ -397,12 +581,43 @@ func (c *Client) dequeuer() error {
 			return tomb.ErrDying
 		}
 
-		c.backend.Log(MessageDequeued, c, nil, msg, nil)
+		c.log(MessageDequeued, nil, msg, nil)
 
 		// prepare publish packet
 		publish := packet.NewPublish()
 		publish.Message = *msg
 
+		// drop message if the packet is too large
+		if c.MaxPacketSize > 0 && int64(publish.Len()) > c.MaxPacketSize {
+			if ack != nil {
+				ack()
+			}
+
+			c.log(PacketTooLarge, nil, msg, nil)
+
+			// put back dequeue token
+			c.dequeueQuota.Release()
+
+			continue
+		}
+
+		// authorize delivery as wildcard subscriptions may cover denied topics
+		ok, err := c.authorize(msg.Topic, ReadAccess)
+		if err != nil {
+			return c.die(BackendError, err)
+		} else if !ok {
+			if ack != nil {
+				ack()
+			}
+
+			c.log(AccessDenied, nil, msg, nil)
+
+			// put back dequeue token
+			c.dequeueQuota.Release()
+
+			continue
+		}
+
 		// set packet id
 		if publish.Message.QOS > 0 {
 			publish.ID = c.session.NextID()
@@ -420,25 +635,41 @@ func (c *Client) dequeuer() error {
 		if ack != nil {
 			ack()
 
-			c.backend.Log(MessageAcknowledged, c, nil, msg, nil)
+			c.log(MessageAcknowledged, nil, msg, nil)
 		}
 
-		// send packet
-		err = c.send(publish, true)
+		// queue qos 0 messages if enabled
+		if publish.Message.QOS == 0 && c.buffered != nil {
+			err = c.queue(msg, publish)
+			if err != nil {
+				return c.die(TransportError, err)
+			}
+
+			// put back dequeue token
+			c.dequeueQuota.Release()
+
+			continue
+		}
+
+		// send packet or shared frame
+		if c.FrameCache != nil {
+			err = c.conn.Send(c.FrameCache.Get(msg, publish), true)
+			if err == nil {
+				c.log(PacketSent, publish, nil, nil)
+			}
+		} else {
+			err = c.send(publish, true)
+		}
 		if err != nil {
 			return c.die(TransportError, err)
 		}
 
 		// immediately put back dequeue token for qos 0 messages
 		if publish.Message.QOS == 0 {
-			select {
-			case c.dequeueTokens <- struct{}{}:
-			default:
-				// continue if full for some reason
-			}
+			c.dequeueQuota.Release()
 		}
 
-		c.backend.Log(MessageForwarded, c, nil, msg, nil)
+		c.log(MessageForwarded, nil, msg, nil)
 	}
 }
 
@@ -486,8 +717,26 @@ func (c *Client) acker() error {
 
 // handle an incoming Connect packet
 func (c *Client) processConnect(pkt *packet.Connect) error {
-	// save id
+	// save id, username and tls state
 	c.id = pkt.ClientID
+	c.user = pkt.Username
+	c.tls = transport.TLSConnectionState(c.conn)
+
+	// check version
+	if !allowedVersion(c.versions, pkt.Version) {
+		// prepare connack
+		connack := packet.NewConnack()
+		connack.ReturnCode = packet.InvalidProtocolVersion
+
+		// send connack
+		err := c.send(connack, false)
+		if err != nil {
+			return c.die(TransportError, err)
+		}
+
+		// close client
+		return c.die(ClientError, ErrUnacceptableVersion)
+	}
 
 	// authenticate
 	ok, err := c.backend.Authenticate(c, pkt.Username, pkt.Password)
@@ -520,7 +769,31 @@ func (c *Client) processConnect(pkt *packet.Connect) error {
 
 	// retrieve session
 	s, resumed, err := c.backend.Setup(c, pkt.ClientID, pkt.CleanSession)
-	if err != nil {
+	if err == ErrIdentifierRejected {
+		// set return code
+		connack.ReturnCode = packet.IdentifierRejected
+
+		// send connack
+		err = c.send(connack, false)
+		if err != nil {
+			return c.die(TransportError, err)
+		}
+
+		// close client
+		return c.die(ClientError, ErrIdentifierRejected)
+	} else if err == ErrClientBanned {
+		// set return code
+		connack.ReturnCode = packet.ServerUnavailable
+
+		// send connack
+		err = c.send(connack, false)
+		if err != nil {
+			return c.die(TransportError, err)
+		}
+
+		// close client
+		return c.die(ClientBanned, ErrClientBanned)
+	} else if err != nil {
 		return c.die(BackendError, err)
 	} else if s == nil {
 		return c.die(BackendError, ErrMissingSession)
@@ -580,10 +853,15 @@ func (c *Client) processConnect(pkt *packet.Connect) error {
 		c.subscribeTokens <- struct{}{}
 	}
 
-	// prepare dequeue tokens
-	c.dequeueTokens = make(chan struct{}, c.InflightMessages)
-	for i := 0; i < c.InflightMessages; i++ {
-		c.dequeueTokens <- struct{}{}
+	// prepare dequeue quota
+	c.dequeueQuota = session.NewQuota(c.InflightMessages)
+
+	// set send queue size if supported
+	if c.SendQueueSize > 0 {
+		if bc, ok := transport.Buffered(c.conn); ok {
+			bc.SetSendQueueSize(c.SendQueueSize)
+			c.buffered = bc
+		}
 	}
 
 	// create ack queue
@@ -609,16 +887,12 @@ func (c *Client) processConnect(pkt *packet.Connect) error {
 	// resend stored packets
 	for _, pkt := range packets {
 		// consume a dequeue token (will be replaced once the flow is complete)
-		select {
-		case <-c.dequeueTokens:
-		default:
-			// continue if depleted
-		}
+		c.dequeueQuota.TryAcquire()
 
-		// set the dup flag on a publish packet
+		// mark publish packet as retransmission
 		publish, ok := pkt.(*packet.Publish)
 		if ok {
-			publish.Dup = true
+			publish.MarkRetransmission()
 		}
 
 		// send packet
@@ -707,18 +981,65 @@ func (c *Client) processSubscribe(pkt *packet.Subscribe) error {
 	suback.ReturnCodes = make([]packet.QOS, len(pkt.Subscriptions))
 	suback.ID = pkt.ID
 
+	// prepare granted subscriptions
+	subs := make([]packet.Subscription, 0, len(pkt.Subscriptions))
+
+	// get subscription counter if limited
+	var counter SubscriptionCounter
+	var count int
+	var added map[string]bool
+	if c.MaxSubscriptions > 0 {
+		counter, _ = c.session.(SubscriptionCounter)
+		if counter != nil {
+			count = counter.CountSubscriptions()
+			added = make(map[string]bool)
+		}
+	}
+
 	// set granted qos
 	for i, subscription := range pkt.Subscriptions {
+		// check authorization
+		ok, err := c.authorize(subscription.Topic, ReadAccess)
+		if err != nil {
+			return c.die(BackendError, err)
+		} else if !ok {
+			c.log(AccessDenied, pkt, nil, nil)
+			suback.ReturnCodes[i] = packet.QOSFailure
+			continue
+		}
+
+		// check subscription limit
+		if counter != nil && !added[subscription.Topic] && !counter.HasSubscription(subscription.Topic) {
+			if count >= c.MaxSubscriptions {
+				c.log(LimitExceeded, pkt, nil, nil)
+				suback.ReturnCodes[i] = packet.QOSFailure
+				continue
+			}
+
+			count++
+			added[subscription.Topic] = true
+		}
+
 		suback.ReturnCodes[i] = subscription.QOS
+		subs = append(subs, subscription)
 	}
 
-	// subscribe client to queue
-	err := c.backend.Subscribe(c, pkt.Subscriptions, func() {
+	// prepare ack
+	ack := func() {
 		select {
 		case c.ackQueue <- suback:
 		case <-c.tomb.Dying():
 		}
-	})
+	}
+
+	// immediately acknowledge if all subscriptions have been denied
+	if len(subs) == 0 {
+		ack()
+		return nil
+	}
+
+	// subscribe client to queue
+	err := c.backend.Subscribe(c, subs, ack)
 	if err != nil {
 		return c.die(BackendError, err)
 	}
@@ -763,6 +1084,14 @@ func (c *Client) processUnsubscribe(pkt *packet.Unsubscribe) error {
 
 // handle an incoming publish packet
 func (c *Client) processPublish(publish *packet.Publish) error {
+	// check authorization
+	ok, err := c.authorize(publish.Message.Topic, WriteAccess)
+	if err != nil {
+		return c.die(BackendError, err)
+	} else if !ok {
+		return c.dropPublish(publish)
+	}
+
 	// handle qos 0 flow
 	if publish.Message.QOS == 0 {
 		// publish message
@@ -771,24 +1100,15 @@ func (c *Client) processPublish(publish *packet.Publish) error {
 			return c.die(BackendError, err)
 		}
 
-		c.backend.Log(MessagePublished, c, nil, &publish.Message, nil)
+		c.log(MessagePublished, nil, &publish.Message, nil)
 
 		return nil
 	}
 
-	// acquire publish token, try fast path first
-	select {
-	case <-c.publishTokens:
-		// continue
-	default:
-		select {
-		case <-c.publishTokens:
-			// continue
-		case <-time.After(c.TokenTimeout):
-			return c.die(ClientError, ErrTokenTimeout)
-		case <-c.tomb.Dying():
-			return tomb.ErrDying
-		}
+	// acquire publish token
+	err = c.acquirePublishToken()
+	if err != nil {
+		return err
 	}
 
 	// handle qos 1 flow
@@ -799,7 +1119,7 @@ func (c *Client) processPublish(publish *packet.Publish) error {
 
 		// publish message and queue puback if ack is called
 		err := c.backend.Publish(c, &publish.Message, func() {
-			c.backend.Log(MessageAcknowledged, c, nil, &publish.Message, nil)
+			c.log(MessageAcknowledged, nil, &publish.Message, nil)
 
 			select {
 			case c.ackQueue <- puback:
@@ -810,7 +1130,7 @@ func (c *Client) processPublish(publish *packet.Publish) error {
 			return c.die(BackendError, err)
 		}
 
-		c.backend.Log(MessagePublished, c, nil, &publish.Message, nil)
+		c.log(MessagePublished, nil, &publish.Message, nil)
 	}
 
 	// handle qos 2 flow
@@ -835,6 +1155,60 @@ func (c *Client) processPublish(publish *packet.Publish) error {
 	return nil
 }
 
+// acknowledge and drop a denied publish packet
+func (c *Client) dropPublish(publish *packet.Publish) error {
+	c.log(AccessDenied, publish, &publish.Message, nil)
+
+	// handle qos 1 flow, the puback is queued to keep the order of
+	// acknowledgements and the acker puts back the publish token
+	if publish.Message.QOS == 1 {
+		err := c.acquirePublishToken()
+		if err != nil {
+			return err
+		}
+
+		puback := packet.NewPuback()
+		puback.ID = publish.ID
+
+		select {
+		case c.ackQueue <- puback:
+		case <-c.tomb.Dying():
+			return tomb.ErrDying
+		}
+	}
+
+	// handle qos 2 flow, the following pubrel is completed immediately as
+	// the packet has not been stored
+	if publish.Message.QOS == 2 {
+		pubrec := packet.NewPubrec()
+		pubrec.ID = publish.ID
+
+		err := c.send(pubrec, true)
+		if err != nil {
+			return c.die(TransportError, err)
+		}
+	}
+
+	return nil
+}
+
+// acquire a publish token, try fast path first
+func (c *Client) acquirePublishToken() error {
+	select {
+	case <-c.publishTokens:
+		return nil
+	default:
+		select {
+		case <-c.publishTokens:
+			return nil
+		case <-time.After(c.TokenTimeout):
+			return c.die(ClientError, ErrTokenTimeout)
+		case <-c.tomb.Dying():
+			return tomb.ErrDying
+		}
+	}
+}
+
 // handle an incoming p or pubcomp packet
 func (c *Client) processPubackAndPubcomp(id packet.ID) error {
 	// remove packet from store
@@ -844,11 +1218,7 @@ func (c *Client) processPubackAndPubcomp(id packet.ID) error {
 	}
 
 	// put back dequeue token
-	select {
-	case c.dequeueTokens <- struct{}{}:
-	default:
-		// continue if full for some reason
-	}
+	c.dequeueQuota.Release()
 
 	return nil
 }
@@ -900,7 +1270,7 @@ func (c *Client) processPubrel(id packet.ID) error {
 
 	// publish message and queue pubcomp if ack is called
 	err = c.backend.Publish(c, &publish.Message, func() {
-		c.backend.Log(MessageAcknowledged, c, nil, &publish.Message, nil)
+		c.log(MessageAcknowledged, nil, &publish.Message, nil)
 
 		select {
 		case c.ackQueue <- pubcomp:
@@ -911,7 +1281,7 @@ func (c *Client) processPubrel(id packet.ID) error {
 		return c.die(BackendError, err)
 	}
 
-	c.backend.Log(MessagePublished, c, nil, &publish.Message, nil)
+	c.log(MessagePublished, nil, &publish.Message, nil)
 
 	return nil
 }
@@ -930,7 +1300,7 @@ func (c *Client) processDisconnect() error {
 	// ensure tomb is killed
 	c.tomb.Kill(ErrClientDisconnected)
 
-	c.backend.Log(ClientDisconnected, c, nil, nil, nil)
+	c.log(ClientDisconnected, nil, nil, nil)
 
 	return ErrClientDisconnected
 }
@@ -945,17 +1315,130 @@ func (c *Client) send(pkt packet.Generic, async bool) error {
 		return err
 	}
 
-	c.backend.Log(PacketSent, c, pkt, nil, nil)
+	c.log(PacketSent, pkt, nil, nil)
 
 	return nil
 }
 
+// queue a qos 0 message or drop it if the send queue is full
+func (c *Client) queue(msg *packet.Message, publish *packet.Publish) error {
+	// get packet or shared frame
+	var pkt packet.Generic = publish
+	if c.FrameCache != nil {
+		pkt = c.FrameCache.Get(msg, publish)
+	}
+
+	// queue packet
+	err := c.buffered.BufferedSend(pkt)
+	if err == transport.ErrSendQueueFull {
+		c.log(SendQueueFull, nil, msg, nil)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	c.log(PacketSent, publish, nil, nil)
+	c.log(MessageForwarded, nil, msg, nil)
+
+	return nil
+}
+
+// check the authorization for a topic and record the decision
+func (c *Client) authorize(topic string, access Access) (bool, error) {
+	// get decision
+	ok, rule, err := c.decide(topic, access)
+	if err != nil {
+		return false, err
+	}
+
+	// record decision
+	if c.Auditor != nil && (!ok || (c.AuditAllows > 0 && rand.Float64() < c.AuditAllows)) {
+		c.Auditor.Audit(c.auditRecord(topic, access, ok, rule))
+	}
+
+	return ok, nil
+}
+
+// check the authorization for a topic and return the deciding rule if known
+func (c *Client) decide(topic string, access Access) (bool, *ACLRule, error) {
+	// check reserved topics
+	for _, rule := range c.ReservedTopics {
+		if rule.Access&access != access && aclMatch(rule.Topic, topic) {
+			rule := rule
+			return false, &rule, nil
+		}
+	}
+
+	// allow all if there is no authorizer
+	if c.Authorizer == nil {
+		return true, nil, nil
+	}
+
+	// get rule if supported
+	if ra, ok := c.Authorizer.(RuleAuthorizer); ok {
+		return ra.AuthorizeRule(c, topic, access)
+	}
+
+	// otherwise just authorize
+	ok, err := c.Authorizer.Authorize(c, topic, access)
+
+	return ok, nil, err
+}
+
 /* error handling and logging */
 
+// logs an event to the backend and the structured logger
+func (c *Client) log(event LogEvent, pkt packet.Generic, msg *packet.Message, err error) {
+	// log to backend
+	c.backend.Log(event, c, pkt, msg, err)
+
+	// check logger
+	if c.logger == nil {
+		return
+	}
+
+	// prepare fields
+	var fields []logging.Field
+	if addr := c.conn.RemoteAddr(); addr != nil {
+		fields = append(fields, logging.F("remote", addr.String()))
+	}
+
+	// add client id once connected
+	if atomic.LoadUint32(&c.state) >= clientConnected {
+		fields = append(fields, logging.F("client", c.id))
+	}
+
+	// add tls version once connected
+	if c.tls != nil && atomic.LoadUint32(&c.state) >= clientConnected {
+		fields = append(fields, logging.F("tls", tlsVersion(c.tls.Version)))
+	}
+
+	// add packet, message and error
+	if pkt != nil {
+		fields = append(fields, logging.F("packet", pkt.Type().String()))
+	}
+	if msg != nil {
+		fields = append(fields, logging.F("topic", msg.Topic), logging.F("qos", int(msg.QOS)))
+	}
+	if err != nil {
+		fields = append(fields, logging.F("error", err))
+	}
+
+	// get level
+	level := logging.Info
+	if err != nil {
+		level = logging.Error
+	} else if pkt != nil || msg != nil {
+		level = logging.Debug
+	}
+
+	c.logger.Log(level, string(event), fields...)
+}
+
 // used for closing and cleaning up from internal goroutines
 func (c *Client) die(event LogEvent, err error) error {
 	// log error
-	c.backend.Log(event, c, nil, nil, err)
+	c.log(event, nil, nil, err)
 
 	// close connection
 	_ = c.conn.Close()
@@ -970,22 +1453,46 @@ func (c *Client) die(event LogEvent, err error) error {
 func (c *Client) cleanup() {
 	// check if not cleanly connected and will is present
 	if atomic.LoadUint32(&c.state) == clientConnected && c.will != nil {
-		// publish message
-		err := c.backend.Publish(c, c.will, nil)
+		// check authorization
+		ok, err := c.authorize(c.will.Topic, WriteAccess)
 		if err != nil {
-			c.backend.Log(BackendError, c, nil, nil, err)
-		}
+			c.log(BackendError, nil, nil, err)
+		} else if !ok {
+			c.log(AccessDenied, nil, c.will, nil)
+		} else {
+			// publish message
+			err = c.backend.Publish(c, c.will, nil)
+			if err != nil {
+				c.log(BackendError, nil, nil, err)
+			}
 
-		c.backend.Log(MessagePublished, c, nil, c.will, nil)
+			c.log(MessagePublished, nil, c.will, nil)
+		}
 	}
 
 	// remove client from the queue
 	if atomic.LoadUint32(&c.state) >= clientConnected {
 		err := c.backend.Terminate(c)
 		if err != nil {
-			c.backend.Log(BackendError, c, nil, nil, err)
+			c.log(BackendError, nil, nil, err)
 		}
 	}
 
-	c.backend.Log(LostConnection, c, nil, nil, nil)
+	c.log(LostConnection, nil, nil, nil)
+}
+
+// returns a readable name for the tls version
+func tlsVersion(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "1.0"
+	case tls.VersionTLS11:
+		return "1.1"
+	case tls.VersionTLS12:
+		return "1.2"
+	case tls.VersionTLS13:
+		return "1.3"
+	default:
+		return "unknown"
+	}
 }
@@ -1,6 +1,9 @@
 package broker
 
 import (
+	"crypto/tls"
+	"net"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -10,6 +13,7 @@ import (
 	"github.com/256dpi/gomqtt/transport/flow"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type testMemoryBackend struct {
@@ -176,3 +180,288 @@ func TestClientTokenTimeoutDequeue(t *testing.T) {
 
 	safeReceive(done)
 }
+
+func TestClientAuthorizer(t *testing.T) {
+	acl := NewACL()
+	acl.AddAnonymousRule(ACLRule{Access: ReadWriteAccess, Topic: "allowed/#"})
+
+	backend := &testMemoryBackend{
+		MemoryBackend: *NewMemoryBackend(),
+	}
+
+	backend.MemoryBackend.ClientAuthorizer = acl
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	f := flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(&packet.Subscribe{Subscriptions: []packet.Subscription{
+			{Topic: "allowed/+", QOS: 1},
+			{Topic: "denied/+", QOS: 1},
+		}, ID: 1}).
+		Receive(&packet.Suback{ID: 1, ReturnCodes: []packet.QOS{1, packet.QOSFailure}}).
+		Send(&packet.Subscribe{Subscriptions: []packet.Subscription{{Topic: "#", QOS: 1}}, ID: 2}).
+		Receive(&packet.Suback{ID: 2, ReturnCodes: []packet.QOS{packet.QOSFailure}}).
+		Send(&packet.Publish{Message: packet.Message{Topic: "denied/a", QOS: 1}, ID: 3}).
+		Receive(&packet.Puback{ID: 3}).
+		Send(&packet.Publish{Message: packet.Message{Topic: "allowed/a", QOS: 1}, ID: 4}).
+		Receive(&packet.Puback{ID: 4}, &packet.Publish{Message: packet.Message{Topic: "allowed/a", QOS: 1}, ID: 1}).
+		Send(&packet.Puback{ID: 1}).
+		Send(&packet.Publish{Message: packet.Message{Topic: "denied/a", QOS: 2}, ID: 5}).
+		Receive(&packet.Pubrec{ID: 5}).
+		Send(&packet.Pubrel{ID: 5}).
+		Receive(&packet.Pubcomp{ID: 5}).
+		Send(&packet.Publish{Message: packet.Message{Topic: "allowed/a/b", QOS: 1}, ID: 6}).
+		Send(&packet.Publish{Message: packet.Message{Topic: "denied/a", QOS: 1}, ID: 7}).
+		Receive(&packet.Puback{ID: 6}).
+		Receive(&packet.Puback{ID: 7}).
+		Send(packet.NewDisconnect()).
+		End()
+
+	err = f.Test(conn)
+	assert.NoError(t, err)
+
+	ret := backend.Close(5 * time.Second)
+	assert.True(t, ret)
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestClientReservedTopics(t *testing.T) {
+	backend := &testMemoryBackend{
+		MemoryBackend: *NewMemoryBackend(),
+	}
+
+	assert.Empty(t, backend.MemoryBackend.ClientReservedTopics)
+
+	backend.MemoryBackend.ClientReservedTopics = []ACLRule{
+		{Access: ReadAccess, Topic: "$SYS/#"},
+		{Access: NoAccess, Topic: "internal/#"},
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	f := flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(&packet.Subscribe{Subscriptions: []packet.Subscription{
+			{Topic: "$SYS/#", QOS: 0},
+			{Topic: "internal/+", QOS: 0},
+			{Topic: "public", QOS: 0},
+		}, ID: 1}).
+		Receive(&packet.Suback{ID: 1, ReturnCodes: []packet.QOS{0, packet.QOSFailure, 0}}).
+		Send(&packet.Publish{Message: packet.Message{Topic: "$SYS/broker/uptime", QOS: 1}, ID: 2}).
+		Receive(&packet.Puback{ID: 2}).
+		Send(&packet.Publish{Message: packet.Message{Topic: "public"}}).
+		Receive(&packet.Publish{Message: packet.Message{Topic: "public"}}).
+		Send(packet.NewDisconnect()).
+		End()
+
+	err = f.Test(conn)
+	assert.NoError(t, err)
+
+	ret := backend.Close(5 * time.Second)
+	assert.True(t, ret)
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestClientMaxPacketSize(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.ClientMaxPacketSize = 32
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	f := flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(&packet.Subscribe{Subscriptions: []packet.Subscription{
+			{Topic: "test", QOS: 1},
+		}, ID: 1}).
+		Receive(&packet.Suback{ID: 1, ReturnCodes: []packet.QOS{1}}).
+		Send(&packet.Publish{Message: packet.Message{Topic: "test", Payload: make([]byte, 64)}}).
+		Send(&packet.Publish{Message: packet.Message{Topic: "test", Payload: []byte("small")}}).
+		Receive(&packet.Publish{Message: packet.Message{Topic: "test", Payload: []byte("small")}}).
+		Send(packet.NewDisconnect()).
+		End()
+
+	err = f.Test(conn)
+	assert.NoError(t, err)
+
+	ret := backend.Close(5 * time.Second)
+	assert.True(t, ret)
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestClientSendQueue(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.ClientSendQueueSize = 10
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	f := flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(&packet.Subscribe{Subscriptions: []packet.Subscription{
+			{Topic: "test", QOS: 0},
+		}, ID: 1}).
+		Receive(&packet.Suback{ID: 1, ReturnCodes: []packet.QOS{0}}).
+		Send(&packet.Publish{Message: packet.Message{Topic: "test", Payload: []byte("1")}}).
+		Send(&packet.Publish{Message: packet.Message{Topic: "test", Payload: []byte("2")}}).
+		Receive(&packet.Publish{Message: packet.Message{Topic: "test", Payload: []byte("1")}}).
+		Receive(&packet.Publish{Message: packet.Message{Topic: "test", Payload: []byte("2")}}).
+		Send(packet.NewDisconnect()).
+		End()
+
+	err = f.Test(conn)
+	assert.NoError(t, err)
+
+	ret := backend.Close(5 * time.Second)
+	assert.True(t, ret)
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+type tlsMemoryBackend struct {
+	MemoryBackend
+
+	states chan *tls.ConnectionState
+}
+
+func (b *tlsMemoryBackend) Authenticate(client *Client, user, password string) (bool, error) {
+	b.states <- client.TLS()
+	return b.MemoryBackend.Authenticate(client, user, password)
+}
+
+func TestClientTLS(t *testing.T) {
+	crt, err := tls.LoadX509KeyPair(filepath.Join("..", "example.crt"), filepath.Join("..", "example.key"))
+	require.NoError(t, err)
+
+	backend := &tlsMemoryBackend{
+		MemoryBackend: *NewMemoryBackend(),
+		states:        make(chan *tls.ConnectionState, 2),
+	}
+
+	engine := NewEngine(backend)
+
+	launcher := transport.NewLauncher()
+	launcher.TLSConfig = &tls.Config{Certificates: []tls.Certificate{crt}}
+
+	tlsServer, err := launcher.Launch("tls://localhost:0")
+	require.NoError(t, err)
+
+	tcpServer, err := launcher.Launch("tcp://localhost:0")
+	require.NoError(t, err)
+
+	engine.Accept(tlsServer)
+	engine.Accept(tcpServer)
+
+	f := flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(packet.NewDisconnect()).
+		End()
+
+	dialer := transport.NewDialer()
+	dialer.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+
+	_, port, _ := net.SplitHostPort(tlsServer.Addr().String())
+
+	conn, err := dialer.Dial("tls://localhost:" + port)
+	require.NoError(t, err)
+
+	err = f.Test(conn)
+	assert.NoError(t, err)
+
+	state := <-backend.states
+	if assert.NotNil(t, state) {
+		assert.True(t, state.Version >= tls.VersionTLS12)
+		assert.NotZero(t, state.CipherSuite)
+		assert.Equal(t, "localhost", state.ServerName)
+		assert.Empty(t, state.PeerCertificates)
+	}
+
+	_, port, _ = net.SplitHostPort(tcpServer.Addr().String())
+
+	conn, err = dialer.Dial("tcp://localhost:" + port)
+	require.NoError(t, err)
+
+	err = f.Test(conn)
+	assert.NoError(t, err)
+
+	assert.Nil(t, <-backend.states)
+
+	_ = tlsServer.Close()
+	_ = tcpServer.Close()
+
+	engine.Close()
+
+	ret := backend.Close(5 * time.Second)
+	assert.True(t, ret)
+}
+
+func TestClientMaxSubscriptions(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.ClientMaxSubscriptions = 2
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	f := flow.New().
+		Send(packet.NewConnect()).
+		Receive(packet.NewConnack()).
+		Send(&packet.Subscribe{Subscriptions: []packet.Subscription{
+			{Topic: "a", QOS: 1},
+			{Topic: "b", QOS: 1},
+			{Topic: "c", QOS: 1},
+		}, ID: 1}).
+		Receive(&packet.Suback{ID: 1, ReturnCodes: []packet.QOS{1, 1, packet.QOSFailure}}).
+		Send(&packet.Subscribe{Subscriptions: []packet.Subscription{
+			{Topic: "a", QOS: 0},
+			{Topic: "d", QOS: 0},
+		}, ID: 2}).
+		Receive(&packet.Suback{ID: 2, ReturnCodes: []packet.QOS{0, packet.QOSFailure}}).
+		Send(&packet.Unsubscribe{Topics: []string{"b"}, ID: 3}).
+		Receive(&packet.Unsuback{ID: 3}).
+		Send(&packet.Subscribe{Subscriptions: []packet.Subscription{
+			{Topic: "d", QOS: 0},
+			{Topic: "d", QOS: 1},
+		}, ID: 4}).
+		Receive(&packet.Suback{ID: 4, ReturnCodes: []packet.QOS{0, 1}}).
+		Send(packet.NewDisconnect()).
+		End()
+
+	err = f.Test(conn)
+	assert.NoError(t, err)
+
+	ret := backend.Close(5 * time.Second)
+	assert.True(t, ret)
+
+	close(quit)
+
+	safeReceive(done)
+}
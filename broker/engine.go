@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/256dpi/gomqtt/logging"
 	"github.com/256dpi/gomqtt/transport"
 
 	"gopkg.in/tomb.v2"
@@ -16,18 +17,54 @@ type Engine struct {
 	// The Backend that will be passed to accepted clients.
 	Backend Backend
 
-	// ConnectTimeout defines the timeout to receive the first packet.
+	// ConnectTimeout defines the timeout to receive the first packet as well
+	// as the deadline to complete the handshake. Clients that fail to send
+	// their Connect packet in time are closed.
 	ConnectTimeout time.Duration
 
 	// The DefaultReadLimit defines the initial read limit.
 	DefaultReadLimit int64
 
+	// WriteTimeout defines the maximum time that writing a packet to a client
+	// may take. Clients that stop reading are closed once the timeout is
+	// exceeded. A value of zero disables the timeout.
+	WriteTimeout time.Duration
+
+	// ReadBufferSize and WriteBufferSize define the size of the buffers that
+	// are allocated for every connection. Smaller buffers reduce the memory
+	// usage of brokers that serve many mostly idle clients.
+	//
+	// Will default to 4096 bytes.
+	ReadBufferSize  int
+	WriteBufferSize int
+
+	// EventLogger can be set to receive structured packet level and lifecycle
+	// events of all handled clients in addition to the backend.
+	EventLogger logging.Logger
+
+	// Interceptors are installed on all handled connections and called with
+	// every sent and received packet.
+	Interceptors []transport.Interceptor
+
+	// Sharder may be set to partition clients between multiple brokers. The
+	// connections of clients whose id is mapped to another shard than the
+	// LocalShard are forwarded to the owning shard using the ShardDialer.
+	// Clients without an id are always handled locally.
+	//
+	// Note: Only connections are forwarded. Messages published on one shard
+	// are not delivered to subscribers connected to another shard unless the
+	// shards are linked otherwise e.g. using a Bridge.
+	Sharder     Sharder
+	LocalShard  string
+	ShardDialer func(shard string) (transport.Conn, error)
+
 	// OnError can be used to receive errors from engine. If an error is received
 	// the server should be restarted.
 	OnError func(error)
 
-	mutex sync.Mutex
-	tomb  tomb.Tomb
+	mutex  sync.Mutex
+	tomb   tomb.Tomb
+	routes sync.WaitGroup
 }
 
 // NewEngine returns a new Engine.
@@ -40,6 +77,19 @@ func NewEngine(backend Backend) *Engine {
 
 // Accept begins accepting connections from the passed server.
 func (e *Engine) Accept(server transport.Server) {
+	e.accept(server, nil)
+}
+
+// AcceptVersions begins accepting connections from the passed server like
+// Accept but only allows clients that connect using one of the specified
+// protocol versions (e.g. packet.Version311). Other clients are rejected with
+// an InvalidProtocolVersion return code. This allows legacy clients to be
+// confined to a separate internal listener.
+func (e *Engine) AcceptVersions(server transport.Server, versions ...byte) {
+	e.accept(server, versions)
+}
+
+func (e *Engine) accept(server transport.Server, versions []byte) {
 	e.tomb.Go(func() error {
 		for {
 			// return if dying
@@ -59,7 +109,7 @@ func (e *Engine) Accept(server transport.Server) {
 			}
 
 			// handle connection
-			if !e.Handle(conn) {
+			if !e.admit(conn, versions) {
 				return nil
 			}
 		}
@@ -69,6 +119,11 @@ func (e *Engine) Accept(server transport.Server) {
 // Handle takes over responsibility and handles a transport.Conn. It returns
 // false if the engine is closing and the connection has been closed.
 func (e *Engine) Handle(conn transport.Conn) bool {
+	return e.admit(conn, nil)
+}
+
+// admit prepares and handles the connection, a nil list allows all versions
+func (e *Engine) admit(conn transport.Conn, versions []byte) bool {
 	// check conn
 	if conn == nil {
 		panic("passed conn is nil")
@@ -84,30 +139,92 @@ func (e *Engine) Handle(conn transport.Conn) bool {
 		return false
 	}
 
+	// install interceptors
+	conn = transport.Intercept(conn, e.Interceptors...)
+
 	// set default read limit
 	conn.SetReadLimit(e.DefaultReadLimit)
 
 	// set initial read timeout
 	conn.SetReadTimeout(e.ConnectTimeout)
 
+	// tune buffered connections
+	if bc, ok := transport.Buffered(conn); ok {
+		// set write timeout
+		if e.WriteTimeout > 0 {
+			bc.SetWriteTimeout(e.WriteTimeout)
+		}
+
+		// set buffer sizes
+		if e.ReadBufferSize > 0 || e.WriteBufferSize > 0 {
+			bc.SetBufferSizes(e.ReadBufferSize, e.WriteBufferSize)
+		}
+	}
+
+	// route connection if sharding is enabled
+	if e.Sharder != nil {
+		e.routes.Add(1)
+		go func() {
+			defer e.routes.Done()
+			e.route(conn, versions)
+		}()
+
+		return true
+	}
+
 	// handle client
-	NewClient(e.Backend, conn)
+	e.handle(conn, versions)
 
 	return true
 }
 
+// handle creates a client for the prepared connection
+func (e *Engine) handle(conn transport.Conn, versions []byte) {
+	// create client
+	client := newClient(e.Backend, conn, e.EventLogger, versions)
+
+	// enforce handshake deadline
+	if e.ConnectTimeout > 0 {
+		go client.awaitHandshake(e.ConnectTimeout)
+	}
+}
+
+// allowedVersion checks if the version is in the list, an empty list allows
+// all versions
+func allowedVersion(versions []byte, version byte) bool {
+	// check list
+	if len(versions) == 0 {
+		return true
+	}
+
+	// find version
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Close will stop handling incoming connections and close all acceptors. The
-// call will block until all acceptors returned.
+// call will block until all acceptors returned. Connections that are being
+// routed or forwarded to another shard are closed.
 //
 // Note: All passed servers to Accept must be closed before calling this method.
 func (e *Engine) Close() {
 	// acquire mutex
 	e.mutex.Lock()
-	defer e.mutex.Unlock()
 
 	// stop acceptors
 	e.tomb.Kill(nil)
 	_ = e.tomb.Wait()
+
+	// release mutex
+	e.mutex.Unlock()
+
+	// wait for routed connections
+	e.routes.Wait()
 }
 
 // Run runs the passed engine on a random available port and returns a channel
@@ -1,10 +1,12 @@
 package broker
 
 import (
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/logging"
 	"github.com/256dpi/gomqtt/packet"
 	"github.com/256dpi/gomqtt/transport"
 
@@ -28,6 +30,140 @@ func TestConnectTimeout(t *testing.T) {
 	safeReceive(done)
 }
 
+type slowBackend struct {
+	*MemoryBackend
+
+	delay time.Duration
+}
+
+func (b *slowBackend) Authenticate(client *Client, user, password string) (bool, error) {
+	time.Sleep(b.delay)
+	return b.MemoryBackend.Authenticate(client, user, password)
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	events := make(chan LogEvent, 10)
+
+	backend := NewMemoryBackend()
+	backend.Logger = func(event LogEvent, _ *Client, _ packet.Generic, _ *packet.Message, _ error) {
+		events <- event
+	}
+
+	engine := NewEngine(&slowBackend{MemoryBackend: backend, delay: 100 * time.Millisecond})
+	engine.ConnectTimeout = 50 * time.Millisecond
+
+	port, quit, done := Run(engine, "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	err = conn.Send(packet.NewConnect(), false)
+	assert.NoError(t, err)
+
+	pkt, err := conn.Receive()
+	assert.Nil(t, pkt)
+	assert.Error(t, err)
+
+	assert.Equal(t, NewConnection, <-events)
+	assert.Equal(t, PacketReceived, <-events)
+	assert.Equal(t, HandshakeTimeout, <-events)
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestHandshakeViolation(t *testing.T) {
+	events := make(chan LogEvent, 10)
+
+	backend := NewMemoryBackend()
+	backend.Logger = func(event LogEvent, _ *Client, _ packet.Generic, _ *packet.Message, _ error) {
+		events <- event
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	conn, err := transport.Dial("tcp://localhost:" + port)
+	assert.NoError(t, err)
+
+	err = conn.Send(packet.NewPingreq(), false)
+	assert.NoError(t, err)
+
+	pkt, err := conn.Receive()
+	assert.Nil(t, pkt)
+	assert.Error(t, err)
+
+	assert.Equal(t, NewConnection, <-events)
+	assert.Equal(t, PacketReceived, <-events)
+	assert.Equal(t, HandshakeViolation, <-events)
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestEngineEventLogger(t *testing.T) {
+	events := make(chan string, 10)
+
+	engine := NewEngine(NewMemoryBackend())
+	engine.EventLogger = logging.LoggerFunc(func(level logging.Level, event string, fields ...logging.Field) {
+		if level != logging.Debug {
+			events <- event
+		}
+	})
+
+	port, quit, done := Run(engine, "tcp")
+
+	c := client.New()
+
+	cf, err := c.Connect(client.NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	assert.NoError(t, c.Disconnect())
+
+	assert.Equal(t, string(NewConnection), <-events)
+	assert.Equal(t, string(ClientDisconnected), <-events)
+	assert.Equal(t, string(LostConnection), <-events)
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestEngineInterceptors(t *testing.T) {
+	engine := NewEngine(NewMemoryBackend())
+	engine.Interceptors = []transport.Interceptor{{
+		Incoming: func(pkt packet.Generic) (packet.Generic, error) {
+			if pkt.Type() == packet.SUBSCRIBE {
+				return nil, errors.New("not allowed")
+			}
+
+			return pkt, nil
+		},
+	}}
+
+	port, quit, done := Run(engine, "tcp")
+
+	c := client.New()
+	wait := make(chan struct{})
+
+	c.Callback = func(msg *packet.Message, err error) error {
+		assert.Error(t, err)
+		close(wait)
+		return nil
+	}
+
+	cf, err := c.Connect(client.NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	sf, err := c.Subscribe("test", 0)
+	assert.NoError(t, err)
+	assert.Error(t, sf.Wait(10*time.Second))
+
+	safeReceive(wait)
+	close(quit)
+	safeReceive(done)
+}
+
 func TestDefaultReadLimit(t *testing.T) {
 	engine := NewEngine(NewMemoryBackend())
 	engine.DefaultReadLimit = 1
@@ -51,3 +187,84 @@ func TestDefaultReadLimit(t *testing.T) {
 	close(quit)
 	safeReceive(done)
 }
+
+func TestEngineBufferSizes(t *testing.T) {
+	engine := NewEngine(NewMemoryBackend())
+	engine.WriteTimeout = time.Second
+	engine.ReadBufferSize = 16
+	engine.WriteBufferSize = 16
+
+	port, quit, done := Run(engine, "tcp")
+
+	c := client.New()
+	wait := make(chan struct{})
+
+	c.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		assert.Equal(t, "test", msg.Topic)
+		assert.Len(t, msg.Payload, 1024)
+		close(wait)
+		return nil
+	}
+
+	cf, err := c.Connect(client.NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	sf, err := c.Subscribe("test", 0)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(10*time.Second))
+
+	pf, err := c.Publish("test", make([]byte, 1024), 0, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(10*time.Second))
+
+	safeReceive(wait)
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestEngineAcceptVersions(t *testing.T) {
+	engine := NewEngine(NewMemoryBackend())
+
+	server1, err := transport.Launch("tcp://localhost:0")
+	assert.NoError(t, err)
+
+	server2, err := transport.Launch("tcp://localhost:0")
+	assert.NoError(t, err)
+
+	engine.Accept(server1)
+	engine.AcceptVersions(server2, packet.Version311)
+
+	connect := func(server transport.Server, version byte) packet.ConnackCode {
+		conn, err := transport.Dial("tcp://" + server.Addr().String())
+		assert.NoError(t, err)
+
+		pkt := packet.NewConnect()
+		pkt.Version = version
+
+		err = conn.Send(pkt, false)
+		assert.NoError(t, err)
+
+		res, err := conn.Receive()
+		assert.NoError(t, err)
+
+		err = conn.Close()
+		assert.NoError(t, err)
+
+		return res.(*packet.Connack).ReturnCode
+	}
+
+	assert.Equal(t, packet.ConnectionAccepted, connect(server1, packet.Version31))
+	assert.Equal(t, packet.ConnectionAccepted, connect(server1, packet.Version311))
+	assert.Equal(t, packet.InvalidProtocolVersion, connect(server2, packet.Version31))
+	assert.Equal(t, packet.ConnectionAccepted, connect(server2, packet.Version311))
+
+	_ = server1.Close()
+	_ = server2.Close()
+	engine.Close()
+}
@@ -0,0 +1,139 @@
+package broker
+
+import (
+	"sync"
+	"time"
+)
+
+// A FlappingPolicy defines when clients that rapidly connect and disconnect
+// are banned.
+type FlappingPolicy struct {
+	// The number of connections a client may open within the window.
+	Threshold int
+
+	// The window in which connections are counted.
+	//
+	// Will default to 1 minute.
+	Window time.Duration
+
+	// The duration of the first ban. The duration is doubled for every
+	// repeated ban and reset once the client has not been banned for the
+	// maximum ban duration.
+	//
+	// Will default to 1 minute.
+	Ban time.Duration
+
+	// The maximum duration of a ban.
+	//
+	// Will default to 1 hour.
+	MaxBan time.Duration
+}
+
+type flappingRecord struct {
+	connects []time.Time
+	bans     int
+	until    time.Time
+}
+
+type flappingDetector struct {
+	records map[string]*flappingRecord
+	mutex   sync.Mutex
+}
+
+func newFlappingDetector() *flappingDetector {
+	return &flappingDetector{
+		records: make(map[string]*flappingRecord),
+	}
+}
+
+func (d *flappingDetector) connect(policy FlappingPolicy, id string, now time.Time) bool {
+	// apply defaults
+	policy = policy.withDefaults()
+
+	// acquire mutex
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// get record
+	record, ok := d.records[id]
+	if !ok {
+		record = &flappingRecord{}
+		d.records[id] = record
+	}
+
+	// check ban
+	if now.Before(record.until) {
+		return false
+	}
+
+	// forgive previous bans
+	if record.bans > 0 && now.Sub(record.until) > policy.MaxBan {
+		record.bans = 0
+	}
+
+	// remove connects outside of window
+	for len(record.connects) > 0 && now.Sub(record.connects[0]) > policy.Window {
+		record.connects = record.connects[1:]
+	}
+
+	// add connect
+	record.connects = append(record.connects, now)
+
+	// check threshold
+	if len(record.connects) <= policy.Threshold {
+		return true
+	}
+
+	// compute ban
+	ban := policy.Ban
+	for i := 0; i < record.bans && ban < policy.MaxBan; i++ {
+		ban *= 2
+	}
+	if ban > policy.MaxBan {
+		ban = policy.MaxBan
+	}
+
+	// ban client
+	record.connects = nil
+	record.bans++
+	record.until = now.Add(ban)
+
+	return false
+}
+
+func (d *flappingDetector) sweep(policy FlappingPolicy, now time.Time) {
+	// apply defaults
+	policy = policy.withDefaults()
+
+	// acquire mutex
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// remove records that no longer affect future connections
+	for id, record := range d.records {
+		idle := len(record.connects) == 0 || now.Sub(record.connects[len(record.connects)-1]) > policy.Window
+		forgiven := record.bans == 0 || now.Sub(record.until) > policy.MaxBan
+		if idle && forgiven {
+			delete(d.records, id)
+		}
+	}
+}
+
+func (p FlappingPolicy) withDefaults() FlappingPolicy {
+	// set default window
+	if p.Window <= 0 {
+		p.Window = time.Minute
+	}
+
+	// set default ban
+	if p.Ban <= 0 {
+		p.Ban = time.Minute
+	}
+
+	// set default max ban
+	if p.MaxBan <= 0 {
+		p.MaxBan = time.Hour
+	}
+
+	return p
+}
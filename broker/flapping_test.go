@@ -0,0 +1,109 @@
+package broker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlappingDetector(t *testing.T) {
+	policy := FlappingPolicy{
+		Threshold: 2,
+		Window:    time.Second,
+		Ban:       time.Second,
+		MaxBan:    3 * time.Second,
+	}
+
+	detector := newFlappingDetector()
+	now := time.Now()
+
+	// first ban
+	assert.True(t, detector.connect(policy, "foo", now))
+	assert.True(t, detector.connect(policy, "foo", now))
+	assert.False(t, detector.connect(policy, "foo", now))
+	assert.False(t, detector.connect(policy, "foo", now.Add(999*time.Millisecond)))
+	assert.True(t, detector.connect(policy, "bar", now))
+
+	// second ban is doubled
+	now = now.Add(time.Second)
+	assert.True(t, detector.connect(policy, "foo", now))
+	assert.True(t, detector.connect(policy, "foo", now))
+	assert.False(t, detector.connect(policy, "foo", now))
+	assert.False(t, detector.connect(policy, "foo", now.Add(1999*time.Millisecond)))
+
+	// third ban is limited
+	now = now.Add(2 * time.Second)
+	assert.True(t, detector.connect(policy, "foo", now))
+	assert.True(t, detector.connect(policy, "foo", now))
+	assert.False(t, detector.connect(policy, "foo", now))
+	assert.False(t, detector.connect(policy, "foo", now.Add(2999*time.Millisecond)))
+	assert.True(t, detector.connect(policy, "foo", now.Add(3*time.Second)))
+
+	// connects outside of window are not counted
+	assert.True(t, detector.connect(policy, "bar", now))
+	assert.True(t, detector.connect(policy, "bar", now.Add(2*time.Second)))
+
+	// records are swept once idle and forgiven
+	detector.sweep(policy, now.Add(5*time.Second))
+	assert.Len(t, detector.records, 1)
+	detector.sweep(policy, now.Add(10*time.Second))
+	assert.Len(t, detector.records, 0)
+}
+
+func TestMemoryBackendFlapping(t *testing.T) {
+	banned := make(chan struct{}, 10)
+
+	backend := NewMemoryBackend()
+	backend.Flapping = FlappingPolicy{
+		Threshold: 2,
+		Ban:       100 * time.Millisecond,
+	}
+	backend.Logger = func(event LogEvent, _ *Client, _ packet.Generic, _ *packet.Message, _ error) {
+		if event == ClientBanned {
+			banned <- struct{}{}
+		}
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	options := client.NewConfigWithClientID("tcp://localhost:"+port, "flapping")
+
+	for i := 0; i < 2; i++ {
+		c := client.New()
+
+		cf, err := c.Connect(options)
+		assert.NoError(t, err)
+		assert.NoError(t, cf.Wait(10*time.Second))
+		assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
+
+		assert.NoError(t, c.Disconnect())
+	}
+
+	c := client.New()
+
+	cf, err := c.Connect(options)
+	assert.NoError(t, err)
+	assert.Error(t, cf.Wait(10*time.Second))
+	assert.Equal(t, packet.ServerUnavailable, cf.ReturnCode())
+
+	safeReceive(banned)
+
+	time.Sleep(150 * time.Millisecond)
+
+	c = client.New()
+
+	cf, err = c.Connect(options)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
+
+	assert.NoError(t, c.Disconnect())
+
+	close(quit)
+
+	safeReceive(done)
+}
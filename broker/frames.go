@@ -0,0 +1,76 @@
+package broker
+
+import (
+	"sync"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// A FrameCache shares the encoded publish packets of QOS 0 messages between
+// the clients that receive the same message. The packet is only encoded for
+// the first client and the other clients write the shared encoding to their
+// connections, which reduces the CPU usage of large fan-outs considerably.
+//
+// Messages are identified by their pointer as backends usually queue the same
+// message for all subscribers. Only the most recently encoded messages are
+// kept in the cache.
+type FrameCache struct {
+	size   int
+	frames map[*packet.Message]*packet.Frame
+	order  []*packet.Message
+	next   int
+	mutex  sync.Mutex
+}
+
+// NewFrameCache returns a new FrameCache that keeps the frames of the
+// specified number of messages.
+func NewFrameCache(size int) *FrameCache {
+	// check size
+	if size <= 0 {
+		size = 1
+	}
+
+	return &FrameCache{
+		size:   size,
+		frames: make(map[*packet.Message]*packet.Frame, size),
+		order:  make([]*packet.Message, size),
+	}
+}
+
+// Get returns the frame of the publish packet that has been created for the
+// message. The packet is encoded and cached if no frame is available. QOS 1
+// and 2 packets are returned as is since their packet id differs per client.
+func (c *FrameCache) Get(msg *packet.Message, publish *packet.Publish) packet.Generic {
+	// check qos
+	if publish.Message.QOS > 0 {
+		return publish
+	}
+
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// check cache
+	frame, ok := c.frames[msg]
+	if ok {
+		return frame
+	}
+
+	// encode packet
+	frame, err := packet.NewFrame(publish)
+	if err != nil {
+		return publish
+	}
+
+	// evict oldest frame
+	if old := c.order[c.next]; old != nil {
+		delete(c.frames, old)
+	}
+
+	// add frame
+	c.frames[msg] = frame
+	c.order[c.next] = msg
+	c.next = (c.next + 1) % c.size
+
+	return frame
+}
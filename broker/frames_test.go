@@ -0,0 +1,37 @@
+package broker
+
+import (
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameCache(t *testing.T) {
+	cache := NewFrameCache(1)
+
+	msg1 := &packet.Message{Topic: "foo", Payload: []byte("bar")}
+	publish1 := packet.NewPublish()
+	publish1.Message = *msg1
+
+	frame1 := cache.Get(msg1, publish1)
+	assert.IsType(t, &packet.Frame{}, frame1)
+	assert.True(t, frame1 == cache.Get(msg1, publish1))
+
+	msg2 := &packet.Message{Topic: "foo", Payload: []byte("baz")}
+	publish2 := packet.NewPublish()
+	publish2.Message = *msg2
+
+	frame2 := cache.Get(msg2, publish2)
+	assert.False(t, frame1 == frame2)
+	assert.Len(t, cache.frames, 1)
+	assert.False(t, frame1 == cache.Get(msg1, publish1))
+
+	msg3 := &packet.Message{Topic: "foo", Payload: []byte("bar"), QOS: 1}
+	publish3 := packet.NewPublish()
+	publish3.ID = 1
+	publish3.Message = *msg3
+
+	assert.Equal(t, publish3, cache.Get(msg3, publish3))
+}
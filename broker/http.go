@@ -0,0 +1,175 @@
+package broker
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/client/future"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// A PublishHandler is a http.Handler that allows systems without a MQTT client
+// library to publish messages to the engine. A message is published with a
+// POST request that carries the payload as its body. The topic, QOS level and
+// retain flag are read from the "topic", "qos" and "retain" query parameters:
+//
+//	curl -u user:pass --data-binary @payload "http://host/publish?topic=foo&qos=1"
+//
+// Every request is handled like a short-lived client connection to the engine
+// that uses the credentials of the basic authentication. Requests are
+// therefore authenticated by the backend and authorized like any other client.
+// The response is sent once the broker acknowledged the message.
+//
+// Note: Like with MQTT clients, messages denied by the Authorizer are
+// acknowledged but dropped.
+type PublishHandler struct {
+	// The timeout for connecting to the engine and publishing the message.
+	//
+	// Will default to 10 seconds.
+	Timeout time.Duration
+
+	// The maximum size of payloads. Larger payloads are rejected.
+	//
+	// Will default to 0 (unlimited).
+	MaxPayloadSize int64
+
+	engine *Engine
+}
+
+// NewPublishHandler returns a new PublishHandler that publishes to the engine.
+func NewPublishHandler(engine *Engine) *PublishHandler {
+	return &PublishHandler{
+		Timeout: 10 * time.Second,
+		engine:  engine,
+	}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *PublishHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// check method
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// get query
+	query := r.URL.Query()
+
+	// prepare message
+	msg := &packet.Message{
+		Topic: query.Get("topic"),
+	}
+
+	// check topic
+	if !topic.ValidName(msg.Topic) {
+		http.Error(w, "invalid topic", http.StatusBadRequest)
+		return
+	}
+
+	// parse qos
+	if str := query.Get("qos"); str != "" {
+		qos, err := strconv.Atoi(str)
+		if err != nil || !packet.QOS(qos).Successful() {
+			http.Error(w, "invalid qos", http.StatusBadRequest)
+			return
+		}
+		msg.QOS = packet.QOS(qos)
+	}
+
+	// parse retain
+	if str := query.Get("retain"); str != "" {
+		retain, err := strconv.ParseBool(str)
+		if err != nil {
+			http.Error(w, "invalid retain", http.StatusBadRequest)
+			return
+		}
+		msg.Retain = retain
+	}
+
+	// read payload
+	body := r.Body
+	if h.MaxPayloadSize > 0 {
+		body = http.MaxBytesReader(w, body, h.MaxPayloadSize)
+	}
+	payload, err := ioutil.ReadAll(body)
+	if err != nil {
+		http.Error(w, "invalid payload", http.StatusRequestEntityTooLarge)
+		return
+	}
+	msg.Payload = payload
+
+	// publish message
+	status := h.publish(r, msg)
+	if status != http.StatusNoContent {
+		if status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Basic realm="broker"`)
+		}
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publish the message and return the status code
+func (h *PublishHandler) publish(r *http.Request, msg *packet.Message) int {
+	// prepare url with credentials
+	brokerURL := url.URL{Scheme: "tcp", Host: "http"}
+	if user, password, ok := r.BasicAuth(); ok {
+		brokerURL.User = url.UserPassword(user, password)
+	}
+
+	// prepare config
+	config := client.NewConfig(brokerURL.String())
+	config.Dialer = &bridgeDialer{engine: h.engine}
+	config.Context = r.Context()
+	config.KeepAlive = "0s"
+
+	// connect client
+	c := client.New()
+	cf, err := c.Connect(config)
+	if err != nil {
+		return http.StatusServiceUnavailable
+	}
+
+	// wait for connack
+	err = cf.Wait(h.Timeout)
+	if err == future.ErrTimeout {
+		_ = c.Close()
+		return http.StatusGatewayTimeout
+	} else if err != nil {
+		switch cf.ReturnCode() {
+		case packet.BadUsernameOrPassword, packet.NotAuthorized:
+			return http.StatusUnauthorized
+		}
+
+		return http.StatusServiceUnavailable
+	}
+
+	// always disconnect
+	defer func() {
+		_ = c.Disconnect()
+	}()
+
+	// publish message
+	pf, err := c.PublishMessage(msg)
+	if err != nil {
+		return http.StatusServiceUnavailable
+	}
+
+	// wait for acknowledgement
+	err = pf.Wait(h.Timeout)
+	if err == future.ErrTimeout {
+		return http.StatusGatewayTimeout
+	} else if err != nil {
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusNoContent
+}
@@ -0,0 +1,279 @@
+package broker
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"sync/atomic"
+
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// DefaultLane is the name of the lane that queues all messages that do not
+// match a configured priority lane.
+const DefaultLane = "default"
+
+// ErrReservedLane is returned by the MemoryBackend if a configured priority
+// lane uses the name of the default lane.
+var ErrReservedLane = errors.New("reserved lane name")
+
+// A PriorityLane queues the messages of matching topics separately from other
+// messages. If a subscriber has a backlog, queued messages of lanes with a
+// higher priority are delivered before queued messages of lanes with a lower
+// priority. This allows e.g. command and control messages to overtake bulk
+// telemetry.
+type PriorityLane struct {
+	// The name of the lane that is used to report statistics.
+	Name string
+
+	// The topic filters of messages that are queued in the lane. If multiple
+	// lanes match a topic, the lane with the highest priority is used.
+	Topics []string
+
+	// The priority of the lane. Messages that do not match any lane are
+	// queued in the default lane which has a priority of zero. Lanes with a
+	// negative priority are therefore delivered after the default lane.
+	Priority int
+}
+
+// LaneStats contains the statistics of a priority lane.
+type LaneStats struct {
+	// The number of messages that are currently queued in the lane of all
+	// sessions.
+	Queued int64
+
+	// The number of messages that have been delivered from the lane.
+	Delivered int64
+
+	// The number of messages that have been dropped because the lane of an
+	// offline session was full or a message published by the backend itself
+	// did not fit into the lane of a session.
+	Dropped int64
+}
+
+type laneCounter struct {
+	// counters are accessed atomically and must be 64 bit aligned
+	delivered int64
+	dropped   int64
+}
+
+type memoryLane struct {
+	stored    chan memoryMessage
+	temporary chan memoryMessage
+	skipped   int
+}
+
+func newMemoryLane(backlog int) *memoryLane {
+	return &memoryLane{
+		stored:    make(chan memoryMessage, backlog),
+		temporary: make(chan memoryMessage, backlog),
+	}
+}
+
+func (l *memoryLane) len() int {
+	return len(l.temporary) + len(l.stored)
+}
+
+func (l *memoryLane) take() memoryMessage {
+	// the caller ensures that a message is queued
+	select {
+	case msg := <-l.temporary:
+		return msg
+	case msg := <-l.stored:
+		return msg
+	}
+}
+
+// next returns the next queued message and the index of its lane without
+// blocking. Lanes are served in order of priority. A lane with queued messages
+// that has been skipped limit times in favour of lanes with a higher priority
+// is served next. A limit of zero serves lanes strictly by priority.
+func (s *memorySession) next(limit int) (memoryMessage, int, bool) {
+	// find first lane with queued messages
+	index := -1
+	for i, lane := range s.lanes {
+		if lane.len() > 0 {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return memoryMessage{}, 0, false
+	}
+
+	// serve the lowest starving lane instead if enabled
+	if limit > 0 {
+		for i := len(s.lanes) - 1; i > index; i-- {
+			if lane := s.lanes[i]; lane.skipped >= limit && lane.len() > 0 {
+				index = i
+				break
+			}
+		}
+	}
+
+	// count skips of lower lanes with queued messages
+	for _, lane := range s.lanes[index+1:] {
+		if lane.len() > 0 {
+			lane.skipped++
+		} else {
+			lane.skipped = 0
+		}
+	}
+
+	// take message
+	lane := s.lanes[index]
+	lane.skipped = 0
+
+	return lane.take(), index, true
+}
+
+// resetSkips resets the skip counters of all lanes.
+func (s *memorySession) resetSkips() {
+	for _, lane := range s.lanes {
+		lane.skipped = 0
+	}
+}
+
+// wait blocks until a message is queued in any lane or the channel is closed.
+func (s *memorySession) wait(closing <-chan struct{}) (memoryMessage, int, bool) {
+	// use a plain select if there is only the default lane
+	if len(s.lanes) == 1 {
+		select {
+		case msg := <-s.lanes[0].temporary:
+			return msg, 0, true
+		case msg := <-s.lanes[0].stored:
+			return msg, 0, true
+		case <-closing:
+			return memoryMessage{}, 0, false
+		}
+	}
+
+	// prepare cases
+	cases := make([]reflect.SelectCase, 0, len(s.lanes)*2+1)
+	for _, lane := range s.lanes {
+		cases = append(cases, reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(lane.temporary),
+		}, reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(lane.stored),
+		})
+	}
+	cases = append(cases, reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(closing),
+	})
+
+	// wait for message
+	chosen, value, _ := reflect.Select(cases)
+	if chosen == len(cases)-1 {
+		return memoryMessage{}, 0, false
+	}
+
+	return value.Interface().(memoryMessage), chosen / 2, true
+}
+
+// prepareLanes will validate and sort the configured lanes by priority and add
+// the default lane.
+func (m *MemoryBackend) prepareLanes() error {
+	m.prioritizer.Do(func() {
+		// check lanes
+		for _, lane := range m.PriorityLanes {
+			if lane.Name == DefaultLane {
+				m.lanesErr = ErrReservedLane
+				return
+			}
+		}
+
+		// copy lanes
+		lanes := append([]PriorityLane{}, m.PriorityLanes...)
+		lanes = append(lanes, PriorityLane{Name: DefaultLane})
+
+		// sort lanes by priority, the default lane is placed after lanes with
+		// the same priority
+		sort.SliceStable(lanes, func(i, j int) bool {
+			return lanes[i].Priority > lanes[j].Priority
+		})
+
+		// create counters
+		counters := make([]*laneCounter, 0, len(lanes))
+		for range lanes {
+			counters = append(counters, &laneCounter{})
+		}
+
+		// find default lane
+		for i, lane := range lanes {
+			if lane.Name == DefaultLane {
+				m.defaultLane = i
+			}
+		}
+
+		m.lanes = lanes
+		m.laneCounters = counters
+	})
+
+	return m.lanesErr
+}
+
+// laneIndex returns the index of the lane that queues messages of the
+// specified topic.
+func (m *MemoryBackend) laneIndex(name string) int {
+	// check lanes
+	if len(m.lanes) == 1 {
+		return 0
+	}
+
+	// find first matching lane
+	for i, lane := range m.lanes {
+		for _, filter := range lane.Topics {
+			if topic.Match(name, filter) {
+				return i
+			}
+		}
+	}
+
+	return m.defaultLane
+}
+
+// LaneStats returns the statistics of all priority lanes including the default
+// lane.
+func (m *MemoryBackend) LaneStats() map[string]LaneStats {
+	// acquire global mutex
+	m.globalMutex.Lock()
+	defer m.globalMutex.Unlock()
+
+	return m.laneStats()
+}
+
+// laneStats returns the statistics of all lanes. The global mutex must be held
+// by the caller.
+func (m *MemoryBackend) laneStats() map[string]LaneStats {
+	// ensure lanes
+	_ = m.prepareLanes()
+
+	// count queued messages
+	queued := make([]int64, len(m.lanes))
+	count := func(sess *memorySession) {
+		for i, lane := range sess.lanes {
+			queued[i] += int64(lane.len())
+		}
+	}
+	for _, sess := range m.temporarySessions {
+		count(sess)
+	}
+	for _, sess := range m.storedSessions {
+		count(sess)
+	}
+
+	// prepare stats
+	stats := make(map[string]LaneStats, len(m.lanes))
+	for i, lane := range m.lanes {
+		stats[lane.Name] = LaneStats{
+			Queued:    queued[i],
+			Delivered: atomic.LoadInt64(&m.laneCounters[i].delivered),
+			Dropped:   atomic.LoadInt64(&m.laneCounters[i].dropped),
+		}
+	}
+
+	return stats
+}
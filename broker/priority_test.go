@@ -0,0 +1,160 @@
+package broker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemorySessionNext(t *testing.T) {
+	for _, item := range []struct {
+		limit int
+		order []int
+	}{
+		{limit: 0, order: []int{0, 0, 0, 0, 0, 0, 2, 2}},
+		{limit: 2, order: []int{0, 0, 2, 0, 0, 2, 0, 0}},
+	} {
+		sess := newMemorySession(10, 3)
+
+		for i := 0; i < 6; i++ {
+			sess.lanes[0].stored <- memoryMessage{}
+		}
+		for i := 0; i < 2; i++ {
+			sess.lanes[2].temporary <- memoryMessage{}
+		}
+
+		var order []int
+		for {
+			_, lane, ok := sess.next(item.limit)
+			if !ok {
+				break
+			}
+			order = append(order, lane)
+		}
+		assert.Equal(t, item.order, order)
+	}
+}
+
+func TestMemoryBackendDequeueResetSkips(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.PriorityLanes = []PriorityLane{
+		{Name: "bulk", Topics: []string{"telemetry/#"}, Priority: -1},
+	}
+	assert.NoError(t, backend.prepareLanes())
+
+	sess := newMemorySession(10, 2)
+	sess.lanes[0].stored <- memoryMessage{Message: &packet.Message{Topic: "status"}}
+	sess.lanes[1].skipped = 5
+
+	// resuming must not touch the skip counters
+	sess.reuse()
+	assert.Equal(t, 5, sess.lanes[1].skipped)
+
+	// the dequeuer of the new owner resets them
+	msg, _, err := backend.Dequeue(&Client{session: sess})
+	assert.NoError(t, err)
+	assert.Equal(t, "status", msg.Topic)
+	assert.Equal(t, 0, sess.lanes[1].skipped)
+}
+
+func TestMemoryBackendReservedLane(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.PriorityLanes = []PriorityLane{
+		{Name: DefaultLane, Topics: []string{"foo"}, Priority: 1},
+	}
+
+	err := backend.Publish(nil, &packet.Message{Topic: "foo"}, nil)
+	assert.Equal(t, ErrReservedLane, err)
+	assert.Empty(t, backend.LaneStats())
+}
+
+func TestMemoryBackendPriorityLanes(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.PriorityLanes = []PriorityLane{
+		{Name: "bulk", Topics: []string{"telemetry/#"}, Priority: -1},
+		{Name: "control", Topics: []string{"command/#"}, Priority: 10},
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	options := client.NewConfigWithClientID("tcp://localhost:"+port, "priority")
+	options.CleanSession = false
+
+	subscriber := client.New()
+
+	cf, err := subscriber.Connect(options)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	sf, err := subscriber.SubscribeMultiple([]packet.Subscription{
+		{Topic: "telemetry/#", QOS: 1},
+		{Topic: "command/#", QOS: 1},
+		{Topic: "status", QOS: 1},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(10*time.Second))
+
+	err = subscriber.Disconnect()
+	assert.NoError(t, err)
+
+	publisher := client.New()
+
+	cf, err = publisher.Connect(client.NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	for _, topic := range []string{"telemetry/1", "telemetry/2", "status", "telemetry/3", "command/1", "command/2"} {
+		pf, err := publisher.Publish(topic, []byte(topic), 1, false)
+		assert.NoError(t, err)
+		assert.NoError(t, pf.Wait(10*time.Second))
+	}
+
+	err = publisher.Disconnect()
+	assert.NoError(t, err)
+
+	stats := backend.LaneStats()
+	assert.Equal(t, LaneStats{Queued: 2}, stats["control"])
+	assert.Equal(t, LaneStats{Queued: 1}, stats[DefaultLane])
+	assert.Equal(t, LaneStats{Queued: 3}, stats["bulk"])
+
+	received := make(chan string, 10)
+
+	subscriber = client.New()
+	subscriber.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		received <- msg.Topic
+		return nil
+	}
+
+	cf, err = subscriber.Connect(options)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.True(t, cf.SessionPresent())
+
+	var topics []string
+	for i := 0; i < 6; i++ {
+		select {
+		case topic := <-received:
+			topics = append(topics, topic)
+		case <-time.After(10 * time.Second):
+			assert.Fail(t, "message not received")
+		}
+	}
+	assert.Equal(t, []string{"command/1", "command/2", "status", "telemetry/1", "telemetry/2", "telemetry/3"}, topics)
+
+	stats = backend.LaneStats()
+	assert.Equal(t, LaneStats{Delivered: 2}, stats["control"])
+	assert.Equal(t, LaneStats{Delivered: 1}, stats[DefaultLane])
+	assert.Equal(t, LaneStats{Delivered: 3}, stats["bulk"])
+
+	err = subscriber.Disconnect()
+	assert.NoError(t, err)
+
+	close(quit)
+
+	safeReceive(done)
+}
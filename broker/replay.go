@@ -0,0 +1,97 @@
+package broker
+
+import (
+	"errors"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// ErrInvalidReplay is returned by Replay if the filter or reply topic is
+// invalid.
+var ErrInvalidReplay = errors.New("invalid replay")
+
+type historyMessage struct {
+	memoryMessage
+
+	published time.Time
+}
+
+// record will add the message published by a client to the history. The
+// global mutex must be held by the caller.
+func (m *MemoryBackend) record(msg *packet.Message) {
+	// check size
+	if m.History <= 0 {
+		return
+	}
+
+	// prepare expiry
+	now := time.Now()
+	var expires time.Time
+	if expiry := m.messageExpiry(msg.Topic); expiry > 0 {
+		expires = now.Add(expiry)
+	}
+
+	// drop oldest message if full
+	if len(m.history) >= m.History {
+		m.history = m.history[len(m.history)-m.History+1:]
+	}
+
+	// add message
+	m.history = append(m.history, historyMessage{
+		memoryMessage: memoryMessage{Message: msg.Copy(), expires: expires},
+		published:     now,
+	})
+}
+
+// Replay will publish the messages from the history that match the filter and
+// have been published in the specified time range to a dedicated reply topic.
+// The original topic is appended to the reply topic, e.g. a message published
+// to "foo/bar" is replayed with the reply topic "replies/1" to the topic
+// "replies/1/foo/bar". A zero since or until time leaves the range open. Only
+// messages that have not yet expired are replayed. The number of replayed
+// messages is returned.
+//
+// Note: Replayed messages are delivered to all clients subscribed to the reply
+// topic. The requesting client should therefore use a unique reply topic that
+// is protected by the Authorizer.
+func (m *MemoryBackend) Replay(filter string, since, until time.Time, replyTopic string) (int, error) {
+	// check filter and reply topic
+	if !topic.ValidFilter(filter) || !topic.ValidName(replyTopic) {
+		return 0, ErrInvalidReplay
+	}
+
+	// acquire global mutex
+	m.globalMutex.Lock()
+	defer m.globalMutex.Unlock()
+
+	// replay messages
+	now := time.Now()
+	count := 0
+	for _, hm := range m.history {
+		// check range
+		if (!since.IsZero() && hm.published.Before(since)) || (!until.IsZero() && !hm.published.Before(until)) {
+			continue
+		}
+
+		// check expiry and topic
+		if hm.expired(now) || !topic.Match(hm.Topic, filter) {
+			continue
+		}
+
+		// prepare message
+		msg := hm.Copy()
+		msg.Topic = replyTopic + "/" + msg.Topic
+
+		// publish message
+		err := m.publish(nil, msg)
+		if err != nil {
+			return count, err
+		}
+
+		count++
+	}
+
+	return count, nil
+}
@@ -0,0 +1,78 @@
+package broker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBackendReplay(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.History = 3
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	received := make(chan *packet.Message, 10)
+
+	client1 := client.New()
+	client1.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		received <- msg
+		return nil
+	}
+
+	cf, err := client1.Connect(client.NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	for _, topic := range []string{"foo/1", "bar/1", "foo/2", "foo/3"} {
+		pf, err := client1.Publish(topic, []byte(topic), 1, false)
+		assert.NoError(t, err)
+		assert.NoError(t, pf.Wait(10*time.Second))
+	}
+
+	middle := time.Now()
+
+	pf, err := client1.Publish("foo/4", []byte("foo/4"), 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(10*time.Second))
+
+	sf, err := client1.Subscribe("replies/1/#", 1)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(10*time.Second))
+
+	n, err := backend.Replay("foo/+", time.Time{}, middle, "replies/1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	msg := <-received
+	assert.Equal(t, "replies/1/foo/2", msg.Topic)
+	assert.Equal(t, []byte("foo/2"), msg.Payload)
+	assert.Equal(t, packet.QOS(1), msg.QOS)
+
+	msg = <-received
+	assert.Equal(t, "replies/1/foo/3", msg.Topic)
+
+	n, err = backend.Replay("foo/#", middle, time.Time{}, "replies/1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	msg = <-received
+	assert.Equal(t, "replies/1/foo/4", msg.Topic)
+
+	_, err = backend.Replay("foo/#/bar", time.Time{}, time.Time{}, "replies/1")
+	assert.Equal(t, ErrInvalidReplay, err)
+
+	_, err = backend.Replay("foo", time.Time{}, time.Time{}, "replies/+")
+	assert.Equal(t, ErrInvalidReplay, err)
+
+	err = client1.Disconnect()
+	assert.NoError(t, err)
+
+	close(quit)
+	safeReceive(done)
+}
@@ -0,0 +1,218 @@
+package broker
+
+import (
+	"errors"
+	"hash/fnv"
+
+	"github.com/256dpi/gomqtt/logging"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+)
+
+// ErrShardUnavailable is returned if a connection cannot be forwarded to the
+// shard that owns the client.
+var ErrShardUnavailable = errors.New("shard unavailable")
+
+// A Sharder maps keys like client ids or topics to the identifier of the shard
+// that owns them.
+type Sharder interface {
+	Shard(key string) string
+}
+
+// The ShardFunc type is an adapter to allow the use of ordinary functions as
+// sharders.
+type ShardFunc func(key string) string
+
+// Shard calls f(key).
+func (f ShardFunc) Shard(key string) string {
+	return f(key)
+}
+
+// A HashSharder distributes keys over a fixed list of shards using rendezvous
+// hashing. If a shard is added or removed only the keys owned by that shard
+// are remapped.
+type HashSharder []string
+
+// Shard implements the Sharder interface.
+func (s HashSharder) Shard(key string) string {
+	// find shard with the highest weight
+	var shard string
+	var max uint64
+	for i, candidate := range s {
+		hash := fnv.New64a()
+		_, _ = hash.Write([]byte(candidate))
+		_, _ = hash.Write([]byte{0})
+		_, _ = hash.Write([]byte(key))
+		weight := mixHash(hash.Sum64())
+
+		if i == 0 || weight > max {
+			shard = candidate
+			max = weight
+		}
+	}
+
+	return shard
+}
+
+// spreads the bits of a fnv hash to improve the distribution of weights
+func mixHash(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// routes the connection to the shard that owns the client
+func (e *Engine) route(conn transport.Conn, versions []byte) {
+	// close connection if the engine dies while routing or forwarding
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-e.tomb.Dying():
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+
+	// receive first packet
+	pkt, err := conn.Receive()
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	// forward connection if the client is owned by another shard, clients
+	// with an unacceptable version are rejected locally
+	if connect, ok := pkt.(*packet.Connect); ok && connect.ClientID != "" && allowedVersion(versions, connect.Version) {
+		shard := e.Sharder.Shard(connect.ClientID)
+		if shard != e.LocalShard {
+			e.forward(conn, connect, shard)
+			return
+		}
+	}
+
+	// acquire mutex
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// close conn when dying
+	if !e.tomb.Alive() {
+		_ = conn.Close()
+		return
+	}
+
+	// handle client locally
+	e.handle(&replayConn{Conn: conn, pkt: pkt}, versions)
+}
+
+// forwards the connection to the specified shard
+func (e *Engine) forward(conn transport.Conn, connect *packet.Connect, shard string) {
+	// dial shard
+	remote, err := e.dialShard(shard)
+	if err == nil {
+		err = remote.Send(connect, false)
+		if err != nil {
+			_ = remote.Close()
+		}
+	}
+
+	// reject client if the shard is unavailable
+	if err != nil {
+		e.logShard(logging.Error, "shard unavailable", connect.ClientID, shard, err)
+
+		connack := packet.NewConnack()
+		connack.ReturnCode = packet.ServerUnavailable
+		_ = conn.Send(connack, false)
+		_ = conn.Close()
+
+		return
+	}
+
+	e.logShard(logging.Info, "connection forwarded", connect.ClientID, shard, nil)
+
+	// keep alive is enforced by the owning shard
+	conn.SetReadTimeout(0)
+
+	// relay packets until both directions are closed, closing the client
+	// connection when the engine dies also closes the remote connection
+	relayed := make(chan struct{})
+	go func() {
+		relay(remote, conn)
+		close(relayed)
+	}()
+	relay(conn, remote)
+	<-relayed
+}
+
+func (e *Engine) dialShard(shard string) (transport.Conn, error) {
+	// check dialer
+	if e.ShardDialer == nil {
+		return nil, ErrShardUnavailable
+	}
+
+	return e.ShardDialer(shard)
+}
+
+func (e *Engine) logShard(level logging.Level, event, id, shard string, err error) {
+	// check logger
+	if e.EventLogger == nil {
+		return
+	}
+
+	// prepare fields
+	fields := []logging.Field{
+		logging.F("client", id),
+		logging.F("shard", shard),
+	}
+	if err != nil {
+		fields = append(fields, logging.F("error", err))
+	}
+
+	e.EventLogger.Log(level, event, fields...)
+}
+
+// relays packets until one of the connections fails
+func relay(from, to transport.Conn) {
+	for {
+		// receive packet
+		pkt, err := from.Receive()
+		if err != nil {
+			break
+		}
+
+		// send packet
+		err = to.Send(pkt, false)
+		if err != nil {
+			break
+		}
+	}
+
+	// close both connections
+	_ = from.Close()
+	_ = to.Close()
+}
+
+// a connection that returns an already received packet first
+type replayConn struct {
+	transport.Conn
+
+	pkt packet.Generic
+}
+
+func (c *replayConn) Receive() (packet.Generic, error) {
+	// return replayed packet
+	if c.pkt != nil {
+		pkt := c.pkt
+		c.pkt = nil
+		return pkt, nil
+	}
+
+	return c.Conn.Receive()
+}
+
+func (c *replayConn) Unwrap() transport.Conn {
+	return c.Conn
+}
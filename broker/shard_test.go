@@ -0,0 +1,242 @@
+package broker
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+	"github.com/256dpi/gomqtt/transport/flow"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashSharder(t *testing.T) {
+	sharder := HashSharder{"a", "b", "c"}
+
+	counts := map[string]int{}
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("client-%d", i)
+		shard := sharder.Shard(key)
+		assert.Equal(t, shard, sharder.Shard(key))
+		counts[shard]++
+	}
+
+	assert.Len(t, counts, 3)
+	for _, count := range counts {
+		assert.True(t, count > 50)
+	}
+
+	// removing a shard only remaps its keys
+	reduced := HashSharder{"a", "b"}
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("client-%d", i)
+		if shard := sharder.Shard(key); shard != "c" {
+			assert.Equal(t, shard, reduced.Shard(key))
+		}
+	}
+
+	assert.Equal(t, "", HashSharder{}.Shard("foo"))
+}
+
+func TestEngineSharding(t *testing.T) {
+	sharder := ShardFunc(func(key string) string {
+		if key == "remote" || key == "local" {
+			return "b"
+		}
+
+		return "a"
+	})
+
+	engineB := NewEngine(NewMemoryBackend())
+	engineB.Sharder = sharder
+	engineB.LocalShard = "b"
+	portB, quitB, doneB := Run(engineB, "tcp")
+
+	engineA := NewEngine(NewMemoryBackend())
+	engineA.Sharder = sharder
+	engineA.LocalShard = "a"
+	engineA.ShardDialer = func(shard string) (transport.Conn, error) {
+		assert.Equal(t, "b", shard)
+		return transport.Dial("tcp://localhost:" + portB)
+	}
+	portA, quitA, doneA := Run(engineA, "tcp")
+
+	received := make(chan *packet.Message, 1)
+
+	// connect through shard a
+	remote := client.New()
+	remote.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		received <- msg
+		return nil
+	}
+
+	cf, err := remote.Connect(client.NewConfigWithClientID("tcp://localhost:"+portA, "remote"))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
+
+	sf, err := remote.Subscribe("test", 1)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(10*time.Second))
+
+	// publish directly to shard b
+	local := client.New()
+
+	cf, err = local.Connect(client.NewConfigWithClientID("tcp://localhost:"+portB, "local"))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	pf, err := local.Publish("test", []byte("test"), 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(10*time.Second))
+
+	msg := <-received
+	assert.Equal(t, "test", msg.Topic)
+	assert.Equal(t, []byte("test"), msg.Payload)
+
+	// clients owned by shard a are handled locally
+	other := client.New()
+
+	cf, err = other.Connect(client.NewConfigWithClientID("tcp://localhost:"+portA, "other"))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	pf, err = other.Publish("test", []byte("test"), 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(10*time.Second))
+
+	select {
+	case <-received:
+		assert.Fail(t, "unexpected message")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.NoError(t, remote.Disconnect())
+	assert.NoError(t, local.Disconnect())
+	assert.NoError(t, other.Disconnect())
+
+	close(quitA)
+	close(quitB)
+
+	safeReceive(doneA)
+	safeReceive(doneB)
+}
+
+func TestEngineShardingUnavailable(t *testing.T) {
+	engine := NewEngine(NewMemoryBackend())
+	engine.Sharder = HashSharder{"b"}
+	engine.LocalShard = "a"
+
+	port, quit, done := Run(engine, "tcp")
+
+	c := client.New()
+
+	cf, err := c.Connect(client.NewConfigWithClientID("tcp://localhost:"+port, "test"))
+	assert.NoError(t, err)
+	assert.Error(t, cf.Wait(10*time.Second))
+	assert.Equal(t, packet.ServerUnavailable, cf.ReturnCode())
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestEngineShardingClose(t *testing.T) {
+	sharder := HashSharder{"b"}
+
+	engineB := NewEngine(NewMemoryBackend())
+	engineB.Sharder = sharder
+	engineB.LocalShard = "b"
+	portB, quitB, doneB := Run(engineB, "tcp")
+
+	engineA := NewEngine(NewMemoryBackend())
+	engineA.Sharder = sharder
+	engineA.LocalShard = "a"
+	engineA.ShardDialer = func(shard string) (transport.Conn, error) {
+		return transport.Dial("tcp://localhost:" + portB)
+	}
+	portA, quitA, doneA := Run(engineA, "tcp")
+
+	lost := make(chan struct{})
+
+	c := client.New()
+	c.Callback = func(msg *packet.Message, err error) error {
+		assert.Nil(t, msg)
+		assert.Error(t, err)
+		close(lost)
+		return nil
+	}
+
+	cf, err := c.Connect(client.NewConfigWithClientID("tcp://localhost:"+portA, "test"))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
+
+	// closing shard a closes forwarded connections
+	close(quitA)
+	safeReceive(doneA)
+	safeReceive(lost)
+
+	close(quitB)
+	safeReceive(doneB)
+}
+
+func TestEngineShardingTLS(t *testing.T) {
+	crt, err := tls.LoadX509KeyPair(filepath.Join("..", "example.crt"), filepath.Join("..", "example.key"))
+	require.NoError(t, err)
+
+	backend := &tlsMemoryBackend{
+		MemoryBackend: *NewMemoryBackend(),
+		states:        make(chan *tls.ConnectionState, 1),
+	}
+
+	engine := NewEngine(backend)
+	engine.Sharder = HashSharder{"a"}
+	engine.LocalShard = "a"
+
+	launcher := transport.NewLauncher()
+	launcher.TLSConfig = &tls.Config{Certificates: []tls.Certificate{crt}}
+
+	server, err := launcher.Launch("tls://localhost:0")
+	require.NoError(t, err)
+
+	engine.Accept(server)
+
+	connect := packet.NewConnect()
+	connect.ClientID = "test"
+
+	f := flow.New().
+		Send(connect).
+		Receive(packet.NewConnack()).
+		Send(packet.NewDisconnect()).
+		End()
+
+	dialer := transport.NewDialer()
+	dialer.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+
+	_, port, _ := net.SplitHostPort(server.Addr().String())
+
+	conn, err := dialer.Dial("tls://localhost:" + port)
+	require.NoError(t, err)
+
+	err = f.Test(conn)
+	assert.NoError(t, err)
+
+	// routed clients still expose the tls state
+	state := <-backend.states
+	if assert.NotNil(t, state) {
+		assert.Equal(t, "localhost", state.ServerName)
+	}
+
+	_ = server.Close()
+
+	engine.Close()
+}
@@ -0,0 +1,109 @@
+package broker
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// A Snapshot periodically publishes the retained messages matching a filter
+// as a single JSON object that maps topics to payloads. Payloads that are
+// valid JSON are embedded as is, all others are encoded as strings. This
+// allows dashboards to receive the consolidated state with a single message
+// instead of subscribing to a large number of retained topics.
+type Snapshot struct {
+	// The topic filter that selects the retained messages.
+	Filter string
+
+	// The topic the snapshot is published to. A retained message on this
+	// topic is never included in the snapshot itself.
+	Topic string
+
+	// The interval in which the snapshot is published.
+	//
+	// Will default to 1 minute.
+	Interval time.Duration
+
+	// The QOS level of the published snapshot.
+	QOS packet.QOS
+
+	// Whether the snapshot should be published as a retained message.
+	Retain bool
+}
+
+// snapshot will periodically publish the specified snapshot until the backend
+// is closed.
+func (m *MemoryBackend) snapshot(snapshot Snapshot) {
+	// get interval
+	interval := snapshot.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	// prepare ticker
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.publishSnapshot(snapshot)
+		case <-m.quit:
+			return
+		}
+	}
+}
+
+// publishSnapshot will publish the current retained messages matching the
+// filter of the snapshot.
+func (m *MemoryBackend) publishSnapshot(snapshot Snapshot) {
+	// acquire global mutex
+	m.globalMutex.Lock()
+	defer m.globalMutex.Unlock()
+
+	// return if closing
+	if m.closing {
+		return
+	}
+
+	// collect retained messages
+	now := time.Now()
+	values := make(map[string]json.RawMessage)
+	for _, value := range m.retainedMessages.Search(snapshot.Filter) {
+		// skip own and expired messages
+		msg := value.(memoryMessage)
+		if msg.Topic == snapshot.Topic || msg.expired(now) {
+			continue
+		}
+
+		// embed json payloads
+		if json.Valid(msg.Payload) {
+			values[msg.Topic] = msg.Payload
+			continue
+		}
+
+		// encode other payloads as strings
+		str, err := json.Marshal(string(msg.Payload))
+		if err != nil {
+			continue
+		}
+
+		values[msg.Topic] = str
+	}
+
+	// encode snapshot
+	payload, err := json.Marshal(values)
+	if err != nil {
+		return
+	}
+
+	// publish snapshot, errors are only returned for the own queue of a
+	// publishing client
+	_ = m.publish(nil, &packet.Message{
+		Topic:   snapshot.Topic,
+		Payload: payload,
+		QOS:     snapshot.QOS,
+		Retain:  snapshot.Retain,
+	})
+}
@@ -0,0 +1,80 @@
+package broker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBackendSnapshots(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.Snapshots = []Snapshot{
+		{Filter: "state/#", Topic: "state/snapshot", Interval: 10 * time.Millisecond, Retain: true},
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	received := make(chan *packet.Message, 100)
+
+	client1 := client.New()
+	client1.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+
+		select {
+		case received <- msg:
+		default:
+		}
+
+		return nil
+	}
+
+	cf, err := client1.Connect(client.NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	for topic, payload := range map[string]string{
+		"state/temp":   "21.5",
+		"state/door":   "open",
+		"state/config": `{"mode":"auto"}`,
+		"other/value":  "1",
+	} {
+		pf, err := client1.Publish(topic, []byte(payload), 1, true)
+		assert.NoError(t, err)
+		assert.NoError(t, pf.Wait(10*time.Second))
+	}
+
+	sf, err := client1.Subscribe("state/snapshot", 0)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(10*time.Second))
+
+	expected := `{"state/config":{"mode":"auto"},"state/door":"open","state/temp":21.5}`
+	timeout := time.After(10 * time.Second)
+
+	for {
+		select {
+		case msg := <-received:
+			if string(msg.Payload) != expected {
+				continue
+			}
+		case <-timeout:
+			assert.Fail(t, "snapshot not received")
+			return
+		}
+
+		break
+	}
+
+	err = client1.Disconnect()
+	assert.NoError(t, err)
+
+	ret := backend.Close(5 * time.Second)
+	assert.True(t, ret)
+
+	close(quit)
+
+	safeReceive(done)
+}
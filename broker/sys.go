@@ -0,0 +1,288 @@
+package broker
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/tools"
+)
+
+// the periods of the published load averages
+var sysLoadPeriods = []struct {
+	name   string
+	period time.Duration
+}{
+	{"1min", time.Minute},
+	{"5min", 5 * time.Minute},
+	{"15min", 15 * time.Minute},
+}
+
+// the counters that have load averages
+var sysLoadCounters = []string{
+	"messages/received",
+	"messages/sent",
+	"publish/messages/received",
+	"publish/messages/sent",
+	"bytes/received",
+	"bytes/sent",
+}
+
+type sysStats struct {
+	// counters are accessed atomically and must be 64 bit aligned
+	messagesReceived int64
+	messagesSent     int64
+	publishReceived  int64
+	publishSent      int64
+	bytesReceived    int64
+	bytesSent        int64
+	messagesDropped  int64
+	subsDenied       int64
+	sessionsExpired  int64
+
+	started time.Time
+
+	last  map[string]int64
+	loads map[string]*tools.Average
+	mutex sync.Mutex
+}
+
+func newSysStats() *sysStats {
+	return &sysStats{
+		started: time.Now(),
+		last:    make(map[string]int64),
+		loads:   make(map[string]*tools.Average),
+	}
+}
+
+func (s *sysStats) count(event LogEvent, pkt packet.Generic) {
+	// count denied subscriptions and dropped messages
+	if event == LimitExceeded && pkt != nil {
+		atomic.AddInt64(&s.subsDenied, 1)
+		return
+	} else if event == QuotaExceeded || event == PacketTooLarge || event == LimitExceeded || event == SendQueueFull {
+		s.drop()
+		return
+	} else if event == SessionExpired {
+		atomic.AddInt64(&s.sessionsExpired, 1)
+		return
+	}
+
+	// check packet
+	if pkt == nil {
+		return
+	}
+
+	// check if publish
+	_, publish := pkt.(*packet.Publish)
+
+	switch event {
+	case PacketReceived:
+		atomic.AddInt64(&s.messagesReceived, 1)
+		atomic.AddInt64(&s.bytesReceived, int64(pkt.Len()))
+		if publish {
+			atomic.AddInt64(&s.publishReceived, 1)
+		}
+	case PacketSent:
+		atomic.AddInt64(&s.messagesSent, 1)
+		atomic.AddInt64(&s.bytesSent, int64(pkt.Len()))
+		if publish {
+			atomic.AddInt64(&s.publishSent, 1)
+		}
+	}
+}
+
+func (s *sysStats) drop() {
+	atomic.AddInt64(&s.messagesDropped, 1)
+}
+
+func (s *sysStats) counters() map[string]int64 {
+	return map[string]int64{
+		"messages/received":         atomic.LoadInt64(&s.messagesReceived),
+		"messages/sent":             atomic.LoadInt64(&s.messagesSent),
+		"publish/messages/received": atomic.LoadInt64(&s.publishReceived),
+		"publish/messages/sent":     atomic.LoadInt64(&s.publishSent),
+		"bytes/received":            atomic.LoadInt64(&s.bytesReceived),
+		"bytes/sent":                atomic.LoadInt64(&s.bytesSent),
+		"messages/dropped":          atomic.LoadInt64(&s.messagesDropped),
+		"subscriptions/denied":      atomic.LoadInt64(&s.subsDenied),
+		"sessions/expired":          atomic.LoadInt64(&s.sessionsExpired),
+	}
+}
+
+// update will recalculate the load averages as exponentially weighted moving
+// averages of the per minute rates since the last update.
+func (s *sysStats) update(counters map[string]int64, interval time.Duration) map[string]float64 {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// prepare result
+	result := make(map[string]float64)
+
+	for _, name := range sysLoadCounters {
+		// calculate per minute rate
+		rate := float64(counters[name]-s.last[name]) * float64(time.Minute) / float64(interval)
+		s.last[name] = counters[name]
+
+		// update averages
+		for _, p := range sysLoadPeriods {
+			key := "load/" + name + "/" + p.name
+			load, ok := s.loads[key]
+			if !ok {
+				load = tools.NewAverage(p.period)
+				s.loads[key] = load
+			}
+
+			result[key] = load.Update(rate, interval)
+		}
+	}
+
+	return result
+}
+
+// report will periodically publish the broker statistics until the backend
+// is closed.
+func (m *MemoryBackend) report() {
+	// prepare ticker
+	ticker := time.NewTicker(m.SysInterval)
+	defer ticker.Stop()
+
+	// publish initial statistics
+	m.publishStats(0)
+
+	for {
+		select {
+		case <-ticker.C:
+			m.publishStats(m.SysInterval)
+		case <-m.quit:
+			return
+		}
+	}
+}
+
+// publishStats will publish the current broker statistics as retained messages
+// and check the configured alerts.
+func (m *MemoryBackend) publishStats(interval time.Duration) {
+	// get counters
+	counters := m.stats.counters()
+
+	// prepare values
+	values := map[string]string{
+		"uptime": strconv.Itoa(int(time.Since(m.stats.started).Seconds())) + " seconds",
+	}
+
+	// prepare metrics
+	metrics := make(map[string]float64)
+
+	// add counters
+	for name, value := range counters {
+		values[name] = strconv.FormatInt(value, 10)
+		metrics[name] = float64(value)
+	}
+
+	// add load averages
+	if interval > 0 {
+		for name, value := range m.stats.update(counters, interval) {
+			values[name] = strconv.FormatFloat(value, 'f', 2, 64)
+			metrics[name] = value
+		}
+	}
+
+	// add heap usage
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	values["heap/current"] = strconv.FormatUint(mem.HeapAlloc, 10)
+	metrics["heap/current"] = float64(mem.HeapAlloc)
+
+	// acquire global mutex
+	m.globalMutex.Lock()
+
+	// return if closing
+	if m.closing {
+		m.globalMutex.Unlock()
+		return
+	}
+
+	// count clients and queued messages
+	connected := len(m.temporarySessions)
+	disconnected := 0
+	encrypted := 0
+	queued := 0
+	for client, sess := range m.temporarySessions {
+		if client.TLS() != nil {
+			encrypted++
+		}
+		queued += sess.queued()
+	}
+	for _, sess := range m.storedSessions {
+		if sess.owner != nil {
+			connected++
+			if sess.owner.TLS() != nil {
+				encrypted++
+			}
+		} else {
+			disconnected++
+		}
+		queued += sess.queued()
+	}
+
+	// add client values
+	values["clients/connected"] = strconv.Itoa(connected)
+	values["clients/disconnected"] = strconv.Itoa(disconnected)
+	values["clients/total"] = strconv.Itoa(connected + disconnected)
+	values["clients/tls"] = strconv.Itoa(encrypted)
+	values["messages/queued"] = strconv.Itoa(queued)
+	metrics["clients/connected"] = float64(connected)
+	metrics["clients/disconnected"] = float64(disconnected)
+	metrics["clients/total"] = float64(connected + disconnected)
+	metrics["clients/tls"] = float64(encrypted)
+	metrics["messages/queued"] = float64(queued)
+
+	// add lane values if enabled
+	if len(m.PriorityLanes) > 0 {
+		for name, stats := range m.laneStats() {
+			for key, value := range map[string]int64{
+				"queued":    stats.Queued,
+				"delivered": stats.Delivered,
+				"dropped":   stats.Dropped,
+			} {
+				values["lanes/"+name+"/"+key] = strconv.FormatInt(value, 10)
+				metrics["lanes/"+name+"/"+key] = float64(value)
+			}
+		}
+	}
+
+	// publish values, errors are only returned for the own queue of a
+	// publishing client
+	for name, value := range values {
+		_ = m.publish(nil, &packet.Message{
+			Topic:   "$SYS/broker/" + name,
+			Payload: []byte(value),
+			Retain:  true,
+		})
+	}
+
+	// check alerts
+	changes := m.checkAlerts(metrics)
+
+	// publish alerts if enabled
+	if m.PublishAlerts {
+		for _, change := range changes {
+			m.publishAlert(change)
+		}
+	}
+
+	// release mutex
+	m.globalMutex.Unlock()
+
+	// call alert callback if available
+	if m.AlertCallback != nil {
+		for _, change := range changes {
+			m.AlertCallback(change.alert, change.value, change.active)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package broker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBackendSys(t *testing.T) {
+	backend := NewMemoryBackend()
+	backend.SysInterval = 10 * time.Millisecond
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	received := make(chan *packet.Message, 100)
+
+	client1 := client.New()
+	client1.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+
+		select {
+		case received <- msg:
+		default:
+		}
+
+		return nil
+	}
+
+	cf, err := client1.Connect(client.NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	sf, err := client1.Subscribe("$SYS/broker/#", 0)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(10*time.Second))
+
+	values := map[string]string{}
+	timeout := time.After(10 * time.Second)
+
+	for len(values) < 34 || values["$SYS/broker/clients/connected"] != "1" {
+		select {
+		case msg := <-received:
+			values[msg.Topic] = string(msg.Payload)
+		case <-timeout:
+			assert.Fail(t, "statistics not received")
+			return
+		}
+	}
+
+	assert.NotEmpty(t, values["$SYS/broker/uptime"])
+	assert.NotEqual(t, "0", values["$SYS/broker/messages/received"])
+	assert.NotEqual(t, "0", values["$SYS/broker/bytes/received"])
+	assert.Equal(t, "0", values["$SYS/broker/clients/tls"])
+	assert.Equal(t, "0", values["$SYS/broker/sessions/expired"])
+
+	err = client1.Disconnect()
+	assert.NoError(t, err)
+
+	ret := backend.Close(5 * time.Second)
+	assert.True(t, ret)
+
+	close(quit)
+
+	safeReceive(done)
+}
+
+func TestMemoryBackendAlerts(t *testing.T) {
+	type change struct {
+		value  float64
+		active bool
+	}
+
+	changes := make(chan change, 10)
+
+	backend := NewMemoryBackend()
+	backend.SysInterval = 10 * time.Millisecond
+	backend.Alerts = []Alert{{Metric: "clients/connected", Threshold: 2}}
+	backend.PublishAlerts = true
+	backend.AlertCallback = func(alert Alert, value float64, active bool) {
+		assert.Equal(t, "clients/connected", alert.Metric)
+		changes <- change{value: value, active: active}
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	received := make(chan *packet.Message, 10)
+
+	client1 := client.New()
+	client1.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		received <- msg
+		return nil
+	}
+
+	cf, err := client1.Connect(client.NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	sf, err := client1.Subscribe("$SYS/alerts/#", 0)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(10*time.Second))
+
+	client2 := client.New()
+
+	cf, err = client2.Connect(client.NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	assert.Equal(t, change{value: 2, active: true}, <-changes)
+
+	msg := <-received
+	assert.Equal(t, "$SYS/alerts/clients/connected", msg.Topic)
+	assert.Equal(t, []byte("2.00"), msg.Payload)
+
+	err = client2.Disconnect()
+	assert.NoError(t, err)
+
+	assert.Equal(t, change{value: 1, active: false}, <-changes)
+
+	msg = <-received
+	assert.Equal(t, "$SYS/alerts/clients/connected", msg.Topic)
+	assert.Empty(t, msg.Payload)
+
+	err = client1.Disconnect()
+	assert.NoError(t, err)
+
+	ret := backend.Close(5 * time.Second)
+	assert.True(t, ret)
+
+	close(quit)
+
+	safeReceive(done)
+}
@@ -0,0 +1,149 @@
+package broker
+
+import (
+	"sync"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// TenantStats contains the usage of a tenant. Only publish packets are counted
+// as messages and bytes.
+type TenantStats struct {
+	// The number of messages received from and sent to clients of the tenant.
+	MessagesReceived int64
+	MessagesSent     int64
+
+	// The size of the messages received from and sent to clients of the
+	// tenant.
+	BytesReceived int64
+	BytesSent     int64
+}
+
+// A TenantQuota limits the messages and bytes that clients of a tenant may
+// publish. Zero values are not limited.
+type TenantQuota struct {
+	MessagesReceived int64
+	BytesReceived    int64
+}
+
+func (q TenantQuota) exceeded(stats TenantStats) bool {
+	return (q.MessagesReceived > 0 && stats.MessagesReceived > q.MessagesReceived) ||
+		(q.BytesReceived > 0 && stats.BytesReceived > q.BytesReceived)
+}
+
+type tenantStats struct {
+	stats   map[string]*TenantStats
+	clients map[*Client]string
+	active  map[string]int
+	mutex   sync.Mutex
+}
+
+func newTenantStats() *tenantStats {
+	return &tenantStats{
+		stats:   make(map[string]*TenantStats),
+		clients: make(map[*Client]string),
+		active:  make(map[string]int),
+	}
+}
+
+func (s *tenantStats) add(client *Client, tenant string) {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// check client
+	if _, ok := s.clients[client]; ok {
+		return
+	}
+
+	// add client
+	s.clients[client] = tenant
+	s.active[tenant]++
+}
+
+func (s *tenantStats) remove(client *Client) {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// get tenant
+	tenant, ok := s.clients[client]
+	if !ok {
+		return
+	}
+
+	// remove client
+	delete(s.clients, client)
+	s.active[tenant]--
+
+	// remove tenant if it was the last client
+	if s.active[tenant] <= 0 {
+		delete(s.active, tenant)
+		delete(s.stats, tenant)
+	}
+}
+
+func (s *tenantStats) count(tenant string, event LogEvent, pkt packet.Generic) {
+	// check if publish
+	if _, ok := pkt.(*packet.Publish); !ok {
+		return
+	}
+
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// ignore tenants without clients
+	if s.active[tenant] == 0 {
+		return
+	}
+
+	// get stats
+	stats, ok := s.stats[tenant]
+	if !ok {
+		stats = &TenantStats{}
+		s.stats[tenant] = stats
+	}
+
+	switch event {
+	case PacketReceived:
+		stats.MessagesReceived++
+		stats.BytesReceived += int64(pkt.Len())
+	case PacketSent:
+		stats.MessagesSent++
+		stats.BytesSent += int64(pkt.Len())
+	}
+}
+
+func (s *tenantStats) get(tenant string) TenantStats {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// get stats
+	stats, ok := s.stats[tenant]
+	if !ok {
+		return TenantStats{}
+	}
+
+	return *stats
+}
+
+func (s *tenantStats) snapshot(reset bool) map[string]TenantStats {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// copy stats
+	snapshot := make(map[string]TenantStats, len(s.stats))
+	for tenant, stats := range s.stats {
+		snapshot[tenant] = *stats
+	}
+
+	// reset stats if requested
+	if reset {
+		s.stats = make(map[string]*TenantStats)
+	}
+
+	return snapshot
+}
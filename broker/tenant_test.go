@@ -0,0 +1,175 @@
+package broker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBackendTenantQuota(t *testing.T) {
+	exceeded := make(chan struct{}, 10)
+	lost := make(chan struct{}, 10)
+
+	backend := NewMemoryBackend()
+	backend.TenantQuotas = map[string]TenantQuota{
+		"foo": {MessagesReceived: 2},
+	}
+	backend.Logger = func(event LogEvent, _ *Client, _ packet.Generic, _ *packet.Message, _ error) {
+		if event == QuotaExceeded {
+			exceeded <- struct{}{}
+		} else if event == LostConnection {
+			lost <- struct{}{}
+		}
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	// keeps the tenant alive
+	client2 := client.New()
+
+	cf, err := client2.Connect(client.NewConfig("tcp://foo@localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	received := make(chan *packet.Message, 10)
+
+	client1 := client.New()
+	client1.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		received <- msg
+		return nil
+	}
+
+	cf, err = client1.Connect(client.NewConfig("tcp://foo@localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	sf, err := client1.Subscribe("test", 0)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(10*time.Second))
+
+	for i := 0; i < 3; i++ {
+		pf, err := client1.Publish("test", []byte("test"), 1, false)
+		assert.NoError(t, err)
+		assert.NoError(t, pf.Wait(10*time.Second))
+	}
+
+	<-exceeded
+	<-received
+	<-received
+
+	err = client1.Disconnect()
+	assert.NoError(t, err)
+
+	<-lost
+
+	assert.Len(t, received, 0)
+
+	stats := backend.TenantStats()
+	assert.Equal(t, int64(3), stats["foo"].MessagesReceived)
+	assert.Equal(t, int64(2), stats["foo"].MessagesSent)
+	assert.Equal(t, int64(3*14), stats["foo"].BytesReceived)
+	assert.Equal(t, int64(2*12), stats["foo"].BytesSent)
+
+	stats = backend.ResetTenantStats()
+	assert.Len(t, stats, 1)
+	assert.Empty(t, backend.TenantStats())
+
+	pf, err := client2.Publish("test", []byte("test"), 0, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(10*time.Second))
+
+	err = client2.Disconnect()
+	assert.NoError(t, err)
+
+	<-lost
+
+	assert.Empty(t, backend.TenantStats())
+	assert.Empty(t, backend.tenants.active)
+	assert.Empty(t, backend.tenants.clients)
+
+	backend.Close(5 * time.Second)
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestMemoryBackendTenant(t *testing.T) {
+	disconnected := make(chan map[string]TenantStats, 1)
+
+	backend := NewMemoryBackend()
+	backend.Tenant = func(client *Client) string {
+		return "bar"
+	}
+	backend.Logger = func(event LogEvent, _ *Client, _ packet.Generic, _ *packet.Message, _ error) {
+		if event == ClientDisconnected {
+			disconnected <- backend.TenantStats()
+		}
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	client1 := client.New()
+
+	cf, err := client1.Connect(client.NewConfig("tcp://foo@localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	pf, err := client1.Publish("test", []byte("test"), 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(10*time.Second))
+
+	err = client1.Disconnect()
+	assert.NoError(t, err)
+
+	stats := <-disconnected
+	assert.Equal(t, int64(1), stats["bar"].MessagesReceived)
+	assert.Equal(t, int64(0), stats["foo"].MessagesReceived)
+
+	backend.Close(5 * time.Second)
+
+	assert.Empty(t, backend.TenantStats())
+
+	close(quit)
+	safeReceive(done)
+}
+
+func TestMemoryBackendTenantDisabled(t *testing.T) {
+	disconnected := make(chan map[string]TenantStats, 1)
+
+	backend := NewMemoryBackend()
+	backend.Logger = func(event LogEvent, _ *Client, _ packet.Generic, _ *packet.Message, _ error) {
+		if event == ClientDisconnected {
+			disconnected <- backend.TenantStats()
+		}
+	}
+
+	port, quit, done := Run(NewEngine(backend), "tcp")
+
+	client1 := client.New()
+
+	cf, err := client1.Connect(client.NewConfig("tcp://foo@localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	pf, err := client1.Publish("test", []byte("test"), 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(10*time.Second))
+
+	err = client1.Disconnect()
+	assert.NoError(t, err)
+
+	assert.Empty(t, <-disconnected)
+
+	backend.Close(5 * time.Second)
+
+	assert.Empty(t, backend.tenants.clients)
+	assert.Equal(t, int64(0), backend.stats.counters()["messages/received"])
+
+	close(quit)
+	safeReceive(done)
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+)
+
+// sinkBroker accepts a single connection and acknowledges all packets
+// without routing messages.
+func sinkBroker(b *testing.B) string {
+	server, err := transport.Launch("tcp://localhost:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	go func() {
+		defer server.Close()
+
+		conn, err := server.Accept()
+		if err != nil {
+			return
+		}
+
+		for {
+			pkt, err := conn.Receive()
+			if err != nil {
+				return
+			}
+
+			var ack packet.Generic
+			switch p := pkt.(type) {
+			case *packet.Connect:
+				ack = packet.NewConnack()
+			case *packet.Publish:
+				if p.Message.QOS == 1 {
+					puback := packet.NewPuback()
+					puback.ID = p.ID
+					ack = puback
+				}
+			case *packet.Disconnect:
+				_ = conn.Close()
+				return
+			}
+
+			if ack != nil {
+				err = conn.Send(ack, false)
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(server.Addr().String())
+
+	return "tcp://localhost:" + port
+}
+
+func benchmarkClientPublish(b *testing.B, qos packet.QOS) {
+	c := New()
+
+	// flush writes immediately to measure the client instead of the delay
+	dialer := transport.NewDialer()
+	dialer.MaxWriteDelay = time.Microsecond
+
+	config := NewConfig(sinkBroker(b))
+	config.Dialer = dialer
+
+	connectFuture, err := c.Connect(config)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	err = connectFuture.Wait(time.Second)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	payload := []byte("test")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		publishFuture, err := c.Publish("test", payload, qos, false)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if qos > 0 {
+			err = publishFuture.Wait(time.Second)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.StopTimer()
+
+	err = c.Disconnect()
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkClientPublishQOS0(b *testing.B) {
+	benchmarkClientPublish(b, 0)
+}
+
+func BenchmarkClientPublishQOS1(b *testing.B) {
+	benchmarkClientPublish(b, 1)
+}
@@ -0,0 +1,145 @@
+package client
+
+import (
+	"sync"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// the default capacity of subscription channels
+const defaultChannelCapacity = 100
+
+type subscriptionChannel struct {
+	ch      chan *packet.Message
+	filters map[string]bool
+	done    chan struct{}
+	closed  bool
+	mutex   sync.Mutex
+}
+
+func (c *subscriptionChannel) send(msg *packet.Message, cancel <-chan struct{}) bool {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// check if closed
+	if c.closed {
+		return true
+	}
+
+	select {
+	case c.ch <- msg:
+		return true
+	case <-c.done:
+		return true
+	case <-cancel:
+		return false
+	}
+}
+
+func (c *subscriptionChannel) close() {
+	// release blocked sender
+	close(c.done)
+
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// close channel
+	c.closed = true
+	close(c.ch)
+}
+
+type channelRegistry struct {
+	tree   *topic.Tree
+	closed bool
+	mutex  sync.Mutex
+}
+
+func newChannelRegistry() *channelRegistry {
+	return &channelRegistry{
+		tree: topic.NewTree(),
+	}
+}
+
+func (r *channelRegistry) register(filters []string, capacity int) <-chan *packet.Message {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// prepare channel
+	sc := &subscriptionChannel{
+		ch:      make(chan *packet.Message, capacity),
+		filters: make(map[string]bool),
+		done:    make(chan struct{}),
+	}
+
+	// return closed channel if registry is closed
+	if r.closed {
+		sc.close()
+		return sc.ch
+	}
+
+	// add filters
+	for _, filter := range filters {
+		sc.filters[filter] = true
+		r.tree.Add(filter, sc)
+	}
+
+	return sc.ch
+}
+
+func (r *channelRegistry) deliver(msg *packet.Message, cancel <-chan struct{}) bool {
+	// send message to all matching channels
+	for _, value := range r.tree.Match(msg.Topic) {
+		if !value.(*subscriptionChannel).send(msg, cancel) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *channelRegistry) unregister(filters []string) {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, filter := range filters {
+		// get and remove channels
+		values := r.tree.Get(filter)
+		r.tree.Empty(filter)
+
+		// close channels without remaining filters
+		for _, value := range values {
+			sc := value.(*subscriptionChannel)
+			delete(sc.filters, filter)
+			if len(sc.filters) == 0 {
+				sc.close()
+			}
+		}
+	}
+}
+
+func (r *channelRegistry) close(final bool) {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// close all channels
+	closed := make(map[*subscriptionChannel]bool)
+	for _, value := range r.tree.All() {
+		sc := value.(*subscriptionChannel)
+		if !closed[sc] {
+			closed[sc] = true
+			sc.close()
+		}
+	}
+
+	// reset tree
+	r.tree.Reset()
+
+	// set flag
+	r.closed = final
+}
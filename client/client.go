@@ -3,16 +3,20 @@
 package client
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/url"
+	"runtime"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/256dpi/gomqtt/client/future"
+	"github.com/256dpi/gomqtt/logging"
 	"github.com/256dpi/gomqtt/packet"
 	"github.com/256dpi/gomqtt/session"
+	"github.com/256dpi/gomqtt/tools"
 	"github.com/256dpi/gomqtt/transport"
 
 	"gopkg.in/tomb.v2"
@@ -31,9 +35,27 @@ var ErrClientNotConnected = errors.New("client not connected")
 var ErrClientMissingID = errors.New("client missing id")
 
 // ErrClientConnectionDenied is returned in the Callback if the connection has
-// been reject by the broker.
+// been reject by the broker. It is wrapped by a ConnackError that carries the
+// return code.
 var ErrClientConnectionDenied = errors.New("client connection denied")
 
+// A ConnackError is returned in the Callback if the connection has been
+// rejected by the broker. It unwraps to ErrClientConnectionDenied.
+type ConnackError struct {
+	// The return code of the Connack packet.
+	ReturnCode packet.ConnackCode
+}
+
+// Error implements the error interface.
+func (e *ConnackError) Error() string {
+	return fmt.Sprintf("client connection denied: %s", e.ReturnCode.String())
+}
+
+// Unwrap returns ErrClientConnectionDenied.
+func (e *ConnackError) Unwrap() error {
+	return ErrClientConnectionDenied
+}
+
 // ErrClientMissingPong is returned in the Callback if the broker did not respond
 // in time to a Pingreq.
 var ErrClientMissingPong = errors.New("client missing pong")
@@ -46,6 +68,10 @@ var ErrClientExpectedConnack = errors.New("client expected connack")
 // failed when Config.ValidateSubs must be set to true.
 var ErrFailedSubscription = errors.New("failed subscription")
 
+// ErrPacketTooLarge is returned by Publish if the packet would exceed the
+// maximum packet size of the broker.
+var ErrPacketTooLarge = errors.New("packet too large")
+
 // A Callback is a function called by the client upon received messages or
 // internal errors. An error can be returned if the callback is not already
 // called with an error to instantly close the client and prevent it from
@@ -56,6 +82,15 @@ var ErrFailedSubscription = errors.New("failed subscription")
 // callback will deadlock the client.
 type Callback func(msg *packet.Message, err error) error
 
+// the interval in which the client checks for system suspensions
+const suspendCheckInterval = time.Second
+
+// the minimum clock difference that is considered a system suspension
+const suspendThreshold = 2 * time.Second
+
+// the default time to wait for a pong after a system suspension
+const defaultResumeTimeout = 5 * time.Second
+
 // A Logger is a function called by the client to log activity.
 type Logger func(msg string)
 
@@ -119,16 +154,32 @@ type Client struct {
 	// automatic keep alive handler.
 	Logger Logger
 
+	// The event logger that receives structured packet level and lifecycle
+	// events.
+	EventLogger logging.Logger
+
+	// The interceptors that are called with every sent and received packet.
+	Interceptors []transport.Interceptor
+
 	clean bool
 
 	keepAlive     time.Duration
 	tracker       *Tracker
+	trace         *ClientTrace
+	sendQuota     *session.Quota
 	futureStore   *future.Store
 	connectFuture *future.Future
-
-	tomb   tomb.Tomb
-	mutex  sync.Mutex
-	finish sync.Once
+	channels      *channelRegistry
+	loopback      *loopback
+	requests      *requestRegistry
+	workers       *tools.Dispatcher
+	stopped       bool
+	resent        sync.Map
+
+	tomb      tomb.Tomb
+	mutex     sync.Mutex
+	loopMutex sync.Mutex
+	finish    sync.Once
 }
 
 // New returns a new client that by default uses a fresh MemorySession.
@@ -137,6 +188,9 @@ func New() *Client {
 		state:       clientInitialized,
 		Session:     session.NewMemorySession(),
 		futureStore: future.NewStore(),
+		channels:    newChannelRegistry(),
+		loopback:    newLoopback(),
+		requests:    newRequestRegistry(),
 	}
 }
 
@@ -180,19 +234,68 @@ func (c *Client) Connect(config *Config) (ConnectFuture, error) {
 	c.keepAlive = keepAlive
 	c.tracker = NewTracker(keepAlive)
 
+	// prepare send quota
+	if config.SendQuota > 0 {
+		c.sendQuota = session.NewQuota(config.SendQuota)
+	}
+
+	// prepare callback workers, a single worker is used to pass looped back
+	// and received messages to the callback from the same goroutine
+	if config.Dispatch != DispatchSerial {
+		workers := config.CallbackWorkers
+		if workers <= 0 {
+			workers = runtime.NumCPU()
+		}
+		c.workers = tools.NewDispatcher(workers, workers)
+	} else if config.Loopback {
+		c.workers = tools.NewDispatcher(1, 1)
+	}
+
+	// forget expected echoes
+	c.loopback.reset()
+
+	// get context and trace
+	ctx := config.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	c.trace = configTrace(config)
+
 	// dial broker (with custom dialer if present)
-	if config.Dialer != nil {
+	if dialer, ok := config.Dialer.(ContextDialer); ok {
+		c.conn, err = dialer.DialContext(ctx, config.BrokerURL)
+		if err != nil {
+			return nil, err
+		}
+	} else if config.Dialer != nil {
 		c.conn, err = config.Dialer.Dial(config.BrokerURL)
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		c.conn, err = transport.Dial(config.BrokerURL)
+		c.conn, err = transport.DialContext(ctx, config.BrokerURL)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	c.trace.gotConn(c.conn)
+
+	// install interceptors
+	c.conn = transport.Intercept(c.conn, c.Interceptors...)
+
+	// set read limit
+	if config.MaxPacketSize > 0 {
+		c.conn.SetReadLimit(config.MaxPacketSize)
+	}
+
+	// set write delay
+	if config.MaxWriteDelay > 0 {
+		if bc, ok := transport.Buffered(c.conn); ok {
+			bc.SetMaxWriteDelay(config.MaxWriteDelay)
+		}
+	}
+
 	// set to connecting as from this point the client cannot be reused
 	atomic.StoreUint32(&c.state, clientConnecting)
 
@@ -222,6 +325,15 @@ func (c *Client) Connect(config *Config) (ConnectFuture, error) {
 		connect.Password, _ = urlParts.User.Password()
 	}
 
+	// append affinity token
+	if config.AffinityToken != "" {
+		separator := config.AffinitySeparator
+		if separator == "" {
+			separator = "#"
+		}
+		connect.Username += separator + config.AffinityToken
+	}
+
 	// set will
 	connect.Will = config.WillMessage
 
@@ -259,8 +371,40 @@ func (c *Client) Publish(topic string, payload []byte, qos packet.QOS, retain bo
 
 // PublishMessage will send a Publish containing the passed message. It will
 // return a PublishFuture that gets completed once the quality of service flow
-// has been completed.
+// has been completed. If the message has been sent but could not be looped
+// back, the future is returned together with the error.
 func (c *Client) PublishMessage(msg *packet.Message) (GenericFuture, error) {
+	// acquire send quota
+	quota := msg.QOS > 0 && atomic.LoadUint32(&c.state) == clientConnected && c.sendQuota != nil
+	if quota {
+		err := c.sendQuota.Acquire(c.tomb.Dying(), 0)
+		if err != nil {
+			return nil, ErrClientNotConnected
+		}
+	}
+
+	// publish message
+	publishFuture, err := c.publish(msg)
+	if err != nil {
+		if quota {
+			c.sendQuota.Release()
+		}
+
+		return nil, err
+	}
+
+	// loop back message if enabled
+	if c.config.Loopback {
+		err = c.loop(msg)
+		if err != nil {
+			return publishFuture, err
+		}
+	}
+
+	return publishFuture, nil
+}
+
+func (c *Client) publish(msg *packet.Message) (GenericFuture, error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
@@ -273,6 +417,11 @@ func (c *Client) PublishMessage(msg *packet.Message) (GenericFuture, error) {
 	publish := packet.NewPublish()
 	publish.Message = *msg
 
+	// check packet size
+	if c.config.BrokerMaxPacketSize > 0 && int64(publish.Len()) > c.config.BrokerMaxPacketSize {
+		return nil, ErrPacketTooLarge
+	}
+
 	// set packet id
 	if msg.QOS > 0 {
 		publish.ID = c.Session.NextID()
@@ -307,6 +456,44 @@ func (c *Client) PublishMessage(msg *packet.Message) (GenericFuture, error) {
 	return publishFuture, nil
 }
 
+// sends a publish packet that has already been saved in the session
+func (c *Client) resend(publish *packet.Publish) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// check if connected
+	if atomic.LoadUint32(&c.state) != clientConnected {
+		return ErrClientNotConnected
+	}
+
+	// skip packets that have been resent after connecting
+	if _, ok := c.resent.Load(publish.ID); ok {
+		c.resent.Delete(publish.ID)
+		return nil
+	}
+
+	// skip packets that have already been acknowledged
+	pkt, err := c.Session.LookupPacket(session.Outgoing, publish.ID)
+	if err != nil {
+		return err
+	} else if _, ok := pkt.(*packet.Publish); !ok {
+		return nil
+	}
+
+	// consume a send token (will be replaced once the flow is complete)
+	if c.sendQuota != nil {
+		c.sendQuota.TryAcquire()
+	}
+
+	// send packet
+	err = c.send(publish, true)
+	if err != nil {
+		return c.cleanup(err, false, false)
+	}
+
+	return nil
+}
+
 // Subscribe will send a Subscribe packet containing one topic to subscribe. It
 // will return a SubscribeFuture that gets completed once a Suback packet has
 // been received.
@@ -336,6 +523,12 @@ func (c *Client) SubscribeMultiple(subscriptions []packet.Subscription) (Subscri
 	// create future
 	subFuture := future.New()
 
+	// store subscriptions for loopback
+	if c.config.Loopback {
+		subFuture.Data.Store(subscriptionsKey, subscriptions)
+		c.loopback.subscribe(subscriptions)
+	}
+
 	// store future
 	c.futureStore.Put(subscribe.ID, subFuture)
 
@@ -346,7 +539,7 @@ func (c *Client) SubscribeMultiple(subscriptions []packet.Subscription) (Subscri
 	}
 
 	// wrap future
-	wrappedFuture := &subscribeFuture{subFuture}
+	wrappedFuture := newSubscribeFuture(subFuture, c.channels, subscriptions)
 
 	return wrappedFuture, nil
 }
@@ -370,6 +563,12 @@ func (c *Client) UnsubscribeMultiple(topics []string) (GenericFuture, error) {
 		return nil, ErrClientNotConnected
 	}
 
+	// close channels
+	c.channels.unregister(topics)
+
+	// remove loopback subscriptions
+	c.loopback.unsubscribe(topics)
+
 	// allocate unsubscribe packet
 	unsubscribe := packet.NewUnsubscribe()
 	unsubscribe.Topics = topics
@@ -418,6 +617,33 @@ func (c *Client) Disconnect(timeout ...time.Duration) error {
 	return c.end(err, true)
 }
 
+// Flush will immediately write all packets that have been buffered by the
+// connection to the broker. Packets are otherwise flushed after the configured
+// MaxWriteDelay, which allows coalescing high-rate publishes into few writes.
+func (c *Client) Flush() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// check if connected
+	if atomic.LoadUint32(&c.state) != clientConnected {
+		return ErrClientNotConnected
+	}
+
+	// get buffered connection
+	bc, ok := transport.Buffered(c.conn)
+	if !ok {
+		return nil
+	}
+
+	// flush connection
+	err := bc.Flush()
+	if err != nil {
+		return c.cleanup(err, false, false)
+	}
+
+	return nil
+}
+
 // Close closes the client immediately without sending a Disconnect packet and
 // waiting for outgoing transmissions to finish.
 func (c *Client) Close() error {
@@ -438,6 +664,21 @@ func (c *Client) Close() error {
 func (c *Client) processor() error {
 	first := true
 
+	// close channels on exit
+	defer c.channels.close(true)
+
+	// stop callback workers before channels are closed
+	if c.workers != nil {
+		defer func() {
+			// prevent further loopbacks
+			c.loopMutex.Lock()
+			c.stopped = true
+			c.loopMutex.Unlock()
+
+			c.workers.Close()
+		}()
+	}
+
 	// start keep alive if greater than zero
 	if c.keepAlive > 0 {
 		c.tomb.Go(c.pinger)
@@ -460,6 +701,10 @@ func (c *Client) processor() error {
 		if c.Logger != nil {
 			c.Logger(fmt.Sprintf("Received: %s", pkt.String()))
 		}
+		c.log(logging.Debug, "packet received", logging.F("packet", pkt.Type().String()))
+
+		// trace acknowledgements
+		c.trace.gotAck(pkt)
 
 		if first {
 			// get connack
@@ -519,30 +764,46 @@ func (c *Client) processConnack(connack *packet.Connack) error {
 
 	// return connection denied error and close connection if not accepted
 	if connack.ReturnCode != packet.ConnectionAccepted {
-		err := c.die(ErrClientConnectionDenied, true, false)
+		c.log(logging.Error, "connection denied", logging.F("return_code", connack.ReturnCode.String()))
+		err := c.die(&ConnackError{ReturnCode: connack.ReturnCode}, true, false)
 		c.connectFuture.Cancel()
 		return err
 	}
 
-	// set state to connected
+	// set state to connected and retrieve stored packets, the mutex ensures
+	// that stored packets are either resent here or by resend
+	c.mutex.Lock()
 	atomic.StoreUint32(&c.state, clientConnected)
+	packets, err := c.Session.AllPackets(session.Outgoing)
+	for _, pkt := range packets {
+		if id, ok := packet.GetID(pkt); ok {
+			c.resent.Store(id, true)
+		}
+	}
+	c.mutex.Unlock()
+
+	c.log(logging.Info, "connected", logging.F("session_present", connack.SessionPresent))
 
 	// complete future
 	c.connectFuture.Complete()
 
-	// retrieve stored packets
-	packets, err := c.Session.AllPackets(session.Outgoing)
+	// check error
 	if err != nil {
 		return c.die(err, true, false)
 	}
 
 	// resend stored packets
 	for _, pkt := range packets {
+		// consume a send token (will be replaced once the flow is complete)
+		if c.sendQuota != nil {
+			c.sendQuota.TryAcquire()
+		}
+
 		// check for publish packets
 		publish, ok := pkt.(*packet.Publish)
 		if ok {
-			// set the dup flag on a publish packet
-			publish.Dup = true
+			// mark publish packet as retransmission
+			publish.MarkRetransmission()
 		}
 
 		// resend packet
@@ -572,6 +833,18 @@ func (c *Client) processSuback(suback *packet.Suback) error {
 	// remove future from store
 	c.futureStore.Delete(suback.ID)
 
+	// store return codes
+	subscribeFuture.Data.Store(returnCodesKey, suback.ReturnCodes)
+
+	// remove failed loopback subscriptions
+	if v, ok := subscribeFuture.Data.Load(subscriptionsKey); ok {
+		for i, sub := range v.([]packet.Subscription) {
+			if i < len(suback.ReturnCodes) && suback.ReturnCodes[i] == packet.QOSFailure {
+				c.loopback.unsubscribe([]string{sub.Topic})
+			}
+		}
+	}
+
 	// validate subscriptions if requested
 	if c.config.ValidateSubs {
 		for _, code := range suback.ReturnCodes {
@@ -583,7 +856,6 @@ func (c *Client) processSuback(suback *packet.Suback) error {
 	}
 
 	// complete future
-	subscribeFuture.Data.Store(returnCodesKey, suback.ReturnCodes)
 	subscribeFuture.Complete()
 
 	return nil
@@ -614,13 +886,12 @@ func (c *Client) processUnsuback(unsuback *packet.Unsuback) error {
 
 // handle an incoming Publish packet
 func (c *Client) processPublish(publish *packet.Publish) error {
-	// call callback for unacknowledged and directly acknowledged messages
-	if publish.Message.QOS <= 1 {
-		if c.Callback != nil {
-			err := c.Callback(&publish.Message, nil)
-			if err != nil {
-				return c.die(err, true, true)
-			}
+	// deliver unacknowledged and directly acknowledged messages unless they
+	// have already been looped back or are responses
+	if publish.Message.QOS <= 1 && !c.loopback.echoed(&publish.Message) && !c.requests.resolve(&publish.Message) {
+		err := c.deliver(&publish.Message)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -667,6 +938,14 @@ func (c *Client) processPubackAndPubcomp(id packet.ID) error {
 		return err
 	}
 
+	// put back send token
+	if c.sendQuota != nil {
+		c.sendQuota.Release()
+	}
+
+	// forget resent packet
+	c.resent.Delete(id)
+
 	// get future
 	publishFuture := c.futureStore.Get(id)
 	if publishFuture == nil {
@@ -717,11 +996,11 @@ func (c *Client) processPubrel(id packet.ID) error {
 		return nil // ignore a wrongly sent Pubrel packet
 	}
 
-	// call callback
-	if c.Callback != nil {
-		err = c.Callback(&publish.Message, nil)
+	// deliver message unless it has already been looped back or is a response
+	if !c.loopback.echoed(&publish.Message) && !c.requests.resolve(&publish.Message) {
+		err = c.deliver(&publish.Message)
 		if err != nil {
-			return c.die(err, true, true)
+			return err
 		}
 	}
 
@@ -744,6 +1023,57 @@ func (c *Client) processPubrel(id packet.ID) error {
 	return nil
 }
 
+// delivers a message to the callback and channels, the delivery is queued on
+// the callback workers if enabled while acknowledgements are still sent by the
+// processor in the order the messages have been received
+func (c *Client) deliver(msg *packet.Message) error {
+	// deliver directly if workers are disabled
+	if c.workers == nil {
+		return c.handle(msg)
+	}
+
+	// prepare job
+	job := func() {
+		// skip if the client is going away
+		select {
+		case <-c.tomb.Dying():
+			return
+		default:
+		}
+
+		// errors have already been handled by closing the connection, which
+		// will stop the processor
+		_ = c.handle(msg)
+	}
+
+	// queue job
+	if c.config.Dispatch == DispatchConcurrent {
+		c.workers.Submit(job)
+	} else {
+		c.workers.Dispatch(msg.Topic, job)
+	}
+
+	return nil
+}
+
+// calls the callback and delivers the message to channels
+func (c *Client) handle(msg *packet.Message) error {
+	// call callback
+	if c.Callback != nil {
+		err := c.Callback(msg, nil)
+		if err != nil {
+			return c.die(err, true, true)
+		}
+	}
+
+	// deliver message to channels
+	if !c.channels.deliver(msg, c.tomb.Dying()) {
+		return tomb.ErrDying
+	}
+
+	return nil
+}
+
 /* pinger goroutine */
 
 // manages the sending of ping packets to keep the connection alive
@@ -772,19 +1102,96 @@ func (c *Client) pinger() error {
 			if c.Logger != nil {
 				c.Logger(fmt.Sprintf("Delay KeepAlive by %s", window.String()))
 			}
+			c.log(logging.Debug, "keep alive delayed", logging.F("window", window))
+		}
+
+		// wait for the window to pass or the system to resume
+		resumed, err := c.sleep(window)
+		if err != nil {
+			return err
+		}
+
+		// verify the connection after a system suspension
+		if resumed {
+			// send pingreq packet if none is pending
+			if !c.tracker.Pending() {
+				err = c.send(packet.NewPingreq(), true)
+				if err != nil {
+					return c.die(err, false, false)
+				}
+
+				// save ping attempt
+				c.tracker.Ping()
+			}
+
+			// require pong within the resume timeout
+			resumeTimeout := c.config.ResumeTimeout
+			if resumeTimeout <= 0 {
+				resumeTimeout = defaultResumeTimeout
+			}
+			c.tracker.Verify(resumeTimeout)
 		}
+	}
+}
 
+// waits for the specified duration and returns early if the system resumed
+// from a suspension
+func (c *Client) sleep(d time.Duration) (bool, error) {
+	// prepare timer
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	// prepare ticker
+	ticker := time.NewTicker(suspendCheckInterval)
+	defer ticker.Stop()
+
+	for {
 		select {
 		case <-c.tomb.Dying():
-			return tomb.ErrDying
-		case <-time.After(window):
-			continue
+			return false, tomb.ErrDying
+		case <-timer.C:
+			return false, nil
+		case <-ticker.C:
+			// check for suspension
+			suspended := c.tracker.Suspended()
+			if suspended < suspendThreshold {
+				continue
+			}
+
+			// log resume
+			if c.Logger != nil {
+				c.Logger(fmt.Sprintf("Resumed after %s", suspended.String()))
+			}
+			c.log(logging.Info, "system resumed", logging.F("suspended", suspended))
+
+			return true, nil
 		}
 	}
 }
 
 /* helpers */
 
+// delivers a published message to the own matching subscriptions
+func (c *Client) loop(msg *packet.Message) error {
+	// match message
+	lm := c.loopback.match(msg, c.config.DropEchoes)
+	if lm == nil {
+		return nil
+	}
+
+	// acquire mutex
+	c.loopMutex.Lock()
+	defer c.loopMutex.Unlock()
+
+	// check workers
+	if c.stopped {
+		return ErrClientNotConnected
+	}
+
+	// queue delivery on the callback workers
+	return c.deliver(lm)
+}
+
 // sends packet and updates lastSend
 func (c *Client) send(pkt packet.Generic, async bool) error {
 	// reset keep alive tracker
@@ -792,6 +1199,7 @@ func (c *Client) send(pkt packet.Generic, async bool) error {
 
 	// send packet
 	err := c.conn.Send(pkt, async)
+	c.trace.wrotePacket(pkt, err)
 	if err != nil {
 		return err
 	}
@@ -800,10 +1208,18 @@ func (c *Client) send(pkt packet.Generic, async bool) error {
 	if c.Logger != nil {
 		c.Logger(fmt.Sprintf("Sent: %s", pkt.String()))
 	}
+	c.log(logging.Debug, "packet sent", logging.F("packet", pkt.Type().String()))
 
 	return nil
 }
 
+// logs a structured event if an event logger is set
+func (c *Client) log(level logging.Level, event string, fields ...logging.Field) {
+	if c.EventLogger != nil {
+		c.EventLogger.Log(level, event, fields...)
+	}
+}
+
 // will try to cleanup as many resources as possible
 func (c *Client) cleanup(err error, doClose bool, possiblyClosed bool) error {
 	// cancel connect future if appropriate
@@ -832,6 +1248,7 @@ func (c *Client) cleanup(err error, doClose bool, possiblyClosed bool) error {
 
 	// cancel all futures
 	c.futureStore.Clear()
+	c.requests.clear()
 
 	return err
 }
@@ -840,6 +1257,7 @@ func (c *Client) cleanup(err error, doClose bool, possiblyClosed bool) error {
 func (c *Client) die(err error, close bool, fromCallback bool) error {
 	c.finish.Do(func() {
 		err = c.cleanup(err, close, false)
+		c.log(logging.Error, "connection lost", logging.F("error", err))
 
 		if c.Callback != nil && !fromCallback {
 			returnedErr := c.Callback(nil, err)
@@ -856,6 +1274,7 @@ func (c *Client) die(err error, close bool, fromCallback bool) error {
 func (c *Client) end(err error, possiblyClosed bool) error {
 	// close connection
 	err = c.cleanup(err, true, true)
+	c.log(logging.Info, "disconnected")
 
 	// shutdown goroutines
 	c.tomb.Kill(nil)
@@ -1,10 +1,12 @@
 package client
 
 import (
+	"context"
 	"time"
 
 	"github.com/256dpi/gomqtt/packet"
 	"github.com/256dpi/gomqtt/transport"
+	"github.com/256dpi/gomqtt/transport/psk"
 )
 
 // Dialer defines the dialer used by a client.
@@ -12,11 +14,21 @@ type Dialer interface {
 	Dial(urlString string) (transport.Conn, error)
 }
 
+// ContextDialer is an optional interface that is used by the client if the
+// dialer also supports dialing with a context.
+type ContextDialer interface {
+	DialContext(ctx context.Context, urlString string) (transport.Conn, error)
+}
+
 // A Config holds information about establishing a connection to a broker.
 type Config struct {
 	// Dialer can be set to use a custom dialer.
 	Dialer Dialer
 
+	// Context can be set to cancel dialing and to attach a ClientTrace
+	// using WithClientTrace.
+	Context context.Context
+
 	// BrokerURL is the url that is used to infer options to open the connection.
 	BrokerURL string
 
@@ -36,10 +48,100 @@ type Config struct {
 	ValidateSubs bool
 
 	// MaxWriteDelay defines the maximum allowed delay when flushing the
-	// underlying buffered writer.
+	// underlying buffered writer. A larger delay coalesces more packets into
+	// one write. Client.Flush can be used to flush buffered packets earlier.
+	//
+	// Will default to the delay of the dialer.
 	MaxWriteDelay time.Duration
+
+	// Loopback will deliver messages published by the client directly to its
+	// own matching subscriptions without a broker round trip. Looped back
+	// messages are queued and passed to the callback and channels by the
+	// callback workers. If Dispatch is DispatchSerial, a single worker is used
+	// to pass looped back and received messages to the callback from the same
+	// goroutine. Publishing from the callback blocks while the queue of the
+	// worker that handles the looped back message is full.
+	Loopback bool
+
+	// DropEchoes will drop messages received from the broker that have
+	// already been delivered by the loopback. MQTT 3.1.1 brokers forward
+	// messages to the publishing client if it has a matching subscription,
+	// which would otherwise result in duplicates. Echoes are identified by
+	// topic and payload.
+	DropEchoes bool
+
+	// SendQuota limits the number of unacknowledged QOS 1 and 2 messages the
+	// client publishes at once. Publishing blocks until a previous message
+	// flow has been completed if the quota is exhausted. MQTT 3.1.1 brokers do
+	// not announce how many messages they are willing to receive, so it should
+	// be configured to match the broker's limit. Defaults to unlimited if zero.
+	SendQuota int
+
+	// MaxPacketSize limits the size of packets the client accepts from the
+	// broker. The connection is closed if a larger packet is received.
+	// Defaults to unlimited if zero.
+	MaxPacketSize int64
+
+	// BrokerMaxPacketSize is the size of the largest packet the broker
+	// accepts. Publish returns ErrPacketTooLarge for larger messages instead
+	// of sending them and having the broker close the connection. MQTT 3.1.1
+	// brokers do not announce this limit, so it must be configured to match
+	// the broker's limit. Defaults to unlimited if zero.
+	BrokerMaxPacketSize int64
+
+	// ResponseTopic is the topic on which responses to requests are received.
+	// Defaults to "responses/" followed by a random id if empty.
+	ResponseTopic string
+
+	// ResumeTimeout defines how long the client waits for a pong after the
+	// system resumed from a suspension before the connection is considered
+	// stale and closed. Defaults to 5 seconds if zero. Suspensions are only
+	// detected if keep alive is enabled.
+	ResumeTimeout time.Duration
+
+	// Dispatch defines how received messages are passed to the callback and
+	// channels. By default, messages are processed serially by the receiving
+	// goroutine, which means that slow callbacks delay the processing of
+	// other packets, including keep alive responses. Acknowledgements are
+	// always sent by the receiving goroutine in the order the messages have
+	// been received. With the other modes or if Loopback is enabled they may
+	// therefore be sent before the callback has processed the message.
+	Dispatch DispatchMode
+
+	// CallbackWorkers is the number of workers used to process messages if
+	// Dispatch is not DispatchSerial. Defaults to the number of CPUs if zero.
+	CallbackWorkers int
+
+	// AffinityToken is appended to the username of the connect packet to
+	// allow load balancers in front of clustered brokers to route reconnects
+	// to the instance that holds the persistent session. MQTT 3.1.1 has no
+	// user properties, so the username is the only field that load balancers
+	// and brokers can inspect besides the client id.
+	AffinityToken string
+
+	// AffinitySeparator separates the username and the affinity token.
+	// Defaults to "#" if empty.
+	AffinitySeparator string
 }
 
+// A DispatchMode defines how received messages are passed to the callback.
+type DispatchMode int
+
+const (
+	// DispatchSerial processes messages in the receiving goroutine in the
+	// order they have been received from the broker.
+	DispatchSerial DispatchMode = iota
+
+	// DispatchPerTopic processes messages concurrently using a pool of
+	// workers. Messages with the same topic are still processed in the order
+	// they have been received.
+	DispatchPerTopic
+
+	// DispatchConcurrent processes messages concurrently using a pool of
+	// workers without any ordering.
+	DispatchConcurrent
+)
+
 // NewConfig creates a new Config using the specified URL.
 func NewConfig(url string) *Config {
 	return &Config{
@@ -56,3 +158,18 @@ func NewConfigWithClientID(url, id string) *Config {
 	config.ClientID = id
 	return config
 }
+
+// NewConfigWithPSK creates a new Config using the specified URL and a dialer
+// that authenticates "tls" and "mqtts" connections with the pre-shared key of
+// the specified identity instead of certificates.
+func NewConfigWithPSK(url, identity string, key []byte) *Config {
+	// prepare dialer
+	dialer := transport.NewDialer()
+	dialer.PSKConfig = psk.ClientConfig(identity, key)
+
+	// prepare config
+	config := NewConfig(url)
+	config.Dialer = dialer
+
+	return config
+}
@@ -0,0 +1,107 @@
+//go:build !gomqtt_lite
+// +build !gomqtt_lite
+
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/client/future"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/session"
+	"github.com/256dpi/gomqtt/transport/flow"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientFileSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomqtt")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	connect := connectPacket()
+	connect.ClientID = "test"
+	connect.CleanSession = false
+
+	connack := connackPacket()
+	connack.SessionPresent = true
+
+	publish1 := packet.NewPublish()
+	publish1.Message.Topic = "test"
+	publish1.Message.Payload = []byte("test")
+	publish1.Message.QOS = 1
+	publish1.ID = 1
+
+	publish2 := packet.NewPublish()
+	publish2.Message = publish1.Message
+	publish2.Dup = true
+	publish2.ID = 1
+
+	puback := packet.NewPuback()
+	puback.ID = 1
+
+	broker1 := flow.New().
+		Receive(connect).
+		Send(connackPacket()).
+		Receive(publish1).
+		Close()
+
+	broker2 := flow.New().
+		Receive(connect).
+		Send(connack).
+		Receive(publish2).
+		Send(puback).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker1, broker2)
+
+	config := NewConfigWithClientID("tcp://localhost:"+port, "test")
+	config.CleanSession = false
+
+	fs, err := session.NewFileSession(dir)
+	assert.NoError(t, err)
+
+	c := New()
+	c.Session = fs
+
+	connectFuture, err := c.Connect(config)
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+
+	publishFuture, err := c.Publish("test", []byte("test"), 1, false)
+	assert.NoError(t, err)
+	assert.Equal(t, future.ErrCanceled, publishFuture.Wait(1*time.Second))
+
+	fs, err = session.NewFileSession(dir)
+	assert.NoError(t, err)
+
+	c = New()
+	c.Session = fs
+
+	connectFuture, err = c.Connect(config)
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+	assert.True(t, connectFuture.SessionPresent())
+
+	for i := 0; i < 100; i++ {
+		list, err := fs.AllPackets(session.Outgoing)
+		assert.NoError(t, err)
+		if len(list) == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	list, err := fs.AllPackets(session.Outgoing)
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
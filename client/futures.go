@@ -1,6 +1,7 @@
 package client
 
 import (
+	"sync"
 	"time"
 
 	"github.com/256dpi/gomqtt/client/future"
@@ -17,7 +18,8 @@ type GenericFuture interface {
 	Wait(timeout time.Duration) error
 }
 
-// A ConnectFuture is returned by the connect method.
+// A ConnectFuture is returned by the connect method. Wait returns a
+// ConnackError with the return code if the broker denied the connection.
 type ConnectFuture interface {
 	GenericFuture
 
@@ -28,12 +30,32 @@ type ConnectFuture interface {
 	ReturnCode() packet.ConnackCode
 }
 
+// A ResponseFuture is returned by the request method.
+type ResponseFuture interface {
+	GenericFuture
+
+	// Response will return the received response with the envelope removed
+	// from the payload.
+	Response() *packet.Message
+}
+
 // A SubscribeFuture is returned by the subscribe methods.
 type SubscribeFuture interface {
 	GenericFuture
 
 	// ReturnCodes will return the suback codes returned by the broker.
 	ReturnCodes() []packet.QOS
+
+	// Channel will return a channel that receives all incoming messages that
+	// match the subscribed topics. The optional capacity defaults to 100.
+	// Subsequent calls return the same channel. Messages are delivered in
+	// addition to the callback and the client blocks while the channel is
+	// full. The channel is closed once all topics have been unsubscribed or
+	// the client is closed.
+	//
+	// Note: Channel should be called before waiting on the future to not miss
+	// any retained messages.
+	Channel(capacity ...int) <-chan *packet.Message
 }
 
 type futureKey int
@@ -42,12 +64,29 @@ const (
 	sessionPresentKey futureKey = iota
 	returnCodeKey
 	returnCodesKey
+	subscriptionsKey
+	responseKey
 )
 
 type connectFuture struct {
 	*future.Future
 }
 
+func (f *connectFuture) Wait(timeout time.Duration) error {
+	// wait for future
+	err := f.Future.Wait(timeout)
+	if err != future.ErrCanceled {
+		return err
+	}
+
+	// return connack error if the connection has been denied
+	if code := f.ReturnCode(); code != packet.ConnectionAccepted {
+		return &ConnackError{ReturnCode: code}
+	}
+
+	return err
+}
+
 func (f *connectFuture) SessionPresent() bool {
 	v, ok := f.Data.Load(sessionPresentKey)
 	if !ok {
@@ -66,8 +105,40 @@ func (f *connectFuture) ReturnCode() packet.ConnackCode {
 	return v.(packet.ConnackCode)
 }
 
+type responseFuture struct {
+	*future.Future
+}
+
+func (f *responseFuture) Response() *packet.Message {
+	v, ok := f.Data.Load(responseKey)
+	if !ok {
+		return nil
+	}
+
+	return v.(*packet.Message)
+}
+
 type subscribeFuture struct {
 	*future.Future
+
+	channels *channelRegistry
+	filters  []string
+	channel  <-chan *packet.Message
+	once     sync.Once
+}
+
+func newSubscribeFuture(f *future.Future, channels *channelRegistry, subscriptions []packet.Subscription) *subscribeFuture {
+	// collect filters
+	filters := make([]string, 0, len(subscriptions))
+	for _, sub := range subscriptions {
+		filters = append(filters, sub.Topic)
+	}
+
+	return &subscribeFuture{
+		Future:   f,
+		channels: channels,
+		filters:  filters,
+	}
 }
 
 func (f *subscribeFuture) ReturnCodes() []packet.QOS {
@@ -78,3 +149,18 @@ func (f *subscribeFuture) ReturnCodes() []packet.QOS {
 
 	return v.([]packet.QOS)
 }
+
+func (f *subscribeFuture) Channel(capacity ...int) <-chan *packet.Message {
+	f.once.Do(func() {
+		// get capacity
+		c := defaultChannelCapacity
+		if len(capacity) > 0 {
+			c = capacity[0]
+		}
+
+		// register channel
+		f.channel = f.channels.register(f.filters, c)
+	})
+
+	return f.channel
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/topic"
+)
+
+// the time after which an expected echo is forgotten if the broker did not
+// forward the message back, e.g. because it has been denied or lost
+const loopbackEchoTimeout = 30 * time.Second
+
+type loopback struct {
+	subscriptions *topic.Tree
+	echoes        map[uint64][]time.Time
+	swept         time.Time
+	mutex         sync.Mutex
+}
+
+func newLoopback() *loopback {
+	return &loopback{
+		subscriptions: topic.NewTree(),
+		echoes:        make(map[uint64][]time.Time),
+		swept:         time.Now(),
+	}
+}
+
+func (l *loopback) reset() {
+	// acquire mutex
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// forget expected echoes
+	l.echoes = make(map[uint64][]time.Time)
+}
+
+func (l *loopback) subscribe(subs []packet.Subscription) {
+	for _, sub := range subs {
+		sub := sub
+		l.subscriptions.Set(sub.Topic, &sub)
+	}
+}
+
+func (l *loopback) unsubscribe(filters []string) {
+	for _, filter := range filters {
+		l.subscriptions.Empty(filter)
+	}
+}
+
+func (l *loopback) match(msg *packet.Message, expectEcho bool) *packet.Message {
+	// find subscription
+	value := l.subscriptions.MatchFirst(msg.Topic)
+	if value == nil {
+		return nil
+	}
+
+	// prepare message like the broker would deliver it
+	sub := value.(*packet.Subscription)
+	lm := msg.Copy()
+	lm.Retain = false
+	if lm.QOS > sub.QOS {
+		lm.QOS = sub.QOS
+	}
+
+	// expect echo from broker
+	if expectEcho {
+		l.expect(loopbackKey(lm), time.Now())
+	}
+
+	return lm
+}
+
+func (l *loopback) expect(key uint64, now time.Time) {
+	// acquire mutex
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// remove expired echoes
+	if now.Sub(l.swept) > loopbackEchoTimeout {
+		for key, deadlines := range l.echoes {
+			l.expire(key, deadlines, now)
+		}
+
+		l.swept = now
+	}
+
+	// add deadline
+	l.echoes[key] = append(l.echoes[key], now.Add(loopbackEchoTimeout))
+}
+
+func (l *loopback) echoed(msg *packet.Message) bool {
+	// acquire mutex
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// get pending echoes
+	key := loopbackKey(msg)
+	deadlines := l.expire(key, l.echoes[key], time.Now())
+	if len(deadlines) == 0 {
+		return false
+	}
+
+	// consume oldest echo
+	if len(deadlines) == 1 {
+		delete(l.echoes, key)
+	} else {
+		l.echoes[key] = deadlines[1:]
+	}
+
+	return true
+}
+
+// expire removes the expired deadlines of the key and returns the remaining
+// deadlines. The mutex must be held by the caller.
+func (l *loopback) expire(key uint64, deadlines []time.Time, now time.Time) []time.Time {
+	// skip expired deadlines
+	i := 0
+	for i < len(deadlines) && !now.Before(deadlines[i]) {
+		i++
+	}
+
+	// update entry
+	if i == len(deadlines) {
+		delete(l.echoes, key)
+		return nil
+	} else if i > 0 {
+		deadlines = deadlines[i:]
+		l.echoes[key] = deadlines
+	}
+
+	return deadlines
+}
+
+func loopbackKey(msg *packet.Message) uint64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(msg.Topic))
+	_, _ = hash.Write([]byte{0})
+	_, _ = hash.Write(msg.Payload)
+	return hash.Sum64()
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoopbackEchoExpiry(t *testing.T) {
+	l := newLoopback()
+	l.subscribe([]packet.Subscription{{Topic: "test"}})
+
+	msg := &packet.Message{Topic: "test", Payload: []byte("test")}
+	key := loopbackKey(msg)
+
+	// expired echoes are not dropped
+	l.expect(key, time.Now().Add(-2*loopbackEchoTimeout))
+	assert.False(t, l.echoed(msg))
+	assert.Empty(t, l.echoes)
+
+	// pending echoes are dropped once
+	assert.NotNil(t, l.match(msg, true))
+	assert.True(t, l.echoed(msg))
+	assert.False(t, l.echoed(msg))
+
+	// expired echoes are removed when new ones are added
+	l.expect(key, time.Now().Add(-2*loopbackEchoTimeout))
+	l.swept = time.Now().Add(-2 * loopbackEchoTimeout)
+	l.expect(loopbackKey(&packet.Message{Topic: "other"}), time.Now())
+	assert.Len(t, l.echoes, 1)
+
+	// reset forgets all echoes
+	assert.NotNil(t, l.match(msg, true))
+	l.reset()
+	assert.False(t, l.echoed(msg))
+}
@@ -0,0 +1,21 @@
+package client
+
+import "fmt"
+
+// A CallbackPanic is reported to the ErrorCallback of a service if one of its
+// callbacks panicked. The service recovers the panic and keeps the connection.
+type CallbackPanic struct {
+	// The name of the callback, e.g. "MessageCallback".
+	Callback string
+
+	// The value passed to panic.
+	Value interface{}
+
+	// The stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+// Error implements the error interface.
+func (p *CallbackPanic) Error() string {
+	return fmt.Sprintf("%s panicked: %v", p.Callback, p.Value)
+}
@@ -0,0 +1,81 @@
+package client
+
+import "sync"
+
+// A DisconnectReason describes why the service went offline.
+type DisconnectReason int
+
+const (
+	// DisconnectStopped is used if the service has been stopped by the
+	// application.
+	DisconnectStopped DisconnectReason = iota
+
+	// DisconnectFailback is used if the connection to the standby broker has
+	// been closed to return to the primary broker.
+	DisconnectFailback
+
+	// DisconnectMissingPong is used if the broker did not respond to a ping
+	// in time.
+	DisconnectMissingPong
+
+	// DisconnectCallbackError is used if the message callback returned an
+	// error.
+	DisconnectCallbackError
+
+	// DisconnectClientError is used if publishing, subscribing, unsubscribing
+	// or renewing subscriptions failed.
+	DisconnectClientError
+
+	// DisconnectConnectionLost is used if the connection has been closed by
+	// the broker or failed. MQTT 3.1.1 brokers close the connection without
+	// sending a Disconnect packet, so no reason code is available.
+	DisconnectConnectionLost
+)
+
+// String returns the reason as a string.
+func (r DisconnectReason) String() string {
+	switch r {
+	case DisconnectStopped:
+		return "stopped"
+	case DisconnectFailback:
+		return "failback"
+	case DisconnectMissingPong:
+		return "missing pong"
+	case DisconnectCallbackError:
+		return "callback error"
+	case DisconnectClientError:
+		return "client error"
+	case DisconnectConnectionLost:
+		return "connection lost"
+	}
+
+	return "unknown"
+}
+
+// Abnormal returns whether the disconnect has not been requested by the
+// application or the failback policy.
+func (r DisconnectReason) Abnormal() bool {
+	return r != DisconnectStopped && r != DisconnectFailback
+}
+
+// records the first failure of a connected client
+type failure struct {
+	reason DisconnectReason
+	err    error
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newFailure() *failure {
+	return &failure{
+		done: make(chan struct{}),
+	}
+}
+
+func (f *failure) report(reason DisconnectReason, err error) {
+	f.once.Do(func() {
+		f.reason = reason
+		f.err = err
+		close(f.done)
+	})
+}
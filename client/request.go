@@ -0,0 +1,311 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/client/future"
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// ErrInvalidRequest is returned by ParseRequest if the message does not
+// contain a valid request envelope.
+var ErrInvalidRequest = errors.New("invalid request")
+
+// the prefix of the default response topic
+const defaultResponsePrefix = "responses/"
+
+// A Request is a request received by a responder.
+//
+// MQTT 3.1.1 has no response topic and correlation data properties. Requests
+// and responses therefore carry them in an envelope that is prepended to the
+// payload: Every field is encoded with a two byte length prefix like strings
+// in MQTT packets. Requests contain the response topic and correlation data
+// and responses contain the correlation data followed by the actual payload.
+type Request struct {
+	// The request message with the envelope removed from the payload.
+	Message *packet.Message
+
+	// The topic on which the response is expected.
+	ResponseTopic string
+
+	// The data used to correlate the response with the request.
+	CorrelationData []byte
+}
+
+// ParseRequest will parse a request from the specified message.
+func ParseRequest(msg *packet.Message) (*Request, error) {
+	// unpack envelope
+	fields, body, ok := unpackEnvelope(msg.Payload, 2)
+	if !ok {
+		return nil, ErrInvalidRequest
+	}
+
+	// copy message
+	req := msg.Copy()
+	req.Payload = body
+
+	return &Request{
+		Message:         req,
+		ResponseTopic:   string(fields[0]),
+		CorrelationData: fields[1],
+	}, nil
+}
+
+// Responder returns a callback that handles incoming requests by publishing
+// the payload returned by the handler as the response. Messages that are not
+// valid requests are ignored.
+func Responder(c *Client, handler func(req *Request) []byte) Callback {
+	return func(msg *packet.Message, err error) error {
+		// return errors
+		if err != nil {
+			return err
+		}
+
+		// parse request
+		req, err := ParseRequest(msg)
+		if err != nil {
+			return nil
+		}
+
+		// publish response
+		_, err = c.Respond(req, handler(req))
+
+		return err
+	}
+}
+
+// Request will publish a request with the specified payload and return a
+// ResponseFuture that gets completed once the response has been received. The
+// future is canceled if no response has been received before the timeout.
+//
+// The first call subscribes to the response topic and waits for the
+// subscription to be acknowledged. It must therefore not be made from the
+// callback. Requests and responses are published with QOS 0.
+func (c *Client) Request(topic string, payload []byte, timeout time.Duration) (ResponseFuture, error) {
+	// ensure response subscription
+	responseTopic, err := c.subscribeResponses(timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// add request
+	correlation, requestFuture := c.requests.add()
+
+	// publish request
+	_, err = c.Publish(topic, packEnvelope(payload, []byte(responseTopic), correlation), 0, false)
+	if err != nil {
+		c.requests.remove(correlation)
+		return nil, err
+	}
+
+	// cancel request after timeout
+	time.AfterFunc(timeout, func() {
+		if c.requests.remove(correlation) {
+			requestFuture.Cancel()
+		}
+	})
+
+	return &responseFuture{requestFuture}, nil
+}
+
+// Respond will publish the specified payload as the response to the request.
+func (c *Client) Respond(req *Request, payload []byte) (GenericFuture, error) {
+	return c.Publish(req.ResponseTopic, packEnvelope(payload, req.CorrelationData), 0, false)
+}
+
+func (c *Client) subscribeResponses(timeout time.Duration) (string, error) {
+	// acquire subscribe mutex
+	c.requests.subscribeMutex.Lock()
+	defer c.requests.subscribeMutex.Unlock()
+
+	// check if already subscribed
+	if topic := c.requests.getTopic(); topic != "" {
+		return topic, nil
+	}
+
+	// get topic
+	topic := c.config.ResponseTopic
+	if topic == "" {
+		buf := make([]byte, 8)
+		_, err := rand.Read(buf)
+		if err != nil {
+			return "", err
+		}
+
+		topic = defaultResponsePrefix + hex.EncodeToString(buf)
+	}
+
+	// subscribe topic
+	subscribeFuture, err := c.Subscribe(topic, 0)
+	if err != nil {
+		return "", err
+	}
+
+	// wait for acknowledgment
+	err = subscribeFuture.Wait(timeout)
+	if err != nil {
+		return "", err
+	}
+
+	// check return code
+	if codes := subscribeFuture.ReturnCodes(); len(codes) != 1 || codes[0] == packet.QOSFailure {
+		return "", ErrFailedSubscription
+	}
+
+	// save topic
+	c.requests.setTopic(topic)
+
+	return topic, nil
+}
+
+type requestRegistry struct {
+	topic   string
+	counter uint64
+	pending map[string]*future.Future
+	mutex   sync.Mutex
+
+	subscribeMutex sync.Mutex
+}
+
+func newRequestRegistry() *requestRegistry {
+	return &requestRegistry{
+		pending: make(map[string]*future.Future),
+	}
+}
+
+func (r *requestRegistry) getTopic() string {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.topic
+}
+
+func (r *requestRegistry) setTopic(topic string) {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.topic = topic
+}
+
+func (r *requestRegistry) add() ([]byte, *future.Future) {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// prepare correlation
+	r.counter++
+	correlation := strconv.FormatUint(r.counter, 10)
+
+	// add future
+	f := future.New()
+	r.pending[correlation] = f
+
+	return []byte(correlation), f
+}
+
+func (r *requestRegistry) remove(correlation []byte) bool {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// remove future
+	_, ok := r.pending[string(correlation)]
+	delete(r.pending, string(correlation))
+
+	return ok
+}
+
+func (r *requestRegistry) resolve(msg *packet.Message) bool {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// check topic
+	if r.topic == "" || msg.Topic != r.topic {
+		return false
+	}
+
+	// unpack envelope
+	fields, body, ok := unpackEnvelope(msg.Payload, 1)
+	if !ok {
+		return true
+	}
+
+	// get future
+	f, ok := r.pending[string(fields[0])]
+	if !ok {
+		return true
+	}
+
+	// remove future
+	delete(r.pending, string(fields[0]))
+
+	// prepare response
+	res := msg.Copy()
+	res.Payload = body
+
+	// complete future
+	f.Data.Store(responseKey, res)
+	f.Complete()
+
+	return true
+}
+
+func (r *requestRegistry) clear() {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// cancel all futures
+	for correlation, f := range r.pending {
+		f.Cancel()
+		delete(r.pending, correlation)
+	}
+}
+
+func packEnvelope(payload []byte, fields ...[]byte) []byte {
+	// compute length
+	length := len(payload)
+	for _, field := range fields {
+		length += 2 + len(field)
+	}
+
+	// write fields
+	buf := make([]byte, 0, length)
+	for _, field := range fields {
+		buf = append(buf, byte(len(field)>>8), byte(len(field)))
+		buf = append(buf, field...)
+	}
+
+	return append(buf, payload...)
+}
+
+func unpackEnvelope(data []byte, n int) ([][]byte, []byte, bool) {
+	// read fields
+	fields := make([][]byte, n)
+	for i := range fields {
+		// read length
+		if len(data) < 2 {
+			return nil, nil, false
+		}
+		length := int(binary.BigEndian.Uint16(data))
+		data = data[2:]
+
+		// read field
+		if len(data) < length {
+			return nil, nil, false
+		}
+		fields[i] = data[:length]
+		data = data[length:]
+	}
+
+	return fields, data, true
+}
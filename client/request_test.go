@@ -0,0 +1,136 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/client/future"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport/flow"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRequest(t *testing.T) {
+	req, err := ParseRequest(&packet.Message{
+		Topic:   "test",
+		Payload: packEnvelope([]byte("ping"), []byte("responses/test"), []byte("1")),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "test", req.Message.Topic)
+	assert.Equal(t, []byte("ping"), req.Message.Payload)
+	assert.Equal(t, "responses/test", req.ResponseTopic)
+	assert.Equal(t, []byte("1"), req.CorrelationData)
+
+	req, err = ParseRequest(&packet.Message{
+		Topic:   "test",
+		Payload: []byte{0, 5, 'f', 'o'},
+	})
+	assert.Equal(t, ErrInvalidRequest, err)
+	assert.Nil(t, req)
+}
+
+func TestClientRequest(t *testing.T) {
+	subscribe := packet.NewSubscribe()
+	subscribe.Subscriptions = []packet.Subscription{{Topic: "responses/test"}}
+	subscribe.ID = 1
+
+	suback := packet.NewSuback()
+	suback.ReturnCodes = []packet.QOS{0}
+	suback.ID = 1
+
+	request1 := packet.NewPublish()
+	request1.Message.Topic = "test"
+	request1.Message.Payload = packEnvelope([]byte("ping"), []byte("responses/test"), []byte("1"))
+
+	response := packet.NewPublish()
+	response.Message.Topic = "responses/test"
+	response.Message.Payload = packEnvelope([]byte("pong"), []byte("1"))
+
+	request2 := packet.NewPublish()
+	request2.Message.Topic = "test"
+	request2.Message.Payload = packEnvelope([]byte("ping"), []byte("responses/test"), []byte("2"))
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(subscribe).
+		Send(suback).
+		Receive(request1).
+		Send(response).
+		Receive(request2).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	c := New()
+	c.Callback = func(msg *packet.Message, err error) error {
+		assert.Fail(t, "unexpected callback")
+		return nil
+	}
+
+	config := NewConfig("tcp://localhost:" + port)
+	config.ResponseTopic = "responses/test"
+
+	connectFuture, err := c.Connect(config)
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+
+	responseFuture, err := c.Request("test", []byte("ping"), time.Second)
+	assert.NoError(t, err)
+	assert.NoError(t, responseFuture.Wait(1*time.Second))
+	assert.Equal(t, "responses/test", responseFuture.Response().Topic)
+	assert.Equal(t, []byte("pong"), responseFuture.Response().Payload)
+
+	responseFuture, err = c.Request("test", []byte("ping"), 10*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, future.ErrCanceled, responseFuture.Wait(1*time.Second))
+	assert.Nil(t, responseFuture.Response())
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
+
+func TestResponder(t *testing.T) {
+	request := packet.NewPublish()
+	request.Message.Topic = "test"
+	request.Message.Payload = packEnvelope([]byte("ping"), []byte("responses/test"), []byte("1"))
+
+	response := packet.NewPublish()
+	response.Message.Topic = "responses/test"
+	response.Message.Payload = packEnvelope([]byte("ping-pong"), []byte("1"))
+
+	responded := make(chan struct{})
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Send(request).
+		Receive(response).
+		Run(func() {
+			close(responded)
+		}).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	c := New()
+	c.Callback = Responder(c, func(req *Request) []byte {
+		return append(req.Message.Payload, []byte("-pong")...)
+	})
+
+	connectFuture, err := c.Connect(NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+
+	safeReceive(responded)
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
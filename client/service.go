@@ -1,30 +1,62 @@
 package client
 
 import (
+	"errors"
 	"fmt"
+	"runtime/debug"
 	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/256dpi/gomqtt/client/future"
+	"github.com/256dpi/gomqtt/logging"
 	"github.com/256dpi/gomqtt/packet"
 	"github.com/256dpi/gomqtt/session"
+	"github.com/256dpi/gomqtt/tools"
 	"github.com/256dpi/gomqtt/topic"
+	"github.com/256dpi/gomqtt/transport"
 
-	"github.com/jpillora/backoff"
 	"gopkg.in/tomb.v2"
 )
 
+// ErrDurableQOS is returned by PublishDurable if the message has QOS 0.
+var ErrDurableQOS = errors.New("durable publish requires QOS 1 or 2")
+
+// ErrDurableCleanSession is returned by PublishDurable if the service has been
+// started with a config that requests a clean session.
+var ErrDurableCleanSession = errors.New("durable publish requires persistent session")
+
+// A SubscribeOption changes how the service handles a subscription.
+type SubscribeOption int
+
+const (
+	// SkipRetained will drop retained messages that are delivered because of
+	// the subscription. This emulates the retain handling "do not send" option
+	// of MQTT 5 on the client side for applications that are only interested
+	// in live messages. Brokers still send the retained messages, but they are
+	// acknowledged without calling the MessageCallback. A retained message is
+	// only dropped if all matching subscriptions skip retained messages.
+	SkipRetained SubscribeOption = iota + 1
+)
+
+type subscription struct {
+	packet.Subscription
+
+	skipRetained bool
+}
+
 type command struct {
 	publish     bool
 	subscribe   bool
 	unsubscribe bool
+	durable     bool
 
 	future        *future.Future
 	message       *packet.Message
 	subscriptions []packet.Subscription
 	topics        []string
+	stored        *packet.Publish
 }
 
 // An OnlineCallback is a function that is called when the service is connected.
@@ -35,7 +67,8 @@ type OnlineCallback func(resumed bool)
 
 // A MessageCallback is a function that is called when a message is received.
 // If an error is returned the underlying client will be prevented from
-// acknowledging the specified message and closes immediately.
+// acknowledging the specified message and closes immediately. If the callback
+// panics, the message is acknowledged but not delivered to channels.
 //
 // Note: Execution of the service is resumed after the callback returns. This
 // means that waiting on a future inside the callback will deadlock the service.
@@ -53,6 +86,21 @@ type ErrorCallback func(error)
 // means that waiting on a future inside the callback will deadlock the service.
 type OfflineCallback func()
 
+// A DisconnectCallback is a function that is called with the reason when the
+// service is disconnected. The error that caused the disconnect is provided
+// for abnormal reasons if available.
+//
+// Note: Execution of the service is resumed after the callback returns. This
+// means that waiting on a future inside the callback will deadlock the service.
+type DisconnectCallback func(reason DisconnectReason, err error)
+
+// A RevocationCallback is a function that is called when a previously granted
+// subscription is denied by the broker while being renewed.
+//
+// Note: Execution of the service is resumed after the callback returns. This
+// means that waiting on a future inside the callback will deadlock the service.
+type RevocationCallback func(topic string)
+
 const (
 	serviceStarted uint32 = iota
 	serviceStopped
@@ -61,6 +109,7 @@ const (
 // Service is an abstraction for Client that provides a stable interface to the
 // application, while it automatically connects and reconnects clients in the
 // background. Errors are not returned but emitted using the ErrorCallback.
+// Panics raised by callbacks are recovered and emitted as a CallbackPanic.
 // All methods return Futures that get completed once the acknowledgements are
 // received. Once the services is stopped all waiting futures get canceled.
 //
@@ -86,11 +135,24 @@ type Service struct {
 	// The callback that is used to notify that the service is offline.
 	OfflineCallback OfflineCallback
 
+	// The callback that is used to notify why the service is offline.
+	DisconnectCallback DisconnectCallback
+
+	// The callback that is used to notify that a subscription has been revoked.
+	RevocationCallback RevocationCallback
+
 	// The logger that is used to log write low level information like packets
 	// that have ben successfully sent and received, details about the
 	// automatic keep alive handler, reconnection and occurring errors.
 	Logger Logger
 
+	// The event logger that receives structured packet level and lifecycle
+	// events of the service and its clients.
+	EventLogger logging.Logger
+
+	// The interceptors that are called with every sent and received packet.
+	Interceptors []transport.Interceptor
+
 	// The minimum delay between reconnects.
 	//
 	// Note: The value must be changed before calling Start.
@@ -101,6 +163,13 @@ type Service struct {
 	// Note: The value must be changed before calling Start.
 	MaxReconnectDelay time.Duration
 
+	// Whether to defer the connection until the first command is queued or
+	// Connect is called. Useful for batch jobs and command line tools that may
+	// not need the connection at all.
+	//
+	// Note: The value must be changed before calling Start.
+	Lazy bool
+
 	// The allowed timeout until a connection attempt is canceled.
 	ConnectTimeout time.Duration
 
@@ -116,10 +185,46 @@ type Service struct {
 	// configured to request one.
 	ResubscribeAllSubscriptions bool
 
-	backoff       *backoff.Backoff
+	// The interval at which all subscriptions are renewed while connected.
+	// Renewals refresh the granted QOS levels and detect subscriptions that
+	// have been revoked, e.g. because of changed ACLs. Renewals are disabled if
+	// the interval is zero.
+	//
+	// Note: If the config requests to validate subscriptions, revoked
+	// subscriptions are reported before the connection is closed with an
+	// error.
+	//
+	// Note: Brokers resend retained messages for renewed subscriptions. The
+	// SkipRetained option can be used to drop them.
+	RenewInterval time.Duration
+
+	// The config of a standby broker the service fails over to if the primary
+	// broker becomes unavailable. A failover is performed without a reconnect
+	// delay if the standby broker has not been probed unsuccessfully.
+	//
+	// Note: The value must be changed before calling Start.
+	StandbyConfig *Config
+
+	// The interval at which the broker that is currently not in use is probed
+	// by dialing it while connected. Probing is disabled if the interval is
+	// zero.
+	ProbeInterval time.Duration
+
+	// The policy that defines when to return to the primary broker after a
+	// failover. Immediate failbacks require probing to be enabled.
+	FailbackPolicy FailbackPolicy
+
+	backoff       *tools.Backoff
 	subscriptions *topic.Tree
 	commandQueue  chan *command
 	futureStore   *future.Store
+	channels      *channelRegistry
+
+	grants      map[string]packet.QOS
+	grantsMutex sync.Mutex
+
+	standby    uint32
+	peerHealth int32
 
 	mutex sync.Mutex
 	tomb  *tomb.Tomb
@@ -144,13 +249,17 @@ func NewService(queueSize ...int) *Service {
 		ResubscribeTimeout:          5 * time.Second,
 		ResubscribeAllSubscriptions: true,
 		subscriptions:               topic.NewTree(),
+		grants:                      make(map[string]packet.QOS),
 		commandQueue:                make(chan *command, qs),
 		futureStore:                 future.NewStore(),
+		channels:                    newChannelRegistry(),
 	}
 }
 
 // Start will start the service with the specified configuration. From now on
 // the service will automatically reconnect on any error until Stop is called.
+// If the service is lazy, the connection is only established once the first
+// command is queued or Connect is called.
 func (s *Service) Start(config *Config) {
 	if config == nil {
 		panic("no config specified")
@@ -170,21 +279,36 @@ func (s *Service) Start(config *Config) {
 	// save config
 	s.config = config
 
+	// reset standby state
+	atomic.StoreUint32(&s.standby, 0)
+	atomic.StoreInt32(&s.peerHealth, peerUnknown)
+
 	// initialize backoff
-	s.backoff = &backoff.Backoff{
-		Min:    s.MinReconnectDelay,
-		Max:    s.MaxReconnectDelay,
-		Factor: 2,
-	}
+	s.backoff = tools.NewExponentialBackoff(s.MinReconnectDelay, s.MaxReconnectDelay)
 
 	// mark future store as protected
 	s.futureStore.Protect(true)
 
-	// create new tomb
-	s.tomb = new(tomb.Tomb)
+	// launch supervisor if not lazy or commands are already queued
+	if !s.Lazy || len(s.commandQueue) > 0 {
+		s.launch()
+	}
+}
 
-	// start supervisor
-	s.tomb.Go(s.supervisor)
+// Connect will establish the connection of a lazy service that has not yet
+// been connected. It does nothing if the service is not started or already
+// connecting.
+func (s *Service) Connect() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// return if service not started
+	if atomic.LoadUint32(&s.state) != serviceStarted {
+		return
+	}
+
+	// launch supervisor
+	s.launch()
 }
 
 // Publish will send a Publish packet containing the passed parameters. It will
@@ -208,6 +332,11 @@ func (s *Service) PublishMessage(msg *packet.Message) GenericFuture {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	// launch supervisor if deferred
+	if atomic.LoadUint32(&s.state) == serviceStarted {
+		s.launch()
+	}
+
 	// allocate future
 	f := future.New()
 
@@ -221,25 +350,97 @@ func (s *Service) PublishMessage(msg *packet.Message) GenericFuture {
 	return f
 }
 
+// PublishDurable will save a Publish packet containing the passed message in
+// the session before queueing it. Once the method returns, the message is
+// sent even if the process crashes, given that the session survives the
+// crash, e.g. a session.FileSession, and the config requests a persistent
+// session. Messages that have been saved before a crash are sent when the
+// service connects again, but without completing any future. The session
+// may be created using session.NewFileSessionWithCipher to encrypt them.
+//
+// Note: The message is sent at least once and may be sent again after a
+// reconnect. Only QOS 1 and 2 messages can be published durably.
+func (s *Service) PublishDurable(msg *packet.Message) (GenericFuture, error) {
+	// check qos
+	if msg.QOS == 0 {
+		return nil, ErrDurableQOS
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// check session
+	if s.config != nil && s.config.CleanSession {
+		return nil, ErrDurableCleanSession
+	}
+
+	// prepare publish packet
+	publish := packet.NewPublish()
+	publish.Message = *msg
+	publish.ID = s.Session.NextID()
+
+	// allocate and store future
+	f := future.New()
+	s.futureStore.Put(publish.ID, f)
+
+	// save packet
+	err := s.Session.SavePacket(session.Outgoing, publish)
+	if err != nil {
+		s.futureStore.Delete(publish.ID)
+		return nil, err
+	}
+
+	// launch supervisor if deferred
+	if atomic.LoadUint32(&s.state) == serviceStarted {
+		s.launch()
+	}
+
+	// queue a copy as the stored packet may be marked as a retransmission
+	stored := *publish
+	s.commandQueue <- &command{
+		durable: true,
+		future:  f,
+		stored:  &stored,
+	}
+
+	return f, nil
+}
+
 // Subscribe will send a Subscribe packet containing one topic to subscribe. It
 // will return a SubscribeFuture that gets completed once the acknowledgements
 // have been received.
-func (s *Service) Subscribe(topic string, qos packet.QOS) SubscribeFuture {
+func (s *Service) Subscribe(topic string, qos packet.QOS, opts ...SubscribeOption) SubscribeFuture {
 	return s.SubscribeMultiple([]packet.Subscription{
 		{Topic: topic, QOS: qos},
-	})
+	}, opts...)
 }
 
 // SubscribeMultiple will send a Subscribe packet containing multiple topics to
 // subscribe. It will return a SubscribeFuture that gets completed once the
-// acknowledgements have been received.
-func (s *Service) SubscribeMultiple(subscriptions []packet.Subscription) SubscribeFuture {
+// acknowledgements have been received. The options apply to all subscriptions.
+func (s *Service) SubscribeMultiple(subscriptions []packet.Subscription, opts ...SubscribeOption) SubscribeFuture {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	// check options
+	skipRetained := false
+	for _, opt := range opts {
+		if opt == SkipRetained {
+			skipRetained = true
+		}
+	}
+
 	// save subscription
 	for _, v := range subscriptions {
-		s.subscriptions.Set(v.Topic, v)
+		s.subscriptions.Set(v.Topic, subscription{
+			Subscription: v,
+			skipRetained: skipRetained,
+		})
+	}
+
+	// launch supervisor if deferred
+	if atomic.LoadUint32(&s.state) == serviceStarted {
+		s.launch()
 	}
 
 	// allocate future
@@ -252,7 +453,7 @@ func (s *Service) SubscribeMultiple(subscriptions []packet.Subscription) Subscri
 		subscriptions: subscriptions,
 	}
 
-	return &subscribeFuture{f}
+	return newSubscribeFuture(f, s.channels, subscriptions)
 }
 
 // Unsubscribe will send a Unsubscribe packet containing one topic to unsubscribe.
@@ -270,8 +471,19 @@ func (s *Service) UnsubscribeMultiple(topics []string) GenericFuture {
 	defer s.mutex.Unlock()
 
 	// remove subscription
+	s.grantsMutex.Lock()
 	for _, v := range topics {
 		s.subscriptions.Empty(v)
+		delete(s.grants, v)
+	}
+	s.grantsMutex.Unlock()
+
+	// close channels
+	s.channels.unregister(topics)
+
+	// launch supervisor if deferred
+	if atomic.LoadUint32(&s.state) == serviceStarted {
+		s.launch()
 	}
 
 	// allocate future
@@ -287,8 +499,9 @@ func (s *Service) UnsubscribeMultiple(topics []string) GenericFuture {
 	return f
 }
 
-// Stop will disconnect the client if online and cancel all futures if requested.
-// After the service is stopped in can be started again.
+// Stop will disconnect the client if online and cancel all futures and close
+// all subscription channels if requested. After the service is stopped in can
+// be started again.
 //
 // Note: You should clear the futures on the last stop before exiting to ensure
 // that all goroutines return that wait on futures.
@@ -301,32 +514,61 @@ func (s *Service) Stop(clearFutures bool) {
 		return
 	}
 
-	// kill and wait
-	s.tomb.Kill(nil)
-	s.tomb.Wait()
+	// kill and wait if launched
+	if s.tomb != nil {
+		s.tomb.Kill(nil)
+		s.tomb.Wait()
+		s.tomb = nil
+	}
 
-	// clear futures if requested
+	// clear futures and close channels if requested
 	if clearFutures {
 		s.futureStore.Protect(false)
 		s.futureStore.Clear()
+		s.channels.close(false)
 	}
 
 	// set state
 	atomic.StoreUint32(&s.state, serviceStopped)
 }
 
+// Standby returns whether the service uses the standby broker.
+func (s *Service) Standby() bool {
+	return atomic.LoadUint32(&s.standby) == 1
+}
+
+// starts the supervisor if not already running
+func (s *Service) launch() {
+	// check tomb
+	if s.tomb != nil {
+		return
+	}
+
+	// create new tomb
+	s.tomb = new(tomb.Tomb)
+
+	// start supervisor
+	s.tomb.Go(s.supervisor)
+}
+
 // the supervised reconnect loop
 func (s *Service) supervisor() error {
 	first := true
+	standby := s.Standby()
 
 	for {
+		// get config
+		config := s.activeConfig(standby)
+
 		if first {
 			// no delay on first attempt
 			first = false
 		} else {
 			// get backoff duration
 			d := s.backoff.Duration()
+			configTrace(config).reconnecting(d)
 			s.log(fmt.Sprintf("Delay Reconnect: %v", d))
+			s.logEvent(logging.Debug, "reconnect delayed", logging.F("delay", d))
 
 			// sleep but return on Stop
 			select {
@@ -337,69 +579,158 @@ func (s *Service) supervisor() error {
 		}
 
 		s.log("Next Reconnect")
+		s.logEvent(logging.Info, "reconnecting", logging.F("standby", standby))
 
-		// prepare the stop channel
-		fail := make(chan struct{})
+		// prepare the failure
+		fail := newFailure()
 
 		// try once to get a client
-		client, resumed := s.connect(fail)
+		client, resumed := s.connect(fail, config)
 		if client == nil {
+			// switch to the other broker and skip the delay if it is not
+			// known to be unavailable
+			if s.StandbyConfig != nil {
+				first = s.peerAvailable()
+				standby = s.failover(!standby, peerUnhealthy)
+			}
+
 			continue
 		}
 
 		// resubscribe
 		if s.ResubscribeAllSubscriptions {
-			if !s.resubscribe(client) {
+			if s.resubscribe(client) != nil {
 				continue
 			}
 		}
 
+		s.logEvent(logging.Info, "online", logging.F("resumed", resumed), logging.F("standby", standby))
+
 		// run callback
 		if s.OnlineCallback != nil {
-			s.OnlineCallback(resumed)
+			s.call("OnlineCallback", func() {
+				s.OnlineCallback(resumed)
+			})
+		}
+
+		// start prober
+		var failback chan struct{}
+		done := make(chan struct{})
+		if s.StandbyConfig != nil && s.ProbeInterval > 0 {
+			failback = make(chan struct{})
+			go s.probe(standby, done, failback)
 		}
 
 		// run dispatcher on client
-		dying := s.dispatcher(client, fail)
+		reason, err := s.dispatcher(client, fail, failback)
 
-		// run callback
+		// stop prober
+		close(done)
+
+		s.logEvent(logging.Info, "offline", logging.F("reason", reason.String()))
+
+		// run callbacks
 		if s.OfflineCallback != nil {
-			s.OfflineCallback()
+			s.call("OfflineCallback", s.OfflineCallback)
+		}
+		if s.DisconnectCallback != nil {
+			s.call("DisconnectCallback", func() {
+				s.DisconnectCallback(reason, err)
+			})
 		}
 
 		// return goroutine if dying
-		if dying {
+		if reason == DisconnectStopped {
 			return tomb.ErrDying
 		}
+
+		// check failback
+		if standby && failback != nil {
+			select {
+			case <-failback:
+				first = true
+				standby = s.failover(false, peerUnknown)
+				continue
+			default:
+			}
+		}
+
+		// return to primary broker after disconnect if requested
+		if standby && s.FailbackPolicy == FailbackOnDisconnect {
+			standby = s.failover(false, peerUnknown)
+		}
 	}
 }
 
+// switches the active broker and sets the health of the previous broker
+func (s *Service) failover(standby bool, health int32) bool {
+	// set state
+	if standby {
+		atomic.StoreUint32(&s.standby, 1)
+	} else {
+		atomic.StoreUint32(&s.standby, 0)
+	}
+	atomic.StoreInt32(&s.peerHealth, health)
+
+	s.log(fmt.Sprintf("Failover: standby=%t", standby))
+	s.logEvent(logging.Info, "failover", logging.F("standby", standby))
+
+	return standby
+}
+
 // will try to connect one client to the broker
-func (s *Service) connect(fail chan struct{}) (*Client, bool) {
+func (s *Service) connect(fail *failure, config *Config) (*Client, bool) {
 	// prepare new client
 	client := New()
 	client.Session = s.Session
 	client.Logger = s.Logger
+	client.EventLogger = s.EventLogger
+	client.Interceptors = s.Interceptors
 	client.futureStore = s.futureStore
 
 	// set callback
 	client.Callback = func(msg *packet.Message, err error) error {
 		if err != nil {
 			s.err("Client", err)
-			close(fail)
+
+			// report failure
+			if err == ErrClientMissingPong {
+				fail.report(DisconnectMissingPong, err)
+			} else {
+				fail.report(DisconnectConnectionLost, err)
+			}
+
+			return nil
+		}
+
+		// drop skipped retained messages
+		if msg.Retain && s.skipRetained(msg.Topic) {
 			return nil
 		}
 
 		// call the handler
 		if s.MessageCallback != nil {
-			return s.MessageCallback(msg)
+			ok := s.call("MessageCallback", func() {
+				err = s.MessageCallback(msg)
+			})
+			if !ok {
+				return nil
+			} else if err != nil {
+				fail.report(DisconnectCallbackError, err)
+				return err
+			}
+		}
+
+		// deliver message to channels
+		if !s.channels.deliver(msg, s.tomb.Dying()) {
+			return tomb.ErrDying
 		}
 
 		return nil
 	}
 
 	// attempt to connect
-	connectFuture, err := client.Connect(s.config)
+	connectFuture, err := client.Connect(config)
 	if err != nil {
 		s.err("Connect", err)
 		return nil, false
@@ -408,8 +739,8 @@ func (s *Service) connect(fail chan struct{}) (*Client, bool) {
 	// wait for connack
 	err = connectFuture.Wait(s.ConnectTimeout)
 
-	// check if future has been canceled
-	if err == future.ErrCanceled {
+	// check if future has been canceled or the connection has been denied
+	if err == future.ErrCanceled || errors.Is(err, ErrClientConnectionDenied) {
 		s.err("Connect", err)
 		return nil, false
 	}
@@ -425,17 +756,17 @@ func (s *Service) connect(fail chan struct{}) (*Client, bool) {
 	return client, connectFuture.SessionPresent()
 }
 
-func (s *Service) resubscribe(client *Client) bool {
+func (s *Service) resubscribe(client *Client) error {
 	// get all subscriptions and return if empty
 	items := s.subscriptions.All()
 	if len(items) == 0 {
-		return true
+		return nil
 	}
 
 	// prepare subscriptions
 	subs := make([]packet.Subscription, 0, len(items))
 	for _, v := range items {
-		subs = append(subs, v.(packet.Subscription))
+		subs = append(subs, v.(subscription).Subscription)
 	}
 
 	// sort subscriptions
@@ -447,16 +778,19 @@ func (s *Service) resubscribe(client *Client) bool {
 	subscribeFuture, err := client.SubscribeMultiple(subs)
 	if err != nil {
 		s.err("Resubscribe", err)
-		return false
+		return err
 	}
 
 	// wait for suback.
 	err = subscribeFuture.Wait(s.ResubscribeTimeout)
 
+	// update grants
+	s.grant(subs, subscribeFuture.ReturnCodes())
+
 	// check if future has been canceled
 	if err == future.ErrCanceled {
 		s.err("Resubscribe", err)
-		return false
+		return err
 	}
 
 	// check if future has timed out
@@ -464,14 +798,66 @@ func (s *Service) resubscribe(client *Client) bool {
 		client.Close()
 
 		s.err("Resubscribe", err)
-		return false
+		return err
 	}
 
-	return true
+	return nil
+}
+
+// saves the granted QOS levels and reports revoked subscriptions
+func (s *Service) grant(subs []packet.Subscription, returnCodes []packet.QOS) {
+	// check return codes
+	if len(returnCodes) != len(subs) {
+		return
+	}
+
+	// acquire mutex
+	s.grantsMutex.Lock()
+
+	// update grants
+	var revoked []string
+	for i, sub := range subs {
+		// skip removed subscriptions
+		if len(s.subscriptions.Get(sub.Topic)) == 0 {
+			continue
+		}
+
+		// check revocation
+		prev, ok := s.grants[sub.Topic]
+		if ok && prev != packet.QOSFailure && returnCodes[i] == packet.QOSFailure {
+			revoked = append(revoked, sub.Topic)
+		}
+
+		// save grant
+		s.grants[sub.Topic] = returnCodes[i]
+	}
+
+	// release mutex
+	s.grantsMutex.Unlock()
+
+	// report revoked subscriptions
+	for _, t := range revoked {
+		s.log(fmt.Sprintf("Subscription Revoked: %s", t))
+		s.logEvent(logging.Error, "subscription revoked", logging.F("topic", t))
+
+		if s.RevocationCallback != nil {
+			s.call("RevocationCallback", func() {
+				s.RevocationCallback(t)
+			})
+		}
+	}
 }
 
 // reads from the queues and calls the current client
-func (s *Service) dispatcher(client *Client, fail chan struct{}) bool {
+func (s *Service) dispatcher(client *Client, fail *failure, failback chan struct{}) (DisconnectReason, error) {
+	// prepare renewal
+	var renew <-chan time.Time
+	if s.RenewInterval > 0 {
+		ticker := time.NewTicker(s.RenewInterval)
+		defer ticker.Stop()
+		renew = ticker.C
+	}
+
 	for {
 		select {
 		case cmd := <-s.commandQueue:
@@ -485,12 +871,16 @@ func (s *Service) dispatcher(client *Client, fail chan struct{}) bool {
 					// cancel future
 					cmd.future.Cancel()
 
-					return false
+					return s.failed(fail, err)
 				}
 
-				// bind future in a own goroutine. the goroutine will be
-				// ultimately collected when the service is stopped
-				go cmd.future.Bind(f2.(*subscribeFuture).Future)
+				// bind future and update grants in a own goroutine. the
+				// goroutine will be ultimately collected when the service is
+				// stopped
+				go func(cmd *command, f2 *subscribeFuture) {
+					cmd.future.Bind(f2.Future)
+					s.grant(cmd.subscriptions, f2.ReturnCodes())
+				}(cmd, f2.(*subscribeFuture))
 			}
 
 			// handle unsubscribe command
@@ -502,7 +892,7 @@ func (s *Service) dispatcher(client *Client, fail chan struct{}) bool {
 					// cancel future
 					cmd.future.Cancel()
 
-					return false
+					return s.failed(fail, err)
 				}
 
 				// bind future in a own goroutine. the goroutine will be
@@ -519,13 +909,25 @@ func (s *Service) dispatcher(client *Client, fail chan struct{}) bool {
 					// cancel future
 					cmd.future.Cancel()
 
-					return false
+					return s.failed(fail, err)
 				}
 
 				// bind future in a own goroutine. the goroutine will be
 				// ultimately collected when the service is stopped
 				go cmd.future.Bind(f2.(*future.Future))
 			}
+
+			// handle durable publish command, the future is completed by
+			// the client and the packet is resent after reconnecting if
+			// sending fails
+			if cmd.durable {
+				err := client.resend(cmd.stored)
+				if err != nil {
+					s.err("Publish", err)
+
+					return s.failed(fail, err)
+				}
+			}
 		case <-s.tomb.Dying():
 			// disconnect client on Stop
 			err := client.Disconnect(s.DisconnectTimeout)
@@ -533,15 +935,72 @@ func (s *Service) dispatcher(client *Client, fail chan struct{}) bool {
 				s.err("Disconnect", err)
 			}
 
-			return true
-		case <-fail:
+			return DisconnectStopped, nil
+		case <-failback:
+			// disconnect client on failback
+			err := client.Disconnect(s.DisconnectTimeout)
+			if err != nil {
+				s.err("Disconnect", err)
+			}
+
+			return DisconnectFailback, nil
+		case <-renew:
+			// renew all subscriptions
+			err := s.resubscribe(client)
+			if err != nil {
+				return s.failed(fail, err)
+			}
+		case <-fail.done:
+			return fail.reason, fail.err
+		}
+	}
+}
+
+// returns the reported failure or a client error
+func (s *Service) failed(fail *failure, err error) (DisconnectReason, error) {
+	fail.report(DisconnectClientError, err)
+	return fail.reason, fail.err
+}
+
+// checks if all subscriptions matching the topic skip retained messages
+func (s *Service) skipRetained(topic string) bool {
+	// get matching subscriptions
+	values := s.subscriptions.Match(topic)
+	if len(values) == 0 {
+		return false
+	}
+
+	// check subscriptions
+	for _, value := range values {
+		if !value.(subscription).skipRetained {
 			return false
 		}
 	}
+
+	return true
+}
+
+// runs the callback and reports a panic, returns false if the callback panicked
+func (s *Service) call(name string, fn func()) (ok bool) {
+	defer func() {
+		if value := recover(); value != nil {
+			ok = false
+			s.err(name, &CallbackPanic{
+				Callback: name,
+				Value:    value,
+				Stack:    debug.Stack(),
+			})
+		}
+	}()
+
+	fn()
+
+	return true
 }
 
 func (s *Service) err(sys string, err error) {
 	s.log(fmt.Sprintf("%s Error: %s", sys, err.Error()))
+	s.logEvent(logging.Error, "service error", logging.F("operation", sys), logging.F("error", err))
 
 	if s.ErrorCallback != nil {
 		s.ErrorCallback(err)
@@ -553,3 +1012,9 @@ func (s *Service) log(str string) {
 		s.Logger(str)
 	}
 }
+
+func (s *Service) logEvent(level logging.Level, event string, fields ...logging.Field) {
+	if s.EventLogger != nil {
+		s.EventLogger.Log(level, event, fields...)
+	}
+}
@@ -1,10 +1,13 @@
 package client
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/session"
 	"github.com/256dpi/gomqtt/transport/flow"
 
 	"github.com/stretchr/testify/assert"
@@ -75,6 +78,205 @@ func TestServicePublishSubscribe(t *testing.T) {
 	safeReceive(done)
 }
 
+func TestServiceChannel(t *testing.T) {
+	subscribe := packet.NewSubscribe()
+	subscribe.Subscriptions = []packet.Subscription{{Topic: "test"}}
+	subscribe.ID = 1
+
+	suback := packet.NewSuback()
+	suback.ReturnCodes = []packet.QOS{0}
+	suback.ID = 1
+
+	publish := packet.NewPublish()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("test")
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(subscribe).
+		Send(suback).
+		Receive(publish).
+		Send(publish).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	online := make(chan struct{})
+
+	s := NewService()
+
+	s.OnlineCallback = func(bool) {
+		close(online)
+	}
+
+	s.Start(NewConfig("tcp://localhost:" + port))
+
+	safeReceive(online)
+
+	subscribeFuture := s.Subscribe("test", 0)
+	ch := subscribeFuture.Channel()
+	assert.NoError(t, subscribeFuture.Wait(1*time.Second))
+
+	assert.NoError(t, s.Publish("test", []byte("test"), 0, false).Wait(1*time.Second))
+
+	msg := <-ch
+	assert.Equal(t, "test", msg.Topic)
+	assert.Equal(t, []byte("test"), msg.Payload)
+
+	s.Stop(true)
+
+	_, ok := <-ch
+	assert.False(t, ok)
+
+	safeReceive(done)
+}
+
+func TestServiceSkipRetained(t *testing.T) {
+	subscribe := packet.NewSubscribe()
+	subscribe.Subscriptions = []packet.Subscription{{Topic: "test", QOS: 1}}
+	subscribe.ID = 1
+
+	suback := packet.NewSuback()
+	suback.ReturnCodes = []packet.QOS{1}
+	suback.ID = 1
+
+	retained := packet.NewPublish()
+	retained.Message.Topic = "test"
+	retained.Message.Payload = []byte("retained")
+	retained.Message.QOS = 1
+	retained.Message.Retain = true
+	retained.ID = 1
+
+	retainedAck := packet.NewPuback()
+	retainedAck.ID = 1
+
+	live := packet.NewPublish()
+	live.Message.Topic = "test"
+	live.Message.Payload = []byte("live")
+	live.Message.QOS = 1
+	live.ID = 2
+
+	liveAck := packet.NewPuback()
+	liveAck.ID = 2
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(subscribe).
+		Send(suback).
+		Send(retained).
+		Receive(retainedAck).
+		Send(live).
+		Receive(liveAck).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	online := make(chan struct{})
+	message := make(chan struct{})
+	offline := make(chan struct{})
+
+	s := NewService()
+
+	s.OnlineCallback = func(resumed bool) {
+		close(online)
+	}
+
+	s.OfflineCallback = func() {
+		close(offline)
+	}
+
+	s.MessageCallback = func(msg *packet.Message) error {
+		assert.Equal(t, "test", msg.Topic)
+		assert.Equal(t, []byte("live"), msg.Payload)
+		assert.False(t, msg.Retain)
+		close(message)
+		return nil
+	}
+
+	s.Start(NewConfig("tcp://localhost:" + port))
+
+	safeReceive(online)
+
+	assert.NoError(t, s.Subscribe("test", 1, SkipRetained).Wait(1*time.Second))
+
+	safeReceive(message)
+
+	s.Stop(true)
+
+	safeReceive(offline)
+	safeReceive(done)
+}
+
+func TestServiceRenewal(t *testing.T) {
+	subscribe1 := packet.NewSubscribe()
+	subscribe1.Subscriptions = []packet.Subscription{{Topic: "test"}}
+	subscribe1.ID = 1
+
+	suback1 := packet.NewSuback()
+	suback1.ReturnCodes = []packet.QOS{0}
+	suback1.ID = 1
+
+	subscribe2 := packet.NewSubscribe()
+	subscribe2.Subscriptions = []packet.Subscription{{Topic: "test"}}
+	subscribe2.ID = 2
+
+	suback2 := packet.NewSuback()
+	suback2.ReturnCodes = []packet.QOS{packet.QOSFailure}
+	suback2.ID = 2
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(subscribe1).
+		Send(suback1).
+		Receive(subscribe2).
+		Send(suback2).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	online := make(chan struct{})
+	revoked := make(chan struct{})
+	offline := make(chan struct{})
+
+	s := NewService()
+	s.RenewInterval = 100 * time.Millisecond
+
+	s.OnlineCallback = func(resumed bool) {
+		close(online)
+	}
+
+	s.RevocationCallback = func(topic string) {
+		assert.Equal(t, "test", topic)
+		close(revoked)
+	}
+
+	s.OfflineCallback = func() {
+		close(offline)
+	}
+
+	config := NewConfig("tcp://localhost:" + port)
+	config.ValidateSubs = false
+
+	s.Start(config)
+
+	safeReceive(online)
+
+	assert.NoError(t, s.Subscribe("test", 0).Wait(1*time.Second))
+
+	safeReceive(revoked)
+
+	s.Stop(true)
+
+	safeReceive(offline)
+	safeReceive(done)
+}
+
 func TestServiceCommandsInCallback(t *testing.T) {
 	subscribe := packet.NewSubscribe()
 	subscribe.Subscriptions = []packet.Subscription{{Topic: "test"}}
@@ -537,6 +739,335 @@ func TestServiceFutureSurvival(t *testing.T) {
 	safeReceive(done)
 }
 
+func TestServiceCorruptBroker(t *testing.T) {
+	connect := connectPacket()
+	connect.ClientID = "test"
+	connect.CleanSession = false
+
+	connack := connackPacket()
+	connack.SessionPresent = true
+
+	publish := packet.NewPublish()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("test")
+	publish.Message.QOS = 1
+	publish.Dup = true
+
+	puback := packet.NewPuback()
+	puback.ID = 1
+
+	broker1 := flow.New().
+		Receive(connect).
+		Send(connack).
+		Drop(1).
+		Delay(10 * time.Millisecond).
+		Corrupt().
+		End()
+
+	broker2 := flow.New().
+		Receive(connect).
+		Send(connack).
+		Receive(flow.Like(publish)).
+		Send(puback).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker1, broker2)
+
+	config := NewConfigWithClientID("tcp://localhost:"+port, "test")
+	config.CleanSession = false
+
+	s := NewService()
+
+	s.Start(config)
+
+	assert.NoError(t, s.Publish("test", []byte("test"), 1, false).Wait(5*time.Second))
+
+	s.Stop(true)
+
+	safeReceive(done)
+}
+
+func TestServiceDisconnectCallback(t *testing.T) {
+	publish := packet.NewPublish()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("test")
+
+	broker1 := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Close()
+
+	broker2 := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Send(publish).
+		End()
+
+	broker3 := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker1, broker2, broker3)
+
+	callbackErr := errors.New("foo")
+	online := make(chan struct{}, 3)
+	reasons := make(chan DisconnectReason, 3)
+
+	s := NewService()
+	s.MinReconnectDelay = 10 * time.Millisecond
+
+	s.OnlineCallback = func(resumed bool) {
+		online <- struct{}{}
+	}
+
+	s.MessageCallback = func(msg *packet.Message) error {
+		return callbackErr
+	}
+
+	s.DisconnectCallback = func(reason DisconnectReason, err error) {
+		switch reason {
+		case DisconnectConnectionLost:
+			assert.Error(t, err)
+		case DisconnectCallbackError:
+			assert.Equal(t, callbackErr, err)
+		case DisconnectStopped:
+			assert.NoError(t, err)
+		}
+
+		reasons <- reason
+	}
+
+	s.Start(NewConfig("tcp://localhost:" + port))
+
+	safeReceive(online)
+	assert.Equal(t, DisconnectConnectionLost, <-reasons)
+
+	safeReceive(online)
+	assert.Equal(t, DisconnectCallbackError, <-reasons)
+
+	safeReceive(online)
+
+	s.Stop(true)
+
+	assert.Equal(t, DisconnectStopped, <-reasons)
+	safeReceive(done)
+}
+
+func TestServiceCallbackPanic(t *testing.T) {
+	publish1 := packet.NewPublish()
+	publish1.ID = 1
+	publish1.Message.Topic = "test"
+	publish1.Message.Payload = []byte("panic")
+	publish1.Message.QOS = 1
+
+	puback1 := packet.NewPuback()
+	puback1.ID = 1
+
+	publish2 := packet.NewPublish()
+	publish2.Message.Topic = "test"
+	publish2.Message.Payload = []byte("test")
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Send(publish1).
+		Receive(puback1).
+		Send(publish2).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	online := make(chan struct{})
+	message := make(chan struct{})
+	offline := make(chan struct{})
+	panics := make(chan *CallbackPanic, 2)
+
+	s := NewService()
+
+	s.OnlineCallback = func(resumed bool) {
+		close(online)
+		panic("online")
+	}
+
+	s.MessageCallback = func(msg *packet.Message) error {
+		if string(msg.Payload) == "panic" {
+			panic("message")
+		}
+
+		close(message)
+		return nil
+	}
+
+	s.ErrorCallback = func(err error) {
+		panics <- err.(*CallbackPanic)
+	}
+
+	s.OfflineCallback = func() {
+		close(offline)
+	}
+
+	s.Start(NewConfig("tcp://localhost:" + port))
+
+	safeReceive(online)
+	safeReceive(message)
+
+	// callbacks run concurrently
+	values := map[string]interface{}{}
+	for i := 0; i < 2; i++ {
+		p := <-panics
+		assert.NotEmpty(t, p.Stack)
+		assert.Equal(t, fmt.Sprintf("%s panicked: %v", p.Callback, p.Value), p.Error())
+		values[p.Callback] = p.Value
+	}
+	assert.Equal(t, map[string]interface{}{
+		"OnlineCallback":  "online",
+		"MessageCallback": "message",
+	}, values)
+
+	s.Stop(true)
+
+	safeReceive(offline)
+	safeReceive(done)
+}
+
+func TestServiceConnectionDenied(t *testing.T) {
+	connack := connackPacket()
+	connack.ReturnCode = packet.ServerUnavailable
+
+	broker1 := flow.New().
+		Receive(connectPacket()).
+		Send(connack).
+		Close()
+
+	broker2 := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker1, broker2)
+
+	online := make(chan struct{})
+	errs := make(chan error, 10)
+
+	s := NewService()
+	s.MinReconnectDelay = 10 * time.Millisecond
+
+	s.OnlineCallback = func(resumed bool) {
+		close(online)
+	}
+
+	s.ErrorCallback = func(err error) {
+		errs <- err
+	}
+
+	s.Start(NewConfig("tcp://localhost:" + port))
+
+	safeReceive(online)
+
+	s.Stop(true)
+
+	safeReceive(done)
+
+	// the client reports the denial as well
+	var denied bool
+	for len(errs) > 0 {
+		if err, ok := (<-errs).(*ConnackError); ok {
+			assert.Equal(t, packet.ServerUnavailable, err.ReturnCode)
+			denied = true
+		}
+	}
+	assert.True(t, denied)
+}
+
+func TestServicePublishDurable(t *testing.T) {
+	connect := connectPacket()
+	connect.ClientID = "test"
+	connect.CleanSession = false
+
+	publish1 := packet.NewPublish()
+	publish1.ID = 1
+	publish1.Dup = true
+	publish1.Message = packet.Message{Topic: "test", Payload: []byte("1"), QOS: 1}
+
+	puback1 := packet.NewPuback()
+	puback1.ID = 1
+
+	publish2 := packet.NewPublish()
+	publish2.ID = 2
+	publish2.Message = packet.Message{Topic: "test", Payload: []byte("2"), QOS: 1}
+
+	puback2 := packet.NewPuback()
+	puback2.ID = 2
+
+	broker := flow.New().
+		Receive(connect).
+		Send(connackPacket()).
+		Receive(publish1).
+		Send(puback1).
+		Receive(publish2).
+		Send(puback2).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	config := NewConfigWithClientID("tcp://localhost:"+port, "test")
+	config.CleanSession = false
+
+	s := NewService()
+
+	_, err := s.PublishDurable(&packet.Message{Topic: "test"})
+	assert.Equal(t, ErrDurableQOS, err)
+
+	// saved while offline and resent after connecting
+	pf1, err := s.PublishDurable(&publish1.Message)
+	assert.NoError(t, err)
+
+	pkt, err := s.Session.LookupPacket(session.Outgoing, 1)
+	assert.NoError(t, err)
+	assert.NotNil(t, pkt)
+
+	s.Start(config)
+
+	assert.NoError(t, pf1.Wait(1*time.Second))
+
+	// sent immediately while online
+	pf2, err := s.PublishDurable(&publish2.Message)
+	assert.NoError(t, err)
+	assert.NoError(t, pf2.Wait(1*time.Second))
+
+	s.Stop(true)
+
+	safeReceive(done)
+
+	pkts, err := s.Session.AllPackets(session.Outgoing)
+	assert.NoError(t, err)
+	assert.Empty(t, pkts)
+
+	s.Start(NewConfig("tcp://localhost:" + port))
+
+	_, err = s.PublishDurable(&publish2.Message)
+	assert.Equal(t, ErrDurableCleanSession, err)
+
+	s.Stop(true)
+}
+
+func TestDisconnectReason(t *testing.T) {
+	assert.Equal(t, "stopped", DisconnectStopped.String())
+	assert.Equal(t, "missing pong", DisconnectMissingPong.String())
+	assert.Equal(t, "unknown", DisconnectReason(-1).String())
+
+	assert.False(t, DisconnectStopped.Abnormal())
+	assert.False(t, DisconnectFailback.Abnormal())
+	assert.True(t, DisconnectMissingPong.Abnormal())
+	assert.True(t, DisconnectConnectionLost.Abnormal())
+}
+
 func BenchmarkServicePublish(b *testing.B) {
 	ready := make(chan struct{})
 	done := make(chan struct{})
@@ -563,3 +1094,96 @@ func BenchmarkServicePublish(b *testing.B) {
 
 	safeReceive(done)
 }
+
+func TestServiceLazy(t *testing.T) {
+	publish := packet.NewPublish()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("test")
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(publish).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	online := make(chan struct{})
+	offline := make(chan struct{})
+
+	s := NewService()
+	s.Lazy = true
+
+	s.OnlineCallback = func(resumed bool) {
+		close(online)
+	}
+
+	s.OfflineCallback = func() {
+		close(offline)
+	}
+
+	s.Start(NewConfig("tcp://localhost:" + port))
+
+	select {
+	case <-online:
+		assert.Fail(t, "should not connect")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.NoError(t, s.Publish("test", []byte("test"), 0, false).Wait(1*time.Second))
+
+	safeReceive(online)
+
+	s.Stop(true)
+
+	safeReceive(offline)
+	safeReceive(done)
+}
+
+func TestServiceLazyConnect(t *testing.T) {
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	online := make(chan struct{})
+	offline := make(chan struct{})
+
+	s := NewService()
+	s.Lazy = true
+
+	s.OnlineCallback = func(resumed bool) {
+		close(online)
+	}
+
+	s.OfflineCallback = func() {
+		close(offline)
+	}
+
+	s.Start(NewConfig("tcp://localhost:" + port))
+	s.Connect()
+	s.Connect() // does nothing
+
+	safeReceive(online)
+
+	s.Stop(true)
+
+	safeReceive(offline)
+	safeReceive(done)
+}
+
+func TestServiceLazyStop(t *testing.T) {
+	s := NewService()
+	s.Lazy = true
+
+	s.OnlineCallback = func(resumed bool) {
+		assert.Fail(t, "should not connect")
+	}
+
+	s.Start(NewConfig("tcp://localhost:1883"))
+	s.Stop(true)
+}
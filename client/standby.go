@@ -0,0 +1,122 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/256dpi/gomqtt/logging"
+	"github.com/256dpi/gomqtt/transport"
+)
+
+// A FailbackPolicy defines when a service that failed over to the standby
+// broker returns to the primary broker.
+type FailbackPolicy int
+
+const (
+	// FailbackOnDisconnect returns to the primary broker once the connection
+	// to the standby broker has been lost.
+	FailbackOnDisconnect FailbackPolicy = iota
+
+	// FailbackImmediately returns to the primary broker as soon as it is
+	// probed successfully. The connection to the standby broker is closed
+	// gracefully beforehand.
+	FailbackImmediately
+
+	// FailbackNever stays with the standby broker until it becomes
+	// unavailable. The primary broker is then treated as the standby broker.
+	FailbackNever
+)
+
+const (
+	peerUnknown int32 = iota
+	peerHealthy
+	peerUnhealthy
+)
+
+// returns the config of the active broker
+func (s *Service) activeConfig(standby bool) *Config {
+	if standby {
+		return s.StandbyConfig
+	}
+
+	return s.config
+}
+
+// checks if the peer broker is not known to be unavailable
+func (s *Service) peerAvailable() bool {
+	return s.StandbyConfig != nil && atomic.LoadInt32(&s.peerHealth) != peerUnhealthy
+}
+
+// probes the peer broker while connected and closes the failback channel if
+// the primary broker is available again
+func (s *Service) probe(standby bool, done <-chan struct{}, failback chan struct{}) {
+	// create ticker
+	ticker := time.NewTicker(s.ProbeInterval)
+	defer ticker.Stop()
+
+	// get peer
+	peer := s.activeConfig(!standby)
+
+	for {
+		// await next tick
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+
+		// probe peer
+		err := probeBroker(peer, s.ConnectTimeout)
+		if err != nil {
+			atomic.StoreInt32(&s.peerHealth, peerUnhealthy)
+			s.log(fmt.Sprintf("Probe Error: %s", err.Error()))
+			s.logEvent(logging.Error, "probe failed", logging.F("url", peer.BrokerURL), logging.F("error", err))
+			continue
+		}
+
+		// set health
+		atomic.StoreInt32(&s.peerHealth, peerHealthy)
+
+		// fail back if connected to standby
+		if standby && s.FailbackPolicy == FailbackImmediately {
+			close(failback)
+			return
+		}
+	}
+}
+
+// probeBroker dials the broker of the config to check its availability. The
+// connection is closed without sending a Connect packet to leave sessions on
+// the broker unaffected.
+func probeBroker(config *Config, timeout time.Duration) error {
+	// prepare context
+	ctx := config.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// apply timeout
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// dial broker (with custom dialer if present)
+	var conn transport.Conn
+	var err error
+	if dialer, ok := config.Dialer.(ContextDialer); ok {
+		conn, err = dialer.DialContext(ctx, config.BrokerURL)
+	} else if config.Dialer != nil {
+		conn, err = config.Dialer.Dial(config.BrokerURL)
+	} else {
+		conn, err = transport.DialContext(ctx, config.BrokerURL)
+	}
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
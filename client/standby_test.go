@@ -0,0 +1,160 @@
+package client
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/transport"
+	"github.com/256dpi/gomqtt/transport/flow"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type toggleDialer struct {
+	down int32
+}
+
+func (d *toggleDialer) Dial(url string) (transport.Conn, error) {
+	if atomic.LoadInt32(&d.down) == 1 {
+		return nil, errors.New("down")
+	}
+
+	return transport.Dial(url)
+}
+
+func TestServiceFailover(t *testing.T) {
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	online := make(chan struct{})
+	offline := make(chan struct{})
+
+	primary := NewConfig("tcp://localhost:1883")
+	primary.Dialer = &toggleDialer{down: 1}
+
+	s := NewService()
+	s.StandbyConfig = NewConfig("tcp://localhost:" + port)
+
+	s.OnlineCallback = func(resumed bool) {
+		close(online)
+	}
+
+	s.OfflineCallback = func() {
+		close(offline)
+	}
+
+	s.Start(primary)
+
+	safeReceive(online)
+	assert.True(t, s.Standby())
+
+	s.Stop(true)
+
+	safeReceive(offline)
+	safeReceive(done)
+}
+
+func TestServiceFailbackImmediately(t *testing.T) {
+	probe := flow.New().
+		End()
+
+	primaryBroker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(disconnectPacket()).
+		End()
+
+	standbyBroker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(disconnectPacket()).
+		End()
+
+	primaryDone, primaryPort := fakeBroker(t, probe, primaryBroker)
+	standbyDone, standbyPort := fakeBroker(t, standbyBroker)
+
+	online := make(chan bool, 2)
+	offline := make(chan struct{}, 2)
+
+	dialer := &toggleDialer{down: 1}
+	primary := NewConfig("tcp://localhost:" + primaryPort)
+	primary.Dialer = dialer
+
+	s := NewService()
+	s.StandbyConfig = NewConfig("tcp://localhost:" + standbyPort)
+	s.ProbeInterval = 10 * time.Millisecond
+	s.FailbackPolicy = FailbackImmediately
+
+	s.OnlineCallback = func(resumed bool) {
+		online <- s.Standby()
+	}
+
+	s.OfflineCallback = func() {
+		offline <- struct{}{}
+	}
+
+	s.Start(primary)
+
+	assert.True(t, <-online)
+
+	atomic.StoreInt32(&dialer.down, 0)
+
+	safeReceive(standbyDone)
+	assert.False(t, <-online)
+
+	s.Stop(true)
+
+	safeReceive(primaryDone)
+	assert.Len(t, offline, 2)
+}
+
+func TestServiceFailbackOnDisconnect(t *testing.T) {
+	standbyBroker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Close()
+
+	primaryBroker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(disconnectPacket()).
+		End()
+
+	primaryDone, primaryPort := fakeBroker(t, primaryBroker)
+	standbyDone, standbyPort := fakeBroker(t, standbyBroker)
+
+	online := make(chan bool, 2)
+
+	dialer := &toggleDialer{down: 1}
+	primary := NewConfig("tcp://localhost:" + primaryPort)
+	primary.Dialer = dialer
+
+	s := NewService()
+	s.StandbyConfig = NewConfig("tcp://localhost:" + standbyPort)
+
+	s.OnlineCallback = func(resumed bool) {
+		if s.Standby() {
+			atomic.StoreInt32(&dialer.down, 0)
+		}
+
+		online <- s.Standby()
+	}
+
+	s.Start(primary)
+
+	assert.True(t, <-online)
+
+	safeReceive(standbyDone)
+	assert.False(t, <-online)
+
+	s.Stop(true)
+
+	safeReceive(primaryDone)
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"sync"
 	"time"
 
 	"github.com/256dpi/gomqtt/packet"
@@ -85,6 +86,126 @@ func ClearRetainedMessage(config *Config, topic string, timeout time.Duration) e
 	}, timeout)
 }
 
+// ClearRetainedTree will connect to the specified broker, subscribe to the
+// specified topic filter and clear all retained messages that are received
+// until no message has been received for the idle duration. It returns the
+// topics of the cleared messages.
+func ClearRetainedTree(config *Config, filter string, idle, timeout time.Duration) ([]string, error) {
+	// create client
+	client := New()
+
+	// prepare state
+	var retained []string
+	var mutex sync.Mutex
+	seen := map[string]bool{}
+	activity := make(chan struct{}, 1)
+	errCh := make(chan error, 1)
+
+	// set callback
+	client.Callback = func(msg *packet.Message, err error) error {
+		if err != nil {
+			select {
+			case errCh <- err:
+			default:
+			}
+			return nil
+		}
+
+		// collect retained topic
+		mutex.Lock()
+		if msg.Retain && len(msg.Payload) > 0 && !seen[msg.Topic] {
+			seen[msg.Topic] = true
+			retained = append(retained, msg.Topic)
+		}
+		mutex.Unlock()
+
+		// signal activity
+		select {
+		case activity <- struct{}{}:
+		default:
+		}
+
+		return nil
+	}
+
+	// connect to broker
+	future, err := client.Connect(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// wait for future
+	err = future.Wait(timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// make subscription
+	subscribeFuture, err := client.Subscribe(filter, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// wait for future
+	err = subscribeFuture.Wait(timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// wait until idle
+	for idling := false; !idling; {
+		select {
+		case err = <-errCh:
+			return nil, err
+		case <-activity:
+		case <-time.After(idle):
+			idling = true
+		}
+	}
+
+	// get topics
+	mutex.Lock()
+	topics := append([]string(nil), retained...)
+	mutex.Unlock()
+
+	// remove subscription
+	unsubscribeFuture, err := client.Unsubscribe(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// wait for future
+	err = unsubscribeFuture.Wait(timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// clear retained messages
+	for _, topic := range topics {
+		publishFuture, err := client.PublishMessage(&packet.Message{
+			Topic:  topic,
+			Retain: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// wait on future
+		err = publishFuture.Wait(timeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// disconnect
+	err = client.Disconnect()
+	if err != nil {
+		return nil, err
+	}
+
+	return topics, nil
+}
+
 // ReceiveMessage will connect to the specified broker and issue a subscription
 // for the specified topic and return the first message received.
 func ReceiveMessage(config *Config, topic string, qos packet.QOS, timeout time.Duration) (*packet.Message, error) {
@@ -49,6 +49,59 @@ func TestClearRetainedMessage(t *testing.T) {
 	safeReceive(done)
 }
 
+func TestClearRetainedTree(t *testing.T) {
+	subscribe := packet.NewSubscribe()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{{Topic: "foo/#"}}
+
+	suback := packet.NewSuback()
+	suback.ID = 1
+	suback.ReturnCodes = []packet.QOS{0}
+
+	retained1 := packet.NewPublish()
+	retained1.Message = packet.Message{Topic: "foo/1", Payload: []byte("1"), Retain: true}
+
+	retained2 := packet.NewPublish()
+	retained2.Message = packet.Message{Topic: "foo/2", Payload: []byte("2"), Retain: true}
+
+	live := packet.NewPublish()
+	live.Message = packet.Message{Topic: "foo/3", Payload: []byte("3")}
+
+	unsubscribe := packet.NewUnsubscribe()
+	unsubscribe.ID = 2
+	unsubscribe.Topics = []string{"foo/#"}
+
+	unsuback := packet.NewUnsuback()
+	unsuback.ID = 2
+
+	clear1 := packet.NewPublish()
+	clear1.Message = packet.Message{Topic: "foo/1", Retain: true}
+
+	clear2 := packet.NewPublish()
+	clear2.Message = packet.Message{Topic: "foo/2", Retain: true}
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(subscribe).
+		Send(suback).
+		Send(retained1, retained2, live).
+		Receive(unsubscribe).
+		Send(unsuback).
+		Receive(clear1).
+		Receive(clear2).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	topics, err := ClearRetainedTree(NewConfig("tcp://localhost:"+port), "foo/#", 50*time.Millisecond, 1*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo/1", "foo/2"}, topics)
+
+	safeReceive(done)
+}
+
 func TestPublishMessage(t *testing.T) {
 	publish := packet.NewPublish()
 	publish.Message = packet.Message{
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+)
+
+// ClientTrace is a set of hooks to run at various stages of a client
+// connection. Any particular hook may be nil. Hooks may be called
+// concurrently from different goroutines and must not block.
+//
+// A trace is attached to a connection by setting the context of the config
+// using WithClientTrace, similar to net/http/httptrace.
+type ClientTrace struct {
+	// DNSStart is called when looking up the broker host begins.
+	DNSStart func(host string)
+
+	// DNSDone is called when looking up the broker host ends.
+	DNSDone func(addrs []net.IPAddr, err error)
+
+	// GotConn is called after the connection to the broker has been
+	// established and before the Connect packet is sent.
+	GotConn func(conn transport.Conn)
+
+	// WrotePacket is called after a packet has been written to the
+	// connection, with the error of the write if any.
+	WrotePacket func(pkt packet.Generic, err error)
+
+	// GotAck is called when an acknowledgement has been received. These are
+	// Connack, Puback, Pubrec, Pubcomp, Suback, Unsuback and Pingresp packets.
+	GotAck func(pkt packet.Generic)
+
+	// Reconnecting is called by the service before a reconnect attempt is
+	// delayed by the specified duration.
+	Reconnecting func(delay time.Duration)
+}
+
+type clientTraceKey struct{}
+
+// WithClientTrace returns a new context based on the provided parent context
+// that carries the specified trace. The DNS hooks are installed as
+// net/http/httptrace hooks that are called by the resolver.
+func WithClientTrace(ctx context.Context, trace *ClientTrace) context.Context {
+	// check trace
+	if trace == nil {
+		panic("nil trace")
+	}
+
+	// install dns hooks
+	if trace.DNSStart != nil || trace.DNSDone != nil {
+		ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			DNSStart: func(info httptrace.DNSStartInfo) {
+				if trace.DNSStart != nil {
+					trace.DNSStart(info.Host)
+				}
+			},
+			DNSDone: func(info httptrace.DNSDoneInfo) {
+				if trace.DNSDone != nil {
+					trace.DNSDone(info.Addrs, info.Err)
+				}
+			},
+		})
+	}
+
+	return context.WithValue(ctx, clientTraceKey{}, trace)
+}
+
+// ContextClientTrace returns the ClientTrace associated with the provided
+// context. If none, it returns nil.
+func ContextClientTrace(ctx context.Context) *ClientTrace {
+	trace, _ := ctx.Value(clientTraceKey{}).(*ClientTrace)
+	return trace
+}
+
+// returns the trace of the config or an empty trace
+func configTrace(config *Config) *ClientTrace {
+	if config != nil && config.Context != nil {
+		if trace := ContextClientTrace(config.Context); trace != nil {
+			return trace
+		}
+	}
+
+	return &ClientTrace{}
+}
+
+func (t *ClientTrace) gotConn(conn transport.Conn) {
+	if t.GotConn != nil {
+		t.GotConn(conn)
+	}
+}
+
+func (t *ClientTrace) wrotePacket(pkt packet.Generic, err error) {
+	if t.WrotePacket != nil {
+		t.WrotePacket(pkt, err)
+	}
+}
+
+func (t *ClientTrace) gotAck(pkt packet.Generic) {
+	// check hook
+	if t.GotAck == nil {
+		return
+	}
+
+	// check type
+	switch pkt.Type() {
+	case packet.CONNACK, packet.PUBACK, packet.PUBREC, packet.PUBCOMP, packet.SUBACK, packet.UNSUBACK, packet.PINGRESP:
+		t.GotAck(pkt)
+	}
+}
+
+func (t *ClientTrace) reconnecting(delay time.Duration) {
+	if t.Reconnecting != nil {
+		t.Reconnecting(delay)
+	}
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+	"github.com/256dpi/gomqtt/transport/flow"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientTrace(t *testing.T) {
+	publish := packet.NewPublish()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("test")
+	publish.Message.QOS = 1
+	publish.ID = 1
+
+	puback := packet.NewPuback()
+	puback.ID = 1
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(publish).
+		Send(puback).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	var mutex sync.Mutex
+	var events []string
+
+	record := func(event string) {
+		mutex.Lock()
+		events = append(events, event)
+		mutex.Unlock()
+	}
+
+	trace := &ClientTrace{
+		DNSStart: func(host string) {
+			record("dns start " + host)
+		},
+		DNSDone: func(addrs []net.IPAddr, err error) {
+			assert.NoError(t, err)
+			record("dns done")
+		},
+		GotConn: func(conn transport.Conn) {
+			assert.NotNil(t, conn)
+			record("got conn")
+		},
+		WrotePacket: func(pkt packet.Generic, err error) {
+			assert.NoError(t, err)
+			record("wrote " + pkt.Type().String())
+		},
+		GotAck: func(pkt packet.Generic) {
+			record("got " + pkt.Type().String())
+		},
+	}
+
+	ctx := WithClientTrace(context.Background(), trace)
+	assert.Equal(t, trace, ContextClientTrace(ctx))
+
+	c := New()
+
+	config := NewConfig("tcp://localhost:" + port)
+	config.Context = ctx
+
+	connectFuture, err := c.Connect(config)
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+
+	publishFuture, err := c.Publish("test", []byte("test"), 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, publishFuture.Wait(1*time.Second))
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+
+	mutex.Lock()
+	assert.Equal(t, []string{
+		"dns start localhost",
+		"dns done",
+		"got conn",
+		"wrote Connect",
+		"got Connack",
+		"wrote Publish",
+		"got Puback",
+		"wrote Disconnect",
+	}, events)
+	mutex.Unlock()
+}
+
+func TestContextClientTrace(t *testing.T) {
+	assert.Nil(t, ContextClientTrace(context.Background()))
+}
@@ -9,16 +9,24 @@ import (
 type Tracker struct {
 	sync.RWMutex
 
-	last    time.Time
-	pings   uint8
-	timeout time.Duration
+	last     time.Time
+	pings    uint8
+	timeout  time.Duration
+	deadline time.Time
+
+	checkedMono time.Time
+	checkedWall time.Time
 }
 
 // NewTracker returns a new tracker.
 func NewTracker(timeout time.Duration) *Tracker {
+	now := time.Now()
+
 	return &Tracker{
-		last:    time.Now(),
-		timeout: timeout,
+		last:        now,
+		timeout:     timeout,
+		checkedMono: now,
+		checkedWall: now.Round(0),
 	}
 }
 
@@ -35,7 +43,17 @@ func (t *Tracker) Window() time.Duration {
 	t.RLock()
 	defer t.RUnlock()
 
-	return t.timeout - time.Since(t.last)
+	// get window
+	window := t.timeout - time.Since(t.last)
+
+	// shorten window if a pong is expected earlier
+	if !t.deadline.IsZero() {
+		if until := time.Until(t.deadline); until < window {
+			window = until
+		}
+	}
+
+	return window
 }
 
 // Ping marks a ping.
@@ -52,6 +70,39 @@ func (t *Tracker) Pong() {
 	defer t.Unlock()
 
 	t.pings--
+	t.deadline = time.Time{}
+}
+
+// Verify requires pending pings to be answered within the specified timeout.
+func (t *Tracker) Verify(timeout time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.deadline = time.Now().Add(timeout)
+}
+
+// Suspended returns the duration the system has been suspended since the last
+// call. The duration is derived from the difference between the wall clock and
+// the monotonic clock, which does not advance during a system suspension.
+func (t *Tracker) Suspended() time.Duration {
+	t.Lock()
+	defer t.Unlock()
+
+	// get elapsed time on both clocks
+	now := time.Now()
+	mono := now.Sub(t.checkedMono)
+	wall := now.Round(0).Sub(t.checkedWall)
+
+	// save readings
+	t.checkedMono = now
+	t.checkedWall = now.Round(0)
+
+	// check difference
+	if wall <= mono {
+		return 0
+	}
+
+	return wall - mono
 }
 
 // Pending returns if pings are pending.
@@ -24,3 +24,28 @@ func TestTracker(t *testing.T) {
 	tracker.Pong()
 	assert.False(t, tracker.Pending())
 }
+
+func TestTrackerVerify(t *testing.T) {
+	tracker := NewTracker(time.Minute)
+	assert.True(t, tracker.Window() > time.Second)
+
+	tracker.Ping()
+	tracker.Verify(10 * time.Millisecond)
+	assert.True(t, tracker.Window() <= 10*time.Millisecond)
+
+	time.Sleep(10 * time.Millisecond)
+	assert.True(t, tracker.Window() <= 0)
+
+	tracker.Pong()
+	assert.True(t, tracker.Window() > time.Second)
+}
+
+func TestTrackerSuspended(t *testing.T) {
+	tracker := NewTracker(time.Minute)
+	assert.True(t, tracker.Suspended() < time.Second)
+
+	// simulate a suspension of the system
+	tracker.checkedWall = tracker.checkedWall.Add(-time.Hour)
+	assert.True(t, tracker.Suspended() > 59*time.Minute)
+	assert.True(t, tracker.Suspended() < time.Second)
+}
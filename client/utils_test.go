@@ -1,7 +1,10 @@
 package client
 
 import (
+	"crypto/tls"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -31,32 +34,61 @@ func errorCallback(t *testing.T) func(*packet.Message, error) error {
 	}
 }
 
-func fakeBroker(t *testing.T, testFlows ...*flow.Flow) (chan struct{}, string) {
-	done := make(chan struct{})
+var testLauncher *transport.Launcher
+var testDialer *transport.Dialer
 
-	server, err := transport.Launch("tcp://localhost:0")
-	assert.NoError(t, err)
+func init() {
+	wd, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
 
-	go func() {
-		for _, flow := range testFlows {
-			conn, err := server.Accept()
-			assert.NoError(t, err)
+	crt, err := tls.LoadX509KeyPair(filepath.Join(wd, "../example.crt"), filepath.Join(wd, "../example.key"))
+	if err != nil {
+		panic(err)
+	}
 
-			err = flow.Test(conn)
-			assert.NoError(t, err)
-		}
+	testLauncher = transport.NewLauncher()
+	testLauncher.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{crt},
+	}
 
-		err = server.Close()
-		assert.NoError(t, err)
+	testDialer = transport.NewDialer()
+	testDialer.TLSConfig = &tls.Config{
+		InsecureSkipVerify: true,
+	}
+}
 
-		close(done)
-	}()
+func fakeBroker(t *testing.T, testFlows ...*flow.Flow) (chan struct{}, string) {
+	done, server := launchFakeBroker(t, "tcp", testFlows...)
 
 	_, port, _ := net.SplitHostPort(server.Addr().String())
 
 	return done, port
 }
 
+func fakeBrokerURL(t *testing.T, protocol string, testFlows ...*flow.Flow) (chan struct{}, string) {
+	done, server := launchFakeBroker(t, protocol, testFlows...)
+
+	return done, protocol + "://" + server.Addr().String()
+}
+
+func launchFakeBroker(t *testing.T, protocol string, testFlows ...*flow.Flow) (chan struct{}, transport.Server) {
+	done := make(chan struct{})
+
+	server, err := testLauncher.Launch(protocol + "://localhost:0")
+	assert.NoError(t, err)
+
+	errCh := flow.Serve(server, testFlows...)
+
+	go func() {
+		assert.NoError(t, <-errCh)
+		close(done)
+	}()
+
+	return done, server
+}
+
 func connectPacket() *packet.Connect {
 	pkt := packet.NewConnect()
 	pkt.CleanSession = true
@@ -0,0 +1,14 @@
+//go:build !gomqtt_lite
+// +build !gomqtt_lite
+
+package client
+
+import "testing"
+
+func TestClientTransportWS(t *testing.T) {
+	abstractClientTransportTest(t, "ws")
+}
+
+func TestClientTransportWSS(t *testing.T) {
+	abstractClientTransportTest(t, "wss")
+}
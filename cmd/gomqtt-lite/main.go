@@ -0,0 +1,57 @@
+// Command gomqtt-lite is a minimal publisher that is used to measure the size
+// of clients built with the "gomqtt_lite" tag:
+//
+//	go build -tags gomqtt_lite -ldflags="-s -w" ./cmd/gomqtt-lite
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+)
+
+var broker = flag.String("broker", "tcp://0.0.0.0:1883", "the broker url")
+var topic = flag.String("topic", "gomqtt-lite", "the topic to publish to")
+var message = flag.String("message", "", "the message payload")
+var qos = flag.Uint("qos", 0, "the qos level of the message")
+var timeout = flag.Duration("timeout", 10*time.Second, "the timeout for broker acknowledgements")
+
+func main() {
+	flag.Parse()
+
+	err := publish()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func publish() error {
+	c := client.New()
+
+	cf, err := c.Connect(client.NewConfig(*broker))
+	if err != nil {
+		return err
+	}
+
+	err = cf.Wait(*timeout)
+	if err != nil {
+		return err
+	}
+
+	pf, err := c.Publish(*topic, []byte(*message), packet.QOS(*qos), false)
+	if err != nil {
+		return err
+	}
+
+	err = pf.Wait(*timeout)
+	if err != nil {
+		return err
+	}
+
+	return c.Disconnect()
+}
@@ -13,11 +13,13 @@ import (
 
 	"github.com/256dpi/gomqtt/broker"
 	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/tools"
 	"github.com/256dpi/gomqtt/transport"
 )
 
 var url = flag.String("url", "tcp://0.0.0.0:1883", "broker url")
 var sqz = flag.Int("sqz", 100, "session queue size")
+var proxy = flag.Bool("proxy", false, "require proxy protocol header")
 
 func main() {
 	flag.Parse()
@@ -28,7 +30,10 @@ func main() {
 
 	fmt.Printf("Starting broker on URL %s... ", *url)
 
-	server, err := transport.Launch(*url)
+	launcher := transport.NewLauncher()
+	launcher.ProxyProtocol = *proxy
+
+	server, err := launcher.Launch(*url)
 	if err != nil {
 		panic(err)
 	}
@@ -38,17 +43,17 @@ func main() {
 	backend := broker.NewMemoryBackend()
 	backend.SessionQueueSize = *sqz
 
-	var published int32
-	var forwarded int32
+	published := tools.NewRate(time.Second, 10)
+	forwarded := tools.NewRate(time.Second, 10)
 	var clients int32
 
 	backend.Logger = func(event broker.LogEvent, client *broker.Client, pkt packet.Generic, msg *packet.Message, err error) {
 		if event == broker.NewConnection {
 			atomic.AddInt32(&clients, 1)
 		} else if event == broker.MessagePublished {
-			atomic.AddInt32(&published, 1)
+			published.Add(1)
 		} else if event == broker.MessageForwarded {
-			atomic.AddInt32(&forwarded, 1)
+			forwarded.Add(1)
 		} else if event == broker.LostConnection {
 			atomic.AddInt32(&clients, -1)
 		}
@@ -61,12 +66,9 @@ func main() {
 		for {
 			<-time.After(1 * time.Second)
 
-			pub := atomic.LoadInt32(&published)
-			fwd := atomic.LoadInt32(&forwarded)
-			fmt.Printf("Publish Rate: %d msg/s, Forward Rate: %d msg/s, Clients: %d\n", pub, fwd, clients)
-
-			atomic.StoreInt32(&published, 0)
-			atomic.StoreInt32(&forwarded, 0)
+			pub := published.Rate()
+			fwd := forwarded.Rate()
+			fmt.Printf("Publish Rate: %.0f msg/s, Forward Rate: %.0f msg/s, Clients: %d\n", pub, fwd, atomic.LoadInt32(&clients))
 		}
 	}()
 
@@ -7,8 +7,7 @@ import (
 
 	"github.com/256dpi/gomqtt/client"
 	"github.com/256dpi/gomqtt/packet"
-
-	"github.com/beorn7/perks/quantile"
+	"github.com/256dpi/gomqtt/tools"
 )
 
 var broker = flag.String("broker", "tcp://0.0.0.0:1883", "broker url")
@@ -52,11 +51,7 @@ func main() {
 		panic(err)
 	}
 
-	q := quantile.NewTargeted(map[float64]float64{
-		0.50: 0.005,
-		0.90: 0.001,
-		0.99: 0.0001,
-	})
+	q := tools.NewQuantiles(nil)
 
 	for {
 		t1 := time.Now()
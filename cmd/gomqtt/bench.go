@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/tools"
+)
+
+// the state of a running benchmark
+type bench struct {
+	options
+
+	publishers  int
+	subscribers int
+	qos         packet.QOS
+	size        int
+	rate        int
+	topic       string
+
+	sent      int64
+	received  int64
+	latencies *tools.Quantiles
+
+	stop  chan struct{}
+	group sync.WaitGroup
+	errs  chan error
+}
+
+func runBench(args []string) error {
+	// prepare flags
+	var b bench
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	b.register(fs)
+	fs.IntVar(&b.publishers, "publishers", 1, "the number of publishing clients")
+	fs.IntVar(&b.subscribers, "subscribers", 1, "the number of subscribing clients")
+	qos := fs.Int("qos", 0, "the qos level of messages and subscriptions")
+	fs.IntVar(&b.size, "size", 64, "the payload size in bytes (at least 8)")
+	fs.IntVar(&b.rate, "rate", 0, "the messages per second per publisher (0 is unlimited)")
+	fs.StringVar(&b.topic, "topic", "gomqtt-bench", "the topic prefix")
+	duration := fs.Duration("duration", 10*time.Second, "the duration of the benchmark")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	// check flags
+	if b.publishers <= 0 || b.subscribers < 0 {
+		return errors.New("invalid number of clients")
+	} else if b.size < 8 {
+		return errors.New("payload size must be at least 8 bytes")
+	}
+
+	// check qos
+	b.qos, err = parseQOS("qos", *qos)
+	if err != nil {
+		return err
+	}
+
+	// prepare state
+	b.latencies = tools.NewQuantiles(nil)
+	b.stop = make(chan struct{})
+	b.errs = make(chan error, b.publishers+b.subscribers)
+
+	// connect subscribers
+	var clients []*client.Client
+	for i := 0; i < b.subscribers; i++ {
+		c, err := b.subscriber(i)
+		if err != nil {
+			return err
+		}
+
+		clients = append(clients, c)
+	}
+
+	// connect publishers
+	var publishers []*client.Client
+	for i := 0; i < b.publishers; i++ {
+		c, err := b.dial(i)
+		if err != nil {
+			return err
+		}
+
+		publishers = append(publishers, c)
+		clients = append(clients, c)
+	}
+
+	fmt.Printf("Benchmarking %s with %d publishers and %d subscribers for %s...\n", b.broker, b.publishers, b.subscribers, *duration)
+
+	// start publishers
+	start := time.Now()
+	for i, c := range publishers {
+		b.group.Add(1)
+		go b.publish(c, i)
+	}
+
+	// handle signals
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	// report until finished
+	ticker := time.NewTicker(time.Second)
+	timeout := time.After(*duration)
+	lastSent, lastReceived := int64(0), int64(0)
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			sent, received := atomic.LoadInt64(&b.sent), atomic.LoadInt64(&b.received)
+			fmt.Printf("Sent: %d msg/s, Received: %d msg/s, Latency (p50): %s\n", sent-lastSent, received-lastReceived, b.latency(0.5))
+			lastSent, lastReceived = sent, received
+		case <-timeout:
+			break loop
+		case <-signals:
+			break loop
+		case err = <-b.errs:
+			break loop
+		}
+	}
+
+	// stop publishers
+	ticker.Stop()
+	close(b.stop)
+	b.group.Wait()
+	elapsed := time.Since(start)
+
+	// allow in flight messages to arrive
+	time.Sleep(time.Second)
+
+	// disconnect clients
+	for _, c := range clients {
+		_ = c.Disconnect()
+	}
+
+	// print summary
+	sent, received := atomic.LoadInt64(&b.sent), atomic.LoadInt64(&b.received)
+	fmt.Printf("Sent: %d msgs (%.0f msg/s)\n", sent, float64(sent)/elapsed.Seconds())
+	fmt.Printf("Received: %d msgs (%.0f msg/s)\n", received, float64(received)/elapsed.Seconds())
+	fmt.Printf("Latency: p50 %s, p90 %s, p99 %s\n", b.latency(0.5), b.latency(0.9), b.latency(0.99))
+
+	return err
+}
+
+func (b *bench) dial(i int) (*client.Client, error) {
+	// get config
+	config, err := b.config()
+	if err != nil {
+		return nil, err
+	}
+
+	// set client id
+	config.ClientID = b.topic + "/pub/" + strconv.Itoa(i)
+
+	// connect client
+	c := client.New()
+	cf, err := c.Connect(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, cf.Wait(b.timeout)
+}
+
+func (b *bench) subscriber(i int) (*client.Client, error) {
+	// prepare client
+	c := client.New()
+	c.Callback = func(msg *packet.Message, err error) error {
+		// report error
+		if err != nil {
+			b.fail(err)
+			return nil
+		}
+
+		// record latency
+		sent := int64(binary.BigEndian.Uint64(msg.Payload))
+		b.latencies.Insert(float64(time.Now().UnixNano() - sent))
+		atomic.AddInt64(&b.received, 1)
+
+		return nil
+	}
+
+	// get config
+	config, err := b.config()
+	if err != nil {
+		return nil, err
+	}
+
+	// connect client
+	config.ClientID = b.topic + "/sub/" + strconv.Itoa(i)
+	cf, err := c.Connect(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// wait for connack
+	err = cf.Wait(b.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// subscribe to all publishers
+	sf, err := c.Subscribe(b.topic+"/+", b.qos)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, sf.Wait(b.timeout)
+}
+
+func (b *bench) publish(c *client.Client, i int) {
+	defer b.group.Done()
+
+	// prepare topic
+	topic := b.topic + "/" + strconv.Itoa(i)
+
+	// prepare rate limit
+	var tick <-chan time.Time
+	if b.rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(b.rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	// prepare futures
+	futures := make(chan client.GenericFuture, 100)
+	done := make(chan struct{})
+	defer func() {
+		close(futures)
+		<-done
+	}()
+
+	// wait for acknowledgements
+	go func() {
+		defer close(done)
+		for future := range futures {
+			err := future.Wait(b.timeout)
+			if err != nil {
+				b.fail(err)
+				return
+			}
+		}
+	}()
+
+	for {
+		// check stop and wait for tick
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-b.stop:
+				return
+			}
+		} else {
+			select {
+			case <-b.stop:
+				return
+			default:
+			}
+		}
+
+		// prepare payload
+		payload := make([]byte, b.size)
+		binary.BigEndian.PutUint64(payload, uint64(time.Now().UnixNano()))
+
+		// publish message
+		future, err := c.Publish(topic, payload, b.qos, false)
+		if err != nil {
+			b.fail(err)
+			return
+		}
+
+		// queue future
+		if b.qos > 0 {
+			select {
+			case futures <- future:
+			case <-b.stop:
+				return
+			}
+		}
+
+		atomic.AddInt64(&b.sent, 1)
+	}
+}
+
+func (b *bench) latency(quantile float64) time.Duration {
+	// check count
+	if b.latencies.Count() == 0 {
+		return 0
+	}
+
+	return time.Duration(b.latencies.Query(quantile)).Round(time.Microsecond)
+}
+
+func (b *bench) fail(err error) {
+	select {
+	case b.errs <- err:
+	default:
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/256dpi/gomqtt/broker"
+	"github.com/256dpi/gomqtt/logging"
+	"github.com/256dpi/gomqtt/transport"
+
+	"gopkg.in/yaml.v2"
+)
+
+// the yaml config file of the broker command
+type brokerConfig struct {
+	// The urls of the listeners e.g. "tcp://0.0.0.0:1883" or "wss://:443".
+	Listeners []string `yaml:"listeners"`
+
+	// The certificate used by secure listeners.
+	TLS struct {
+		CertFile string `yaml:"cert_file"`
+		KeyFile  string `yaml:"key_file"`
+	} `yaml:"tls"`
+
+	// Whether the listeners require a PROXY protocol header.
+	ProxyProtocol bool `yaml:"proxy_protocol"`
+
+	// The file with "user:password" lines. All clients are allowed if empty.
+	AuthFile string `yaml:"auth_file"`
+
+	// The interval in which statistics are published to $SYS, e.g. "10s".
+	SysInterval string `yaml:"sys_interval"`
+
+	// The maximum number of queued messages per session.
+	SessionQueueSize int `yaml:"session_queue_size"`
+
+	// The maximum size of packets sent by clients.
+	MaxPacketSize int64 `yaml:"max_packet_size"`
+
+	// Whether packet level events should be logged.
+	Debug bool `yaml:"debug"`
+}
+
+func loadBrokerConfig(path string) (*brokerConfig, error) {
+	// prepare defaults
+	config := &brokerConfig{
+		Listeners: []string{"tcp://0.0.0.0:1883"},
+	}
+
+	// check path
+	if path == "" {
+		return config, nil
+	}
+
+	// read file
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// decode config
+	err = yaml.UnmarshalStrict(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return config, nil
+}
+
+func loadCredentials(path string) (map[string]string, error) {
+	// open file
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// read lines
+	credentials := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		// skip empty lines and comments
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		// parse line
+		i := strings.Index(text, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid credentials on line %d of %s", line, path)
+		}
+
+		credentials[text[:i]] = text[i+1:]
+	}
+
+	return credentials, scanner.Err()
+}
+
+// a broker that has been started by the broker command
+type brokerInstance struct {
+	backend *broker.MemoryBackend
+	engine  *broker.Engine
+	servers []transport.Server
+	errors  chan error
+}
+
+func runBroker(args []string) error {
+	// parse flags
+	fs := flag.NewFlagSet("broker", flag.ContinueOnError)
+	configFile := fs.String("config", "", "the yaml config file")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	// load config
+	config, err := loadBrokerConfig(*configFile)
+	if err != nil {
+		return err
+	}
+
+	// start broker
+	instance, err := startBroker(config)
+	if err != nil {
+		return err
+	}
+
+	// handle signals
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	// wait for signal or error
+	select {
+	case <-signals:
+	case err = <-instance.errors:
+	}
+
+	// close broker
+	instance.close()
+
+	return err
+}
+
+func startBroker(config *brokerConfig) (*brokerInstance, error) {
+	// check listeners
+	if len(config.Listeners) == 0 {
+		return nil, errors.New("missing listeners")
+	}
+
+	// prepare backend
+	backend := broker.NewMemoryBackend()
+	backend.ClientMaxPacketSize = config.MaxPacketSize
+	if config.SessionQueueSize > 0 {
+		backend.SessionQueueSize = config.SessionQueueSize
+	}
+
+	// set sys interval
+	if config.SysInterval != "" {
+		var err error
+		backend.SysInterval, err = time.ParseDuration(config.SysInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sys interval: %w", err)
+		}
+	}
+
+	// load credentials
+	if config.AuthFile != "" {
+		var err error
+		backend.Credentials, err = loadCredentials(config.AuthFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// prepare launcher
+	launcher := transport.NewLauncher()
+	launcher.ProxyProtocol = config.ProxyProtocol
+
+	// load certificate
+	if config.TLS.CertFile != "" {
+		crt, err := tls.LoadX509KeyPair(config.TLS.CertFile, config.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		launcher.TLSConfig = &tls.Config{Certificates: []tls.Certificate{crt}}
+	}
+
+	// prepare engine
+	engine := broker.NewEngine(backend)
+	engine.EventLogger = logging.LoggerFunc(func(level logging.Level, event string, fields ...logging.Field) {
+		// check level
+		if level == logging.Debug && !config.Debug {
+			return
+		}
+
+		// format fields
+		line := fmt.Sprintf("%s [%s] %s", time.Now().Format(time.RFC3339), level, event)
+		for _, field := range fields {
+			line += fmt.Sprintf(" %s=%v", field.Key, field.Value)
+		}
+
+		fmt.Fprintln(os.Stderr, line)
+	})
+
+	// prepare instance
+	instance := &brokerInstance{
+		backend: backend,
+		engine:  engine,
+		errors:  make(chan error, 1),
+	}
+
+	// handle errors
+	engine.OnError = func(err error) {
+		select {
+		case instance.errors <- err:
+		default:
+		}
+	}
+
+	// launch listeners
+	for _, url := range config.Listeners {
+		server, err := launcher.Launch(url)
+		if err != nil {
+			instance.close()
+			return nil, err
+		}
+
+		instance.servers = append(instance.servers, server)
+		engine.Accept(server)
+
+		fmt.Fprintf(os.Stderr, "Listening on %s\n", server.Addr())
+	}
+
+	return instance, nil
+}
+
+func (i *brokerInstance) close() {
+	// close servers
+	for _, server := range i.servers {
+		_ = server.Close()
+	}
+
+	// close backend
+	i.backend.Close(5 * time.Second)
+
+	// close engine if accepting (a tomb without goroutines never dies)
+	if len(i.servers) > 0 {
+		i.engine.Close()
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, []byte(content), 0600)
+	require.NoError(t, err)
+	return path
+}
+
+func TestLoadBrokerConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomqtt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	full := &brokerConfig{
+		Listeners:        []string{"tcp://0.0.0.0:1883", "wss://:443"},
+		ProxyProtocol:    true,
+		AuthFile:         "users.txt",
+		SysInterval:      "10s",
+		SessionQueueSize: 50,
+		MaxPacketSize:    1024,
+		Debug:            true,
+	}
+	full.TLS.CertFile = "server.crt"
+	full.TLS.KeyFile = "server.key"
+
+	for _, item := range []struct {
+		name   string
+		file   string
+		config *brokerConfig
+		err    string
+	}{
+		{
+			name:   "defaults",
+			config: &brokerConfig{Listeners: []string{"tcp://0.0.0.0:1883"}},
+		},
+		{
+			name: "full",
+			file: writeFile(t, dir, "full.yaml", `
+# the listeners
+listeners:
+  - tcp://0.0.0.0:1883
+  - wss://:443
+tls:
+  cert_file: server.crt
+  key_file: server.key
+proxy_protocol: true
+auth_file: users.txt
+sys_interval: 10s
+session_queue_size: 50
+max_packet_size: 1024
+debug: true
+`),
+			config: full,
+		},
+		{
+			name:   "partial",
+			file:   writeFile(t, dir, "partial.yaml", "sys_interval: 1m\n"),
+			config: &brokerConfig{Listeners: []string{"tcp://0.0.0.0:1883"}, SysInterval: "1m"},
+		},
+		{
+			name:   "json",
+			file:   writeFile(t, dir, "config.json", `{"listeners": ["tcp://localhost:1884"]}`),
+			config: &brokerConfig{Listeners: []string{"tcp://localhost:1884"}},
+		},
+		{
+			name: "unknown field",
+			file: writeFile(t, dir, "unknown.yaml", "listener: tcp://0.0.0.0:1883\n"),
+			err:  "invalid config",
+		},
+		{
+			name: "invalid type",
+			file: writeFile(t, dir, "type.yaml", "session_queue_size: many\n"),
+			err:  "invalid config",
+		},
+		{
+			name: "missing file",
+			file: filepath.Join(dir, "missing.yaml"),
+			err:  "no such file",
+		},
+	} {
+		t.Run(item.name, func(t *testing.T) {
+			config, err := loadBrokerConfig(item.file)
+			if item.err != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), item.err)
+				assert.Nil(t, config)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, item.config, config)
+		})
+	}
+}
+
+func TestLoadCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomqtt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	credentials, err := loadCredentials(writeFile(t, dir, "users.txt", "# users\n\nfoo:bar\nbaz:qu:x\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"foo": "bar", "baz": "qu:x"}, credentials)
+
+	_, err = loadCredentials(writeFile(t, dir, "invalid.txt", "foo\n"))
+	assert.Error(t, err)
+}
+
+func TestStartBrokerErrors(t *testing.T) {
+	for _, config := range []*brokerConfig{
+		{},
+		{Listeners: []string{"tcp://localhost:0"}, SysInterval: "soon"},
+		{Listeners: []string{"tcp://localhost:0"}, AuthFile: "missing.txt"},
+		{Listeners: []string{"foo://localhost:0"}},
+	} {
+		instance, err := startBroker(config)
+		assert.Error(t, err)
+		assert.Nil(t, instance)
+	}
+}
+
+func TestBrokerPubSub(t *testing.T) {
+	instance, err := startBroker(&brokerConfig{
+		Listeners: []string{"tcp://localhost:0"},
+	})
+	require.NoError(t, err)
+	defer instance.close()
+
+	url := "tcp://" + instance.servers[0].Addr().String()
+
+	err = pub([]string{"-broker", url, "-topic", "test", "-message", "hello", "-qos", "1", "-retain"})
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	err = sub([]string{"-broker", url, "-topic", "test", "-qos", "1", "-count", "1", "-json"}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"topic":"test","payload":"hello","qos":1,"retain":true}`+"\n", out.String())
+}
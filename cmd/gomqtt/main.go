@@ -0,0 +1,385 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+)
+
+const usage = `Usage: gomqtt <command> [flags]
+
+Commands:
+  pub     publish a message to a topic
+  sub     subscribe to topics and print received messages
+  broker  run a broker configured by a yaml file
+  bench   measure the throughput and latency of a broker
+
+Run "gomqtt <command> -h" to list the flags of a command.
+`
+
+// the flags shared by all commands
+type options struct {
+	broker    string
+	id        string
+	clean     bool
+	keepAlive string
+	timeout   time.Duration
+
+	caFile   string
+	certFile string
+	keyFile  string
+	insecure bool
+
+	willTopic   string
+	willPayload string
+	willQOS     int
+	willRetain  bool
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.broker, "broker", "tcp://localhost:1883", "the broker url")
+	fs.StringVar(&o.id, "id", "", "the client id")
+	fs.BoolVar(&o.clean, "clean", true, "request a clean session")
+	fs.StringVar(&o.keepAlive, "keep-alive", "30s", "the keep alive interval")
+	fs.DurationVar(&o.timeout, "timeout", 10*time.Second, "the timeout for broker acknowledgements")
+
+	fs.StringVar(&o.caFile, "ca-file", "", "the certificate authorities used to verify the broker")
+	fs.StringVar(&o.certFile, "cert-file", "", "the client certificate")
+	fs.StringVar(&o.keyFile, "key-file", "", "the client certificate key")
+	fs.BoolVar(&o.insecure, "insecure", false, "skip the verification of the broker certificate")
+
+	fs.StringVar(&o.willTopic, "will-topic", "", "the topic of the will message")
+	fs.StringVar(&o.willPayload, "will-payload", "", "the payload of the will message")
+	fs.IntVar(&o.willQOS, "will-qos", 0, "the qos level of the will message")
+	fs.BoolVar(&o.willRetain, "will-retain", false, "retain the will message")
+}
+
+func (o *options) config() (*client.Config, error) {
+	// prepare config
+	config := client.NewConfigWithClientID(o.broker, o.id)
+	config.CleanSession = o.clean
+	config.KeepAlive = o.keepAlive
+
+	// set will message
+	if o.willTopic != "" {
+		qos, err := parseQOS("will qos", o.willQOS)
+		if err != nil {
+			return nil, err
+		}
+
+		config.WillMessage = &packet.Message{
+			Topic:   o.willTopic,
+			Payload: []byte(o.willPayload),
+			QOS:     qos,
+			Retain:  o.willRetain,
+		}
+	}
+
+	// check tls
+	if o.caFile == "" && o.certFile == "" && !o.insecure {
+		return config, nil
+	}
+
+	// prepare tls config
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: o.insecure,
+	}
+
+	// load certificate authorities
+	if o.caFile != "" {
+		pem, err := ioutil.ReadFile(o.caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in " + o.caFile)
+		}
+	}
+
+	// load client certificate
+	if o.certFile != "" {
+		crt, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{crt}
+	}
+
+	// set dialer
+	dialer := transport.NewDialer()
+	dialer.TLSConfig = tlsConfig
+	config.Dialer = dialer
+
+	return config, nil
+}
+
+func (o *options) connect(c *client.Client) error {
+	// get config
+	config, err := o.config()
+	if err != nil {
+		return err
+	}
+
+	// connect client
+	cf, err := c.Connect(config)
+	if err != nil {
+		return err
+	}
+
+	return cf.Wait(o.timeout)
+}
+
+func main() {
+	// check command
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// run command
+	var err error
+	switch os.Args[1] {
+	case "pub":
+		err = pub(os.Args[2:])
+	case "sub":
+		err = sub(os.Args[2:], os.Stdout)
+	case "broker":
+		err = runBroker(os.Args[2:])
+	case "bench":
+		err = runBench(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// handle error
+	if err == flag.ErrHelp {
+		return
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func pub(args []string) error {
+	// prepare flags
+	var o options
+	fs := flag.NewFlagSet("pub", flag.ContinueOnError)
+	o.register(fs)
+	topic := fs.String("topic", "", "the topic to publish to")
+	message := fs.String("message", "", "the message payload")
+	stdin := fs.Bool("stdin", false, "read the message payload from stdin")
+	qos := fs.Int("qos", 0, "the qos level of the message")
+	retain := fs.Bool("retain", false, "retain the message")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	// check topic
+	if *topic == "" {
+		return errors.New("missing topic")
+	}
+
+	// check qos
+	level, err := parseQOS("qos", *qos)
+	if err != nil {
+		return err
+	}
+
+	// get payload
+	payload := []byte(*message)
+	if *stdin {
+		payload, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+	}
+
+	// connect client
+	c := client.New()
+	err = o.connect(c)
+	if err != nil {
+		return err
+	}
+
+	// publish message
+	pf, err := c.Publish(*topic, payload, level, *retain)
+	if err != nil {
+		return err
+	}
+
+	// wait for acknowledgement
+	err = pf.Wait(o.timeout)
+	if err != nil {
+		return err
+	}
+
+	return c.Disconnect()
+}
+
+func sub(args []string, out io.Writer) error {
+	// prepare flags
+	var o options
+	fs := flag.NewFlagSet("sub", flag.ContinueOnError)
+	o.register(fs)
+	var topics topicList
+	fs.Var(&topics, "topic", "the topic filter to subscribe (may be repeated)")
+	qos := fs.Int("qos", 0, "the maximum qos level of the subscriptions")
+	count := fs.Int("count", 0, "exit after receiving the number of messages")
+	verbose := fs.Bool("verbose", false, "print the topic along with the payload")
+	jsonOutput := fs.Bool("json", false, "print messages as json objects")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	// check topics
+	if len(topics) == 0 {
+		return errors.New("missing topic")
+	}
+
+	// check qos
+	level, err := parseQOS("qos", *qos)
+	if err != nil {
+		return err
+	}
+
+	// prepare channels
+	finished := make(chan struct{})
+	errs := make(chan error, 1)
+
+	// prepare printer
+	encoder := json.NewEncoder(out)
+	received := 0
+	output := func(msg *packet.Message) error {
+		// print message
+		if *jsonOutput {
+			err := encoder.Encode(jsonMessage{
+				Topic:   msg.Topic,
+				Payload: string(msg.Payload),
+				QOS:     int(msg.QOS),
+				Retain:  msg.Retain,
+			})
+			if err != nil {
+				return err
+			}
+		} else if *verbose {
+			fmt.Fprintf(out, "%s %s\n", msg.Topic, msg.Payload)
+		} else {
+			fmt.Fprintf(out, "%s\n", msg.Payload)
+		}
+
+		// check count
+		received++
+		if received == *count {
+			close(finished)
+		}
+
+		return nil
+	}
+
+	// prepare client
+	c := client.New()
+	c.Callback = func(msg *packet.Message, err error) error {
+		// print message if not finished
+		if err == nil && (*count <= 0 || received < *count) {
+			err = output(msg)
+		}
+
+		// forward error
+		if err != nil {
+			select {
+			case errs <- err:
+			default:
+			}
+		}
+
+		return nil
+	}
+
+	// connect client
+	err = o.connect(c)
+	if err != nil {
+		return err
+	}
+
+	// prepare subscriptions
+	subs := make([]packet.Subscription, 0, len(topics))
+	for _, topic := range topics {
+		subs = append(subs, packet.Subscription{Topic: topic, QOS: level})
+	}
+
+	// subscribe
+	sf, err := c.SubscribeMultiple(subs)
+	if err != nil {
+		return err
+	}
+
+	// wait for acknowledgement
+	err = sf.Wait(o.timeout)
+	if err != nil {
+		return err
+	}
+
+	// handle signals
+	finish := make(chan os.Signal, 1)
+	signal.Notify(finish, syscall.SIGINT, syscall.SIGTERM)
+
+	// wait until finished
+	select {
+	case <-finished:
+	case <-finish:
+	case err := <-errs:
+		return err
+	}
+
+	return c.Disconnect()
+}
+
+// parseQOS returns the qos level or an error if it is invalid
+func parseQOS(name string, qos int) (packet.QOS, error) {
+	// check level
+	if qos < 0 || qos > 2 {
+		return 0, fmt.Errorf("invalid %s %d", name, qos)
+	}
+
+	return packet.QOS(qos), nil
+}
+
+type jsonMessage struct {
+	Topic   string `json:"topic"`
+	Payload string `json:"payload"`
+	QOS     int    `json:"qos"`
+	Retain  bool   `json:"retain"`
+}
+
+type topicList []string
+
+func (l *topicList) String() string {
+	return fmt.Sprint(*l)
+}
+
+func (l *topicList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQOS(t *testing.T) {
+	for _, qos := range []int{0, 1, 2} {
+		level, err := parseQOS("qos", qos)
+		assert.NoError(t, err)
+		assert.Equal(t, packet.QOS(qos), level)
+	}
+
+	for _, qos := range []int{-1, 3, 128} {
+		_, err := parseQOS("qos", qos)
+		assert.Error(t, err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	var o options
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	o.register(fs)
+	err := fs.Parse([]string{"-id", "foo", "-clean=false", "-will-topic", "will", "-will-payload", "bye", "-will-qos", "1", "-will-retain"})
+	assert.NoError(t, err)
+
+	config, err := o.config()
+	assert.NoError(t, err)
+	assert.Equal(t, "tcp://localhost:1883", config.BrokerURL)
+	assert.Equal(t, "foo", config.ClientID)
+	assert.False(t, config.CleanSession)
+	assert.Equal(t, "30s", config.KeepAlive)
+	assert.Equal(t, &packet.Message{Topic: "will", Payload: []byte("bye"), QOS: 1, Retain: true}, config.WillMessage)
+	assert.Nil(t, config.Dialer)
+
+	o.willQOS = 3
+	_, err = o.config()
+	assert.Error(t, err)
+
+	o.willQOS = 0
+	o.insecure = true
+	config, err = o.config()
+	assert.NoError(t, err)
+	assert.NotNil(t, config.Dialer)
+
+	o.caFile = "missing.pem"
+	_, err = o.config()
+	assert.Error(t, err)
+}
+
+func TestCommandFlags(t *testing.T) {
+	for _, item := range []struct {
+		name string
+		run  func([]string) error
+		args []string
+		err  string
+	}{
+		{name: "pub help", run: pub, args: []string{"-h"}, err: flag.ErrHelp.Error()},
+		{name: "pub unknown flag", run: pub, args: []string{"-foo"}, err: "flag provided but not defined"},
+		{name: "pub missing topic", run: pub, args: []string{"-message", "foo"}, err: "missing topic"},
+		{name: "pub invalid qos", run: pub, args: []string{"-topic", "foo", "-qos", "3"}, err: "invalid qos 3"},
+		{name: "pub invalid will qos", run: pub, args: []string{"-topic", "foo", "-will-topic", "bar", "-will-qos", "-1"}, err: "invalid will qos -1"},
+		{name: "sub missing topic", run: subDiscard, args: []string{}, err: "missing topic"},
+		{name: "sub invalid qos", run: subDiscard, args: []string{"-topic", "foo", "-qos", "5"}, err: "invalid qos 5"},
+		{name: "sub invalid count", run: subDiscard, args: []string{"-topic", "foo", "-count", "x"}, err: "invalid value"},
+		{name: "broker unknown flag", run: runBroker, args: []string{"-foo"}, err: "flag provided but not defined"},
+		{name: "broker missing config", run: runBroker, args: []string{"-config", "missing.yaml"}, err: "no such file"},
+		{name: "bench invalid clients", run: runBench, args: []string{"-publishers", "0"}, err: "invalid number of clients"},
+		{name: "bench invalid size", run: runBench, args: []string{"-size", "4"}, err: "payload size must be at least 8 bytes"},
+		{name: "bench invalid qos", run: runBench, args: []string{"-qos", "3"}, err: "invalid qos 3"},
+	} {
+		t.Run(item.name, func(t *testing.T) {
+			err := item.run(item.args)
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), item.err)
+		})
+	}
+}
+
+func subDiscard(args []string) error {
+	return sub(args, ioutil.Discard)
+}
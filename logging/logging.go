@@ -0,0 +1,57 @@
+// Package logging defines a structured logging hook that is used by clients,
+// services and brokers to report packet level and lifecycle events. Adapters
+// for the standard slog package and zap are provided.
+package logging
+
+// A Level describes the severity of an event.
+type Level int
+
+// All available levels.
+const (
+	// Debug is used for packet level events.
+	Debug Level = iota
+
+	// Info is used for lifecycle events.
+	Info
+
+	// Error is used for events that carry an error.
+	Error
+)
+
+// String returns the level name.
+func (l Level) String() string {
+	switch l {
+	case Debug:
+		return "debug"
+	case Info:
+		return "info"
+	case Error:
+		return "error"
+	}
+
+	return "unknown"
+}
+
+// A Field is a key value pair that describes an event.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F is a shorthand to create a field.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// A Logger receives structured events.
+type Logger interface {
+	Log(level Level, event string, fields ...Field)
+}
+
+// LoggerFunc is a function that implements the Logger interface.
+type LoggerFunc func(level Level, event string, fields ...Field)
+
+// Log will call the function.
+func (f LoggerFunc) Log(level Level, event string, fields ...Field) {
+	f(level, event, fields...)
+}
@@ -0,0 +1,26 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelString(t *testing.T) {
+	assert.Equal(t, "debug", Debug.String())
+	assert.Equal(t, "info", Info.String())
+	assert.Equal(t, "error", Error.String())
+	assert.Equal(t, "unknown", Level(9).String())
+}
+
+func TestLoggerFunc(t *testing.T) {
+	var logged []Field
+	logger := LoggerFunc(func(level Level, event string, fields ...Field) {
+		assert.Equal(t, Info, level)
+		assert.Equal(t, "foo", event)
+		logged = fields
+	})
+
+	logger.Log(Info, "foo", F("bar", 1))
+	assert.Equal(t, []Field{{Key: "bar", Value: 1}}, logged)
+}
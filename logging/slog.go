@@ -0,0 +1,40 @@
+//go:build go1.21
+// +build go1.21
+
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// Slog returns a logger that writes events to the specified slog logger.
+func Slog(logger *slog.Logger) Logger {
+	return &slogLogger{logger: logger}
+}
+
+func (l *slogLogger) Log(level Level, event string, fields ...Field) {
+	// convert fields
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, field := range fields {
+		attrs = append(attrs, slog.Any(field.Key, field.Value))
+	}
+
+	// log event
+	l.logger.LogAttrs(context.Background(), slogLevel(level), event, attrs...)
+}
+
+func slogLevel(level Level) slog.Level {
+	switch level {
+	case Debug:
+		return slog.LevelDebug
+	case Error:
+		return slog.LevelError
+	}
+
+	return slog.LevelInfo
+}
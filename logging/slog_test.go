@@ -0,0 +1,33 @@
+//go:build go1.21
+// +build go1.21
+
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlog(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(_ []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	})
+
+	logger := Slog(slog.New(handler))
+
+	logger.Log(Debug, "foo", F("bar", "baz"))
+	logger.Log(Info, "foo")
+	logger.Log(Error, "foo", F("qos", 1))
+
+	assert.Equal(t, "level=DEBUG msg=foo bar=baz\nlevel=INFO msg=foo\nlevel=ERROR msg=foo qos=1\n", buf.String())
+}
@@ -0,0 +1,33 @@
+//go:build !gomqtt_lite
+// +build !gomqtt_lite
+
+package logging
+
+import "go.uber.org/zap"
+
+type zapLogger struct {
+	logger *zap.Logger
+}
+
+// Zap returns a logger that writes events to the specified zap logger.
+func Zap(logger *zap.Logger) Logger {
+	return &zapLogger{logger: logger}
+}
+
+func (l *zapLogger) Log(level Level, event string, fields ...Field) {
+	// convert fields
+	zapFields := make([]zap.Field, 0, len(fields))
+	for _, field := range fields {
+		zapFields = append(zapFields, zap.Any(field.Key, field.Value))
+	}
+
+	// log event
+	switch level {
+	case Debug:
+		l.logger.Debug(event, zapFields...)
+	case Error:
+		l.logger.Error(event, zapFields...)
+	default:
+		l.logger.Info(event, zapFields...)
+	}
+}
@@ -0,0 +1,32 @@
+//go:build !gomqtt_lite
+// +build !gomqtt_lite
+
+package logging
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestZap(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := Zap(zap.New(core))
+
+	logger.Log(Debug, "foo", F("bar", "baz"))
+	logger.Log(Info, "foo")
+	logger.Log(Error, "foo", F("error", errors.New("failed")))
+
+	entries := logs.All()
+	assert.Len(t, entries, 3)
+	assert.Equal(t, zapcore.DebugLevel, entries[0].Level)
+	assert.Equal(t, "foo", entries[0].Message)
+	assert.Equal(t, map[string]interface{}{"bar": "baz"}, entries[0].ContextMap())
+	assert.Equal(t, zapcore.InfoLevel, entries[1].Level)
+	assert.Equal(t, zapcore.ErrorLevel, entries[2].Level)
+	assert.Equal(t, map[string]interface{}{"error": "failed"}, entries[2].ContextMap())
+}
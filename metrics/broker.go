@@ -0,0 +1,234 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/broker"
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Broker collects metrics from the log events of a broker backend.
+type Broker struct {
+	packetsReceived *prometheus.CounterVec
+	packetsSent     *prometheus.CounterVec
+	messages        *prometheus.CounterVec
+	errors          *prometheus.CounterVec
+	limits          *prometheus.CounterVec
+	bans            prometheus.Counter
+	expiries        prometheus.Counter
+	clients         prometheus.Gauge
+	inflight        prometheus.Gauge
+	latency         prometheus.Histogram
+
+	forwarded map[*broker.Client]map[packet.ID]time.Time
+	mutex     sync.Mutex
+}
+
+// NewBroker creates the broker metrics and registers them on the provided
+// registerer.
+func NewBroker(reg prometheus.Registerer) (*Broker, error) {
+	// create metrics
+	b := &Broker{
+		packetsReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mqtt",
+			Subsystem: "broker",
+			Name:      "packets_received_total",
+			Help:      "The number of received packets by type.",
+		}, []string{"type"}),
+		packetsSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mqtt",
+			Subsystem: "broker",
+			Name:      "packets_sent_total",
+			Help:      "The number of sent packets by type.",
+		}, []string{"type"}),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mqtt",
+			Subsystem: "broker",
+			Name:      "messages_total",
+			Help:      "The number of handled messages by event.",
+		}, []string{"event"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mqtt",
+			Subsystem: "broker",
+			Name:      "errors_total",
+			Help:      "The number of errors by event.",
+		}, []string{"event"}),
+		limits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mqtt",
+			Subsystem: "broker",
+			Name:      "limits_exceeded_total",
+			Help:      "The number of denied subscriptions and dropped messages by limit.",
+		}, []string{"limit"}),
+		bans: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "mqtt",
+			Subsystem: "broker",
+			Name:      "client_bans_total",
+			Help:      "The number of connections rejected due to flapping.",
+		}),
+		expiries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "mqtt",
+			Subsystem: "broker",
+			Name:      "sessions_expired_total",
+			Help:      "The number of stored sessions removed due to expiry.",
+		}),
+		clients: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "mqtt",
+			Subsystem: "broker",
+			Name:      "connected_clients",
+			Help:      "The number of connected clients.",
+		}),
+		inflight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "mqtt",
+			Subsystem: "broker",
+			Name:      "inflight_messages",
+			Help:      "The number of forwarded messages awaiting acknowledgement.",
+		}),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "mqtt",
+			Subsystem: "broker",
+			Name:      "publish_latency_seconds",
+			Help:      "The time until a forwarded message with QOS 1 or 2 is acknowledged by the client.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		forwarded: make(map[*broker.Client]map[packet.ID]time.Time),
+	}
+
+	// register metrics
+	err := register(reg, b.packetsReceived, b.packetsSent, b.messages, b.errors, b.limits, b.bans, b.expiries, b.clients, b.inflight, b.latency)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Logger returns a logger that can be set on a broker.MemoryBackend to
+// collect metrics. The optional next logger is called for every event.
+func (b *Broker) Logger(next func(broker.LogEvent, *broker.Client, packet.Generic, *packet.Message, error)) func(broker.LogEvent, *broker.Client, packet.Generic, *packet.Message, error) {
+	return func(event broker.LogEvent, client *broker.Client, pkt packet.Generic, msg *packet.Message, err error) {
+		// collect metrics
+		b.Log(event, client, pkt, msg, err)
+
+		// call next logger if available
+		if next != nil {
+			next(event, client, pkt, msg, err)
+		}
+	}
+}
+
+// Log will collect the metrics for the specified event. It can be called from
+// custom backend implementations.
+func (b *Broker) Log(event broker.LogEvent, client *broker.Client, pkt packet.Generic, _ *packet.Message, err error) {
+	switch event {
+	case broker.NewConnection:
+		b.clients.Inc()
+		b.track(client)
+	case broker.LostConnection:
+		b.clients.Dec()
+		b.release(client)
+	case broker.PacketReceived:
+		b.packetsReceived.WithLabelValues(pkt.Type().String()).Inc()
+		b.complete(client, pkt)
+	case broker.PacketSent:
+		b.packetsSent.WithLabelValues(pkt.Type().String()).Inc()
+		b.forward(client, pkt)
+	case broker.MessagePublished, broker.MessageAcknowledged, broker.MessageDequeued, broker.MessageForwarded:
+		b.messages.WithLabelValues(string(event)).Inc()
+	case broker.PacketTooLarge:
+		b.limits.WithLabelValues("packet_size").Inc()
+	case broker.SendQueueFull:
+		b.limits.WithLabelValues("send_queue").Inc()
+	case broker.LimitExceeded:
+		if pkt != nil {
+			b.limits.WithLabelValues("subscriptions").Inc()
+		} else {
+			b.limits.WithLabelValues("fan_out").Inc()
+		}
+	case broker.ClientBanned:
+		b.bans.Inc()
+	case broker.SessionExpired:
+		b.expiries.Inc()
+	default:
+		if err != nil {
+			b.errors.WithLabelValues(string(event)).Inc()
+		}
+	}
+}
+
+func (b *Broker) track(client *broker.Client) {
+	// acquire mutex
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// add client
+	if _, ok := b.forwarded[client]; !ok {
+		b.forwarded[client] = make(map[packet.ID]time.Time)
+	}
+}
+
+func (b *Broker) release(client *broker.Client) {
+	// acquire mutex
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// release inflight messages
+	b.inflight.Sub(float64(len(b.forwarded[client])))
+	delete(b.forwarded, client)
+}
+
+func (b *Broker) forward(client *broker.Client, pkt packet.Generic) {
+	// check packet
+	publish, ok := pkt.(*packet.Publish)
+	if !ok || publish.Message.QOS == 0 {
+		return
+	}
+
+	// acquire mutex
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// get tracked messages of connected client
+	inflight, ok := b.forwarded[client]
+	if !ok {
+		return
+	}
+
+	// track message, retransmissions keep the first timestamp
+	if _, ok := inflight[publish.ID]; !ok {
+		inflight[publish.ID] = time.Now()
+		b.inflight.Inc()
+	}
+}
+
+func (b *Broker) complete(client *broker.Client, pkt packet.Generic) {
+	// get id of acknowledgement
+	var id packet.ID
+	switch typedPkt := pkt.(type) {
+	case *packet.Puback:
+		id = typedPkt.ID
+	case *packet.Pubcomp:
+		id = typedPkt.ID
+	default:
+		return
+	}
+
+	// acquire mutex
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// get start
+	start, ok := b.forwarded[client][id]
+	if !ok {
+		return
+	}
+
+	// remove message
+	delete(b.forwarded[client], id)
+	b.inflight.Dec()
+
+	// observe latency
+	b.latency.Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/broker"
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroker(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	metrics, err := NewBroker(reg)
+	assert.NoError(t, err)
+
+	var logged int64
+
+	backend := broker.NewMemoryBackend()
+	backend.Logger = metrics.Logger(func(broker.LogEvent, *broker.Client, packet.Generic, *packet.Message, error) {
+		atomic.AddInt64(&logged, 1)
+	})
+
+	port, quit, done := broker.Run(broker.NewEngine(backend), "tcp")
+
+	client1 := client.New()
+
+	cf, err := client1.Connect(client.NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(10*time.Second))
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.clients))
+
+	received := make(chan struct{})
+	client1.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		close(received)
+		return nil
+	}
+
+	sf, err := client1.Subscribe("test", 1)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(10*time.Second))
+
+	pf, err := client1.Publish("test", []byte("test"), 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(10*time.Second))
+
+	<-received
+
+	// wait for acknowledgement
+	for i := 0; i < 100 && latencySamples(t, reg) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	err = client1.Disconnect()
+	assert.NoError(t, err)
+
+	ret := backend.Close(5 * time.Second)
+	assert.True(t, ret)
+
+	close(quit)
+
+	<-done
+
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.clients))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.packetsReceived.WithLabelValues("Connect")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.packetsReceived.WithLabelValues("Publish")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.packetsSent.WithLabelValues("Puback")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.packetsReceived.WithLabelValues("Puback")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.inflight))
+	assert.Equal(t, uint64(1), latencySamples(t, reg))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.messages.WithLabelValues(string(broker.MessagePublished))))
+	assert.True(t, atomic.LoadInt64(&logged) > 0)
+
+	metrics.Log(broker.LimitExceeded, nil, packet.NewSubscribe(), nil, nil)
+	metrics.Log(broker.LimitExceeded, nil, nil, &packet.Message{Topic: "test"}, nil)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.limits.WithLabelValues("subscriptions")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.limits.WithLabelValues("fan_out")))
+
+	metrics.Log(broker.SessionExpired, nil, nil, nil, &broker.ExpiredSession{ID: "test"})
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.expiries))
+
+	metrics.Log(broker.PacketTooLarge, nil, nil, &packet.Message{Topic: "test"}, nil)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.limits.WithLabelValues("packet_size")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.messages.WithLabelValues(string(broker.PacketTooLarge))))
+
+	metrics.Log(broker.SendQueueFull, nil, nil, &packet.Message{Topic: "test"}, nil)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.limits.WithLabelValues("send_queue")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.messages.WithLabelValues(string(broker.SendQueueFull))))
+}
+
+func TestBrokerRegisterError(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	_, err := NewBroker(reg)
+	assert.NoError(t, err)
+
+	_, err = NewBroker(reg)
+	assert.Error(t, err)
+}
+
+func latencySamples(t *testing.T, reg *prometheus.Registry) uint64 {
+	families, err := reg.Gather()
+	assert.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() == "mqtt_broker_publish_latency_seconds" {
+			return family.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,206 @@
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Client collects metrics of clients that use a dialer returned by Dialer.
+type Client struct {
+	packetsReceived *prometheus.CounterVec
+	packetsSent     *prometheus.CounterVec
+	connects        prometheus.Counter
+	reconnects      prometheus.Counter
+	inflight        prometheus.Gauge
+	latency         prometheus.Histogram
+}
+
+// NewClient creates the client metrics and registers them on the provided
+// registerer.
+func NewClient(reg prometheus.Registerer) (*Client, error) {
+	// create metrics
+	c := &Client{
+		packetsReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mqtt",
+			Subsystem: "client",
+			Name:      "packets_received_total",
+			Help:      "The number of received packets by type.",
+		}, []string{"type"}),
+		packetsSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mqtt",
+			Subsystem: "client",
+			Name:      "packets_sent_total",
+			Help:      "The number of sent packets by type.",
+		}, []string{"type"}),
+		connects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "mqtt",
+			Subsystem: "client",
+			Name:      "connects_total",
+			Help:      "The number of established connections.",
+		}),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "mqtt",
+			Subsystem: "client",
+			Name:      "reconnects_total",
+			Help:      "The number of connections established after the first one.",
+		}),
+		inflight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "mqtt",
+			Subsystem: "client",
+			Name:      "inflight_messages",
+			Help:      "The number of sent messages awaiting acknowledgement.",
+		}),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "mqtt",
+			Subsystem: "client",
+			Name:      "publish_latency_seconds",
+			Help:      "The time until a sent message with QOS 1 or 2 is acknowledged.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+	}
+
+	// register metrics
+	err := register(reg, c.packetsReceived, c.packetsSent, c.connects, c.reconnects, c.inflight, c.latency)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Dialer returns a dialer that instruments the connections of the specified
+// dialer. If no dialer is specified, transport.Dial is used.
+func (c *Client) Dialer(dialer client.Dialer) client.Dialer {
+	return &clientDialer{
+		metrics: c,
+		dialer:  dialer,
+	}
+}
+
+type clientDialer struct {
+	metrics *Client
+	dialer  client.Dialer
+	dials   uint32
+}
+
+func (d *clientDialer) Dial(urlString string) (transport.Conn, error) {
+	// dial connection
+	var conn transport.Conn
+	var err error
+	if d.dialer != nil {
+		conn, err = d.dialer.Dial(urlString)
+	} else {
+		conn, err = transport.Dial(urlString)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// count connection
+	d.metrics.connects.Inc()
+	if atomic.AddUint32(&d.dials, 1) > 1 {
+		d.metrics.reconnects.Inc()
+	}
+
+	return &clientConn{
+		Conn:     conn,
+		metrics:  d.metrics,
+		inflight: make(map[packet.ID]time.Time),
+	}, nil
+}
+
+type clientConn struct {
+	transport.Conn
+
+	metrics  *Client
+	inflight map[packet.ID]time.Time
+	closed   bool
+	mutex    sync.Mutex
+}
+
+func (c *clientConn) Unwrap() transport.Conn {
+	return c.Conn
+}
+
+func (c *clientConn) Send(pkt packet.Generic, async bool) error {
+	// send packet
+	err := c.Conn.Send(pkt, async)
+	if err != nil {
+		return err
+	}
+
+	// count packet
+	c.metrics.packetsSent.WithLabelValues(pkt.Type().String()).Inc()
+
+	// track outgoing messages
+	if publish, ok := pkt.(*packet.Publish); ok && publish.Message.QOS > 0 {
+		c.mutex.Lock()
+		if _, ok := c.inflight[publish.ID]; !ok && !c.closed {
+			c.inflight[publish.ID] = time.Now()
+			c.metrics.inflight.Inc()
+		}
+		c.mutex.Unlock()
+	}
+
+	return nil
+}
+
+func (c *clientConn) Receive() (packet.Generic, error) {
+	// receive packet
+	pkt, err := c.Conn.Receive()
+	if err != nil {
+		return nil, err
+	}
+
+	// count packet
+	c.metrics.packetsReceived.WithLabelValues(pkt.Type().String()).Inc()
+
+	// complete outgoing messages
+	switch typedPkt := pkt.(type) {
+	case *packet.Puback:
+		c.complete(typedPkt.ID)
+	case *packet.Pubcomp:
+		c.complete(typedPkt.ID)
+	}
+
+	return pkt, nil
+}
+
+func (c *clientConn) Close() error {
+	// release inflight messages
+	c.mutex.Lock()
+	if !c.closed {
+		c.closed = true
+		c.metrics.inflight.Sub(float64(len(c.inflight)))
+		c.inflight = nil
+	}
+	c.mutex.Unlock()
+
+	return c.Conn.Close()
+}
+
+func (c *clientConn) complete(id packet.ID) {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// get start
+	start, ok := c.inflight[id]
+	if !ok {
+		return
+	}
+
+	// remove message
+	delete(c.inflight, id)
+	c.metrics.inflight.Dec()
+
+	// observe latency
+	c.metrics.latency.Observe(time.Since(start).Seconds())
+}
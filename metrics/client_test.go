@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/broker"
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/transport"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	metrics, err := NewClient(prometheus.NewRegistry())
+	assert.NoError(t, err)
+
+	backend := broker.NewMemoryBackend()
+
+	port, quit, done := broker.Run(broker.NewEngine(backend), "tcp")
+
+	config := client.NewConfig("tcp://localhost:" + port)
+	config.Dialer = metrics.Dialer(transport.NewDialer())
+
+	for i := 0; i < 2; i++ {
+		client1 := client.New()
+
+		cf, err := client1.Connect(config)
+		assert.NoError(t, err)
+		assert.NoError(t, cf.Wait(10*time.Second))
+
+		pf, err := client1.Publish("test", []byte("test"), 2, false)
+		assert.NoError(t, err)
+		assert.NoError(t, pf.Wait(10*time.Second))
+
+		err = client1.Disconnect()
+		assert.NoError(t, err)
+	}
+
+	ret := backend.Close(5 * time.Second)
+	assert.True(t, ret)
+
+	close(quit)
+
+	<-done
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.connects))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.reconnects))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.inflight))
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.packetsSent.WithLabelValues("Publish")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.packetsReceived.WithLabelValues("Pubcomp")))
+}
+
+func TestClientDefaultDialer(t *testing.T) {
+	metrics, err := NewClient(prometheus.NewRegistry())
+	assert.NoError(t, err)
+
+	_, err = metrics.Dialer(nil).Dial("tcp://localhost:1")
+	assert.Error(t, err)
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.connects))
+}
@@ -0,0 +1,18 @@
+// Package metrics implements optional prometheus metrics for clients and
+// brokers. Clients are instrumented by wrapping their dialer while brokers are
+// instrumented using the log events of the backend. Nothing is collected
+// unless the metrics are explicitly wired up.
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+func register(reg prometheus.Registerer, collectors ...prometheus.Collector) error {
+	for _, collector := range collectors {
+		err := reg.Register(collector)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
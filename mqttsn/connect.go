@@ -0,0 +1,692 @@
+package mqttsn
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// ProtocolID is the protocol id transmitted in Connect packets.
+const ProtocolID byte = 0x01
+
+// A Connect packet is sent by a client to setup a connection.
+type Connect struct {
+	// The will flag requests the gateway to ask for the will topic and message.
+	Will bool
+
+	// The clean session flag.
+	CleanSession bool
+
+	// The keep alive duration in seconds.
+	Duration uint16
+
+	// The clients client id.
+	ClientID string
+}
+
+// NewConnect creates a new Connect packet.
+func NewConnect() *Connect {
+	return &Connect{
+		CleanSession: true,
+	}
+}
+
+// Type returns the packets type.
+func (cp *Connect) Type() Type {
+	return CONNECT
+}
+
+// String returns a string representation of the packet.
+func (cp *Connect) String() string {
+	return fmt.Sprintf("<Connect ClientID=%q Duration=%d Will=%t CleanSession=%t>",
+		cp.ClientID, cp.Duration, cp.Will, cp.CleanSession)
+}
+
+// Len returns the byte length of the encoded packet.
+func (cp *Connect) Len() int {
+	return packetLen(cp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (cp *Connect) Decode(src []byte) (int, error) {
+	return packetDecode(src, cp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (cp *Connect) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, cp)
+}
+
+func (cp *Connect) len() int {
+	return 4 + len(cp.ClientID)
+}
+
+func (cp *Connect) encode(dst []byte) error {
+	// check client id
+	if len(cp.ClientID) == 0 {
+		return makeError(cp.Type(), "client id is empty")
+	}
+
+	// write flags
+	dst[0], _ = encodeFlags(flags{will: cp.Will, cleanSession: cp.CleanSession}, cp.Type())
+
+	// write protocol id, duration and client id
+	dst[1] = ProtocolID
+	binary.BigEndian.PutUint16(dst[2:], cp.Duration)
+	copy(dst[4:], cp.ClientID)
+
+	return nil
+}
+
+func (cp *Connect) decode(src []byte) error {
+	// check length
+	err := checkMinLen(src, 5, cp.Type())
+	if err != nil {
+		return err
+	}
+
+	// read flags
+	f, err := decodeFlags(src[0], cp.Type())
+	if err != nil {
+		return err
+	}
+
+	// check protocol id
+	if src[1] != ProtocolID {
+		return makeError(cp.Type(), "invalid protocol id (%d)", src[1])
+	}
+
+	// set fields
+	cp.Will = f.will
+	cp.CleanSession = f.cleanSession
+	cp.Duration = binary.BigEndian.Uint16(src[2:])
+	cp.ClientID = string(src[4:])
+
+	return nil
+}
+
+// A Connack packet is sent by the gateway in response to a Connect packet.
+type Connack struct {
+	// The return code.
+	ReturnCode ReturnCode
+}
+
+// NewConnack creates a new Connack packet.
+func NewConnack() *Connack {
+	return &Connack{}
+}
+
+// Type returns the packets type.
+func (cp *Connack) Type() Type {
+	return CONNACK
+}
+
+// String returns a string representation of the packet.
+func (cp *Connack) String() string {
+	return fmt.Sprintf("<Connack ReturnCode=%d>", cp.ReturnCode)
+}
+
+// Len returns the byte length of the encoded packet.
+func (cp *Connack) Len() int {
+	return packetLen(cp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (cp *Connack) Decode(src []byte) (int, error) {
+	return packetDecode(src, cp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (cp *Connack) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, cp)
+}
+
+func (cp *Connack) len() int {
+	return 1
+}
+
+func (cp *Connack) encode(dst []byte) error {
+	return returnCodeEncode(dst, cp.ReturnCode, cp.Type())
+}
+
+func (cp *Connack) decode(src []byte) (err error) {
+	cp.ReturnCode, err = returnCodeDecode(src, cp.Type())
+	return err
+}
+
+// A WillTopicReq packet is sent by the gateway to request the will topic.
+type WillTopicReq struct{}
+
+// NewWillTopicReq creates a new WillTopicReq packet.
+func NewWillTopicReq() *WillTopicReq {
+	return &WillTopicReq{}
+}
+
+// Type returns the packets type.
+func (wp *WillTopicReq) Type() Type {
+	return WILLTOPICREQ
+}
+
+// String returns a string representation of the packet.
+func (wp *WillTopicReq) String() string {
+	return "<WillTopicReq>"
+}
+
+// Len returns the byte length of the encoded packet.
+func (wp *WillTopicReq) Len() int {
+	return packetLen(wp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (wp *WillTopicReq) Decode(src []byte) (int, error) {
+	return packetDecode(src, wp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (wp *WillTopicReq) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, wp)
+}
+
+func (wp *WillTopicReq) len() int {
+	return 0
+}
+
+func (wp *WillTopicReq) encode([]byte) error {
+	return nil
+}
+
+func (wp *WillTopicReq) decode(src []byte) error {
+	return checkLen(src, 0, wp.Type())
+}
+
+// A WillTopic packet is sent by the client in response to a WillTopicReq
+// packet. An empty packet without a topic deletes the will.
+type WillTopic struct {
+	// The QOS level of the will message.
+	QOS QOS
+
+	// The retain flag of the will message.
+	Retain bool
+
+	// The topic of the will message.
+	Topic string
+}
+
+// NewWillTopic creates a new WillTopic packet.
+func NewWillTopic() *WillTopic {
+	return &WillTopic{}
+}
+
+// Type returns the packets type.
+func (wp *WillTopic) Type() Type {
+	return WILLTOPIC
+}
+
+// String returns a string representation of the packet.
+func (wp *WillTopic) String() string {
+	return fmt.Sprintf("<WillTopic Topic=%q QOS=%d Retain=%t>", wp.Topic, wp.QOS, wp.Retain)
+}
+
+// Len returns the byte length of the encoded packet.
+func (wp *WillTopic) Len() int {
+	return packetLen(wp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (wp *WillTopic) Decode(src []byte) (int, error) {
+	return packetDecode(src, wp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (wp *WillTopic) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, wp)
+}
+
+func (wp *WillTopic) len() int {
+	return willTopicLen(wp.Topic)
+}
+
+func (wp *WillTopic) encode(dst []byte) error {
+	return willTopicEncode(dst, wp.QOS, wp.Retain, wp.Topic, wp.Type())
+}
+
+func (wp *WillTopic) decode(src []byte) (err error) {
+	wp.QOS, wp.Retain, wp.Topic, err = willTopicDecode(src, wp.Type())
+	return err
+}
+
+// A WillMsgReq packet is sent by the gateway to request the will message.
+type WillMsgReq struct{}
+
+// NewWillMsgReq creates a new WillMsgReq packet.
+func NewWillMsgReq() *WillMsgReq {
+	return &WillMsgReq{}
+}
+
+// Type returns the packets type.
+func (wp *WillMsgReq) Type() Type {
+	return WILLMSGREQ
+}
+
+// String returns a string representation of the packet.
+func (wp *WillMsgReq) String() string {
+	return "<WillMsgReq>"
+}
+
+// Len returns the byte length of the encoded packet.
+func (wp *WillMsgReq) Len() int {
+	return packetLen(wp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (wp *WillMsgReq) Decode(src []byte) (int, error) {
+	return packetDecode(src, wp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (wp *WillMsgReq) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, wp)
+}
+
+func (wp *WillMsgReq) len() int {
+	return 0
+}
+
+func (wp *WillMsgReq) encode([]byte) error {
+	return nil
+}
+
+func (wp *WillMsgReq) decode(src []byte) error {
+	return checkLen(src, 0, wp.Type())
+}
+
+// A WillMsg packet is sent by the client in response to a WillMsgReq packet.
+type WillMsg struct {
+	// The payload of the will message.
+	Payload []byte
+}
+
+// NewWillMsg creates a new WillMsg packet.
+func NewWillMsg() *WillMsg {
+	return &WillMsg{}
+}
+
+// Type returns the packets type.
+func (wp *WillMsg) Type() Type {
+	return WILLMSG
+}
+
+// String returns a string representation of the packet.
+func (wp *WillMsg) String() string {
+	return fmt.Sprintf("<WillMsg Payload=%v>", wp.Payload)
+}
+
+// Len returns the byte length of the encoded packet.
+func (wp *WillMsg) Len() int {
+	return packetLen(wp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (wp *WillMsg) Decode(src []byte) (int, error) {
+	return packetDecode(src, wp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (wp *WillMsg) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, wp)
+}
+
+func (wp *WillMsg) len() int {
+	return len(wp.Payload)
+}
+
+func (wp *WillMsg) encode(dst []byte) error {
+	copy(dst, wp.Payload)
+	return nil
+}
+
+func (wp *WillMsg) decode(src []byte) error {
+	wp.Payload = payloadDecode(src)
+	return nil
+}
+
+// A WillTopicUpd packet is sent by the client to update its will topic.
+// An empty packet without a topic deletes the will.
+type WillTopicUpd struct {
+	// The QOS level of the will message.
+	QOS QOS
+
+	// The retain flag of the will message.
+	Retain bool
+
+	// The topic of the will message.
+	Topic string
+}
+
+// NewWillTopicUpd creates a new WillTopicUpd packet.
+func NewWillTopicUpd() *WillTopicUpd {
+	return &WillTopicUpd{}
+}
+
+// Type returns the packets type.
+func (wp *WillTopicUpd) Type() Type {
+	return WILLTOPICUPD
+}
+
+// String returns a string representation of the packet.
+func (wp *WillTopicUpd) String() string {
+	return fmt.Sprintf("<WillTopicUpd Topic=%q QOS=%d Retain=%t>", wp.Topic, wp.QOS, wp.Retain)
+}
+
+// Len returns the byte length of the encoded packet.
+func (wp *WillTopicUpd) Len() int {
+	return packetLen(wp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (wp *WillTopicUpd) Decode(src []byte) (int, error) {
+	return packetDecode(src, wp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (wp *WillTopicUpd) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, wp)
+}
+
+func (wp *WillTopicUpd) len() int {
+	return willTopicLen(wp.Topic)
+}
+
+func (wp *WillTopicUpd) encode(dst []byte) error {
+	return willTopicEncode(dst, wp.QOS, wp.Retain, wp.Topic, wp.Type())
+}
+
+func (wp *WillTopicUpd) decode(src []byte) (err error) {
+	wp.QOS, wp.Retain, wp.Topic, err = willTopicDecode(src, wp.Type())
+	return err
+}
+
+// A WillTopicResp packet is sent by the gateway in response to a WillTopicUpd
+// packet.
+type WillTopicResp struct {
+	// The return code.
+	ReturnCode ReturnCode
+}
+
+// NewWillTopicResp creates a new WillTopicResp packet.
+func NewWillTopicResp() *WillTopicResp {
+	return &WillTopicResp{}
+}
+
+// Type returns the packets type.
+func (wp *WillTopicResp) Type() Type {
+	return WILLTOPICRESP
+}
+
+// String returns a string representation of the packet.
+func (wp *WillTopicResp) String() string {
+	return fmt.Sprintf("<WillTopicResp ReturnCode=%d>", wp.ReturnCode)
+}
+
+// Len returns the byte length of the encoded packet.
+func (wp *WillTopicResp) Len() int {
+	return packetLen(wp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (wp *WillTopicResp) Decode(src []byte) (int, error) {
+	return packetDecode(src, wp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (wp *WillTopicResp) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, wp)
+}
+
+func (wp *WillTopicResp) len() int {
+	return 1
+}
+
+func (wp *WillTopicResp) encode(dst []byte) error {
+	return returnCodeEncode(dst, wp.ReturnCode, wp.Type())
+}
+
+func (wp *WillTopicResp) decode(src []byte) (err error) {
+	wp.ReturnCode, err = returnCodeDecode(src, wp.Type())
+	return err
+}
+
+// A WillMsgUpd packet is sent by the client to update its will message.
+type WillMsgUpd struct {
+	// The payload of the will message.
+	Payload []byte
+}
+
+// NewWillMsgUpd creates a new WillMsgUpd packet.
+func NewWillMsgUpd() *WillMsgUpd {
+	return &WillMsgUpd{}
+}
+
+// Type returns the packets type.
+func (wp *WillMsgUpd) Type() Type {
+	return WILLMSGUPD
+}
+
+// String returns a string representation of the packet.
+func (wp *WillMsgUpd) String() string {
+	return fmt.Sprintf("<WillMsgUpd Payload=%v>", wp.Payload)
+}
+
+// Len returns the byte length of the encoded packet.
+func (wp *WillMsgUpd) Len() int {
+	return packetLen(wp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (wp *WillMsgUpd) Decode(src []byte) (int, error) {
+	return packetDecode(src, wp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (wp *WillMsgUpd) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, wp)
+}
+
+func (wp *WillMsgUpd) len() int {
+	return len(wp.Payload)
+}
+
+func (wp *WillMsgUpd) encode(dst []byte) error {
+	copy(dst, wp.Payload)
+	return nil
+}
+
+func (wp *WillMsgUpd) decode(src []byte) error {
+	wp.Payload = payloadDecode(src)
+	return nil
+}
+
+// A WillMsgResp packet is sent by the gateway in response to a WillMsgUpd
+// packet.
+type WillMsgResp struct {
+	// The return code.
+	ReturnCode ReturnCode
+}
+
+// NewWillMsgResp creates a new WillMsgResp packet.
+func NewWillMsgResp() *WillMsgResp {
+	return &WillMsgResp{}
+}
+
+// Type returns the packets type.
+func (wp *WillMsgResp) Type() Type {
+	return WILLMSGRESP
+}
+
+// String returns a string representation of the packet.
+func (wp *WillMsgResp) String() string {
+	return fmt.Sprintf("<WillMsgResp ReturnCode=%d>", wp.ReturnCode)
+}
+
+// Len returns the byte length of the encoded packet.
+func (wp *WillMsgResp) Len() int {
+	return packetLen(wp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (wp *WillMsgResp) Decode(src []byte) (int, error) {
+	return packetDecode(src, wp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (wp *WillMsgResp) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, wp)
+}
+
+func (wp *WillMsgResp) len() int {
+	return 1
+}
+
+func (wp *WillMsgResp) encode(dst []byte) error {
+	return returnCodeEncode(dst, wp.ReturnCode, wp.Type())
+}
+
+func (wp *WillMsgResp) decode(src []byte) (err error) {
+	wp.ReturnCode, err = returnCodeDecode(src, wp.Type())
+	return err
+}
+
+// encodes a return code
+func returnCodeEncode(dst []byte, rc ReturnCode, t Type) error {
+	// check return code
+	if !rc.Valid() {
+		return makeError(t, "invalid return code (%d)", rc)
+	}
+
+	// write return code
+	dst[0] = byte(rc)
+
+	return nil
+}
+
+// decodes a return code
+func returnCodeDecode(src []byte, t Type) (ReturnCode, error) {
+	// check length
+	err := checkLen(src, 1, t)
+	if err != nil {
+		return 0, err
+	}
+
+	// read return code
+	rc := ReturnCode(src[0])
+	if !rc.Valid() {
+		return 0, makeError(t, "invalid return code (%d)", rc)
+	}
+
+	return rc, nil
+}
+
+// returns the length of a will topic body
+func willTopicLen(topic string) int {
+	// empty packets have no flags
+	if len(topic) == 0 {
+		return 0
+	}
+
+	return 1 + len(topic)
+}
+
+// encodes a will topic body
+func willTopicEncode(dst []byte, qos QOS, retain bool, topic string, t Type) error {
+	// empty packets have no flags
+	if len(topic) == 0 {
+		return nil
+	}
+
+	// check qos
+	if qos == QOSMinusOne {
+		return makeError(t, "invalid QOS level (%d)", qos)
+	}
+
+	// write flags
+	f, err := encodeFlags(flags{qos: qos, retain: retain}, t)
+	if err != nil {
+		return err
+	}
+	dst[0] = f
+
+	// write topic
+	copy(dst[1:], topic)
+
+	return nil
+}
+
+// decodes a will topic body
+func willTopicDecode(src []byte, t Type) (QOS, bool, string, error) {
+	// empty packets have no flags
+	if len(src) == 0 {
+		return 0, false, "", nil
+	}
+
+	// check length
+	err := checkMinLen(src, 2, t)
+	if err != nil {
+		return 0, false, "", err
+	}
+
+	// read flags
+	f, err := decodeFlags(src[0], t)
+	if err != nil {
+		return 0, false, "", err
+	}
+
+	// check qos
+	if f.qos == QOSMinusOne {
+		return 0, false, "", makeError(t, "invalid QOS level (%d)", f.qos)
+	}
+
+	return f.qos, f.retain, string(src[1:]), nil
+}
+
+// decodes a payload
+func payloadDecode(src []byte) []byte {
+	// leave empty payloads nil
+	if len(src) == 0 {
+		return nil
+	}
+
+	// copy payload
+	payload := make([]byte, len(src))
+	copy(payload, src)
+
+	return payload
+}
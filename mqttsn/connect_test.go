@@ -0,0 +1,76 @@
+package mqttsn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectInterface(t *testing.T) {
+	pkt := NewConnect()
+
+	assert.Equal(t, pkt.Type(), CONNECT)
+	assert.Equal(t, `<Connect ClientID="" Duration=0 Will=false CleanSession=true>`, pkt.String())
+}
+
+func TestConnectEncode(t *testing.T) {
+	pkt := NewConnect()
+	pkt.Will = true
+	pkt.Duration = 10
+	pkt.ClientID = "c"
+
+	buf, err := Encode(pkt)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{7, byte(CONNECT), 0x0C, ProtocolID, 0, 10, 'c'}, buf)
+}
+
+func TestConnectEncodeError(t *testing.T) {
+	_, err := Encode(NewConnect())
+	assert.Error(t, err)
+}
+
+func TestConnectDecodeError(t *testing.T) {
+	_, err := NewConnect().Decode([]byte{6, byte(CONNECT), 0x04, 0x02, 0, 10})
+	assert.Error(t, err)
+
+	_, err = NewConnect().Decode([]byte{7, byte(CONNECT), 0x04, 0x02, 0, 10, 'c'})
+	assert.Error(t, err)
+
+	_, err = NewConnect().Decode([]byte{7, byte(CONNECT), 0x03, ProtocolID, 0, 10, 'c'})
+	assert.Error(t, err)
+}
+
+func TestConnackDecodeError(t *testing.T) {
+	_, err := NewConnack().Decode([]byte{3, byte(CONNACK), 4})
+	assert.Error(t, err)
+
+	_, err = Encode(&Connack{ReturnCode: 4})
+	assert.Error(t, err)
+}
+
+func TestWillTopicEmpty(t *testing.T) {
+	buf, err := Encode(&WillTopic{QOS: QOSAtLeastOnce})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2, byte(WILLTOPIC)}, buf)
+
+	pkt, err := Decode(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, &WillTopic{}, pkt)
+}
+
+func TestWillTopicErrors(t *testing.T) {
+	_, err := Encode(&WillTopic{QOS: QOSMinusOne, Topic: "t"})
+	assert.Error(t, err)
+
+	_, err = NewWillTopic().Decode([]byte{3, byte(WILLTOPIC), 0x00})
+	assert.Error(t, err)
+
+	_, err = NewWillTopicUpd().Decode([]byte{4, byte(WILLTOPICUPD), 0x60, 't'})
+	assert.Error(t, err)
+}
+
+func TestWillMsgEmpty(t *testing.T) {
+	pkt, err := Decode([]byte{2, byte(WILLMSG)})
+	assert.NoError(t, err)
+	assert.Equal(t, &WillMsg{}, pkt)
+}
@@ -0,0 +1,208 @@
+package mqttsn
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// An Advertise packet is broadcast periodically by a gateway to advertise its
+// presence.
+type Advertise struct {
+	// The id of the gateway.
+	GatewayID byte
+
+	// The time interval in seconds until the next Advertise is broadcast.
+	Duration uint16
+}
+
+// NewAdvertise creates a new Advertise packet.
+func NewAdvertise() *Advertise {
+	return &Advertise{}
+}
+
+// Type returns the packets type.
+func (ap *Advertise) Type() Type {
+	return ADVERTISE
+}
+
+// String returns a string representation of the packet.
+func (ap *Advertise) String() string {
+	return fmt.Sprintf("<Advertise GatewayID=%d Duration=%d>", ap.GatewayID, ap.Duration)
+}
+
+// Len returns the byte length of the encoded packet.
+func (ap *Advertise) Len() int {
+	return packetLen(ap)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (ap *Advertise) Decode(src []byte) (int, error) {
+	return packetDecode(src, ap)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (ap *Advertise) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, ap)
+}
+
+func (ap *Advertise) len() int {
+	return 3
+}
+
+func (ap *Advertise) encode(dst []byte) error {
+	dst[0] = ap.GatewayID
+	binary.BigEndian.PutUint16(dst[1:], ap.Duration)
+	return nil
+}
+
+func (ap *Advertise) decode(src []byte) error {
+	// check length
+	err := checkLen(src, 3, ap.Type())
+	if err != nil {
+		return err
+	}
+
+	// read fields
+	ap.GatewayID = src[0]
+	ap.Duration = binary.BigEndian.Uint16(src[1:])
+
+	return nil
+}
+
+// A SearchGW packet is broadcast by a client to search for available gateways.
+type SearchGW struct {
+	// The broadcast radius of the packet.
+	Radius byte
+}
+
+// NewSearchGW creates a new SearchGW packet.
+func NewSearchGW() *SearchGW {
+	return &SearchGW{}
+}
+
+// Type returns the packets type.
+func (sp *SearchGW) Type() Type {
+	return SEARCHGW
+}
+
+// String returns a string representation of the packet.
+func (sp *SearchGW) String() string {
+	return fmt.Sprintf("<SearchGW Radius=%d>", sp.Radius)
+}
+
+// Len returns the byte length of the encoded packet.
+func (sp *SearchGW) Len() int {
+	return packetLen(sp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (sp *SearchGW) Decode(src []byte) (int, error) {
+	return packetDecode(src, sp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (sp *SearchGW) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, sp)
+}
+
+func (sp *SearchGW) len() int {
+	return 1
+}
+
+func (sp *SearchGW) encode(dst []byte) error {
+	dst[0] = sp.Radius
+	return nil
+}
+
+func (sp *SearchGW) decode(src []byte) error {
+	// check length
+	err := checkLen(src, 1, sp.Type())
+	if err != nil {
+		return err
+	}
+
+	// read radius
+	sp.Radius = src[0]
+
+	return nil
+}
+
+// A GWInfo packet is sent by a gateway or client in response to a SearchGW
+// packet.
+type GWInfo struct {
+	// The id of the gateway.
+	GatewayID byte
+
+	// The address of the gateway. It is only present if the packet is sent
+	// by a client.
+	GatewayAddress []byte
+}
+
+// NewGWInfo creates a new GWInfo packet.
+func NewGWInfo() *GWInfo {
+	return &GWInfo{}
+}
+
+// Type returns the packets type.
+func (gp *GWInfo) Type() Type {
+	return GWINFO
+}
+
+// String returns a string representation of the packet.
+func (gp *GWInfo) String() string {
+	return fmt.Sprintf("<GWInfo GatewayID=%d GatewayAddress=%v>", gp.GatewayID, gp.GatewayAddress)
+}
+
+// Len returns the byte length of the encoded packet.
+func (gp *GWInfo) Len() int {
+	return packetLen(gp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (gp *GWInfo) Decode(src []byte) (int, error) {
+	return packetDecode(src, gp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (gp *GWInfo) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, gp)
+}
+
+func (gp *GWInfo) len() int {
+	return 1 + len(gp.GatewayAddress)
+}
+
+func (gp *GWInfo) encode(dst []byte) error {
+	dst[0] = gp.GatewayID
+	copy(dst[1:], gp.GatewayAddress)
+	return nil
+}
+
+func (gp *GWInfo) decode(src []byte) error {
+	// check length
+	err := checkMinLen(src, 1, gp.Type())
+	if err != nil {
+		return err
+	}
+
+	// read gateway id
+	gp.GatewayID = src[0]
+
+	// read gateway address
+	gp.GatewayAddress = nil
+	if len(src) > 1 {
+		gp.GatewayAddress = make([]byte, len(src)-1)
+		copy(gp.GatewayAddress, src[1:])
+	}
+
+	return nil
+}
@@ -0,0 +1,401 @@
+// Package mqttsn implements functionality for encoding and decoding MQTT-SN 1.2
+// packets and transmitting them over UDP.
+package mqttsn
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// QOS is the type used to store quality of service levels. In contrast to MQTT,
+// MQTT-SN additionally supports the level -1 that allows clients to publish
+// messages to a gateway without setting up a connection.
+type QOS int8
+
+const (
+	// QOSAtMostOnce defines that the message is delivered at most once, or it
+	// may not be delivered at all.
+	QOSAtMostOnce QOS = 0
+
+	// QOSAtLeastOnce defines that the message is always delivered at least once.
+	QOSAtLeastOnce QOS = 1
+
+	// QOSExactlyOnce defines that the message is always delivered exactly once.
+	QOSExactlyOnce QOS = 2
+
+	// QOSMinusOne defines that the message is published without a connection
+	// using a predefined topic id or a short topic name.
+	QOSMinusOne QOS = -1
+)
+
+// Valid returns if the quality of service level is valid.
+func (qos QOS) Valid() bool {
+	return qos >= QOSMinusOne && qos <= QOSExactlyOnce
+}
+
+// TopicIDType defines how the topic id of a packet is interpreted.
+type TopicIDType byte
+
+const (
+	// NormalTopicID denotes a topic id that has been registered using a
+	// Register packet or a full topic name in Subscribe and Unsubscribe packets.
+	NormalTopicID TopicIDType = iota
+
+	// PredefinedTopicID denotes a topic id that is known in advance by both the
+	// client and the gateway.
+	PredefinedTopicID
+
+	// ShortTopicName denotes a topic name that consists of exactly two
+	// characters which are transmitted in place of the topic id.
+	ShortTopicName
+)
+
+// Valid returns if the topic id type is valid.
+func (t TopicIDType) Valid() bool {
+	return t <= ShortTopicName
+}
+
+// ShortTopic returns the topic id that represents the supplied two character
+// topic name.
+func ShortTopic(name string) uint16 {
+	if len(name) != 2 {
+		panic("short topic names must have two characters")
+	}
+
+	return binary.BigEndian.Uint16([]byte(name))
+}
+
+// ReturnCode is the type used to store the return codes of acknowledgement
+// packets.
+type ReturnCode byte
+
+// All available return codes.
+const (
+	Accepted ReturnCode = iota
+	RejectedCongestion
+	RejectedInvalidTopicID
+	RejectedNotSupported
+)
+
+// Valid returns if the return code is valid.
+func (rc ReturnCode) Valid() bool {
+	return rc <= RejectedNotSupported
+}
+
+// String returns the corresponding error string for the return code.
+func (rc ReturnCode) String() string {
+	switch rc {
+	case Accepted:
+		return "accepted"
+	case RejectedCongestion:
+		return "rejected: congestion"
+	case RejectedInvalidTopicID:
+		return "rejected: invalid topic id"
+	case RejectedNotSupported:
+		return "rejected: not supported"
+	}
+
+	return "invalid return code"
+}
+
+// Generic is an MQTT-SN packet that can be encoded to a buffer or decoded from
+// a buffer.
+type Generic interface {
+	// Type returns the packets type.
+	Type() Type
+
+	// Len returns the byte length of the encoded packet.
+	Len() int
+
+	// Decode reads from the byte slice argument. It returns the total number of
+	// bytes decoded, and whether there have been any errors during the process.
+	Decode(src []byte) (int, error)
+
+	// Encode writes the packet bytes into the byte slice from the argument. It
+	// returns the number of bytes encoded and whether there's any errors along
+	// the way. If there is an error, the byte slice should be considered invalid.
+	Encode(dst []byte) (int, error)
+
+	// String returns a string representation of the packet.
+	String() string
+}
+
+// Error represents decoding and encoding errors.
+type Error struct {
+	Type Type
+
+	format    string
+	arguments []interface{}
+}
+
+func makeError(typ Type, format string, arguments ...interface{}) *Error {
+	return &Error{Type: typ, format: format, arguments: arguments}
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf(e.format, e.arguments...)
+}
+
+// DetectPacket tries to detect the next packet in a buffer. It returns a length
+// greater than zero if the packet has been detected as well as its Type.
+func DetectPacket(src []byte) (int, Type) {
+	// check for minimum size
+	if len(src) < 2 {
+		return 0, 0
+	}
+
+	// read short header
+	if src[0] != 0x01 {
+		return int(src[0]), Type(src[1])
+	}
+
+	// check for long header size
+	if len(src) < 4 {
+		return 0, 0
+	}
+
+	return int(binary.BigEndian.Uint16(src[1:])), Type(src[3])
+}
+
+// Decode detects and decodes the packet in the supplied buffer.
+func Decode(src []byte) (Generic, error) {
+	// detect packet
+	l, t := DetectPacket(src)
+	if l <= 0 {
+		return nil, makeError(t, "insufficient buffer size, expected at least 2, got %d", len(src))
+	}
+
+	// create packet
+	pkt, err := t.New()
+	if err != nil {
+		return nil, err
+	}
+
+	// decode packet
+	_, err = pkt.Decode(src)
+	if err != nil {
+		return nil, err
+	}
+
+	return pkt, nil
+}
+
+// Encode allocates a buffer and encodes the supplied packet.
+func Encode(pkt Generic) ([]byte, error) {
+	// allocate buffer
+	buf := make([]byte, pkt.Len())
+
+	// encode packet
+	_, err := pkt.Encode(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// a body is implemented by all packets to share the header handling
+type body interface {
+	Type() Type
+	len() int
+	encode(dst []byte) error
+	decode(src []byte) error
+}
+
+// returns the length of the header for the specified body length
+func headerLen(bl int) int {
+	if bl+2 < 256 {
+		return 2
+	}
+
+	return 4
+}
+
+// returns the total length of the packet
+func packetLen(b body) int {
+	bl := b.len()
+	return headerLen(bl) + bl
+}
+
+// encodes the header and the body of a packet
+func packetEncode(dst []byte, b body) (int, error) {
+	// get lengths
+	bl := b.len()
+	hl := headerLen(bl)
+	tl := hl + bl
+
+	// check total length
+	if tl > 65535 {
+		return 0, makeError(b.Type(), "packet length (%d) out of bound (max %d)", tl, 65535)
+	}
+
+	// check buffer length
+	if len(dst) < tl {
+		return 0, makeError(b.Type(), "insufficient buffer size, expected %d, got %d", tl, len(dst))
+	}
+
+	// write length
+	if hl == 2 {
+		dst[0] = byte(tl)
+	} else {
+		dst[0] = 0x01
+		binary.BigEndian.PutUint16(dst[1:], uint16(tl))
+	}
+
+	// write type
+	dst[hl-1] = byte(b.Type())
+
+	// write body
+	err := b.encode(dst[hl:tl])
+	if err != nil {
+		return hl, err
+	}
+
+	return tl, nil
+}
+
+// decodes the header and the body of a packet
+func packetDecode(src []byte, b body) (int, error) {
+	// detect packet
+	tl, t := DetectPacket(src)
+	if tl <= 0 {
+		return 0, makeError(b.Type(), "insufficient buffer size, expected at least 2, got %d", len(src))
+	}
+
+	// get header length
+	hl := 2
+	if src[0] == 0x01 {
+		hl = 4
+	}
+
+	// check type
+	if t != b.Type() {
+		return hl, makeError(b.Type(), "invalid type %d", t)
+	}
+
+	// check total length
+	if tl < hl {
+		return hl, makeError(b.Type(), "invalid packet length (%d)", tl)
+	}
+
+	// check buffer length
+	if len(src) < tl {
+		return hl, makeError(b.Type(), "insufficient buffer size, expected %d, got %d", tl, len(src))
+	}
+
+	// decode body
+	err := b.decode(src[hl:tl])
+	if err != nil {
+		return hl, err
+	}
+
+	return tl, nil
+}
+
+// checks the body length
+func checkLen(src []byte, l int, t Type) error {
+	if len(src) != l {
+		return makeError(t, "invalid body length, expected %d, got %d", l, len(src))
+	}
+
+	return nil
+}
+
+// checks the minimum body length
+func checkMinLen(src []byte, l int, t Type) error {
+	if len(src) < l {
+		return makeError(t, "insufficient body length, expected at least %d, got %d", l, len(src))
+	}
+
+	return nil
+}
+
+// the flags carried by various packets
+type flags struct {
+	dup          bool
+	qos          QOS
+	retain       bool
+	will         bool
+	cleanSession bool
+	topicIDType  TopicIDType
+}
+
+// encodes the flags
+func encodeFlags(f flags, t Type) (byte, error) {
+	// check qos
+	if !f.qos.Valid() {
+		return 0, makeError(t, "invalid QOS level (%d)", f.qos)
+	}
+
+	// check topic id type
+	if !f.topicIDType.Valid() {
+		return 0, makeError(t, "invalid topic id type (%d)", f.topicIDType)
+	}
+
+	var b byte
+
+	// set dup flag
+	if f.dup {
+		b |= 0x80 // 10000000
+	}
+
+	// set qos
+	b |= (byte(f.qos) & 0x3) << 5 // 01100000
+
+	// set retain flag
+	if f.retain {
+		b |= 0x10 // 00010000
+	}
+
+	// set will flag
+	if f.will {
+		b |= 0x8 // 00001000
+	}
+
+	// set clean session flag
+	if f.cleanSession {
+		b |= 0x4 // 00000100
+	}
+
+	// set topic id type
+	b |= byte(f.topicIDType) // 00000011
+
+	return b, nil
+}
+
+// decodes the flags
+func decodeFlags(b byte, t Type) (flags, error) {
+	f := flags{
+		dup:          (b>>7)&0x1 == 1,
+		qos:          QOS((b >> 5) & 0x3),
+		retain:       (b>>4)&0x1 == 1,
+		will:         (b>>3)&0x1 == 1,
+		cleanSession: (b>>2)&0x1 == 1,
+		topicIDType:  TopicIDType(b & 0x3),
+	}
+
+	// convert qos -1
+	if f.qos == 3 {
+		f.qos = QOSMinusOne
+	}
+
+	// check topic id type
+	if !f.topicIDType.Valid() {
+		return f, makeError(t, "invalid topic id type (%d)", f.topicIDType)
+	}
+
+	return f, nil
+}
+
+// reads a packet id
+func readID(src []byte) packet.ID {
+	return packet.ID(binary.BigEndian.Uint16(src))
+}
+
+// writes a packet id
+func writeID(dst []byte, id packet.ID) {
+	binary.BigEndian.PutUint16(dst, uint16(id))
+}
@@ -0,0 +1,183 @@
+package mqttsn
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPackets() []Generic {
+	return []Generic{
+		&Advertise{GatewayID: 1, Duration: 900},
+		&SearchGW{Radius: 2},
+		&GWInfo{GatewayID: 1, GatewayAddress: []byte{192, 168, 0, 1}},
+		&Connect{Will: true, CleanSession: true, Duration: 30, ClientID: "c1"},
+		&Connack{ReturnCode: RejectedCongestion},
+		&WillTopicReq{},
+		&WillTopic{QOS: QOSAtLeastOnce, Retain: true, Topic: "will"},
+		&WillMsgReq{},
+		&WillMsg{Payload: []byte("bye")},
+		&Register{TopicID: 1, ID: 2, TopicName: "foo/bar"},
+		&Regack{TopicID: 1, ID: 2, ReturnCode: Accepted},
+		&Publish{Dup: true, QOS: QOSExactlyOnce, Retain: true, TopicIDType: PredefinedTopicID, TopicID: 7, ID: 3, Data: []byte("data")},
+		&Puback{TopicID: 7, ID: 3, ReturnCode: RejectedInvalidTopicID},
+		&Pubcomp{ID: 3},
+		&Pubrec{ID: 3},
+		&Pubrel{ID: 3},
+		&Subscribe{QOS: QOSAtLeastOnce, ID: 4, TopicName: "foo/#"},
+		&Suback{QOS: QOSAtLeastOnce, TopicID: 8, ID: 4, ReturnCode: Accepted},
+		&Unsubscribe{TopicIDType: ShortTopicName, ID: 5, TopicID: ShortTopic("ab")},
+		&Unsuback{ID: 5},
+		&Pingreq{ClientID: "c1"},
+		&Pingresp{},
+		&Disconnect{Duration: 60},
+		&WillTopicUpd{QOS: QOSExactlyOnce, Topic: "will"},
+		&WillTopicResp{ReturnCode: Accepted},
+		&WillMsgUpd{Payload: []byte("bye")},
+		&WillMsgResp{ReturnCode: RejectedNotSupported},
+	}
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	for _, pkt := range testPackets() {
+		buf, err := Encode(pkt)
+		assert.NoError(t, err, pkt.Type().String())
+		assert.Equal(t, pkt.Len(), len(buf), pkt.Type().String())
+
+		l, typ := DetectPacket(buf)
+		assert.Equal(t, len(buf), l, pkt.Type().String())
+		assert.Equal(t, pkt.Type(), typ, pkt.Type().String())
+
+		pkt2, err := Decode(buf)
+		assert.NoError(t, err, pkt.Type().String())
+		assert.Equal(t, pkt, pkt2, pkt.Type().String())
+		assert.Equal(t, pkt.String(), pkt2.String())
+	}
+}
+
+func TestPacketLongHeader(t *testing.T) {
+	pkt := &Publish{
+		TopicIDType: PredefinedTopicID,
+		TopicID:     1,
+		Data:        bytes.Repeat([]byte{1}, 300),
+	}
+
+	buf, err := Encode(pkt)
+	assert.NoError(t, err)
+	assert.Equal(t, 309, len(buf))
+	assert.Equal(t, []byte{0x01, 0x01, 0x35, byte(PUBLISH)}, buf[:4])
+
+	pkt2, err := Decode(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, pkt, pkt2)
+}
+
+func TestDetectPacket(t *testing.T) {
+	l, typ := DetectPacket([]byte{2})
+	assert.Equal(t, 0, l)
+	assert.Equal(t, Type(0), typ)
+
+	l, typ = DetectPacket([]byte{2, byte(PINGRESP)})
+	assert.Equal(t, 2, l)
+	assert.Equal(t, PINGRESP, typ)
+
+	l, typ = DetectPacket([]byte{0x01, 0x01})
+	assert.Equal(t, 0, l)
+	assert.Equal(t, Type(0), typ)
+
+	l, typ = DetectPacket([]byte{0x01, 0x01, 0x00, byte(PUBLISH)})
+	assert.Equal(t, 256, l)
+	assert.Equal(t, PUBLISH, typ)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	_, err := Decode([]byte{2})
+	assert.Error(t, err)
+
+	_, err = Decode([]byte{2, 0x03})
+	assert.Equal(t, ErrInvalidPacketType, err)
+
+	_, err = Decode([]byte{3, byte(PINGRESP), 0})
+	assert.Error(t, err)
+
+	_, err = Decode([]byte{4, byte(CONNACK), 0})
+	assert.Error(t, err)
+
+	_, err = Decode([]byte{1, byte(CONNACK)})
+	assert.Error(t, err)
+}
+
+func TestEncodeErrors(t *testing.T) {
+	_, err := NewPingresp().Encode(make([]byte, 1))
+	assert.Error(t, err)
+
+	_, err = NewRegister().Encode(make([]byte, 16))
+	assert.Error(t, err)
+
+	_, err = Encode(&Publish{TopicIDType: PredefinedTopicID, Data: make([]byte, 65535)})
+	assert.Error(t, err)
+}
+
+func TestPacketDecodeWrongType(t *testing.T) {
+	_, err := NewConnack().Decode([]byte{3, byte(REGACK), 0})
+	assert.Error(t, err)
+}
+
+func TestReturnCodes(t *testing.T) {
+	assert.Equal(t, "accepted", Accepted.String())
+	assert.Equal(t, "rejected: congestion", RejectedCongestion.String())
+	assert.Equal(t, "rejected: invalid topic id", RejectedInvalidTopicID.String())
+	assert.Equal(t, "rejected: not supported", RejectedNotSupported.String())
+	assert.Equal(t, "invalid return code", ReturnCode(4).String())
+	assert.False(t, ReturnCode(4).Valid())
+}
+
+func TestQOSValid(t *testing.T) {
+	assert.True(t, QOSMinusOne.Valid())
+	assert.True(t, QOSAtMostOnce.Valid())
+	assert.True(t, QOSExactlyOnce.Valid())
+	assert.False(t, QOS(3).Valid())
+	assert.False(t, QOS(-2).Valid())
+}
+
+func TestShortTopic(t *testing.T) {
+	assert.Equal(t, uint16(0x6162), ShortTopic("ab"))
+
+	assert.Panics(t, func() {
+		ShortTopic("abc")
+	})
+}
+
+func TestFlags(t *testing.T) {
+	b, err := encodeFlags(flags{
+		dup:          true,
+		qos:          QOSMinusOne,
+		retain:       true,
+		will:         true,
+		cleanSession: true,
+		topicIDType:  ShortTopicName,
+	}, PUBLISH)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0xFE), b)
+
+	f, err := decodeFlags(b, PUBLISH)
+	assert.NoError(t, err)
+	assert.Equal(t, flags{
+		dup:          true,
+		qos:          QOSMinusOne,
+		retain:       true,
+		will:         true,
+		cleanSession: true,
+		topicIDType:  ShortTopicName,
+	}, f)
+
+	_, err = encodeFlags(flags{qos: 3}, PUBLISH)
+	assert.Error(t, err)
+
+	_, err = encodeFlags(flags{topicIDType: 3}, PUBLISH)
+	assert.Error(t, err)
+
+	_, err = decodeFlags(0x03, PUBLISH)
+	assert.Error(t, err)
+}
@@ -0,0 +1,184 @@
+package mqttsn
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// A Pingreq packet is sent by a client to keep the connection alive. Sleeping
+// clients include their client id to receive buffered messages.
+type Pingreq struct {
+	// The client id of a sleeping client.
+	ClientID string
+}
+
+// NewPingreq creates a new Pingreq packet.
+func NewPingreq() *Pingreq {
+	return &Pingreq{}
+}
+
+// Type returns the packets type.
+func (pp *Pingreq) Type() Type {
+	return PINGREQ
+}
+
+// String returns a string representation of the packet.
+func (pp *Pingreq) String() string {
+	return fmt.Sprintf("<Pingreq ClientID=%q>", pp.ClientID)
+}
+
+// Len returns the byte length of the encoded packet.
+func (pp *Pingreq) Len() int {
+	return packetLen(pp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (pp *Pingreq) Decode(src []byte) (int, error) {
+	return packetDecode(src, pp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (pp *Pingreq) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, pp)
+}
+
+func (pp *Pingreq) len() int {
+	return len(pp.ClientID)
+}
+
+func (pp *Pingreq) encode(dst []byte) error {
+	copy(dst, pp.ClientID)
+	return nil
+}
+
+func (pp *Pingreq) decode(src []byte) error {
+	pp.ClientID = string(src)
+	return nil
+}
+
+// A Pingresp packet is sent in response to a Pingreq packet.
+type Pingresp struct{}
+
+// NewPingresp creates a new Pingresp packet.
+func NewPingresp() *Pingresp {
+	return &Pingresp{}
+}
+
+// Type returns the packets type.
+func (pp *Pingresp) Type() Type {
+	return PINGRESP
+}
+
+// String returns a string representation of the packet.
+func (pp *Pingresp) String() string {
+	return "<Pingresp>"
+}
+
+// Len returns the byte length of the encoded packet.
+func (pp *Pingresp) Len() int {
+	return packetLen(pp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (pp *Pingresp) Decode(src []byte) (int, error) {
+	return packetDecode(src, pp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (pp *Pingresp) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, pp)
+}
+
+func (pp *Pingresp) len() int {
+	return 0
+}
+
+func (pp *Pingresp) encode([]byte) error {
+	return nil
+}
+
+func (pp *Pingresp) decode(src []byte) error {
+	return checkLen(src, 0, pp.Type())
+}
+
+// A Disconnect packet is sent by a client to close the connection or to
+// announce that it goes to sleep. It is also sent by the gateway to close the
+// connection.
+type Disconnect struct {
+	// The sleep duration in seconds. A zero duration omits the field.
+	Duration uint16
+}
+
+// NewDisconnect creates a new Disconnect packet.
+func NewDisconnect() *Disconnect {
+	return &Disconnect{}
+}
+
+// Type returns the packets type.
+func (dp *Disconnect) Type() Type {
+	return DISCONNECT
+}
+
+// String returns a string representation of the packet.
+func (dp *Disconnect) String() string {
+	return fmt.Sprintf("<Disconnect Duration=%d>", dp.Duration)
+}
+
+// Len returns the byte length of the encoded packet.
+func (dp *Disconnect) Len() int {
+	return packetLen(dp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (dp *Disconnect) Decode(src []byte) (int, error) {
+	return packetDecode(src, dp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (dp *Disconnect) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, dp)
+}
+
+func (dp *Disconnect) len() int {
+	if dp.Duration > 0 {
+		return 2
+	}
+
+	return 0
+}
+
+func (dp *Disconnect) encode(dst []byte) error {
+	if dp.Duration > 0 {
+		binary.BigEndian.PutUint16(dst, dp.Duration)
+	}
+
+	return nil
+}
+
+func (dp *Disconnect) decode(src []byte) error {
+	// check for empty packet
+	if len(src) == 0 {
+		dp.Duration = 0
+		return nil
+	}
+
+	// check length
+	err := checkLen(src, 2, dp.Type())
+	if err != nil {
+		return err
+	}
+
+	// read duration
+	dp.Duration = binary.BigEndian.Uint16(src)
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package mqttsn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPingreqEmpty(t *testing.T) {
+	buf, err := Encode(NewPingreq())
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2, byte(PINGREQ)}, buf)
+}
+
+func TestDisconnectEmpty(t *testing.T) {
+	buf, err := Encode(NewDisconnect())
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2, byte(DISCONNECT)}, buf)
+
+	pkt, err := Decode(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, NewDisconnect(), pkt)
+
+	_, err = Decode([]byte{3, byte(DISCONNECT), 1})
+	assert.Error(t, err)
+}
@@ -0,0 +1,409 @@
+package mqttsn
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// A Publish packet is sent by a client or the gateway to transport a message.
+type Publish struct {
+	// The dup flag is set if the packet is retransmitted.
+	Dup bool
+
+	// The QOS level of the message.
+	QOS QOS
+
+	// The retain flag of the message.
+	Retain bool
+
+	// The type of the topic id.
+	TopicIDType TopicIDType
+
+	// The topic id, predefined topic id or short topic name.
+	TopicID uint16
+
+	// The packet identifier. It is only relevant for QOS levels 1 and 2.
+	ID packet.ID
+
+	// The published data.
+	Data []byte
+}
+
+// NewPublish creates a new Publish packet.
+func NewPublish() *Publish {
+	return &Publish{}
+}
+
+// Type returns the packets type.
+func (pp *Publish) Type() Type {
+	return PUBLISH
+}
+
+// String returns a string representation of the packet.
+func (pp *Publish) String() string {
+	return fmt.Sprintf("<Publish ID=%d TopicIDType=%d TopicID=%d QOS=%d Retain=%t Dup=%t Data=%v>",
+		pp.ID, pp.TopicIDType, pp.TopicID, pp.QOS, pp.Retain, pp.Dup, pp.Data)
+}
+
+// Len returns the byte length of the encoded packet.
+func (pp *Publish) Len() int {
+	return packetLen(pp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (pp *Publish) Decode(src []byte) (int, error) {
+	return packetDecode(src, pp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (pp *Publish) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, pp)
+}
+
+func (pp *Publish) len() int {
+	return 5 + len(pp.Data)
+}
+
+func (pp *Publish) encode(dst []byte) error {
+	// check packet id
+	if pp.QOS > QOSAtMostOnce && !pp.ID.Valid() {
+		return makeError(pp.Type(), "packet id must be grater than zero")
+	}
+
+	// check qos -1 topic id type
+	if pp.QOS == QOSMinusOne && pp.TopicIDType == NormalTopicID {
+		return makeError(pp.Type(), "normal topic ids are not allowed with QOS level -1")
+	}
+
+	// write flags
+	f, err := encodeFlags(flags{
+		dup:         pp.Dup,
+		qos:         pp.QOS,
+		retain:      pp.Retain,
+		topicIDType: pp.TopicIDType,
+	}, pp.Type())
+	if err != nil {
+		return err
+	}
+	dst[0] = f
+
+	// write topic id
+	binary.BigEndian.PutUint16(dst[1:], pp.TopicID)
+
+	// write packet id
+	if pp.QOS > QOSAtMostOnce {
+		writeID(dst[3:], pp.ID)
+	} else {
+		writeID(dst[3:], 0)
+	}
+
+	// write data
+	copy(dst[5:], pp.Data)
+
+	return nil
+}
+
+func (pp *Publish) decode(src []byte) error {
+	// check length
+	err := checkMinLen(src, 5, pp.Type())
+	if err != nil {
+		return err
+	}
+
+	// read flags
+	f, err := decodeFlags(src[0], pp.Type())
+	if err != nil {
+		return err
+	}
+
+	// set flags
+	pp.Dup = f.dup
+	pp.QOS = f.qos
+	pp.Retain = f.retain
+	pp.TopicIDType = f.topicIDType
+
+	// read topic id
+	pp.TopicID = binary.BigEndian.Uint16(src[1:])
+
+	// read packet id
+	pp.ID = 0
+	if pp.QOS > QOSAtMostOnce {
+		pp.ID = readID(src[3:])
+
+		// check packet id
+		if !pp.ID.Valid() {
+			return makeError(pp.Type(), "packet id must be grater than zero")
+		}
+	}
+
+	// read data
+	pp.Data = payloadDecode(src[5:])
+
+	return nil
+}
+
+// A Puback packet is sent in response to a Publish packet with QOS level 1 or
+// to reject a Publish packet with an invalid topic id.
+type Puback struct {
+	// The topic id of the acknowledged packet.
+	TopicID uint16
+
+	// The packet identifier.
+	ID packet.ID
+
+	// The return code.
+	ReturnCode ReturnCode
+}
+
+// NewPuback creates a new Puback packet.
+func NewPuback() *Puback {
+	return &Puback{}
+}
+
+// Type returns the packets type.
+func (pp *Puback) Type() Type {
+	return PUBACK
+}
+
+// String returns a string representation of the packet.
+func (pp *Puback) String() string {
+	return fmt.Sprintf("<Puback ID=%d TopicID=%d ReturnCode=%d>", pp.ID, pp.TopicID, pp.ReturnCode)
+}
+
+// Len returns the byte length of the encoded packet.
+func (pp *Puback) Len() int {
+	return packetLen(pp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (pp *Puback) Decode(src []byte) (int, error) {
+	return packetDecode(src, pp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (pp *Puback) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, pp)
+}
+
+func (pp *Puback) len() int {
+	return 5
+}
+
+func (pp *Puback) encode(dst []byte) error {
+	// write fields
+	binary.BigEndian.PutUint16(dst, pp.TopicID)
+	writeID(dst[2:], pp.ID)
+
+	return returnCodeEncode(dst[4:], pp.ReturnCode, pp.Type())
+}
+
+func (pp *Puback) decode(src []byte) (err error) {
+	// check length
+	err = checkLen(src, 5, pp.Type())
+	if err != nil {
+		return err
+	}
+
+	// read fields
+	pp.TopicID = binary.BigEndian.Uint16(src)
+	pp.ID = readID(src[2:])
+
+	// read return code
+	pp.ReturnCode, err = returnCodeDecode(src[4:], pp.Type())
+
+	return err
+}
+
+// A Pubrec packet is the response to a Publish packet with QOS level 2.
+type Pubrec struct {
+	// The packet identifier.
+	ID packet.ID
+}
+
+// NewPubrec creates a new Pubrec packet.
+func NewPubrec() *Pubrec {
+	return &Pubrec{}
+}
+
+// Type returns the packets type.
+func (pp *Pubrec) Type() Type {
+	return PUBREC
+}
+
+// String returns a string representation of the packet.
+func (pp *Pubrec) String() string {
+	return fmt.Sprintf("<Pubrec ID=%d>", pp.ID)
+}
+
+// Len returns the byte length of the encoded packet.
+func (pp *Pubrec) Len() int {
+	return packetLen(pp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (pp *Pubrec) Decode(src []byte) (int, error) {
+	return packetDecode(src, pp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (pp *Pubrec) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, pp)
+}
+
+func (pp *Pubrec) len() int {
+	return 2
+}
+
+func (pp *Pubrec) encode(dst []byte) error {
+	return identifiedEncode(dst, pp.ID, pp.Type())
+}
+
+func (pp *Pubrec) decode(src []byte) (err error) {
+	pp.ID, err = identifiedDecode(src, pp.Type())
+	return err
+}
+
+// A Pubrel packet is the response to a Pubrec packet.
+type Pubrel struct {
+	// The packet identifier.
+	ID packet.ID
+}
+
+// NewPubrel creates a new Pubrel packet.
+func NewPubrel() *Pubrel {
+	return &Pubrel{}
+}
+
+// Type returns the packets type.
+func (pp *Pubrel) Type() Type {
+	return PUBREL
+}
+
+// String returns a string representation of the packet.
+func (pp *Pubrel) String() string {
+	return fmt.Sprintf("<Pubrel ID=%d>", pp.ID)
+}
+
+// Len returns the byte length of the encoded packet.
+func (pp *Pubrel) Len() int {
+	return packetLen(pp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (pp *Pubrel) Decode(src []byte) (int, error) {
+	return packetDecode(src, pp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (pp *Pubrel) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, pp)
+}
+
+func (pp *Pubrel) len() int {
+	return 2
+}
+
+func (pp *Pubrel) encode(dst []byte) error {
+	return identifiedEncode(dst, pp.ID, pp.Type())
+}
+
+func (pp *Pubrel) decode(src []byte) (err error) {
+	pp.ID, err = identifiedDecode(src, pp.Type())
+	return err
+}
+
+// A Pubcomp packet is the response to a Pubrel packet.
+type Pubcomp struct {
+	// The packet identifier.
+	ID packet.ID
+}
+
+// NewPubcomp creates a new Pubcomp packet.
+func NewPubcomp() *Pubcomp {
+	return &Pubcomp{}
+}
+
+// Type returns the packets type.
+func (pp *Pubcomp) Type() Type {
+	return PUBCOMP
+}
+
+// String returns a string representation of the packet.
+func (pp *Pubcomp) String() string {
+	return fmt.Sprintf("<Pubcomp ID=%d>", pp.ID)
+}
+
+// Len returns the byte length of the encoded packet.
+func (pp *Pubcomp) Len() int {
+	return packetLen(pp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (pp *Pubcomp) Decode(src []byte) (int, error) {
+	return packetDecode(src, pp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (pp *Pubcomp) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, pp)
+}
+
+func (pp *Pubcomp) len() int {
+	return 2
+}
+
+func (pp *Pubcomp) encode(dst []byte) error {
+	return identifiedEncode(dst, pp.ID, pp.Type())
+}
+
+func (pp *Pubcomp) decode(src []byte) (err error) {
+	pp.ID, err = identifiedDecode(src, pp.Type())
+	return err
+}
+
+// encodes a packet id only body
+func identifiedEncode(dst []byte, id packet.ID, t Type) error {
+	// check packet id
+	if !id.Valid() {
+		return makeError(t, "packet id must be grater than zero")
+	}
+
+	// write packet id
+	writeID(dst, id)
+
+	return nil
+}
+
+// decodes a packet id only body
+func identifiedDecode(src []byte, t Type) (packet.ID, error) {
+	// check length
+	err := checkLen(src, 2, t)
+	if err != nil {
+		return 0, err
+	}
+
+	// read packet id
+	id := readID(src)
+	if !id.Valid() {
+		return 0, makeError(t, "packet id must be grater than zero")
+	}
+
+	return id, nil
+}
@@ -0,0 +1,74 @@
+package mqttsn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishInterface(t *testing.T) {
+	pkt := NewPublish()
+
+	assert.Equal(t, pkt.Type(), PUBLISH)
+	assert.Equal(t, "<Publish ID=0 TopicIDType=0 TopicID=0 QOS=0 Retain=false Dup=false Data=[]>", pkt.String())
+}
+
+func TestPublishEncode(t *testing.T) {
+	buf, err := Encode(&Publish{
+		QOS:         QOSAtLeastOnce,
+		TopicIDType: ShortTopicName,
+		TopicID:     ShortTopic("ab"),
+		ID:          1,
+		Data:        []byte("x"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{8, byte(PUBLISH), 0x22, 'a', 'b', 0, 1, 'x'}, buf)
+}
+
+func TestPublishMinusOne(t *testing.T) {
+	pkt := &Publish{
+		QOS:         QOSMinusOne,
+		TopicIDType: PredefinedTopicID,
+		TopicID:     1,
+		ID:          7,
+	}
+
+	buf, err := Encode(pkt)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{7, byte(PUBLISH), 0x61, 0, 1, 0, 0}, buf)
+
+	pkt2, err := Decode(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, &Publish{
+		QOS:         QOSMinusOne,
+		TopicIDType: PredefinedTopicID,
+		TopicID:     1,
+	}, pkt2)
+
+	_, err = Encode(&Publish{QOS: QOSMinusOne, TopicIDType: NormalTopicID})
+	assert.Error(t, err)
+}
+
+func TestPublishErrors(t *testing.T) {
+	_, err := Encode(&Publish{QOS: QOSAtLeastOnce})
+	assert.Error(t, err)
+
+	_, err = NewPublish().Decode([]byte{6, byte(PUBLISH), 0x00, 0, 1, 0})
+	assert.Error(t, err)
+
+	_, err = NewPublish().Decode([]byte{7, byte(PUBLISH), 0x20, 0, 1, 0, 0})
+	assert.Error(t, err)
+}
+
+func TestIdentifiedErrors(t *testing.T) {
+	for _, pkt := range []Generic{NewPubrec(), NewPubrel(), NewPubcomp(), NewUnsuback()} {
+		_, err := Encode(pkt)
+		assert.Error(t, err)
+
+		_, err = pkt.Decode([]byte{4, byte(pkt.Type()), 0, 0})
+		assert.Error(t, err)
+
+		_, err = pkt.Decode([]byte{3, byte(pkt.Type()), 1})
+		assert.Error(t, err)
+	}
+}
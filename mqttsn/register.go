@@ -0,0 +1,181 @@
+package mqttsn
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// A Register packet is sent by a client to request a topic id for a topic name
+// or by the gateway to inform the client about an assigned topic id.
+type Register struct {
+	// The topic id. It is zero if sent by a client.
+	TopicID uint16
+
+	// The packet identifier.
+	ID packet.ID
+
+	// The topic name.
+	TopicName string
+}
+
+// NewRegister creates a new Register packet.
+func NewRegister() *Register {
+	return &Register{}
+}
+
+// Type returns the packets type.
+func (rp *Register) Type() Type {
+	return REGISTER
+}
+
+// String returns a string representation of the packet.
+func (rp *Register) String() string {
+	return fmt.Sprintf("<Register ID=%d TopicID=%d TopicName=%q>", rp.ID, rp.TopicID, rp.TopicName)
+}
+
+// Len returns the byte length of the encoded packet.
+func (rp *Register) Len() int {
+	return packetLen(rp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (rp *Register) Decode(src []byte) (int, error) {
+	return packetDecode(src, rp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (rp *Register) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, rp)
+}
+
+func (rp *Register) len() int {
+	return 4 + len(rp.TopicName)
+}
+
+func (rp *Register) encode(dst []byte) error {
+	// check packet id
+	if !rp.ID.Valid() {
+		return makeError(rp.Type(), "packet id must be grater than zero")
+	}
+
+	// check topic name
+	if len(rp.TopicName) == 0 {
+		return makeError(rp.Type(), "topic name is empty")
+	}
+
+	// write fields
+	binary.BigEndian.PutUint16(dst, rp.TopicID)
+	writeID(dst[2:], rp.ID)
+	copy(dst[4:], rp.TopicName)
+
+	return nil
+}
+
+func (rp *Register) decode(src []byte) error {
+	// check length
+	err := checkMinLen(src, 5, rp.Type())
+	if err != nil {
+		return err
+	}
+
+	// read fields
+	rp.TopicID = binary.BigEndian.Uint16(src)
+	rp.ID = readID(src[2:])
+	rp.TopicName = string(src[4:])
+
+	// check packet id
+	if !rp.ID.Valid() {
+		return makeError(rp.Type(), "packet id must be grater than zero")
+	}
+
+	return nil
+}
+
+// A Regack packet is sent in response to a Register packet.
+type Regack struct {
+	// The assigned topic id.
+	TopicID uint16
+
+	// The packet identifier.
+	ID packet.ID
+
+	// The return code.
+	ReturnCode ReturnCode
+}
+
+// NewRegack creates a new Regack packet.
+func NewRegack() *Regack {
+	return &Regack{}
+}
+
+// Type returns the packets type.
+func (rp *Regack) Type() Type {
+	return REGACK
+}
+
+// String returns a string representation of the packet.
+func (rp *Regack) String() string {
+	return fmt.Sprintf("<Regack ID=%d TopicID=%d ReturnCode=%d>", rp.ID, rp.TopicID, rp.ReturnCode)
+}
+
+// Len returns the byte length of the encoded packet.
+func (rp *Regack) Len() int {
+	return packetLen(rp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (rp *Regack) Decode(src []byte) (int, error) {
+	return packetDecode(src, rp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (rp *Regack) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, rp)
+}
+
+func (rp *Regack) len() int {
+	return 5
+}
+
+func (rp *Regack) encode(dst []byte) error {
+	// check packet id
+	if !rp.ID.Valid() {
+		return makeError(rp.Type(), "packet id must be grater than zero")
+	}
+
+	// write fields
+	binary.BigEndian.PutUint16(dst, rp.TopicID)
+	writeID(dst[2:], rp.ID)
+
+	return returnCodeEncode(dst[4:], rp.ReturnCode, rp.Type())
+}
+
+func (rp *Regack) decode(src []byte) (err error) {
+	// check length
+	err = checkLen(src, 5, rp.Type())
+	if err != nil {
+		return err
+	}
+
+	// read fields
+	rp.TopicID = binary.BigEndian.Uint16(src)
+	rp.ID = readID(src[2:])
+
+	// check packet id
+	if !rp.ID.Valid() {
+		return makeError(rp.Type(), "packet id must be grater than zero")
+	}
+
+	// read return code
+	rp.ReturnCode, err = returnCodeDecode(src[4:], rp.Type())
+
+	return err
+}
@@ -0,0 +1,434 @@
+package mqttsn
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// A Subscribe packet is sent by a client to subscribe to a topic name, a
+// predefined topic id or a short topic name.
+type Subscribe struct {
+	// The dup flag is set if the packet is retransmitted.
+	Dup bool
+
+	// The requested QOS level.
+	QOS QOS
+
+	// The type of the topic.
+	TopicIDType TopicIDType
+
+	// The packet identifier.
+	ID packet.ID
+
+	// The topic name. It is only used with normal topic ids.
+	TopicName string
+
+	// The predefined topic id or short topic name. It is only used with
+	// predefined topic ids and short topic names.
+	TopicID uint16
+}
+
+// NewSubscribe creates a new Subscribe packet.
+func NewSubscribe() *Subscribe {
+	return &Subscribe{}
+}
+
+// Type returns the packets type.
+func (sp *Subscribe) Type() Type {
+	return SUBSCRIBE
+}
+
+// String returns a string representation of the packet.
+func (sp *Subscribe) String() string {
+	return fmt.Sprintf("<Subscribe ID=%d TopicIDType=%d TopicName=%q TopicID=%d QOS=%d Dup=%t>",
+		sp.ID, sp.TopicIDType, sp.TopicName, sp.TopicID, sp.QOS, sp.Dup)
+}
+
+// Len returns the byte length of the encoded packet.
+func (sp *Subscribe) Len() int {
+	return packetLen(sp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (sp *Subscribe) Decode(src []byte) (int, error) {
+	return packetDecode(src, sp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (sp *Subscribe) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, sp)
+}
+
+func (sp *Subscribe) len() int {
+	return 3 + topicLen(sp.TopicIDType, sp.TopicName)
+}
+
+func (sp *Subscribe) encode(dst []byte) error {
+	// check packet id
+	if !sp.ID.Valid() {
+		return makeError(sp.Type(), "packet id must be grater than zero")
+	}
+
+	// check qos
+	if sp.QOS == QOSMinusOne {
+		return makeError(sp.Type(), "invalid QOS level (%d)", sp.QOS)
+	}
+
+	// write flags
+	f, err := encodeFlags(flags{
+		dup:         sp.Dup,
+		qos:         sp.QOS,
+		topicIDType: sp.TopicIDType,
+	}, sp.Type())
+	if err != nil {
+		return err
+	}
+	dst[0] = f
+
+	// write packet id
+	writeID(dst[1:], sp.ID)
+
+	return topicEncode(dst[3:], sp.TopicIDType, sp.TopicName, sp.TopicID, sp.Type())
+}
+
+func (sp *Subscribe) decode(src []byte) error {
+	// check length
+	err := checkMinLen(src, 4, sp.Type())
+	if err != nil {
+		return err
+	}
+
+	// read flags
+	f, err := decodeFlags(src[0], sp.Type())
+	if err != nil {
+		return err
+	}
+
+	// check qos
+	if f.qos == QOSMinusOne {
+		return makeError(sp.Type(), "invalid QOS level (%d)", f.qos)
+	}
+
+	// set flags
+	sp.Dup = f.dup
+	sp.QOS = f.qos
+	sp.TopicIDType = f.topicIDType
+
+	// read packet id
+	sp.ID = readID(src[1:])
+	if !sp.ID.Valid() {
+		return makeError(sp.Type(), "packet id must be grater than zero")
+	}
+
+	// read topic
+	sp.TopicName, sp.TopicID, err = topicDecode(src[3:], sp.TopicIDType, sp.Type())
+
+	return err
+}
+
+// A Suback packet is sent by the gateway in response to a Subscribe packet.
+type Suback struct {
+	// The granted QOS level.
+	QOS QOS
+
+	// The assigned topic id. It is zero for wildcard subscriptions, short
+	// topic names and predefined topic ids.
+	TopicID uint16
+
+	// The packet identifier.
+	ID packet.ID
+
+	// The return code.
+	ReturnCode ReturnCode
+}
+
+// NewSuback creates a new Suback packet.
+func NewSuback() *Suback {
+	return &Suback{}
+}
+
+// Type returns the packets type.
+func (sp *Suback) Type() Type {
+	return SUBACK
+}
+
+// String returns a string representation of the packet.
+func (sp *Suback) String() string {
+	return fmt.Sprintf("<Suback ID=%d TopicID=%d QOS=%d ReturnCode=%d>",
+		sp.ID, sp.TopicID, sp.QOS, sp.ReturnCode)
+}
+
+// Len returns the byte length of the encoded packet.
+func (sp *Suback) Len() int {
+	return packetLen(sp)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (sp *Suback) Decode(src []byte) (int, error) {
+	return packetDecode(src, sp)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (sp *Suback) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, sp)
+}
+
+func (sp *Suback) len() int {
+	return 6
+}
+
+func (sp *Suback) encode(dst []byte) error {
+	// check packet id
+	if !sp.ID.Valid() {
+		return makeError(sp.Type(), "packet id must be grater than zero")
+	}
+
+	// write flags
+	f, err := encodeFlags(flags{qos: sp.QOS}, sp.Type())
+	if err != nil {
+		return err
+	}
+	dst[0] = f
+
+	// write fields
+	binary.BigEndian.PutUint16(dst[1:], sp.TopicID)
+	writeID(dst[3:], sp.ID)
+
+	return returnCodeEncode(dst[5:], sp.ReturnCode, sp.Type())
+}
+
+func (sp *Suback) decode(src []byte) error {
+	// check length
+	err := checkLen(src, 6, sp.Type())
+	if err != nil {
+		return err
+	}
+
+	// read flags
+	f, err := decodeFlags(src[0], sp.Type())
+	if err != nil {
+		return err
+	}
+
+	// read fields
+	sp.QOS = f.qos
+	sp.TopicID = binary.BigEndian.Uint16(src[1:])
+	sp.ID = readID(src[3:])
+
+	// check packet id
+	if !sp.ID.Valid() {
+		return makeError(sp.Type(), "packet id must be grater than zero")
+	}
+
+	// read return code
+	sp.ReturnCode, err = returnCodeDecode(src[5:], sp.Type())
+
+	return err
+}
+
+// An Unsubscribe packet is sent by a client to unsubscribe from a topic name,
+// a predefined topic id or a short topic name.
+type Unsubscribe struct {
+	// The type of the topic.
+	TopicIDType TopicIDType
+
+	// The packet identifier.
+	ID packet.ID
+
+	// The topic name. It is only used with normal topic ids.
+	TopicName string
+
+	// The predefined topic id or short topic name. It is only used with
+	// predefined topic ids and short topic names.
+	TopicID uint16
+}
+
+// NewUnsubscribe creates a new Unsubscribe packet.
+func NewUnsubscribe() *Unsubscribe {
+	return &Unsubscribe{}
+}
+
+// Type returns the packets type.
+func (up *Unsubscribe) Type() Type {
+	return UNSUBSCRIBE
+}
+
+// String returns a string representation of the packet.
+func (up *Unsubscribe) String() string {
+	return fmt.Sprintf("<Unsubscribe ID=%d TopicIDType=%d TopicName=%q TopicID=%d>",
+		up.ID, up.TopicIDType, up.TopicName, up.TopicID)
+}
+
+// Len returns the byte length of the encoded packet.
+func (up *Unsubscribe) Len() int {
+	return packetLen(up)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (up *Unsubscribe) Decode(src []byte) (int, error) {
+	return packetDecode(src, up)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (up *Unsubscribe) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, up)
+}
+
+func (up *Unsubscribe) len() int {
+	return 3 + topicLen(up.TopicIDType, up.TopicName)
+}
+
+func (up *Unsubscribe) encode(dst []byte) error {
+	// check packet id
+	if !up.ID.Valid() {
+		return makeError(up.Type(), "packet id must be grater than zero")
+	}
+
+	// write flags
+	f, err := encodeFlags(flags{topicIDType: up.TopicIDType}, up.Type())
+	if err != nil {
+		return err
+	}
+	dst[0] = f
+
+	// write packet id
+	writeID(dst[1:], up.ID)
+
+	return topicEncode(dst[3:], up.TopicIDType, up.TopicName, up.TopicID, up.Type())
+}
+
+func (up *Unsubscribe) decode(src []byte) error {
+	// check length
+	err := checkMinLen(src, 4, up.Type())
+	if err != nil {
+		return err
+	}
+
+	// read flags
+	f, err := decodeFlags(src[0], up.Type())
+	if err != nil {
+		return err
+	}
+
+	// set topic id type
+	up.TopicIDType = f.topicIDType
+
+	// read packet id
+	up.ID = readID(src[1:])
+	if !up.ID.Valid() {
+		return makeError(up.Type(), "packet id must be grater than zero")
+	}
+
+	// read topic
+	up.TopicName, up.TopicID, err = topicDecode(src[3:], up.TopicIDType, up.Type())
+
+	return err
+}
+
+// An Unsuback packet is sent by the gateway in response to an Unsubscribe
+// packet.
+type Unsuback struct {
+	// The packet identifier.
+	ID packet.ID
+}
+
+// NewUnsuback creates a new Unsuback packet.
+func NewUnsuback() *Unsuback {
+	return &Unsuback{}
+}
+
+// Type returns the packets type.
+func (up *Unsuback) Type() Type {
+	return UNSUBACK
+}
+
+// String returns a string representation of the packet.
+func (up *Unsuback) String() string {
+	return fmt.Sprintf("<Unsuback ID=%d>", up.ID)
+}
+
+// Len returns the byte length of the encoded packet.
+func (up *Unsuback) Len() int {
+	return packetLen(up)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (up *Unsuback) Decode(src []byte) (int, error) {
+	return packetDecode(src, up)
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (up *Unsuback) Encode(dst []byte) (int, error) {
+	return packetEncode(dst, up)
+}
+
+func (up *Unsuback) len() int {
+	return 2
+}
+
+func (up *Unsuback) encode(dst []byte) error {
+	return identifiedEncode(dst, up.ID, up.Type())
+}
+
+func (up *Unsuback) decode(src []byte) (err error) {
+	up.ID, err = identifiedDecode(src, up.Type())
+	return err
+}
+
+// returns the length of a topic name or topic id
+func topicLen(t TopicIDType, name string) int {
+	if t == NormalTopicID {
+		return len(name)
+	}
+
+	return 2
+}
+
+// encodes a topic name or topic id
+func topicEncode(dst []byte, tt TopicIDType, name string, id uint16, t Type) error {
+	// write topic id
+	if tt != NormalTopicID {
+		binary.BigEndian.PutUint16(dst, id)
+		return nil
+	}
+
+	// check topic name
+	if len(name) == 0 {
+		return makeError(t, "topic name is empty")
+	}
+
+	// write topic name
+	copy(dst, name)
+
+	return nil
+}
+
+// decodes a topic name or topic id
+func topicDecode(src []byte, tt TopicIDType, t Type) (string, uint16, error) {
+	// read topic name
+	if tt == NormalTopicID {
+		return string(src), 0, nil
+	}
+
+	// check length
+	err := checkLen(src, 2, t)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return "", binary.BigEndian.Uint16(src), nil
+}
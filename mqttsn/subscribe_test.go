@@ -0,0 +1,61 @@
+package mqttsn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribeEncode(t *testing.T) {
+	buf, err := Encode(&Subscribe{
+		QOS:       QOSExactlyOnce,
+		ID:        1,
+		TopicName: "a/+",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{8, byte(SUBSCRIBE), 0x40, 0, 1, 'a', '/', '+'}, buf)
+
+	buf, err = Encode(&Subscribe{
+		TopicIDType: PredefinedTopicID,
+		ID:          1,
+		TopicID:     5,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{7, byte(SUBSCRIBE), 0x01, 0, 1, 0, 5}, buf)
+}
+
+func TestSubscribeErrors(t *testing.T) {
+	_, err := Encode(&Subscribe{TopicName: "foo"})
+	assert.Error(t, err)
+
+	_, err = Encode(&Subscribe{ID: 1})
+	assert.Error(t, err)
+
+	_, err = Encode(&Subscribe{ID: 1, QOS: QOSMinusOne, TopicName: "foo"})
+	assert.Error(t, err)
+
+	_, err = NewSubscribe().Decode([]byte{6, byte(SUBSCRIBE), 0x60, 0, 1, 'a'})
+	assert.Error(t, err)
+
+	_, err = NewSubscribe().Decode([]byte{6, byte(SUBSCRIBE), 0x00, 0, 0, 'a'})
+	assert.Error(t, err)
+
+	_, err = NewSubscribe().Decode([]byte{6, byte(SUBSCRIBE), 0x01, 0, 1, 5})
+	assert.Error(t, err)
+}
+
+func TestSubackErrors(t *testing.T) {
+	_, err := Encode(&Suback{})
+	assert.Error(t, err)
+
+	_, err = NewSuback().Decode([]byte{8, byte(SUBACK), 0x00, 0, 1, 0, 0, 0})
+	assert.Error(t, err)
+}
+
+func TestUnsubscribeErrors(t *testing.T) {
+	_, err := Encode(&Unsubscribe{TopicName: "foo"})
+	assert.Error(t, err)
+
+	_, err = NewUnsubscribe().Decode([]byte{6, byte(UNSUBSCRIBE), 0x00, 0, 0, 'a'})
+	assert.Error(t, err)
+}
@@ -0,0 +1,27 @@
+package mqttsn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypes(t *testing.T) {
+	for _, pkt := range testPackets() {
+		assert.True(t, pkt.Type().Valid())
+		assert.NotEqual(t, "Unknown", pkt.Type().String())
+
+		pkt2, err := pkt.Type().New()
+		assert.NoError(t, err)
+		assert.Equal(t, pkt.Type(), pkt2.Type())
+	}
+}
+
+func TestTypeInvalid(t *testing.T) {
+	assert.False(t, Type(0x03).Valid())
+	assert.Equal(t, "Unknown", Type(0x03).String())
+
+	pkt, err := Type(0x03).New()
+	assert.Nil(t, pkt)
+	assert.Equal(t, ErrInvalidPacketType, err)
+}
@@ -0,0 +1,342 @@
+package mqttsn
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by Conn and Server if they have been closed.
+var ErrClosed = errors.New("closed")
+
+// ErrReadTimeout is returned by Conn.Receive if the read timeout has been
+// exceeded.
+var ErrReadTimeout = errors.New("read timeout")
+
+// maxDatagramSize is the maximum size of an MQTT-SN packet.
+const maxDatagramSize = 65535
+
+// incomingQueueSize is the amount of datagrams that are buffered per accepted
+// connection. Further datagrams are dropped until the queue has been drained.
+const incomingQueueSize = 64
+
+// A Conn exchanges MQTT-SN packets with a single remote peer over UDP. It is
+// either created by Dial or returned by Server.Accept.
+type Conn struct {
+	conn   *net.UDPConn
+	remote *net.UDPAddr
+	server *Server
+
+	incoming chan []byte
+	timeout  time.Duration
+
+	mutex  sync.Mutex
+	closed chan struct{}
+	once   sync.Once
+}
+
+// Dial will open a UDP socket that exchanges packets with the specified
+// address.
+func Dial(address string) (*Conn, error) {
+	// resolve address
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	// dial address
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{
+		conn:   conn,
+		remote: addr,
+		closed: make(chan struct{}),
+	}, nil
+}
+
+// Send will encode the packet and write it as a single datagram.
+func (c *Conn) Send(pkt Generic) error {
+	// check if closed
+	select {
+	case <-c.closed:
+		return ErrClosed
+	default:
+	}
+
+	// encode packet
+	buf, err := Encode(pkt)
+	if err != nil {
+		return err
+	}
+
+	// write to server socket
+	if c.server != nil {
+		_, err = c.conn.WriteToUDP(buf, c.remote)
+		return err
+	}
+
+	// write to connected socket
+	_, err = c.conn.Write(buf)
+
+	return err
+}
+
+// Receive will read the next datagram and decode the contained packet.
+func (c *Conn) Receive() (Generic, error) {
+	// get timeout
+	c.mutex.Lock()
+	timeout := c.timeout
+	c.mutex.Unlock()
+
+	// read from server
+	if c.server != nil {
+		return c.receiveQueued(timeout)
+	}
+
+	// set deadline
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	err := c.conn.SetReadDeadline(deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	// read datagram
+	buf := make([]byte, maxDatagramSize)
+	n, err := c.conn.Read(buf)
+	if err != nil {
+		// check if closed
+		select {
+		case <-c.closed:
+			return nil, ErrClosed
+		default:
+		}
+
+		// check timeout
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return nil, ErrReadTimeout
+		}
+
+		return nil, err
+	}
+
+	return Decode(buf[:n])
+}
+
+func (c *Conn) receiveQueued(timeout time.Duration) (Generic, error) {
+	// prepare timeout
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	// wait for datagram
+	select {
+	case buf := <-c.incoming:
+		return Decode(buf)
+	case <-expired:
+		return nil, ErrReadTimeout
+	case <-c.closed:
+		return nil, ErrClosed
+	case <-c.server.closed:
+		return nil, ErrClosed
+	}
+}
+
+// Close will close the connection. Connections returned by Server.Accept will
+// only be removed from the server and a later datagram from the same remote
+// address will create a new connection.
+func (c *Conn) Close() error {
+	var err error
+	c.once.Do(func() {
+		// signal close
+		close(c.closed)
+
+		// remove from server
+		if c.server != nil {
+			c.server.remove(c)
+			return
+		}
+
+		// close socket
+		err = c.conn.Close()
+	})
+
+	return err
+}
+
+// SetReadTimeout sets the maximum time Receive will wait for the next
+// datagram. A zero timeout disables the timeout.
+func (c *Conn) SetReadTimeout(timeout time.Duration) {
+	c.mutex.Lock()
+	c.timeout = timeout
+	c.mutex.Unlock()
+}
+
+// LocalAddr will return the local net address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr will return the remote net address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// A Server is a local UDP port that demultiplexes incoming datagrams by their
+// remote address into connections.
+type Server struct {
+	conn     *net.UDPConn
+	accepted chan *Conn
+
+	mutex sync.Mutex
+	conns map[string]*Conn
+
+	err    error
+	closed chan struct{}
+	once   sync.Once
+}
+
+// Listen will listen for datagrams on the specified address.
+func Listen(address string) (*Server, error) {
+	// resolve address
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	// listen on address
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// prepare server
+	s := &Server{
+		conn:     conn,
+		accepted: make(chan *Conn),
+		conns:    make(map[string]*Conn),
+		closed:   make(chan struct{}),
+	}
+
+	// run reader
+	go s.read()
+
+	return s, nil
+}
+
+func (s *Server) read() {
+	buf := make([]byte, maxDatagramSize)
+
+	for {
+		// read datagram
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			s.close(err)
+			return
+		}
+
+		// copy datagram
+		datagram := make([]byte, n)
+		copy(datagram, buf[:n])
+
+		// get or create connection
+		conn, created := s.lookup(addr)
+
+		// hand over new connection
+		if created {
+			select {
+			case s.accepted <- conn:
+			case <-s.closed:
+				return
+			}
+		}
+
+		// queue datagram or drop it if the queue is full
+		select {
+		case conn.incoming <- datagram:
+		default:
+		}
+	}
+}
+
+func (s *Server) lookup(addr *net.UDPAddr) (*Conn, bool) {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// check existing connection
+	conn, ok := s.conns[addr.String()]
+	if ok {
+		return conn, false
+	}
+
+	// create connection
+	conn = &Conn{
+		conn:     s.conn,
+		remote:   addr,
+		server:   s,
+		incoming: make(chan []byte, incomingQueueSize),
+		closed:   make(chan struct{}),
+	}
+
+	// store connection
+	s.conns[addr.String()] = conn
+
+	return conn, true
+}
+
+func (s *Server) remove(conn *Conn) {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// remove connection if still current
+	if s.conns[conn.remote.String()] == conn {
+		delete(s.conns, conn.remote.String())
+	}
+}
+
+// Accept will return the next connection for a previously unseen remote
+// address or block until one becomes available.
+func (s *Server) Accept() (*Conn, error) {
+	select {
+	case conn := <-s.accepted:
+		return conn, nil
+	case <-s.closed:
+		return nil, s.err
+	}
+}
+
+// Close will close the underlying socket and all accepted connections.
+func (s *Server) Close() error {
+	var err error
+	s.once.Do(func() {
+		s.err = ErrClosed
+		close(s.closed)
+		err = s.conn.Close()
+	})
+
+	return err
+}
+
+func (s *Server) close(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.closed)
+		_ = s.conn.Close()
+	})
+}
+
+// Addr returns the server's network address.
+func (s *Server) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
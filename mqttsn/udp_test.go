@@ -0,0 +1,101 @@
+package mqttsn
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUDP(t *testing.T) {
+	server, err := Listen("localhost:0")
+	assert.NoError(t, err)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		conn, err := server.Accept()
+		assert.NoError(t, err)
+
+		pkt, err := conn.Receive()
+		assert.NoError(t, err)
+		assert.Equal(t, &Connect{CleanSession: true, ClientID: "c1"}, pkt)
+
+		err = conn.Send(NewConnack())
+		assert.NoError(t, err)
+
+		pkt, err = conn.Receive()
+		assert.NoError(t, err)
+		assert.Equal(t, NewDisconnect(), pkt)
+
+		err = conn.Close()
+		assert.NoError(t, err)
+	}()
+
+	conn, err := Dial(server.Addr().String())
+	assert.NoError(t, err)
+	assert.Equal(t, server.Addr().String(), conn.RemoteAddr().String())
+	assert.NotNil(t, conn.LocalAddr())
+
+	err = conn.Send(&Connect{CleanSession: true, ClientID: "c1"})
+	assert.NoError(t, err)
+
+	pkt, err := conn.Receive()
+	assert.NoError(t, err)
+	assert.Equal(t, NewConnack(), pkt)
+
+	err = conn.Send(NewDisconnect())
+	assert.NoError(t, err)
+
+	<-done
+
+	err = conn.Close()
+	assert.NoError(t, err)
+
+	err = conn.Send(NewPingreq())
+	assert.Equal(t, ErrClosed, err)
+
+	err = server.Close()
+	assert.NoError(t, err)
+
+	_, err = server.Accept()
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestUDPReadTimeout(t *testing.T) {
+	server, err := Listen("localhost:0")
+	assert.NoError(t, err)
+
+	conn, err := Dial(server.Addr().String())
+	assert.NoError(t, err)
+
+	conn.SetReadTimeout(10 * time.Millisecond)
+
+	_, err = conn.Receive()
+	assert.Equal(t, ErrReadTimeout, err)
+
+	err = conn.Send(NewPingreq())
+	assert.NoError(t, err)
+
+	conn2, err := server.Accept()
+	assert.NoError(t, err)
+
+	_, err = conn2.Receive()
+	assert.NoError(t, err)
+
+	conn2.SetReadTimeout(10 * time.Millisecond)
+
+	_, err = conn2.Receive()
+	assert.Equal(t, ErrReadTimeout, err)
+
+	err = server.Close()
+	assert.NoError(t, err)
+
+	_, err = conn2.Receive()
+	assert.Equal(t, ErrClosed, err)
+
+	err = conn.Close()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,166 @@
+package packet
+
+// the minimum size of the arena buffer
+const minArenaBuffer = 4096
+
+// An Arena batch allocates the publish related packets and payloads of decoded
+// packets. Instead of allocating every packet separately, the arena allocates
+// slabs of packets and payload buffers that are reused after calling Reset.
+// This reduces the pressure on the garbage collector when processing bursts
+// of packets.
+//
+// Note: Packets and payloads obtained from an arena must not be used anymore
+// after the arena has been reset. Packets or messages that must outlive the
+// processing of a batch (e.g. to be stored in a session or queue) have to be
+// copied beforehand. An arena is not safe for concurrent use.
+type Arena struct {
+	publishes     []Publish
+	publishesUsed int
+	pubacks       []Puback
+	pubacksUsed   int
+	pubrecs       []Pubrec
+	pubrecsUsed   int
+	pubrels       []Pubrel
+	pubrelsUsed   int
+	pubcomps      []Pubcomp
+	pubcompsUsed  int
+	buffer        []byte
+	bufferUsed    int
+}
+
+// NewArena returns a new Arena that initially allocates slabs for the
+// specified number of packets. The slabs grow as needed.
+func NewArena(size int) *Arena {
+	// ensure size
+	if size < 1 {
+		size = 1
+	}
+
+	return &Arena{
+		publishes: make([]Publish, size),
+		pubacks:   make([]Puback, size),
+		pubrecs:   make([]Pubrec, size),
+		pubrels:   make([]Pubrel, size),
+		pubcomps:  make([]Pubcomp, size),
+	}
+}
+
+// New returns a new packet of the specified type. Publish, Puback, Pubrec,
+// Pubrel and Pubcomp packets are allocated from the arena while all other
+// packets are allocated normally.
+func (a *Arena) New(t Type) (Generic, error) {
+	switch t {
+	case PUBLISH:
+		if a.publishesUsed == len(a.publishes) {
+			a.publishes = make([]Publish, 2*len(a.publishes))
+			a.publishesUsed = 0
+		}
+
+		pkt := &a.publishes[a.publishesUsed]
+		*pkt = Publish{}
+		a.publishesUsed++
+		return pkt, nil
+	case PUBACK:
+		if a.pubacksUsed == len(a.pubacks) {
+			a.pubacks = make([]Puback, 2*len(a.pubacks))
+			a.pubacksUsed = 0
+		}
+
+		pkt := &a.pubacks[a.pubacksUsed]
+		*pkt = Puback{}
+		a.pubacksUsed++
+		return pkt, nil
+	case PUBREC:
+		if a.pubrecsUsed == len(a.pubrecs) {
+			a.pubrecs = make([]Pubrec, 2*len(a.pubrecs))
+			a.pubrecsUsed = 0
+		}
+
+		pkt := &a.pubrecs[a.pubrecsUsed]
+		*pkt = Pubrec{}
+		a.pubrecsUsed++
+		return pkt, nil
+	case PUBREL:
+		if a.pubrelsUsed == len(a.pubrels) {
+			a.pubrels = make([]Pubrel, 2*len(a.pubrels))
+			a.pubrelsUsed = 0
+		}
+
+		pkt := &a.pubrels[a.pubrelsUsed]
+		*pkt = Pubrel{}
+		a.pubrelsUsed++
+		return pkt, nil
+	case PUBCOMP:
+		if a.pubcompsUsed == len(a.pubcomps) {
+			a.pubcomps = make([]Pubcomp, 2*len(a.pubcomps))
+			a.pubcompsUsed = 0
+		}
+
+		pkt := &a.pubcomps[a.pubcompsUsed]
+		*pkt = Pubcomp{}
+		a.pubcompsUsed++
+		return pkt, nil
+	}
+
+	return t.New()
+}
+
+// Decode detects and decodes the next packet in the buffer using the arena to
+// allocate the packet and its payload. It returns the packet and the number
+// of bytes decoded.
+func (a *Arena) Decode(src []byte) (Generic, int, error) {
+	// detect packet
+	_, t := DetectPacket(src)
+
+	// create packet
+	pkt, err := a.New(t)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// decode publish packets using the arena buffer
+	var n int
+	if publish, ok := pkt.(*Publish); ok {
+		n, err = publish.decode(src, a.alloc, nil)
+	} else {
+		n, err = pkt.Decode(src)
+	}
+	if err != nil {
+		return nil, n, err
+	}
+
+	return pkt, n, nil
+}
+
+// Reset will release all packets and payloads allocated since the last reset
+// so the memory can be reused.
+func (a *Arena) Reset() {
+	a.publishesUsed = 0
+	a.pubacksUsed = 0
+	a.pubrecsUsed = 0
+	a.pubrelsUsed = 0
+	a.pubcompsUsed = 0
+	a.bufferUsed = 0
+}
+
+func (a *Arena) alloc(n int) []byte {
+	// grow buffer if too small
+	if n > len(a.buffer)-a.bufferUsed {
+		size := 2 * len(a.buffer)
+		if size < minArenaBuffer {
+			size = minArenaBuffer
+		}
+		if size < n {
+			size = n
+		}
+
+		a.buffer = make([]byte, size)
+		a.bufferUsed = 0
+	}
+
+	// cut slice with limited capacity
+	buf := a.buffer[a.bufferUsed : a.bufferUsed+n : a.bufferUsed+n]
+	a.bufferUsed += n
+
+	return buf
+}
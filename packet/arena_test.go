@@ -0,0 +1,149 @@
+package packet
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodePacket(pkt Generic) []byte {
+	buf := make([]byte, pkt.Len())
+	_, err := pkt.Encode(buf)
+	if err != nil {
+		panic(err)
+	}
+
+	return buf
+}
+
+func TestArena(t *testing.T) {
+	arena := NewArena(1)
+
+	for typ := CONNECT; typ <= DISCONNECT; typ++ {
+		pkt, err := arena.New(typ)
+		assert.NoError(t, err)
+		assert.Equal(t, typ, pkt.Type())
+	}
+
+	pkt, err := arena.New(0)
+	assert.Nil(t, pkt)
+	assert.Equal(t, ErrInvalidPacketType, err)
+}
+
+func TestArenaReuse(t *testing.T) {
+	arena := NewArena(2)
+
+	pkt1, _ := arena.New(PUBLISH)
+	pkt1.(*Publish).ID = 1
+	pkt2, _ := arena.New(PUBLISH)
+	pkt3, _ := arena.New(PUBLISH)
+	assert.False(t, pkt1 == pkt2)
+	assert.False(t, pkt2 == pkt3)
+
+	arena.Reset()
+
+	pkt4, _ := arena.New(PUBLISH)
+	assert.True(t, pkt3 == pkt4)
+	assert.Equal(t, NewPublish(), pkt4)
+}
+
+func TestArenaDecode(t *testing.T) {
+	arena := NewArena(1)
+
+	publish := NewPublish()
+	publish.Message.Topic = "foo"
+	publish.Message.Payload = []byte("bar")
+	publish.Message.QOS = 1
+	publish.ID = 7
+
+	puback := NewPuback()
+	puback.ID = 7
+
+	for _, pkt := range []Generic{publish, puback, NewPingreq()} {
+		buf := encodePacket(pkt)
+
+		decoded, n, err := arena.Decode(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, len(buf), n)
+		assert.Equal(t, pkt, decoded)
+	}
+
+	pkt, _, err := arena.Decode([]byte{0x30, 0x01, 0x00})
+	assert.Nil(t, pkt)
+	assert.Error(t, err)
+
+	pkt, _, err = arena.Decode([]byte{0x00})
+	assert.Nil(t, pkt)
+	assert.Equal(t, ErrInvalidPacketType, err)
+}
+
+func TestArenaPayloads(t *testing.T) {
+	arena := NewArena(1)
+
+	publish := NewPublish()
+	publish.Message.Topic = "foo"
+	publish.Message.Payload = []byte("bar")
+	buf := encodePacket(publish)
+
+	pkt1, _, err := arena.Decode(buf)
+	assert.NoError(t, err)
+	pkt2, _, err := arena.Decode(buf)
+	assert.NoError(t, err)
+
+	// payloads must not overlap
+	payload1 := pkt1.(*Publish).Message.Payload
+	payload2 := pkt2.(*Publish).Message.Payload
+	assert.Equal(t, 3, cap(payload1))
+	_ = append(payload1, 'x')
+	assert.Equal(t, []byte("bar"), payload2)
+
+	// large payloads
+	publish.Message.Payload = make([]byte, 2*minArenaBuffer)
+	pkt3, _, err := arena.Decode(encodePacket(publish))
+	assert.NoError(t, err)
+	assert.Len(t, pkt3.(*Publish).Message.Payload, 2*minArenaBuffer)
+}
+
+func TestDecoderArena(t *testing.T) {
+	buf := new(bytes.Buffer)
+	dec := NewDecoder(buf)
+	dec.Arena = NewArena(1)
+
+	publish := NewPublish()
+	publish.Message.Topic = "foo"
+	publish.Message.Payload = []byte("bar")
+	buf.Write(encodePacket(publish))
+	buf.Write(encodePacket(NewConnect()))
+
+	pkt, err := dec.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, publish, pkt)
+
+	pkt, err = dec.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, NewConnect(), pkt)
+}
+
+func BenchmarkArenaDecode(b *testing.B) {
+	arena := NewArena(100)
+
+	publish := NewPublish()
+	publish.Message.Topic = "foo/bar/baz"
+	publish.Message.Payload = make([]byte, 100)
+	buf := encodePacket(publish)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if i%100 == 0 {
+			arena.Reset()
+		}
+
+		_, _, err := arena.Decode(buf)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
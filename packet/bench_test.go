@@ -0,0 +1,190 @@
+package packet
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// The benchmarks in this file encode and decode every packet type in several
+// size classes and report allocations. The output of multiple runs can be
+// compared using benchstat:
+//
+//   go test -run=^$ -bench=Packet -benchmem -count=10 ./packet > old.txt
+//   go test -run=^$ -bench=Packet -benchmem -count=10 ./packet > new.txt
+//   benchstat old.txt new.txt
+//
+// The "bench" target of the Makefile runs the same command.
+
+type benchSize struct {
+	name string
+	size int
+}
+
+var benchSizes = []benchSize{
+	{name: "Small", size: 16},
+	{name: "Medium", size: 1024},
+	{name: "Large", size: 32 * 1024},
+}
+
+type benchPacket struct {
+	name string
+	pkt  Generic
+}
+
+func benchPayload(size int) []byte {
+	return bytes.Repeat([]byte{'x'}, size)
+}
+
+func benchTopic(size int) string {
+	// limit topic length
+	if size > 256 {
+		size = 256
+	}
+
+	return strings.Repeat("t", size)
+}
+
+func benchSubscriptions(size int) []Subscription {
+	// use one subscription per 16 bytes
+	subs := make([]Subscription, size/16)
+	for i := range subs {
+		subs[i] = Subscription{Topic: fmt.Sprintf("foo/%d/#", i), QOS: QOSAtLeastOnce}
+	}
+
+	return subs
+}
+
+func benchPackets() []benchPacket {
+	var list []benchPacket
+
+	// add fixed size packets
+	puback := NewPuback()
+	puback.ID = 1
+
+	pubrec := NewPubrec()
+	pubrec.ID = 1
+
+	pubrel := NewPubrel()
+	pubrel.ID = 1
+
+	pubcomp := NewPubcomp()
+	pubcomp.ID = 1
+
+	unsuback := NewUnsuback()
+	unsuback.ID = 1
+
+	for _, pkt := range []Generic{NewConnack(), puback, pubrec, pubrel, pubcomp, unsuback, NewPingreq(), NewPingresp(), NewDisconnect()} {
+		list = append(list, benchPacket{name: pkt.Type().String(), pkt: pkt})
+	}
+
+	// add variable size packets
+	for _, size := range benchSizes {
+		connect := NewConnect()
+		connect.ClientID = "client"
+		connect.Username = "user"
+		connect.Password = "pass"
+		connect.Will = &Message{
+			Topic:   benchTopic(size.size),
+			Payload: benchPayload(size.size),
+			QOS:     QOSAtLeastOnce,
+		}
+
+		publish := NewPublish()
+		publish.ID = 1
+		publish.Message = Message{
+			Topic:   benchTopic(size.size),
+			Payload: benchPayload(size.size),
+			QOS:     QOSAtLeastOnce,
+		}
+
+		subscribe := NewSubscribe()
+		subscribe.ID = 1
+		subscribe.Subscriptions = benchSubscriptions(size.size)
+
+		subs := benchSubscriptions(size.size)
+
+		suback := NewSuback()
+		suback.ID = 1
+		suback.ReturnCodes = make([]QOS, len(subs))
+
+		unsubscribe := NewUnsubscribe()
+		unsubscribe.ID = 1
+		for _, sub := range subs {
+			unsubscribe.Topics = append(unsubscribe.Topics, sub.Topic)
+		}
+
+		for _, pkt := range []Generic{connect, publish, subscribe, suback, unsubscribe} {
+			list = append(list, benchPacket{name: pkt.Type().String() + "/" + size.name, pkt: pkt})
+		}
+	}
+
+	return list
+}
+
+func BenchmarkPacketEncode(b *testing.B) {
+	for _, bp := range benchPackets() {
+		pkt := bp.pkt
+		buf := make([]byte, pkt.Len())
+
+		b.Run(bp.name, func(b *testing.B) {
+			b.SetBytes(int64(len(buf)))
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				_, err := pkt.Encode(buf)
+				if err != nil {
+					panic(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPacketDecode(b *testing.B) {
+	for _, bp := range benchPackets() {
+		buf := encodePacket(bp.pkt)
+		pkt, _ := bp.pkt.Type().New()
+
+		b.Run(bp.name, func(b *testing.B) {
+			b.SetBytes(int64(len(buf)))
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				_, err := pkt.Decode(buf)
+				if err != nil {
+					panic(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPacketStream(b *testing.B) {
+	for _, bp := range benchPackets() {
+		pkt := bp.pkt
+		size := pkt.Len()
+
+		b.Run(bp.name, func(b *testing.B) {
+			var buf bytes.Buffer
+			enc := NewEncoder(&buf, 0)
+			dec := NewDecoder(&buf)
+
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				err := enc.Write(pkt, false)
+				if err != nil {
+					panic(err)
+				}
+
+				_, err = dec.Read()
+				if err != nil {
+					panic(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package packet
+
+import "bytes"
+
+// Clone returns a deep copy of the packet. Payloads and slices are copied so
+// the clone does not alias the buffer the packet has been decoded from, e.g.
+// when decoded using an Arena. This allows a broker to safely hand out a
+// single decoded packet to many subscribers.
+func Clone(pkt Generic) Generic {
+	switch p := pkt.(type) {
+	case *Connect:
+		c := *p
+		c.Will = cloneMessage(p.Will)
+		return &c
+	case *Connack:
+		c := *p
+		return &c
+	case *Publish:
+		c := *p
+		c.Message = *cloneMessage(&p.Message)
+		return &c
+	case *Puback:
+		c := *p
+		return &c
+	case *Pubrec:
+		c := *p
+		return &c
+	case *Pubrel:
+		c := *p
+		return &c
+	case *Pubcomp:
+		c := *p
+		return &c
+	case *Subscribe:
+		c := *p
+		if p.Subscriptions != nil {
+			c.Subscriptions = make([]Subscription, len(p.Subscriptions))
+			copy(c.Subscriptions, p.Subscriptions)
+		}
+		return &c
+	case *Suback:
+		c := *p
+		if p.ReturnCodes != nil {
+			c.ReturnCodes = make([]QOS, len(p.ReturnCodes))
+			copy(c.ReturnCodes, p.ReturnCodes)
+		}
+		return &c
+	case *Unsubscribe:
+		c := *p
+		if p.Topics != nil {
+			c.Topics = make([]string, len(p.Topics))
+			copy(c.Topics, p.Topics)
+		}
+		return &c
+	case *Unsuback:
+		c := *p
+		return &c
+	case *Pingreq:
+		return &Pingreq{}
+	case *Pingresp:
+		return &Pingresp{}
+	case *Disconnect:
+		return &Disconnect{}
+	}
+
+	return nil
+}
+
+// Equal returns whether both packets have the same type and field values.
+// Nil and empty payloads and slices are considered equal.
+func Equal(a, b Generic) bool {
+	// check nil
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	// check type
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch p := a.(type) {
+	case *Connect:
+		q := b.(*Connect)
+		return p.ClientID == q.ClientID && p.KeepAlive == q.KeepAlive &&
+			p.Username == q.Username && p.Password == q.Password &&
+			p.CleanSession == q.CleanSession && p.Version == q.Version &&
+			equalMessage(p.Will, q.Will)
+	case *Connack:
+		return *p == *b.(*Connack)
+	case *Publish:
+		q := b.(*Publish)
+		return p.ID == q.ID && p.Dup == q.Dup && equalMessage(&p.Message, &q.Message)
+	case *Puback:
+		return *p == *b.(*Puback)
+	case *Pubrec:
+		return *p == *b.(*Pubrec)
+	case *Pubrel:
+		return *p == *b.(*Pubrel)
+	case *Pubcomp:
+		return *p == *b.(*Pubcomp)
+	case *Subscribe:
+		q := b.(*Subscribe)
+		if p.ID != q.ID || len(p.Subscriptions) != len(q.Subscriptions) {
+			return false
+		}
+		for i := range p.Subscriptions {
+			if p.Subscriptions[i] != q.Subscriptions[i] {
+				return false
+			}
+		}
+		return true
+	case *Suback:
+		q := b.(*Suback)
+		if p.ID != q.ID || len(p.ReturnCodes) != len(q.ReturnCodes) {
+			return false
+		}
+		for i := range p.ReturnCodes {
+			if p.ReturnCodes[i] != q.ReturnCodes[i] {
+				return false
+			}
+		}
+		return true
+	case *Unsubscribe:
+		q := b.(*Unsubscribe)
+		if p.ID != q.ID || len(p.Topics) != len(q.Topics) {
+			return false
+		}
+		for i := range p.Topics {
+			if p.Topics[i] != q.Topics[i] {
+				return false
+			}
+		}
+		return true
+	case *Unsuback:
+		return *p == *b.(*Unsuback)
+	}
+
+	// naked packets have no fields
+	return true
+}
+
+// cloneMessage returns a copy of the message with a copied payload
+func cloneMessage(msg *Message) *Message {
+	// check nil
+	if msg == nil {
+		return nil
+	}
+
+	return msg.Detach()
+}
+
+// equalMessage returns whether both messages are equal
+func equalMessage(a, b *Message) bool {
+	// check nil
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return a.Topic == b.Topic && a.QOS == b.QOS && a.Retain == b.Retain &&
+		bytes.Equal(a.Payload, b.Payload)
+}
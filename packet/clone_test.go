@@ -0,0 +1,63 @@
+package packet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClone(t *testing.T) {
+	for _, v := range Vectors() {
+		clone := Clone(v.Packet)
+		assert.Equal(t, v.Packet, clone, v.Name)
+		assert.True(t, Equal(v.Packet, clone), v.Name)
+
+		if v.Packet.Type() != PINGREQ && v.Packet.Type() != PINGRESP && v.Packet.Type() != DISCONNECT {
+			assert.False(t, v.Packet == clone, v.Name)
+		}
+	}
+
+	publish := NewPublish()
+	publish.Message.Topic = "foo"
+	publish.Message.Payload = []byte("bar")
+
+	clone := Clone(publish).(*Publish)
+	clone.Message.Payload[0] = 'z'
+	assert.Equal(t, []byte("bar"), publish.Message.Payload)
+
+	connect := NewConnect()
+	connect.Will = &Message{Topic: "foo", Payload: []byte("bar")}
+
+	clone2 := Clone(connect).(*Connect)
+	clone2.Will.Payload[0] = 'z'
+	assert.Equal(t, []byte("bar"), connect.Will.Payload)
+
+	subscribe := NewSubscribe()
+	subscribe.Subscriptions = []Subscription{{Topic: "foo"}}
+
+	clone3 := Clone(subscribe).(*Subscribe)
+	clone3.Subscriptions[0].Topic = "bar"
+	assert.Equal(t, "foo", subscribe.Subscriptions[0].Topic)
+}
+
+func TestEqual(t *testing.T) {
+	vectors := Vectors()
+	for i, v1 := range vectors {
+		for j, v2 := range vectors {
+			assert.Equal(t, i == j, Equal(v1.Packet, v2.Packet), v1.Name+" "+v2.Name)
+		}
+	}
+
+	assert.True(t, Equal(nil, nil))
+	assert.False(t, Equal(NewPingreq(), nil))
+
+	publish1 := NewPublish()
+	publish1.Message.Topic = "foo"
+	publish2 := NewPublish()
+	publish2.Message.Topic = "foo"
+	publish2.Message.Payload = []byte{}
+	assert.True(t, Equal(publish1, publish2))
+
+	publish2.Message.Payload = []byte("bar")
+	assert.False(t, Equal(publish1, publish2))
+}
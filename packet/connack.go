@@ -78,10 +78,14 @@ func (cp *Connack) Len() int {
 // Decode reads from the byte slice argument. It returns the total number of
 // bytes decoded, and whether there have been any errors during the process.
 func (cp *Connack) Decode(src []byte) (int, error) {
+	return cp.decode(src, nil)
+}
+
+func (cp *Connack) decode(src []byte, v *validator) (int, error) {
 	total := 0
 
 	// decode header
-	hl, _, rl, err := headerDecode(src, CONNACK)
+	hl, _, rl, err := headerDecode(src, CONNACK, v)
 	total += hl
 	if err != nil {
 		return total, err
@@ -89,7 +93,7 @@ func (cp *Connack) Decode(src []byte) (int, error) {
 
 	// check remaining length
 	if rl != 2 {
-		return total, makeError(cp.Type(), "expected remaining length to be 2")
+		return total, wrapError(cp.Type(), ErrMalformedRemainingLength, "expected remaining length to be 2")
 	}
 
 	// read connack flags
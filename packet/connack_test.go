@@ -177,6 +177,8 @@ func TestConnackEqualDecodeEncode(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.Equal(t, 4, n3)
+
+	assertRoundTrip(t, pkt)
 }
 
 func BenchmarkConnackEncode(b *testing.B) {
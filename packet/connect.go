@@ -82,10 +82,14 @@ func (cp *Connect) Len() int {
 // Decode reads from the byte slice argument. It returns the total number of
 // bytes decoded, and whether there have been any errors during the process.
 func (cp *Connect) Decode(src []byte) (int, error) {
+	return cp.decode(src, nil)
+}
+
+func (cp *Connect) decode(src []byte, v *validator) (int, error) {
 	total := 0
 
 	// decode header
-	hl, _, _, err := headerDecode(src[total:], CONNECT)
+	hl, _, _, err := headerDecode(src[total:], CONNECT, v)
 	total += hl
 	if err != nil {
 		return total, err
@@ -100,7 +104,7 @@ func (cp *Connect) Decode(src []byte) (int, error) {
 
 	// check buffer length
 	if len(src) < total+1 {
-		return total, makeError(cp.Type(), "insufficient buffer size, expected %d, got %d", total+1, len(src))
+		return total, wrapError(cp.Type(), ErrInsufficientBuffer, "insufficient buffer size, expected %d, got %d", total+1, len(src))
 	}
 
 	// read version
@@ -122,7 +126,7 @@ func (cp *Connect) Decode(src []byte) (int, error) {
 
 	// check buffer length
 	if len(src) < total+1 {
-		return total, makeError(cp.Type(), "insufficient buffer size, expected %d, got %d", total+1, len(src))
+		return total, wrapError(cp.Type(), ErrInsufficientBuffer, "insufficient buffer size, expected %d, got %d", total+1, len(src))
 	}
 
 	// read connect flags
@@ -139,12 +143,15 @@ func (cp *Connect) Decode(src []byte) (int, error) {
 
 	// check reserved bit
 	if connectFlags&0x1 != 0 {
-		return total, makeError(cp.Type(), "reserved bit 0 is not 0")
+		err = v.violation(cp.Type(), "reserved bit 0 is not 0")
+		if err != nil {
+			return total, err
+		}
 	}
 
 	// check will qos
 	if !willQOS.Successful() {
-		return total, makeError(cp.Type(), "invalid QOS level (%d) for will message", willQOS)
+		return total, wrapError(cp.Type(), ErrInvalidQOS, "invalid QOS level (%d) for will message", willQOS)
 	}
 
 	// check will flags
@@ -164,7 +171,7 @@ func (cp *Connect) Decode(src []byte) (int, error) {
 
 	// check buffer length
 	if len(src) < total+2 {
-		return total, makeError(cp.Type(), "insufficient buffer size, expected %d, got %d", total+2, len(src))
+		return total, wrapError(cp.Type(), ErrInsufficientBuffer, "insufficient buffer size, expected %d, got %d", total+2, len(src))
 	}
 
 	// read keep alive
@@ -180,7 +187,16 @@ func (cp *Connect) Decode(src []byte) (int, error) {
 
 	// if the client supplies a zero-byte clientID, the client must also set CleanSession to 1
 	if len(cp.ClientID) == 0 && !cp.CleanSession {
-		return total, makeError(cp.Type(), "clean session must be 1 if client id is zero length")
+		err = v.violation(cp.Type(), "clean session must be 1 if client id is zero length")
+		if err != nil {
+			return total, err
+		}
+	}
+
+	// check client id
+	err = v.checkUTF8(cp.Type(), "client id", cp.ClientID)
+	if err != nil {
+		return total, err
 	}
 
 	// read will topic and payload
@@ -191,6 +207,17 @@ func (cp *Connect) Decode(src []byte) (int, error) {
 			return total, err
 		}
 
+		// check will topic length
+		if len(cp.Will.Topic) == 0 {
+			return total, makeError(cp.Type(), "will topic is empty")
+		}
+
+		// check will topic
+		err = v.checkUTF8(cp.Type(), "will topic", cp.Will.Topic)
+		if err != nil {
+			return total, err
+		}
+
 		cp.Will.Payload, n, err = readLPBytes(src[total:], true, cp.Type())
 		total += n
 		if err != nil {
@@ -205,6 +232,12 @@ func (cp *Connect) Decode(src []byte) (int, error) {
 		if err != nil {
 			return total, err
 		}
+
+		// check username
+		err = v.checkUTF8(cp.Type(), "username", cp.Username)
+		if err != nil {
+			return total, err
+		}
 	}
 
 	// read password
@@ -282,7 +315,7 @@ func (cp *Connect) Encode(dst []byte) (int, error) {
 
 		// check will qos
 		if !cp.Will.QOS.Successful() {
-			return total, makeError(cp.Type(), "invalid will qos level %d", cp.Will.QOS)
+			return total, wrapError(cp.Type(), ErrInvalidQOS, "invalid will qos level %d", cp.Will.QOS)
 		}
 
 		// set will qos flag
@@ -320,7 +353,7 @@ func (cp *Connect) Encode(dst []byte) (int, error) {
 	total += 2
 
 	// write client id
-	n, err = writeLPString(dst[total:], cp.ClientID, cp.Type())
+	n, err = writeUTF8String(dst[total:], cp.ClientID, "client id", cp.Type())
 	total += n
 	if err != nil {
 		return total, err
@@ -328,7 +361,7 @@ func (cp *Connect) Encode(dst []byte) (int, error) {
 
 	// write will topic and payload
 	if cp.Will != nil {
-		n, err = writeLPString(dst[total:], cp.Will.Topic, cp.Type())
+		n, err = writeUTF8String(dst[total:], cp.Will.Topic, "will topic", cp.Type())
 		total += n
 		if err != nil {
 			return total, err
@@ -347,7 +380,7 @@ func (cp *Connect) Encode(dst []byte) (int, error) {
 
 	// write username
 	if len(cp.Username) > 0 {
-		n, err = writeLPString(dst[total:], cp.Username, cp.Type())
+		n, err = writeUTF8String(dst[total:], cp.Username, "username", cp.Type())
 		total += n
 		if err != nil {
 			return total, err
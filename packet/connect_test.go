@@ -703,6 +703,8 @@ func TestConnectEqualDecodeEncode(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.Equal(t, len(pktBytes), n3)
+
+	assertRoundTrip(t, pkt)
 }
 
 func BenchmarkConnectEncode(b *testing.B) {
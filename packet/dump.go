@@ -0,0 +1,103 @@
+package packet
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// the maximum number of payload bytes included in a dump
+const dumpPayloadLimit = 32
+
+// Dump returns a human-readable multi-line representation of the packet that
+// lists its flags, packet id, topics, QOS levels and a truncated hex dump of
+// the payload. Passwords are masked.
+func Dump(pkt Generic) string {
+	// prepare builder
+	var b strings.Builder
+	line := func(format string, args ...interface{}) {
+		b.WriteString("  ")
+		b.WriteString(fmt.Sprintf(format, args...))
+		b.WriteString("\n")
+	}
+
+	// write type and length
+	b.WriteString(fmt.Sprintf("%s (%d bytes)\n", strings.ToUpper(pkt.Type().String()), pkt.Len()))
+
+	// write fields
+	switch p := pkt.(type) {
+	case *Connect:
+		line("Version: %d", p.Version)
+		line("ClientID: %q", p.ClientID)
+		line("KeepAlive: %d", p.KeepAlive)
+		line("CleanSession: %t", p.CleanSession)
+		line("Username: %q", p.Username)
+		line("Password: %s", maskPassword(p.Password))
+		if p.Will != nil {
+			line("Will: %s", dumpMessage(p.Will))
+		}
+	case *Connack:
+		line("SessionPresent: %t", p.SessionPresent)
+		line("ReturnCode: %d (%s)", p.ReturnCode, p.ReturnCode.String())
+	case *Publish:
+		line("Flags: dup=%t qos=%d retain=%t", p.Dup, p.Message.QOS, p.Message.Retain)
+		line("ID: %d", p.ID)
+		line("Topic: %q", p.Message.Topic)
+		line("Payload: %s", dumpPayload(p.Message.Payload))
+	case *Puback:
+		line("ID: %d", p.ID)
+	case *Pubrec:
+		line("ID: %d", p.ID)
+	case *Pubrel:
+		line("ID: %d", p.ID)
+	case *Pubcomp:
+		line("ID: %d", p.ID)
+	case *Subscribe:
+		line("ID: %d", p.ID)
+		for _, s := range p.Subscriptions {
+			line("Subscription: %q qos=%d", s.Topic, s.QOS)
+		}
+	case *Suback:
+		line("ID: %d", p.ID)
+		for _, code := range p.ReturnCodes {
+			if code == QOSFailure {
+				line("ReturnCode: failure")
+			} else {
+				line("ReturnCode: qos=%d", code)
+			}
+		}
+	case *Unsubscribe:
+		line("ID: %d", p.ID)
+		for _, topic := range p.Topics {
+			line("Topic: %q", topic)
+		}
+	case *Unsuback:
+		line("ID: %d", p.ID)
+	}
+
+	return b.String()
+}
+
+// dumpMessage returns a single line representation of the message
+func dumpMessage(msg *Message) string {
+	return fmt.Sprintf("%q qos=%d retain=%t payload=%s", msg.Topic, msg.QOS, msg.Retain, dumpPayload(msg.Payload))
+}
+
+// dumpPayload returns the length and truncated hex representation
+func dumpPayload(payload []byte) string {
+	// check limit
+	if len(payload) <= dumpPayloadLimit {
+		return fmt.Sprintf("%d bytes %s", len(payload), hex.EncodeToString(payload))
+	}
+
+	return fmt.Sprintf("%d bytes %s...", len(payload), hex.EncodeToString(payload[:dumpPayloadLimit]))
+}
+
+// maskPassword hides the password while indicating its presence
+func maskPassword(password string) string {
+	if password == "" {
+		return `""`
+	}
+
+	return fmt.Sprintf("*** (%d bytes)", len(password))
+}
@@ -0,0 +1,44 @@
+package packet
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDump(t *testing.T) {
+	publish := NewPublish()
+	publish.ID = 7
+	publish.Dup = true
+	publish.Message = Message{
+		Topic:   "foo/bar",
+		Payload: []byte("baz"),
+		QOS:     1,
+	}
+
+	assert.Equal(t, "PUBLISH (16 bytes)\n"+
+		"  Flags: dup=true qos=1 retain=false\n"+
+		"  ID: 7\n"+
+		"  Topic: \"foo/bar\"\n"+
+		"  Payload: 3 bytes 62617a\n", Dump(publish))
+
+	publish.Message.Payload = bytes.Repeat([]byte{0xab}, 40)
+	assert.Contains(t, Dump(publish), "  Payload: 40 bytes "+string(bytes.Repeat([]byte("ab"), 32))+"...\n")
+
+	connect := NewConnect()
+	connect.Username = "user"
+	connect.Password = "secret"
+	assert.Contains(t, Dump(connect), "  Password: *** (6 bytes)\n")
+	assert.NotContains(t, Dump(connect), "secret")
+
+	suback := NewSuback()
+	suback.ID = 1
+	suback.ReturnCodes = []QOS{1, QOSFailure}
+	assert.Equal(t, "SUBACK (6 bytes)\n"+
+		"  ID: 1\n"+
+		"  ReturnCode: qos=1\n"+
+		"  ReturnCode: failure\n", Dump(suback))
+
+	assert.Equal(t, "PINGREQ (2 bytes)\n", Dump(NewPingreq()))
+}
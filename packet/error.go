@@ -1,11 +1,34 @@
 package packet
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
-// Error represents decoding and encoding errors.
+// ErrInsufficientBuffer is wrapped by errors returned if the buffer is too
+// small to encode or decode a packet.
+var ErrInsufficientBuffer = errors.New("insufficient buffer size")
+
+// ErrMalformedRemainingLength is wrapped by errors returned if the remaining
+// length of a packet cannot be read, is out of bounds or does not match the
+// contents of the packet.
+var ErrMalformedRemainingLength = errors.New("malformed remaining length")
+
+// ErrInvalidQOS is wrapped by errors returned if a packet carries an invalid
+// QOS level.
+var ErrInvalidQOS = errors.New("invalid QOS level")
+
+// ErrInvalidID is wrapped by errors returned if a packet that requires a packet
+// id carries a zero id.
+var ErrInvalidID = errors.New("invalid packet id")
+
+// Error represents decoding and encoding errors. Errors of specific failures
+// wrap one of the exported sentinel errors and can be inspected using
+// errors.Is.
 type Error struct {
 	Type Type
 
+	cause     error
 	format    string
 	arguments []interface{}
 }
@@ -14,7 +37,16 @@ func makeError(typ Type, format string, arguments ...interface{}) *Error {
 	return &Error{Type: typ, format: format, arguments: arguments}
 }
 
+func wrapError(typ Type, cause error, format string, arguments ...interface{}) *Error {
+	return &Error{Type: typ, cause: cause, format: format, arguments: arguments}
+}
+
 // Error implements the error interface.
 func (e *Error) Error() string {
 	return fmt.Sprintf(e.format, e.arguments...)
 }
+
+// Unwrap returns the wrapped sentinel error if available.
+func (e *Error) Unwrap() error {
+	return e.cause
+}
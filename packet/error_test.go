@@ -0,0 +1,45 @@
+package packet
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorIs(t *testing.T) {
+	_, err := NewConnack().Decode([]byte{byte(CONNACK << 4)})
+	assert.True(t, errors.Is(err, ErrInsufficientBuffer))
+
+	_, err = NewConnack().Encode(make([]byte, 2))
+	assert.True(t, errors.Is(err, ErrInsufficientBuffer))
+
+	_, err = NewConnack().Decode([]byte{byte(CONNACK << 4), 0xff, 0xff, 0xff, 0xff, 0xff})
+	assert.True(t, errors.Is(err, ErrMalformedRemainingLength))
+
+	_, err = NewPuback().Decode([]byte{byte(PUBACK << 4), 3, 0, 1, 0})
+	assert.True(t, errors.Is(err, ErrMalformedRemainingLength))
+
+	pkt := NewPublish()
+	pkt.Message.Topic = "foo"
+	pkt.Message.QOS = 3
+	_, err = pkt.Encode(make([]byte, 100))
+	assert.True(t, errors.Is(err, ErrInvalidQOS))
+
+	pkt.Message.QOS = 1
+	_, err = pkt.Encode(make([]byte, 100))
+	assert.True(t, errors.Is(err, ErrInvalidID))
+
+	_, err = NewConnack().Decode([]byte{byte(PUBACK << 4), 2, 0, 0})
+	assert.True(t, errors.Is(err, ErrInvalidPacketType))
+
+	connack := NewConnack()
+	connack.ReturnCode = 11
+	_, err = connack.Encode(make([]byte, 100))
+	assert.Error(t, err)
+	assert.Nil(t, errors.Unwrap(err))
+
+	var perr *Error
+	assert.True(t, errors.As(err, &perr))
+	assert.Equal(t, CONNACK, perr.Type)
+}
@@ -0,0 +1,70 @@
+package packet
+
+// A Frame is a packet that has been encoded in advance. Encoders write the
+// encoded bytes of a frame directly, which allows sending the same encoding to
+// many connections while encoding the packet only once.
+//
+// Note: Frames are shared and must not be modified after being created.
+type Frame struct {
+	// The encoded packet.
+	Packet Generic
+
+	// The encoding of the packet.
+	Bytes []byte
+}
+
+// NewFrame encodes the packet and returns a frame.
+func NewFrame(pkt Generic) (*Frame, error) {
+	// encode packet
+	buf := make([]byte, pkt.Len())
+	n, err := pkt.Encode(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Frame{
+		Packet: pkt,
+		Bytes:  buf[:n],
+	}, nil
+}
+
+// Type returns the type of the encoded packet.
+func (f *Frame) Type() Type {
+	return f.Packet.Type()
+}
+
+// Len returns the length of the encoding.
+func (f *Frame) Len() int {
+	return len(f.Bytes)
+}
+
+// Decode reads from the byte slice argument into the packet and keeps a copy
+// of the decoded bytes.
+func (f *Frame) Decode(src []byte) (int, error) {
+	// decode packet
+	n, err := f.Packet.Decode(src)
+	if err != nil {
+		return n, err
+	}
+
+	// copy encoding
+	f.Bytes = make([]byte, n)
+	copy(f.Bytes, src)
+
+	return n, nil
+}
+
+// Encode copies the encoding into the byte slice from the argument.
+func (f *Frame) Encode(dst []byte) (int, error) {
+	// check buffer
+	if len(dst) < len(f.Bytes) {
+		return 0, wrapError(f.Type(), ErrInsufficientBuffer, "insufficient buffer size, expected %d, got %d", len(f.Bytes), len(dst))
+	}
+
+	return copy(dst, f.Bytes), nil
+}
+
+// String returns a string representation of the encoded packet.
+func (f *Frame) String() string {
+	return f.Packet.String()
+}
@@ -0,0 +1,70 @@
+package packet
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrame(t *testing.T) {
+	pkt := NewPublish()
+	pkt.Message.Topic = "foo"
+	pkt.Message.Payload = []byte("bar")
+
+	frame, err := NewFrame(pkt)
+	assert.NoError(t, err)
+	assert.Equal(t, PUBLISH, frame.Type())
+	assert.Equal(t, pkt.Len(), frame.Len())
+	assert.Equal(t, pkt.String(), frame.String())
+
+	buf := make([]byte, pkt.Len())
+	_, err = pkt.Encode(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, buf, frame.Bytes)
+
+	dst := make([]byte, frame.Len())
+	n, err := frame.Encode(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, len(buf), n)
+	assert.Equal(t, buf, dst)
+
+	n, err = frame.Encode(make([]byte, 2))
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+
+	frame2 := &Frame{Packet: NewPublish()}
+	n, err = frame2.Decode(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, len(buf), n)
+	assert.Equal(t, pkt, frame2.Packet)
+	assert.Equal(t, buf, frame2.Bytes)
+
+	id, ok := GetID(frame)
+	assert.True(t, ok)
+	assert.Equal(t, ID(0), id)
+
+	_, err = NewFrame(NewSubscribe())
+	assert.Error(t, err)
+}
+
+func TestEncoderFrame(t *testing.T) {
+	pkt := NewPublish()
+	pkt.Message.Topic = "foo"
+	pkt.Message.Payload = []byte("bar")
+
+	frame, err := NewFrame(pkt)
+	assert.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf, time.Millisecond)
+
+	err = enc.Write(frame, false)
+	assert.NoError(t, err)
+
+	err = enc.Write(frame, false)
+	assert.NoError(t, err)
+
+	assert.Equal(t, append(frame.Bytes, frame.Bytes...), buf.Bytes())
+}
@@ -28,18 +28,18 @@ func headerEncode(dst []byte, flags byte, rl int, tl int, t Type) (int, error) {
 
 	// check buffer length
 	if len(dst) < tl {
-		return total, makeError(t, "insufficient buffer size, expected %d, got %d", tl, len(dst))
+		return total, wrapError(t, ErrInsufficientBuffer, "insufficient buffer size, expected %d, got %d", tl, len(dst))
 	}
 
 	// check remaining length
 	if rl > maxRemainingLength || rl < 0 {
-		return total, makeError(t, "remaining length (%d) out of bound (max %d, min 0)", rl, maxRemainingLength)
+		return total, wrapError(t, ErrMalformedRemainingLength, "remaining length (%d) out of bound (max %d, min 0)", rl, maxRemainingLength)
 	}
 
 	// check header length
 	hl := headerLen(rl)
 	if len(dst) < hl {
-		return total, makeError(t, "insufficient buffer size, expected %d, got %d", hl, len(dst))
+		return total, wrapError(t, ErrInsufficientBuffer, "insufficient buffer size, expected %d, got %d", hl, len(dst))
 	}
 
 	// write type and flags
@@ -55,12 +55,12 @@ func headerEncode(dst []byte, flags byte, rl int, tl int, t Type) (int, error) {
 	return total, nil
 }
 
-func headerDecode(src []byte, t Type) (int, byte, int, error) {
+func headerDecode(src []byte, t Type, v *validator) (int, byte, int, error) {
 	total := 0
 
 	// check buffer size
 	if len(src) < 2 {
-		return total, 0, 0, makeError(t, "insufficient buffer size, expected %d, got %d", 2, len(src))
+		return total, 0, 0, wrapError(t, ErrInsufficientBuffer, "insufficient buffer size, expected %d, got %d", 2, len(src))
 	}
 
 	// read type and flags
@@ -71,12 +71,15 @@ func headerDecode(src []byte, t Type) (int, byte, int, error) {
 
 	// check against static type
 	if decodedType != t {
-		return total, 0, 0, makeError(t, "invalid type %d", decodedType)
+		return total, 0, 0, wrapError(t, ErrInvalidPacketType, "invalid type %d", decodedType)
 	}
 
 	// check flags except for publish packets
 	if t != PUBLISH && flags != t.defaultFlags() {
-		return total, 0, 0, makeError(t, "invalid flags, expected %d, got %d", t.defaultFlags(), flags)
+		err := v.violation(t, "invalid flags, expected %d, got %d", t.defaultFlags(), flags)
+		if err != nil {
+			return total, 0, 0, err
+		}
 	}
 
 	// read remaining length
@@ -86,12 +89,12 @@ func headerDecode(src []byte, t Type) (int, byte, int, error) {
 
 	// check resulting remaining length
 	if m <= 0 {
-		return total, 0, 0, makeError(t, "error reading remaining length")
+		return total, 0, 0, wrapError(t, ErrMalformedRemainingLength, "error reading remaining length")
 	}
 
 	// check remaining buffer
 	if rl > len(src[total:]) {
-		return total, 0, 0, makeError(t, "remaining length (%d) is greater than remaining buffer (%d)", rl, len(src[total:]))
+		return total, 0, 0, wrapError(t, ErrMalformedRemainingLength, "remaining length (%d) is greater than remaining buffer (%d)", rl, len(src[total:]))
 	}
 
 	return total, flags, rl, nil
@@ -9,7 +9,7 @@ import (
 func TestHeaderDecodeError1(t *testing.T) {
 	buf := []byte{0x6f, 193, 2} // < not enough bytes
 
-	_, _, _, err := headerDecode(buf, 0)
+	_, _, _, err := headerDecode(buf, 0, nil)
 	assert.Error(t, err)
 }
 
@@ -17,14 +17,14 @@ func TestHeaderDecodeError2(t *testing.T) {
 	// source to small
 	buf := []byte{0x62}
 
-	_, _, _, err := headerDecode(buf, 0)
+	_, _, _, err := headerDecode(buf, 0, nil)
 	assert.Error(t, err)
 }
 
 func TestHeaderDecodeError3(t *testing.T) {
 	buf := []byte{0x62, 0xff} // < invalid packet type
 
-	_, _, _, err := headerDecode(buf, 0)
+	_, _, _, err := headerDecode(buf, 0, nil)
 	assert.Error(t, err)
 }
 
@@ -32,7 +32,7 @@ func TestHeaderDecodeError4(t *testing.T) {
 	// remaining length to big
 	buf := []byte{0x62, 0xff, 0xff, 0xff, 0xff}
 
-	n, _, _, err := headerDecode(buf, 6)
+	n, _, _, err := headerDecode(buf, 6, nil)
 
 	assert.Error(t, err)
 	assert.Equal(t, 1, n)
@@ -41,7 +41,7 @@ func TestHeaderDecodeError4(t *testing.T) {
 func TestHeaderDecodeError5(t *testing.T) {
 	buf := []byte{0x66, 0x00, 0x01} // < wrong flags
 
-	n, _, _, err := headerDecode(buf, 6)
+	n, _, _, err := headerDecode(buf, 6, nil)
 	assert.Error(t, err)
 	assert.Equal(t, 1, n)
 }
@@ -11,11 +11,11 @@ func identifiedLen() int {
 }
 
 // decodes an identified packet
-func identifiedDecode(src []byte, t Type) (int, ID, error) {
+func identifiedDecode(src []byte, t Type, v *validator) (int, ID, error) {
 	total := 0
 
 	// decode header
-	hl, _, rl, err := headerDecode(src, t)
+	hl, _, rl, err := headerDecode(src, t, v)
 	total += hl
 	if err != nil {
 		return total, 0, err
@@ -23,7 +23,7 @@ func identifiedDecode(src []byte, t Type) (int, ID, error) {
 
 	// check remaining length
 	if rl != 2 {
-		return total, 0, makeError(t, "expected remaining length to be 2")
+		return total, 0, wrapError(t, ErrMalformedRemainingLength, "expected remaining length to be 2")
 	}
 
 	// read packet id
@@ -32,7 +32,7 @@ func identifiedDecode(src []byte, t Type) (int, ID, error) {
 
 	// check packet id
 	if !packetID.Valid() {
-		return total, 0, makeError(t, "packet id must be grater than zero")
+		return total, 0, wrapError(t, ErrInvalidID, "packet id must be grater than zero")
 	}
 
 	return total, packetID, nil
@@ -44,7 +44,7 @@ func identifiedEncode(dst []byte, id ID, t Type) (int, error) {
 
 	// check packet id
 	if !id.Valid() {
-		return total, makeError(t, "packet id must be grater than zero")
+		return total, wrapError(t, ErrInvalidID, "packet id must be grater than zero")
 	}
 
 	// encode header
@@ -85,7 +85,11 @@ func (pp *Puback) Len() int {
 // Decode reads from the byte slice argument. It returns the total number of
 // bytes decoded, and whether there have been any errors during the process.
 func (pp *Puback) Decode(src []byte) (int, error) {
-	n, pid, err := identifiedDecode(src, PUBACK)
+	return pp.decode(src, nil)
+}
+
+func (pp *Puback) decode(src []byte, v *validator) (int, error) {
+	n, pid, err := identifiedDecode(src, PUBACK, v)
 	pp.ID = pid
 	return n, err
 }
@@ -129,7 +133,11 @@ func (pp *Pubcomp) Len() int {
 // Decode reads from the byte slice argument. It returns the total number of
 // bytes decoded, and whether there have been any errors during the process.
 func (pp *Pubcomp) Decode(src []byte) (int, error) {
-	n, pid, err := identifiedDecode(src, PUBCOMP)
+	return pp.decode(src, nil)
+}
+
+func (pp *Pubcomp) decode(src []byte, v *validator) (int, error) {
+	n, pid, err := identifiedDecode(src, PUBCOMP, v)
 	pp.ID = pid
 	return n, err
 }
@@ -171,7 +179,11 @@ func (pp *Pubrec) Len() int {
 // Decode reads from the byte slice argument. It returns the total number of
 // bytes decoded, and whether there have been any errors during the process.
 func (pp *Pubrec) Decode(src []byte) (int, error) {
-	n, pid, err := identifiedDecode(src, PUBREC)
+	return pp.decode(src, nil)
+}
+
+func (pp *Pubrec) decode(src []byte, v *validator) (int, error) {
+	n, pid, err := identifiedDecode(src, PUBREC, v)
 	pp.ID = pid
 	return n, err
 }
@@ -215,7 +227,11 @@ func (pp *Pubrel) Len() int {
 // Decode reads from the byte slice argument. It returns the total number of
 // bytes decoded, and whether there have been any errors during the process.
 func (pp *Pubrel) Decode(src []byte) (int, error) {
-	n, pid, err := identifiedDecode(src, PUBREL)
+	return pp.decode(src, nil)
+}
+
+func (pp *Pubrel) decode(src []byte, v *validator) (int, error) {
+	n, pid, err := identifiedDecode(src, PUBREL, v)
 	pp.ID = pid
 	return n, err
 }
@@ -257,7 +273,11 @@ func (up *Unsuback) Len() int {
 // Decode reads from the byte slice argument. It returns the total number of
 // bytes decoded, and whether there have been any errors during the process.
 func (up *Unsuback) Decode(src []byte) (int, error) {
-	n, pid, err := identifiedDecode(src, UNSUBACK)
+	return up.decode(src, nil)
+}
+
+func (up *Unsuback) decode(src []byte, v *validator) (int, error) {
+	n, pid, err := identifiedDecode(src, UNSUBACK, v)
 	up.ID = pid
 	return n, err
 }
@@ -15,7 +15,7 @@ func TestIdentifiedDecode(t *testing.T) {
 		7, // packet ID LSB
 	}
 
-	n, pid, err := identifiedDecode(pktBytes, PUBACK)
+	n, pid, err := identifiedDecode(pktBytes, PUBACK, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, 4, n)
 	assert.Equal(t, ID(7), pid)
@@ -29,7 +29,7 @@ func TestIdentifiedDecodeError1(t *testing.T) {
 		7, // packet ID LSB
 	}
 
-	n, pid, err := identifiedDecode(pktBytes, PUBACK)
+	n, pid, err := identifiedDecode(pktBytes, PUBACK, nil)
 	assert.Error(t, err)
 	assert.Equal(t, 2, n)
 	assert.Equal(t, ID(0), pid)
@@ -43,7 +43,7 @@ func TestIdentifiedDecodeError2(t *testing.T) {
 		// < insufficient bytes
 	}
 
-	n, pid, err := identifiedDecode(pktBytes, PUBACK)
+	n, pid, err := identifiedDecode(pktBytes, PUBACK, nil)
 	assert.Error(t, err)
 	assert.Equal(t, 2, n)
 	assert.Equal(t, ID(0), pid)
@@ -57,7 +57,7 @@ func TestIdentifiedDecodeError3(t *testing.T) {
 		0, // packet ID MSB < zero id
 	}
 
-	n, pid, err := identifiedDecode(pktBytes, PUBACK)
+	n, pid, err := identifiedDecode(pktBytes, PUBACK, nil)
 	assert.Error(t, err)
 	assert.Equal(t, 4, n)
 	assert.Equal(t, ID(0), pid)
@@ -116,10 +116,12 @@ func TestIdentifiedEqualDecodeEncode(t *testing.T) {
 	assert.Equal(t, 4, n2)
 	assert.Equal(t, pktBytes, dst[:n2])
 
-	n3, pid, err := identifiedDecode(pktBytes, PUBACK)
+	n3, pid, err := identifiedDecode(pktBytes, PUBACK, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, 4, n3)
 	assert.Equal(t, ID(7), pid)
+
+	assertRoundTrip(t, pkt)
 }
 
 func BenchmarkIdentifiedEncode(b *testing.B) {
@@ -165,6 +167,8 @@ func testIdentifiedImplementation(t *testing.T, pkt Generic) {
 	n, err = pkt.Decode(buf)
 	assert.NoError(t, err)
 	assert.Equal(t, 4, n)
+
+	assertRoundTrip(t, pkt)
 }
 
 func TestPubackImplementation(t *testing.T) {
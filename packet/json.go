@@ -0,0 +1,478 @@
+package packet
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// The JSON representation of packets is an object that has a "type" field
+// with the lowercase packet type and the packet fields in snake case. Payloads
+// are encoded as base64 strings:
+//
+//   {"type":"publish","id":1,"dup":false,"message":{"topic":"foo","payload":"YmFy","qos":1,"retain":false}}
+
+type jsonHeader struct {
+	Type string `json:"type"`
+}
+
+type jsonMessage struct {
+	Topic   string `json:"topic"`
+	Payload []byte `json:"payload"`
+	QOS     QOS    `json:"qos"`
+	Retain  bool   `json:"retain"`
+}
+
+type jsonConnect struct {
+	Type         string   `json:"type"`
+	ClientID     string   `json:"client_id"`
+	KeepAlive    uint16   `json:"keep_alive"`
+	Username     string   `json:"username"`
+	Password     string   `json:"password"`
+	CleanSession bool     `json:"clean_session"`
+	Will         *Message `json:"will"`
+	Version      byte     `json:"version"`
+}
+
+type jsonConnack struct {
+	Type           string      `json:"type"`
+	SessionPresent bool        `json:"session_present"`
+	ReturnCode     ConnackCode `json:"return_code"`
+}
+
+type jsonPublish struct {
+	Type    string  `json:"type"`
+	ID      ID      `json:"id"`
+	Dup     bool    `json:"dup"`
+	Message Message `json:"message"`
+}
+
+type jsonIdentified struct {
+	Type string `json:"type"`
+	ID   ID     `json:"id"`
+}
+
+type jsonSubscription struct {
+	Topic string `json:"topic"`
+	QOS   QOS    `json:"qos"`
+}
+
+type jsonSubscribe struct {
+	Type          string             `json:"type"`
+	ID            ID                 `json:"id"`
+	Subscriptions []jsonSubscription `json:"subscriptions"`
+}
+
+type jsonSuback struct {
+	Type        string `json:"type"`
+	ID          ID     `json:"id"`
+	ReturnCodes []QOS  `json:"return_codes"`
+}
+
+type jsonUnsubscribe struct {
+	Type   string   `json:"type"`
+	ID     ID       `json:"id"`
+	Topics []string `json:"topics"`
+}
+
+// ParseJSON parses the JSON representation of a packet and returns the
+// packet of the specified type.
+func ParseJSON(data []byte) (Generic, error) {
+	// read header
+	var header jsonHeader
+	err := json.Unmarshal(data, &header)
+	if err != nil {
+		return nil, err
+	}
+
+	// lookup type
+	var pkt Generic
+	for t := CONNECT; t <= DISCONNECT; t++ {
+		if jsonType(t) == header.Type {
+			pkt, _ = t.New()
+			break
+		}
+	}
+	if pkt == nil {
+		return nil, ErrInvalidPacketType
+	}
+
+	// unmarshal packet
+	err = json.Unmarshal(data, pkt)
+	if err != nil {
+		return nil, err
+	}
+
+	return pkt, nil
+}
+
+// returns the name of the type used in the JSON representation
+func jsonType(t Type) string {
+	return strings.ToLower(t.String())
+}
+
+// checks the type read from the JSON representation
+func checkJSONType(t Type, name string) error {
+	if name != jsonType(t) {
+		return fmt.Errorf("invalid JSON packet type %q, expected %q", name, jsonType(t))
+	}
+
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (m Message) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonMessage(m))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, (*jsonMessage)(m))
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (cp *Connect) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonConnect{
+		Type:         jsonType(cp.Type()),
+		ClientID:     cp.ClientID,
+		KeepAlive:    cp.KeepAlive,
+		Username:     cp.Username,
+		Password:     cp.Password,
+		CleanSession: cp.CleanSession,
+		Will:         cp.Will,
+		Version:      cp.Version,
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (cp *Connect) UnmarshalJSON(data []byte) error {
+	// unmarshal packet
+	var j jsonConnect
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return err
+	}
+
+	// check type
+	err = checkJSONType(cp.Type(), j.Type)
+	if err != nil {
+		return err
+	}
+
+	// set fields
+	cp.ClientID = j.ClientID
+	cp.KeepAlive = j.KeepAlive
+	cp.Username = j.Username
+	cp.Password = j.Password
+	cp.CleanSession = j.CleanSession
+	cp.Will = j.Will
+	cp.Version = j.Version
+
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (cp *Connack) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonConnack{
+		Type:           jsonType(cp.Type()),
+		SessionPresent: cp.SessionPresent,
+		ReturnCode:     cp.ReturnCode,
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (cp *Connack) UnmarshalJSON(data []byte) error {
+	// unmarshal packet
+	var j jsonConnack
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return err
+	}
+
+	// check type
+	err = checkJSONType(cp.Type(), j.Type)
+	if err != nil {
+		return err
+	}
+
+	// set fields
+	cp.SessionPresent = j.SessionPresent
+	cp.ReturnCode = j.ReturnCode
+
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (pp *Publish) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonPublish{
+		Type:    jsonType(pp.Type()),
+		ID:      pp.ID,
+		Dup:     pp.Dup,
+		Message: pp.Message,
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pp *Publish) UnmarshalJSON(data []byte) error {
+	// unmarshal packet
+	var j jsonPublish
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return err
+	}
+
+	// check type
+	err = checkJSONType(pp.Type(), j.Type)
+	if err != nil {
+		return err
+	}
+
+	// set fields
+	pp.ID = j.ID
+	pp.Dup = j.Dup
+	pp.Message = j.Message
+
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (pp *Puback) MarshalJSON() ([]byte, error) {
+	return marshalIdentifiedJSON(pp.Type(), pp.ID)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pp *Puback) UnmarshalJSON(data []byte) error {
+	return unmarshalIdentifiedJSON(data, pp.Type(), &pp.ID)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (pp *Pubrec) MarshalJSON() ([]byte, error) {
+	return marshalIdentifiedJSON(pp.Type(), pp.ID)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pp *Pubrec) UnmarshalJSON(data []byte) error {
+	return unmarshalIdentifiedJSON(data, pp.Type(), &pp.ID)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (pp *Pubrel) MarshalJSON() ([]byte, error) {
+	return marshalIdentifiedJSON(pp.Type(), pp.ID)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pp *Pubrel) UnmarshalJSON(data []byte) error {
+	return unmarshalIdentifiedJSON(data, pp.Type(), &pp.ID)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (pp *Pubcomp) MarshalJSON() ([]byte, error) {
+	return marshalIdentifiedJSON(pp.Type(), pp.ID)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pp *Pubcomp) UnmarshalJSON(data []byte) error {
+	return unmarshalIdentifiedJSON(data, pp.Type(), &pp.ID)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (up *Unsuback) MarshalJSON() ([]byte, error) {
+	return marshalIdentifiedJSON(up.Type(), up.ID)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (up *Unsuback) UnmarshalJSON(data []byte) error {
+	return unmarshalIdentifiedJSON(data, up.Type(), &up.ID)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (sp *Subscribe) MarshalJSON() ([]byte, error) {
+	// convert subscriptions
+	subscriptions := make([]jsonSubscription, 0, len(sp.Subscriptions))
+	for _, s := range sp.Subscriptions {
+		subscriptions = append(subscriptions, jsonSubscription(s))
+	}
+
+	return json.Marshal(jsonSubscribe{
+		Type:          jsonType(sp.Type()),
+		ID:            sp.ID,
+		Subscriptions: subscriptions,
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (sp *Subscribe) UnmarshalJSON(data []byte) error {
+	// unmarshal packet
+	var j jsonSubscribe
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return err
+	}
+
+	// check type
+	err = checkJSONType(sp.Type(), j.Type)
+	if err != nil {
+		return err
+	}
+
+	// set fields
+	sp.ID = j.ID
+	sp.Subscriptions = nil
+	for _, s := range j.Subscriptions {
+		sp.Subscriptions = append(sp.Subscriptions, Subscription(s))
+	}
+
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (sp *Suback) MarshalJSON() ([]byte, error) {
+	// ensure list
+	codes := sp.ReturnCodes
+	if codes == nil {
+		codes = []QOS{}
+	}
+
+	return json.Marshal(jsonSuback{
+		Type:        jsonType(sp.Type()),
+		ID:          sp.ID,
+		ReturnCodes: codes,
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (sp *Suback) UnmarshalJSON(data []byte) error {
+	// unmarshal packet
+	var j jsonSuback
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return err
+	}
+
+	// check type
+	err = checkJSONType(sp.Type(), j.Type)
+	if err != nil {
+		return err
+	}
+
+	// set fields
+	sp.ID = j.ID
+	sp.ReturnCodes = j.ReturnCodes
+
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (up *Unsubscribe) MarshalJSON() ([]byte, error) {
+	// ensure list
+	topics := up.Topics
+	if topics == nil {
+		topics = []string{}
+	}
+
+	return json.Marshal(jsonUnsubscribe{
+		Type:   jsonType(up.Type()),
+		ID:     up.ID,
+		Topics: topics,
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (up *Unsubscribe) UnmarshalJSON(data []byte) error {
+	// unmarshal packet
+	var j jsonUnsubscribe
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return err
+	}
+
+	// check type
+	err = checkJSONType(up.Type(), j.Type)
+	if err != nil {
+		return err
+	}
+
+	// set fields
+	up.ID = j.ID
+	up.Topics = j.Topics
+
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (pp *Pingreq) MarshalJSON() ([]byte, error) {
+	return marshalNakedJSON(pp.Type())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pp *Pingreq) UnmarshalJSON(data []byte) error {
+	return unmarshalNakedJSON(data, pp.Type())
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (pp *Pingresp) MarshalJSON() ([]byte, error) {
+	return marshalNakedJSON(pp.Type())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pp *Pingresp) UnmarshalJSON(data []byte) error {
+	return unmarshalNakedJSON(data, pp.Type())
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (dp *Disconnect) MarshalJSON() ([]byte, error) {
+	return marshalNakedJSON(dp.Type())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (dp *Disconnect) UnmarshalJSON(data []byte) error {
+	return unmarshalNakedJSON(data, dp.Type())
+}
+
+// marshals a packet that only has an id
+func marshalIdentifiedJSON(t Type, id ID) ([]byte, error) {
+	return json.Marshal(jsonIdentified{
+		Type: jsonType(t),
+		ID:   id,
+	})
+}
+
+// unmarshals a packet that only has an id
+func unmarshalIdentifiedJSON(data []byte, t Type, id *ID) error {
+	// unmarshal packet
+	var j jsonIdentified
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return err
+	}
+
+	// check type
+	err = checkJSONType(t, j.Type)
+	if err != nil {
+		return err
+	}
+
+	// set id
+	*id = j.ID
+
+	return nil
+}
+
+// marshals a packet that has no fields
+func marshalNakedJSON(t Type) ([]byte, error) {
+	return json.Marshal(jsonHeader{
+		Type: jsonType(t),
+	})
+}
+
+// unmarshals a packet that has no fields
+func unmarshalNakedJSON(data []byte, t Type) error {
+	// unmarshal packet
+	var j jsonHeader
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return err
+	}
+
+	return checkJSONType(t, j.Type)
+}
@@ -0,0 +1,98 @@
+package packet
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSON(t *testing.T) {
+	connect := NewConnect()
+	connect.ClientID = "client"
+	connect.Username = "user"
+	connect.Password = "pass"
+	connect.Will = &Message{Topic: "will", Payload: []byte("bye"), QOS: 1}
+
+	connack := NewConnack()
+	connack.SessionPresent = true
+	connack.ReturnCode = NotAuthorized
+
+	publish := NewPublish()
+	publish.ID = 1
+	publish.Message = Message{Topic: "foo", Payload: []byte("bar"), QOS: 1, Retain: true}
+
+	puback := NewPuback()
+	puback.ID = 2
+
+	pubrec := NewPubrec()
+	pubrec.ID = 3
+
+	pubrel := NewPubrel()
+	pubrel.ID = 4
+
+	pubcomp := NewPubcomp()
+	pubcomp.ID = 5
+
+	subscribe := NewSubscribe()
+	subscribe.ID = 6
+	subscribe.Subscriptions = []Subscription{{Topic: "foo/#", QOS: 2}}
+
+	suback := NewSuback()
+	suback.ID = 6
+	suback.ReturnCodes = []QOS{2, QOSFailure}
+
+	unsubscribe := NewUnsubscribe()
+	unsubscribe.ID = 7
+	unsubscribe.Topics = []string{"foo/#"}
+
+	unsuback := NewUnsuback()
+	unsuback.ID = 7
+
+	packets := []Generic{connect, connack, publish, puback, pubrec, pubrel, pubcomp,
+		subscribe, suback, unsubscribe, unsuback, NewPingreq(), NewPingresp(), NewDisconnect()}
+
+	for _, pkt := range packets {
+		data, err := json.Marshal(pkt)
+		assert.NoError(t, err, pkt.Type().String())
+
+		pkt2, err := ParseJSON(data)
+		assert.NoError(t, err, pkt.Type().String())
+		assert.Equal(t, pkt, pkt2, pkt.Type().String())
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	publish := NewPublish()
+	publish.ID = 1
+	publish.Message = Message{Topic: "foo", Payload: []byte("bar"), QOS: 1}
+
+	data, err := json.Marshal(publish)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "publish",
+		"id": 1,
+		"dup": false,
+		"message": {
+			"topic": "foo",
+			"payload": "YmFy",
+			"qos": 1,
+			"retain": false
+		}
+	}`, string(data))
+
+	data, err = json.Marshal(NewPingreq())
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type": "pingreq"}`, string(data))
+}
+
+func TestJSONErrors(t *testing.T) {
+	_, err := ParseJSON([]byte(`{"type": "foo"}`))
+	assert.Equal(t, ErrInvalidPacketType, err)
+
+	_, err = ParseJSON([]byte(`{`))
+	assert.Error(t, err)
+
+	err = json.Unmarshal([]byte(`{"type": "puback", "id": 1}`), NewPubrec())
+	assert.EqualError(t, err, `invalid JSON packet type "puback", expected "pubrec"`)
+}
@@ -25,7 +25,22 @@ func (m *Message) String() string {
 		m.Topic, m.QOS, m.Retain, m.Payload)
 }
 
-// Copy returns a copy of the message.
+// Copy returns a copy of the message. The payload is not copied and thus
+// shared with the original message.
 func (m Message) Copy() *Message {
 	return &m
 }
+
+// Detach returns a copy of the message with its own copy of the payload.
+// Messages are passed by reference and share their payload when copied, e.g.
+// when a broker delivers a message to many subscribers. Callers that mutate
+// the payload of a received message must detach it beforehand.
+func (m Message) Detach() *Message {
+	if m.Payload != nil {
+		payload := make([]byte, len(m.Payload))
+		copy(payload, m.Payload)
+		m.Payload = payload
+	}
+
+	return &m
+}
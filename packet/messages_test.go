@@ -29,3 +29,22 @@ func TestMessageCopy(t *testing.T) {
 	msg1.Retain = true
 	assert.False(t, msg2.Retain)
 }
+
+func TestMessageDetach(t *testing.T) {
+	msg1 := &Message{
+		Topic:   "w",
+		Payload: []byte("m"),
+		QOS:     QOSAtLeastOnce,
+	}
+
+	msg2 := msg1.Copy()
+	msg3 := msg1.Detach()
+	assert.Equal(t, msg1, msg3)
+
+	msg1.Payload[0] = 'x'
+	assert.Equal(t, []byte("x"), msg2.Payload)
+	assert.Equal(t, []byte("m"), msg3.Payload)
+
+	msg4 := (&Message{Topic: "w"}).Detach()
+	assert.Nil(t, msg4.Payload)
+}
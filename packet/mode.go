@@ -0,0 +1,59 @@
+package packet
+
+// DecodeMode controls how protocol violations are handled while decoding.
+// Only violations that do not prevent the packet from being decoded can be
+// tolerated. These are set reserved header flags and connect flags, zero
+// length client ids without a clean session, set dup flags of QOS 0 publish
+// packets, empty publish topics and invalid UTF-8 strings.
+type DecodeMode int
+
+const (
+	// Strict returns protocol violations as errors. This is the default mode
+	// and should be used to implement compliant brokers and clients.
+	Strict DecodeMode = iota
+
+	// Lenient tolerates protocol violations and reports them as warnings. It
+	// can be used to analyze packet captures of misbehaving devices. The
+	// UTF-8 validation of strings is therefore also relaxed.
+	Lenient
+)
+
+// a modalDecoder is implemented by all packets except Publish
+type modalDecoder interface {
+	decode(src []byte, v *validator) (int, error)
+}
+
+// a validator checks protocol violations according to the decode mode, a nil
+// validator is strict
+type validator struct {
+	mode DecodeMode
+	warn func(*Error)
+}
+
+// violation returns the violation as an error in strict mode or reports it as
+// a warning in lenient mode
+func (v *validator) violation(t Type, format string, arguments ...interface{}) error {
+	// get error
+	err := makeError(t, format, arguments...)
+
+	// return error if strict
+	if v == nil || v.mode == Strict {
+		return err
+	}
+
+	// report warning
+	if v.warn != nil {
+		v.warn(err)
+	}
+
+	return nil
+}
+
+// checkUTF8 checks that the string field is valid UTF-8
+func (v *validator) checkUTF8(t Type, field, str string) error {
+	if !validUTF8(str) {
+		return v.violation(t, "%s is not valid UTF-8", field)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package packet
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func violatingPackets() [][]byte {
+	// connect with reserved flag and zero length client id without clean session
+	connect := encodePacket(NewConnect())
+	connect[9] = 0x01
+
+	// publish with invalid topic
+	publish := NewPublish()
+	publish.Message.Topic = "foox"
+	publish.Message.Payload = []byte("bar")
+	pub := encodePacket(publish)
+	pub[7] = 0xff
+
+	// qos 0 publish with dup flag
+	publish = NewPublish()
+	publish.Message.Topic = "foo"
+	dup := encodePacket(publish)
+	dup[0] |= 0x08
+
+	// publish with empty topic
+	empty := []byte{0x30, 0x05, 0x00, 0x00, 'b', 'a', 'r'}
+
+	// pingreq with reserved flags
+	pingreq := encodePacket(NewPingreq())
+	pingreq[0] |= 0x01
+
+	return [][]byte{connect, pub, dup, empty, pingreq}
+}
+
+func TestDecoderStrictMode(t *testing.T) {
+	for _, data := range violatingPackets() {
+		dec := NewDecoder(bytes.NewReader(data))
+
+		pkt, err := dec.Read()
+		assert.Error(t, err)
+		assert.Nil(t, pkt)
+	}
+}
+
+func TestDecoderLenientMode(t *testing.T) {
+	var warnings []string
+
+	var data []byte
+	for _, pkt := range violatingPackets() {
+		data = append(data, pkt...)
+	}
+
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.Mode = Lenient
+	dec.Warning = func(err *Error) {
+		warnings = append(warnings, err.Error())
+	}
+
+	pkt, err := dec.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, "", pkt.(*Connect).ClientID)
+	assert.False(t, pkt.(*Connect).CleanSession)
+
+	pkt, err = dec.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, "foo\xff", pkt.(*Publish).Message.Topic)
+
+	pkt, err = dec.Read()
+	assert.NoError(t, err)
+	assert.True(t, pkt.(*Publish).Dup)
+	assert.Equal(t, QOS(0), pkt.(*Publish).Message.QOS)
+
+	pkt, err = dec.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, "", pkt.(*Publish).Message.Topic)
+	assert.Equal(t, []byte("bar"), pkt.(*Publish).Message.Payload)
+
+	pkt, err = dec.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, PINGREQ, pkt.Type())
+
+	assert.Equal(t, []string{
+		"reserved bit 0 is not 0",
+		"clean session must be 1 if client id is zero length",
+		"topic is not valid UTF-8",
+		"dup flag must not be set for QOS level 0",
+		"topic name is empty",
+		"invalid flags, expected 0, got 1",
+	}, warnings)
+}
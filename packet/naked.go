@@ -6,13 +6,13 @@ func nakedLen() int {
 }
 
 // decodes a naked packet
-func nakedDecode(src []byte, t Type) (int, error) {
+func nakedDecode(src []byte, t Type, v *validator) (int, error) {
 	// decode header
-	hl, _, rl, err := headerDecode(src, t)
+	hl, _, rl, err := headerDecode(src, t, v)
 
 	// check remaining length
 	if rl != 0 {
-		return hl, makeError(t, "expected zero remaining length")
+		return hl, wrapError(t, ErrMalformedRemainingLength, "expected zero remaining length")
 	}
 
 	return hl, err
@@ -46,7 +46,11 @@ func (dp *Disconnect) Len() int {
 // Decode reads from the byte slice argument. It returns the total number of
 // bytes decoded, and whether there have been any errors during the process.
 func (dp *Disconnect) Decode(src []byte) (int, error) {
-	return nakedDecode(src, DISCONNECT)
+	return dp.decode(src, nil)
+}
+
+func (dp *Disconnect) decode(src []byte, v *validator) (int, error) {
+	return nakedDecode(src, DISCONNECT, v)
 }
 
 // Encode writes the packet bytes into the byte slice from the argument. It
@@ -82,7 +86,11 @@ func (pp *Pingreq) Len() int {
 // Decode reads from the byte slice argument. It returns the total number of
 // bytes decoded, and whether there have been any errors during the process.
 func (pp *Pingreq) Decode(src []byte) (int, error) {
-	return nakedDecode(src, PINGREQ)
+	return pp.decode(src, nil)
+}
+
+func (pp *Pingreq) decode(src []byte, v *validator) (int, error) {
+	return nakedDecode(src, PINGREQ, v)
 }
 
 // Encode writes the packet bytes into the byte slice from the argument. It
@@ -121,7 +129,11 @@ func (pp *Pingresp) Len() int {
 // Decode reads from the byte slice argument. It returns the total number of
 // bytes decoded, and whether there have been any errors during the process.
 func (pp *Pingresp) Decode(src []byte) (int, error) {
-	return nakedDecode(src, PINGRESP)
+	return pp.decode(src, nil)
+}
+
+func (pp *Pingresp) decode(src []byte, v *validator) (int, error) {
+	return nakedDecode(src, PINGRESP, v)
 }
 
 // Encode writes the packet bytes into the byte slice from the argument. It
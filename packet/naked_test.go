@@ -13,7 +13,7 @@ func TestNakedDecode(t *testing.T) {
 		0,
 	}
 
-	n, err := nakedDecode(pktBytes, DISCONNECT)
+	n, err := nakedDecode(pktBytes, DISCONNECT, nil)
 
 	assert.NoError(t, err)
 	assert.Equal(t, 2, n)
@@ -26,7 +26,7 @@ func TestNakedDecodeError1(t *testing.T) {
 		0,
 	}
 
-	n, err := nakedDecode(pktBytes, DISCONNECT)
+	n, err := nakedDecode(pktBytes, DISCONNECT, nil)
 
 	assert.Error(t, err)
 	assert.Equal(t, 2, n)
@@ -52,7 +52,7 @@ func TestNakedEqualDecodeEncode(t *testing.T) {
 		0,
 	}
 
-	n, err := nakedDecode(pktBytes, DISCONNECT)
+	n, err := nakedDecode(pktBytes, DISCONNECT, nil)
 
 	assert.NoError(t, err)
 	assert.Equal(t, 2, n)
@@ -64,7 +64,7 @@ func TestNakedEqualDecodeEncode(t *testing.T) {
 	assert.Equal(t, 2, n2)
 	assert.Equal(t, pktBytes, dst[:n2])
 
-	n3, err := nakedDecode(dst, DISCONNECT)
+	n3, err := nakedDecode(dst, DISCONNECT, nil)
 
 	assert.NoError(t, err)
 	assert.Equal(t, 2, n3)
@@ -88,7 +88,7 @@ func BenchmarkNakedDecode(b *testing.B) {
 	}
 
 	for i := 0; i < b.N; i++ {
-		_, err := nakedDecode(pktBytes, DISCONNECT)
+		_, err := nakedDecode(pktBytes, DISCONNECT, nil)
 		if err != nil {
 			panic(err)
 		}
@@ -109,6 +109,8 @@ func testNakedImplementation(t *testing.T, _t Type) {
 	n, err = pkt.Decode(buf)
 	assert.NoError(t, err)
 	assert.Equal(t, 2, n)
+
+	assertRoundTrip(t, pkt)
 }
 
 func TestDisconnectImplementation(t *testing.T) {
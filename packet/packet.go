@@ -1,7 +1,11 @@
 // Package packet implements functionality for encoding and decoding MQTT packets.
 package packet
 
-import "encoding/binary"
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
 
 // QOS is the type used to store quality of service levels.
 type QOS byte
@@ -79,8 +83,13 @@ func DetectPacket(src []byte) (int, Type) {
 }
 
 // GetID checks the packets type and returns its ID and true, or if it
-// does not have a ID, zero and false.
+// does not have a ID, zero and false. The packet of a Frame is checked.
 func GetID(pkt Generic) (ID, bool) {
+	// unwrap frames
+	if frame, ok := pkt.(*Frame); ok {
+		pkt = frame.Packet
+	}
+
 	switch pkt.Type() {
 	case PUBLISH:
 		return pkt.(*Publish).ID, true
@@ -105,9 +114,12 @@ func GetID(pkt Generic) (ID, bool) {
 	return 0, false
 }
 
-// Fuzz is a basic fuzzing test that works with https://github.com/dvyukov/go-fuzz:
+// Fuzz is a differential fuzzing test that works with https://github.com/dvyukov/go-fuzz.
+// Every successfully decoded packet is encoded and decoded again and the
+// function panics if the packets differ. A seed corpus that covers all packet
+// types and edge lengths is available in the fuzz directory:
 //
-//		$ go-fuzz-build github.com/gomqtt/packet
+//		$ go-fuzz-build github.com/256dpi/gomqtt/packet
 //		$ go-fuzz -bin=./packet-fuzz.zip -workdir=./fuzz
 func Fuzz(data []byte) int {
 	// check for zero length data
@@ -133,6 +145,73 @@ func Fuzz(data []byte) int {
 		return 0
 	}
 
+	// check round trip
+	checkSymmetry(pkt)
+
 	// everything was ok
 	return 1
 }
+
+// checkSymmetry panics if the packet does not survive a round trip
+func checkSymmetry(pkt Generic) {
+	err := CheckRoundTrip(pkt)
+	if err != nil {
+		panic(err.Error())
+	}
+}
+
+// CheckRoundTrip encodes the packet, decodes it again and encodes the decoded
+// packet. It returns an error if the decoded packet differs from the original
+// packet or if both encodings are not byte identical. Nil and empty payloads
+// and slices are considered equal. The packettest package provides a helper
+// to run the check in tests.
+func CheckRoundTrip(pkt Generic) error {
+	// encode packet
+	buf1, err := encodeRoundTrip(pkt)
+	if err != nil {
+		return err
+	}
+
+	// decode packet
+	pkt2, err := pkt.Type().New()
+	if err != nil {
+		return err
+	}
+	n, err := pkt2.Decode(buf1)
+	if err != nil {
+		return fmt.Errorf("failed to decode encoded packet %s: %s", pkt.String(), err.Error())
+	} else if n != len(buf1) {
+		return fmt.Errorf("decoded %d bytes of packet %s, expected %d", n, pkt.String(), len(buf1))
+	}
+
+	// compare packets
+	if !Equal(pkt, pkt2) {
+		return fmt.Errorf("asymmetric packet %s, decoded again as %s", pkt.String(), pkt2.String())
+	}
+
+	// encode decoded packet
+	buf2, err := encodeRoundTrip(pkt2)
+	if err != nil {
+		return err
+	}
+
+	// compare encodings
+	if !bytes.Equal(buf1, buf2) {
+		return fmt.Errorf("asymmetric encoding of packet %s: %x, encoded again as %x", pkt.String(), buf1, buf2)
+	}
+
+	return nil
+}
+
+func encodeRoundTrip(pkt Generic) ([]byte, error) {
+	// encode packet
+	buf := make([]byte, pkt.Len())
+	n, err := pkt.Encode(buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode packet %s: %s", pkt.String(), err.Error())
+	} else if n != len(buf) {
+		return nil, fmt.Errorf("encoded %d bytes of packet %s, expected %d", n, pkt.String(), len(buf))
+	}
+
+	return buf, nil
+}
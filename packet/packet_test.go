@@ -1,6 +1,12 @@
 package packet
 
 import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -144,3 +150,78 @@ func TestFuzz(t *testing.T) {
 	b3 := []byte{2 << 4, 0x02, 0x00, 0x01}
 	assert.Equal(t, 1, Fuzz(b3))
 }
+
+var updateCorpus = flag.Bool("update-corpus", false, "regenerate the fuzz seed corpus")
+
+func fuzzCorpus() map[string][]byte {
+	corpus := map[string][]byte{}
+
+	// add all vectors
+	for _, v := range Vectors() {
+		corpus[strings.Replace(v.Name, "/", "-", -1)] = v.Data
+	}
+
+	// add edge lengths of the remaining length encoding
+	for _, rl := range []int{127, 128, 16383, 16384} {
+		pkt := NewPublish()
+		pkt.Message.Topic = "t"
+		pkt.Message.Payload = make([]byte, rl-3)
+
+		buf := make([]byte, pkt.Len())
+		_, err := pkt.Encode(buf)
+		if err != nil {
+			panic(err)
+		}
+
+		corpus[fmt.Sprintf("publish-length-%d", rl)] = buf
+	}
+
+	return corpus
+}
+
+func TestFuzzCorpus(t *testing.T) {
+	corpus := fuzzCorpus()
+	dir := filepath.Join("fuzz", "corpus")
+
+	if *updateCorpus {
+		assert.NoError(t, os.RemoveAll(dir))
+		assert.NoError(t, os.MkdirAll(dir, 0755))
+
+		for name, data := range corpus {
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), data, 0644))
+		}
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, len(corpus))
+
+	for name, data := range corpus {
+		file, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.NoError(t, err, name)
+		assert.Equal(t, data, file, name)
+		assert.Equal(t, 1, Fuzz(data), name)
+	}
+}
+
+func TestFuzzAsymmetry(t *testing.T) {
+	// publish with empty topic
+	assert.Equal(t, 0, Fuzz([]byte{3 << 4, 0x02, 0x00, 0x00}))
+
+	// publish with remaining length smaller than the topic
+	assert.Equal(t, 0, Fuzz([]byte{3 << 4, 0x00, 0x00, 0x01, 't'}))
+
+	// connect with empty will topic
+	assert.Equal(t, 0, Fuzz([]byte{1 << 4, 16, 0, 4, 'M', 'Q', 'T', 'T', 4, 0x06, 0, 0, 0, 1, 'c', 0, 0, 0, 0}))
+}
+
+func TestCheckRoundTrip(t *testing.T) {
+	for _, v := range Vectors() {
+		assertRoundTrip(t, v.Packet)
+	}
+
+	pkt := NewPublish()
+	pkt.Message.Topic = "foo"
+	pkt.Message.QOS = 1
+	assert.Error(t, CheckRoundTrip(pkt))
+}
@@ -0,0 +1,22 @@
+// Package packettest provides helpers to test packet implementations and code
+// that constructs packets.
+package packettest
+
+import (
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// RoundTrip asserts that the packet survives a round trip. The packet is
+// encoded, decoded and encoded again and the test fails if the decoded packet
+// differs from the original packet or if both encodings are not byte
+// identical. See packet.CheckRoundTrip for details.
+func RoundTrip(t testing.TB, pkt packet.Generic) {
+	t.Helper()
+
+	err := packet.CheckRoundTrip(pkt)
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,30 @@
+package packettest
+
+import (
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	testing.TB
+	errors []interface{}
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Error(args ...interface{}) {
+	r.errors = append(r.errors, args...)
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, v := range packet.Vectors() {
+		RoundTrip(t, v.Packet)
+	}
+
+	rec := &recorder{TB: t}
+	RoundTrip(rec, packet.NewPublish())
+	assert.Len(t, rec.errors, 1)
+}
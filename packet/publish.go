@@ -37,6 +37,20 @@ func (pp *Publish) String() string {
 		pp.ID, pp.Message.String(), pp.Dup)
 }
 
+// MarkRetransmission sets the dup flag to indicate that the packet is a
+// re-delivery of an earlier attempt. The packet id is kept as the receiver
+// uses it to detect the duplicate. QOS 0 messages are never retransmitted
+// and are left unchanged.
+func (pp *Publish) MarkRetransmission() {
+	pp.Dup = pp.Message.QOS > 0
+}
+
+// MarkFresh clears the dup flag to indicate that the packet is sent for the
+// first time.
+func (pp *Publish) MarkFresh() {
+	pp.Dup = false
+}
+
 // Len returns the byte length of the encoded packet.
 func (pp *Publish) Len() int {
 	ml := pp.len()
@@ -46,10 +60,16 @@ func (pp *Publish) Len() int {
 // Decode reads from the byte slice argument. It returns the total number of
 // bytes decoded, and whether there have been any errors during the process.
 func (pp *Publish) Decode(src []byte) (int, error) {
+	return pp.decode(src, nil, nil)
+}
+
+// decode will decode the packet and use the optional allocator to allocate
+// the payload
+func (pp *Publish) decode(src []byte, alloc func(int) []byte, v *validator) (int, error) {
 	total := 0
 
 	// decode header
-	hl, flags, rl, err := headerDecode(src[total:], PUBLISH)
+	hl, flags, rl, err := headerDecode(src[total:], PUBLISH, v)
 	total += hl
 	if err != nil {
 		return total, err
@@ -62,12 +82,20 @@ func (pp *Publish) Decode(src []byte) (int, error) {
 
 	// check qos
 	if !pp.Message.QOS.Successful() {
-		return total, makeError(pp.Type(), "invalid QOS level (%d)", pp.Message.QOS)
+		return total, wrapError(pp.Type(), ErrInvalidQOS, "invalid QOS level (%d)", pp.Message.QOS)
+	}
+
+	// check dup flag
+	if pp.Dup && pp.Message.QOS == 0 {
+		err = v.violation(pp.Type(), "dup flag must not be set for QOS level 0")
+		if err != nil {
+			return total, err
+		}
 	}
 
 	// check buffer length
 	if len(src) < total+2 {
-		return total, makeError(pp.Type(), "insufficient buffer size, expected %d, got %d", total+2, len(src))
+		return total, wrapError(pp.Type(), ErrInsufficientBuffer, "insufficient buffer size, expected %d, got %d", total+2, len(src))
 	}
 
 	n := 0
@@ -79,10 +107,24 @@ func (pp *Publish) Decode(src []byte) (int, error) {
 		return total, err
 	}
 
+	// check topic length
+	if len(pp.Message.Topic) == 0 {
+		err = v.violation(pp.Type(), "topic name is empty")
+		if err != nil {
+			return total, err
+		}
+	}
+
+	// check topic
+	err = v.checkUTF8(pp.Type(), "topic", pp.Message.Topic)
+	if err != nil {
+		return total, err
+	}
+
 	if pp.Message.QOS != 0 {
 		// check buffer length
 		if len(src) < total+2 {
-			return total, makeError(pp.Type(), "insufficient buffer size, expected %d, got %d", total+2, len(src))
+			return total, wrapError(pp.Type(), ErrInsufficientBuffer, "insufficient buffer size, expected %d, got %d", total+2, len(src))
 		}
 
 		// read packet id
@@ -91,16 +133,25 @@ func (pp *Publish) Decode(src []byte) (int, error) {
 
 		// check packet id
 		if !pp.ID.Valid() {
-			return total, makeError(pp.Type(), "packet id must be grater than zero")
+			return total, wrapError(pp.Type(), ErrInvalidID, "packet id must be grater than zero")
 		}
 	}
 
 	// calculate payload length
 	l := int(rl) - (total - hl)
 
+	// check remaining length
+	if l < 0 {
+		return total, wrapError(pp.Type(), ErrMalformedRemainingLength, "remaining length (%d) is smaller than the variable header", rl)
+	}
+
 	// read payload
 	if l > 0 {
-		pp.Message.Payload = make([]byte, l)
+		if alloc != nil {
+			pp.Message.Payload = alloc(l)
+		} else {
+			pp.Message.Payload = make([]byte, l)
+		}
 		copy(pp.Message.Payload, src[total:total+l])
 		total += len(pp.Message.Payload)
 	}
@@ -137,12 +188,17 @@ func (pp *Publish) Encode(dst []byte) (int, error) {
 
 	// check qos
 	if !pp.Message.QOS.Successful() {
-		return 0, makeError(pp.Type(), "invalid QOS level %d", pp.Message.QOS)
+		return 0, wrapError(pp.Type(), ErrInvalidQOS, "invalid QOS level %d", pp.Message.QOS)
+	}
+
+	// check dup flag
+	if pp.Dup && pp.Message.QOS == 0 {
+		return total, makeError(pp.Type(), "dup flag must not be set for QOS level 0")
 	}
 
 	// check packet id
 	if pp.Message.QOS > 0 && !pp.ID.Valid() {
-		return total, makeError(pp.Type(), "packet id must be grater than zero")
+		return total, wrapError(pp.Type(), ErrInvalidID, "packet id must be grater than zero")
 	}
 
 	// set qos
@@ -156,7 +212,7 @@ func (pp *Publish) Encode(dst []byte) (int, error) {
 	}
 
 	// write topic
-	n, err = writeLPString(dst[total:], pp.Message.Topic, pp.Type())
+	n, err = writeUTF8String(dst[total:], pp.Message.Topic, "topic", pp.Type())
 	total += n
 	if err != nil {
 		return total, err
@@ -146,6 +146,21 @@ func TestPublishDecodeError6(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestPublishDecodeError7(t *testing.T) {
+	pktBytes := []byte{
+		byte(PUBLISH<<4) | 8, // < dup with qos 0
+		3,
+		0, // topic name MSB
+		1, // topic name LSB
+		't',
+	}
+
+	pkt := NewPublish()
+	_, err := pkt.Decode(pktBytes)
+
+	assert.Error(t, err)
+}
+
 func TestPublishEncode1(t *testing.T) {
 	pktBytes := []byte{
 		byte(PUBLISH<<4) | 11,
@@ -249,6 +264,36 @@ func TestPublishEncodeError5(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestPublishEncodeError6(t *testing.T) {
+	pkt := NewPublish()
+	pkt.Message.Topic = "test"
+	pkt.Dup = true // < dup with qos 0
+
+	dst := make([]byte, pkt.Len())
+	_, err := pkt.Encode(dst)
+
+	assert.Error(t, err)
+}
+
+func TestPublishMarkRetransmission(t *testing.T) {
+	pkt := NewPublish()
+	pkt.Message.Topic = "test"
+	pkt.Message.QOS = QOSAtLeastOnce
+	pkt.ID = 7
+
+	pkt.MarkRetransmission()
+	assert.True(t, pkt.Dup)
+	assert.Equal(t, ID(7), pkt.ID)
+
+	pkt.MarkFresh()
+	assert.False(t, pkt.Dup)
+	assert.Equal(t, ID(7), pkt.ID)
+
+	pkt.Message.QOS = QOSAtMostOnce
+	pkt.MarkRetransmission()
+	assert.False(t, pkt.Dup)
+}
+
 func TestPublishEqualDecodeEncode(t *testing.T) {
 	pktBytes := []byte{
 		byte(PUBLISH<<4) | 2,
@@ -278,6 +323,8 @@ func TestPublishEqualDecodeEncode(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.Equal(t, len(pktBytes), n3)
+
+	assertRoundTrip(t, pkt)
 }
 
 func BenchmarkPublishEncode(b *testing.B) {
@@ -3,7 +3,10 @@ package packet
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
 	"time"
 
@@ -18,21 +21,96 @@ var ErrDetectionOverflow = errors.New("detection overflow")
 // exceeded its read limit.
 var ErrReadLimitExceeded = errors.New("read limit exceeded")
 
+// ErrChecksumMismatch is returned by the Decoder if checksums are enabled and
+// the trailer of a packet does not match its contents.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ChecksumLength is the length of the checksum trailer.
+const ChecksumLength = 4
+
+// A ReservedTypeError is returned by the Decoder if the next packet has the
+// reserved type 0 or 15. It unwraps to ErrInvalidPacketType.
+type ReservedTypeError struct {
+	// The first byte of the packet.
+	Header byte
+
+	// The offset of the packet in the stream.
+	Offset int64
+}
+
+// Error implements the error interface.
+func (e *ReservedTypeError) Error() string {
+	return fmt.Sprintf("invalid packet type: reserved type %d (first byte 0x%02x) at offset %d", e.Header>>4, e.Header, e.Offset)
+}
+
+// Unwrap returns ErrInvalidPacketType.
+func (e *ReservedTypeError) Unwrap() error {
+	return ErrInvalidPacketType
+}
+
 // An Encoder wraps a Writer and continuously encodes packets.
 type Encoder struct {
-	writer *mercury.Writer
-	buffer bytes.Buffer
+	// Checksum can be set to append a big endian CRC-32 (IEEE) trailer to
+	// every packet. The trailer is not part of MQTT and must be enabled on
+	// both ends by an out of band agreement. It is intended for links like
+	// serial lines or radios that do not guarantee the integrity of the
+	// stream.
+	Checksum bool
+
+	target  io.Writer
+	delay   time.Duration
+	size    int
+	writer  *mercury.Writer
+	buffer  bytes.Buffer
+	trailer [ChecksumLength]byte
 }
 
 // NewEncoder creates a new Encoder.
 func NewEncoder(writer io.Writer, maxWriteDelay time.Duration) *Encoder {
 	return &Encoder{
+		target: writer,
+		delay:  maxWriteDelay,
 		writer: mercury.NewWriter(writer, maxWriteDelay),
 	}
 }
 
+// SetBufferSize flushes the write buffer and replaces it with a buffer of the
+// specified size. A size of zero restores the default size of 4096 bytes.
+// Packets that exceed the buffer size are written directly.
+func (e *Encoder) SetBufferSize(size int) error {
+	e.size = size
+	return e.replace()
+}
+
+// SetMaxWriteDelay flushes the write buffer and changes the maximum delay after
+// which asynchronously written packets are flushed. Together with the buffer
+// size, which is the threshold at which the buffer is flushed regardless of
+// the delay, it controls how many small packets are coalesced into one write.
+func (e *Encoder) SetMaxWriteDelay(maxWriteDelay time.Duration) error {
+	e.delay = maxWriteDelay
+	return e.replace()
+}
+
+func (e *Encoder) replace() error {
+	// flush buffer
+	err := e.writer.Flush()
+	if err != nil {
+		return err
+	}
+
+	// replace writer
+	e.writer = mercury.NewWriterSize(e.target, e.delay, e.size)
+
+	return nil
+}
+
 // Write encodes and writes the passed packet to the write buffer.
 func (e *Encoder) Write(pkt Generic, async bool) error {
+	// write frames directly
+	if frame, ok := pkt.(*Frame); ok {
+		return e.write(frame.Bytes, async)
+	}
+
 	// reset and eventually grow buffer
 	packetLength := pkt.Len()
 	e.buffer.Reset()
@@ -45,7 +123,23 @@ func (e *Encoder) Write(pkt Generic, async bool) error {
 		return err
 	}
 
+	return e.write(buf, async)
+}
+
+func (e *Encoder) write(buf []byte, async bool) error {
+	// write buffer and checksum trailer
+	if e.Checksum {
+		_, err := e.writer.Write(buf)
+		if err != nil {
+			return err
+		}
+
+		binary.BigEndian.PutUint32(e.trailer[:], crc32.ChecksumIEEE(buf))
+		buf = e.trailer[:]
+	}
+
 	// write buffer
+	var err error
 	if async {
 		_, err = e.writer.Write(buf)
 	} else {
@@ -67,17 +161,68 @@ func (e *Encoder) Flush() error {
 type Decoder struct {
 	Limit int64
 
+	// Arena can be set to allocate decoded packets from an arena. The arena
+	// must be reset by the caller once all packets of a batch have been
+	// processed.
+	Arena *Arena
+
+	// Mode controls how protocol violations are handled. In lenient mode
+	// tolerated violations are reported to the Warning callback.
+	Mode DecodeMode
+
+	// Warning is called with protocol violations that have been tolerated in
+	// lenient mode.
+	Warning func(*Error)
+
+	// Checksum can be set to read and verify the CRC-32 trailer that follows
+	// every packet if the Encoder of the other end has checksums enabled.
+	Checksum bool
+
+	source io.Reader
 	reader *bufio.Reader
 	buffer bytes.Buffer
+	offset int64
 }
 
 // NewDecoder returns a new Decoder.
 func NewDecoder(reader io.Reader) *Decoder {
 	return &Decoder{
+		source: reader,
 		reader: bufio.NewReader(reader),
 	}
 }
 
+// SetBufferSize replaces the read buffer with a buffer of the specified size.
+// A size of zero restores the default size of 4096 bytes. Already buffered
+// data is preserved. Packets that exceed the buffer size are read in multiple
+// steps.
+func (d *Decoder) SetBufferSize(size int) {
+	// copy buffered data
+	var buffered []byte
+	if n := d.reader.Buffered(); n > 0 {
+		buffered, _ = d.reader.Peek(n)
+		buffered = append([]byte(nil), buffered...)
+	}
+
+	// prepare source
+	source := d.source
+	if len(buffered) > 0 {
+		source = io.MultiReader(bytes.NewReader(buffered), d.source)
+	}
+
+	// replace reader
+	if size <= 0 {
+		size = 4096
+	}
+	d.reader = bufio.NewReaderSize(source, size)
+}
+
+// Offset returns the number of bytes that have been consumed by the decoder,
+// which is the offset of the next packet in the stream.
+func (d *Decoder) Offset() int64 {
+	return d.offset
+}
+
 // Read reads the next packet from the buffered reader.
 func (d *Decoder) Read() (Generic, error) {
 	// initial detection length
@@ -98,6 +243,11 @@ func (d *Decoder) Read() (Generic, error) {
 			return nil, err
 		}
 
+		// check reserved types
+		if typ := header[0] >> 4; typ == 0 || typ == 15 {
+			return nil, &ReservedTypeError{Header: header[0], Offset: d.offset}
+		}
+
 		// detect packet
 		packetLength, packetType := DetectPacket(header)
 
@@ -114,15 +264,26 @@ func (d *Decoder) Read() (Generic, error) {
 		}
 
 		// create packet
-		pkt, err := packetType.New()
+		var pkt Generic
+		if d.Arena != nil {
+			pkt, err = d.Arena.New(packetType)
+		} else {
+			pkt, err = packetType.New()
+		}
 		if err != nil {
 			return nil, err
 		}
 
+		// get read length
+		readLength := packetLength
+		if d.Checksum {
+			readLength += ChecksumLength
+		}
+
 		// reset and eventually grow buffer
 		d.buffer.Reset()
-		d.buffer.Grow(packetLength)
-		buf := d.buffer.Bytes()[0:packetLength]
+		d.buffer.Grow(readLength)
+		buf := d.buffer.Bytes()[0:readLength]
 
 		// read whole packet (will not return EOF)
 		_, err = io.ReadFull(d.reader, buf)
@@ -130,8 +291,31 @@ func (d *Decoder) Read() (Generic, error) {
 			return nil, err
 		}
 
+		// advance offset
+		d.offset += int64(readLength)
+
+		// verify and remove checksum trailer
+		if d.Checksum {
+			if binary.BigEndian.Uint32(buf[packetLength:]) != crc32.ChecksumIEEE(buf[:packetLength]) {
+				return nil, ErrChecksumMismatch
+			}
+			buf = buf[:packetLength]
+		}
+
+		// prepare validator
+		var v *validator
+		if d.Mode != Strict {
+			v = &validator{mode: d.Mode, warn: d.Warning}
+		}
+
 		// decode buffer
-		_, err = pkt.Decode(buf)
+		if publish, ok := pkt.(*Publish); ok && d.Arena != nil {
+			_, err = publish.decode(buf, d.Arena.alloc, v)
+		} else if publish, ok := pkt.(*Publish); ok {
+			_, err = publish.decode(buf, nil, v)
+		} else {
+			_, err = pkt.(modalDecoder).decode(buf, v)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -47,6 +47,49 @@ func TestEncoderWriterError(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestEncoderSetBufferSize(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf, time.Hour)
+
+	err := enc.Write(NewConnect(), true)
+	assert.NoError(t, err)
+	assert.Len(t, buf.Bytes(), 0)
+
+	err = enc.SetBufferSize(16)
+	assert.NoError(t, err)
+	assert.Len(t, buf.Bytes(), 14)
+
+	pkt := NewPublish()
+	pkt.Message.Topic = "foo"
+	pkt.Message.Payload = make([]byte, 64)
+
+	err = enc.Write(pkt, true)
+	assert.NoError(t, err)
+	assert.Len(t, buf.Bytes(), 14+pkt.Len())
+}
+
+func TestEncoderSetMaxWriteDelay(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf, time.Hour)
+
+	err := enc.Write(NewConnect(), true)
+	assert.NoError(t, err)
+	assert.Len(t, buf.Bytes(), 0)
+
+	err = enc.SetMaxWriteDelay(time.Millisecond)
+	assert.NoError(t, err)
+	assert.Len(t, buf.Bytes(), 14)
+
+	err = enc.Write(NewConnect(), true)
+	assert.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+
+	err = enc.Flush()
+	assert.NoError(t, err)
+	assert.Len(t, buf.Bytes(), 28)
+}
+
 func TestDecoder(t *testing.T) {
 	buf := new(bytes.Buffer)
 	dec := NewDecoder(buf)
@@ -61,6 +104,36 @@ func TestDecoder(t *testing.T) {
 	assert.NotNil(t, pkt)
 }
 
+func TestDecoderSetBufferSize(t *testing.T) {
+	buf := new(bytes.Buffer)
+	dec := NewDecoder(buf)
+
+	pkt := NewPublish()
+	pkt.Message.Topic = "foo"
+	pkt.Message.Payload = make([]byte, 64)
+
+	for i := 0; i < 2; i++ {
+		b := make([]byte, pkt.Len())
+		_, err := pkt.Encode(b)
+		assert.NoError(t, err)
+		buf.Write(b)
+	}
+
+	res, err := dec.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, pkt, res)
+
+	dec.SetBufferSize(16)
+
+	res, err = dec.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, pkt, res)
+
+	res, err = dec.Read()
+	assert.Equal(t, io.EOF, err)
+	assert.Nil(t, res)
+}
+
 func TestDecoderDetectionOverflowError(t *testing.T) {
 	buf := new(bytes.Buffer)
 	dec := NewDecoder(buf)
@@ -104,12 +177,29 @@ func TestDecoderInvalidTypeError(t *testing.T) {
 	assert.Nil(t, pkt)
 }
 
+func TestDecoderReservedTypeError(t *testing.T) {
+	buf := new(bytes.Buffer)
+	dec := NewDecoder(buf)
+
+	buf.Write([]byte{0xc0, 0x00, 0xf2, 0x00})
+
+	pkt, err := dec.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, PINGREQ, pkt.Type())
+
+	pkt, err = dec.Read()
+	assert.Equal(t, &ReservedTypeError{Header: 0xf2, Offset: 2}, err)
+	assert.True(t, errors.Is(err, ErrInvalidPacketType))
+	assert.Equal(t, "invalid packet type: reserved type 15 (first byte 0xf2) at offset 2", err.Error())
+	assert.Nil(t, pkt)
+}
+
 func TestDecoderReadLimitError(t *testing.T) {
 	buf := new(bytes.Buffer)
 	dec := NewDecoder(buf)
 	dec.Limit = 1
 
-	buf.Write([]byte{0x00, 0x00})
+	buf.Write([]byte{0xc0, 0x00})
 
 	pkt, err := dec.Read()
 	assert.Equal(t, ErrReadLimitExceeded, err)
@@ -158,3 +248,45 @@ func TestStream(t *testing.T) {
 	assert.NotNil(t, pkt)
 	assert.NoError(t, err)
 }
+
+func TestStreamChecksum(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	enc := NewEncoder(buf, time.Millisecond)
+	enc.Checksum = true
+
+	err := enc.Write(NewConnect(), false)
+	assert.NoError(t, err)
+
+	frame, err := NewFrame(NewPingreq())
+	assert.NoError(t, err)
+
+	err = enc.Write(frame, false)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 14+2+2*ChecksumLength, buf.Len())
+	assert.Equal(t, []byte{0xc0, 0x0, 0x8a, 0x23, 0xc5, 0xb1}, buf.Bytes()[18:])
+
+	dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+	dec.Checksum = true
+
+	pkt, err := dec.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, NewConnect(), pkt)
+
+	pkt, err = dec.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, NewPingreq(), pkt)
+	assert.Equal(t, int64(buf.Len()), dec.Offset())
+
+	// corrupt payload
+	data := buf.Bytes()
+	data[5] ^= 0xff
+
+	dec = NewDecoder(bytes.NewReader(data))
+	dec.Checksum = true
+
+	pkt, err = dec.Read()
+	assert.Equal(t, ErrChecksumMismatch, err)
+	assert.Nil(t, pkt)
+}
@@ -2,6 +2,8 @@ package packet
 
 import (
 	"encoding/binary"
+	"strings"
+	"unicode/utf8"
 )
 
 const maxLPLength uint16 = 65535
@@ -9,7 +11,7 @@ const maxLPLength uint16 = 65535
 // read length prefixed bytes
 func readLPBytes(buf []byte, safe bool, t Type) ([]byte, int, error) {
 	if len(buf) < 2 {
-		return nil, 0, makeError(t, "insufficient buffer size, expected 2, got %d", len(buf))
+		return nil, 0, wrapError(t, ErrInsufficientBuffer, "insufficient buffer size, expected 2, got %d", len(buf))
 	}
 
 	n, total := 0, 0
@@ -19,7 +21,7 @@ func readLPBytes(buf []byte, safe bool, t Type) ([]byte, int, error) {
 	total += n
 
 	if len(buf) < total {
-		return nil, total, makeError(t, "insufficient buffer size, expected %d, got %d", total, len(buf))
+		return nil, total, wrapError(t, ErrInsufficientBuffer, "insufficient buffer size, expected %d, got %d", total, len(buf))
 	}
 
 	// copy buffer in safe mode
@@ -35,7 +37,7 @@ func readLPBytes(buf []byte, safe bool, t Type) ([]byte, int, error) {
 // read length prefixed string
 func readLPString(buf []byte, t Type) (string, int, error) {
 	if len(buf) < 2 {
-		return "", 0, makeError(t, "insufficient buffer size, expected 2, got %d", len(buf))
+		return "", 0, wrapError(t, ErrInsufficientBuffer, "insufficient buffer size, expected 2, got %d", len(buf))
 	}
 
 	n, total := 0, 0
@@ -45,7 +47,7 @@ func readLPString(buf []byte, t Type) (string, int, error) {
 	total += n
 
 	if len(buf) < total {
-		return "", total, makeError(t, "insufficient buffer size, expected %d, got %d", total, len(buf))
+		return "", total, wrapError(t, ErrInsufficientBuffer, "insufficient buffer size, expected %d, got %d", total, len(buf))
 	}
 
 	return string(buf[2:total]), total, nil
@@ -60,7 +62,7 @@ func writeLPBytes(buf []byte, b []byte, t Type) (int, error) {
 	}
 
 	if len(buf) < 2+n {
-		return 0, makeError(t, "insufficient buffer size, expected %d, got %d", 2+n, len(buf))
+		return 0, wrapError(t, ErrInsufficientBuffer, "insufficient buffer size, expected %d, got %d", 2+n, len(buf))
 	}
 
 	binary.BigEndian.PutUint16(buf, uint16(n))
@@ -76,3 +78,18 @@ func writeLPBytes(buf []byte, b []byte, t Type) (int, error) {
 func writeLPString(buf []byte, str string, t Type) (int, error) {
 	return writeLPBytes(buf, []byte(str), t)
 }
+
+// write length prefixed UTF-8 string
+func writeUTF8String(buf []byte, str, field string, t Type) (int, error) {
+	if !validUTF8(str) {
+		return 0, makeError(t, "%s is not valid UTF-8", field)
+	}
+
+	return writeLPString(buf, str, t)
+}
+
+// validUTF8 checks that the string is well-formed UTF-8 as required by the
+// spec, which disallows surrogates (U+D800 to U+DFFF) and the null character
+func validUTF8(str string) bool {
+	return utf8.ValidString(str) && !strings.ContainsRune(str, 0)
+}
@@ -76,3 +76,26 @@ func TestWriteLPBytesErrors(t *testing.T) {
 	_, err = writeLPBytes([]byte{}, make([]byte, 10), CONNECT)
 	assert.Error(t, err)
 }
+
+func TestValidUTF8(t *testing.T) {
+	assert.True(t, validUTF8(""))
+	assert.True(t, validUTF8("foo/bar"))
+	assert.True(t, validUTF8("f\u00f6\u00f6/\U0001f600"))
+	assert.False(t, validUTF8("foo\x00bar"))
+	assert.False(t, validUTF8("foo\xff"))
+	assert.False(t, validUTF8("\xed\xa0\x80"))
+}
+
+func TestWriteUTF8String(t *testing.T) {
+	buf := make([]byte, 10)
+
+	n, err := writeUTF8String(buf, "foo", "topic", PUBLISH)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	_, err = writeUTF8String(buf, "foo\x00", "topic", PUBLISH)
+	assert.EqualError(t, err, "topic is not valid UTF-8")
+
+	_, err = writeUTF8String(buf, "\xed\xbf\xbf", "topic", PUBLISH)
+	assert.EqualError(t, err, "topic is not valid UTF-8")
+}
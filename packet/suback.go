@@ -48,10 +48,14 @@ func (sp *Suback) Len() int {
 // Decode reads from the byte slice argument. It returns the total number of
 // bytes decoded, and whether there have been any errors during the process.
 func (sp *Suback) Decode(src []byte) (int, error) {
+	return sp.decode(src, nil)
+}
+
+func (sp *Suback) decode(src []byte, v *validator) (int, error) {
 	total := 0
 
 	// decode header
-	hl, _, rl, err := headerDecode(src[total:], SUBACK)
+	hl, _, rl, err := headerDecode(src[total:], SUBACK, v)
 	total += hl
 	if err != nil {
 		return total, err
@@ -59,12 +63,12 @@ func (sp *Suback) Decode(src []byte) (int, error) {
 
 	// check buffer length
 	if len(src) < total+2 {
-		return total, makeError(sp.Type(), "insufficient buffer size, expected %d, got %d", total+2, len(src))
+		return total, wrapError(sp.Type(), ErrInsufficientBuffer, "insufficient buffer size, expected %d, got %d", total+2, len(src))
 	}
 
 	// check remaining length
 	if rl <= 2 {
-		return total, makeError(sp.Type(), "expected remaining length to be greater than 2, got %d", rl)
+		return total, wrapError(sp.Type(), ErrMalformedRemainingLength, "expected remaining length to be greater than 2, got %d", rl)
 	}
 
 	// read packet id
@@ -73,7 +77,7 @@ func (sp *Suback) Decode(src []byte) (int, error) {
 
 	// check packet id
 	if !sp.ID.Valid() {
-		return total, makeError(sp.Type(), "packet id must be grater than zero")
+		return total, wrapError(sp.Type(), ErrInvalidID, "packet id must be grater than zero")
 	}
 
 	// calculate number of return codes
@@ -111,7 +115,7 @@ func (sp *Suback) Encode(dst []byte) (int, error) {
 
 	// check packet id
 	if !sp.ID.Valid() {
-		return total, makeError(sp.Type(), "packet id must be grater than zero")
+		return total, wrapError(sp.Type(), ErrInvalidID, "packet id must be grater than zero")
 	}
 
 	// encode header
@@ -199,6 +199,8 @@ func TestSubackEqualDecodeEncode(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.Equal(t, len(pktBytes), n3)
+
+	assertRoundTrip(t, pkt)
 }
 
 func BenchmarkSubackEncode(b *testing.B) {
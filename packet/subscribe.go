@@ -61,10 +61,14 @@ func (sp *Subscribe) Len() int {
 // Decode reads from the byte slice argument. It returns the total number of
 // bytes decoded, and whether there have been any errors during the process.
 func (sp *Subscribe) Decode(src []byte) (int, error) {
+	return sp.decode(src, nil)
+}
+
+func (sp *Subscribe) decode(src []byte, v *validator) (int, error) {
 	total := 0
 
 	// decode header
-	hl, _, rl, err := headerDecode(src[total:], SUBSCRIBE)
+	hl, _, rl, err := headerDecode(src[total:], SUBSCRIBE, v)
 	total += hl
 	if err != nil {
 		return total, err
@@ -72,7 +76,7 @@ func (sp *Subscribe) Decode(src []byte) (int, error) {
 
 	// check buffer length
 	if len(src) < total+2 {
-		return total, makeError(sp.Type(), "insufficient buffer size, expected %d, got %d", total+2, len(src))
+		return total, wrapError(sp.Type(), ErrInsufficientBuffer, "insufficient buffer size, expected %d, got %d", total+2, len(src))
 	}
 
 	// read packet id
@@ -81,7 +85,7 @@ func (sp *Subscribe) Decode(src []byte) (int, error) {
 
 	// check packet id
 	if !sp.ID.Valid() {
-		return total, makeError(sp.Type(), "packet id must be grater than zero")
+		return total, wrapError(sp.Type(), ErrInvalidID, "packet id must be grater than zero")
 	}
 
 	// reset subscriptions
@@ -98,15 +102,21 @@ func (sp *Subscribe) Decode(src []byte) (int, error) {
 			return total, err
 		}
 
+		// check topic
+		err = v.checkUTF8(sp.Type(), "topic", t)
+		if err != nil {
+			return total, err
+		}
+
 		// check buffer length
 		if len(src) < total+1 {
-			return total, makeError(sp.Type(), "insufficient buffer size, expected %d, got %d", total+1, len(src))
+			return total, wrapError(sp.Type(), ErrInsufficientBuffer, "insufficient buffer size, expected %d, got %d", total+1, len(src))
 		}
 
 		// read qos
 		qos := QOS(src[total])
 		if !qos.Successful() {
-			return total, makeError(sp.Type(), "invalid QOS level (%d)", qos)
+			return total, wrapError(sp.Type(), ErrInvalidQOS, "invalid QOS level (%d)", qos)
 		}
 
 		// read qos and add subscription
@@ -133,7 +143,7 @@ func (sp *Subscribe) Encode(dst []byte) (int, error) {
 
 	// check packet id
 	if !sp.ID.Valid() {
-		return total, makeError(sp.Type(), "packet id must be grater than zero")
+		return total, wrapError(sp.Type(), ErrInvalidID, "packet id must be grater than zero")
 	}
 
 	// encode header
@@ -149,7 +159,7 @@ func (sp *Subscribe) Encode(dst []byte) (int, error) {
 
 	for _, t := range sp.Subscriptions {
 		// write topic
-		n, err := writeLPString(dst[total:], t.Topic, sp.Type())
+		n, err := writeUTF8String(dst[total:], t.Topic, "topic", sp.Type())
 		total += n
 		if err != nil {
 			return total, err
@@ -157,7 +167,7 @@ func (sp *Subscribe) Encode(dst []byte) (int, error) {
 
 		// check qos
 		if !t.QOS.Successful() {
-			return total, makeError(sp.Type(), "invalid QOS level (%d)", t.QOS)
+			return total, wrapError(sp.Type(), ErrInvalidQOS, "invalid QOS level (%d)", t.QOS)
 		}
 
 		// write qos
@@ -281,6 +281,8 @@ func TestSubscribeEqualDecodeEncode(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.Equal(t, len(pktBytes), n3)
+
+	assertRoundTrip(t, pkt)
 }
 
 func BenchmarkSubscribeEncode(b *testing.B) {
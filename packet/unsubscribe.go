@@ -46,10 +46,14 @@ func (up *Unsubscribe) Len() int {
 // Decode reads from the byte slice argument. It returns the total number of
 // bytes decoded, and whether there have been any errors during the process.
 func (up *Unsubscribe) Decode(src []byte) (int, error) {
+	return up.decode(src, nil)
+}
+
+func (up *Unsubscribe) decode(src []byte, v *validator) (int, error) {
 	total := 0
 
 	// decode header
-	hl, _, rl, err := headerDecode(src[total:], UNSUBSCRIBE)
+	hl, _, rl, err := headerDecode(src[total:], UNSUBSCRIBE, v)
 	total += hl
 	if err != nil {
 		return total, err
@@ -57,7 +61,7 @@ func (up *Unsubscribe) Decode(src []byte) (int, error) {
 
 	// check buffer length
 	if len(src) < total+2 {
-		return total, makeError(up.Type(), "insufficient buffer size, expected %d, got %d", total+2, len(src))
+		return total, wrapError(up.Type(), ErrInsufficientBuffer, "insufficient buffer size, expected %d, got %d", total+2, len(src))
 	}
 
 	// read packet id
@@ -66,7 +70,7 @@ func (up *Unsubscribe) Decode(src []byte) (int, error) {
 
 	// check packet id
 	if !up.ID.Valid() {
-		return total, makeError(up.Type(), "packet id must be grater than zero")
+		return total, wrapError(up.Type(), ErrInvalidID, "packet id must be grater than zero")
 	}
 
 	// prepare counter
@@ -83,6 +87,12 @@ func (up *Unsubscribe) Decode(src []byte) (int, error) {
 			return total, err
 		}
 
+		// check topic
+		err = v.checkUTF8(up.Type(), "topic", t)
+		if err != nil {
+			return total, err
+		}
+
 		// append to list
 		up.Topics = append(up.Topics, t)
 
@@ -106,7 +116,7 @@ func (up *Unsubscribe) Encode(dst []byte) (int, error) {
 
 	// check packet id
 	if !up.ID.Valid() {
-		return total, makeError(up.Type(), "packet id must be grater than zero")
+		return total, wrapError(up.Type(), ErrInvalidID, "packet id must be grater than zero")
 	}
 
 	// encode header
@@ -122,7 +132,7 @@ func (up *Unsubscribe) Encode(dst []byte) (int, error) {
 
 	for _, t := range up.Topics {
 		// write topic
-		n, err := writeLPString(dst[total:], t, up.Type())
+		n, err := writeUTF8String(dst[total:], t, "topic", up.Type())
 		total += n
 		if err != nil {
 			return total, err
@@ -220,6 +220,8 @@ func TestUnsubscribeEqualDecodeEncode(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.Equal(t, len(pktBytes), n3)
+
+	assertRoundTrip(t, pkt)
 }
 
 func BenchmarkUnsubscribeEncode(b *testing.B) {
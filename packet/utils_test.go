@@ -1,6 +1,9 @@
 package packet
 
-import "io"
+import (
+	"io"
+	"testing"
+)
 
 type errorWriter struct {
 	writer io.Writer
@@ -30,3 +33,13 @@ func (r *errorReader) Read(p []byte) (int, error) {
 	r.after--
 	return r.reader.Read(p)
 }
+
+// assertRoundTrip mirrors packettest.RoundTrip which cannot be imported here
+func assertRoundTrip(t *testing.T, pkt Generic) {
+	t.Helper()
+
+	err := CheckRoundTrip(pkt)
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,294 @@
+package packet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// A Vector is a known-good encoded packet together with its decoded fields.
+// The vectors can be exported as JSON to validate other implementations.
+type Vector struct {
+	// The name of the vector.
+	Name string
+
+	// The encoded packet.
+	Data []byte
+
+	// The decoded packet.
+	Packet Generic
+}
+
+type jsonVector struct {
+	Name   string          `json:"name"`
+	Data   string          `json:"data"`
+	Packet json.RawMessage `json:"packet"`
+}
+
+// MarshalJSON implements the json.Marshaler interface. The data is encoded as
+// a hex string and the packet using its JSON representation.
+func (v Vector) MarshalJSON() ([]byte, error) {
+	// marshal packet
+	pkt, err := json.Marshal(v.Packet)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(jsonVector{
+		Name:   v.Name,
+		Data:   hex.EncodeToString(v.Data),
+		Packet: pkt,
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (v *Vector) UnmarshalJSON(data []byte) error {
+	// unmarshal vector
+	var j jsonVector
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return err
+	}
+
+	// decode data
+	v.Data, err = hex.DecodeString(j.Data)
+	if err != nil {
+		return err
+	}
+
+	// parse packet
+	v.Packet, err = ParseJSON(j.Packet)
+	if err != nil {
+		return err
+	}
+
+	// set name
+	v.Name = j.Name
+
+	return nil
+}
+
+// Vectors returns the canonical test vectors that cover all packet types and
+// their variations. A new list is returned on every call.
+func Vectors() []Vector {
+	return []Vector{
+		{
+			Name: "connect/minimal",
+			Data: []byte{
+				0x10, 13,
+				0, 4, 'M', 'Q', 'T', 'T', 4, 0x02, 0, 60,
+				0, 1, 'c',
+			},
+			Packet: &Connect{
+				ClientID:     "c",
+				KeepAlive:    60,
+				CleanSession: true,
+				Version:      Version311,
+			},
+		},
+		{
+			Name: "connect/full",
+			Data: []byte{
+				0x10, 25,
+				0, 4, 'M', 'Q', 'T', 'T', 4, 0xec, 0, 30,
+				0, 1, 'c',
+				0, 1, 'w',
+				0, 1, 'x',
+				0, 1, 'u',
+				0, 1, 'p',
+			},
+			Packet: &Connect{
+				ClientID:  "c",
+				KeepAlive: 30,
+				Username:  "u",
+				Password:  "p",
+				Will: &Message{
+					Topic:   "w",
+					Payload: []byte("x"),
+					QOS:     QOSAtLeastOnce,
+					Retain:  true,
+				},
+				Version: Version311,
+			},
+		},
+		{
+			Name: "connect/v31",
+			Data: []byte{
+				0x10, 15,
+				0, 6, 'M', 'Q', 'I', 's', 'd', 'p', 3, 0x02, 0, 0,
+				0, 1, 'c',
+			},
+			Packet: &Connect{
+				ClientID:     "c",
+				CleanSession: true,
+				Version:      Version31,
+			},
+		},
+		{
+			Name: "connack/session-present",
+			Data: []byte{0x20, 2, 0x01, 0x00},
+			Packet: &Connack{
+				SessionPresent: true,
+				ReturnCode:     ConnectionAccepted,
+			},
+		},
+		{
+			Name: "connack/refused",
+			Data: []byte{0x20, 2, 0x00, 0x05},
+			Packet: &Connack{
+				ReturnCode: NotAuthorized,
+			},
+		},
+		{
+			Name: "publish/qos0",
+			Data: []byte{
+				0x30, 7,
+				0, 3, 'a', '/', 'b',
+				'h', 'i',
+			},
+			Packet: &Publish{
+				Message: Message{
+					Topic:   "a/b",
+					Payload: []byte("hi"),
+				},
+			},
+		},
+		{
+			Name: "publish/qos1-dup-retain",
+			Data: []byte{
+				0x3b, 6,
+				0, 1, 't', 0, 10,
+				'x',
+			},
+			Packet: &Publish{
+				ID:  10,
+				Dup: true,
+				Message: Message{
+					Topic:   "t",
+					Payload: []byte("x"),
+					QOS:     QOSAtLeastOnce,
+					Retain:  true,
+				},
+			},
+		},
+		{
+			Name: "publish/qos2-empty",
+			Data: []byte{
+				0x34, 5,
+				0, 1, 't', 0, 1,
+			},
+			Packet: &Publish{
+				ID: 1,
+				Message: Message{
+					Topic: "t",
+					QOS:   QOSExactlyOnce,
+				},
+			},
+		},
+		{
+			Name:   "puback",
+			Data:   []byte{0x40, 2, 0, 1},
+			Packet: &Puback{ID: 1},
+		},
+		{
+			Name:   "pubrec",
+			Data:   []byte{0x50, 2, 0, 2},
+			Packet: &Pubrec{ID: 2},
+		},
+		{
+			Name:   "pubrel",
+			Data:   []byte{0x62, 2, 0, 3},
+			Packet: &Pubrel{ID: 3},
+		},
+		{
+			Name:   "pubcomp",
+			Data:   []byte{0x70, 2, 0, 4},
+			Packet: &Pubcomp{ID: 4},
+		},
+		{
+			Name: "subscribe",
+			Data: []byte{
+				0x82, 12,
+				0, 1,
+				0, 3, 'a', '/', '#', 1,
+				0, 1, '+', 2,
+			},
+			Packet: &Subscribe{
+				ID: 1,
+				Subscriptions: []Subscription{
+					{Topic: "a/#", QOS: QOSAtLeastOnce},
+					{Topic: "+", QOS: QOSExactlyOnce},
+				},
+			},
+		},
+		{
+			Name: "suback",
+			Data: []byte{0x90, 5, 0, 1, 1, 2, 0x80},
+			Packet: &Suback{
+				ID:          1,
+				ReturnCodes: []QOS{QOSAtLeastOnce, QOSExactlyOnce, QOSFailure},
+			},
+		},
+		{
+			Name: "unsubscribe",
+			Data: []byte{
+				0xa2, 10,
+				0, 1,
+				0, 3, 'a', '/', '#',
+				0, 1, 'b',
+			},
+			Packet: &Unsubscribe{
+				ID:     1,
+				Topics: []string{"a/#", "b"},
+			},
+		},
+		{
+			Name:   "unsuback",
+			Data:   []byte{0xb0, 2, 0, 1},
+			Packet: &Unsuback{ID: 1},
+		},
+		{
+			Name:   "pingreq",
+			Data:   []byte{0xc0, 0},
+			Packet: &Pingreq{},
+		},
+		{
+			Name:   "pingresp",
+			Data:   []byte{0xd0, 0},
+			Packet: &Pingresp{},
+		},
+		{
+			Name:   "disconnect",
+			Data:   []byte{0xe0, 0},
+			Packet: &Disconnect{},
+		},
+	}
+}
+
+// VerifyVectors validates a packet implementation against the canonical test
+// vectors. The decode function must decode the data of a vector and the encode
+// function must encode the packet of a vector. Packets are compared using their
+// string representation. An error is returned for the first vector that does
+// not match.
+func VerifyVectors(decode func([]byte) (Generic, error), encode func(Generic) ([]byte, error)) error {
+	for _, v := range Vectors() {
+		// check decoding
+		pkt, err := decode(v.Data)
+		if err != nil {
+			return fmt.Errorf("%s: decode failed: %w", v.Name, err)
+		} else if pkt == nil || pkt.String() != v.Packet.String() {
+			return fmt.Errorf("%s: decoded %v, expected %s", v.Name, pkt, v.Packet.String())
+		}
+
+		// check encoding
+		data, err := encode(v.Packet)
+		if err != nil {
+			return fmt.Errorf("%s: encode failed: %w", v.Name, err)
+		} else if !bytes.Equal(data, v.Data) {
+			return fmt.Errorf("%s: encoded %x, expected %x", v.Name, data, v.Data)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package packet
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeVector(data []byte) (Generic, error) {
+	_, t := DetectPacket(data)
+
+	pkt, err := t.New()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = pkt.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return pkt, nil
+}
+
+func encodeVector(pkt Generic) ([]byte, error) {
+	data := make([]byte, pkt.Len())
+
+	_, err := pkt.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func TestVerifyVectors(t *testing.T) {
+	err := VerifyVectors(decodeVector, encodeVector)
+	assert.NoError(t, err)
+
+	err = VerifyVectors(decodeVector, func(Generic) ([]byte, error) {
+		return []byte{0x00}, nil
+	})
+	assert.EqualError(t, err, "connect/minimal: encoded 00, expected 100d00044d5154540402003c000163")
+}
+
+func TestVectorsJSON(t *testing.T) {
+	data, err := json.Marshal(Vectors()[0])
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"name": "connect/minimal",
+		"data": "100d00044d5154540402003c000163",
+		"packet": {
+			"type": "connect",
+			"client_id": "c",
+			"keep_alive": 60,
+			"username": "",
+			"password": "",
+			"clean_session": true,
+			"will": null,
+			"version": 4
+		}
+	}`, string(data))
+
+	data, err = json.Marshal(Vectors())
+	assert.NoError(t, err)
+
+	var vectors []Vector
+	err = json.Unmarshal(data, &vectors)
+	assert.NoError(t, err)
+	assert.Equal(t, Vectors(), vectors)
+}
@@ -0,0 +1,303 @@
+//go:build !gomqtt_lite
+// +build !gomqtt_lite
+
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// ErrInvalidCiphertext is returned by the AES cipher if a file cannot be
+// decrypted with the configured key.
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+// A Cipher encrypts the packets persisted by a FileSession. Publish packets
+// may carry confidential payloads (e.g. credentials sent by a device) that
+// should not be stored in cleartext on disk or flash.
+type Cipher interface {
+	// Encrypt returns the encrypted version of the passed data.
+	Encrypt(data []byte) ([]byte, error)
+
+	// Decrypt returns the data that has been encrypted using Encrypt.
+	Decrypt(data []byte) ([]byte, error)
+}
+
+type aesCipher struct {
+	aead cipher.AEAD
+}
+
+// NewAESCipher returns a Cipher that uses AES-GCM with the passed key. The key
+// must be 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256.
+func NewAESCipher(key []byte) (Cipher, error) {
+	// create block
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// create aead
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &aesCipher{aead: aead}, nil
+}
+
+func (c *aesCipher) Encrypt(data []byte) ([]byte, error) {
+	// generate nonce
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(data)+c.aead.Overhead())
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.aead.Seal(nonce, nonce, data, nil), nil
+}
+
+func (c *aesCipher) Decrypt(data []byte) ([]byte, error) {
+	// check length
+	if len(data) < c.aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+
+	// open data
+	nonce, data := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+
+	return plain, nil
+}
+
+// A FileSession stores packets in memory and persists them as files in a
+// directory. Unacknowledged packets thus survive restarts of the process and
+// are resent by a client that resumes the session after reconnecting.
+//
+// Note: A directory must only be used by a single session at a time.
+type FileSession struct {
+	dir    string
+	cipher Cipher
+	memory *MemorySession
+	mutex  sync.Mutex
+}
+
+// NewFileSession returns a new FileSession that uses the specified directory.
+// The directory is created if missing and packets that have been saved
+// previously are loaded.
+func NewFileSession(dir string) (*FileSession, error) {
+	return NewFileSessionWithCipher(dir, nil)
+}
+
+// NewFileSessionWithCipher returns a new FileSession like NewFileSession that
+// encrypts the files using the specified cipher. Packets that have been saved
+// previously must have been encrypted using the same cipher.
+func NewFileSessionWithCipher(dir string, c Cipher) (*FileSession, error) {
+	// prepare session
+	s := &FileSession{
+		dir:    dir,
+		cipher: c,
+		memory: NewMemorySession(),
+	}
+
+	// load packets
+	for _, dir := range []Direction{Incoming, Outgoing} {
+		err := s.load(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// continue counting after the highest outgoing id
+	var max packet.ID
+	for _, pkt := range s.memory.Outgoing.All() {
+		if id, ok := packet.GetID(pkt); ok && id > max {
+			max = id
+		}
+	}
+	s.memory.Counter = NewIDCounterWithNext(max + 1)
+
+	return s, nil
+}
+
+// NextID will return the next id for outgoing packets.
+func (s *FileSession) NextID() packet.ID {
+	return s.memory.NextID()
+}
+
+// SavePacket will store a packet in the session. An eventual existing
+// packet with the same id gets quietly overwritten.
+func (s *FileSession) SavePacket(dir Direction, pkt packet.Generic) error {
+	// get id
+	id, ok := packet.GetID(pkt)
+	if !ok {
+		return nil
+	}
+
+	// encode packet
+	buf := make([]byte, pkt.Len())
+	_, err := pkt.Encode(buf)
+	if err != nil {
+		return err
+	}
+
+	// encrypt packet
+	if s.cipher != nil {
+		buf, err = s.cipher.Encrypt(buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// write file atomically
+	path := s.path(dir, id)
+	err = ioutil.WriteFile(path+".tmp", buf, 0600)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(path+".tmp", path)
+	if err != nil {
+		return err
+	}
+
+	return s.memory.SavePacket(dir, pkt)
+}
+
+// LookupPacket will retrieve a packet from the session using a packet id.
+func (s *FileSession) LookupPacket(dir Direction, id packet.ID) (packet.Generic, error) {
+	return s.memory.LookupPacket(dir, id)
+}
+
+// DeletePacket will remove a packet from the session. The method must not
+// return an error if no packet with the specified id does exists.
+func (s *FileSession) DeletePacket(dir Direction, id packet.ID) error {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// remove file
+	err := os.Remove(s.path(dir, id))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return s.memory.DeletePacket(dir, id)
+}
+
+// AllPackets will return all packets currently saved in the session.
+func (s *FileSession) AllPackets(dir Direction) ([]packet.Generic, error) {
+	return s.memory.AllPackets(dir)
+}
+
+// Reset will completely reset the session.
+func (s *FileSession) Reset() error {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// remove files
+	for _, dir := range []Direction{Incoming, Outgoing} {
+		err := os.RemoveAll(s.directory(dir))
+		if err != nil {
+			return err
+		}
+
+		err = os.MkdirAll(s.directory(dir), 0700)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.memory.Reset()
+}
+
+func (s *FileSession) load(dir Direction) error {
+	// ensure directory
+	err := os.MkdirAll(s.directory(dir), 0700)
+	if err != nil {
+		return err
+	}
+
+	// read directory
+	files, err := ioutil.ReadDir(s.directory(dir))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		// skip unfinished writes and other files
+		if _, err := strconv.ParseUint(file.Name(), 10, 16); err != nil {
+			continue
+		}
+
+		// read file
+		path := filepath.Join(s.directory(dir), file.Name())
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		// decrypt packet
+		if s.cipher != nil {
+			buf, err = s.cipher.Decrypt(buf)
+			if err != nil {
+				return fmt.Errorf("invalid packet file %q: %w", path, err)
+			}
+		}
+
+		// detect packet
+		length, typ := packet.DetectPacket(buf)
+		if length != len(buf) {
+			return fmt.Errorf("invalid packet file %q", path)
+		}
+
+		// decode packet
+		pkt, err := typ.New()
+		if err != nil {
+			return err
+		}
+		_, err = pkt.Decode(buf)
+		if err != nil {
+			return err
+		}
+
+		// save packet
+		err = s.memory.SavePacket(dir, pkt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *FileSession) directory(dir Direction) string {
+	if dir == Incoming {
+		return filepath.Join(s.dir, "incoming")
+	} else if dir == Outgoing {
+		return filepath.Join(s.dir, "outgoing")
+	}
+
+	panic("unknown direction")
+}
+
+func (s *FileSession) path(dir Direction, id packet.ID) string {
+	return filepath.Join(s.directory(dir), strconv.Itoa(int(id)))
+}
@@ -0,0 +1,134 @@
+//go:build !gomqtt_lite
+// +build !gomqtt_lite
+
+package session
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomqtt")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	session, err := NewFileSession(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, packet.ID(1), session.NextID())
+
+	publish := packet.NewPublish()
+	publish.ID = 7
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("test")
+	publish.Message.QOS = 1
+
+	pubrel := packet.NewPubrel()
+	pubrel.ID = 3
+
+	pubrec := packet.NewPubrec()
+	pubrec.ID = 5
+
+	assert.NoError(t, session.SavePacket(Outgoing, publish))
+	assert.NoError(t, session.SavePacket(Outgoing, pubrel))
+	assert.NoError(t, session.SavePacket(Incoming, pubrec))
+
+	session, err = NewFileSession(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, packet.ID(8), session.NextID())
+
+	pkt, err := session.LookupPacket(Outgoing, 7)
+	assert.NoError(t, err)
+	assert.Equal(t, publish, pkt)
+
+	pkt, err = session.LookupPacket(Outgoing, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, pubrel, pkt)
+
+	all, err := session.AllPackets(Incoming)
+	assert.NoError(t, err)
+	assert.Equal(t, []packet.Generic{pubrec}, all)
+
+	assert.NoError(t, session.DeletePacket(Outgoing, 7))
+	assert.NoError(t, session.DeletePacket(Outgoing, 7))
+
+	session, err = NewFileSession(dir)
+	assert.NoError(t, err)
+
+	all, err = session.AllPackets(Outgoing)
+	assert.NoError(t, err)
+	assert.Equal(t, []packet.Generic{pubrel}, all)
+
+	assert.NoError(t, session.Reset())
+	assert.Equal(t, packet.ID(1), session.NextID())
+
+	session, err = NewFileSession(dir)
+	assert.NoError(t, err)
+
+	all, err = session.AllPackets(Outgoing)
+	assert.NoError(t, err)
+	assert.Empty(t, all)
+}
+
+func TestFileSessionInvalidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomqtt")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "outgoing"), 0700))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "outgoing", "1.tmp"), []byte{1}, 0600))
+
+	_, err = NewFileSession(dir)
+	assert.NoError(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "outgoing", "1"), []byte{0x62, 2, 0}, 0600))
+
+	_, err = NewFileSession(dir)
+	assert.Error(t, err)
+}
+
+func TestFileSessionCipher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomqtt")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cipher, err := NewAESCipher([]byte("0123456789abcdef"))
+	assert.NoError(t, err)
+
+	session, err := NewFileSessionWithCipher(dir, cipher)
+	assert.NoError(t, err)
+
+	publish := packet.NewPublish()
+	publish.ID = 1
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("secret")
+	publish.Message.QOS = 1
+
+	assert.NoError(t, session.SavePacket(Outgoing, publish))
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "outgoing", "1"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(buf), "secret")
+
+	session, err = NewFileSessionWithCipher(dir, cipher)
+	assert.NoError(t, err)
+
+	all, err := session.AllPackets(Outgoing)
+	assert.NoError(t, err)
+	assert.Equal(t, []packet.Generic{publish}, all)
+
+	other, err := NewAESCipher([]byte("fedcba9876543210"))
+	assert.NoError(t, err)
+
+	_, err = NewFileSessionWithCipher(dir, other)
+	assert.Error(t, err)
+
+	_, err = NewAESCipher([]byte("short"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,94 @@
+package session
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrQuotaTimeout is returned by Acquire if no token became available before
+// the timeout.
+var ErrQuotaTimeout = errors.New("quota timeout")
+
+// ErrQuotaCanceled is returned by Acquire if the cancel channel has been
+// closed while waiting for a token.
+var ErrQuotaCanceled = errors.New("quota canceled")
+
+// A Quota limits the number of unacknowledged QOS 1 and 2 messages that are
+// in flight at the same time. A token is acquired before a message is sent
+// and released once the message flow has been completed. It is used by
+// clients and brokers to respect the number of messages a peer is willing to
+// receive at once.
+type Quota struct {
+	tokens chan struct{}
+}
+
+// NewQuota returns a new quota with the specified number of tokens.
+func NewQuota(size int) *Quota {
+	// prepare tokens
+	tokens := make(chan struct{}, size)
+	for i := 0; i < size; i++ {
+		tokens <- struct{}{}
+	}
+
+	return &Quota{
+		tokens: tokens,
+	}
+}
+
+// Acquire will acquire a token. It will block until a token becomes available,
+// the optional timeout is reached or the cancel channel is closed.
+func (q *Quota) Acquire(cancel <-chan struct{}, timeout time.Duration) error {
+	// try fast path first
+	select {
+	case <-q.tokens:
+		return nil
+	default:
+	}
+
+	// prepare timeout
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-q.tokens:
+		return nil
+	case <-expired:
+		return ErrQuotaTimeout
+	case <-cancel:
+		return ErrQuotaCanceled
+	}
+}
+
+// TryAcquire will acquire a token if one is available without blocking.
+func (q *Quota) TryAcquire() bool {
+	select {
+	case <-q.tokens:
+		return true
+	default:
+		return false
+	}
+}
+
+// Release will return a token. Tokens that exceed the size of the quota are
+// ignored.
+func (q *Quota) Release() {
+	select {
+	case q.tokens <- struct{}{}:
+	default:
+		// continue if full for some reason
+	}
+}
+
+// Available returns the number of available tokens.
+func (q *Quota) Available() int {
+	return len(q.tokens)
+}
+
+// Size returns the total number of tokens.
+func (q *Quota) Size() int {
+	return cap(q.tokens)
+}
@@ -0,0 +1,37 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuota(t *testing.T) {
+	quota := NewQuota(2)
+	assert.Equal(t, 2, quota.Size())
+	assert.Equal(t, 2, quota.Available())
+
+	assert.NoError(t, quota.Acquire(nil, 0))
+	assert.True(t, quota.TryAcquire())
+	assert.False(t, quota.TryAcquire())
+	assert.Equal(t, 0, quota.Available())
+
+	assert.Equal(t, ErrQuotaTimeout, quota.Acquire(nil, time.Millisecond))
+
+	cancel := make(chan struct{})
+	close(cancel)
+	assert.Equal(t, ErrQuotaCanceled, quota.Acquire(cancel, 0))
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		quota.Release()
+	}()
+
+	assert.NoError(t, quota.Acquire(nil, time.Second))
+
+	quota.Release()
+	quota.Release()
+	quota.Release()
+	assert.Equal(t, 2, quota.Available())
+}
@@ -1,6 +1,7 @@
 package spec
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -14,13 +15,13 @@ import (
 func AuthenticationTest(t *testing.T, config *Config) {
 	deniedClient := client.New()
 	deniedClient.Callback = func(msg *packet.Message, err error) error {
-		assert.Equal(t, client.ErrClientConnectionDenied, err)
+		assert.True(t, errors.Is(err, client.ErrClientConnectionDenied))
 		return nil
 	}
 
 	cf, err := deniedClient.Connect(client.NewConfig(config.DenyURL))
 	assert.NoError(t, err)
-	assert.Error(t, cf.Wait(10*time.Second))
+	assert.Error(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.NotAuthorized, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
@@ -28,7 +29,7 @@ func AuthenticationTest(t *testing.T, config *Config) {
 
 	cf, err = allowedClient.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
@@ -43,7 +44,7 @@ func UniqueClientIDUncleanTest(t *testing.T, config *Config) {
 	options := client.NewConfigWithClientID(config.URL, id)
 	options.CleanSession = false
 
-	assert.NoError(t, client.ClearSession(options, 10*time.Second))
+	assert.NoError(t, client.ClearSession(options, config.timeout()))
 
 	wait := make(chan struct{})
 
@@ -55,7 +56,7 @@ func UniqueClientIDUncleanTest(t *testing.T, config *Config) {
 
 	cf, err := firstClient.Connect(options)
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
@@ -63,11 +64,11 @@ func UniqueClientIDUncleanTest(t *testing.T, config *Config) {
 
 	cf, err = secondClient.Connect(options)
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.True(t, cf.SessionPresent())
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	err = secondClient.Disconnect()
 	assert.NoError(t, err)
@@ -90,7 +91,7 @@ func UniqueClientIDCleanTest(t *testing.T, config *Config) {
 
 	cf, err := firstClient.Connect(options)
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
@@ -98,11 +99,11 @@ func UniqueClientIDCleanTest(t *testing.T, config *Config) {
 
 	cf, err = secondClient.Connect(options)
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	err = secondClient.Disconnect()
 	assert.NoError(t, err)
@@ -127,25 +128,25 @@ func RootSlashDistinctionTest(t *testing.T, config *Config, topic string) {
 
 	cf, err := c.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := c.Subscribe("/"+topic, 0)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0}, sf.ReturnCodes())
 
 	sf, err = c.Subscribe(topic, 0)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0}, sf.ReturnCodes())
 
 	pf, err := c.Publish(topic, testPayload, 0, false)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	time.Sleep(config.NoMessageWait)
 
@@ -32,20 +32,20 @@ func PublishSubscribeTest(t *testing.T, config *Config, pub, sub string, subQOS,
 
 	cf, err := c.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := c.Subscribe(sub, subQOS)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{subQOS}, sf.ReturnCodes())
 
 	pf, err := c.Publish(pub, testPayload, pubQOS, false)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	time.Sleep(config.NoMessageWait)
 
@@ -71,33 +71,33 @@ func UnsubscribeTest(t *testing.T, config *Config, topic string, qos packet.QOS)
 
 	cf, err := c.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := c.Subscribe(topic+"/1", qos)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{qos}, sf.ReturnCodes())
 
 	sf, err = c.Subscribe(topic+"/2", qos)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{qos}, sf.ReturnCodes())
 
 	uf, err := c.Unsubscribe(topic + "/1")
 	assert.NoError(t, err)
-	assert.NoError(t, uf.Wait(10*time.Second))
+	assert.NoError(t, uf.Wait(config.timeout()))
 
 	pf, err := c.Publish(topic+"/1", testPayload, qos, false)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
 	pf, err = c.Publish(topic+"/2", testPayload, qos, false)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	time.Sleep(config.NoMessageWait)
 
@@ -117,13 +117,13 @@ func UnsubscribeNotExistingSubscriptionTest(t *testing.T, config *Config, topic
 
 	cf, err := c.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	uf, err := c.Unsubscribe(topic)
 	assert.NoError(t, err)
-	assert.NoError(t, uf.Wait(10*time.Second))
+	assert.NoError(t, uf.Wait(config.timeout()))
 
 	time.Sleep(config.NoMessageWait)
 
@@ -150,29 +150,29 @@ func UnsubscribeOverlappingSubscriptions(t *testing.T, config *Config, topic str
 
 	cf, err := c.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := c.Subscribe(topic+"/#", 0)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0}, sf.ReturnCodes())
 
 	sf, err = c.Subscribe(topic+"/+", 0)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0}, sf.ReturnCodes())
 
 	uf, err := c.Unsubscribe(topic + "/#")
 	assert.NoError(t, err)
-	assert.NoError(t, uf.Wait(10*time.Second))
+	assert.NoError(t, uf.Wait(config.timeout()))
 
 	pf, err := c.Publish(topic+"/foo", testPayload, 0, false)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	time.Sleep(config.NoMessageWait)
 
@@ -180,6 +180,121 @@ func UnsubscribeOverlappingSubscriptions(t *testing.T, config *Config, topic str
 	assert.NoError(t, err)
 }
 
+// UnsubscribeMultipleTest tests the broker for unsubscribing multiple topics,
+// including not existing ones, with a single Unsubscribe packet.
+func UnsubscribeMultipleTest(t *testing.T, config *Config, topic string) {
+	c := client.New()
+	wait := make(chan struct{})
+
+	c.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		assert.Equal(t, topic+"/3", msg.Topic)
+		assert.Equal(t, testPayload, msg.Payload)
+		assert.Equal(t, packet.QOS(0), msg.QOS)
+		assert.False(t, msg.Retain)
+
+		close(wait)
+		return nil
+	}
+
+	cf, err := c.Connect(client.NewConfig(config.URL))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(config.timeout()))
+	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
+	assert.False(t, cf.SessionPresent())
+
+	sf, err := c.SubscribeMultiple([]packet.Subscription{
+		{Topic: topic + "/1"},
+		{Topic: topic + "/2"},
+		{Topic: topic + "/3"},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(config.timeout()))
+	assert.Equal(t, []packet.QOS{0, 0, 0}, sf.ReturnCodes())
+
+	uf, err := c.UnsubscribeMultiple([]string{topic + "/1", topic + "/2", topic + "/4"})
+	assert.NoError(t, err)
+	assert.NoError(t, uf.Wait(config.timeout()))
+
+	for _, suffix := range []string{"/1", "/2", "/4", "/3"} {
+		pf, err := c.Publish(topic+suffix, testPayload, 0, false)
+		assert.NoError(t, err)
+		assert.NoError(t, pf.Wait(config.timeout()))
+	}
+
+	config.safeReceive(wait)
+
+	time.Sleep(config.NoMessageWait)
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+}
+
+// UnsubscribeStopsDeliveryTest tests the broker for not delivering messages
+// published by other clients after a subscription has been removed.
+func UnsubscribeStopsDeliveryTest(t *testing.T, config *Config, topic string, qos packet.QOS) {
+	subscriber := client.New()
+	wait := make(chan struct{})
+
+	received := 0
+	subscriber.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		assert.Equal(t, topic, msg.Topic)
+		assert.Equal(t, testPayload, msg.Payload)
+
+		received++
+		assert.Equal(t, 1, received)
+
+		close(wait)
+		return nil
+	}
+
+	cf, err := subscriber.Connect(client.NewConfig(config.URL))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(config.timeout()))
+	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
+
+	sf, err := subscriber.Subscribe(topic, qos)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(config.timeout()))
+	assert.Equal(t, []packet.QOS{qos}, sf.ReturnCodes())
+
+	publisher := client.New()
+	publisher.Callback = func(msg *packet.Message, err error) error {
+		assert.Fail(t, "should not be called")
+		return nil
+	}
+
+	cf, err = publisher.Connect(client.NewConfig(config.URL))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(config.timeout()))
+	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
+
+	pf, err := publisher.Publish(topic, testPayload, qos, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(config.timeout()))
+
+	config.safeReceive(wait)
+
+	uf, err := subscriber.Unsubscribe(topic)
+	assert.NoError(t, err)
+	assert.NoError(t, uf.Wait(config.timeout()))
+
+	for i := 0; i < 3; i++ {
+		pf, err = publisher.Publish(topic, testPayload, qos, false)
+		assert.NoError(t, err)
+		assert.NoError(t, pf.Wait(config.timeout()))
+	}
+
+	time.Sleep(config.NoMessageWait)
+
+	err = publisher.Disconnect()
+	assert.NoError(t, err)
+
+	err = subscriber.Disconnect()
+	assert.NoError(t, err)
+}
+
 // SubscriptionUpgradeTest tests the broker for properly upgrading subscriptions,
 func SubscriptionUpgradeTest(t *testing.T, config *Config, topic string, from, to packet.QOS) {
 	c := client.New()
@@ -198,25 +313,25 @@ func SubscriptionUpgradeTest(t *testing.T, config *Config, topic string, from, t
 
 	cf, err := c.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := c.Subscribe(topic, from)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{from}, sf.ReturnCodes())
 
 	sf, err = c.Subscribe(topic, to)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{to}, sf.ReturnCodes())
 
 	pf, err := c.Publish(topic, testPayload, to, false)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	err = c.Disconnect()
 	assert.NoError(t, err)
@@ -235,31 +350,39 @@ func OverlappingSubscriptionsTest(t *testing.T, config *Config, pub, sub string)
 		assert.Equal(t, packet.QOS(0), msg.QOS)
 		assert.False(t, msg.Retain)
 
+		// check duplicate
+		select {
+		case <-wait:
+			assert.True(t, config.OverlappingDuplicates, "received duplicate message")
+			return nil
+		default:
+		}
+
 		close(wait)
 		return nil
 	}
 
 	cf, err := c.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := c.Subscribe(sub, 0)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0}, sf.ReturnCodes())
 
 	sf, err = c.Subscribe(pub, 0)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0}, sf.ReturnCodes())
 
 	pf, err := c.Publish(pub, testPayload, 0, false)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	time.Sleep(config.NoMessageWait)
 
@@ -286,7 +409,7 @@ func MultipleSubscriptionTest(t *testing.T, config *Config, topic string) {
 
 	cf, err := c.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
@@ -298,14 +421,14 @@ func MultipleSubscriptionTest(t *testing.T, config *Config, topic string) {
 
 	sf, err := c.SubscribeMultiple(subs)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0, 1, 2}, sf.ReturnCodes())
 
 	pf, err := c.Publish(topic+"/3", testPayload, 2, false)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	time.Sleep(config.NoMessageWait)
 
@@ -332,7 +455,7 @@ func DuplicateSubscriptionTest(t *testing.T, config *Config, topic string) {
 
 	cf, err := c.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
@@ -343,14 +466,14 @@ func DuplicateSubscriptionTest(t *testing.T, config *Config, topic string) {
 
 	sf, err := c.SubscribeMultiple(subs)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0, 1}, sf.ReturnCodes())
 
 	pf, err := c.Publish(topic, testPayload, 1, false)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	time.Sleep(config.NoMessageWait)
 
@@ -376,32 +499,32 @@ func IsolatedSubscriptionTest(t *testing.T, config *Config, topic string) {
 
 	cf, err := c.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := c.Subscribe(topic+"/foo", 0)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0}, sf.ReturnCodes())
 
 	pf, err := c.Publish(topic, testPayload, 0, false)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
 	pf, err = c.Publish(topic+"/bar", testPayload, 0, false)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
 	pf, err = c.Publish(topic+"/baz", testPayload, 0, false)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
 	pf, err = c.Publish(topic+"/foo", testPayload, 0, false)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	time.Sleep(config.NoMessageWait)
 
@@ -422,7 +545,7 @@ func WillTest(t *testing.T, config *Config, topic string, sub, pub packet.QOS) {
 
 	cf, err := clientWithWill.Connect(opts)
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
@@ -442,19 +565,19 @@ func WillTest(t *testing.T, config *Config, topic string, sub, pub packet.QOS) {
 
 	cf, err = clientReceivingWill.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := clientReceivingWill.Subscribe(topic, sub)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{sub}, sf.ReturnCodes())
 
 	err = clientWithWill.Close()
 	assert.NoError(t, err)
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	time.Sleep(config.NoMessageWait)
 
@@ -476,7 +599,7 @@ func CleanWillTest(t *testing.T, config *Config, topic string) {
 
 	cf, err := clientWithWill.Connect(opts)
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
@@ -489,13 +612,13 @@ func CleanWillTest(t *testing.T, config *Config, topic string) {
 
 	cf, err = nonReceiver.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := nonReceiver.Subscribe(topic, 0)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0}, sf.ReturnCodes())
 
 	err = clientWithWill.Disconnect()
@@ -527,7 +650,7 @@ func KeepAliveTest(t *testing.T, config *Config) {
 
 	cf, err := c.Connect(opts)
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
@@ -0,0 +1,211 @@
+package spec
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+	"github.com/256dpi/gomqtt/transport/flow"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// the number of messages sent by the rollover test, which exceeds the number
+// of available packet ids in both directions
+const rolloverMessages = 1<<16 + 100
+
+// the number of unacknowledged messages sent by the rollover test
+const rolloverWindow = 100
+
+// PacketIDReuseTest tests the broker for properly handling packet ids that are
+// reused after the previous flow with the same id has been completed.
+func PacketIDReuseTest(t *testing.T, config *Config, topic string) {
+	username, password := config.usernamePassword()
+
+	received := make(chan string, 4)
+
+	c := client.New()
+	c.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		received <- string(msg.Payload)
+		return nil
+	}
+
+	cf, err := c.Connect(client.NewConfig(config.URL))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(config.timeout()))
+
+	sf, err := c.Subscribe(topic, 2)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(config.timeout()))
+
+	connect := packet.NewConnect()
+	connect.Username = username
+	connect.Password = password
+
+	publish := func(payload string, qos packet.QOS) *packet.Publish {
+		publish := packet.NewPublish()
+		publish.ID = 1
+		publish.Message.Topic = topic
+		publish.Message.Payload = []byte(payload)
+		publish.Message.QOS = qos
+		return publish
+	}
+
+	conn, err := transport.Dial(config.URL)
+	assert.NoError(t, err)
+	assert.NotNil(t, conn)
+
+	err = flow.New().
+		Send(connect).
+		Skip(&packet.Connack{}).
+		Send(publish("1", 1)).
+		Receive(&packet.Puback{ID: 1}).
+		Send(publish("2", 1)).
+		Receive(&packet.Puback{ID: 1}).
+		Send(publish("3", 2)).
+		Receive(&packet.Pubrec{ID: 1}).
+		Send(&packet.Pubrel{ID: 1}).
+		Receive(&packet.Pubcomp{ID: 1}).
+		Send(publish("4", 2)).
+		Receive(&packet.Pubrec{ID: 1}).
+		Send(&packet.Pubrel{ID: 1}).
+		Receive(&packet.Pubcomp{ID: 1}).
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	for _, payload := range []string{"1", "2", "3", "4"} {
+		select {
+		case p := <-received:
+			assert.Equal(t, payload, p)
+		case <-time.After(config.timeout()):
+			assert.Fail(t, "message not received", payload)
+			return
+		}
+	}
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+}
+
+// PacketIDRolloverTest tests the broker for properly handling packet id
+// rollover by sending more than 65535 QOS1 messages through a connection that
+// is subscribed to the topic. It asserts that acknowledgments are not
+// conflated across reused ids and that all messages are delivered in order.
+func PacketIDRolloverTest(t *testing.T, config *Config, topic string) {
+	if testing.Short() {
+		t.Skip("skipped in short mode")
+	}
+
+	username, password := config.usernamePassword()
+
+	connect := packet.NewConnect()
+	connect.Username = username
+	connect.Password = password
+
+	subscribe := packet.NewSubscribe()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{
+		{Topic: topic, QOS: 1},
+	}
+
+	conn, err := transport.Dial(config.URL)
+	assert.NoError(t, err)
+	assert.NotNil(t, conn)
+
+	err = flow.New().
+		Send(connect).
+		Skip(&packet.Connack{}).
+		Send(subscribe).
+		Receive(&packet.Suback{ID: 1, ReturnCodes: []packet.QOS{1}}).
+		Test(conn)
+	assert.NoError(t, err)
+	if err != nil {
+		return
+	}
+
+	conn.SetReadTimeout(config.timeout())
+
+	err = rollover(conn, topic)
+	assert.NoError(t, err)
+
+	err = flow.New().
+		Send(packet.NewDisconnect()).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+}
+
+func rollover(conn transport.Conn, topic string) error {
+	// prepare state
+	var sent, acked, received int
+	var nextID packet.ID = 1
+	inflight := make(map[packet.ID]bool)
+
+	for acked < rolloverMessages || received < rolloverMessages {
+		// fill window
+		for sent < rolloverMessages && len(inflight) < rolloverWindow {
+			publish := packet.NewPublish()
+			publish.ID = nextID
+			publish.Message.Topic = topic
+			publish.Message.Payload = []byte(strconv.Itoa(sent))
+			publish.Message.QOS = 1
+
+			err := conn.Send(publish, false)
+			if err != nil {
+				return err
+			}
+
+			inflight[nextID] = true
+			sent++
+
+			// advance id
+			nextID++
+			if nextID == 0 {
+				nextID = 1
+			}
+		}
+
+		// receive packet
+		pkt, err := conn.Receive()
+		if err != nil {
+			return fmt.Errorf("failed after %d sent, %d acked and %d received messages: %v", sent, acked, received, err)
+		}
+
+		switch pkt := pkt.(type) {
+		case *packet.Puback:
+			// check id
+			if !inflight[pkt.ID] {
+				return fmt.Errorf("unexpected puback with id %d after %d acked messages", pkt.ID, acked)
+			}
+
+			delete(inflight, pkt.ID)
+			acked++
+		case *packet.Publish:
+			// check message
+			if !pkt.ID.Valid() || pkt.Message.QOS != 1 {
+				return fmt.Errorf("invalid publish %s after %d received messages", pkt.String(), received)
+			} else if string(pkt.Message.Payload) != strconv.Itoa(received) {
+				return fmt.Errorf("expected message %d but got %q", received, pkt.Message.Payload)
+			}
+
+			received++
+
+			// acknowledge message
+			err = conn.Send(&packet.Puback{ID: pkt.ID}, false)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected packet %s", pkt.String())
+		}
+	}
+
+	return nil
+}
@@ -18,19 +18,19 @@ func OfflineSubscriptionTest(t *testing.T, config *Config, topic string, sub, pu
 	options := client.NewConfigWithClientID(config.URL, id)
 	options.CleanSession = false
 
-	assert.NoError(t, client.ClearSession(options, 10*time.Second))
+	assert.NoError(t, client.ClearSession(options, config.timeout()))
 
 	offlineSubscriber := client.New()
 
 	cf, err := offlineSubscriber.Connect(options)
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := offlineSubscriber.Subscribe(topic, sub)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{sub}, sf.ReturnCodes())
 
 	err = offlineSubscriber.Disconnect()
@@ -40,13 +40,13 @@ func OfflineSubscriptionTest(t *testing.T, config *Config, topic string, sub, pu
 
 	cf, err = publisher.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	pf, err := publisher.Publish(topic, testPayload, pub, false)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
 	err = publisher.Disconnect()
 	assert.NoError(t, err)
@@ -67,12 +67,12 @@ func OfflineSubscriptionTest(t *testing.T, config *Config, topic string, sub, pu
 
 	cf, err = offlineReceiver.Connect(options)
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.True(t, cf.SessionPresent())
 
 	if await {
-		safeReceive(wait)
+		config.safeReceive(wait)
 	}
 
 	time.Sleep(config.NoMessageWait)
@@ -89,8 +89,8 @@ func OfflineSubscriptionRetainedTest(t *testing.T, config *Config, topic string,
 	options := client.NewConfigWithClientID(config.URL, id)
 	options.CleanSession = false
 
-	assert.NoError(t, client.ClearRetainedMessage(options, topic, 10*time.Second))
-	assert.NoError(t, client.ClearSession(options, 10*time.Second))
+	assert.NoError(t, client.ClearRetainedMessage(options, topic, config.timeout()))
+	assert.NoError(t, client.ClearSession(options, config.timeout()))
 
 	time.Sleep(config.MessageRetainWait)
 
@@ -98,13 +98,13 @@ func OfflineSubscriptionRetainedTest(t *testing.T, config *Config, topic string,
 
 	cf, err := offlineSubscriber.Connect(options)
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := offlineSubscriber.Subscribe(topic, sub)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{sub}, sf.ReturnCodes())
 
 	err = offlineSubscriber.Disconnect()
@@ -114,13 +114,13 @@ func OfflineSubscriptionRetainedTest(t *testing.T, config *Config, topic string,
 
 	cf, err = publisher.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	pf, err := publisher.Publish(topic, testPayload, pub, true)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
 	time.Sleep(config.MessageRetainWait)
 
@@ -144,12 +144,12 @@ func OfflineSubscriptionRetainedTest(t *testing.T, config *Config, topic string,
 
 	cf, err = offlineReceiver.Connect(options)
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.True(t, cf.SessionPresent())
 
 	if await {
-		safeReceive(wait)
+		config.safeReceive(wait)
 	}
 
 	time.Sleep(config.NoMessageWait)
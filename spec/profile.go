@@ -0,0 +1,81 @@
+package spec
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrUnknownProfile is returned by ProfileConfig if the profile does not exist.
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// The available broker profiles.
+const (
+	Mosquitto = "mosquitto"
+	EMQX      = "emqx"
+	HiveMQ    = "hivemq"
+	VerneMQ   = "vernemq"
+)
+
+var profiles = map[string]func(*Config){
+	Mosquitto: func(c *Config) {
+		c.Authentication = false
+		c.ProcessWait = 10 * time.Millisecond
+		c.MessageRetainWait = 100 * time.Millisecond
+		c.NoMessageWait = 50 * time.Millisecond
+	},
+	EMQX: func(c *Config) {
+		c.Authentication = false
+		c.OverlappingDuplicates = true
+		c.ProcessWait = 50 * time.Millisecond
+		c.MessageRetainWait = 250 * time.Millisecond
+		c.NoMessageWait = 100 * time.Millisecond
+	},
+	HiveMQ: func(c *Config) {
+		c.Authentication = false
+		c.ProcessWait = 50 * time.Millisecond
+		c.MessageRetainWait = 250 * time.Millisecond
+		c.NoMessageWait = 100 * time.Millisecond
+	},
+	VerneMQ: func(c *Config) {
+		c.Authentication = false
+		c.OverlappingDuplicates = true
+		c.ProcessWait = 50 * time.Millisecond
+		c.MessageRetainWait = 200 * time.Millisecond
+		c.NoMessageWait = 100 * time.Millisecond
+	},
+}
+
+// Profiles returns the names of all available broker profiles.
+func Profiles() []string {
+	// collect names
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+
+	// sort names
+	sort.Strings(names)
+
+	return names
+}
+
+// ProfileConfig returns a config with all features enabled that has been
+// adjusted to the quirks of the named broker in its default configuration.
+// The URL must still be set before running the tests.
+//
+// Note: Authentication is disabled for all profiles as the brokers allow
+// anonymous clients by default.
+func ProfileConfig(name string) (*Config, error) {
+	// get profile
+	profile, ok := profiles[name]
+	if !ok {
+		return nil, ErrUnknownProfile
+	}
+
+	// prepare config
+	config := AllFeatures()
+	profile(config)
+
+	return config, nil
+}
@@ -0,0 +1,46 @@
+package spec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileConfig(t *testing.T) {
+	assert.Equal(t, []string{EMQX, HiveMQ, Mosquitto, VerneMQ}, Profiles())
+
+	for _, name := range Profiles() {
+		config, err := ProfileConfig(name)
+		assert.NoError(t, err)
+		assert.True(t, config.RetainedMessages)
+		assert.False(t, config.Authentication)
+		assert.NotZero(t, config.MessageRetainWait)
+	}
+
+	config, err := ProfileConfig("foo")
+	assert.Equal(t, ErrUnknownProfile, err)
+	assert.Nil(t, config)
+}
+
+func TestConfigTimeout(t *testing.T) {
+	config := AllFeatures()
+	assert.Equal(t, 10*time.Second, config.timeout())
+
+	config.Timeout = time.Second
+	assert.Equal(t, time.Second, config.timeout())
+
+	config.Timeouts = map[string]time.Duration{
+		"Foo": time.Minute,
+	}
+
+	config.run(t, "Foo", func(t *testing.T) {
+		assert.Equal(t, time.Minute, config.timeout())
+	})
+
+	config.run(t, "Bar", func(t *testing.T) {
+		assert.Equal(t, time.Second, config.timeout())
+	})
+
+	assert.Equal(t, time.Second, config.timeout())
+}
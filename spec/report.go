@@ -0,0 +1,185 @@
+package spec
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A Result describes the outcome of a single test.
+type Result struct {
+	// The name of the test.
+	Name string
+
+	// Whether the test failed or has been skipped.
+	Failed  bool
+	Skipped bool
+
+	// The time it took to run the test.
+	Duration time.Duration
+}
+
+// A Report collects the results of the tests executed by Run. It can be set on
+// the Config to publish conformance results without parsing the output of
+// "go test".
+type Report struct {
+	results []Result
+	mutex   sync.Mutex
+}
+
+// Results returns the collected results in the order the tests finished.
+func (r *Report) Results() []Result {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]Result(nil), r.results...)
+}
+
+// Failed returns whether at least one test failed.
+func (r *Report) Failed() bool {
+	for _, result := range r.Results() {
+		if result.Failed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WriteJSON will write the results as a JSON array of objects with the
+// "name", "status" and "duration" (in seconds) keys. The status is either
+// "pass", "fail" or "skip".
+func (r *Report) WriteJSON(w io.Writer) error {
+	// prepare entries
+	type entry struct {
+		Name     string  `json:"name"`
+		Status   string  `json:"status"`
+		Duration float64 `json:"duration"`
+	}
+	results := r.Results()
+	entries := make([]entry, 0, len(results))
+	for _, result := range results {
+		entries = append(entries, entry{
+			Name:     result.Name,
+			Status:   result.status(),
+			Duration: result.Duration.Seconds(),
+		})
+	}
+
+	// encode entries
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(entries)
+}
+
+// WriteJUnit will write the results as a JUnit XML test suite with the
+// specified name.
+func (r *Report) WriteJUnit(w io.Writer, name string) error {
+	// prepare suite
+	type failure struct {
+		Message string `xml:"message,attr"`
+	}
+	type testCase struct {
+		Name    string    `xml:"name,attr"`
+		Time    float64   `xml:"time,attr"`
+		Failure *failure  `xml:"failure,omitempty"`
+		Skipped *struct{} `xml:"skipped,omitempty"`
+	}
+	type testSuite struct {
+		XMLName  xml.Name   `xml:"testsuite"`
+		Name     string     `xml:"name,attr"`
+		Tests    int        `xml:"tests,attr"`
+		Failures int        `xml:"failures,attr"`
+		Skipped  int        `xml:"skipped,attr"`
+		Time     float64    `xml:"time,attr"`
+		Cases    []testCase `xml:"testcase"`
+	}
+	suite := testSuite{Name: name}
+
+	// add results
+	for _, result := range r.Results() {
+		tc := testCase{
+			Name: result.Name,
+			Time: result.Duration.Seconds(),
+		}
+		if result.Failed {
+			tc.Failure = &failure{Message: "test failed"}
+			suite.Failures++
+		} else if result.Skipped {
+			tc.Skipped = &struct{}{}
+			suite.Skipped++
+		}
+
+		suite.Tests++
+		suite.Time += tc.Time
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	// write header
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	// encode suite
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(suite)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+
+	return err
+}
+
+func (r *Report) add(result Result) {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.results = append(r.results, result)
+}
+
+func (r Result) status() string {
+	if r.Failed {
+		return "fail"
+	} else if r.Skipped {
+		return "skip"
+	}
+
+	return "pass"
+}
+
+// run will run the test as a subtest and record its result if a report is
+// configured
+func (c *Config) run(t *testing.T, name string, fn func(t *testing.T)) {
+	t.Run(name, func(t *testing.T) {
+		// set current test
+		c.current = name
+		defer func() {
+			c.current = ""
+		}()
+
+		// record result
+		if c.Report != nil {
+			start := time.Now()
+			defer func() {
+				c.Report.add(Result{
+					Name:     name,
+					Failed:   t.Failed(),
+					Skipped:  t.Skipped(),
+					Duration: time.Since(start),
+				})
+			}()
+		}
+
+		fn(t)
+	})
+}
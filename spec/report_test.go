@@ -0,0 +1,71 @@
+package spec
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReport(t *testing.T) {
+	config := &Config{Report: &Report{}}
+
+	config.run(t, "Pass", func(t *testing.T) {})
+	config.run(t, "Skip", func(t *testing.T) {
+		t.Skip()
+	})
+
+	config.Report.add(Result{Name: "Fail", Failed: true, Duration: time.Second})
+
+	results := config.Report.Results()
+	assert.Len(t, results, 3)
+	assert.Equal(t, "Pass", results[0].Name)
+	assert.False(t, results[0].Failed)
+	assert.False(t, results[0].Skipped)
+	assert.Equal(t, "Skip", results[1].Name)
+	assert.True(t, results[1].Skipped)
+	assert.True(t, config.Report.Failed())
+
+	// normalize durations
+	for i := range config.Report.results {
+		config.Report.results[i].Duration = time.Second
+	}
+
+	var buf bytes.Buffer
+	err := config.Report.WriteJSON(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, `[
+  {
+    "name": "Pass",
+    "status": "pass",
+    "duration": 1
+  },
+  {
+    "name": "Skip",
+    "status": "skip",
+    "duration": 1
+  },
+  {
+    "name": "Fail",
+    "status": "fail",
+    "duration": 1
+  }
+]
+`, buf.String())
+
+	buf.Reset()
+	err = config.Report.WriteJUnit(&buf, "broker")
+	assert.NoError(t, err)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<testsuite name="broker" tests="3" failures="1" skipped="1" time="3">
+  <testcase name="Pass" time="1"></testcase>
+  <testcase name="Skip" time="1">
+    <skipped></skipped>
+  </testcase>
+  <testcase name="Fail" time="1">
+    <failure message="test failed"></failure>
+  </testcase>
+</testsuite>
+`, buf.String())
+}
@@ -12,7 +12,7 @@ import (
 
 // RetainedMessageTest tests the broker for properly handling retained messages.
 func RetainedMessageTest(t *testing.T, config *Config, out, in string, sub, pub packet.QOS) {
-	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), out, 10*time.Second))
+	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), out, config.timeout()))
 
 	time.Sleep(config.MessageRetainWait)
 
@@ -20,13 +20,13 @@ func RetainedMessageTest(t *testing.T, config *Config, out, in string, sub, pub
 
 	cf, err := retainer.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	pf, err := retainer.Publish(out, testPayload, pub, true)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
 	time.Sleep(config.MessageRetainWait)
 
@@ -50,16 +50,16 @@ func RetainedMessageTest(t *testing.T, config *Config, out, in string, sub, pub
 
 	cf, err = receiver.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := receiver.Subscribe(in, sub)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{sub}, sf.ReturnCodes())
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	time.Sleep(config.NoMessageWait)
 
@@ -70,7 +70,7 @@ func RetainedMessageTest(t *testing.T, config *Config, out, in string, sub, pub
 // RetainedMessageReplaceTest tests the broker for replacing existing retained
 // messages.
 func RetainedMessageReplaceTest(t *testing.T, config *Config, topic string) {
-	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), topic, 10*time.Second))
+	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), topic, config.timeout()))
 
 	time.Sleep(config.MessageRetainWait)
 
@@ -78,19 +78,19 @@ func RetainedMessageReplaceTest(t *testing.T, config *Config, topic string) {
 
 	cf, err := retainer.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	pf, err := retainer.Publish(topic, testPayload, 0, true)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
 	time.Sleep(config.MessageRetainWait)
 
 	pf, err = retainer.Publish(topic, testPayload2, 0, true)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
 	time.Sleep(config.MessageRetainWait)
 
@@ -114,16 +114,16 @@ func RetainedMessageReplaceTest(t *testing.T, config *Config, topic string) {
 
 	cf, err = receiver.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := receiver.Subscribe(topic, 0)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0}, sf.ReturnCodes())
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	time.Sleep(config.NoMessageWait)
 
@@ -133,7 +133,7 @@ func RetainedMessageReplaceTest(t *testing.T, config *Config, topic string) {
 
 // ClearRetainedMessageTest tests the broker for clearing retained messages.
 func ClearRetainedMessageTest(t *testing.T, config *Config, topic string) {
-	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), topic, 10*time.Second))
+	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), topic, config.timeout()))
 
 	time.Sleep(config.MessageRetainWait)
 
@@ -141,13 +141,13 @@ func ClearRetainedMessageTest(t *testing.T, config *Config, topic string) {
 
 	cf, err := retainer.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	pf, err := retainer.Publish(topic, testPayload, 0, true)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
 	time.Sleep(config.MessageRetainWait)
 
@@ -176,22 +176,22 @@ func ClearRetainedMessageTest(t *testing.T, config *Config, topic string) {
 
 	cf, err = receiverAndClearer.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := receiverAndClearer.Subscribe(topic, 0)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0}, sf.ReturnCodes())
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	time.Sleep(config.NoMessageWait)
 
 	pf, err = receiverAndClearer.Publish(topic, nil, 0, true)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
 	time.Sleep(config.MessageRetainWait)
 
@@ -206,13 +206,13 @@ func ClearRetainedMessageTest(t *testing.T, config *Config, topic string) {
 
 	cf, err = nonReceiver.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err = nonReceiver.Subscribe(topic, 0)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0}, sf.ReturnCodes())
 
 	time.Sleep(config.NoMessageWait)
@@ -224,7 +224,7 @@ func ClearRetainedMessageTest(t *testing.T, config *Config, topic string) {
 // DirectRetainedMessageTest tests the broker for properly handling subscriptions
 // with retained messages.
 func DirectRetainedMessageTest(t *testing.T, config *Config, topic string) {
-	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), topic, 10*time.Second))
+	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), topic, config.timeout()))
 
 	time.Sleep(config.MessageRetainWait)
 
@@ -244,22 +244,22 @@ func DirectRetainedMessageTest(t *testing.T, config *Config, topic string) {
 
 	cf, err := c.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := c.Subscribe(topic, 0)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0}, sf.ReturnCodes())
 
 	time.Sleep(config.MessageRetainWait)
 
 	pf, err := c.Publish(topic, testPayload, 0, true)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	time.Sleep(config.NoMessageWait)
 
@@ -270,7 +270,7 @@ func DirectRetainedMessageTest(t *testing.T, config *Config, topic string) {
 // DirectClearRetainedMessageTest tests the broker for properly dispatching a
 // messages intended to clear a retained message.
 func DirectClearRetainedMessageTest(t *testing.T, config *Config, topic string) {
-	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), topic, 10*time.Second))
+	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), topic, config.timeout()))
 
 	time.Sleep(config.MessageRetainWait)
 
@@ -290,22 +290,22 @@ func DirectClearRetainedMessageTest(t *testing.T, config *Config, topic string)
 
 	cf, err := c.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := c.Subscribe(topic, 0)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0}, sf.ReturnCodes())
 
 	time.Sleep(config.MessageRetainWait)
 
 	pf, err := c.Publish(topic, nil, 0, true)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	time.Sleep(config.NoMessageWait)
 
@@ -315,7 +315,7 @@ func DirectClearRetainedMessageTest(t *testing.T, config *Config, topic string)
 
 // RetainedWillTest tests the broker for support of retained will messages.
 func RetainedWillTest(t *testing.T, config *Config, topic string) {
-	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), topic, 10*time.Second))
+	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), topic, config.timeout()))
 
 	time.Sleep(config.MessageRetainWait)
 
@@ -331,7 +331,7 @@ func RetainedWillTest(t *testing.T, config *Config, topic string) {
 
 	cf, err := clientWithRetainedWill.Connect(opts)
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
@@ -356,16 +356,16 @@ func RetainedWillTest(t *testing.T, config *Config, topic string) {
 
 	cf, err = receiver.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := receiver.Subscribe(topic, 0)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0}, sf.ReturnCodes())
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	time.Sleep(config.NoMessageWait)
 
@@ -376,7 +376,7 @@ func RetainedWillTest(t *testing.T, config *Config, topic string) {
 // RetainedMessageResubscriptionTest tests the broker for properly dispatching
 // retained messages on resubscription.
 func RetainedMessageResubscriptionTest(t *testing.T, config *Config, topic string) {
-	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), topic, 10*time.Second))
+	assert.NoError(t, client.ClearRetainedMessage(client.NewConfig(config.URL), topic, config.timeout()))
 
 	time.Sleep(config.MessageRetainWait)
 
@@ -384,13 +384,13 @@ func RetainedMessageResubscriptionTest(t *testing.T, config *Config, topic strin
 
 	cf, err := retainer.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	pf, err := retainer.Publish(topic, testPayload, 0, true)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
 	time.Sleep(config.MessageRetainWait)
 
@@ -413,23 +413,23 @@ func RetainedMessageResubscriptionTest(t *testing.T, config *Config, topic strin
 
 	cf, err = receiver.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := receiver.Subscribe(topic, 0)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0}, sf.ReturnCodes())
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	sf, err = receiver.Subscribe(topic, 0)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0}, sf.ReturnCodes())
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	time.Sleep(config.NoMessageWait)
 
@@ -0,0 +1,211 @@
+package spec
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// the number of messages published by the shared subscription tests
+const sharedMessages = 10
+
+type sharedMember struct {
+	client   *client.Client
+	messages []*packet.Message
+	received chan struct{}
+	mutex    sync.Mutex
+}
+
+func newSharedMember(t *testing.T, config *Config, topic string, qos packet.QOS) *sharedMember {
+	m := &sharedMember{
+		client:   client.New(),
+		received: make(chan struct{}, sharedMessages*2),
+	}
+
+	m.client.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		assert.Equal(t, topic, msg.Topic)
+		assert.False(t, msg.Retain)
+
+		m.mutex.Lock()
+		m.messages = append(m.messages, msg)
+		m.mutex.Unlock()
+
+		m.received <- struct{}{}
+		return nil
+	}
+
+	cf, err := m.client.Connect(client.NewConfig(config.URL))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(config.timeout()))
+	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
+
+	sf, err := m.client.Subscribe("$share/group/"+topic, qos)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(config.timeout()))
+	assert.Equal(t, []packet.QOS{qos}, sf.ReturnCodes())
+
+	return m
+}
+
+func (m *sharedMember) payloads() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var list []string
+	for _, msg := range m.messages {
+		list = append(list, string(msg.Payload))
+	}
+
+	return list
+}
+
+func publishShared(t *testing.T, config *Config, topic string, qos packet.QOS, from, to int) {
+	publisher := client.New()
+
+	cf, err := publisher.Connect(client.NewConfig(config.URL))
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(config.timeout()))
+
+	for i := from; i < to; i++ {
+		pf, err := publisher.Publish(topic, []byte(strconv.Itoa(i)), qos, false)
+		assert.NoError(t, err)
+		assert.NoError(t, pf.Wait(config.timeout()))
+	}
+
+	err = publisher.Disconnect()
+	assert.NoError(t, err)
+}
+
+func (c *Config) awaitShared(members []*sharedMember, total int) bool {
+	timeout := time.After(c.timeout())
+
+	// merge notifications
+	merged := make(chan struct{}, total)
+	done := make(chan struct{})
+	defer close(done)
+	for _, m := range members {
+		go func(m *sharedMember) {
+			for {
+				select {
+				case <-m.received:
+					merged <- struct{}{}
+				case <-done:
+					return
+				}
+			}
+		}(m)
+	}
+
+	for i := 0; i < total; i++ {
+		select {
+		case <-merged:
+		case <-timeout:
+			return false
+		}
+	}
+
+	return true
+}
+
+func assertDisjoint(t *testing.T, from, to int, members ...*sharedMember) {
+	seen := map[string]bool{}
+	for _, m := range members {
+		for _, payload := range m.payloads() {
+			assert.False(t, seen[payload], "message %s received more than once", payload)
+			seen[payload] = true
+		}
+	}
+
+	for i := from; i < to; i++ {
+		assert.True(t, seen[strconv.Itoa(i)], "message %d not received", i)
+	}
+}
+
+// SharedSubscriptionTest tests the broker for delivering each message of a
+// shared subscription to only one member of the group.
+func SharedSubscriptionTest(t *testing.T, config *Config, topic string) {
+	member1 := newSharedMember(t, config, topic, 1)
+	member2 := newSharedMember(t, config, topic, 1)
+
+	publishShared(t, config, topic, 1, 0, sharedMessages)
+
+	assert.True(t, config.awaitShared([]*sharedMember{member1, member2}, sharedMessages))
+
+	time.Sleep(config.NoMessageWait)
+
+	assertDisjoint(t, 0, sharedMessages, member1, member2)
+
+	err := member1.client.Disconnect()
+	assert.NoError(t, err)
+
+	err = member2.client.Disconnect()
+	assert.NoError(t, err)
+}
+
+// SharedSubscriptionQOSTest tests the broker for honoring the QOS level
+// requested by each member of a shared subscription.
+func SharedSubscriptionQOSTest(t *testing.T, config *Config, topic string) {
+	member1 := newSharedMember(t, config, topic, 0)
+	member2 := newSharedMember(t, config, topic, 2)
+
+	publishShared(t, config, topic, 2, 0, sharedMessages)
+
+	assert.True(t, config.awaitShared([]*sharedMember{member1, member2}, sharedMessages))
+
+	time.Sleep(config.NoMessageWait)
+
+	assertDisjoint(t, 0, sharedMessages, member1, member2)
+
+	member1.mutex.Lock()
+	for _, msg := range member1.messages {
+		assert.Equal(t, packet.QOS(0), msg.QOS)
+	}
+	member1.mutex.Unlock()
+
+	member2.mutex.Lock()
+	for _, msg := range member2.messages {
+		assert.Equal(t, packet.QOS(2), msg.QOS)
+	}
+	member2.mutex.Unlock()
+
+	err := member1.client.Disconnect()
+	assert.NoError(t, err)
+
+	err = member2.client.Disconnect()
+	assert.NoError(t, err)
+}
+
+// SharedSubscriptionRedistributionTest tests the broker for delivering all
+// messages to the remaining members once a member of a shared subscription
+// disconnected.
+func SharedSubscriptionRedistributionTest(t *testing.T, config *Config, topic string) {
+	member1 := newSharedMember(t, config, topic, 1)
+	member2 := newSharedMember(t, config, topic, 1)
+
+	publishShared(t, config, topic, 1, 0, sharedMessages)
+
+	assert.True(t, config.awaitShared([]*sharedMember{member1, member2}, sharedMessages))
+
+	err := member1.client.Disconnect()
+	assert.NoError(t, err)
+
+	time.Sleep(config.ProcessWait)
+
+	publishShared(t, config, topic, 1, sharedMessages, sharedMessages*2)
+
+	assert.True(t, config.awaitShared([]*sharedMember{member2}, sharedMessages))
+
+	time.Sleep(config.NoMessageWait)
+
+	assertDisjoint(t, 0, sharedMessages*2, member1, member2)
+
+	err = member2.client.Disconnect()
+	assert.NoError(t, err)
+}
@@ -23,6 +23,11 @@ type Config struct {
 	Authentication       bool
 	UniqueClientIDs      bool
 	RootSlashDistinction bool
+	SharedSubscriptions  bool
+
+	// PacketIDRollover enables the long-running tests that send more than
+	// 65535 QOS1 messages through a connection. They are skipped in short mode.
+	PacketIDRollover bool
 
 	// ProcessWait defines the time some tests should wait and let the broker
 	// finish processing (e.g. properly terminating a connection)
@@ -36,7 +41,26 @@ type Config struct {
 	// receiving a wrongly sent message or an error.
 	NoMessageWait time.Duration
 
+	// Timeout defines how long tests wait for acknowledgements and messages
+	// before they fail.
+	//
+	// Will default to 10s.
+	Timeout time.Duration
+
+	// Timeouts can be set to override the timeout of individual tests by
+	// their name e.g. "KeepAliveTimeout".
+	Timeouts map[string]time.Duration
+
+	// OverlappingDuplicates should be set if the broker delivers a message
+	// once per matching subscription when a client has overlapping
+	// subscriptions, which is permitted by the specification.
+	OverlappingDuplicates bool
+
+	// Report can be set to collect the results of all tests.
+	Report *Report
+
 	counter int
+	current string
 }
 
 // AllFeatures returns a config that enables all features.
@@ -49,6 +73,8 @@ func AllFeatures() *Config {
 		Authentication:       true,
 		UniqueClientIDs:      true,
 		RootSlashDistinction: true,
+		SharedSubscriptions:  true,
+		PacketIDRollover:     true,
 	}
 }
 
@@ -67,6 +93,20 @@ func (c *Config) usernamePassword() (string, string) {
 	return uri.User.Username(), pw
 }
 
+func (c *Config) timeout() time.Duration {
+	// check override
+	if timeout, ok := c.Timeouts[c.current]; ok {
+		return timeout
+	}
+
+	// check timeout
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+
+	return 10 * time.Second
+}
+
 func (c *Config) clientID() string {
 	c.counter++
 	return fmt.Sprintf("c%d", c.counter)
@@ -74,279 +114,329 @@ func (c *Config) clientID() string {
 
 // Run will fully test a to support all specified features in the matrix.
 func Run(t *testing.T, config *Config) {
-	t.Run("PublishSubscribeQOS0", func(t *testing.T) {
+	config.run(t, "PublishSubscribeQOS0", func(t *testing.T) {
 		PublishSubscribeTest(t, config, "pubsub/1", "pubsub/1", 0, 0, 0)
 	})
 
-	t.Run("PublishSubscribeQOS1", func(t *testing.T) {
+	config.run(t, "PublishSubscribeQOS1", func(t *testing.T) {
 		PublishSubscribeTest(t, config, "pubsub/2", "pubsub/2", 1, 1, 1)
 	})
 
-	t.Run("PublishSubscribeQOS2", func(t *testing.T) {
+	config.run(t, "PublishSubscribeQOS2", func(t *testing.T) {
 		PublishSubscribeTest(t, config, "pubsub/3", "pubsub/3", 2, 2, 2)
 	})
 
-	t.Run("PublishSubscribeQOSKeep0", func(t *testing.T) {
+	config.run(t, "PublishSubscribeQOSKeep0", func(t *testing.T) {
 		PublishSubscribeTest(t, config, "keep/1", "keep/1", 1, 0, 0)
 	})
 
-	t.Run("PublishSubscribeQOSKeep1", func(t *testing.T) {
+	config.run(t, "PublishSubscribeQOSKeep1", func(t *testing.T) {
 		PublishSubscribeTest(t, config, "keep/2", "keep/2", 2, 1, 1)
 	})
 
-	t.Run("PublishSubscribeWildcardOne", func(t *testing.T) {
+	config.run(t, "PublishSubscribeWildcardOne", func(t *testing.T) {
 		PublishSubscribeTest(t, config, "wildcard/1/foo", "wildcard/1/+", 0, 0, 0)
 	})
 
-	t.Run("PublishSubscribeWildcardSome", func(t *testing.T) {
+	config.run(t, "PublishSubscribeWildcardSome", func(t *testing.T) {
 		PublishSubscribeTest(t, config, "wildcard/2/foo", "wildcard/2/#", 0, 0, 0)
 	})
 
-	t.Run("PublishSubscribeQOSDowngrade1To0", func(t *testing.T) {
+	config.run(t, "PublishSubscribeQOSDowngrade1To0", func(t *testing.T) {
 		PublishSubscribeTest(t, config, "downgrade/1", "downgrade/1", 0, 1, 0)
 	})
 
-	t.Run("PublishSubscribeQOSDowngrade2To0", func(t *testing.T) {
+	config.run(t, "PublishSubscribeQOSDowngrade2To0", func(t *testing.T) {
 		PublishSubscribeTest(t, config, "downgrade/2", "downgrade/2", 0, 2, 0)
 	})
 
-	t.Run("PublishSubscribeQOSDowngrade2To1", func(t *testing.T) {
+	config.run(t, "PublishSubscribeQOSDowngrade2To1", func(t *testing.T) {
 		PublishSubscribeTest(t, config, "downgrade/3", "downgrade/3", 1, 2, 1)
 	})
 
-	t.Run("UnsubscribeQOS0", func(t *testing.T) {
+	config.run(t, "UnsubscribeQOS0", func(t *testing.T) {
 		UnsubscribeTest(t, config, "unsub/1", 0)
 	})
 
-	t.Run("UnsubscribeQOS1", func(t *testing.T) {
+	config.run(t, "UnsubscribeQOS1", func(t *testing.T) {
 		UnsubscribeTest(t, config, "unsub/2", 1)
 	})
 
-	t.Run("UnsubscribeQOS2", func(t *testing.T) {
+	config.run(t, "UnsubscribeQOS2", func(t *testing.T) {
 		UnsubscribeTest(t, config, "unsub/3", 2)
 	})
 
-	t.Run("UnsubscribeNotExistingSubscription", func(t *testing.T) {
+	config.run(t, "UnsubscribeNotExistingSubscription", func(t *testing.T) {
 		UnsubscribeNotExistingSubscriptionTest(t, config, "unsub/4")
 	})
 
-	t.Run("UnsubscribeOverlappingSubscription", func(t *testing.T) {
+	config.run(t, "UnsubscribeOverlappingSubscription", func(t *testing.T) {
 		UnsubscribeOverlappingSubscriptions(t, config, "unsub/5")
 	})
 
-	t.Run("SubscriptionUpgradeQOS0To1", func(t *testing.T) {
+	config.run(t, "UnsubscribeMultiple", func(t *testing.T) {
+		UnsubscribeMultipleTest(t, config, "unsub/6")
+	})
+
+	config.run(t, "UnsubscribeStopsDeliveryQOS0", func(t *testing.T) {
+		UnsubscribeStopsDeliveryTest(t, config, "unsub/7", 0)
+	})
+
+	config.run(t, "UnsubscribeStopsDeliveryQOS1", func(t *testing.T) {
+		UnsubscribeStopsDeliveryTest(t, config, "unsub/8", 1)
+	})
+
+	config.run(t, "UnsubscribeStopsDeliveryQOS2", func(t *testing.T) {
+		UnsubscribeStopsDeliveryTest(t, config, "unsub/9", 2)
+	})
+
+	config.run(t, "SubscriptionUpgradeQOS0To1", func(t *testing.T) {
 		SubscriptionUpgradeTest(t, config, "subup/1", 0, 1)
 	})
 
-	t.Run("SubscriptionUpgradeQOS1To2", func(t *testing.T) {
+	config.run(t, "SubscriptionUpgradeQOS1To2", func(t *testing.T) {
 		SubscriptionUpgradeTest(t, config, "subup/2", 1, 2)
 	})
 
-	t.Run("OverlappingSubscriptionsWildcardOne", func(t *testing.T) {
+	config.run(t, "OverlappingSubscriptionsWildcardOne", func(t *testing.T) {
 		OverlappingSubscriptionsTest(t, config, "ovlsub/1/foo", "ovlsub/1/+")
 	})
 
-	t.Run("OverlappingSubscriptionsWildcardSome", func(t *testing.T) {
+	config.run(t, "OverlappingSubscriptionsWildcardSome", func(t *testing.T) {
 		OverlappingSubscriptionsTest(t, config, "ovlsub/2/foo", "ovlsub/2/#")
 	})
 
-	t.Run("MultipleSubscription", func(t *testing.T) {
+	config.run(t, "MultipleSubscription", func(t *testing.T) {
 		MultipleSubscriptionTest(t, config, "mulsub")
 	})
 
-	t.Run("DuplicateSubscription", func(t *testing.T) {
+	config.run(t, "DuplicateSubscription", func(t *testing.T) {
 		DuplicateSubscriptionTest(t, config, "dblsub")
 	})
 
-	t.Run("IsolatedSubscription", func(t *testing.T) {
+	config.run(t, "IsolatedSubscription", func(t *testing.T) {
 		IsolatedSubscriptionTest(t, config, "islsub")
 	})
 
-	t.Run("WillQOS0", func(t *testing.T) {
+	config.run(t, "WillQOS0", func(t *testing.T) {
 		WillTest(t, config, "will/1", 0, 0)
 	})
 
-	t.Run("WillQOS1", func(t *testing.T) {
+	config.run(t, "WillQOS1", func(t *testing.T) {
 		WillTest(t, config, "will/2", 1, 1)
 	})
 
-	t.Run("WillQOS2", func(t *testing.T) {
+	config.run(t, "WillQOS2", func(t *testing.T) {
 		WillTest(t, config, "will/3", 2, 2)
 	})
 
-	t.Run("CleanWill", func(t *testing.T) {
+	config.run(t, "CleanWill", func(t *testing.T) {
 		CleanWillTest(t, config, "will/4")
 	})
 
-	t.Run("KeepAlive", func(t *testing.T) {
+	config.run(t, "KeepAlive", func(t *testing.T) {
 		KeepAliveTest(t, config)
 	})
 
-	t.Run("KeepAliveTimeout", func(t *testing.T) {
+	config.run(t, "KeepAliveTimeout", func(t *testing.T) {
 		KeepAliveTimeoutTest(t, config)
 	})
 
-	t.Run("UnexpectedPubrel", func(t *testing.T) {
+	config.run(t, "UnexpectedPubrel", func(t *testing.T) {
 		UnexpectedPubrelTest(t, config)
 	})
 
+	config.run(t, "PacketIDReuse", func(t *testing.T) {
+		PacketIDReuseTest(t, config, "ids/1")
+	})
+
+	if config.PacketIDRollover {
+		config.run(t, "PacketIDRollover", func(t *testing.T) {
+			PacketIDRolloverTest(t, config, "ids/2")
+		})
+	}
+
 	if config.RetainedMessages {
-		t.Run("RetainedMessageQOS0", func(t *testing.T) {
+		config.run(t, "RetainedMessageQOS0", func(t *testing.T) {
 			RetainedMessageTest(t, config, "retained/1", "retained/1", 0, 0)
 		})
 
-		t.Run("RetainedMessageQOS1", func(t *testing.T) {
+		config.run(t, "RetainedMessageQOS1", func(t *testing.T) {
 			RetainedMessageTest(t, config, "retained/2", "retained/2", 1, 1)
 		})
 
-		t.Run("RetainedMessageQOS2", func(t *testing.T) {
+		config.run(t, "RetainedMessageQOS2", func(t *testing.T) {
 			RetainedMessageTest(t, config, "retained/3", "retained/3", 2, 2)
 		})
 
-		t.Run("RetainedMessageDowngrade1To0", func(t *testing.T) {
+		config.run(t, "RetainedMessageDowngrade1To0", func(t *testing.T) {
 			RetainedMessageTest(t, config, "retained/4", "retained/4", 0, 1)
 		})
 
-		t.Run("RetainedMessageDowngrade2To0", func(t *testing.T) {
+		config.run(t, "RetainedMessageDowngrade2To0", func(t *testing.T) {
 			RetainedMessageTest(t, config, "retained/5", "retained/5", 0, 2)
 		})
 
-		t.Run("RetainedMessageDowngrade2To1", func(t *testing.T) {
+		config.run(t, "RetainedMessageDowngrade2To1", func(t *testing.T) {
 			RetainedMessageTest(t, config, "retained/6", "retained/6", 1, 2)
 		})
 
-		t.Run("RetainedMessageWildcardOne", func(t *testing.T) {
+		config.run(t, "RetainedMessageWildcardOne", func(t *testing.T) {
 			RetainedMessageTest(t, config, "retained/7/foo/bar", "retained/7/foo/+", 0, 0)
 		})
 
-		t.Run("RetainedMessageWildcardSome", func(t *testing.T) {
+		config.run(t, "RetainedMessageWildcardSome", func(t *testing.T) {
 			RetainedMessageTest(t, config, "retained/8/foo/bar", "retained/8/#", 0, 0)
 		})
 
-		t.Run("RetainedMessageReplace", func(t *testing.T) {
+		config.run(t, "RetainedMessageReplace", func(t *testing.T) {
 			RetainedMessageReplaceTest(t, config, "retained/9")
 		})
 
-		t.Run("ClearRetainedMessage", func(t *testing.T) {
+		config.run(t, "ClearRetainedMessage", func(t *testing.T) {
 			ClearRetainedMessageTest(t, config, "retained/10")
 		})
 
-		t.Run("DirectRetainedMessage", func(t *testing.T) {
+		config.run(t, "DirectRetainedMessage", func(t *testing.T) {
 			DirectRetainedMessageTest(t, config, "retained/11")
 		})
 
-		t.Run("DirectClearRetainedMessage", func(t *testing.T) {
+		config.run(t, "DirectClearRetainedMessage", func(t *testing.T) {
 			DirectClearRetainedMessageTest(t, config, "retained/12")
 		})
 
-		t.Run("RetainedWill", func(t *testing.T) {
+		config.run(t, "RetainedWill", func(t *testing.T) {
 			RetainedWillTest(t, config, "retained/13")
 		})
 
-		t.Run("RetainedMessageResubscription", func(t *testing.T) {
+		config.run(t, "RetainedMessageResubscription", func(t *testing.T) {
 			RetainedMessageResubscriptionTest(t, config, "retained/14")
 		})
 	}
 
 	if config.StoredPackets {
-		t.Run("PublishResendQOS1", func(t *testing.T) {
+		config.run(t, "PublishResendQOS1", func(t *testing.T) {
 			PublishResendQOS1Test(t, config, "pubres/1")
 		})
 
-		t.Run("PublishResendQOS2", func(t *testing.T) {
+		config.run(t, "PublishResendQOS2", func(t *testing.T) {
 			PublishResendQOS2Test(t, config, "pubres/2")
 		})
 
-		t.Run("PubrelResendQOS2", func(t *testing.T) {
+		config.run(t, "PubrelResendQOS2", func(t *testing.T) {
 			PubrelResendQOS2Test(t, config, "pubres/3")
 		})
 	}
 
 	if config.StoredSubscriptions {
-		t.Run("StoredSubscriptionsQOS0", func(t *testing.T) {
+		config.run(t, "StoredSubscriptionsQOS0", func(t *testing.T) {
 			StoredSubscriptionsTest(t, config, "strdsub/1", 0)
 		})
 
-		t.Run("StoredSubscriptionsQOS1", func(t *testing.T) {
+		config.run(t, "StoredSubscriptionsQOS1", func(t *testing.T) {
 			StoredSubscriptionsTest(t, config, "strdsub/2", 1)
 		})
 
-		t.Run("StoredSubscriptionsQOS2", func(t *testing.T) {
+		config.run(t, "StoredSubscriptionsQOS2", func(t *testing.T) {
 			StoredSubscriptionsTest(t, config, "strdsub/3", 2)
 		})
 
-		t.Run("CleanStoredSubscriptions", func(t *testing.T) {
+		config.run(t, "CleanStoredSubscriptions", func(t *testing.T) {
 			CleanStoredSubscriptionsTest(t, config, "strdsub/4")
 		})
 
-		t.Run("RemoveStoredSubscription", func(t *testing.T) {
+		config.run(t, "RemoveStoredSubscription", func(t *testing.T) {
 			RemoveStoredSubscriptionTest(t, config, "strdsub/5")
 		})
 	}
 
 	if config.OfflineSubscriptions {
-		t.Run("OfflineSubscriptionQOS00", func(t *testing.T) {
+		config.run(t, "OfflineSubscriptionQOS00", func(t *testing.T) {
 			OfflineSubscriptionTest(t, config, "offsub/1", 0, 0, false)
 		})
 
-		t.Run("OfflineSubscriptionQOS01", func(t *testing.T) {
+		config.run(t, "OfflineSubscriptionQOS01", func(t *testing.T) {
 			OfflineSubscriptionTest(t, config, "offsub/2", 0, 1, false)
 		})
 
-		t.Run("OfflineSubscriptionQOS10", func(t *testing.T) {
+		config.run(t, "OfflineSubscriptionQOS10", func(t *testing.T) {
 			OfflineSubscriptionTest(t, config, "offsub/3", 1, 0, false)
 		})
 
-		t.Run("OfflineSubscriptionQOS11", func(t *testing.T) {
+		config.run(t, "OfflineSubscriptionQOS11", func(t *testing.T) {
 			OfflineSubscriptionTest(t, config, "offsub/4", 1, 1, true)
 		})
 
-		t.Run("OfflineSubscriptionQOS12", func(t *testing.T) {
+		config.run(t, "OfflineSubscriptionQOS12", func(t *testing.T) {
 			OfflineSubscriptionTest(t, config, "offsub/5", 1, 2, true)
 		})
 
-		t.Run("OfflineSubscriptionQOS21", func(t *testing.T) {
+		config.run(t, "OfflineSubscriptionQOS21", func(t *testing.T) {
 			OfflineSubscriptionTest(t, config, "offsub/6", 2, 1, true)
 		})
 
-		t.Run("OfflineSubscriptionQOS22", func(t *testing.T) {
+		config.run(t, "OfflineSubscriptionQOS22", func(t *testing.T) {
 			OfflineSubscriptionTest(t, config, "offsub/7", 2, 2, true)
 		})
 	}
 
 	if config.OfflineSubscriptions && config.RetainedMessages {
-		t.Run("OfflineSubscriptionRetainedQOS0", func(t *testing.T) {
+		config.run(t, "OfflineSubscriptionRetainedQOS0", func(t *testing.T) {
 			OfflineSubscriptionRetainedTest(t, config, "offsubret/1", 0, 0, false)
 		})
 
-		t.Run("OfflineSubscriptionRetainedQOS1", func(t *testing.T) {
+		config.run(t, "OfflineSubscriptionRetainedQOS1", func(t *testing.T) {
 			OfflineSubscriptionRetainedTest(t, config, "offsubret/2", 1, 1, true)
 		})
 
-		t.Run("OfflineSubscriptionRetainedQOS2", func(t *testing.T) {
+		config.run(t, "OfflineSubscriptionRetainedQOS2", func(t *testing.T) {
 			OfflineSubscriptionRetainedTest(t, config, "offsubret/3", 2, 2, true)
 		})
 	}
 
 	if config.Authentication {
-		t.Run("Authentication", func(t *testing.T) {
+		config.run(t, "Authentication", func(t *testing.T) {
 			AuthenticationTest(t, config)
 		})
 	}
 
 	if config.UniqueClientIDs {
-		t.Run("UniqueClientIDUnclean", func(t *testing.T) {
+		config.run(t, "UniqueClientIDUnclean", func(t *testing.T) {
 			UniqueClientIDUncleanTest(t, config)
 		})
 
-		t.Run("UniqueClientIDClean", func(t *testing.T) {
+		config.run(t, "UniqueClientIDClean", func(t *testing.T) {
 			UniqueClientIDCleanTest(t, config)
 		})
+
+		config.run(t, "CleanSessionTakeover", func(t *testing.T) {
+			CleanSessionTakeoverTest(t, config, "takeover/2")
+		})
+	}
+
+	if config.UniqueClientIDs && config.StoredPackets && config.StoredSubscriptions {
+		config.run(t, "SessionTakeover", func(t *testing.T) {
+			SessionTakeoverTest(t, config, "takeover/1")
+		})
 	}
 
 	if config.RootSlashDistinction {
-		t.Run("RootSlashDistinction", func(t *testing.T) {
+		config.run(t, "RootSlashDistinction", func(t *testing.T) {
 			RootSlashDistinctionTest(t, config, "rootslash")
 		})
 	}
+
+	if config.SharedSubscriptions {
+		config.run(t, "SharedSubscription", func(t *testing.T) {
+			SharedSubscriptionTest(t, config, "shared/1")
+		})
+
+		config.run(t, "SharedSubscriptionQOS", func(t *testing.T) {
+			SharedSubscriptionQOSTest(t, config, "shared/2")
+		})
+
+		config.run(t, "SharedSubscriptionRedistribution", func(t *testing.T) {
+			SharedSubscriptionRedistributionTest(t, config, "shared/3")
+		})
+	}
 }
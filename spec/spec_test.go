@@ -2,18 +2,15 @@ package spec
 
 import (
 	"testing"
-	"time"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestSpec(t *testing.T) {
-	config := AllFeatures()
-	config.URL = "tcp://localhost:1883"
+	config, err := ProfileConfig(Mosquitto)
+	require.NoError(t, err)
 
-	// mosquitto specific config
-	config.Authentication = false
-	config.ProcessWait = 10 * time.Millisecond
-	config.MessageRetainWait = 100 * time.Millisecond
-	config.NoMessageWait = 50 * time.Millisecond
+	config.URL = "tcp://localhost:1883"
 
 	Run(t, config)
 }
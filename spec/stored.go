@@ -17,7 +17,7 @@ import (
 func PublishResendQOS1Test(t *testing.T, config *Config, topic string) {
 	id := config.clientID()
 
-	assert.NoError(t, client.ClearSession(client.NewConfigWithClientID(config.URL, id), 10*time.Second))
+	assert.NoError(t, client.ClearSession(client.NewConfigWithClientID(config.URL, id), config.timeout()))
 
 	username, password := config.usernamePassword()
 
@@ -88,7 +88,7 @@ func PublishResendQOS1Test(t *testing.T, config *Config, topic string) {
 func PublishResendQOS2Test(t *testing.T, config *Config, topic string) {
 	id := config.clientID()
 
-	assert.NoError(t, client.ClearSession(client.NewConfigWithClientID(config.URL, id), 10*time.Second))
+	assert.NoError(t, client.ClearSession(client.NewConfigWithClientID(config.URL, id), config.timeout()))
 
 	username, password := config.usernamePassword()
 
@@ -171,7 +171,7 @@ func PublishResendQOS2Test(t *testing.T, config *Config, topic string) {
 func PubrelResendQOS2Test(t *testing.T, config *Config, topic string) {
 	id := config.clientID()
 
-	assert.NoError(t, client.ClearSession(client.NewConfigWithClientID(config.URL, id), 10*time.Second))
+	assert.NoError(t, client.ClearSession(client.NewConfigWithClientID(config.URL, id), config.timeout()))
 
 	username, password := config.usernamePassword()
 
@@ -259,19 +259,19 @@ func StoredSubscriptionsTest(t *testing.T, config *Config, topic string, qos pac
 	options := client.NewConfigWithClientID(config.URL, id)
 	options.CleanSession = false
 
-	assert.NoError(t, client.ClearSession(options, 10*time.Second))
+	assert.NoError(t, client.ClearSession(options, config.timeout()))
 
 	subscriber := client.New()
 
 	cf, err := subscriber.Connect(options)
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := subscriber.Subscribe(topic, qos)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{qos}, sf.ReturnCodes())
 
 	err = subscriber.Disconnect()
@@ -294,15 +294,15 @@ func StoredSubscriptionsTest(t *testing.T, config *Config, topic string, qos pac
 
 	cf, err = receiver.Connect(options)
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.True(t, cf.SessionPresent())
 
 	pf, err := receiver.Publish(topic, testPayload, qos, false)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
-	safeReceive(wait)
+	config.safeReceive(wait)
 
 	time.Sleep(config.NoMessageWait)
 
@@ -318,19 +318,19 @@ func CleanStoredSubscriptionsTest(t *testing.T, config *Config, topic string) {
 	options := client.NewConfigWithClientID(config.URL, id)
 	options.CleanSession = false
 
-	assert.NoError(t, client.ClearSession(options, 10*time.Second))
+	assert.NoError(t, client.ClearSession(options, config.timeout()))
 
 	subscriber := client.New()
 
 	cf, err := subscriber.Connect(options)
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := subscriber.Subscribe(topic, 0)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0}, sf.ReturnCodes())
 
 	err = subscriber.Disconnect()
@@ -346,13 +346,13 @@ func CleanStoredSubscriptionsTest(t *testing.T, config *Config, topic string) {
 
 	cf, err = nonReceiver.Connect(options)
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	pf, err := nonReceiver.Publish(topic, testPayload, 0, false)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
 	time.Sleep(config.NoMessageWait)
 
@@ -368,24 +368,24 @@ func RemoveStoredSubscriptionTest(t *testing.T, config *Config, topic string) {
 	options := client.NewConfigWithClientID(config.URL, id)
 	options.CleanSession = false
 
-	assert.NoError(t, client.ClearSession(options, 10*time.Second))
+	assert.NoError(t, client.ClearSession(options, config.timeout()))
 
 	subscriberAndUnsubscriber := client.New()
 
 	cf, err := subscriberAndUnsubscriber.Connect(options)
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	sf, err := subscriberAndUnsubscriber.Subscribe(topic, 0)
 	assert.NoError(t, err)
-	assert.NoError(t, sf.Wait(10*time.Second))
+	assert.NoError(t, sf.Wait(config.timeout()))
 	assert.Equal(t, []packet.QOS{0}, sf.ReturnCodes())
 
 	unsf, err := subscriberAndUnsubscriber.Unsubscribe(topic)
 	assert.NoError(t, err)
-	assert.NoError(t, unsf.Wait(10*time.Second))
+	assert.NoError(t, unsf.Wait(config.timeout()))
 
 	err = subscriberAndUnsubscriber.Disconnect()
 	assert.NoError(t, err)
@@ -398,13 +398,13 @@ func RemoveStoredSubscriptionTest(t *testing.T, config *Config, topic string) {
 
 	cf, err = nonReceiver.Connect(client.NewConfig(config.URL))
 	assert.NoError(t, err)
-	assert.NoError(t, cf.Wait(10*time.Second))
+	assert.NoError(t, cf.Wait(config.timeout()))
 	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
 	assert.False(t, cf.SessionPresent())
 
 	pf, err := nonReceiver.Publish(topic, testPayload, 0, false)
 	assert.NoError(t, err)
-	assert.NoError(t, pf.Wait(10*time.Second))
+	assert.NoError(t, pf.Wait(config.timeout()))
 
 	time.Sleep(config.NoMessageWait)
 
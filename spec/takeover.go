@@ -0,0 +1,173 @@
+package spec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/client"
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
+	"github.com/256dpi/gomqtt/transport/flow"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// SessionTakeoverTest tests the broker for properly closing an active
+// connection if a second client connects with the same id and for handing
+// over the persistent session including subscriptions and unacknowledged
+// messages without losing or duplicating messages.
+func SessionTakeoverTest(t *testing.T, config *Config, topic string) {
+	id := config.clientID()
+
+	options := client.NewConfigWithClientID(config.URL, id)
+	options.CleanSession = false
+
+	assert.NoError(t, client.ClearSession(options, config.timeout()))
+
+	username, password := config.usernamePassword()
+
+	connect := packet.NewConnect()
+	connect.CleanSession = false
+	connect.ClientID = id
+	connect.Username = username
+	connect.Password = password
+
+	subscribe := packet.NewSubscribe()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{
+		{Topic: topic, QOS: 1},
+	}
+
+	publishOut := packet.NewPublish()
+	publishOut.ID = 2
+	publishOut.Message.Topic = topic
+	publishOut.Message.Payload = testPayload
+	publishOut.Message.QOS = 1
+
+	pubackOut := packet.NewPuback()
+	pubackOut.ID = 2
+
+	publishIn := packet.NewPublish()
+	publishIn.ID = 1
+	publishIn.Message.Topic = topic
+	publishIn.Message.Payload = testPayload
+	publishIn.Message.QOS = 1
+
+	messages := make(chan *packet.Message, 10)
+
+	second := client.New()
+	second.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		messages <- msg
+		return nil
+	}
+
+	conn, err := transport.Dial(config.URL)
+	assert.NoError(t, err)
+	assert.NotNil(t, conn)
+
+	// the first connection receives a message without acknowledging it and
+	// is closed by the broker once the second client connects
+	err = flow.New().
+		Send(connect).
+		Skip(&packet.Connack{}).
+		Send(subscribe).
+		Skip(&packet.Suback{}).
+		Send(publishOut).
+		Receive(pubackOut, publishIn).
+		Run(func() {
+			cf, err := second.Connect(options)
+			assert.NoError(t, err)
+			assert.NoError(t, cf.Wait(config.timeout()))
+			assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
+			assert.True(t, cf.SessionPresent())
+		}).
+		End().
+		Test(conn)
+	assert.NoError(t, err)
+
+	// the unacknowledged message is redelivered
+	msg := <-messages
+	assert.Equal(t, topic, msg.Topic)
+	assert.Equal(t, testPayload, msg.Payload)
+	assert.Equal(t, packet.QOS(1), msg.QOS)
+
+	// the subscription has been handed over
+	pf, err := second.Publish(topic, testPayload2, 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(config.timeout()))
+
+	msg = <-messages
+	assert.Equal(t, topic, msg.Topic)
+	assert.Equal(t, testPayload2, msg.Payload)
+	assert.Equal(t, packet.QOS(1), msg.QOS)
+
+	// no message is delivered twice
+	time.Sleep(config.NoMessageWait)
+	assert.Empty(t, messages)
+
+	err = second.Disconnect()
+	assert.NoError(t, err)
+}
+
+// CleanSessionTakeoverTest tests the broker for properly closing an active
+// connection if a second client connects with the same id and a clean session
+// and for discarding the session of the first client.
+func CleanSessionTakeoverTest(t *testing.T, config *Config, topic string) {
+	id := config.clientID()
+
+	options := client.NewConfigWithClientID(config.URL, id)
+	options.CleanSession = false
+
+	assert.NoError(t, client.ClearSession(options, config.timeout()))
+
+	closed := make(chan struct{})
+
+	first := client.New()
+	first.Callback = func(msg *packet.Message, err error) error {
+		assert.Nil(t, msg)
+		assert.Error(t, err)
+		close(closed)
+		return nil
+	}
+
+	cf, err := first.Connect(options)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(config.timeout()))
+	assert.False(t, cf.SessionPresent())
+
+	sf, err := first.Subscribe(topic, 1)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Wait(config.timeout()))
+	assert.Equal(t, []packet.QOS{1}, sf.ReturnCodes())
+
+	received := make(chan struct{}, 1)
+
+	second := client.New()
+	second.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		received <- struct{}{}
+		return nil
+	}
+
+	options.CleanSession = true
+
+	cf, err = second.Connect(options)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Wait(config.timeout()))
+	assert.Equal(t, packet.ConnectionAccepted, cf.ReturnCode())
+	assert.False(t, cf.SessionPresent())
+
+	config.safeReceive(closed)
+
+	// the subscription has been discarded
+	pf, err := second.Publish(topic, testPayload, 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pf.Wait(config.timeout()))
+
+	time.Sleep(config.NoMessageWait)
+	assert.Empty(t, received)
+
+	err = second.Disconnect()
+	assert.NoError(t, err)
+}
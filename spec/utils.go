@@ -6,9 +6,9 @@ import (
 	"github.com/256dpi/gomqtt/packet"
 )
 
-func safeReceive(ch chan struct{}) {
+func (c *Config) safeReceive(ch chan struct{}) {
 	select {
-	case <-time.After(10 * time.Second):
+	case <-time.After(c.timeout()):
 		panic("nothing received")
 	case <-ch:
 	}
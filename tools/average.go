@@ -0,0 +1,45 @@
+package tools
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// An Average is an exponentially weighted moving average of a value that is
+// sampled in varying intervals, like the load averages of a system.
+type Average struct {
+	period time.Duration
+	value  float64
+	mutex  sync.Mutex
+}
+
+// NewAverage returns a new average over the specified period.
+func NewAverage(period time.Duration) *Average {
+	return &Average{
+		period: period,
+	}
+}
+
+// Update will add the specified sample that has been taken after the
+// specified interval and return the new average.
+func (a *Average) Update(sample float64, interval time.Duration) float64 {
+	// acquire mutex
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// update average
+	factor := math.Exp(-float64(interval) / float64(a.period))
+	a.value = sample + factor*(a.value-sample)
+
+	return a.value
+}
+
+// Value returns the current average.
+func (a *Average) Value() float64 {
+	// acquire mutex
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.value
+}
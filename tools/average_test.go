@@ -0,0 +1,24 @@
+package tools
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAverage(t *testing.T) {
+	avg := NewAverage(time.Minute)
+	assert.Equal(t, 0.0, avg.Value())
+
+	value := avg.Update(60, time.Minute)
+	assert.InDelta(t, 60*(1-math.Exp(-1)), value, 0.0001)
+	assert.Equal(t, value, avg.Value())
+
+	for i := 0; i < 100; i++ {
+		avg.Update(60, time.Minute)
+	}
+
+	assert.InDelta(t, 60, avg.Value(), 0.0001)
+}
@@ -0,0 +1,163 @@
+package tools
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// A Backoff calculates the delays between consecutive attempts of an operation.
+// The delay starts at Min and is multiplied by Factor with every attempt until
+// it reaches Max.
+type Backoff struct {
+	// The delay of the first attempt.
+	//
+	// Will default to 100ms.
+	Min time.Duration
+
+	// The maximum delay between attempts.
+	//
+	// Will default to 10s.
+	Max time.Duration
+
+	// The factor the delay is multiplied with after every attempt. A factor of
+	// one yields a constant delay.
+	//
+	// Will default to 2.
+	Factor float64
+
+	// Whether the delays should be randomized between Min and the calculated
+	// delay to spread out attempts of multiple clients.
+	Jitter bool
+
+	attempt int
+	mutex   sync.Mutex
+}
+
+// NewConstantBackoff returns a backoff that always returns the same delay.
+func NewConstantBackoff(delay time.Duration) *Backoff {
+	return &Backoff{
+		Min:    delay,
+		Max:    delay,
+		Factor: 1,
+	}
+}
+
+// NewExponentialBackoff returns a backoff that doubles the delay with every
+// attempt until the maximum is reached.
+func NewExponentialBackoff(min, max time.Duration) *Backoff {
+	return &Backoff{
+		Min:    min,
+		Max:    max,
+		Factor: 2,
+	}
+}
+
+// Duration returns the delay for the next attempt and increments the attempt
+// counter.
+func (b *Backoff) Duration() time.Duration {
+	// acquire mutex
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// get delay
+	d := b.ForAttempt(b.attempt)
+	b.attempt++
+
+	return d
+}
+
+// ForAttempt returns the delay for the specified attempt. The first attempt
+// is zero.
+func (b *Backoff) ForAttempt(attempt int) time.Duration {
+	// get min
+	min := b.Min
+	if min <= 0 {
+		min = 100 * time.Millisecond
+	}
+
+	// get max
+	max := b.Max
+	if max <= 0 {
+		max = 10 * time.Second
+	}
+
+	// check range
+	if min >= max {
+		return max
+	}
+
+	// get factor
+	factor := b.Factor
+	if factor <= 0 {
+		factor = 2
+	}
+
+	// calculate delay
+	delay := float64(min) * math.Pow(factor, float64(attempt))
+	if b.Jitter {
+		delay = rand.Float64()*(delay-float64(min)) + float64(min)
+	}
+
+	// cap delay
+	if delay >= float64(max) {
+		return max
+	} else if delay <= float64(min) {
+		return min
+	}
+
+	return time.Duration(delay)
+}
+
+// Attempt returns the number of attempts since the last reset.
+func (b *Backoff) Attempt() int {
+	// acquire mutex
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.attempt
+}
+
+// Reset will reset the attempt counter.
+func (b *Backoff) Reset() {
+	// acquire mutex
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.attempt = 0
+}
+
+// Wait will sleep for the delay of the next attempt. It returns the error of
+// the context if it is canceled in the meantime.
+func (b *Backoff) Wait(ctx context.Context) error {
+	// prepare timer
+	timer := time.NewTimer(b.Duration())
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Retry will call the function until it succeeds while waiting between
+// attempts as defined by the backoff. It returns the last error of the
+// function if the context is canceled before the function succeeded.
+func Retry(ctx context.Context, backoff *Backoff, fn func() error) error {
+	for {
+		// call function
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		// wait for next attempt
+		if backoff.Wait(ctx) != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	backoff := NewExponentialBackoff(time.Second, 10*time.Second)
+	assert.Equal(t, time.Second, backoff.Duration())
+	assert.Equal(t, 2*time.Second, backoff.Duration())
+	assert.Equal(t, 4*time.Second, backoff.Duration())
+	assert.Equal(t, 8*time.Second, backoff.Duration())
+	assert.Equal(t, 10*time.Second, backoff.Duration())
+	assert.Equal(t, 10*time.Second, backoff.Duration())
+	assert.Equal(t, 6, backoff.Attempt())
+
+	backoff.Reset()
+	assert.Equal(t, 0, backoff.Attempt())
+	assert.Equal(t, time.Second, backoff.Duration())
+
+	// large attempts
+	assert.Equal(t, 10*time.Second, backoff.ForAttempt(1000))
+}
+
+func TestBackoffDefaults(t *testing.T) {
+	backoff := &Backoff{}
+	assert.Equal(t, 100*time.Millisecond, backoff.ForAttempt(0))
+	assert.Equal(t, 200*time.Millisecond, backoff.ForAttempt(1))
+	assert.Equal(t, 10*time.Second, backoff.ForAttempt(100))
+}
+
+func TestBackoffConstant(t *testing.T) {
+	backoff := NewConstantBackoff(time.Second)
+	assert.Equal(t, time.Second, backoff.Duration())
+	assert.Equal(t, time.Second, backoff.Duration())
+	assert.Equal(t, time.Second, backoff.ForAttempt(100))
+}
+
+func TestBackoffJitter(t *testing.T) {
+	backoff := NewExponentialBackoff(time.Second, 10*time.Second)
+	backoff.Jitter = true
+
+	for i := 0; i < 100; i++ {
+		d := backoff.ForAttempt(2)
+		assert.True(t, d >= time.Second)
+		assert.True(t, d <= 4*time.Second)
+	}
+}
+
+func TestBackoffWait(t *testing.T) {
+	backoff := NewConstantBackoff(time.Millisecond)
+	assert.NoError(t, backoff.Wait(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	backoff = NewConstantBackoff(time.Hour)
+	assert.Equal(t, context.Canceled, backoff.Wait(ctx))
+}
+
+func TestRetry(t *testing.T) {
+	backoff := NewConstantBackoff(time.Millisecond)
+
+	calls := 0
+	err := Retry(context.Background(), backoff, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("foo")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 2, backoff.Attempt())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err = Retry(ctx, backoff, func() error {
+		return errors.New("foo")
+	})
+	assert.Equal(t, "foo", err.Error())
+}
@@ -0,0 +1,138 @@
+// Package capture implements a reader for raw MQTT byte streams that have been
+// extracted from packet captures or tee'd connections.
+package capture
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// Direction describes the direction of a captured stream.
+type Direction int
+
+const (
+	// ClientToBroker is a stream sent by the client.
+	ClientToBroker Direction = iota
+
+	// BrokerToClient is a stream sent by the broker.
+	BrokerToClient
+)
+
+// String returns the direction as a string.
+func (d Direction) String() string {
+	switch d {
+	case ClientToBroker:
+		return "client->broker"
+	case BrokerToClient:
+		return "broker->client"
+	}
+
+	return "unknown"
+}
+
+// A Record is a single packet read from a captured stream.
+type Record struct {
+	// The offset of the packet in the stream.
+	Offset int64
+
+	// The length of the encoded packet.
+	Length int64
+
+	// The direction of the stream.
+	Direction Direction
+
+	// The decoded packet, nil if Err is set.
+	Packet packet.Generic
+
+	// The error if the packet could not be decoded.
+	Err error
+
+	// The protocol violations that have been tolerated.
+	Warnings []*packet.Error
+}
+
+// String returns a string representation of the record.
+func (r *Record) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("%08d %s error: %s", r.Offset, r.Direction, r.Err)
+	}
+
+	return fmt.Sprintf("%08d %s %s", r.Offset, r.Direction, r.Packet.String())
+}
+
+// A Reader reads packets from a captured stream. Protocol violations are
+// tolerated where possible to simplify debugging misbehaving peers.
+type Reader struct {
+	direction Direction
+	decoder   *packet.Decoder
+	warnings  []*packet.Error
+}
+
+// NewReader returns a new reader for the specified stream and direction.
+func NewReader(stream io.Reader, direction Direction) *Reader {
+	// create reader
+	r := &Reader{
+		direction: direction,
+		decoder:   packet.NewDecoder(stream),
+	}
+
+	// configure decoder
+	r.decoder.Mode = packet.Lenient
+	r.decoder.Warning = func(err *packet.Error) {
+		r.warnings = append(r.warnings, err)
+	}
+
+	return r
+}
+
+// Next returns the next record from the stream. Packets that could be framed
+// but not decoded are returned as records with an error. Framing errors end
+// the stream and are returned directly, like io.EOF at the end of the stream.
+func (r *Reader) Next() (*Record, error) {
+	// get offset
+	offset := r.decoder.Offset()
+
+	// read packet
+	r.warnings = nil
+	pkt, err := r.decoder.Read()
+
+	// get length
+	length := r.decoder.Offset() - offset
+
+	// return framing errors
+	if err != nil && length == 0 {
+		return nil, err
+	}
+
+	return &Record{
+		Offset:    offset,
+		Length:    length,
+		Direction: r.direction,
+		Packet:    pkt,
+		Err:       err,
+		Warnings:  r.warnings,
+	}, nil
+}
+
+// ReadAll reads all records from the stream until the end of the stream or
+// a framing error. The records read so far are returned with the error. An
+// error is not returned at the end of the stream.
+func ReadAll(stream io.Reader, direction Direction) ([]*Record, error) {
+	// create reader
+	reader := NewReader(stream, direction)
+
+	// read records
+	var records []*Record
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return records, err
+		}
+
+		records = append(records, record)
+	}
+}
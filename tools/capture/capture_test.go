@@ -0,0 +1,86 @@
+package capture
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encode(pkt packet.Generic) []byte {
+	buf := make([]byte, pkt.Len())
+
+	_, err := pkt.Encode(buf)
+	if err != nil {
+		panic(err)
+	}
+
+	return buf
+}
+
+func TestReadAll(t *testing.T) {
+	connect := packet.NewConnect()
+	connect.ClientID = "foo"
+
+	publish := packet.NewPublish()
+	publish.Message.Topic = "foo"
+	publish.Message.Payload = []byte("bar")
+
+	pingreq := encode(packet.NewPingreq())
+	pingreq[0] |= 0x01
+
+	invalid := []byte{0x40, 2, 0, 0}
+
+	var stream []byte
+	stream = append(stream, encode(connect)...)
+	stream = append(stream, encode(publish)...)
+	stream = append(stream, pingreq...)
+	stream = append(stream, invalid...)
+	stream = append(stream, encode(packet.NewDisconnect())...)
+
+	records, err := ReadAll(bytes.NewReader(stream), ClientToBroker)
+	assert.NoError(t, err)
+	assert.Len(t, records, 5)
+
+	assert.Equal(t, int64(0), records[0].Offset)
+	assert.Equal(t, int64(connect.Len()), records[0].Length)
+	assert.Equal(t, ClientToBroker, records[0].Direction)
+	assert.Equal(t, connect, records[0].Packet)
+	assert.NoError(t, records[0].Err)
+
+	assert.Equal(t, int64(connect.Len()), records[1].Offset)
+	assert.Equal(t, publish, records[1].Packet)
+
+	assert.Equal(t, packet.PINGREQ, records[2].Packet.Type())
+	assert.Len(t, records[2].Warnings, 1)
+
+	assert.Nil(t, records[3].Packet)
+	assert.Error(t, records[3].Err)
+	assert.Equal(t, int64(4), records[3].Length)
+
+	assert.Equal(t, int64(len(stream)-2), records[4].Offset)
+	assert.Equal(t, packet.DISCONNECT, records[4].Packet.Type())
+	assert.Equal(t, "00000033 client->broker <Disconnect>", records[4].String())
+}
+
+func TestReaderFramingError(t *testing.T) {
+	stream := append(encode(packet.NewPingresp()), 0xf0, 0)
+
+	reader := NewReader(bytes.NewReader(stream), BrokerToClient)
+
+	record, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, packet.PINGRESP, record.Packet.Type())
+	assert.Equal(t, BrokerToClient, record.Direction)
+
+	record, err = reader.Next()
+	assert.Nil(t, record)
+	assert.Error(t, err)
+
+	records, err := ReadAll(bytes.NewReader(stream[:3]), BrokerToClient)
+	assert.Len(t, records, 1)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
@@ -0,0 +1,107 @@
+package tools
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// A Dispatcher runs functions concurrently on a bounded number of workers.
+// Functions dispatched with the same key, e.g. a topic or client ID, are
+// always run by the same worker and thus in the order they were dispatched.
+type Dispatcher struct {
+	queues []chan func()
+	shared chan func()
+	group  sync.WaitGroup
+	once   sync.Once
+}
+
+// NewDispatcher returns a new dispatcher that runs the specified number of
+// workers that each queue up to size functions.
+func NewDispatcher(workers, size int) *Dispatcher {
+	// check workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	// check size
+	if size < 0 {
+		size = 0
+	}
+
+	// prepare dispatcher
+	d := &Dispatcher{
+		queues: make([]chan func(), workers),
+		shared: make(chan func(), size),
+	}
+
+	// run workers
+	for i := range d.queues {
+		d.queues[i] = make(chan func(), size)
+		d.group.Add(1)
+		go d.worker(d.queues[i])
+	}
+
+	return d
+}
+
+// Dispatch will queue the function on the worker that is responsible for the
+// key. It blocks if the queue of the worker is full.
+func (d *Dispatcher) Dispatch(key string, fn func()) {
+	d.queues[d.index(key)] <- fn
+}
+
+// Submit will queue the function to be run by the next available worker. It
+// blocks if the shared queue is full. Submitted functions are not ordered.
+func (d *Dispatcher) Submit(fn func()) {
+	d.shared <- fn
+}
+
+// Close will stop the workers after all queued functions have been run and
+// wait until they have returned. Dispatch and Submit must not be called
+// afterwards.
+func (d *Dispatcher) Close() {
+	d.once.Do(func() {
+		for _, queue := range d.queues {
+			close(queue)
+		}
+		close(d.shared)
+	})
+
+	d.group.Wait()
+}
+
+func (d *Dispatcher) index(key string) int {
+	// check workers
+	if len(d.queues) == 1 {
+		return 0
+	}
+
+	// hash key
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+
+	return int(hash.Sum32() % uint32(len(d.queues)))
+}
+
+func (d *Dispatcher) worker(queue chan func()) {
+	defer d.group.Done()
+
+	// run functions until both queues are closed and drained
+	shared := d.shared
+	for queue != nil || shared != nil {
+		select {
+		case fn, ok := <-queue:
+			if !ok {
+				queue = nil
+				continue
+			}
+			fn()
+		case fn, ok := <-shared:
+			if !ok {
+				shared = nil
+				continue
+			}
+			fn()
+		}
+	}
+}
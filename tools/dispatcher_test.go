@@ -0,0 +1,110 @@
+package tools
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatcherOrdering(t *testing.T) {
+	d := NewDispatcher(4, 8)
+
+	var mutex sync.Mutex
+	results := map[string][]int{}
+
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i % 10)
+		value := i
+		d.Dispatch(key, func() {
+			mutex.Lock()
+			results[key] = append(results[key], value)
+			mutex.Unlock()
+		})
+	}
+
+	d.Close()
+
+	assert.Len(t, results, 10)
+	for key, values := range results {
+		k, _ := strconv.Atoi(key)
+		assert.Len(t, values, 10)
+		for i, value := range values {
+			assert.Equal(t, k+i*10, value)
+		}
+	}
+}
+
+func TestDispatcherConcurrency(t *testing.T) {
+	d := NewDispatcher(2, 0)
+
+	key := "b"
+	for d.index(key) == d.index("a") {
+		key += "b"
+	}
+
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+
+	for _, k := range []string{"a", key} {
+		d.Dispatch(k, func() {
+			started <- struct{}{}
+			<-release
+		})
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("worker not started")
+		}
+	}
+
+	close(release)
+	d.Close()
+}
+
+func TestDispatcherSubmit(t *testing.T) {
+	d := NewDispatcher(2, 1)
+
+	second := make(chan struct{})
+	var count int32
+
+	d.Submit(func() {
+		<-second
+		atomic.AddInt32(&count, 1)
+	})
+
+	d.Submit(func() {
+		close(second)
+		atomic.AddInt32(&count, 1)
+	})
+
+	d.Dispatch("a", func() {
+		atomic.AddInt32(&count, 1)
+	})
+
+	d.Close()
+
+	assert.Equal(t, int32(3), count)
+}
+
+func TestDispatcherClose(t *testing.T) {
+	d := NewDispatcher(0, -1)
+
+	var count int32
+	for i := 0; i < 10; i++ {
+		d.Dispatch("a", func() {
+			atomic.AddInt32(&count, 1)
+		})
+	}
+
+	d.Close()
+	d.Close()
+
+	assert.Equal(t, int32(10), count)
+}
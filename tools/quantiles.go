@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"sync"
+
+	"github.com/beorn7/perks/quantile"
+)
+
+// DefaultQuantiles are the quantiles and allowed errors used if none are
+// specified.
+var DefaultQuantiles = map[float64]float64{
+	0.50: 0.005,
+	0.90: 0.001,
+	0.99: 0.0001,
+}
+
+// Quantiles estimates quantiles of a stream of values using a bounded amount
+// of memory.
+type Quantiles struct {
+	stream *quantile.Stream
+	mutex  sync.Mutex
+}
+
+// NewQuantiles returns a new estimator for the specified quantiles mapped to
+// their allowed error. DefaultQuantiles are used if targets is nil.
+func NewQuantiles(targets map[float64]float64) *Quantiles {
+	// set default targets
+	if targets == nil {
+		targets = DefaultQuantiles
+	}
+
+	return &Quantiles{
+		stream: quantile.NewTargeted(targets),
+	}
+}
+
+// Insert will add the specified value.
+func (q *Quantiles) Insert(value float64) {
+	// acquire mutex
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.stream.Insert(value)
+}
+
+// Query returns the estimated value of the specified quantile.
+func (q *Quantiles) Query(quantile float64) float64 {
+	// acquire mutex
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.stream.Query(quantile)
+}
+
+// Count returns the number of inserted values.
+func (q *Quantiles) Count() int {
+	// acquire mutex
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.stream.Count()
+}
+
+// Reset will remove all inserted values.
+func (q *Quantiles) Reset() {
+	// acquire mutex
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.stream.Reset()
+}
@@ -0,0 +1,23 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuantiles(t *testing.T) {
+	q := NewQuantiles(nil)
+
+	for i := 1; i <= 1000; i++ {
+		q.Insert(float64(i))
+	}
+
+	assert.Equal(t, 1000, q.Count())
+	assert.InDelta(t, 500, q.Query(0.50), 10)
+	assert.InDelta(t, 900, q.Query(0.90), 5)
+	assert.InDelta(t, 990, q.Query(0.99), 1)
+
+	q.Reset()
+	assert.Equal(t, 0, q.Count())
+}
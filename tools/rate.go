@@ -0,0 +1,102 @@
+// Package tools implements statistics, concurrency and retry helpers that are
+// shared by the broker, the client and the command line tools.
+package tools
+
+import (
+	"sync"
+	"time"
+)
+
+// A Rate counts events in a sliding window and reports their rate. The window
+// is divided into buckets that are discarded once they leave the window.
+type Rate struct {
+	window  time.Duration
+	bucket  time.Duration
+	buckets []int64
+	current int
+	start   time.Time
+	total   int64
+	mutex   sync.Mutex
+}
+
+// NewRate returns a new rate that uses the specified window and number of
+// buckets.
+func NewRate(window time.Duration, buckets int) *Rate {
+	// check buckets
+	if buckets <= 0 {
+		buckets = 1
+	}
+
+	return &Rate{
+		window:  window,
+		bucket:  window / time.Duration(buckets),
+		buckets: make([]int64, buckets),
+		start:   time.Now(),
+	}
+}
+
+// Add will count the specified number of events.
+func (r *Rate) Add(n int64) {
+	r.add(time.Now(), n)
+}
+
+// Rate returns the number of events per second in the window.
+func (r *Rate) Rate() float64 {
+	return r.rate(time.Now())
+}
+
+// Total returns the number of events counted since the rate was created.
+func (r *Rate) Total() int64 {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.total
+}
+
+func (r *Rate) add(now time.Time, n int64) {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// advance window
+	r.advance(now)
+
+	// count events
+	r.buckets[r.current] += n
+	r.total += n
+}
+
+func (r *Rate) rate(now time.Time) float64 {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// advance window
+	r.advance(now)
+
+	// sum buckets
+	var sum int64
+	for _, count := range r.buckets {
+		sum += count
+	}
+
+	return float64(sum) / r.window.Seconds()
+}
+
+func (r *Rate) advance(now time.Time) {
+	// get number of elapsed buckets
+	elapsed := int(now.Sub(r.start) / r.bucket)
+	if elapsed <= 0 {
+		return
+	}
+
+	// clear elapsed buckets
+	for i := 0; i < elapsed && i < len(r.buckets); i++ {
+		r.current = (r.current + 1) % len(r.buckets)
+		r.buckets[r.current] = 0
+	}
+
+	// move start
+	r.start = r.start.Add(time.Duration(elapsed) * r.bucket)
+}
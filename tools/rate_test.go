@@ -0,0 +1,53 @@
+package tools
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRate(t *testing.T) {
+	rate := NewRate(time.Second, 10)
+	now := rate.start
+
+	rate.add(now, 5)
+	rate.add(now.Add(500*time.Millisecond), 5)
+	assert.Equal(t, 10.0, rate.rate(now.Add(900*time.Millisecond)))
+	assert.Equal(t, int64(10), rate.Total())
+
+	// first bucket leaves the window
+	assert.Equal(t, 5.0, rate.rate(now.Add(1100*time.Millisecond)))
+
+	// all buckets leave the window
+	assert.Equal(t, 0.0, rate.rate(now.Add(5*time.Second)))
+	assert.Equal(t, int64(10), rate.Total())
+
+	// larger window
+	rate = NewRate(10*time.Second, 10)
+	now = rate.start
+
+	rate.add(now, 50)
+	assert.Equal(t, 5.0, rate.rate(now))
+}
+
+func TestRateConcurrency(t *testing.T) {
+	rate := NewRate(time.Minute, 60)
+
+	done := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		go func() {
+			for j := 0; j < 100; j++ {
+				rate.Add(1)
+			}
+			done <- struct{}{}
+		}()
+	}
+
+	for i := 0; i < 10; i++ {
+		<-done
+	}
+
+	assert.Equal(t, int64(1000), rate.Total())
+	assert.Equal(t, 1000.0/60, rate.Rate())
+}
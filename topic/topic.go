@@ -5,6 +5,7 @@ import (
 	"errors"
 	"regexp"
 	"strings"
+	"unicode/utf8"
 )
 
 // ErrZeroLength is returned by Parse if a topics has a zero length.
@@ -63,8 +64,121 @@ func Parse(topic string, allowWildcards bool) (string, error) {
 	return topic, nil
 }
 
+// ValidName tests if the supplied topic is a valid topic name that can be used
+// to publish a message. Topic names must not be empty and must not contain
+// wildcards. Unlike Parse, the topic is not normalized and empty levels are
+// allowed as required by the spec.
+func ValidName(topic string) bool {
+	// check string
+	if !validString(topic) {
+		return false
+	}
+
+	return !ContainsWildcards(topic)
+}
+
+// ValidFilter tests if the supplied topic is a valid filter that can be used to
+// subscribe. The multi level wildcard "#" may only be used as the last level
+// and the single level wildcard "+" must occupy an entire level. Shared
+// subscriptions in the form "$share/<group>/<filter>" are validated by
+// checking the group name and the contained filter.
+func ValidFilter(filter string) bool {
+	// check string
+	if !validString(filter) {
+		return false
+	}
+
+	// check shared subscriptions
+	if strings.HasPrefix(filter, "$share/") {
+		// split group and filter
+		parts := strings.SplitN(filter, "/", 3)
+		if len(parts) != 3 {
+			return false
+		}
+
+		// check group
+		if parts[1] == "" || ContainsWildcards(parts[1]) {
+			return false
+		}
+
+		filter = parts[2]
+
+		// check filter
+		if filter == "" {
+			return false
+		}
+	}
+
+	// check all segments
+	for {
+		// get segment
+		segment := topicSegment(filter, "/")
+
+		// check use of wildcards
+		if ContainsWildcards(segment) && len(segment) > 1 {
+			return false
+		}
+
+		// advance
+		filter = topicShorten(filter, "/")
+
+		// check if hash is the last level
+		if segment == "#" {
+			return filter == topicEnd
+		}
+
+		// check end
+		if filter == topicEnd {
+			return true
+		}
+	}
+}
+
+// validString tests if the topic is not empty, not too long and valid UTF-8
+// without null characters
+func validString(topic string) bool {
+	return topic != "" && len(topic) <= 65535 && utf8.ValidString(topic) && !strings.ContainsRune(topic, 0)
+}
+
 // ContainsWildcards tests if the supplied topic contains wildcards. The topics
 // is expected to be tested and normalized using Parse beforehand.
 func ContainsWildcards(topic string) bool {
 	return strings.Contains(topic, "+") || strings.Contains(topic, "#")
 }
+
+// Match tests if the supplied topic matches the supplied filter. Wildcards in
+// the first level of the filter do not match topics that begin with a "$" as
+// those are reserved for the broker.
+//
+// Note: The function compares the topic level by level against a single filter.
+// A Tree should be used to match a topic against a large set of filters.
+func Match(topic, filter string) bool {
+	// check reserved topics
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+
+	for {
+		// get filter segment
+		segment := topicSegment(filter, "/")
+
+		// multi level wildcards match the remainder and the parent level
+		if segment == "#" {
+			return true
+		}
+
+		// check if one has been fully consumed
+		if topic == topicEnd || filter == topicEnd {
+			return topic == filter
+		}
+
+		// compare segments
+		if segment != "+" && segment != topicSegment(topic, "/") {
+			return false
+		}
+
+		// advance
+		topic = topicShorten(topic, "/")
+		filter = topicShorten(filter, "/")
+	}
+}
@@ -98,3 +98,86 @@ func TestTopicContainsWildcards(t *testing.T) {
 	assert.True(t, ContainsWildcards("topic/#"))
 	assert.False(t, ContainsWildcards("topic/hello"))
 }
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		topic  string
+		filter string
+		match  bool
+	}{
+		{"foo/bar", "foo/bar", true},
+		{"foo/bar", "foo/baz", false},
+		{"foo/bar", "foo", false},
+		{"foo", "foo/bar", false},
+		{"foo/bar", "foo/+", true},
+		{"foo", "foo/+", false},
+		{"foo/bar/baz", "foo/+", false},
+		{"foo/bar/baz", "foo/+/baz", true},
+		{"foo/bar", "+/+", true},
+		{"/foo", "+/foo", true},
+		{"foo/bar", "foo/#", true},
+		{"foo/bar/baz", "foo/#", true},
+		{"foo", "foo/#", true},
+		{"foo", "foo/bar/#", false},
+		{"foo/bar", "#", true},
+		{"$SYS/broker", "#", false},
+		{"$SYS/broker", "+/broker", false},
+		{"$SYS/broker", "$SYS/#", true},
+		{"$SYS/broker", "$SYS/+", true},
+	}
+
+	for _, item := range tests {
+		assert.Equal(t, item.match, Match(item.topic, item.filter), item.topic+" "+item.filter)
+	}
+}
+
+func TestValidName(t *testing.T) {
+	tests := map[string]bool{
+		"":             false,
+		"foo":          true,
+		"foo/bar":      true,
+		"/foo//bar/":   true,
+		"$SYS/foo":     true,
+		"foo/+":        false,
+		"foo/#":        false,
+		"foo+":         false,
+		"foo\x00bar":   false,
+		"foo\xff":      false,
+		"$share/g/foo": true,
+	}
+
+	for str, result := range tests {
+		assert.Equal(t, result, ValidName(str), str)
+	}
+}
+
+func TestValidFilter(t *testing.T) {
+	tests := map[string]bool{
+		"":                 false,
+		"foo":              true,
+		"/foo//bar/":       true,
+		"#":                true,
+		"+":                true,
+		"foo/#":            true,
+		"foo/+/bar":        true,
+		"+/+/#":            true,
+		"foo/#/bar":        false,
+		"foo#":             false,
+		"foo/bar+":         false,
+		"foo/+bar/baz":     false,
+		"foo\x00":          false,
+		"foo\xff":          false,
+		"$share/group/foo": true,
+		"$share/group/#":   true,
+		"$share/group/+/a": true,
+		"$share/group/":    false,
+		"$share/group":     false,
+		"$share//foo":      false,
+		"$share/g+/foo":    false,
+		"$share/g/foo/#/a": false,
+	}
+
+	for str, result := range tests {
+		assert.Equal(t, result, ValidFilter(str), str)
+	}
+}
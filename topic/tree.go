@@ -246,7 +246,8 @@ func (t *Tree) clear(value interface{}, node *node) bool {
 }
 
 // Match will return a set of values from topics that match the supplied topic.
-// The result set will be cleared from duplicate values.
+// The result set will be cleared from duplicate values. Stored wildcards on the
+// first level will not match topics that begin with a "$".
 //
 // Note: In contrast to Search, Match does not respect wildcards in the query but
 // in the stored tree.
@@ -279,9 +280,30 @@ func (t *Tree) MatchFirst(topic string) interface{} {
 	return value
 }
 
+// MatchCount behaves similar to Match but only returns the number of distinct
+// values. The values must therefore be comparable.
+func (t *Tree) MatchCount(topic string) int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	// count distinct values
+	set := make(map[interface{}]struct{})
+	t.match(topic, t.root, func(values []interface{}) bool {
+		for _, value := range values {
+			set[value] = struct{}{}
+		}
+		return true
+	})
+
+	return len(set)
+}
+
 func (t *Tree) match(topic string, node *node, fn func([]interface{}) bool) {
+	// wildcards on the first level do not match reserved topics
+	wildcards := node != t.root || !strings.HasPrefix(topic, "$")
+
 	// add all values to the result set that match multiple levels
-	if child, ok := node.children[t.WildcardSome]; ok && len(child.values) > 0 {
+	if child, ok := node.children[t.WildcardSome]; ok && wildcards && len(child.values) > 0 {
 		if !fn(child.values) {
 			return
 		}
@@ -297,7 +319,7 @@ func (t *Tree) match(topic string, node *node, fn func([]interface{}) bool) {
 	}
 
 	// advance children that match a single level
-	if child, ok := node.children[t.WildcardOne]; ok {
+	if child, ok := node.children[t.WildcardOne]; ok && wildcards {
 		t.match(topicShorten(topic, t.Separator), child, fn)
 	}
 
@@ -313,7 +335,8 @@ func (t *Tree) match(topic string, node *node, fn func([]interface{}) bool) {
 }
 
 // Search will return a set of values from topics that match the supplied topic.
-// The result set will be cleared from duplicate values.
+// The result set will be cleared from duplicate values. Wildcards on the first
+// level of the query will not match stored topics that begin with a "$".
 //
 // Note: In contrast to Match, Search respects wildcards in the query but not in
 // the stored tree.
@@ -367,7 +390,11 @@ func (t *Tree) search(topic string, node *node, fn func([]interface{}) bool) {
 			}
 		}
 
-		for _, child := range node.children {
+		for key, child := range node.children {
+			if t.reserved(node, key) {
+				continue
+			}
+
 			t.search(topic, child, fn)
 		}
 	}
@@ -380,7 +407,11 @@ func (t *Tree) search(topic string, node *node, fn func([]interface{}) bool) {
 			}
 		}
 
-		for _, child := range node.children {
+		for key, child := range node.children {
+			if t.reserved(node, key) {
+				continue
+			}
+
 			t.search(topicShorten(topic, t.Separator), child, fn)
 		}
 	}
@@ -393,6 +424,12 @@ func (t *Tree) search(topic string, node *node, fn func([]interface{}) bool) {
 	}
 }
 
+// reserved returns whether the child of the supplied node is a reserved first
+// level segment that must not be matched by wildcards.
+func (t *Tree) reserved(node *node, segment string) bool {
+	return node == t.root && strings.HasPrefix(segment, "$")
+}
+
 // clean will remove duplicates
 func (t *Tree) clean(values []interface{}) []interface{} {
 	result := values[:0]
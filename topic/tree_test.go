@@ -135,6 +135,18 @@ func TestTreeMatchWildcard5(t *testing.T) {
 	assert.Equal(t, 1, tree.Match("foo/bar/#")[0])
 }
 
+func TestTreeMatchReserved(t *testing.T) {
+	tree := NewTree()
+
+	tree.Add("#", 1)
+	tree.Add("+/broker", 2)
+	tree.Add("$SYS/#", 3)
+	tree.Add("$SYS/+", 4)
+
+	assert.Equal(t, []interface{}{3, 4}, tree.Match("$SYS/broker"))
+	assert.Equal(t, []interface{}{1, 2}, tree.Match("foo/broker"))
+}
+
 func TestTreeMatchMultiple(t *testing.T) {
 	tree := NewTree()
 
@@ -171,6 +183,19 @@ func TestTreeMatchFirstNone(t *testing.T) {
 	assert.Nil(t, tree.MatchFirst("baz/qux"))
 }
 
+func TestTreeMatchCount(t *testing.T) {
+	tree := NewTree()
+
+	tree.Add("foo/+", 1)
+	tree.Add("foo/#", 1)
+	tree.Add("foo/bar", 2)
+	tree.Add("#", 3)
+
+	assert.Equal(t, 3, tree.MatchCount("foo/bar"))
+	assert.Equal(t, 2, tree.MatchCount("foo/baz"))
+	assert.Equal(t, 0, tree.MatchCount("$foo/bar"))
+}
+
 func TestTreeSearchExact(t *testing.T) {
 	tree := NewTree()
 
@@ -219,6 +244,18 @@ func TestTreeSearchWildcard5(t *testing.T) {
 	assert.Equal(t, 1, tree.Search("foo/#")[0])
 }
 
+func TestTreeSearchReserved(t *testing.T) {
+	tree := NewTree()
+
+	tree.Add("$SYS/broker", 1)
+	tree.Add("foo/broker", 2)
+
+	assert.Equal(t, []interface{}{2}, tree.Search("#"))
+	assert.Equal(t, []interface{}{2}, tree.Search("+/broker"))
+	assert.Equal(t, []interface{}{1}, tree.Search("$SYS/#"))
+	assert.Equal(t, []interface{}{1}, tree.Search("$SYS/+"))
+}
+
 func TestTreeSearchMultiple(t *testing.T) {
 	tree := NewTree()
 
@@ -431,3 +468,35 @@ func BenchmarkTreeSearchWildcardSome(b *testing.B) {
 		tree.Search("#")
 	}
 }
+
+func BenchmarkTreeMatchMany(b *testing.B) {
+	tree := NewTree()
+
+	for i := 0; i < 1000; i++ {
+		tree.Add(fmt.Sprintf("foo/%d/+", i), i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree.Match("foo/500/bar")
+	}
+}
+
+func BenchmarkLinearMatchMany(b *testing.B) {
+	filters := make([]string, 0, 1000)
+
+	for i := 0; i < 1000; i++ {
+		filters = append(filters, fmt.Sprintf("foo/%d/+", i))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, filter := range filters {
+			Match("foo/500/bar", filter)
+		}
+	}
+}
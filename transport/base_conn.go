@@ -1,6 +1,7 @@
 package transport
 
 import (
+	"errors"
 	"io"
 	"sync"
 	"time"
@@ -8,11 +9,28 @@ import (
 	"github.com/256dpi/gomqtt/packet"
 )
 
+// ErrSendQueueFull is returned by BufferedSend if the send queue of the
+// connection is full.
+var ErrSendQueueFull = errors.New("send queue full")
+
+// ErrSendQueueClosed is returned by BufferedSend if the connection has been
+// closed.
+var ErrSendQueueClosed = errors.New("send queue closed")
+
+// DefaultSendQueueSize is the default size of the send queue that is used by
+// BufferedSend.
+const DefaultSendQueueSize = 100
+
+// CloseTimeout is the maximum time Close waits for buffered and queued packets
+// to be written before the underlying connection is closed forcefully.
+const CloseTimeout = time.Second
+
 // A Carrier is a generalized stream that can be used with BaseConn.
 type Carrier interface {
 	io.ReadWriteCloser
 
 	SetReadDeadline(time.Time) error
+	SetWriteDeadline(time.Time) error
 }
 
 // A BaseConn manages the low-level plumbing between the Carrier and the packet
@@ -25,7 +43,16 @@ type BaseConn struct {
 	sMutex sync.Mutex
 	rMutex sync.Mutex
 
-	readTimeout time.Duration
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	queue     chan packet.Generic
+	queueSize int
+	qErr      error
+	qClosed   bool
+	qClosing  chan struct{}
+	qDone     chan struct{}
+	qMutex    sync.Mutex
 }
 
 // NewBaseConn creates a new BaseConn using the specified Carrier.
@@ -46,8 +73,15 @@ func (c *BaseConn) Send(pkt packet.Generic, async bool) error {
 	c.sMutex.Lock()
 	defer c.sMutex.Unlock()
 
+	// set write deadline
+	err := c.setWriteDeadline()
+	if err != nil {
+		_ = c.carrier.Close()
+		return err
+	}
+
 	// write packet
-	err := c.stream.Write(pkt, async)
+	err = c.stream.Write(pkt, async)
 	if err != nil {
 		// ensure connection gets closed
 		_ = c.carrier.Close()
@@ -58,6 +92,96 @@ func (c *BaseConn) Send(pkt packet.Generic, async bool) error {
 	return nil
 }
 
+// BufferedSend will add the packet to the send queue of the connection and
+// return immediately. The queued packets are sent in order by a separate
+// goroutine, which coalesces packets that are queued in quick succession into
+// fewer writes. If the queue is full, ErrSendQueueFull is returned and the
+// packet is not sent, which allows the caller to apply backpressure or drop
+// the packet. Network errors are returned by the following calls.
+//
+// Note: The packet must not be modified after it has been queued. Packets sent
+// using Send may overtake queued packets.
+func (c *BaseConn) BufferedSend(pkt packet.Generic) error {
+	c.qMutex.Lock()
+	defer c.qMutex.Unlock()
+
+	// check state
+	if c.qErr != nil {
+		return c.qErr
+	} else if c.qClosed {
+		return ErrSendQueueClosed
+	}
+
+	// start writer if missing
+	if c.queue == nil {
+		size := c.queueSize
+		if size <= 0 {
+			size = DefaultSendQueueSize
+		}
+
+		c.queue = make(chan packet.Generic, size)
+		c.qClosing = make(chan struct{})
+		c.qDone = make(chan struct{})
+
+		go c.writer()
+	}
+
+	// queue packet
+	select {
+	case c.queue <- pkt:
+		return nil
+	default:
+		return ErrSendQueueFull
+	}
+}
+
+// SetSendQueueSize sets the number of packets that can be queued using
+// BufferedSend. It must be called before the first packet is queued.
+//
+// Will default to DefaultSendQueueSize.
+func (c *BaseConn) SetSendQueueSize(size int) {
+	c.qMutex.Lock()
+	c.queueSize = size
+	c.qMutex.Unlock()
+}
+
+func (c *BaseConn) writer() {
+	// signal exit
+	defer close(c.qDone)
+
+	for {
+		select {
+		case pkt := <-c.queue:
+			// flush once the queue is empty
+			err := c.Send(pkt, len(c.queue) > 0)
+			if err != nil {
+				c.fail(err)
+				return
+			}
+		case <-c.qClosing:
+			// send remaining packets, Close will flush the buffer
+			for {
+				select {
+				case pkt := <-c.queue:
+					err := c.Send(pkt, true)
+					if err != nil {
+						c.fail(err)
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (c *BaseConn) fail(err error) {
+	c.qMutex.Lock()
+	c.qErr = err
+	c.qMutex.Unlock()
+}
+
 // Receive will read from the underlying connection and return a fully read
 // packet. It will return an Error if there was an error while decoding or
 // reading from the underlying connection.
@@ -76,10 +200,11 @@ func (c *BaseConn) Receive() (packet.Generic, error) {
 		return nil, err
 	}
 
-	// reset timeout
+	// reset timeout, the packet is still returned if the connection has been
+	// closed by the peer in the meantime as the next read will fail anyway
 	err = c.resetTimeout()
 	if err != nil {
-		return nil, err
+		_ = c.carrier.Close()
 	}
 
 	return pkt, nil
@@ -87,11 +212,33 @@ func (c *BaseConn) Receive() (packet.Generic, error) {
 
 // Close will close the underlying connection and cleanup resources. It will
 // return an Error if there was an error while closing the underlying
-// connection.
+// connection. Buffered and queued packets are written before the connection is
+// closed, but Close waits at most CloseTimeout for them to be written.
 func (c *BaseConn) Close() error {
+	// close queue
+	c.qMutex.Lock()
+	started := c.queue != nil && !c.qClosed
+	c.qClosed = true
+	c.qMutex.Unlock()
+
+	// abort pending writes if they do not finish in time
+	timer := time.AfterFunc(CloseTimeout, func() {
+		_ = c.carrier.Close()
+	})
+	defer timer.Stop()
+
+	// wait for writer
+	if started {
+		close(c.qClosing)
+		<-c.qDone
+	}
+
 	c.sMutex.Lock()
 	defer c.sMutex.Unlock()
 
+	// set write deadline
+	_ = c.setWriteDeadline()
+
 	// flush buffer
 	err1 := c.stream.Flush()
 
@@ -108,6 +255,49 @@ func (c *BaseConn) Close() error {
 	return nil
 }
 
+// Flush will immediately write all packets that have been buffered by
+// asynchronous sends to the underlying connection. It will return an Error if
+// there was an error while flushing the buffer or any previous asynchronous
+// flush.
+func (c *BaseConn) Flush() error {
+	c.sMutex.Lock()
+	defer c.sMutex.Unlock()
+
+	// set write deadline
+	err := c.setWriteDeadline()
+	if err != nil {
+		_ = c.carrier.Close()
+		return err
+	}
+
+	// flush buffer
+	err = c.stream.Flush()
+	if err != nil {
+		// ensure connection gets closed
+		_ = c.carrier.Close()
+
+		return err
+	}
+
+	return nil
+}
+
+// SetMaxWriteDelay sets the maximum time asynchronously sent packets are
+// buffered before they are flushed to the underlying connection. Packets are
+// also flushed once the write buffer is full, see SetBufferSizes. A larger
+// delay coalesces more small packets into one write, which improves the
+// throughput of high-rate streams at the expense of latency.
+func (c *BaseConn) SetMaxWriteDelay(delay time.Duration) {
+	c.sMutex.Lock()
+	defer c.sMutex.Unlock()
+
+	// set delay
+	err := c.stream.Encoder.SetMaxWriteDelay(delay)
+	if err != nil {
+		_ = c.carrier.Close()
+	}
+}
+
 // SetReadLimit sets the maximum size of a packet that can be received.
 // If the limit is greater than zero, Receive will close the connection and
 // return an Error if receiving the next packet will exceed the limit.
@@ -115,6 +305,15 @@ func (c *BaseConn) SetReadLimit(limit int64) {
 	c.stream.Decoder.Limit = limit
 }
 
+// EnableChecksums will append a CRC-32 trailer to sent packets and verify the
+// trailer of received packets. Both ends of the connection must enable
+// checksums before the first packet is exchanged. Receive returns an error if
+// a corrupted packet is received. See packet.Encoder for details.
+func (c *BaseConn) EnableChecksums() {
+	c.stream.Encoder.Checksum = true
+	c.stream.Decoder.Checksum = true
+}
+
 // SetReadTimeout sets the maximum time that can pass between reads.
 // If no data is received in the set duration the connection will be closed
 // and Read returns an error.
@@ -125,6 +324,53 @@ func (c *BaseConn) SetReadTimeout(timeout time.Duration) {
 	_ = c.resetTimeout()
 }
 
+// SetWriteTimeout sets the maximum time that writing a packet to the
+// underlying connection may take. If a peer stops reading and the write does
+// not complete in the set duration, the connection will be closed and Send
+// returns an error. Asynchronously flushed packets are subject to the same
+// deadline, the timeout should therefore be much larger than the maximum write
+// delay.
+func (c *BaseConn) SetWriteTimeout(timeout time.Duration) {
+	c.sMutex.Lock()
+	defer c.sMutex.Unlock()
+
+	c.writeTimeout = timeout
+
+	// clear deadline if disabled
+	if timeout <= 0 {
+		_ = c.carrier.SetWriteDeadline(time.Time{})
+	}
+}
+
+// SetBufferSizes sets the size of the read and write buffer that are
+// allocated for the connection. A size of zero restores the default size of
+// 4096 bytes. Smaller buffers reduce the memory usage of idle connections
+// while larger buffers reduce the number of system calls for large packets.
+//
+// Note: The read buffer size must not be changed while a Receive is pending.
+func (c *BaseConn) SetBufferSizes(read, write int) {
+	// set read buffer size
+	c.stream.Decoder.SetBufferSize(read)
+
+	// acquire mutex
+	c.sMutex.Lock()
+	defer c.sMutex.Unlock()
+
+	// set write buffer size
+	err := c.stream.Encoder.SetBufferSize(write)
+	if err != nil {
+		_ = c.carrier.Close()
+	}
+}
+
+func (c *BaseConn) setWriteDeadline() error {
+	if c.writeTimeout > 0 {
+		return c.carrier.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+
+	return nil
+}
+
 func (c *BaseConn) resetTimeout() error {
 	if c.readTimeout > 0 {
 		return c.carrier.SetReadDeadline(time.Now().Add(c.readTimeout))
@@ -0,0 +1,265 @@
+//go:build js && wasm
+// +build js,wasm
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+// ErrBrowserConnection is returned if the browser failed to open or maintain a
+// WebSocket connection. Browsers do not expose the reason of such failures.
+var ErrBrowserConnection = errors.New("browser web socket connection failed")
+
+// ErrBrowserReadTimeout is returned if no data has been received before the
+// read deadline of a BrowserConn.
+var ErrBrowserReadTimeout = errors.New("browser web socket read timeout")
+
+type browserAddr string
+
+func (a browserAddr) Network() string {
+	return "websocket"
+}
+
+func (a browserAddr) String() string {
+	return string(a)
+}
+
+type browserStream struct {
+	socket js.Value
+	funcs  []js.Func
+
+	buffer   []byte
+	messages [][]byte
+	err      error
+	deadline time.Time
+	notify   chan struct{}
+	mutex    sync.Mutex
+}
+
+func newBrowserStream(socket js.Value) *browserStream {
+	// create stream
+	s := &browserStream{
+		socket: socket,
+		notify: make(chan struct{}, 1),
+	}
+
+	// register handlers, they must not block the event loop
+	s.on("message", func(event js.Value) {
+		// get data
+		data := event.Get("data")
+		if data.Type() == js.TypeString {
+			s.fail(ErrNotBinary)
+			return
+		}
+
+		// copy message
+		array := js.Global().Get("Uint8Array").New(data)
+		msg := make([]byte, array.Get("length").Int())
+		js.CopyBytesToGo(msg, array)
+
+		// queue message
+		s.mutex.Lock()
+		s.messages = append(s.messages, msg)
+		s.mutex.Unlock()
+		s.signal()
+	})
+	s.on("close", func(js.Value) {
+		s.fail(io.EOF)
+		s.release()
+	})
+
+	return s
+}
+
+func (s *browserStream) Read(p []byte) (int, error) {
+	for {
+		// acquire mutex
+		s.mutex.Lock()
+
+		// fill buffer from queued messages
+		if len(s.buffer) == 0 && len(s.messages) > 0 {
+			s.buffer = s.messages[0]
+			s.messages = s.messages[1:]
+		}
+
+		// read from buffer
+		if len(s.buffer) > 0 {
+			n := copy(p, s.buffer)
+			s.buffer = s.buffer[n:]
+			s.mutex.Unlock()
+			return n, nil
+		}
+
+		// get error and deadline
+		err := s.err
+		deadline := s.deadline
+
+		// release mutex
+		s.mutex.Unlock()
+
+		// return error
+		if err != nil {
+			return 0, err
+		}
+
+		// prepare timeout
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			timeout = timer.C
+		}
+
+		// wait for messages or errors
+		select {
+		case <-s.notify:
+			if timer != nil {
+				timer.Stop()
+			}
+		case <-timeout:
+			return 0, ErrBrowserReadTimeout
+		}
+	}
+}
+
+func (s *browserStream) Write(p []byte) (int, error) {
+	// check error
+	s.mutex.Lock()
+	err := s.err
+	s.mutex.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	// copy data
+	array := js.Global().Get("Uint8Array").New(len(p))
+	js.CopyBytesToJS(array, p)
+
+	// send message
+	s.socket.Call("send", array)
+
+	return len(p), nil
+}
+
+func (s *browserStream) Close() error {
+	s.socket.Call("close")
+	s.fail(io.EOF)
+	return nil
+}
+
+func (s *browserStream) SetReadDeadline(t time.Time) error {
+	// set deadline
+	s.mutex.Lock()
+	s.deadline = t
+	s.mutex.Unlock()
+
+	// wake up reader
+	s.signal()
+
+	return nil
+}
+
+func (s *browserStream) SetWriteDeadline(time.Time) error {
+	// writes are queued by the browser and never block
+	return nil
+}
+
+func (s *browserStream) on(event string, fn func(js.Value)) {
+	// create function
+	f := js.FuncOf(func(_ js.Value, args []js.Value) interface{} {
+		fn(args[0])
+		return nil
+	})
+
+	// register function
+	s.socket.Call("addEventListener", event, f)
+	s.funcs = append(s.funcs, f)
+}
+
+func (s *browserStream) fail(err error) {
+	// set first error
+	s.mutex.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mutex.Unlock()
+
+	// wake up reader
+	s.signal()
+}
+
+func (s *browserStream) signal() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *browserStream) release() {
+	for _, f := range s.funcs {
+		f.Release()
+	}
+}
+
+// A BrowserConn is a WebSocket connection opened by the browser using the
+// WebSocket API. It is used by the Dialer for "ws" and "wss" URLs if the
+// package is compiled for WebAssembly.
+//
+// Note: Browsers manage TLS and request headers themselves, the TLSConfig and
+// RequestHeader of the Dialer are therefore ignored.
+type BrowserConn struct {
+	*BaseConn
+
+	url string
+}
+
+// LocalAddr returns the URL of the connection as browsers do not expose the
+// local address.
+func (c *BrowserConn) LocalAddr() net.Addr {
+	return browserAddr(c.url)
+}
+
+// RemoteAddr returns the URL of the connection.
+func (c *BrowserConn) RemoteAddr() net.Addr {
+	return browserAddr(c.url)
+}
+
+func (d *Dialer) dialWebSocket(ctx context.Context, wsURL string) (Conn, error) {
+	// create socket
+	socket := js.Global().Get("WebSocket").New(wsURL, "mqtt")
+	socket.Set("binaryType", "arraybuffer")
+
+	// prepare stream
+	stream := newBrowserStream(socket)
+
+	// wait for open
+	opened := make(chan struct{}, 1)
+	open := js.FuncOf(func(js.Value, []js.Value) interface{} {
+		opened <- struct{}{}
+		return nil
+	})
+	defer open.Release()
+	socket.Call("addEventListener", "open", open)
+	defer socket.Call("removeEventListener", "open", open)
+
+	select {
+	case <-opened:
+	case <-stream.notify:
+		return nil, ErrBrowserConnection
+	case <-ctx.Done():
+		_ = stream.Close()
+		return nil, ctx.Err()
+	}
+
+	return &BrowserConn{
+		BaseConn: NewBaseConn(stream, d.MaxWriteDelay),
+		url:      wsURL,
+	}, nil
+}
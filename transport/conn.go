@@ -46,3 +46,72 @@ type Conn interface {
 	// RemoteAddr will return the underlying connection's remote net address.
 	RemoteAddr() net.Addr
 }
+
+// A WrappedConn is a connection that wraps another connection. Wrappers should
+// implement the interface to allow Buffered, TLSConnectionState and
+// PSKIdentity to inspect the underlying connection.
+type WrappedConn interface {
+	Conn
+
+	// Unwrap returns the wrapped connection.
+	Unwrap() Conn
+}
+
+// A BufferedConn is a Conn that queues packets and allows tuning how they are
+// written to the underlying connection. All connections provided by this
+// package implement the interface. Callers should look it up using Buffered as
+// other implementations of Conn are not required to support it.
+type BufferedConn interface {
+	Conn
+
+	// BufferedSend will add the packet to the send queue of the connection and
+	// return immediately. The queued packets are sent in order by a separate
+	// goroutine. If the queue is full, ErrSendQueueFull is returned and the
+	// packet is not sent. Network errors are returned by the following calls.
+	//
+	// Note: The packet must not be modified after it has been queued.
+	BufferedSend(pkt packet.Generic) error
+
+	// Flush will immediately write all packets that have been buffered by
+	// asynchronous sends to the underlying connection.
+	Flush() error
+
+	// SetWriteTimeout sets the maximum time that writing a packet to the
+	// underlying connection may take. If the write does not complete in the set
+	// duration the connection will be closed and Send returns an error.
+	SetWriteTimeout(timeout time.Duration)
+
+	// SetMaxWriteDelay sets the maximum time asynchronously sent packets are
+	// buffered before they are flushed to the underlying connection.
+	SetMaxWriteDelay(delay time.Duration)
+
+	// SetSendQueueSize sets the number of packets that can be queued using
+	// BufferedSend. It must be called before the first packet is queued.
+	SetSendQueueSize(size int)
+
+	// SetBufferSizes sets the size of the read and write buffer that are
+	// allocated for the connection. A size of zero restores the default size.
+	SetBufferSizes(read, write int)
+}
+
+// Buffered returns the BufferedConn of the specified connection. Wrapped
+// connections are unwrapped until a BufferedConn is found.
+//
+// Note: Packets sent using BufferedSend of an unwrapped connection bypass the
+// Send method of the wrappers. Wrappers that must see all sent packets should
+// therefore implement BufferedConn themselves.
+func Buffered(conn Conn) (BufferedConn, bool) {
+	for {
+		// check connection
+		if bc, ok := conn.(BufferedConn); ok {
+			return bc, true
+		}
+
+		// unwrap connection
+		wc, ok := conn.(WrappedConn)
+		if !ok {
+			return nil, false
+		}
+		conn = wc.Unwrap()
+	}
+}
@@ -7,7 +7,6 @@ import (
 
 	"github.com/256dpi/gomqtt/packet"
 
-	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -71,11 +70,7 @@ func abstractConnDecodeErrorTest(t *testing.T, protocol string) {
 	conn2, done := connectionPair(protocol, func(conn1 Conn) {
 		buf := []byte{0x00, 0x00} // < too small
 
-		if netConn, ok := conn1.(*NetConn); ok {
-			netConn.conn.Write(buf)
-		} else if webSocketConn, ok := conn1.(*WebSocketConn); ok {
-			webSocketConn.conn.WriteMessage(websocket.BinaryMessage, buf)
-		}
+		writeRaw(conn1, buf)
 
 		pkt, err := conn1.Receive()
 		assert.Nil(t, pkt)
@@ -192,6 +187,113 @@ func abstractConnReadTimeoutTest(t *testing.T, protocol string) {
 	safeReceive(done)
 }
 
+func abstractConnWriteTimeoutTest(t *testing.T, protocol string) {
+	conn2, done := connectionPair(protocol, func(conn1 Conn) {
+		conn1.(BufferedConn).SetWriteTimeout(10 * time.Millisecond)
+
+		pkt := packet.NewPublish()
+		pkt.Message.Topic = "test"
+		pkt.Message.Payload = make([]byte, 64*1024)
+
+		// fill buffers until the write times out
+		var err error
+		for i := 0; i < 1000 && err == nil; i++ {
+			err = conn1.Send(pkt, false)
+		}
+		assert.Error(t, err)
+	})
+
+	safeReceive(done)
+
+	err := conn2.Close()
+	assert.NoError(t, err)
+}
+
+func abstractConnBufferSizesTest(t *testing.T, protocol string) {
+	conn2, done := connectionPair(protocol, func(conn1 Conn) {
+		conn1.(BufferedConn).SetBufferSizes(16, 16)
+
+		pkt, err := conn1.Receive()
+		assert.NoError(t, err)
+		assert.Equal(t, packet.PUBLISH, pkt.Type())
+
+		err = conn1.Send(pkt, false)
+		assert.NoError(t, err)
+	})
+
+	conn2.(BufferedConn).SetBufferSizes(128, 128)
+
+	pkt := packet.NewPublish()
+	pkt.Message.Topic = "test"
+	pkt.Message.Payload = make([]byte, 1024)
+
+	err := conn2.Send(pkt, false)
+	assert.NoError(t, err)
+
+	res, err := conn2.Receive()
+	assert.NoError(t, err)
+	assert.Equal(t, pkt, res)
+
+	safeReceive(done)
+}
+
+func abstractConnFlushTest(t *testing.T, protocol string) {
+	conn2, done := connectionPair(protocol, func(conn1 Conn) {
+		conn1.(BufferedConn).SetMaxWriteDelay(time.Hour)
+
+		err := conn1.Send(packet.NewConnect(), true)
+		assert.NoError(t, err)
+
+		err = conn1.(BufferedConn).Flush()
+		assert.NoError(t, err)
+
+		pkt, err := conn1.Receive()
+		assert.NoError(t, err)
+		assert.Equal(t, packet.CONNACK, pkt.Type())
+	})
+
+	pkt, err := conn2.Receive()
+	assert.NoError(t, err)
+	assert.Equal(t, packet.CONNECT, pkt.Type())
+
+	err = conn2.Send(packet.NewConnack(), false)
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
+
+func abstractConnBufferedSendTest(t *testing.T, protocol string) {
+	conn2, done := connectionPair(protocol, func(conn1 Conn) {
+		for i := 1; i <= 10; i++ {
+			pkt, err := conn1.Receive()
+			assert.NoError(t, err)
+			assert.Equal(t, packet.ID(i), pkt.(*packet.Puback).ID)
+		}
+
+		err := conn1.Close()
+		assert.NoError(t, err)
+	})
+
+	conn2.(BufferedConn).SetSendQueueSize(10)
+
+	for i := 1; i <= 10; i++ {
+		err := conn2.(BufferedConn).BufferedSend(&packet.Puback{ID: packet.ID(i)})
+		assert.NoError(t, err)
+	}
+
+	pkt, err := conn2.Receive()
+	assert.Nil(t, pkt)
+	assert.Equal(t, io.EOF, err)
+
+	err = conn2.Close()
+	assert.Error(t, err)
+
+	err = conn2.(BufferedConn).BufferedSend(packet.NewPingreq())
+	assert.Equal(t, ErrSendQueueClosed, err)
+
+	safeReceive(done)
+}
+
 func abstractConnCloseAfterCloseTest(t *testing.T, protocol string) {
 	conn2, done := connectionPair(protocol, func(conn1 Conn) {
 		err := conn1.Close()
@@ -1,20 +1,28 @@
 package transport
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net"
-	"net/http"
 	"net/url"
 	"time"
 
-	"github.com/gorilla/websocket"
+	"github.com/256dpi/gomqtt/transport/psk"
 )
 
 // The Dialer handles connecting to a server and creating a connection.
 type Dialer struct {
-	TLSConfig     *tls.Config
-	RequestHeader http.Header
+	TLSConfig *tls.Config
+
+	// PSKConfig can be set to authenticate "tls" and "mqtts" connections using
+	// TLS-PSK instead of certificates. The TLSConfig is ignored in that case.
+	PSKConfig *psk.Config
+
+	// The header sent with WebSocket handshakes. It is an http.Header except
+	// for lite builds, which do not depend on net/http.
+	RequestHeader requestHeader
+
 	MaxWriteDelay time.Duration
 
 	DefaultTCPPort string
@@ -22,20 +30,17 @@ type Dialer struct {
 	DefaultWSPort  string
 	DefaultWSSPort string
 
-	webSocketDialer *websocket.Dialer
+	webSocketDialer *wsDialer
 }
 
 // NewDialer returns a new Dialer.
 func NewDialer() *Dialer {
 	return &Dialer{
-		DefaultTCPPort: "1883",
-		DefaultTLSPort: "8883",
-		DefaultWSPort:  "80",
-		DefaultWSSPort: "443",
-		webSocketDialer: &websocket.Dialer{
-			Proxy:        http.ProxyFromEnvironment,
-			Subprotocols: []string{"mqtt"},
-		},
+		DefaultTCPPort:  "1883",
+		DefaultTLSPort:  "8883",
+		DefaultWSPort:   "80",
+		DefaultWSSPort:  "443",
+		webSocketDialer: newWebSocketDialer(),
 	}
 }
 
@@ -50,8 +55,20 @@ func Dial(urlString string) (Conn, error) {
 	return sharedDialer.Dial(urlString)
 }
 
+// DialContext is a shorthand function.
+func DialContext(ctx context.Context, urlString string) (Conn, error) {
+	return sharedDialer.DialContext(ctx, urlString)
+}
+
 // Dial initiates a connection based in information extracted from an URL.
 func (d *Dialer) Dial(urlString string) (Conn, error) {
+	return d.DialContext(context.Background(), urlString)
+}
+
+// DialContext initiates a connection based in information extracted from an
+// URL. The context is used to cancel the dial and carries net/http/httptrace
+// hooks that are called while resolving and connecting.
+func (d *Dialer) DialContext(ctx context.Context, urlString string) (Conn, error) {
 	// ensure write delay default
 	if d.MaxWriteDelay == 0 {
 		d.MaxWriteDelay = 10 * time.Millisecond
@@ -74,7 +91,7 @@ func (d *Dialer) Dial(urlString string) (Conn, error) {
 			port = d.DefaultTCPPort
 		}
 
-		conn, err := net.Dial("tcp", net.JoinHostPort(host, port))
+		conn, err := d.dial(ctx, net.JoinHostPort(host, port))
 		if err != nil {
 			return nil, err
 		}
@@ -85,25 +102,50 @@ func (d *Dialer) Dial(urlString string) (Conn, error) {
 			port = d.DefaultTLSPort
 		}
 
-		conn, err := tls.Dial("tcp", net.JoinHostPort(host, port), d.TLSConfig)
+		conn, err := d.dial(ctx, net.JoinHostPort(host, port))
 		if err != nil {
 			return nil, err
 		}
 
-		return NewNetConn(conn, d.MaxWriteDelay), nil
-	case "ws":
-		if port == "" {
-			port = d.DefaultWSPort
+		// perform psk handshake
+		if d.PSKConfig != nil {
+			pskConn := psk.Client(conn, d.PSKConfig)
+			err = handshake(ctx, conn, pskConn.Handshake)
+			if err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+
+			return NewNetConn(pskConn, d.MaxWriteDelay), nil
 		}
 
-		wsURL := fmt.Sprintf("ws://%s:%s%s", host, port, urlParts.Path)
+		// prepare config
+		config := d.TLSConfig
+		if config == nil {
+			config = &tls.Config{}
+		}
+		if config.ServerName == "" {
+			config = config.Clone()
+			config.ServerName = host
+		}
 
-		conn, _, err := d.webSocketDialer.Dial(wsURL, d.RequestHeader)
+		// perform handshake
+		tlsConn := tls.Client(conn, config)
+		err = handshake(ctx, conn, tlsConn.Handshake)
 		if err != nil {
+			_ = conn.Close()
 			return nil, err
 		}
 
-		return NewWebSocketConn(conn, d.MaxWriteDelay), nil
+		return NewNetConn(tlsConn, d.MaxWriteDelay), nil
+	case "ws":
+		if port == "" {
+			port = d.DefaultWSPort
+		}
+
+		wsURL := fmt.Sprintf("ws://%s:%s%s", host, port, urlParts.Path)
+
+		return d.dialWebSocket(ctx, wsURL)
 	case "wss":
 		if port == "" {
 			port = d.DefaultWSSPort
@@ -111,14 +153,46 @@ func (d *Dialer) Dial(urlString string) (Conn, error) {
 
 		wsURL := fmt.Sprintf("wss://%s:%s%s", host, port, urlParts.Path)
 
-		d.webSocketDialer.TLSClientConfig = d.TLSConfig
-		conn, _, err := d.webSocketDialer.Dial(wsURL, d.RequestHeader)
-		if err != nil {
-			return nil, err
+		return d.dialWebSocket(ctx, wsURL)
+	}
+
+	return nil, ErrUnsupportedProtocol
+}
+
+func (d *Dialer) dial(ctx context.Context, addr string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+// handshake runs the handshake function while respecting the deadline and
+// cancellation of the context. The connection is closed if the context is
+// done before the handshake completed. No connection deadline is derived from
+// the context so that a failed handshake reliably reports the context error.
+func handshake(ctx context.Context, conn net.Conn, fn func() error) error {
+	// close connection if the context is done
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-done:
 		}
+	}()
+
+	// run handshake
+	err := fn()
 
-		return NewWebSocketConn(conn, d.MaxWriteDelay), nil
+	// stop watcher
+	close(done)
+	<-stopped
+
+	// prefer context error
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
 
-	return nil, ErrUnsupportedProtocol
+	return err
 }
@@ -0,0 +1,10 @@
+//go:build gomqtt_lite && !js
+// +build gomqtt_lite,!js
+
+package transport
+
+import "context"
+
+func (d *Dialer) dialWebSocket(context.Context, string) (Conn, error) {
+	return nil, ErrUnsupportedProtocol
+}
@@ -1,8 +1,14 @@
 package transport
 
 import (
+	"context"
 	"io"
+	"net"
 	"testing"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport/psk"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -37,6 +43,74 @@ func TestGlobalDial(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestDialerPSK(t *testing.T) {
+	key := []byte("secret")
+
+	launcher := NewLauncher()
+	launcher.PSKConfig = psk.ServerConfig(map[string][]byte{"client1": key})
+
+	server, err := launcher.Launch("mqtts://localhost:0")
+	require.NoError(t, err)
+
+	wait := make(chan struct{})
+
+	go func() {
+		conn, err := server.Accept()
+		require.NoError(t, err)
+
+		pkt, err := conn.Receive()
+		assert.NoError(t, err)
+		assert.Equal(t, packet.CONNECT, pkt.Type())
+		assert.Equal(t, "client1", PSKIdentity(conn))
+		assert.Nil(t, TLSConnectionState(conn))
+
+		err = conn.Close()
+		assert.NoError(t, err)
+
+		close(wait)
+	}()
+
+	dialer := NewDialer()
+	dialer.PSKConfig = psk.ClientConfig("client1", key)
+
+	conn, err := dialer.Dial(getURL(server, "mqtts"))
+	require.NoError(t, err)
+
+	err = conn.Send(packet.NewConnect(), false)
+	assert.NoError(t, err)
+
+	pkt, err := conn.Receive()
+	assert.Nil(t, pkt)
+	assert.Equal(t, io.EOF, err)
+
+	safeReceive(wait)
+
+	wait = make(chan struct{})
+
+	go func() {
+		conn, err := server.Accept()
+		require.NoError(t, err)
+
+		pkt, err := conn.Receive()
+		assert.Nil(t, pkt)
+		assert.Error(t, err)
+		assert.Empty(t, PSKIdentity(conn))
+
+		close(wait)
+	}()
+
+	dialer.PSKConfig = psk.ClientConfig("client2", key)
+
+	conn, err = dialer.Dial(getURL(server, "mqtts"))
+	assert.Nil(t, conn)
+	assert.Error(t, err)
+
+	safeReceive(wait)
+
+	err = server.Close()
+	assert.NoError(t, err)
+}
+
 func TestDialerBadURL(t *testing.T) {
 	conn, err := Dial("foo")
 	assert.Nil(t, conn)
@@ -116,10 +190,35 @@ func TestTLSDefaultPort(t *testing.T) {
 	abstractDefaultPortTest(t, "tls")
 }
 
-func TestWSDefaultPort(t *testing.T) {
-	abstractDefaultPortTest(t, "ws")
-}
+func TestDialerHandshakeContext(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	// accept connections but never respond
+	go func() {
+		for {
+			_, err := listener.Accept()
+			if err != nil {
+				return
+			}
+		}
+	}()
 
-func TestWSSDefaultPort(t *testing.T) {
-	abstractDefaultPortTest(t, "wss")
+	dialer := NewDialer()
+	dialer.PSKConfig = psk.ClientConfig("foo", []byte("bar"))
+
+	for _, config := range []*psk.Config{nil, dialer.PSKConfig} {
+		dialer.PSKConfig = config
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+
+		conn, err := dialer.DialContext(ctx, "tls://"+listener.Addr().String())
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.Nil(t, conn)
+
+		cancel()
+	}
+
+	err = listener.Close()
+	assert.NoError(t, err)
 }
@@ -0,0 +1,65 @@
+//go:build !js && !gomqtt_lite
+// +build !js,!gomqtt_lite
+
+package transport
+
+import (
+	"context"
+	"net"
+
+	"github.com/gorilla/websocket"
+)
+
+func (d *Dialer) dialWebSocket(ctx context.Context, wsURL string) (Conn, error) {
+	// prepare dialer
+	webSocketDialer := d.webSocket(ctx)
+	webSocketDialer.TLSClientConfig = d.TLSConfig
+
+	// dial connection
+	conn, _, err := webSocketDialer.Dial(wsURL, d.RequestHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWebSocketConn(conn, d.MaxWriteDelay), nil
+}
+
+func (d *Dialer) webSocket(ctx context.Context) *websocket.Dialer {
+	// copy dialer
+	webSocketDialer := *d.webSocketDialer
+
+	// wrap dial function to respect the context, a configured dial function
+	// is kept as is
+	netDial := webSocketDialer.NetDial
+	webSocketDialer.NetDial = func(network, addr string) (net.Conn, error) {
+		// dial connection
+		var conn net.Conn
+		var err error
+		if netDial != nil {
+			err = ctx.Err()
+			if err == nil {
+				conn, err = netDial(network, addr)
+			}
+		} else {
+			var dialer net.Dialer
+			conn, err = dialer.DialContext(ctx, network, addr)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// apply context deadline to the handshake, the websocket dialer
+		// clears the deadline once the handshake completed
+		if deadline, ok := ctx.Deadline(); ok {
+			err = conn.SetDeadline(deadline)
+			if err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+		}
+
+		return conn, nil
+	}
+
+	return &webSocketDialer
+}
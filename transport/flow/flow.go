@@ -5,10 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"strings"
 	"time"
 
 	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
 )
 
 // A Conn defines an abstract interface for connections used with a Flow.
@@ -64,6 +66,10 @@ const (
 	actionReceive
 	actionSkip
 	actionRun
+	actionDelay
+	actionJitter
+	actionDrop
+	actionCorrupt
 	actionClose
 	actionEnd
 )
@@ -72,21 +78,26 @@ const (
 type action struct {
 	kind     byte
 	packets  []packet.Generic
+	matchers []Matcher
 	fn       func()
 	ch       chan struct{}
 	duration time.Duration
+	max      time.Duration
+	count    int
 }
 
 // A Flow is a sequence of actions that can be tested against a connection.
 type Flow struct {
 	debug   bool
 	actions []action
+	random  *rand.Rand
 }
 
 // New returns a new flow.
 func New() *Flow {
 	return &Flow{
 		actions: make([]action, 0),
+		random:  rand.New(rand.NewSource(1)),
 	}
 }
 
@@ -106,11 +117,21 @@ func (f *Flow) Send(pkts ...packet.Generic) *Flow {
 	return f
 }
 
-// Receive will receive and match the specified packets out of order.
-func (f *Flow) Receive(pkts ...packet.Generic) *Flow {
+// Receive will receive and match the specified packets out of order. Besides
+// packets that are matched exactly, expectations may be specified as Matcher
+// functions e.g. to ignore dynamically assigned packet ids using Like. A
+// received packet is matched against the expectations in the specified order,
+// more specific expectations should therefore be listed first.
+func (f *Flow) Receive(expected ...interface{}) *Flow {
+	// prepare matchers
+	matchers := make([]Matcher, 0, len(expected))
+	for _, e := range expected {
+		matchers = append(matchers, matcher(e))
+	}
+
 	f.add(action{
-		kind:    actionReceive,
-		packets: pkts,
+		kind:     actionReceive,
+		matchers: matchers,
 	})
 
 	return f
@@ -136,6 +157,57 @@ func (f *Flow) Run(fn func()) *Flow {
 	return f
 }
 
+// Delay will pause the flow for the specified duration to simulate a slow
+// peer.
+func (f *Flow) Delay(d time.Duration) *Flow {
+	f.add(action{
+		kind:     actionDelay,
+		duration: d,
+	})
+
+	return f
+}
+
+// Jitter will pause the flow for a random duration between min and max. The
+// durations are derived from the seed of the flow and are therefore the same
+// for every run.
+func (f *Flow) Jitter(min, max time.Duration) *Flow {
+	f.add(action{
+		kind:     actionJitter,
+		duration: min,
+		max:      max,
+	})
+
+	return f
+}
+
+// Seed will set the seed that is used to derive jitter durations.
+func (f *Flow) Seed(seed int64) *Flow {
+	f.random = rand.New(rand.NewSource(seed))
+	return f
+}
+
+// Drop will receive the specified number of packets of any type and discard
+// them to simulate a lossy peer.
+func (f *Flow) Drop(n int) *Flow {
+	f.add(action{
+		kind:  actionDrop,
+		count: n,
+	})
+
+	return f
+}
+
+// Corrupt will send a malformed packet with a reserved type that will fail to
+// decode on the other side of a transport connection.
+func (f *Flow) Corrupt() *Flow {
+	f.add(action{
+		kind: actionCorrupt,
+	})
+
+	return f
+}
+
 // Close will immediately close the connection.
 func (f *Flow) Close() *Flow {
 	f.add(action{
@@ -184,10 +256,7 @@ func (f *Flow) test(conn Conn, action action) error {
 		}
 	case actionReceive:
 		// initialize store
-		store := make(map[int]string)
-		for i, pkt := range action.packets {
-			store[i] = pkt.String()
-		}
+		store := append([]Matcher(nil), action.matchers...)
 
 	receive:
 		// keep going until we have all packets
@@ -207,9 +276,9 @@ func (f *Flow) test(conn Conn, action action) error {
 			}
 
 			// check packet
-			for i, p := range store {
-				if p == pkt.String() {
-					delete(store, i)
+			for i, matcher := range store {
+				if matcher(pkt) {
+					store = append(store[:i], store[i+1:]...)
 					continue receive
 				}
 			}
@@ -257,6 +326,52 @@ func (f *Flow) test(conn Conn, action action) error {
 
 		// run function
 		action.fn()
+	case actionDelay:
+		if f.debug {
+			fmt.Printf("delaying %s...\n", action.duration)
+		}
+
+		// wait
+		time.Sleep(action.duration)
+	case actionJitter:
+		// get duration
+		duration := action.duration
+		if action.max > action.duration {
+			duration += time.Duration(f.random.Int63n(int64(action.max - action.duration)))
+		}
+
+		if f.debug {
+			fmt.Printf("delaying %s...\n", duration)
+		}
+
+		// wait
+		time.Sleep(duration)
+	case actionDrop:
+		for i := 0; i < action.count; i++ {
+			if f.debug {
+				fmt.Printf("dropping packet...\n")
+			}
+
+			// wait for next packet
+			pkt, err := conn.Receive()
+			if err != nil {
+				return fmt.Errorf("expected to drop a received packet but got error: %v", err)
+			}
+
+			if f.debug {
+				fmt.Println("dropped packet:", pkt)
+			}
+		}
+	case actionCorrupt:
+		if f.debug {
+			fmt.Printf("sending corrupt packet...\n")
+		}
+
+		// send corrupt packet
+		err := conn.Send(corruptPacket{}, false)
+		if err != nil {
+			return fmt.Errorf("error sending corrupt packet: %v", err)
+		}
 	case actionClose:
 		if f.debug {
 			fmt.Printf("closing...\n")
@@ -300,6 +415,66 @@ func (f *Flow) TestAsync(conn Conn, timeout time.Duration) <-chan error {
 	return errCh
 }
 
+// Serve will accept a connection from the specified server for each flow and
+// test the flows in order. The server is closed afterwards and the first error
+// is returned through the channel. Using a transport.Launcher, flows may be
+// served over any supported transport.
+func Serve(server transport.Server, flows ...*Flow) <-chan error {
+	errCh := make(chan error, 1)
+	go func() {
+		var err error
+		for _, flow := range flows {
+			// accept next connection
+			var conn transport.Conn
+			conn, err = server.Accept()
+			if err != nil {
+				break
+			}
+
+			// test flow
+			err = flow.Test(conn)
+			if err != nil {
+				break
+			}
+		}
+
+		// close server
+		closeErr := server.Close()
+		if err == nil {
+			err = closeErr
+		}
+
+		errCh <- err
+	}()
+
+	return errCh
+}
+
+// corruptPacket encodes to the header of a packet with a reserved type.
+type corruptPacket struct{}
+
+func (corruptPacket) Type() packet.Type {
+	return 0
+}
+
+func (corruptPacket) Len() int {
+	return 2
+}
+
+func (corruptPacket) Decode([]byte) (int, error) {
+	return 0, errors.New("corrupt packet")
+}
+
+func (corruptPacket) Encode(dst []byte) (int, error) {
+	dst[0] = 0
+	dst[1] = 0
+	return 2, nil
+}
+
+func (corruptPacket) String() string {
+	return "<Corrupt>"
+}
+
 // add will add the specified action.
 func (f *Flow) add(action action) {
 	f.actions = append(f.actions, action)
@@ -1,10 +1,13 @@
 package flow
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/256dpi/gomqtt/packet"
+	"github.com/256dpi/gomqtt/transport"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -62,6 +65,32 @@ func TestFlow(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestServe(t *testing.T) {
+	connect := packet.NewConnect()
+	connack := packet.NewConnack()
+
+	server, err := transport.Launch("ws://localhost:0")
+	assert.NoError(t, err)
+
+	errCh := Serve(server, New().
+		Receive(connect).
+		Send(connack).
+		End())
+
+	conn, err := transport.Dial("ws://" + server.Addr().String())
+	assert.NoError(t, err)
+
+	err = New().
+		Send(connect).
+		Receive(connack).
+		Close().
+		Test(conn)
+	assert.NoError(t, err)
+
+	err = <-errCh
+	assert.NoError(t, err)
+}
+
 func TestAlreadyClosedError(t *testing.T) {
 	pipe := NewPipe()
 	pipe.Close()
@@ -69,3 +98,230 @@ func TestAlreadyClosedError(t *testing.T) {
 	err := pipe.Send(nil, false)
 	assert.Error(t, err)
 }
+
+func TestMatchers(t *testing.T) {
+	publish := packet.NewPublish()
+	publish.ID = 7
+	publish.Message.Topic = "foo/bar"
+	publish.Message.Payload = []byte(`{"value":42}`)
+	publish.Message.QOS = 1
+
+	like := packet.NewPublish()
+	like.Message.Topic = "foo/bar"
+	like.Message.QOS = 1
+
+	other := packet.NewPublish()
+	other.Message.Topic = "foo/baz"
+
+	assert.True(t, Exactly(publish)(publish))
+	assert.False(t, Exactly(like)(publish))
+
+	assert.True(t, Any(packet.PUBLISH)(publish))
+	assert.False(t, Any(packet.PUBACK)(publish))
+
+	assert.True(t, Like(like)(publish))
+	assert.False(t, Like(other)(publish))
+	assert.False(t, Like(packet.NewPuback())(publish))
+
+	assert.True(t, PayloadMatches(`"value":\d+`)(publish))
+	assert.False(t, PayloadMatches(`"value":"`)(publish))
+	assert.False(t, PayloadMatches(`.*`)(packet.NewPuback()))
+
+	assert.True(t, All(Like(like), PayloadMatches("42"))(publish))
+	assert.False(t, All(Like(like), PayloadMatches("43"))(publish))
+}
+
+func TestFlowMatchers(t *testing.T) {
+	publish := packet.NewPublish()
+	publish.ID = 7
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("hello")
+	publish.Message.QOS = 1
+
+	puback := packet.NewPuback()
+	puback.ID = 7
+
+	like := packet.NewPublish()
+	like.Message.Topic = "test"
+
+	server := New().
+		Receive(All(Like(like), PayloadMatches("^hel")), Any(packet.PUBACK)).
+		Close()
+
+	client := New().
+		Send(puback, publish).
+		End()
+
+	pipe := NewPipe()
+
+	errCh := server.TestAsync(pipe, 100*time.Millisecond)
+
+	err := client.Test(pipe)
+	assert.NoError(t, err)
+
+	err = <-errCh
+	assert.NoError(t, err)
+
+	assert.Panics(t, func() {
+		New().Receive("foo")
+	})
+}
+
+func TestFlowFaults(t *testing.T) {
+	publish := packet.NewPublish()
+	publish.Message.Topic = "test"
+
+	server := New().
+		Drop(2).
+		Delay(10*time.Millisecond).
+		Jitter(5*time.Millisecond, 10*time.Millisecond).
+		Receive(publish).
+		Close()
+
+	client := New().
+		Send(packet.NewPingreq(), packet.NewConnect(), publish).
+		End()
+
+	pipe := NewPipe()
+
+	errCh := server.TestAsync(pipe, time.Second)
+
+	start := time.Now()
+	err := client.Test(pipe)
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= 15*time.Millisecond)
+
+	err = <-errCh
+	assert.NoError(t, err)
+}
+
+func TestFlowCorrupt(t *testing.T) {
+	server, err := transport.Launch("tcp://localhost:0")
+	assert.NoError(t, err)
+
+	errCh := Serve(server, New().
+		Corrupt().
+		End())
+
+	conn, err := transport.Dial("tcp://" + server.Addr().String())
+	assert.NoError(t, err)
+
+	pkt, err := conn.Receive()
+	assert.Nil(t, pkt)
+	assert.IsType(t, &packet.ReservedTypeError{}, err)
+
+	err = <-errCh
+	assert.NoError(t, err)
+}
+
+func TestRecorder(t *testing.T) {
+	connect := packet.NewConnect()
+	connack := packet.NewConnack()
+
+	publish := packet.NewPublish()
+	publish.ID = 1
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("hello")
+	publish.Message.QOS = 1
+
+	puback := packet.NewPuback()
+	puback.ID = 1
+
+	peer := func() *Flow {
+		return New().
+			Receive(connect).
+			Send(connack).
+			Receive(publish).
+			Send(puback).
+			Receive(packet.NewDisconnect()).
+			End()
+	}
+
+	server, err := transport.Launch("tcp://localhost:0")
+	assert.NoError(t, err)
+
+	errCh := Serve(server, peer())
+
+	conn, err := transport.Dial("tcp://" + server.Addr().String())
+	assert.NoError(t, err)
+
+	recorder := NewRecorder(conn)
+
+	err = New().
+		Send(connect).
+		Receive(connack).
+		Send(publish).
+		Receive(puback).
+		Send(packet.NewDisconnect()).
+		Close().
+		Test(recorder)
+	assert.NoError(t, err)
+
+	err = <-errCh
+	assert.NoError(t, err)
+
+	// round trip recording
+	var buf bytes.Buffer
+	err = recorder.Recording().Write(&buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "# <Connect ")
+
+	recording, err := ReadRecording(&buf)
+	assert.NoError(t, err)
+	assert.Len(t, recording.Events, 6)
+
+	kinds := make([]EventKind, 0, len(recording.Events))
+	for _, event := range recording.Events {
+		kinds = append(kinds, event.Kind)
+	}
+	assert.Equal(t, []EventKind{
+		EventSend, EventReceive, EventSend, EventReceive, EventSend, EventClose,
+	}, kinds)
+	assert.Equal(t, publish.String(), recording.Events[2].Packet.String())
+
+	// replay against peer
+	server, err = transport.Launch("tcp://localhost:0")
+	assert.NoError(t, err)
+
+	errCh = Serve(server, peer())
+
+	conn, err = transport.Dial("tcp://" + server.Addr().String())
+	assert.NoError(t, err)
+
+	err = recording.Flow().Test(conn)
+	assert.NoError(t, err)
+
+	err = <-errCh
+	assert.NoError(t, err)
+
+	// replay mirrored
+	pipe := NewPipe()
+
+	errCh = recording.Mirror().TestAsync(pipe, time.Second)
+
+	err = recording.Flow().Test(pipe)
+	assert.NoError(t, err)
+
+	err = <-errCh
+	assert.NoError(t, err)
+}
+
+func TestReadRecordingErrors(t *testing.T) {
+	_, err := ReadRecording(strings.NewReader("foo 1s"))
+	assert.Error(t, err)
+
+	_, err = ReadRecording(strings.NewReader("send foo 00"))
+	assert.Error(t, err)
+
+	_, err = ReadRecording(strings.NewReader("send 1s"))
+	assert.Error(t, err)
+
+	_, err = ReadRecording(strings.NewReader("send 1s zz"))
+	assert.Error(t, err)
+
+	_, err = ReadRecording(strings.NewReader("receive 1s c000ff"))
+	assert.Error(t, err)
+
+	_, err = ReadRecording(strings.NewReader("close 1s c000"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,127 @@
+package flow
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// A Matcher reports whether a received packet is expected. Matchers can be
+// passed to Receive in place of packets to match packets with dynamically
+// assigned values like packet ids.
+type Matcher func(pkt packet.Generic) bool
+
+// Exactly returns a matcher that matches packets that are equal to the
+// specified packet. It is used for packets passed to Receive.
+func Exactly(expected packet.Generic) Matcher {
+	str := expected.String()
+	return func(pkt packet.Generic) bool {
+		return pkt.String() == str
+	}
+}
+
+// Any returns a matcher that matches all packets of the specified type.
+func Any(typ packet.Type) Matcher {
+	return func(pkt packet.Generic) bool {
+		return pkt.Type() == typ
+	}
+}
+
+// Like returns a matcher that matches packets of the same type whose fields
+// equal all non zero fields of the specified packet. Nested structs like the
+// message of a publish packet are compared field by field as well.
+//
+// Note: As zero fields are ignored, a matcher that requires e.g. a QOS of zero
+// must be written manually.
+func Like(expected packet.Generic) Matcher {
+	return func(pkt packet.Generic) bool {
+		// check type
+		if pkt.Type() != expected.Type() {
+			return false
+		}
+
+		return like(reflect.ValueOf(expected), reflect.ValueOf(pkt))
+	}
+}
+
+// PayloadMatches returns a matcher that matches publish packets whose payload
+// matches the specified regular expression. It panics if the expression is
+// invalid.
+func PayloadMatches(expr string) Matcher {
+	re := regexp.MustCompile(expr)
+	return func(pkt packet.Generic) bool {
+		// check packet
+		publish, ok := pkt.(*packet.Publish)
+		if !ok {
+			return false
+		}
+
+		return re.Match(publish.Message.Payload)
+	}
+}
+
+// All returns a matcher that matches packets that are matched by all the
+// specified matchers.
+func All(matchers ...Matcher) Matcher {
+	return func(pkt packet.Generic) bool {
+		for _, matcher := range matchers {
+			if !matcher(pkt) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+func like(expected, actual reflect.Value) bool {
+	// dereference pointers
+	if expected.Kind() == reflect.Ptr {
+		if expected.IsNil() {
+			return true
+		} else if actual.IsNil() {
+			return false
+		}
+
+		return like(expected.Elem(), actual.Elem())
+	}
+
+	// compare structs field by field
+	if expected.Kind() == reflect.Struct {
+		for i := 0; i < expected.NumField(); i++ {
+			// skip unexported fields
+			if expected.Type().Field(i).PkgPath != "" {
+				continue
+			}
+
+			if !like(expected.Field(i), actual.Field(i)) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	// ignore zero values
+	if expected.IsZero() {
+		return true
+	}
+
+	return reflect.DeepEqual(expected.Interface(), actual.Interface())
+}
+
+// matcher returns a matcher for the specified expectation.
+func matcher(expected interface{}) Matcher {
+	switch e := expected.(type) {
+	case Matcher:
+		return e
+	case func(packet.Generic) bool:
+		return e
+	case packet.Generic:
+		return Exactly(e)
+	default:
+		panic(fmt.Sprintf("flow: unsupported expectation %T", expected))
+	}
+}
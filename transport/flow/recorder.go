@@ -0,0 +1,420 @@
+package flow
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// The available event kinds.
+const (
+	// EventSend is recorded for sent packets.
+	EventSend EventKind = iota
+
+	// EventReceive is recorded for received packets.
+	EventReceive
+
+	// EventClose is recorded when the connection has been closed locally.
+	EventClose
+
+	// EventEnd is recorded when the connection has been closed by the peer.
+	EventEnd
+)
+
+// EventKind describes the kind of recorded event.
+type EventKind byte
+
+// String returns the event kind as a string.
+func (k EventKind) String() string {
+	switch k {
+	case EventSend:
+		return "send"
+	case EventReceive:
+		return "receive"
+	case EventClose:
+		return "close"
+	case EventEnd:
+		return "end"
+	}
+
+	return "unknown"
+}
+
+// An Event is a single step of a recorded packet exchange.
+type Event struct {
+	// The kind of the event.
+	Kind EventKind
+
+	// The time since the start of the recording.
+	Time time.Duration
+
+	// The sent or received packet.
+	Packet packet.Generic
+}
+
+// A Recording is a recorded packet exchange.
+type Recording struct {
+	Events []Event
+}
+
+// Flow returns a flow that replays the exchange from the perspective of the
+// recorded connection. It can be tested against the peer that has been
+// recorded, e.g. a broker.
+func (r *Recording) Flow() *Flow {
+	return r.flow(false)
+}
+
+// Mirror returns a flow that replays the exchange from the perspective of the
+// peer. It can be served to the implementation that owned the recorded
+// connection, e.g. a client.
+func (r *Recording) Mirror() *Flow {
+	return r.flow(true)
+}
+
+func (r *Recording) flow(mirror bool) *Flow {
+	// prepare flow
+	f := New()
+
+	// add events
+	for i := 0; i < len(r.Events); i++ {
+		// get kind
+		kind := r.Events[i].Kind
+		if mirror {
+			kind = mirrorKind(kind)
+		}
+
+		switch kind {
+		case EventSend, EventReceive:
+			// collect consecutive packets
+			pkts := []packet.Generic{r.Events[i].Packet}
+			for i+1 < len(r.Events) && r.Events[i+1].Kind == r.Events[i].Kind {
+				i++
+				pkts = append(pkts, r.Events[i].Packet)
+			}
+
+			// add action
+			if kind == EventSend {
+				f.Send(pkts...)
+			} else {
+				expected := make([]interface{}, 0, len(pkts))
+				for _, pkt := range pkts {
+					expected = append(expected, pkt)
+				}
+				f.Receive(expected...)
+			}
+		case EventClose:
+			f.Close()
+		case EventEnd:
+			f.End()
+		}
+	}
+
+	return f
+}
+
+// Write will write the recording in the text format to the specified writer.
+// Every event is written as a line with its kind, time and hex encoded packet,
+// preceded by a comment that describes the packet.
+func (r *Recording) Write(w io.Writer) error {
+	// write header
+	_, err := fmt.Fprintln(w, "# gomqtt flow recording")
+	if err != nil {
+		return err
+	}
+
+	// write events
+	for _, event := range r.Events {
+		// write close and end events
+		if event.Packet == nil {
+			_, err = fmt.Fprintf(w, "%s %s\n", event.Kind, event.Time)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// encode packet
+		buf := make([]byte, event.Packet.Len())
+		_, err = event.Packet.Encode(buf)
+		if err != nil {
+			return err
+		}
+
+		// write packet
+		_, err = fmt.Fprintf(w, "# %s\n%s %s %s\n", event.Packet.String(), event.Kind, event.Time, hex.EncodeToString(buf))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Save will write the recording to the specified file.
+func (r *Recording) Save(path string) error {
+	// create file
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	// write recording
+	err = r.Write(file)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// ReadRecording will read a recording in the text format from the specified
+// reader.
+func ReadRecording(r io.Reader) (*Recording, error) {
+	// prepare recording
+	recording := &Recording{}
+
+	// read lines
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<28)
+	for line := 1; scanner.Scan(); line++ {
+		// skip empty lines and comments
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		// parse event
+		event, err := parseEvent(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		recording.Events = append(recording.Events, event)
+	}
+
+	// check error
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return recording, nil
+}
+
+// LoadRecording will read a recording from the specified file.
+func LoadRecording(path string) (*Recording, error) {
+	// open file
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// ensure close
+	defer file.Close()
+
+	return ReadRecording(file)
+}
+
+// A Recorder wraps a connection and records the exchanged packets. It can be
+// used to capture sessions with real peers that are later replayed as flows
+// in regression tests.
+type Recorder struct {
+	conn   Conn
+	start  time.Time
+	events []Event
+	mutex  sync.Mutex
+}
+
+// NewRecorder returns a new recorder that wraps the specified connection.
+func NewRecorder(conn Conn) *Recorder {
+	return &Recorder{
+		conn:  conn,
+		start: time.Now(),
+	}
+}
+
+// Send will send the packet and record it.
+func (r *Recorder) Send(pkt packet.Generic, async bool) error {
+	// send packet
+	err := r.conn.Send(pkt, async)
+	if err != nil {
+		return err
+	}
+
+	// record a copy as the packet may be reused by the caller
+	r.record(EventSend, clone(pkt))
+
+	return nil
+}
+
+// Receive will receive a packet and record it. The end of the connection is
+// recorded as well.
+func (r *Recorder) Receive() (packet.Generic, error) {
+	// receive packet
+	pkt, err := r.conn.Receive()
+	if err != nil {
+		if strings.Contains(err.Error(), "EOF") {
+			r.record(EventEnd, nil)
+		}
+
+		return nil, err
+	}
+
+	// record packet
+	r.record(EventReceive, pkt)
+
+	return pkt, nil
+}
+
+// Close will close the connection and record it.
+func (r *Recorder) Close() error {
+	// record close
+	r.record(EventClose, nil)
+
+	return r.conn.Close()
+}
+
+// Recording returns the events recorded so far.
+func (r *Recorder) Recording() *Recording {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return &Recording{
+		Events: append([]Event(nil), r.events...),
+	}
+}
+
+func (r *Recorder) record(kind EventKind, pkt packet.Generic) {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// add event
+	r.events = append(r.events, Event{
+		Kind:   kind,
+		Time:   time.Since(r.start),
+		Packet: pkt,
+	})
+}
+
+func parseEvent(text string) (Event, error) {
+	// split fields
+	fields := strings.Fields(text)
+	if len(fields) < 2 {
+		return Event{}, fmt.Errorf("invalid event %q", text)
+	}
+
+	// parse time
+	duration, err := time.ParseDuration(fields[1])
+	if err != nil {
+		return Event{}, err
+	}
+
+	// parse kind
+	var kind EventKind
+	switch fields[0] {
+	case "send":
+		kind = EventSend
+	case "receive":
+		kind = EventReceive
+	case "close":
+		kind = EventClose
+	case "end":
+		kind = EventEnd
+	default:
+		return Event{}, fmt.Errorf("invalid event kind %q", fields[0])
+	}
+
+	// check close and end events
+	if kind == EventClose || kind == EventEnd {
+		if len(fields) != 2 {
+			return Event{}, fmt.Errorf("unexpected packet for %s event", kind)
+		}
+
+		return Event{Kind: kind, Time: duration}, nil
+	}
+
+	// check packet
+	if len(fields) != 3 {
+		return Event{}, fmt.Errorf("missing packet for %s event", kind)
+	}
+
+	// decode packet
+	buf, err := hex.DecodeString(fields[2])
+	if err != nil {
+		return Event{}, err
+	}
+	pkt, err := decode(buf)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{Kind: kind, Time: duration, Packet: pkt}, nil
+}
+
+// decode will decode a single packet from the buffer.
+func decode(buf []byte) (packet.Generic, error) {
+	// detect packet
+	l, typ := packet.DetectPacket(buf)
+	if l != len(buf) {
+		return nil, fmt.Errorf("invalid packet length")
+	}
+
+	// create packet
+	pkt, err := typ.New()
+	if err != nil {
+		return nil, err
+	}
+
+	// decode packet
+	_, err = pkt.Decode(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return pkt, nil
+}
+
+// clone will return a copy of the packet by encoding and decoding it. The
+// packet itself is returned if that fails.
+func clone(pkt packet.Generic) packet.Generic {
+	// encode packet
+	buf := make([]byte, pkt.Len())
+	_, err := pkt.Encode(buf)
+	if err != nil {
+		return pkt
+	}
+
+	// decode packet
+	cpy, err := decode(buf)
+	if err != nil {
+		return pkt
+	}
+
+	return cpy
+}
+
+func mirrorKind(kind EventKind) EventKind {
+	switch kind {
+	case EventSend:
+		return EventReceive
+	case EventReceive:
+		return EventSend
+	case EventClose:
+		return EventEnd
+	case EventEnd:
+		return EventClose
+	}
+
+	return kind
+}
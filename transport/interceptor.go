@@ -0,0 +1,156 @@
+package transport
+
+import (
+	"time"
+
+	"github.com/256dpi/gomqtt/packet"
+)
+
+// An Interceptor inspects packets that are sent and received over a connection.
+// The functions are called with every packet and may return the same packet, a
+// modified or replaced packet, nil to drop the packet or an error that is
+// returned by Send or Receive respectively. Packets may be delayed by blocking
+// in the function.
+//
+// Note: Outgoing packets may still be referenced by the sender, e.g. to store
+// them in a session. Interceptors should therefore return modified copies
+// instead of mutating outgoing packets.
+type Interceptor struct {
+	// Outgoing is called before a packet is sent.
+	Outgoing func(packet.Generic) (packet.Generic, error)
+
+	// Incoming is called after a packet has been received.
+	Incoming func(packet.Generic) (packet.Generic, error)
+}
+
+// Intercept returns a connection that runs all packets through the specified
+// interceptors. Outgoing packets are passed in order while incoming packets are
+// passed in reverse order. The original connection is returned if no
+// interceptors are provided. The returned connection is a BufferedConn if the
+// specified connection provides one.
+func Intercept(conn Conn, interceptors ...Interceptor) Conn {
+	// check interceptors
+	if len(interceptors) == 0 {
+		return conn
+	}
+
+	// prepare connection
+	ic := &interceptedConn{
+		Conn:         conn,
+		interceptors: interceptors,
+	}
+
+	// keep buffering if available
+	if bc, ok := Buffered(conn); ok {
+		return &bufferedInterceptedConn{
+			interceptedConn: ic,
+			buffered:        bc,
+		}
+	}
+
+	return ic
+}
+
+type interceptedConn struct {
+	Conn
+
+	interceptors []Interceptor
+}
+
+func (c *interceptedConn) Unwrap() Conn {
+	return c.Conn
+}
+
+func (c *interceptedConn) Send(pkt packet.Generic, async bool) error {
+	// run interceptors
+	pkt, err := c.outgoing(pkt)
+	if err != nil || pkt == nil {
+		return err
+	}
+
+	return c.Conn.Send(pkt, async)
+}
+
+func (c *interceptedConn) outgoing(pkt packet.Generic) (packet.Generic, error) {
+	for _, interceptor := range c.interceptors {
+		if interceptor.Outgoing == nil {
+			continue
+		}
+
+		var err error
+		pkt, err = interceptor.Outgoing(pkt)
+		if err != nil {
+			return nil, err
+		}
+
+		// drop packet
+		if pkt == nil {
+			return nil, nil
+		}
+	}
+
+	return pkt, nil
+}
+
+func (c *interceptedConn) Receive() (packet.Generic, error) {
+	for {
+		// receive next packet
+		pkt, err := c.Conn.Receive()
+		if err != nil {
+			return nil, err
+		}
+
+		// run interceptors
+		for i := len(c.interceptors) - 1; i >= 0 && pkt != nil; i-- {
+			if c.interceptors[i].Incoming == nil {
+				continue
+			}
+
+			pkt, err = c.interceptors[i].Incoming(pkt)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// return packet if not dropped
+		if pkt != nil {
+			return pkt, nil
+		}
+	}
+}
+
+type bufferedInterceptedConn struct {
+	*interceptedConn
+
+	buffered BufferedConn
+}
+
+func (c *bufferedInterceptedConn) BufferedSend(pkt packet.Generic) error {
+	// run interceptors
+	pkt, err := c.outgoing(pkt)
+	if err != nil || pkt == nil {
+		return err
+	}
+
+	return c.buffered.BufferedSend(pkt)
+}
+
+func (c *bufferedInterceptedConn) Flush() error {
+	return c.buffered.Flush()
+}
+
+func (c *bufferedInterceptedConn) SetWriteTimeout(timeout time.Duration) {
+	c.buffered.SetWriteTimeout(timeout)
+}
+
+func (c *bufferedInterceptedConn) SetMaxWriteDelay(delay time.Duration) {
+	c.buffered.SetMaxWriteDelay(delay)
+}
+
+func (c *bufferedInterceptedConn) SetSendQueueSize(size int) {
+	c.buffered.SetSendQueueSize(size)
+}
+
+func (c *bufferedInterceptedConn) SetBufferSizes(read, write int) {
+	c.buffered.SetBufferSizes(read, write)
+}
@@ -0,0 +1,189 @@
+package transport
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterceptNone(t *testing.T) {
+	conn, done := connectionPair("tcp", func(conn Conn) {})
+
+	assert.Equal(t, conn, Intercept(conn))
+
+	err := conn.Close()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
+
+func TestIntercept(t *testing.T) {
+	var order []string
+
+	conn2, done := connectionPair("tcp", func(conn1 Conn) {
+		pkt, err := conn1.Receive()
+		assert.NoError(t, err)
+		assert.Equal(t, "bar", pkt.(*packet.Publish).Message.Topic)
+
+		err = conn1.Send(packet.NewPingresp(), false)
+		assert.NoError(t, err)
+
+		err = conn1.Send(packet.NewConnack(), false)
+		assert.NoError(t, err)
+
+		_, err = conn1.Receive()
+		assert.Error(t, err)
+	})
+
+	conn := Intercept(conn2, Interceptor{
+		Outgoing: func(pkt packet.Generic) (packet.Generic, error) {
+			order = append(order, "out1")
+
+			// rewrite topic
+			if publish, ok := pkt.(*packet.Publish); ok {
+				publish2 := packet.NewPublish()
+				publish2.Message = publish.Message
+				publish2.Message.Topic = "bar"
+				return publish2, nil
+			}
+
+			return pkt, nil
+		},
+		Incoming: func(pkt packet.Generic) (packet.Generic, error) {
+			order = append(order, "in1")
+			return pkt, nil
+		},
+	}, Interceptor{
+		Outgoing: func(pkt packet.Generic) (packet.Generic, error) {
+			order = append(order, "out2")
+
+			// drop pingreq
+			if pkt.Type() == packet.PINGREQ {
+				return nil, nil
+			}
+
+			return pkt, nil
+		},
+		Incoming: func(pkt packet.Generic) (packet.Generic, error) {
+			order = append(order, "in2")
+
+			// drop pingresp
+			if pkt.Type() == packet.PINGRESP {
+				return nil, nil
+			}
+
+			return pkt, nil
+		},
+	})
+
+	err := conn.Send(packet.NewPingreq(), false)
+	assert.NoError(t, err)
+
+	publish := packet.NewPublish()
+	publish.Message.Topic = "foo"
+	err = conn.Send(publish, false)
+	assert.NoError(t, err)
+
+	pkt, err := conn.Receive()
+	assert.NoError(t, err)
+	assert.Equal(t, packet.CONNACK, pkt.Type())
+
+	assert.Equal(t, []string{"out1", "out2", "out1", "out2", "in2", "in2", "in1"}, order)
+
+	err = conn.Close()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
+
+func TestInterceptBufferedSend(t *testing.T) {
+	conn2, done := connectionPair("tcp", func(conn1 Conn) {
+		pkt, err := conn1.Receive()
+		assert.NoError(t, err)
+		assert.Equal(t, packet.PINGREQ, pkt.Type())
+
+		_, err = conn1.Receive()
+		assert.Error(t, err)
+	})
+
+	conn := Intercept(conn2, Interceptor{
+		Outgoing: func(pkt packet.Generic) (packet.Generic, error) {
+			// drop connect
+			if pkt.Type() == packet.CONNECT {
+				return nil, nil
+			}
+
+			return pkt, nil
+		},
+	})
+
+	err := conn.(BufferedConn).BufferedSend(packet.NewConnect())
+	assert.NoError(t, err)
+
+	err = conn.(BufferedConn).BufferedSend(packet.NewPingreq())
+	assert.NoError(t, err)
+
+	err = conn.Close()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
+
+type plainConn struct {
+	Conn
+}
+
+func TestInterceptBuffered(t *testing.T) {
+	conn, done := connectionPair("tcp", func(conn Conn) {})
+
+	interceptor := Interceptor{}
+
+	_, ok := Intercept(conn, interceptor).(BufferedConn)
+	assert.True(t, ok)
+
+	_, ok = Intercept(&plainConn{Conn: conn}, interceptor).(BufferedConn)
+	assert.False(t, ok)
+
+	bc, ok := Buffered(Intercept(&plainConn{Conn: conn}, interceptor))
+	assert.False(t, ok)
+	assert.Nil(t, bc)
+
+	err := conn.Close()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
+
+func TestInterceptError(t *testing.T) {
+	conn2, done := connectionPair("tcp", func(conn1 Conn) {
+		err := conn1.Send(packet.NewConnack(), false)
+		assert.NoError(t, err)
+
+		_, err = conn1.Receive()
+		assert.Error(t, err)
+	})
+
+	conn := Intercept(conn2, Interceptor{
+		Outgoing: func(pkt packet.Generic) (packet.Generic, error) {
+			return nil, errors.New("outgoing")
+		},
+		Incoming: func(pkt packet.Generic) (packet.Generic, error) {
+			return nil, errors.New("incoming")
+		},
+	})
+
+	err := conn.Send(packet.NewConnect(), false)
+	assert.EqualError(t, err, "outgoing")
+
+	pkt, err := conn.Receive()
+	assert.Nil(t, pkt)
+	assert.EqualError(t, err, "incoming")
+
+	err = conn.Close()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
@@ -2,12 +2,23 @@ package transport
 
 import (
 	"crypto/tls"
+	"net"
 	"net/url"
+
+	"github.com/256dpi/gomqtt/transport/psk"
 )
 
 // The Launcher helps with launching a server and accepting connections.
 type Launcher struct {
 	TLSConfig *tls.Config
+
+	// PSKConfig can be set to authenticate "tls", "ssl" and "mqtts" servers
+	// using TLS-PSK instead of certificates.
+	PSKConfig *psk.Config
+
+	// ProxyProtocol can be set to require a PROXY protocol header on all
+	// incoming connections. See ProxyListener for details.
+	ProxyProtocol bool
 }
 
 // NewLauncher returns a new Launcher.
@@ -33,16 +44,63 @@ func (l *Launcher) Launch(urlString string) (Server, error) {
 		return nil, err
 	}
 
+	// launch proxy protocol server if requested
+	if l.ProxyProtocol {
+		return l.launchProxy(urlParts)
+	}
+
 	switch urlParts.Scheme {
 	case "tcp", "mqtt":
 		return CreateNetServer(urlParts.Host)
 	case "tls", "ssl", "mqtts":
+		if l.PSKConfig != nil {
+			return CreatePSKNetServer(urlParts.Host, l.PSKConfig)
+		}
+
 		return CreateSecureNetServer(urlParts.Host, l.TLSConfig)
 	case "ws":
-		return CreateWebSocketServer(urlParts.Host)
+		return launchWebSocket(urlParts.Host, nil)
 	case "wss":
-		return CreateSecureWebSocketServer(urlParts.Host, l.TLSConfig)
+		return launchWebSocket(urlParts.Host, l.TLSConfig)
 	}
 
 	return nil, ErrUnsupportedProtocol
 }
+
+func (l *Launcher) launchProxy(urlParts *url.URL) (Server, error) {
+	// check scheme
+	var secure, webSocket bool
+	switch urlParts.Scheme {
+	case "tcp", "mqtt":
+	case "tls", "ssl", "mqtts":
+		secure = true
+	case "ws":
+		webSocket = true
+	case "wss":
+		secure = true
+		webSocket = true
+	default:
+		return nil, ErrUnsupportedProtocol
+	}
+
+	// create listener
+	listener, err := net.Listen("tcp", urlParts.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	// parse proxy header before the tls handshake
+	listener = NewProxyListener(listener)
+	if secure && l.PSKConfig != nil && !webSocket {
+		listener = psk.NewListener(listener, l.PSKConfig)
+	} else if secure {
+		listener = tls.NewListener(listener, l.TLSConfig)
+	}
+
+	// create server
+	if webSocket {
+		return newWebSocketServer(listener)
+	}
+
+	return NewNetServer(listener), nil
+}
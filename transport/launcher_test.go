@@ -1,8 +1,12 @@
 package transport
 
 import (
+	"crypto/tls"
+	"net"
 	"testing"
 
+	"github.com/256dpi/gomqtt/packet"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -26,3 +30,89 @@ func TestLauncherUnsupportedProtocol(t *testing.T) {
 	assert.Nil(t, conn)
 	assert.Equal(t, ErrUnsupportedProtocol, err)
 }
+
+func abstractLauncherProxyProtocolTest(t *testing.T, protocol string) {
+	launcher := NewLauncher()
+	launcher.TLSConfig = serverTLSConfig
+	launcher.ProxyProtocol = true
+
+	server, err := launcher.Launch(protocol + "://localhost:0")
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+
+	go func() {
+		conn, err := server.Accept()
+		require.NoError(t, err)
+
+		pkt, err := conn.Receive()
+		assert.NoError(t, err)
+		assert.Equal(t, packet.CONNECT, pkt.Type())
+		assert.Equal(t, "192.168.0.1:56324", conn.RemoteAddr().String())
+
+		err = conn.Close()
+		assert.NoError(t, err)
+
+		close(done)
+	}()
+
+	dialer := NewDialer()
+	dialer.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	setWebSocketNetDial(dialer, func(network, addr string) (net.Conn, error) {
+		return dialProxy(addr)
+	})
+
+	var conn Conn
+	switch protocol {
+	case "tcp":
+		netConn, err := dialProxy(server.Addr().String())
+		require.NoError(t, err)
+		conn = NewNetConn(netConn, 0)
+	case "tls":
+		netConn, err := dialProxy(server.Addr().String())
+		require.NoError(t, err)
+		conn = NewNetConn(tls.Client(netConn, dialer.TLSConfig), 0)
+	default:
+		conn, err = dialer.Dial(getURL(server, protocol))
+		require.NoError(t, err)
+	}
+
+	err = conn.Send(packet.NewConnect(), false)
+	assert.NoError(t, err)
+
+	safeReceive(done)
+
+	err = server.Close()
+	assert.NoError(t, err)
+}
+
+func TestLauncherProxyProtocolTCP(t *testing.T) {
+	abstractLauncherProxyProtocolTest(t, "tcp")
+}
+
+func TestLauncherProxyProtocolTLS(t *testing.T) {
+	abstractLauncherProxyProtocolTest(t, "tls")
+}
+
+func TestLauncherProxyProtocolUnsupportedProtocol(t *testing.T) {
+	launcher := NewLauncher()
+	launcher.ProxyProtocol = true
+
+	conn, err := launcher.Launch("foo://localhost")
+	assert.Nil(t, conn)
+	assert.Equal(t, ErrUnsupportedProtocol, err)
+}
+
+func dialProxy(addr string) (net.Conn, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.Write([]byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 1883\r\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
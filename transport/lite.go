@@ -0,0 +1,37 @@
+//go:build gomqtt_lite
+// +build gomqtt_lite
+
+package transport
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+// The WebSocket transport is excluded from lite builds to avoid the
+// dependencies on net/http and gorilla/websocket. Launching or dialing "ws"
+// and "wss" URLs returns ErrUnsupportedProtocol, except for the browser
+// transport that is used when compiled for WebAssembly.
+
+type wsDialer struct{}
+
+type requestHeader = map[string][]string
+
+func newWebSocketDialer() *wsDialer {
+	return nil
+}
+
+func webSocketTLSConn(Conn) *tls.Conn {
+	return nil
+}
+
+func launchWebSocket(string, *tls.Config) (Server, error) {
+	return nil, ErrUnsupportedProtocol
+}
+
+func newWebSocketServer(listener net.Listener) (Server, error) {
+	// close listener
+	_ = listener.Close()
+
+	return nil, ErrUnsupportedProtocol
+}
@@ -0,0 +1,322 @@
+package transport
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+
+	"github.com/256dpi/gomqtt/transport/psk"
+
+	"gopkg.in/tomb.v2"
+)
+
+// ErrMissingTLSConfig is returned by a MultiServer if a secure listener has
+// been configured without a TLS or PSK config.
+var ErrMissingTLSConfig = errors.New("missing tls config")
+
+// A Listener configures a single listener of a MultiServer.
+type Listener struct {
+	// The URL the listener binds to e.g. "tcp://0.0.0.0:1883",
+	// "wss://0.0.0.0:8084" or "unix:///var/run/mqtt.sock".
+	URL string
+
+	// The TLS config used by "tls", "ssl", "mqtts" and "wss" listeners.
+	TLSConfig *tls.Config
+
+	// PSKConfig can be set to authenticate "tls", "ssl" and "mqtts" listeners
+	// using TLS-PSK instead of certificates.
+	PSKConfig *psk.Config
+
+	// MaxConnections limits the number of simultaneously open connections.
+	// Connections that exceed the limit are closed immediately. A value of
+	// zero disables the limit.
+	MaxConnections int
+
+	// ReadBufferSize sets the size of the operating system receive buffer of
+	// accepted connections. A value of zero keeps the system default.
+	ReadBufferSize int
+
+	// ProxyProtocol can be set to require a PROXY protocol header on all
+	// incoming connections. See ProxyListener for details.
+	ProxyProtocol bool
+}
+
+// A MultiServer binds multiple listeners and hands the accepted connections
+// from all listeners to a single Accept method. It implements the Server
+// interface and can therefore be passed to the broker engine directly.
+type MultiServer struct {
+	listeners []Listener
+	servers   []Server
+	incoming  chan Conn
+
+	tomb tomb.Tomb
+}
+
+// NewServer returns a new MultiServer for the provided listeners. The
+// listeners are bound when Launch is called.
+func NewServer(listeners ...Listener) *MultiServer {
+	return &MultiServer{
+		listeners: listeners,
+		incoming:  make(chan Conn),
+	}
+}
+
+// LaunchServer is a shorthand function to create and launch a MultiServer.
+func LaunchServer(listeners ...Listener) (*MultiServer, error) {
+	// create server
+	server := NewServer(listeners...)
+
+	// launch server
+	err := server.Launch()
+	if err != nil {
+		return nil, err
+	}
+
+	return server, nil
+}
+
+// Launch will bind all listeners and start accepting connections. If a
+// listener cannot be bound, the already bound listeners are closed and the
+// error is returned.
+func (s *MultiServer) Launch() error {
+	// create servers
+	for _, listener := range s.listeners {
+		server, err := launchListener(listener)
+		if err != nil {
+			for _, server := range s.servers {
+				_ = server.Close()
+			}
+			s.servers = nil
+
+			return err
+		}
+
+		s.servers = append(s.servers, server)
+	}
+
+	// accept connections
+	for _, server := range s.servers {
+		server := server
+		s.tomb.Go(func() error {
+			return s.accept(server)
+		})
+	}
+
+	// close servers when dying
+	s.tomb.Go(func() error {
+		<-s.tomb.Dying()
+
+		for _, server := range s.servers {
+			_ = server.Close()
+		}
+
+		return tomb.ErrDying
+	})
+
+	return nil
+}
+
+// Accept will return the next available connection from any listener or
+// block until a connection becomes available. If a listener failed, all
+// listeners are closed and the error is returned.
+func (s *MultiServer) Accept() (Conn, error) {
+	select {
+	case <-s.tomb.Dying():
+		if s.tomb.Err() == errManualClose {
+			// server has been closed manually
+			return nil, ErrAcceptAfterClose
+		}
+
+		// return the previously caught error
+		return nil, s.tomb.Err()
+	case conn := <-s.incoming:
+		return conn, nil
+	}
+}
+
+// Close will close all listeners and cleanup resources.
+func (s *MultiServer) Close() error {
+	// stop goroutines
+	s.tomb.Kill(errManualClose)
+
+	// wait for goroutines if launched
+	if len(s.servers) > 0 {
+		_ = s.tomb.Wait()
+	}
+
+	return nil
+}
+
+// Addr returns the network address of the first listener.
+func (s *MultiServer) Addr() net.Addr {
+	// check servers
+	if len(s.servers) == 0 {
+		return nil
+	}
+
+	return s.servers[0].Addr()
+}
+
+// Addrs returns the network addresses of all listeners in order.
+func (s *MultiServer) Addrs() []net.Addr {
+	// collect addresses
+	addrs := make([]net.Addr, 0, len(s.servers))
+	for _, server := range s.servers {
+		addrs = append(addrs, server.Addr())
+	}
+
+	return addrs
+}
+
+func (s *MultiServer) accept(server Server) error {
+	for {
+		// accept next connection
+		conn, err := server.Accept()
+		if err != nil {
+			// ignore errors of closed servers
+			if !s.tomb.Alive() {
+				return tomb.ErrDying
+			}
+
+			return err
+		}
+
+		// hand over connection
+		select {
+		case s.incoming <- conn:
+		case <-s.tomb.Dying():
+			_ = conn.Close()
+			return tomb.ErrDying
+		}
+	}
+}
+
+func launchListener(config Listener) (Server, error) {
+	urlParts, err := url.ParseRequestURI(config.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	// check scheme
+	network, address := "tcp", urlParts.Host
+	var secure, webSocket bool
+	switch urlParts.Scheme {
+	case "tcp", "mqtt":
+	case "tls", "ssl", "mqtts":
+		secure = true
+	case "ws":
+		webSocket = true
+	case "wss":
+		secure = true
+		webSocket = true
+	case "unix":
+		network, address = "unix", urlParts.Host+urlParts.Path
+	default:
+		return nil, ErrUnsupportedProtocol
+	}
+
+	// check tls config
+	usePSK := secure && !webSocket && config.PSKConfig != nil
+	if secure && !usePSK && config.TLSConfig == nil {
+		return nil, ErrMissingTLSConfig
+	}
+
+	// create listener
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	// apply limits
+	if config.MaxConnections > 0 || config.ReadBufferSize > 0 {
+		listener = &limitListener{
+			Listener:       listener,
+			maxConnections: config.MaxConnections,
+			readBufferSize: config.ReadBufferSize,
+		}
+	}
+
+	// parse proxy header before the tls handshake
+	if config.ProxyProtocol {
+		listener = NewProxyListener(listener)
+	}
+
+	// add tls
+	if usePSK {
+		listener = psk.NewListener(listener, config.PSKConfig)
+	} else if secure {
+		listener = tls.NewListener(listener, config.TLSConfig)
+	}
+
+	// create server
+	if webSocket {
+		return newWebSocketServer(listener)
+	}
+
+	return NewNetServer(listener), nil
+}
+
+// limitListener limits the number of open connections and configures the
+// read buffer of accepted connections.
+type limitListener struct {
+	net.Listener
+	maxConnections int
+	readBufferSize int
+
+	open  int
+	mutex sync.Mutex
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		// accept next connection
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		// set read buffer size
+		if l.readBufferSize > 0 {
+			if c, ok := conn.(interface{ SetReadBuffer(int) error }); ok {
+				_ = c.SetReadBuffer(l.readBufferSize)
+			}
+		}
+
+		// return connection if unlimited
+		if l.maxConnections <= 0 {
+			return conn, nil
+		}
+
+		// check limit
+		l.mutex.Lock()
+		if l.open >= l.maxConnections {
+			l.mutex.Unlock()
+			_ = conn.Close()
+			continue
+		}
+		l.open++
+		l.mutex.Unlock()
+
+		return &limitConn{Conn: conn, listener: l}, nil
+	}
+}
+
+func (l *limitListener) release() {
+	l.mutex.Lock()
+	l.open--
+	l.mutex.Unlock()
+}
+
+// limitConn releases its slot when closed.
+type limitConn struct {
+	net.Conn
+	listener *limitListener
+	once     sync.Once
+}
+
+func (c *limitConn) Close() error {
+	c.once.Do(c.listener.release)
+	return c.Conn.Close()
+}
@@ -0,0 +1,159 @@
+//go:build !gomqtt_lite
+// +build !gomqtt_lite
+
+package transport
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomqtt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "mqtt.sock")
+
+	server, err := LaunchServer(
+		Listener{URL: "tcp://localhost:0"},
+		Listener{URL: "tls://localhost:0", TLSConfig: serverTLSConfig},
+		Listener{URL: "ws://localhost:0"},
+		Listener{URL: "wss://localhost:0", TLSConfig: serverTLSConfig},
+		Listener{URL: "unix://" + socket, ReadBufferSize: 1024},
+	)
+	require.NoError(t, err)
+
+	addrs := server.Addrs()
+	assert.Len(t, addrs, 5)
+	assert.Equal(t, addrs[0], server.Addr())
+
+	dialer := NewDialer()
+	dialer.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+
+	for i, protocol := range []string{"tcp", "tls", "ws", "wss", "unix"} {
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+
+			conn, err := server.Accept()
+			require.NoError(t, err)
+
+			pkt, err := conn.Receive()
+			assert.NoError(t, err)
+			assert.Equal(t, packet.CONNECT, pkt.Type())
+
+			err = conn.Close()
+			assert.NoError(t, err)
+		}()
+
+		var conn Conn
+		if protocol == "unix" {
+			c, err := net.Dial("unix", socket)
+			require.NoError(t, err)
+			conn = NewNetConn(c, 0)
+		} else {
+			conn, err = dialer.Dial(protocol + "://" + addrs[i].String())
+			require.NoError(t, err, protocol)
+		}
+
+		err = conn.Send(packet.NewConnect(), false)
+		assert.NoError(t, err)
+
+		safeReceive(done)
+
+		err = conn.Close()
+		assert.NoError(t, err)
+	}
+
+	err = server.Close()
+	assert.NoError(t, err)
+
+	conn, err := server.Accept()
+	assert.Nil(t, conn)
+	assert.Equal(t, ErrAcceptAfterClose, err)
+}
+
+func TestMultiServerMaxConnections(t *testing.T) {
+	server, err := LaunchServer(Listener{URL: "tcp://localhost:0", MaxConnections: 1})
+	require.NoError(t, err)
+
+	url := "tcp://" + server.Addr().String()
+
+	conn1, err := Dial(url)
+	require.NoError(t, err)
+
+	serverConn1, err := server.Accept()
+	require.NoError(t, err)
+
+	conn2, err := Dial(url)
+	require.NoError(t, err)
+
+	pkt, err := conn2.Receive()
+	assert.Nil(t, pkt)
+	assert.Error(t, err)
+
+	err = serverConn1.Close()
+	assert.NoError(t, err)
+
+	_, err = conn1.Receive()
+	assert.Error(t, err)
+
+	conn3, err := Dial(url)
+	require.NoError(t, err)
+
+	err = conn3.Send(packet.NewConnect(), false)
+	assert.NoError(t, err)
+
+	serverConn3, err := server.Accept()
+	require.NoError(t, err)
+
+	pkt, err = serverConn3.Receive()
+	assert.NoError(t, err)
+	assert.Equal(t, packet.CONNECT, pkt.Type())
+
+	err = server.Close()
+	assert.NoError(t, err)
+}
+
+func TestMultiServerLaunchErrors(t *testing.T) {
+	server, err := LaunchServer(Listener{URL: "foo"})
+	assert.Nil(t, server)
+	assert.Error(t, err)
+
+	server, err = LaunchServer(Listener{URL: "foo://localhost:0"})
+	assert.Nil(t, server)
+	assert.Equal(t, ErrUnsupportedProtocol, err)
+
+	server, err = LaunchServer(Listener{URL: "tls://localhost:0"})
+	assert.Nil(t, server)
+	assert.Equal(t, ErrMissingTLSConfig, err)
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	multi := NewServer(
+		Listener{URL: "tcp://localhost:0"},
+		Listener{URL: "tcp://" + listener.Addr().String()},
+	)
+
+	err = multi.Launch()
+	assert.Error(t, err)
+	assert.Nil(t, multi.Addr())
+
+	err = multi.Close()
+	assert.NoError(t, err)
+
+	err = listener.Close()
+	assert.NoError(t, err)
+}
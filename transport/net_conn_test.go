@@ -1,6 +1,8 @@
 package transport
 
 import (
+	"io"
+	"net"
 	"testing"
 	"time"
 
@@ -45,10 +47,80 @@ func TestNetConnReadTimeout(t *testing.T) {
 	abstractConnReadTimeoutTest(t, "tcp")
 }
 
+func TestNetConnWriteTimeout(t *testing.T) {
+	abstractConnWriteTimeoutTest(t, "tcp")
+}
+
+func TestNetConnBufferSizes(t *testing.T) {
+	abstractConnBufferSizesTest(t, "tcp")
+}
+
+func TestNetConnFlush(t *testing.T) {
+	abstractConnFlushTest(t, "tcp")
+}
+
+func TestNetConnBufferedSend(t *testing.T) {
+	abstractConnBufferedSendTest(t, "tcp")
+}
+
 func TestNetConnCloseAfterClose(t *testing.T) {
 	abstractConnCloseAfterCloseTest(t, "tcp")
 }
 
+type closedDeadlineConn struct {
+	net.Conn
+}
+
+func (c closedDeadlineConn) SetReadDeadline(time.Time) error {
+	return io.ErrClosedPipe
+}
+
+func TestNetConnReceiveBeforeClose(t *testing.T) {
+	local, remote := net.Pipe()
+
+	conn1 := NewNetConn(local, 0)
+	conn2 := NewNetConn(closedDeadlineConn{remote}, 0)
+
+	go func() {
+		err := conn1.Send(packet.NewConnack(), false)
+		assert.NoError(t, err)
+	}()
+
+	pkt, err := conn2.Receive()
+	assert.NoError(t, err)
+	assert.Equal(t, packet.CONNACK, pkt.Type())
+
+	pkt, err = conn2.Receive()
+	assert.Error(t, err)
+	assert.Nil(t, pkt)
+}
+
+func TestNetConnChecksums(t *testing.T) {
+	local, remote := net.Pipe()
+
+	conn1 := NewNetConn(local, 0)
+	conn1.EnableChecksums()
+
+	conn2 := NewNetConn(remote, 0)
+	conn2.EnableChecksums()
+
+	go func() {
+		err := conn1.Send(packet.NewConnack(), false)
+		assert.NoError(t, err)
+
+		_, err = local.Write([]byte{0xc0, 0x00, 0x00, 0x00, 0x00, 0x00})
+		assert.NoError(t, err)
+	}()
+
+	pkt, err := conn2.Receive()
+	assert.NoError(t, err)
+	assert.Equal(t, packet.CONNACK, pkt.Type())
+
+	pkt, err = conn2.Receive()
+	assert.Equal(t, packet.ErrChecksumMismatch, err)
+	assert.Nil(t, pkt)
+}
+
 func TestNetConnAddr(t *testing.T) {
 	abstractConnAddrTest(t, "tcp")
 }
@@ -187,3 +259,47 @@ func BenchmarkNetConnAsync(b *testing.B) {
 
 	safeReceive(done)
 }
+
+func TestNetConnBufferedSendQueueFull(t *testing.T) {
+	local, remote := net.Pipe()
+
+	conn := NewNetConn(local, 0)
+	conn.SetSendQueueSize(1)
+
+	// the writer blocks on the first packet as the pipe is not read
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		err = conn.BufferedSend(packet.NewPingreq())
+	}
+	assert.Equal(t, ErrSendQueueFull, err)
+
+	err = remote.Close()
+	assert.NoError(t, err)
+
+	err = conn.Close()
+	assert.Error(t, err)
+
+	err = conn.BufferedSend(packet.NewPingreq())
+	assert.Error(t, err)
+}
+
+func TestNetConnBufferedSendCloseTimeout(t *testing.T) {
+	local, remote := net.Pipe()
+
+	conn := NewNetConn(local, 0)
+	conn.SetSendQueueSize(10)
+
+	// the writer blocks on the first packet as the pipe is not read
+	for i := 0; i < 10; i++ {
+		err := conn.BufferedSend(packet.NewPingreq())
+		assert.NoError(t, err)
+	}
+
+	start := time.Now()
+	err := conn.Close()
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 2*CloseTimeout)
+
+	err = remote.Close()
+	assert.NoError(t, err)
+}
@@ -4,6 +4,8 @@ import (
 	"crypto/tls"
 	"net"
 	"time"
+
+	"github.com/256dpi/gomqtt/transport/psk"
 )
 
 // A NetServer accepts net.Conn based connections.
@@ -40,6 +42,17 @@ func CreateSecureNetServer(address string, config *tls.Config) (*NetServer, erro
 	return NewNetServer(listener), nil
 }
 
+// CreatePSKNetServer creates a new TLS-PSK server that listens on the provided
+// address.
+func CreatePSKNetServer(address string, config *psk.Config) (*NetServer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewNetServer(psk.NewListener(listener, config)), nil
+}
+
 // Accept will return the next available connection or block until a
 // connection becomes available, otherwise returns an Error.
 func (s *NetServer) Accept() (Conn, error) {
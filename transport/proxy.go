@@ -0,0 +1,223 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidProxyHeader is returned if a connection does not start with a valid
+// PROXY protocol header.
+var ErrInvalidProxyHeader = errors.New("invalid proxy header")
+
+// the maximum length of a version 1 header including CRLF
+const proxyV1MaxLength = 107
+
+// the signature of a version 2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// A ProxyListener wraps a listener and parses the PROXY protocol header
+// (version 1 and 2) that load balancers like HAProxy or AWS NLB send at the
+// beginning of every connection. The RemoteAddr method of the accepted
+// connections will then return the address of the original client.
+//
+// The header is parsed on the first read using the read deadline of the
+// connection. Until then, RemoteAddr returns the address of the load balancer
+// without blocking. Connections that do not start with a valid header fail
+// with ErrInvalidProxyHeader. Headers that do not carry an address (e.g.
+// health checks) retain the address of the load balancer.
+type ProxyListener struct {
+	net.Listener
+}
+
+// NewProxyListener wraps the provided listener.
+func NewProxyListener(listener net.Listener) *ProxyListener {
+	return &ProxyListener{
+		Listener: listener,
+	}
+}
+
+// Accept will return the next available connection.
+func (l *ProxyListener) Accept() (net.Conn, error) {
+	// accept connection
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &proxyConn{
+		Conn:   conn,
+		reader: bufio.NewReader(conn),
+	}, nil
+}
+
+type proxyConn struct {
+	net.Conn
+
+	reader *bufio.Reader
+	addr   net.Addr
+	err    error
+	once   sync.Once
+	mutex  sync.Mutex
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	// parse header
+	c.once.Do(c.parse)
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	// get parsed address
+	c.mutex.Lock()
+	addr := c.addr
+	c.mutex.Unlock()
+	if addr != nil {
+		return addr
+	}
+
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) parse() {
+	// read header
+	addr, err := readProxyHeader(c.reader)
+
+	// set address
+	c.mutex.Lock()
+	c.addr = addr
+	c.mutex.Unlock()
+
+	c.err = err
+}
+
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	// peek at the beginning
+	start, err := r.Peek(5)
+	if err != nil {
+		return nil, err
+	}
+
+	// check version
+	if string(start) == "PROXY" {
+		return readProxyHeaderV1(r)
+	} else if bytes.Equal(start, proxyV2Signature[:5]) {
+		return readProxyHeaderV2(r)
+	}
+
+	return nil, ErrInvalidProxyHeader
+}
+
+func readProxyHeaderV1(r *bufio.Reader) (net.Addr, error) {
+	// read line
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, ErrInvalidProxyHeader
+	} else if err != nil {
+		return nil, err
+	}
+
+	// check line
+	if len(line) > proxyV1MaxLength || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	// split fields
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) < 2 {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	// check protocol
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, ErrInvalidProxyHeader
+	}
+
+	// check fields
+	if len(fields) != 6 {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	// parse source address
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readProxyHeaderV2(r *bufio.Reader) (net.Addr, error) {
+	// read header
+	header := make([]byte, 16)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	// check signature and version
+	if !bytes.Equal(header[:12], proxyV2Signature) || header[12]>>4 != 2 {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	// read addresses and optional extensions
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// check command
+	switch header[12] & 0x0F {
+	case 0x0:
+		return nil, nil // local
+	case 0x1:
+		// proxy
+	default:
+		return nil, ErrInvalidProxyHeader
+	}
+
+	// parse source address
+	var ip net.IP
+	var port int
+	switch header[13] >> 4 {
+	case 0x1:
+		if len(payload) < 12 {
+			return nil, ErrInvalidProxyHeader
+		}
+
+		ip = net.IP(payload[0:4])
+		port = int(binary.BigEndian.Uint16(payload[8:10]))
+	case 0x2:
+		if len(payload) < 36 {
+			return nil, ErrInvalidProxyHeader
+		}
+
+		ip = net.IP(payload[0:16])
+		port = int(binary.BigEndian.Uint16(payload[32:34]))
+	default:
+		return nil, nil // unspecified or unix
+	}
+
+	// check transport
+	if header[13]&0x0F == 0x2 {
+		return &net.UDPAddr{IP: ip, Port: port}, nil
+	}
+
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
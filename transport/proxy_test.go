@@ -0,0 +1,135 @@
+package transport
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseProxyHeader(header string) (net.Addr, string, error) {
+	reader := bufio.NewReader(strings.NewReader(header + "rest"))
+
+	addr, err := readProxyHeader(reader)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rest, _ := reader.ReadString(0)
+
+	return addr, rest, nil
+}
+
+func TestProxyHeaderV1(t *testing.T) {
+	addr, rest, err := parseProxyHeader("PROXY TCP4 192.168.0.1 192.168.0.11 56324 1883\r\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.0.1:56324", addr.String())
+	assert.Equal(t, "rest", rest)
+
+	addr, rest, err = parseProxyHeader("PROXY TCP6 2001:db8::1 2001:db8::2 56324 1883\r\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "[2001:db8::1]:56324", addr.String())
+	assert.Equal(t, "rest", rest)
+
+	addr, rest, err = parseProxyHeader("PROXY UNKNOWN\r\n")
+	assert.NoError(t, err)
+	assert.Nil(t, addr)
+	assert.Equal(t, "rest", rest)
+}
+
+func TestProxyHeaderV1Errors(t *testing.T) {
+	for _, header := range []string{
+		"PROXY\r\n",
+		"PROXY TCP4 192.168.0.1 192.168.0.11 56324\r\n",
+		"PROXY TCP4 foo 192.168.0.11 56324 1883\r\n",
+		"PROXY TCP4 192.168.0.1 192.168.0.11 99999 1883\r\n",
+		"PROXY UDP4 192.168.0.1 192.168.0.11 56324 1883\r\n",
+		"PROXY TCP4 192.168.0.1 192.168.0.11 56324 1883\n",
+		"PROXY " + strings.Repeat("x", 200) + "\r\n",
+		"HELLO WORLD\r\n",
+	} {
+		_, _, err := parseProxyHeader(header)
+		assert.Equal(t, ErrInvalidProxyHeader, err, header)
+	}
+}
+
+func TestProxyHeaderV2(t *testing.T) {
+	// ipv4
+	header := string(proxyV2Signature) + "\x21\x11\x00\x0c" +
+		"\xc0\xa8\x00\x01\xc0\xa8\x00\x0b\xdc\x04\x07\x5b"
+	addr, rest, err := parseProxyHeader(header)
+	assert.NoError(t, err)
+	assert.Equal(t, &net.TCPAddr{IP: net.IP{192, 168, 0, 1}, Port: 56324}, addr)
+	assert.Equal(t, "rest", rest)
+
+	// ipv6 with extension
+	header = string(proxyV2Signature) + "\x21\x21\x00\x28" +
+		"\x20\x01\x0d\xb8" + strings.Repeat("\x00", 11) + "\x01" +
+		"\x20\x01\x0d\xb8" + strings.Repeat("\x00", 11) + "\x02" +
+		"\xdc\x04\x07\x5b" + "\x04\x00\x01\x00"
+	addr, rest, err = parseProxyHeader(header)
+	assert.NoError(t, err)
+	assert.Equal(t, "[2001:db8::1]:56324", addr.String())
+	assert.Equal(t, "rest", rest)
+
+	// udp
+	header = string(proxyV2Signature) + "\x21\x12\x00\x0c" +
+		"\xc0\xa8\x00\x01\xc0\xa8\x00\x0b\xdc\x04\x07\x5b"
+	addr, _, err = parseProxyHeader(header)
+	assert.NoError(t, err)
+	assert.Equal(t, &net.UDPAddr{IP: net.IP{192, 168, 0, 1}, Port: 56324}, addr)
+
+	// local
+	header = string(proxyV2Signature) + "\x20\x00\x00\x00"
+	addr, rest, err = parseProxyHeader(header)
+	assert.NoError(t, err)
+	assert.Nil(t, addr)
+	assert.Equal(t, "rest", rest)
+}
+
+func TestProxyHeaderV2Errors(t *testing.T) {
+	for _, header := range []string{
+		string(proxyV2Signature[:11]) + "X\x21\x11\x00\x00",
+		string(proxyV2Signature) + "\x11\x11\x00\x00",
+		string(proxyV2Signature) + "\x22\x11\x00\x00",
+		string(proxyV2Signature) + "\x21\x11\x00\x04\x00\x00\x00\x00",
+		string(proxyV2Signature) + "\x21\x21\x00\x0c" + strings.Repeat("\x00", 12),
+	} {
+		_, _, err := parseProxyHeader(header)
+		assert.Equal(t, ErrInvalidProxyHeader, err, header)
+	}
+}
+
+func TestProxyListenerRemoteAddr(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	assert.NoError(t, err)
+
+	proxyListener := NewProxyListener(listener)
+	defer proxyListener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	assert.NoError(t, err)
+	defer client.Close()
+
+	conn, err := proxyListener.Accept()
+	assert.NoError(t, err)
+
+	// the socket address is returned without blocking before the header
+	// has been read
+	assert.Equal(t, client.LocalAddr().String(), conn.RemoteAddr().String())
+
+	_, err = client.Write([]byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 1883\r\nfoo"))
+	assert.NoError(t, err)
+
+	buf := make([]byte, 3)
+	_, err = io.ReadFull(conn, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", string(buf))
+	assert.Equal(t, "192.168.0.1:56324", conn.RemoteAddr().String())
+
+	err = conn.Close()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,395 @@
+package psk
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// record types
+const (
+	recordChangeCipherSpec byte = 20
+	recordAlert            byte = 21
+	recordHandshake        byte = 22
+	recordApplicationData  byte = 23
+)
+
+// alert descriptions
+const (
+	alertCloseNotify        byte = 0
+	alertUnexpectedMessage  byte = 10
+	alertBadRecordMAC       byte = 20
+	alertHandshakeFailure   byte = 40
+	alertIllegalParameter   byte = 47
+	alertDecodeError        byte = 50
+	alertDecryptError       byte = 51
+	alertProtocolVersion    byte = 70
+	alertInternalError      byte = 80
+	alertUnknownPSKIdentity byte = 115
+)
+
+// record limits
+const (
+	maxPlaintext        = 16384
+	maxCiphertext       = maxPlaintext + 2048
+	recordHeaderLength  = 5
+	explicitNonceLength = 8
+)
+
+// An AlertError is returned if the peer sent a fatal alert.
+type AlertError struct {
+	Description byte
+}
+
+// Error implements the error interface.
+func (e *AlertError) Error() string {
+	return fmt.Sprintf("psk: remote alert %d", e.Description)
+}
+
+// A Conn is a TLS-PSK connection that implements the net.Conn interface.
+type Conn struct {
+	conn   net.Conn
+	config *Config
+	client bool
+
+	// handshakeStatus is 1 if the handshake has been completed and is
+	// accessed atomically to not block on a running handshake
+	handshakeStatus uint32
+	handshakeMutex  sync.Mutex
+	handshakeErr    error
+	identity        string
+
+	in  halfConn
+	out halfConn
+
+	input     []byte
+	handshake []byte
+}
+
+type halfConn struct {
+	sync.Mutex
+	aead cipher.AEAD
+	salt []byte
+	seq  uint64
+	err  error
+}
+
+// Handshake runs the handshake if it has not yet been run. Most uses of this
+// package need not call Handshake explicitly as it is run automatically with
+// the first read or write.
+func (c *Conn) Handshake() error {
+	// fast path
+	if c.handshakeComplete() {
+		return nil
+	}
+
+	// acquire mutex
+	c.handshakeMutex.Lock()
+	defer c.handshakeMutex.Unlock()
+
+	// check state
+	if c.handshakeComplete() || c.handshakeErr != nil {
+		return c.handshakeErr
+	}
+
+	// run handshake
+	if c.client {
+		c.handshakeErr = c.clientHandshake()
+	} else {
+		c.handshakeErr = c.serverHandshake()
+	}
+
+	// set flag
+	if c.handshakeErr == nil {
+		atomic.StoreUint32(&c.handshakeStatus, 1)
+	}
+
+	return c.handshakeErr
+}
+
+func (c *Conn) handshakeComplete() bool {
+	return atomic.LoadUint32(&c.handshakeStatus) == 1
+}
+
+// Identity returns the identity that has been used to authenticate the
+// client. It is empty until the handshake has been completed.
+func (c *Conn) Identity() string {
+	// check state
+	if !c.handshakeComplete() {
+		return ""
+	}
+
+	return c.identity
+}
+
+// Read reads application data from the connection.
+func (c *Conn) Read(b []byte) (int, error) {
+	// ensure handshake
+	err := c.Handshake()
+	if err != nil {
+		return 0, err
+	}
+
+	// acquire mutex
+	c.in.Lock()
+	defer c.in.Unlock()
+
+	// read records until data is available
+	for len(c.input) == 0 {
+		typ, data, err := c.readRecord()
+		if err != nil {
+			return 0, err
+		}
+
+		switch typ {
+		case recordApplicationData:
+			c.input = data
+		case recordHandshake:
+			// renegotiation is not supported
+			return 0, c.fail(alertUnexpectedMessage, errors.New("psk: renegotiation is not supported"))
+		default:
+			return 0, c.fail(alertUnexpectedMessage, fmt.Errorf("psk: unexpected record type %d", typ))
+		}
+	}
+
+	// copy data
+	n := copy(b, c.input)
+	c.input = c.input[n:]
+
+	return n, nil
+}
+
+// Write writes application data to the connection.
+func (c *Conn) Write(b []byte) (int, error) {
+	// ensure handshake
+	err := c.Handshake()
+	if err != nil {
+		return 0, err
+	}
+
+	// acquire mutex
+	c.out.Lock()
+	defer c.out.Unlock()
+
+	// write records
+	err = c.writeRecord(recordApplicationData, b)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// Close sends a close notification if the handshake has been completed and
+// closes the underlying connection. It does not wait for a running handshake,
+// which fails once the underlying connection is closed.
+func (c *Conn) Close() error {
+	// send close notification
+	if c.handshakeComplete() {
+		_ = c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		c.out.Lock()
+		_ = c.writeRecord(recordAlert, []byte{1, alertCloseNotify})
+		c.out.Unlock()
+	}
+
+	return c.conn.Close()
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines of the underlying connection.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the underlying connection.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline of the underlying connection.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// UnderlyingConn returns the underlying connection.
+func (c *Conn) UnderlyingConn() net.Conn {
+	return c.conn
+}
+
+// readRecord reads and decrypts the next record. Alerts are handled and
+// returned as errors.
+func (c *Conn) readRecord() (byte, []byte, error) {
+	// check error
+	if c.in.err != nil {
+		return 0, nil, c.in.err
+	}
+
+	for {
+		// read header
+		var header [recordHeaderLength]byte
+		_, err := io.ReadFull(c.conn, header[:])
+		if err != nil {
+			c.in.err = err
+			return 0, nil, err
+		}
+
+		// check header
+		typ := header[0]
+		length := int(binary.BigEndian.Uint16(header[3:]))
+		if header[1] != 3 {
+			return 0, nil, c.fail(alertProtocolVersion, fmt.Errorf("psk: unsupported record version %x", header[1:3]))
+		} else if length > maxCiphertext {
+			return 0, nil, c.fail(alertDecodeError, errors.New("psk: oversized record"))
+		}
+
+		// read fragment
+		data := make([]byte, length)
+		_, err = io.ReadFull(c.conn, data)
+		if err != nil {
+			c.in.err = err
+			return 0, nil, err
+		}
+
+		// decrypt fragment
+		if c.in.aead != nil {
+			data, err = c.decrypt(typ, data)
+			if err != nil {
+				return 0, nil, c.fail(alertBadRecordMAC, err)
+			}
+		}
+
+		// handle alerts
+		if typ == recordAlert {
+			if len(data) != 2 {
+				return 0, nil, c.fail(alertDecodeError, errors.New("psk: invalid alert"))
+			}
+
+			// handle close notification
+			if data[1] == alertCloseNotify {
+				c.in.err = io.EOF
+				return 0, nil, io.EOF
+			}
+
+			// ignore warnings
+			if data[0] == 1 {
+				continue
+			}
+
+			c.in.err = &AlertError{Description: data[1]}
+			return 0, nil, c.in.err
+		}
+
+		return typ, data, nil
+	}
+}
+
+// writeRecord encrypts and writes the data as one or more records.
+func (c *Conn) writeRecord(typ byte, data []byte) error {
+	// check error
+	if c.out.err != nil {
+		return c.out.err
+	}
+
+	for {
+		// get fragment
+		fragment := data
+		if len(fragment) > maxPlaintext {
+			fragment = fragment[:maxPlaintext]
+		}
+		data = data[len(fragment):]
+
+		// prepare header
+		header := []byte{typ, 3, 3, 0, 0}
+
+		// encrypt fragment
+		if c.out.aead != nil {
+			fragment = c.encrypt(typ, fragment)
+		}
+
+		// write record
+		binary.BigEndian.PutUint16(header[3:], uint16(len(fragment)))
+		_, err := c.conn.Write(append(header, fragment...))
+		if err != nil {
+			c.out.err = err
+			return err
+		}
+
+		// check remaining data
+		if len(data) == 0 {
+			return nil
+		}
+	}
+}
+
+func (c *Conn) encrypt(typ byte, plaintext []byte) []byte {
+	// prepare nonce
+	explicit := make([]byte, explicitNonceLength)
+	binary.BigEndian.PutUint64(explicit, c.out.seq)
+	nonce := append(append([]byte{}, c.out.salt...), explicit...)
+
+	// encrypt
+	ad := additionalData(c.out.seq, typ, len(plaintext))
+	c.out.seq++
+
+	return c.out.aead.Seal(explicit, nonce, plaintext, ad)
+}
+
+func (c *Conn) decrypt(typ byte, ciphertext []byte) ([]byte, error) {
+	// check length
+	overhead := explicitNonceLength + c.in.aead.Overhead()
+	if len(ciphertext) < overhead {
+		return nil, errors.New("psk: record too short")
+	}
+
+	// prepare nonce
+	nonce := append(append([]byte{}, c.in.salt...), ciphertext[:explicitNonceLength]...)
+
+	// decrypt
+	ad := additionalData(c.in.seq, typ, len(ciphertext)-overhead)
+	plaintext, err := c.in.aead.Open(nil, nonce, ciphertext[explicitNonceLength:], ad)
+	if err != nil {
+		return nil, err
+	}
+	c.in.seq++
+
+	return plaintext, nil
+}
+
+func additionalData(seq uint64, typ byte, length int) []byte {
+	ad := make([]byte, 13)
+	binary.BigEndian.PutUint64(ad, seq)
+	ad[8] = typ
+	ad[9] = 3
+	ad[10] = 3
+	binary.BigEndian.PutUint16(ad[11:], uint16(length))
+	return ad
+}
+
+// fail sends a fatal alert and returns the error.
+func (c *Conn) fail(alert byte, err error) error {
+	// send alert
+	c.out.Lock()
+	_ = c.writeRecord(recordAlert, []byte{2, alert})
+	c.out.err = err
+	c.out.Unlock()
+
+	// set error
+	c.in.err = err
+
+	return err
+}
@@ -0,0 +1,605 @@
+package psk
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// handshake message types
+const (
+	typeHelloRequest      byte = 0
+	typeClientHello       byte = 1
+	typeServerHello       byte = 2
+	typeServerKeyExchange byte = 12
+	typeServerHelloDone   byte = 14
+	typeClientKeyExchange byte = 16
+	typeFinished          byte = 20
+)
+
+// extension and signaling values
+const (
+	extensionRenegotiationInfo uint16 = 0xff01
+	scsvRenegotiation          uint16 = 0x00ff
+)
+
+// a suite describes the parameters of a cipher suite
+type suite struct {
+	id     uint16
+	keyLen int
+	hash   func() hash.Hash
+}
+
+var suites = []suite{
+	{TLS_PSK_WITH_AES_128_GCM_SHA256, 16, sha256.New},
+	{TLS_PSK_WITH_AES_256_GCM_SHA384, 32, sha512.New384},
+}
+
+func lookupSuite(id uint16) *suite {
+	for i := range suites {
+		if suites[i].id == id {
+			return &suites[i]
+		}
+	}
+
+	return nil
+}
+
+// handshakeState holds the state of a running handshake.
+type handshakeState struct {
+	suite        *suite
+	clientRandom []byte
+	serverRandom []byte
+	transcript   bytes.Buffer
+	master       []byte
+}
+
+func (c *Conn) clientHandshake() error {
+	// check callback
+	if c.config.ClientKey == nil {
+		return ErrMissingCallback
+	}
+
+	// prepare state
+	hs := &handshakeState{
+		clientRandom: make([]byte, 32),
+	}
+	_, err := rand.Read(hs.clientRandom)
+	if err != nil {
+		return err
+	}
+
+	// prepare client hello
+	hello := []byte{3, 3}
+	hello = append(hello, hs.clientRandom...)
+	hello = append(hello, 0)
+	cipherSuites := c.config.cipherSuites()
+	hello = appendUint16(hello, uint16(2*len(cipherSuites)))
+	for _, id := range cipherSuites {
+		hello = appendUint16(hello, id)
+	}
+	hello = append(hello, 1, 0)
+	hello = appendUint16(hello, 5)
+	hello = appendUint16(hello, extensionRenegotiationInfo)
+	hello = append(hello, 0, 1, 0)
+
+	// send client hello
+	err = c.writeHandshake(hs, typeClientHello, hello)
+	if err != nil {
+		return err
+	}
+
+	// read server hello
+	msg, err := c.readHandshake(hs, typeServerHello)
+	if err != nil {
+		return err
+	}
+
+	// parse server hello
+	r := reader(msg)
+	version, random := r.uint16(), r.bytes(32)
+	r.bytes(int(r.uint8()))
+	id, compression := r.uint16(), r.uint8()
+	if !r.ok() {
+		return c.fail(alertDecodeError, errors.New("psk: invalid server hello"))
+	} else if version != 0x0303 {
+		return c.fail(alertProtocolVersion, fmt.Errorf("psk: unsupported version %x", version))
+	} else if compression != 0 {
+		return c.fail(alertIllegalParameter, errors.New("psk: unsupported compression"))
+	}
+
+	// check suite
+	hs.suite = lookupSuite(id)
+	if hs.suite == nil || !contains(cipherSuites, id) {
+		return c.fail(alertIllegalParameter, fmt.Errorf("psk: unexpected cipher suite %x", id))
+	}
+	hs.serverRandom = random
+
+	// read server key exchange or server hello done
+	typ, msg, err := c.readHandshakeAny(hs)
+	if err != nil {
+		return err
+	}
+
+	// parse server key exchange
+	var hint string
+	if typ == typeServerKeyExchange {
+		r := reader(msg)
+		hint = string(r.bytes(int(r.uint16())))
+		if !r.ok() || len(r) != 0 {
+			return c.fail(alertDecodeError, errors.New("psk: invalid server key exchange"))
+		}
+
+		// read server hello done
+		typ, _, err = c.readHandshakeAny(hs)
+		if err != nil {
+			return err
+		}
+	}
+
+	// check server hello done
+	if typ != typeServerHelloDone {
+		return c.fail(alertUnexpectedMessage, fmt.Errorf("psk: unexpected handshake message %d", typ))
+	}
+
+	// get identity and key
+	identity, key, err := c.config.ClientKey(hint)
+	if err != nil {
+		return c.fail(alertInternalError, err)
+	}
+
+	// send client key exchange
+	err = c.writeHandshake(hs, typeClientKeyExchange, appendBytes16(nil, []byte(identity)))
+	if err != nil {
+		return err
+	}
+
+	// derive keys
+	clientKey, serverKey, err := hs.establish(key)
+	if err != nil {
+		return c.fail(alertInternalError, err)
+	}
+
+	// send change cipher spec and finished
+	err = c.changeCipherSpec(clientKey)
+	if err != nil {
+		return err
+	}
+	err = c.writeHandshake(hs, typeFinished, hs.finished("client finished"))
+	if err != nil {
+		return err
+	}
+
+	// read change cipher spec and finished
+	err = c.readChangeCipherSpec(hs, serverKey)
+	if err != nil {
+		return err
+	}
+	expected := hs.finished("server finished")
+	msg, err = c.readHandshake(hs, typeFinished)
+	if err != nil {
+		return err
+	} else if !hmac.Equal(msg, expected) {
+		return c.fail(alertDecryptError, errors.New("psk: invalid server finished"))
+	}
+
+	// set identity
+	c.identity = identity
+
+	return nil
+}
+
+func (c *Conn) serverHandshake() error {
+	// check callback
+	if c.config.ServerKey == nil {
+		return ErrMissingCallback
+	}
+
+	// prepare state
+	hs := &handshakeState{
+		serverRandom: make([]byte, 32),
+	}
+	_, err := rand.Read(hs.serverRandom)
+	if err != nil {
+		return err
+	}
+
+	// read client hello
+	msg, err := c.readHandshake(hs, typeClientHello)
+	if err != nil {
+		return err
+	}
+
+	// parse client hello
+	r := reader(msg)
+	version, random := r.uint16(), r.bytes(32)
+	r.bytes(int(r.uint8()))
+	ids := r.bytes(int(r.uint16()))
+	compressions := r.bytes(int(r.uint8()))
+	if !r.ok() || len(ids)%2 != 0 {
+		return c.fail(alertDecodeError, errors.New("psk: invalid client hello"))
+	} else if version < 0x0303 {
+		return c.fail(alertProtocolVersion, fmt.Errorf("psk: unsupported version %x", version))
+	} else if bytes.IndexByte(compressions, 0) < 0 {
+		return c.fail(alertIllegalParameter, errors.New("psk: unsupported compression"))
+	}
+	hs.clientRandom = random
+
+	// check secure renegotiation
+	var offered []uint16
+	var secureRenegotiation bool
+	for i := 0; i < len(ids); i += 2 {
+		id := binary.BigEndian.Uint16(ids[i:])
+		offered = append(offered, id)
+		if id == scsvRenegotiation {
+			secureRenegotiation = true
+		}
+	}
+	if len(r) > 0 {
+		extensions := reader(r.bytes(int(r.uint16())))
+		for len(extensions) > 0 && extensions.ok() {
+			typ := extensions.uint16()
+			extensions.bytes(int(extensions.uint16()))
+			if typ == extensionRenegotiationInfo {
+				secureRenegotiation = true
+			}
+		}
+	}
+
+	// select suite
+	for _, id := range c.config.cipherSuites() {
+		if contains(offered, id) {
+			hs.suite = lookupSuite(id)
+			break
+		}
+	}
+	if hs.suite == nil {
+		return c.fail(alertHandshakeFailure, errors.New("psk: no shared cipher suite"))
+	}
+
+	// prepare server hello
+	hello := []byte{3, 3}
+	hello = append(hello, hs.serverRandom...)
+	hello = append(hello, 0)
+	hello = appendUint16(hello, hs.suite.id)
+	hello = append(hello, 0)
+	if secureRenegotiation {
+		hello = appendUint16(hello, 5)
+		hello = appendUint16(hello, extensionRenegotiationInfo)
+		hello = append(hello, 0, 1, 0)
+	}
+
+	// send server hello
+	err = c.writeHandshake(hs, typeServerHello, hello)
+	if err != nil {
+		return err
+	}
+
+	// send server key exchange
+	if c.config.Hint != "" {
+		err = c.writeHandshake(hs, typeServerKeyExchange, appendBytes16(nil, []byte(c.config.Hint)))
+		if err != nil {
+			return err
+		}
+	}
+
+	// send server hello done
+	err = c.writeHandshake(hs, typeServerHelloDone, nil)
+	if err != nil {
+		return err
+	}
+
+	// read client key exchange
+	msg, err = c.readHandshake(hs, typeClientKeyExchange)
+	if err != nil {
+		return err
+	}
+
+	// parse client key exchange
+	r = reader(msg)
+	identity := string(r.bytes(int(r.uint16())))
+	if !r.ok() || len(r) != 0 {
+		return c.fail(alertDecodeError, errors.New("psk: invalid client key exchange"))
+	}
+
+	// get key
+	key, err := c.config.ServerKey(identity)
+	if err == ErrUnknownIdentity {
+		return c.fail(alertUnknownPSKIdentity, err)
+	} else if err != nil {
+		return c.fail(alertInternalError, err)
+	}
+
+	// derive keys
+	clientKey, serverKey, err := hs.establish(key)
+	if err != nil {
+		return c.fail(alertInternalError, err)
+	}
+
+	// read change cipher spec and finished
+	err = c.readChangeCipherSpec(hs, clientKey)
+	if err != nil {
+		return err
+	}
+	expected := hs.finished("client finished")
+	msg, err = c.readHandshake(hs, typeFinished)
+	if err != nil {
+		return err
+	} else if !hmac.Equal(msg, expected) {
+		return c.fail(alertDecryptError, errors.New("psk: invalid client finished"))
+	}
+
+	// send change cipher spec and finished
+	err = c.changeCipherSpec(serverKey)
+	if err != nil {
+		return err
+	}
+	err = c.writeHandshake(hs, typeFinished, hs.finished("server finished"))
+	if err != nil {
+		return err
+	}
+
+	// set identity
+	c.identity = identity
+
+	return nil
+}
+
+// writeHandshake writes a handshake message and adds it to the transcript.
+func (c *Conn) writeHandshake(hs *handshakeState, typ byte, body []byte) error {
+	// prepare message
+	msg := []byte{typ, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}
+	msg = append(msg, body...)
+
+	// add to transcript
+	hs.transcript.Write(msg)
+
+	return c.writeRecord(recordHandshake, msg)
+}
+
+// readHandshake reads a handshake message of the specified type.
+func (c *Conn) readHandshake(hs *handshakeState, expected byte) ([]byte, error) {
+	// read message
+	typ, msg, err := c.readHandshakeAny(hs)
+	if err != nil {
+		return nil, err
+	}
+
+	// check type
+	if typ != expected {
+		return nil, c.fail(alertUnexpectedMessage, fmt.Errorf("psk: unexpected handshake message %d", typ))
+	}
+
+	return msg, nil
+}
+
+// readHandshakeAny reads the next handshake message and adds it to the
+// transcript.
+func (c *Conn) readHandshakeAny(hs *handshakeState) (byte, []byte, error) {
+	for {
+		// check buffer
+		if len(c.handshake) >= 4 {
+			length := int(c.handshake[1])<<16 | int(c.handshake[2])<<8 | int(c.handshake[3])
+			if length > maxCiphertext {
+				return 0, nil, c.fail(alertDecodeError, errors.New("psk: oversized handshake message"))
+			}
+
+			if len(c.handshake) >= 4+length {
+				// get message
+				typ := c.handshake[0]
+				msg := c.handshake[:4+length]
+				c.handshake = c.handshake[4+length:]
+
+				// ignore hello requests
+				if typ == typeHelloRequest {
+					continue
+				}
+
+				// add to transcript
+				hs.transcript.Write(msg)
+
+				return typ, msg[4:], nil
+			}
+		}
+
+		// read record
+		typ, data, err := c.readRecord()
+		if err != nil {
+			return 0, nil, err
+		} else if typ != recordHandshake {
+			return 0, nil, c.fail(alertUnexpectedMessage, fmt.Errorf("psk: unexpected record type %d", typ))
+		}
+
+		// add data
+		c.handshake = append(c.handshake, data...)
+	}
+}
+
+// changeCipherSpec sends a change cipher spec and enables the write cipher.
+func (c *Conn) changeCipherSpec(key *cipherKey) error {
+	// send change cipher spec
+	err := c.writeRecord(recordChangeCipherSpec, []byte{1})
+	if err != nil {
+		return err
+	}
+
+	// enable cipher
+	c.out.aead = key.aead
+	c.out.salt = key.salt
+	c.out.seq = 0
+
+	return nil
+}
+
+// readChangeCipherSpec reads a change cipher spec and enables the read cipher.
+func (c *Conn) readChangeCipherSpec(hs *handshakeState, key *cipherKey) error {
+	// check buffer
+	if len(c.handshake) > 0 {
+		return c.fail(alertUnexpectedMessage, errors.New("psk: unexpected handshake data"))
+	}
+
+	// read record
+	typ, data, err := c.readRecord()
+	if err != nil {
+		return err
+	} else if typ != recordChangeCipherSpec || len(data) != 1 || data[0] != 1 {
+		return c.fail(alertUnexpectedMessage, errors.New("psk: expected change cipher spec"))
+	}
+
+	// enable cipher
+	c.in.aead = key.aead
+	c.in.salt = key.salt
+	c.in.seq = 0
+
+	return nil
+}
+
+type cipherKey struct {
+	aead cipher.AEAD
+	salt []byte
+}
+
+// establish derives the master secret and the client and server keys from
+// the pre-shared key.
+func (hs *handshakeState) establish(psk []byte) (*cipherKey, *cipherKey, error) {
+	// prepare premaster secret
+	premaster := appendUint16(nil, uint16(len(psk)))
+	premaster = append(premaster, make([]byte, len(psk))...)
+	premaster = appendBytes16(premaster, psk)
+
+	// derive master secret
+	seed := append(append([]byte{}, hs.clientRandom...), hs.serverRandom...)
+	hs.master = prf(hs.suite.hash, premaster, "master secret", seed, 48)
+
+	// derive key block
+	seed = append(append([]byte{}, hs.serverRandom...), hs.clientRandom...)
+	n := hs.suite.keyLen
+	block := prf(hs.suite.hash, hs.master, "key expansion", seed, 2*n+8)
+
+	// create keys
+	clientKey, err := newCipherKey(block[:n], block[2*n:2*n+4])
+	if err != nil {
+		return nil, nil, err
+	}
+	serverKey, err := newCipherKey(block[n:2*n], block[2*n+4:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return clientKey, serverKey, nil
+}
+
+// finished returns the verify data of a finished message.
+func (hs *handshakeState) finished(label string) []byte {
+	// hash transcript
+	h := hs.suite.hash()
+	h.Write(hs.transcript.Bytes())
+
+	return prf(hs.suite.hash, hs.master, label, h.Sum(nil), 12)
+}
+
+func newCipherKey(key, salt []byte) (*cipherKey, error) {
+	// create block cipher
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// create aead
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cipherKey{aead: aead, salt: salt}, nil
+}
+
+// prf implements the TLS 1.2 pseudo random function.
+func prf(h func() hash.Hash, secret []byte, label string, seed []byte, length int) []byte {
+	// prepare seed
+	seed = append([]byte(label), seed...)
+
+	// expand secret
+	mac := hmac.New(h, secret)
+	mac.Write(seed)
+	a := mac.Sum(nil)
+	out := make([]byte, 0, length)
+	for len(out) < length {
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(seed)
+		out = mac.Sum(out)
+
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(nil)
+	}
+
+	return out[:length]
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendBytes16(b []byte, v []byte) []byte {
+	return append(appendUint16(b, uint16(len(v))), v...)
+}
+
+func contains(list []uint16, v uint16) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reader is a simple reader for handshake messages. A failed read sets the
+// reader to nil.
+type reader []byte
+
+func (r *reader) ok() bool {
+	return *r != nil
+}
+
+func (r *reader) uint8() uint8 {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+
+	return b[0]
+}
+
+func (r *reader) uint16() uint16 {
+	b := r.bytes(2)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint16(b)
+}
+
+func (r *reader) bytes(n int) []byte {
+	// check length
+	if *r == nil || len(*r) < n {
+		*r = nil
+		return nil
+	}
+
+	// get bytes
+	b := (*r)[:n:n]
+	*r = (*r)[n:]
+
+	return b
+}
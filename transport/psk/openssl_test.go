@@ -0,0 +1,142 @@
+package psk
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"net"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var openSSLSuites = map[uint16]string{
+	TLS_PSK_WITH_AES_128_GCM_SHA256: "PSK-AES128-GCM-SHA256",
+	TLS_PSK_WITH_AES_256_GCM_SHA384: "PSK-AES256-GCM-SHA384",
+}
+
+func openSSL(t *testing.T, args ...string) (func(), io.WriteCloser, *bufio.Reader) {
+	// check binary
+	path, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Skip("openssl not available")
+	}
+
+	// prepare command
+	cmd := exec.Command(path, args...)
+	stdin, err := cmd.StdinPipe()
+	require.NoError(t, err)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	cmd.Stderr = cmd.Stdout
+
+	// start command
+	err = cmd.Start()
+	require.NoError(t, err)
+
+	// kill process if the test hangs
+	timer := time.AfterFunc(10*time.Second, func() {
+		_ = cmd.Process.Kill()
+	})
+
+	// prepare stop function
+	stop := func() {
+		timer.Stop()
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}
+
+	return stop, stdin, bufio.NewReader(stdout)
+}
+
+func readLineWith(t *testing.T, reader *bufio.Reader, substr string) string {
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+
+		if strings.Contains(line, substr) {
+			return line
+		}
+	}
+}
+
+func TestOpenSSLServer(t *testing.T) {
+	for suite, name := range openSSLSuites {
+		stop, _, stdout := openSSL(t, "s_server", "-accept", "0", "-naccept", "1", "-nocert",
+			"-psk", hex.EncodeToString(testKey), "-psk_hint", "gomqtt",
+			"-tls1_2", "-cipher", name, "-rev")
+
+		// get port
+		line := readLineWith(t, stdout, "ACCEPT")
+		port := line[strings.LastIndex(line, ":")+1 : len(line)-1]
+
+		conn, err := net.Dial("tcp", "localhost:"+port)
+		require.NoError(t, err)
+
+		var hint string
+		client := Client(conn, &Config{
+			ClientKey: func(h string) (string, []byte, error) {
+				hint = h
+				return "client1", testKey, nil
+			},
+			CipherSuites: []uint16{suite},
+		})
+
+		_, err = client.Write([]byte("hello\n"))
+		require.NoError(t, err)
+
+		line, err = bufio.NewReader(client).ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "olleh\n", line)
+		assert.Equal(t, "gomqtt", hint)
+
+		err = client.Close()
+		assert.NoError(t, err)
+
+		stop()
+	}
+}
+
+func TestOpenSSLClient(t *testing.T) {
+	for suite, name := range openSSLSuites {
+		listener, err := net.Listen("tcp", "localhost:0")
+		require.NoError(t, err)
+
+		serverConfig := ServerConfig(map[string][]byte{"client1": testKey})
+		serverConfig.CipherSuites = []uint16{suite}
+
+		stop, stdin, stdout := openSSL(t, "s_client", "-connect", listener.Addr().String(),
+			"-psk_identity", "client1", "-psk", hex.EncodeToString(testKey),
+			"-tls1_2", "-cipher", name, "-quiet")
+
+		conn, err := NewListener(listener, serverConfig).Accept()
+		require.NoError(t, err)
+
+		_, err = stdin.Write([]byte("hello\n"))
+		require.NoError(t, err)
+
+		reader := bufio.NewReader(conn)
+		line, err := reader.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "hello\n", line)
+		assert.Equal(t, "client1", conn.(*Conn).Identity())
+
+		_, err = conn.Write([]byte("world\n"))
+		assert.NoError(t, err)
+
+		line = readLineWith(t, stdout, "world")
+		assert.Equal(t, "world\n", line)
+
+		err = conn.Close()
+		assert.NoError(t, err)
+
+		err = listener.Close()
+		assert.NoError(t, err)
+
+		stop()
+	}
+}
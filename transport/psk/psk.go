@@ -0,0 +1,129 @@
+// Package psk implements TLS 1.2 with pre-shared keys as specified in RFC 4279
+// and RFC 5487. The crypto/tls package does not support PSK cipher suites,
+// which are commonly used by constrained devices instead of certificates.
+//
+// Only the plain PSK key exchange with the AES-GCM cipher suites is supported.
+// Session resumption and renegotiation are not supported.
+package psk
+
+import (
+	"errors"
+	"net"
+)
+
+// The supported cipher suites.
+const (
+	TLS_PSK_WITH_AES_128_GCM_SHA256 uint16 = 0x00a8
+	TLS_PSK_WITH_AES_256_GCM_SHA384 uint16 = 0x00a9
+)
+
+// ErrUnknownIdentity may be returned by a server key callback if the identity
+// is not known.
+var ErrUnknownIdentity = errors.New("unknown identity")
+
+// ErrMissingCallback is returned by the handshake if the key callback for the
+// side of the connection is not configured.
+var ErrMissingCallback = errors.New("missing key callback")
+
+// A Config configures a client or server connection.
+type Config struct {
+	// ClientKey is called by clients with the identity hint sent by the
+	// server, which may be empty. It must return the identity and key that
+	// are used to authenticate.
+	ClientKey func(hint string) (identity string, key []byte, err error)
+
+	// Hint is sent by servers to help clients select an identity.
+	Hint string
+
+	// ServerKey is called by servers with the identity sent by the client. It
+	// must return the key of the identity or ErrUnknownIdentity.
+	ServerKey func(identity string) (key []byte, err error)
+
+	// The cipher suites in order of preference.
+	//
+	// Will default to TLS_PSK_WITH_AES_128_GCM_SHA256 and
+	// TLS_PSK_WITH_AES_256_GCM_SHA384.
+	CipherSuites []uint16
+}
+
+// ClientConfig returns a client config that always authenticates using the
+// specified identity and key.
+func ClientConfig(identity string, key []byte) *Config {
+	return &Config{
+		ClientKey: func(string) (string, []byte, error) {
+			return identity, key, nil
+		},
+	}
+}
+
+// ServerConfig returns a server config that looks up the keys of clients in
+// the specified map.
+func ServerConfig(keys map[string][]byte) *Config {
+	return &Config{
+		ServerKey: func(identity string) ([]byte, error) {
+			key, ok := keys[identity]
+			if !ok {
+				return nil, ErrUnknownIdentity
+			}
+
+			return key, nil
+		},
+	}
+}
+
+func (c *Config) cipherSuites() []uint16 {
+	// check suites
+	if len(c.CipherSuites) > 0 {
+		return c.CipherSuites
+	}
+
+	return []uint16{
+		TLS_PSK_WITH_AES_128_GCM_SHA256,
+		TLS_PSK_WITH_AES_256_GCM_SHA384,
+	}
+}
+
+// Client returns a new client side connection that uses conn as the
+// underlying transport. The handshake is performed with the first read or
+// write or by calling Handshake.
+func Client(conn net.Conn, config *Config) *Conn {
+	return &Conn{
+		conn:   conn,
+		config: config,
+		client: true,
+	}
+}
+
+// Server returns a new server side connection that uses conn as the
+// underlying transport. The handshake is performed with the first read or
+// write or by calling Handshake.
+func Server(conn net.Conn, config *Config) *Conn {
+	return &Conn{
+		conn:   conn,
+		config: config,
+	}
+}
+
+// NewListener returns a listener that wraps accepted connections using
+// Server.
+func NewListener(listener net.Listener, config *Config) net.Listener {
+	return &pskListener{
+		Listener: listener,
+		config:   config,
+	}
+}
+
+type pskListener struct {
+	net.Listener
+	config *Config
+}
+
+func (l *pskListener) Accept() (net.Conn, error) {
+	// accept connection
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return Server(conn, l.config), nil
+}
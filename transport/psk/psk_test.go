@@ -0,0 +1,202 @@
+package psk
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testKey = []byte{0x1a, 0x2b, 0x3c, 0x4d}
+
+func pair(t *testing.T, clientConfig, serverConfig *Config) (*Conn, *Conn) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+
+	serverConn, err := NewListener(listener, serverConfig).Accept()
+	require.NoError(t, err)
+
+	return Client(conn, clientConfig), serverConn.(*Conn)
+}
+
+func handshake(client, server *Conn) (error, error) {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Handshake()
+	}()
+
+	err := client.Handshake()
+
+	return err, <-errCh
+}
+
+func TestConn(t *testing.T) {
+	for _, suite := range []uint16{TLS_PSK_WITH_AES_128_GCM_SHA256, TLS_PSK_WITH_AES_256_GCM_SHA384} {
+		var hint string
+		clientConfig := &Config{
+			ClientKey: func(h string) (string, []byte, error) {
+				hint = h
+				return "client1", testKey, nil
+			},
+			CipherSuites: []uint16{suite},
+		}
+
+		serverConfig := ServerConfig(map[string][]byte{"client1": testKey})
+		serverConfig.Hint = "gomqtt"
+
+		client, server := pair(t, clientConfig, serverConfig)
+
+		// send more than a single record
+		data := bytes.Repeat([]byte("x"), 3*maxPlaintext)
+
+		errCh := make(chan error, 1)
+		go func() {
+			buf := make([]byte, len(data))
+			_, err := io.ReadFull(server, buf)
+			if err == nil {
+				_, err = server.Write(buf)
+			}
+			errCh <- err
+		}()
+
+		n, err := client.Write(data)
+		assert.NoError(t, err)
+		assert.Equal(t, len(data), n)
+
+		buf := make([]byte, len(data))
+		_, err = io.ReadFull(client, buf)
+		assert.NoError(t, err)
+		assert.Equal(t, data, buf)
+		assert.NoError(t, <-errCh)
+
+		assert.Equal(t, "gomqtt", hint)
+		assert.Equal(t, "client1", client.Identity())
+		assert.Equal(t, "client1", server.Identity())
+
+		err = client.Close()
+		assert.NoError(t, err)
+
+		rest, err := ioutil.ReadAll(server)
+		assert.NoError(t, err)
+		assert.Empty(t, rest)
+
+		err = server.Close()
+		assert.NoError(t, err)
+	}
+}
+
+func TestConnUnknownIdentity(t *testing.T) {
+	client, server := pair(t, ClientConfig("client2", testKey), ServerConfig(map[string][]byte{
+		"client1": testKey,
+	}))
+
+	clientErr, serverErr := handshake(client, server)
+	assert.Equal(t, &AlertError{Description: alertUnknownPSKIdentity}, clientErr)
+	assert.Equal(t, ErrUnknownIdentity, serverErr)
+	assert.Empty(t, server.Identity())
+
+	_ = client.Close()
+	_ = server.Close()
+}
+
+func TestConnWrongKey(t *testing.T) {
+	client, server := pair(t, ClientConfig("client1", []byte("foo")), ServerConfig(map[string][]byte{
+		"client1": testKey,
+	}))
+
+	clientErr, serverErr := handshake(client, server)
+	assert.Error(t, clientErr)
+	assert.Error(t, serverErr)
+
+	_ = client.Close()
+	_ = server.Close()
+}
+
+func TestConnNoSharedCipherSuite(t *testing.T) {
+	clientConfig := ClientConfig("client1", testKey)
+	clientConfig.CipherSuites = []uint16{TLS_PSK_WITH_AES_128_GCM_SHA256}
+
+	serverConfig := ServerConfig(map[string][]byte{"client1": testKey})
+	serverConfig.CipherSuites = []uint16{TLS_PSK_WITH_AES_256_GCM_SHA384}
+
+	client, server := pair(t, clientConfig, serverConfig)
+
+	clientErr, serverErr := handshake(client, server)
+	assert.Equal(t, &AlertError{Description: alertHandshakeFailure}, clientErr)
+	assert.Error(t, serverErr)
+
+	_ = client.Close()
+	_ = server.Close()
+}
+
+func TestConnMissingCallback(t *testing.T) {
+	client, server := pair(t, &Config{}, &Config{})
+
+	err := client.Handshake()
+	assert.Equal(t, ErrMissingCallback, err)
+
+	err = server.Handshake()
+	assert.Equal(t, ErrMissingCallback, err)
+
+	_ = client.Close()
+	_ = server.Close()
+}
+
+func TestPRF(t *testing.T) {
+	// common TLS 1.2 PRF test vector for SHA-256
+	secret := []byte{0x9b, 0xbe, 0x43, 0x6b, 0xa9, 0x40, 0xf0, 0x17, 0xb1, 0x76, 0x52, 0x84, 0x9a, 0x71, 0xdb, 0x35}
+	seed := []byte{0xa0, 0xba, 0x9f, 0x93, 0x6c, 0xda, 0x31, 0x18, 0x27, 0xa6, 0xf7, 0x96, 0xff, 0xd5, 0x19, 0x8c}
+	expected := []byte{0xe3, 0xf2, 0x29, 0xba, 0x72, 0x7b, 0xe1, 0x7b, 0x8d, 0x12, 0x26, 0x20, 0x55, 0x7c, 0xd4, 0x53}
+
+	out := prf(suites[0].hash, secret, "test label", seed, 100)
+	assert.Len(t, out, 100)
+	assert.Equal(t, expected, out[:16])
+}
+
+func TestConnCloseDuringHandshake(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	// connect a peer that never sends anything
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	serverConn, err := NewListener(listener, ServerConfig(nil)).Accept()
+	require.NoError(t, err)
+	server := serverConn.(*Conn)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Handshake()
+	}()
+
+	// wait for the handshake to block
+	time.Sleep(10 * time.Millisecond)
+	assert.Empty(t, server.Identity())
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- server.Close()
+	}()
+
+	select {
+	case err = <-closed:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		assert.Fail(t, "close blocked on handshake")
+	}
+
+	assert.Error(t, <-errCh)
+	assert.Empty(t, server.Identity())
+}
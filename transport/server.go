@@ -1,6 +1,11 @@
 package transport
 
-import "net"
+import (
+	"errors"
+	"net"
+)
+
+var errManualClose = errors.New("internal: manual close")
 
 // A Server is a local port on which incoming connections can be accepted.
 type Server interface {
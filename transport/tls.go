@@ -0,0 +1,72 @@
+package transport
+
+import (
+	"crypto/tls"
+
+	"github.com/256dpi/gomqtt/transport/psk"
+)
+
+// TLSConnectionState returns the state of the TLS connection that underlies
+// the specified connection. It will return nil if the connection is not
+// encrypted or the handshake has not yet been completed.
+//
+// Note: Server side handshakes are performed lazily with the first read. The
+// state is therefore only available once the first packet has been received.
+func TLSConnectionState(conn Conn) *tls.ConnectionState {
+	// unwrap wrapped connections
+	conn = unwrap(conn)
+
+	// get tls connection
+	var tlsConn *tls.Conn
+	switch c := conn.(type) {
+	case *NetConn:
+		tlsConn, _ = c.UnderlyingConn().(*tls.Conn)
+	default:
+		tlsConn = webSocketTLSConn(conn)
+	}
+
+	// check connection
+	if tlsConn == nil {
+		return nil
+	}
+
+	// get state
+	state := tlsConn.ConnectionState()
+	if !state.HandshakeComplete {
+		return nil
+	}
+
+	return &state
+}
+
+// PSKIdentity returns the identity that has been used to authenticate the
+// TLS-PSK connection that underlies the specified connection. It will return
+// an empty string if the connection does not use TLS-PSK or the handshake has
+// not yet been completed.
+func PSKIdentity(conn Conn) string {
+	// unwrap wrapped connections
+	conn = unwrap(conn)
+
+	// get psk connection
+	nc, ok := conn.(*NetConn)
+	if !ok {
+		return ""
+	}
+	pskConn, ok := nc.UnderlyingConn().(*psk.Conn)
+	if !ok {
+		return ""
+	}
+
+	return pskConn.Identity()
+}
+
+// unwrap returns the innermost connection of wrapped connections
+func unwrap(conn Conn) Conn {
+	for {
+		wc, ok := conn.(WrappedConn)
+		if !ok {
+			return conn
+		}
+		conn = wc.Unwrap()
+	}
+}
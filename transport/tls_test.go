@@ -0,0 +1,70 @@
+package transport
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/256dpi/gomqtt/packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func abstractTLSConnectionStateTest(t *testing.T, protocol string) {
+	server, err := testLauncher.Launch(protocol + "://localhost:0")
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+
+	go func() {
+		conn, err := server.Accept()
+		require.NoError(t, err)
+
+		pkt, err := conn.Receive()
+		assert.NoError(t, err)
+		assert.Equal(t, packet.CONNECT, pkt.Type())
+
+		state := TLSConnectionState(Intercept(conn, Interceptor{}))
+		if protocol == "tcp" || protocol == "ws" {
+			assert.Nil(t, state)
+		} else if assert.NotNil(t, state) {
+			assert.True(t, state.Version >= tls.VersionTLS12)
+			assert.Equal(t, "localhost", state.ServerName)
+			assert.Empty(t, state.PeerCertificates)
+		}
+
+		err = conn.Close()
+		assert.NoError(t, err)
+
+		close(done)
+	}()
+
+	dialer := NewDialer()
+	dialer.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+
+	conn, err := dialer.Dial(protocol + "://localhost:" + getPort(server))
+	require.NoError(t, err)
+
+	state := TLSConnectionState(conn)
+	if protocol == "tcp" || protocol == "ws" {
+		assert.Nil(t, state)
+	} else if assert.NotNil(t, state) {
+		assert.NotEmpty(t, state.PeerCertificates)
+	}
+
+	err = conn.Send(packet.NewConnect(), false)
+	assert.NoError(t, err)
+
+	safeReceive(done)
+
+	err = server.Close()
+	assert.NoError(t, err)
+}
+
+func TestTLSConnectionStateTCP(t *testing.T) {
+	abstractTLSConnectionStateTest(t, "tcp")
+}
+
+func TestTLSConnectionStateTLS(t *testing.T) {
+	abstractTLSConnectionStateTest(t, "tls")
+}
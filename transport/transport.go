@@ -1,4 +1,7 @@
 // Package transport implements functionality for handling MQTT connections.
+//
+// When compiled for WebAssembly (GOOS=js GOARCH=wasm) the Dialer opens "ws"
+// and "wss" connections using the WebSocket API of the browser.
 package transport
 
 import "errors"
@@ -7,8 +10,13 @@ import "errors"
 // couldn't infer the protocol from the URL.
 var ErrUnsupportedProtocol = errors.New("unsupported protocol")
 
-// ErrAcceptAfterClose can be returned by a WebSocketServer during Accept()
-// if the server has been already closed and the internal goroutine is dying.
+// ErrNotBinary may be returned by WebSocket connection when a message is
+// received that is not binary.
+var ErrNotBinary = errors.New("received web socket message is not binary")
+
+// ErrAcceptAfterClose can be returned by a WebSocketServer or MultiServer
+// during Accept() if the server has been already closed and the internal
+// goroutine is dying.
 //
 // Note: this error is wrapped in an Error with NetworkError code.
 var ErrAcceptAfterClose = errors.New("accept after close")
@@ -0,0 +1,16 @@
+//go:build gomqtt_lite
+// +build gomqtt_lite
+
+package transport
+
+import "net"
+
+// writes raw bytes to the underlying connection
+func writeRaw(conn Conn, buf []byte) {
+	if netConn, ok := conn.(*NetConn); ok {
+		netConn.conn.Write(buf)
+	}
+}
+
+// websockets are not available in lite builds
+func setWebSocketNetDial(*Dialer, func(network, addr string) (net.Conn, error)) {}
@@ -0,0 +1,24 @@
+//go:build !gomqtt_lite
+// +build !gomqtt_lite
+
+package transport
+
+import (
+	"net"
+
+	"github.com/gorilla/websocket"
+)
+
+// writes raw bytes to the underlying connection
+func writeRaw(conn Conn, buf []byte) {
+	if netConn, ok := conn.(*NetConn); ok {
+		netConn.conn.Write(buf)
+	} else if webSocketConn, ok := conn.(*WebSocketConn); ok {
+		webSocketConn.conn.WriteMessage(websocket.BinaryMessage, buf)
+	}
+}
+
+// sets the function used to dial the connections of websockets
+func setWebSocketNetDial(dialer *Dialer, fn func(network, addr string) (net.Conn, error)) {
+	dialer.webSocketDialer.NetDial = fn
+}
@@ -1,17 +1,41 @@
+//go:build !gomqtt_lite
+// +build !gomqtt_lite
+
 package transport
 
 import (
-	"errors"
+	"crypto/tls"
 	"io"
 	"net"
+	"net/http"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-// ErrNotBinary may be returned by WebSocket connection when a message is
-// received that is not binary.
-var ErrNotBinary = errors.New("received web socket message is not binary")
+type wsDialer = websocket.Dialer
+
+type requestHeader = http.Header
+
+func newWebSocketDialer() *wsDialer {
+	return &websocket.Dialer{
+		Proxy:        http.ProxyFromEnvironment,
+		Subprotocols: []string{"mqtt"},
+	}
+}
+
+// webSocketTLSConn returns the underlying TLS connection of a WebSocketConn.
+func webSocketTLSConn(conn Conn) *tls.Conn {
+	// check connection
+	c, ok := conn.(*WebSocketConn)
+	if !ok {
+		return nil
+	}
+
+	tlsConn, _ := c.UnderlyingConn().UnderlyingConn().(*tls.Conn)
+
+	return tlsConn
+}
 
 type wsStream struct {
 	conn   *websocket.Conn
@@ -93,6 +117,10 @@ func (s *wsStream) SetReadDeadline(t time.Time) error {
 	return s.conn.SetReadDeadline(t)
 }
 
+func (s *wsStream) SetWriteDeadline(t time.Time) error {
+	return s.conn.SetWriteDeadline(t)
+}
+
 // The WebSocketConn wraps a websocket.Conn. The implementation supports packets
 // that are chunked over several WebSocket messages and packets that are coalesced
 // to one WebSocket message.
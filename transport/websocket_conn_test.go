@@ -1,3 +1,6 @@
+//go:build !gomqtt_lite
+// +build !gomqtt_lite
+
 package transport
 
 import (
@@ -46,6 +49,22 @@ func TestWebSocketConnReadTimeout(t *testing.T) {
 	abstractConnReadTimeoutTest(t, "ws")
 }
 
+func TestWebSocketConnWriteTimeout(t *testing.T) {
+	abstractConnWriteTimeoutTest(t, "ws")
+}
+
+func TestWebSocketConnBufferSizes(t *testing.T) {
+	abstractConnBufferSizesTest(t, "ws")
+}
+
+func TestWebSocketConnFlush(t *testing.T) {
+	abstractConnFlushTest(t, "ws")
+}
+
+func TestWebSocketConnBufferedSend(t *testing.T) {
+	abstractConnBufferedSendTest(t, "ws")
+}
+
 func TestWebSocketConnCloseAfterClose(t *testing.T) {
 	abstractConnCloseAfterCloseTest(t, "ws")
 }
@@ -220,3 +239,11 @@ func BenchmarkWebSocketConnAsync(b *testing.B) {
 
 	safeReceive(done)
 }
+
+func TestWSDefaultPort(t *testing.T) {
+	abstractDefaultPortTest(t, "ws")
+}
+
+func TestWSSDefaultPort(t *testing.T) {
+	abstractDefaultPortTest(t, "wss")
+}
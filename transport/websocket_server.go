@@ -1,8 +1,10 @@
+//go:build !gomqtt_lite
+// +build !gomqtt_lite
+
 package transport
 
 import (
 	"crypto/tls"
-	"errors"
 	"net"
 	"net/http"
 	"time"
@@ -11,8 +13,6 @@ import (
 	"gopkg.in/tomb.v2"
 )
 
-var errManualClose = errors.New("internal: manual close")
-
 // The WebSocketServer accepts websocket.Conn based connections.
 type WebSocketServer struct {
 	MaxWriteDelay time.Duration
@@ -61,6 +61,32 @@ func NewWebSocketServer(listener net.Listener) *WebSocketServer {
 	return ws
 }
 
+// launchWebSocket creates a WS or WSS server if a TLS config is provided.
+func launchWebSocket(address string, config *tls.Config) (Server, error) {
+	// create secure server
+	if config != nil {
+		server, err := CreateSecureWebSocketServer(address, config)
+		if err != nil {
+			return nil, err
+		}
+
+		return server, nil
+	}
+
+	// create server
+	server, err := CreateWebSocketServer(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return server, nil
+}
+
+// newWebSocketServer wraps the provided listener in a WebSocketServer.
+func newWebSocketServer(listener net.Listener) (Server, error) {
+	return NewWebSocketServer(listener), nil
+}
+
 // CreateWebSocketServer creates a new WS server that listens on the provided address.
 func CreateWebSocketServer(address string) (*WebSocketServer, error) {
 	listener, err := net.Listen("tcp", address)
@@ -1,3 +1,6 @@
+//go:build !gomqtt_lite
+// +build !gomqtt_lite
+
 package transport
 
 import (
@@ -139,3 +142,19 @@ func TestWebSocketOriginChecker(t *testing.T) {
 	require.Error(t, err)
 	require.Nil(t, conn)
 }
+
+func TestLauncherProxyProtocolWS(t *testing.T) {
+	abstractLauncherProxyProtocolTest(t, "ws")
+}
+
+func TestLauncherProxyProtocolWSS(t *testing.T) {
+	abstractLauncherProxyProtocolTest(t, "wss")
+}
+
+func TestTLSConnectionStateWS(t *testing.T) {
+	abstractTLSConnectionStateTest(t, "ws")
+}
+
+func TestTLSConnectionStateWSS(t *testing.T) {
+	abstractTLSConnectionStateTest(t, "wss")
+}